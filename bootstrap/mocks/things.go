@@ -54,6 +54,10 @@ func (svc *mainfluxThings) CreateThings(_ context.Context, owner string, ths ...
 	return ths, nil
 }
 
+func (svc *mainfluxThings) SaveBestEffort(context.Context, string, ...things.Thing) ([]things.Result, error) {
+	panic("not implemented")
+}
+
 func (svc *mainfluxThings) ViewThing(_ context.Context, owner, id string) (things.Thing, error) {
 	svc.mu.Lock()
 	defer svc.mu.Unlock()
@@ -176,7 +180,15 @@ func (svc *mainfluxThings) ListChannelsByThing(context.Context, string, string,
 	panic("not implemented")
 }
 
-func (svc *mainfluxThings) ListThingsByChannel(context.Context, string, string, uint64, uint64, bool) (things.Page, error) {
+func (svc *mainfluxThings) ListConnectionEventsByThing(context.Context, string, string, uint64, uint64) (things.ConnectionEventsPage, error) {
+	panic("not implemented")
+}
+
+func (svc *mainfluxThings) ListConnectionEventsByChannel(context.Context, string, string, uint64, uint64) (things.ConnectionEventsPage, error) {
+	panic("not implemented")
+}
+
+func (svc *mainfluxThings) ListThingsByChannel(context.Context, string, string, bool, things.PageMetadata) (things.Page, error) {
 	panic("not implemented")
 }
 
@@ -222,6 +234,10 @@ func (svc *mainfluxThings) Identify(context.Context, string) (string, error) {
 	panic("not implemented")
 }
 
+func (svc *mainfluxThings) ConnectionsByKey(context.Context, string) ([]string, error) {
+	panic("not implemented")
+}
+
 func findIndex(list []string, val string) int {
 	for i, v := range list {
 		if v == val {
@@ -236,6 +252,22 @@ func (svc *mainfluxThings) CreateGroup(ctx context.Context, token string, g grou
 	panic("not implemented")
 }
 
+func (svc *mainfluxThings) RebuildConnectionCache(context.Context, string) (things.CacheReport, error) {
+	panic("not implemented")
+}
+
+func (svc *mainfluxThings) CountAll(context.Context, string) (uint64, uint64, uint64, error) {
+	panic("not implemented")
+}
+
+func (svc *mainfluxThings) ReconcileGroups(context.Context, string, string) (things.GroupReport, error) {
+	panic("not implemented")
+}
+
+func (svc *mainfluxThings) RetrieveGroupContents(context.Context, string, string, things.PageMetadata) (things.GroupContents, error) {
+	panic("not implemented")
+}
+
 func (svc *mainfluxThings) UpdateGroup(ctx context.Context, token string, g groups.Group) (groups.Group, error) {
 	panic("not implemented")
 }
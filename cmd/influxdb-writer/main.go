@@ -4,132 +4,585 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"syscall"
+	"time"
 
+	"github.com/BurntSushi/toml"
 	kitprometheus "github.com/go-kit/kit/metrics/prometheus"
 	influxdata "github.com/influxdata/influxdb/client/v2"
 	"github.com/mainflux/mainflux"
 	"github.com/mainflux/mainflux/logger"
+	"github.com/mainflux/mainflux/pkg/env"
+	"github.com/mainflux/mainflux/pkg/errors"
 	"github.com/mainflux/mainflux/pkg/messaging/nats"
+	"github.com/mainflux/mainflux/pkg/servers"
+	"github.com/mainflux/mainflux/pkg/transformers"
+	mfjson "github.com/mainflux/mainflux/pkg/transformers/json"
 	"github.com/mainflux/mainflux/pkg/transformers/senml"
 	"github.com/mainflux/mainflux/writers"
 	"github.com/mainflux/mainflux/writers/api"
 	"github.com/mainflux/mainflux/writers/influxdb"
+	broker "github.com/nats-io/nats.go"
 	stdprometheus "github.com/prometheus/client_golang/prometheus"
 )
 
 const (
 	svcName = "influxdb-writer"
 
-	defNatsURL     = "nats://localhost:4222"
-	defLogLevel    = "error"
-	defPort        = "8180"
-	defDB          = "mainflux"
-	defDBHost      = "localhost"
-	defDBPort      = "8086"
-	defDBUser      = "mainflux"
-	defDBPass      = "mainflux"
-	defConfigPath  = "/config.toml"
-	defContentType = "application/senml+json"
-
-	envNatsURL     = "MF_NATS_URL"
-	envLogLevel    = "MF_INFLUX_WRITER_LOG_LEVEL"
-	envPort        = "MF_INFLUX_WRITER_PORT"
-	envDB          = "MF_INFLUX_WRITER_DB"
+	defPingTimeout = 5 * time.Second
+	defMaxInterval = 30 * time.Second
+
+	envConsistency = "MF_INFLUX_WRITER_WRITE_CONSISTENCY"
+	envTSPolicy    = "MF_INFLUX_WRITER_TIMESTAMP_POLICY"
+	envRetention   = "MF_INFLUX_WRITER_RETENTION_CONFIG"
+	envStatus      = "MF_INFLUX_WRITER_STATUS_ACTIONS"
 	envDBHost      = "MF_INFLUX_WRITER_DB_HOST"
 	envDBPort      = "MF_INFLUX_WRITER_DB_PORT"
-	envDBUser      = "MF_INFLUX_WRITER_DB_USER"
-	envDBPass      = "MF_INFLUX_WRITER_DB_PASS"
-	envConfigPath  = "MF_INFLUX_WRITER_CONFIG_PATH"
-	envContentType = "MF_INFLUX_WRITER_CONTENT_TYPE"
+	envDBURLs      = "MF_INFLUX_WRITER_DB_URLS"
+	envSecondary   = "MF_INFLUX_WRITER_SECONDARY_DB_URL"
+)
+
+var (
+	errNatsDisconnected = errors.New("not connected to NATS")
+	errInvalidDB        = errors.New("invalid InfluxDB configuration")
 )
 
 type config struct {
-	natsURL     string
-	logLevel    string
-	port        string
-	dbName      string
-	dbHost      string
-	dbPort      string
-	dbUser      string
-	dbPass      string
-	configPath  string
-	contentType string
+	NatsURL       string                  `env:"MF_NATS_URL" envDefault:"nats://localhost:4222"`
+	NatsQueue     string                  `env:"MF_NATS_QUEUE_GROUP" envDefault:"influxdb-writer"`
+	NatsCACert    string                  `env:"MF_INFLUX_WRITER_NATS_CA_CERTS"`
+	NatsCert      string                  `env:"MF_INFLUX_WRITER_NATS_CLIENT_CERT"`
+	NatsKey       string                  `env:"MF_INFLUX_WRITER_NATS_CLIENT_KEY"`
+	NatsServer    string                  `env:"MF_INFLUX_WRITER_NATS_SERVER_NAME"`
+	NatsConnName  string                  `env:"MF_NATS_CONN_NAME"`
+	LogLevel      string                  `env:"MF_INFLUX_WRITER_LOG_LEVEL" envDefault:"error"`
+	Port          string                  `env:"MF_INFLUX_WRITER_PORT" envDefault:"8180"`
+	DBName        string                  `env:"MF_INFLUX_WRITER_DB" envDefault:"mainflux"`
+	DBHost        string                  `env:"MF_INFLUX_WRITER_DB_HOST" envDefault:"localhost"`
+	DBPort        string                  `env:"MF_INFLUX_WRITER_DB_PORT" envDefault:"8086"`
+	DBUser        string                  `env:"MF_INFLUX_WRITER_DB_USER" envDefault:"mainflux"`
+	DBPass        string                  `env:"MF_INFLUX_WRITER_DB_PASS" envDefault:"mainflux"`
+	DBURLs        []string                `env:"MF_INFLUX_WRITER_DB_URLS"`
+	DBCreate      bool                    `env:"MF_INFLUX_WRITER_DB_CREATE" envDefault:"false"`
+	DBDuration    time.Duration           `env:"MF_INFLUX_WRITER_DB_DURATION" envDefault:"0s" validate:"min=0s"`
+	DBRetries     int                     `env:"MF_INFLUX_WRITER_DB_CONNECT_RETRIES" envDefault:"5" validate:"min=0"`
+	DBInterval    time.Duration           `env:"MF_INFLUX_WRITER_DB_CONNECT_INTERVAL" envDefault:"1s" validate:"min=1ns"`
+	ConfigPath    string                  `env:"MF_INFLUX_WRITER_CONFIG_PATH" envDefault:"/config.toml"`
+	ContentType   string                  `env:"MF_INFLUX_WRITER_CONTENT_TYPE" envDefault:"application/senml+json"`
+	Transformer   string                  `env:"MF_INFLUX_WRITER_TRANSFORMER" envDefault:"senml" validate:"oneof=senml json"`
+	StopTimeout   time.Duration           `env:"MF_INFLUX_WRITER_STOP_TIMEOUT" envDefault:"10s"`
+	UnitAsTag     bool                    `env:"MF_INFLUX_WRITER_UNIT_AS_TAG" envDefault:"false"`
+	QueueSize     int                     `env:"MF_INFLUX_WRITER_QUEUE_SIZE" envDefault:"0" validate:"min=0"`
+	RetentionPath string                  `env:"MF_INFLUX_WRITER_RETENTION_CONFIG"`
+	Ingestion     bool                    `env:"MF_INFLUX_WRITER_INGESTION_TIME" envDefault:"false"`
+	DedupWindow   time.Duration           `env:"MF_INFLUX_WRITER_DEDUP_WINDOW" envDefault:"0s"`
+	DedupSize     int                     `env:"MF_INFLUX_WRITER_DEDUP_SIZE" envDefault:"10000" validate:"min=1"`
+	ValueField    string                  `env:"MF_INFLUX_WRITER_VALUE_FIELD" envDefault:"value"`
+	Consistency   string                  `env:"MF_INFLUX_WRITER_WRITE_CONSISTENCY"`
+	Precision     string                  `env:"MF_INFLUX_WRITER_PRECISION" envDefault:"ns" validate:"oneof=ns us ms s"`
+	Measurement   string                  `env:"MF_INFLUX_WRITER_MEASUREMENT" envDefault:"messages"`
+	TSPolicy      writers.TimestampPolicy `env:"MF_INFLUX_WRITER_TIMESTAMP_POLICY" envDefault:"accept"`
+	FutureSkew    time.Duration           `env:"MF_INFLUX_WRITER_MAX_FUTURE_SKEW" envDefault:"0s" validate:"min=0s"`
+	PastSkew      time.Duration           `env:"MF_INFLUX_WRITER_MAX_PAST_SKEW" envDefault:"0s" validate:"min=0s"`
+	Geohash       int                     `env:"MF_INFLUX_WRITER_GEOHASH_PRECISION" envDefault:"0" validate:"min=0,max=12"`
+	BatchSize     int                     `env:"MF_INFLUX_WRITER_BATCH_SIZE" envDefault:"0" validate:"min=0"`
+	FlushInterval time.Duration           `env:"MF_INFLUX_WRITER_FLUSH_INTERVAL" envDefault:"1s" validate:"min=0s"`
+	LogFirst      int                     `env:"MF_INFLUX_WRITER_LOG_SAMPLING_FIRST" envDefault:"0" validate:"min=0"`
+	LogEvery      int                     `env:"MF_INFLUX_WRITER_LOG_SAMPLING_EVERY" envDefault:"100" validate:"min=0"`
+	LogInterval   time.Duration           `env:"MF_INFLUX_WRITER_LOG_SAMPLING_INTERVAL" envDefault:"1m" validate:"min=1s"`
+	Admin         bool                    `env:"MF_INFLUX_WRITER_ADMIN" envDefault:"false"`
+	Root          bool                    `env:"MF_INFLUX_WRITER_ROOT" envDefault:"false"`
+	SecondaryURL  string                  `env:"MF_INFLUX_WRITER_SECONDARY_DB_URL"`
+	SecondaryDB   string                  `env:"MF_INFLUX_WRITER_SECONDARY_DB"`
+	SecondaryUser string                  `env:"MF_INFLUX_WRITER_SECONDARY_DB_USER" envDefault:"mainflux"`
+	SecondaryPass string                  `env:"MF_INFLUX_WRITER_SECONDARY_DB_PASS" envDefault:"mainflux"`
+	FanoutPolicy  writers.FanoutPolicy    `env:"MF_INFLUX_WRITER_FANOUT_POLICY" envDefault:"all" validate:"oneof=all best_effort"`
+	MaxTagLength  int                     `env:"MF_INFLUX_WRITER_MAX_TAG_LENGTH" envDefault:"0" validate:"min=0"`
+	TagPolicy     influxdb.TagPolicy      `env:"MF_INFLUX_WRITER_TAG_POLICY" envDefault:"truncate" validate:"oneof=truncate reject"`
+	StatusActions string                  `env:"MF_INFLUX_WRITER_STATUS_ACTIONS"`
+	WriteRetries  int                     `env:"MF_INFLUX_WRITER_WRITE_RETRIES" envDefault:"3" validate:"min=0"`
+	RetryBackoff  time.Duration           `env:"MF_INFLUX_WRITER_RETRY_BACKOFF" envDefault:"100ms" validate:"min=0s"`
+	MaxBackoff    time.Duration           `env:"MF_INFLUX_WRITER_MAX_RETRY_BACKOFF" envDefault:"10s" validate:"min=0s"`
+	DLQSubject    string                  `env:"MF_INFLUX_WRITER_DLQ_SUBJECT"`
+	SubjectPolicy writers.SubjectPolicy   `env:"MF_INFLUX_WRITER_SUBJECT_POLICY" envDefault:"dead_letter" validate:"oneof=dead_letter default"`
+	DefChannel    string                  `env:"MF_INFLUX_WRITER_DEFAULT_CHANNEL" envDefault:"unknown"`
+	DryRun        bool                    `env:"MF_INFLUX_WRITER_DRY_RUN" envDefault:"false"`
+
+	retention influxdb.Retention
+	actions   influxdb.StatusActions
+	natsTLS   *tls.Config
 }
 
 func main() {
-	cfg, clientCfg := loadConfigs()
+	cfg, clientCfgs := loadConfigs()
 
-	logger, err := logger.New(os.Stdout, cfg.logLevel)
+	l, err := logger.New(os.Stdout, cfg.LogLevel)
 	if err != nil {
 		log.Fatalf(err.Error())
 	}
+	logger := logger.NewSampler(l, logger.Sampling{
+		First:    cfg.LogFirst,
+		Every:    cfg.LogEvery,
+		Interval: cfg.LogInterval,
+	})
 
-	pubSub, err := nats.NewPubSub(cfg.natsURL, "", logger)
+	pubSub, err := nats.NewPubSubWithOptions(cfg.NatsURL, cfg.NatsQueue, logger, natsOptions(cfg)...)
 	if err != nil {
 		logger.Error(fmt.Sprintf("Failed to connect to NATS: %s", err))
 		os.Exit(1)
 	}
 	defer pubSub.Close()
 
-	client, err := influxdata.NewHTTPClient(clientCfg)
+	client, err := connectToInflux(clientCfgs, cfg.DBRetries, cfg.DBInterval, logger)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to connect to InfluxDB: %s", err))
+		os.Exit(1)
+	}
+	if cfg.DryRun {
+		logger.Warn("Running dry, the points are logged at the debug level instead of being written")
+		client = influxdb.NewDryRunClient(client, logger)
+	}
+	retryCfg := influxdb.RetryConfig{
+		Actions:    cfg.actions,
+		Retries:    cfg.WriteRetries,
+		Backoff:    cfg.RetryBackoff,
+		MaxBackoff: cfg.MaxBackoff,
+		Counter:    makeRetryMetrics(),
+	}
+	client = influxdb.NewRetryClient(client, retryCfg)
+	authz := influxdb.NewAuthzClient(client, logger)
+	client = authz
+	counter, latency := makeMetrics()
+	summary := emptySummary
+	if cfg.BatchSize > 1 {
+		bc := influxdb.NewBatchingClient(client, influxdb.BatchConfig{
+			Size:       cfg.BatchSize,
+			Interval:   cfg.FlushInterval,
+			Depth:      makeBatchMetrics(),
+			OldestAge:  makeAgeMetrics(),
+			Counter:    counter,
+			Latency:    latency,
+			Processing: makeProcessingMetrics(),
+		}, logger)
+		summary = bc.Summary
+		client = bc
+	}
+	defer func() {
+		if err := client.Close(); err != nil {
+			logger.Error(fmt.Sprintf("Failed to close InfluxDB client: %s", err))
+		}
+	}()
+
+	pipeline, err := writers.LoadPipeline(cfg.ConfigPath)
 	if err != nil {
-		logger.Error(fmt.Sprintf("Failed to create InfluxDB client: %s", err))
+		if errors.Contains(err, writers.ErrInvalidPipeline) {
+			logger.Error(fmt.Sprintf("Invalid configuration file %s: %s", cfg.ConfigPath, err))
+			os.Exit(1)
+		}
+		logger.Warn(fmt.Sprintf("Failed to load pipeline: %s", err))
+	} else {
+		logger.Info(fmt.Sprintf("Loaded configuration file %s", cfg.ConfigPath))
+	}
+	repoCfg := influxdb.Config{
+		Database:            cfg.DBName,
+		WriteConsistency:    cfg.Consistency,
+		Precision:           cfg.Precision,
+		Measurement:         cfg.Measurement,
+		UnitAsTag:           cfg.UnitAsTag,
+		Retention:           cfg.retention,
+		Routes:              writers.NewRoutes(pipeline.Routes),
+		Measurements:        writers.NewSubjectRoutes(pipeline.SubjectRoutes),
+		ContentMeasurements: writers.NewContentRoutes(pipeline.ContentRoutes),
+		IngestionTime:       cfg.Ingestion,
+		ValueField:          cfg.ValueField,
+		GeohashPrecision:    cfg.Geohash,
+		MaxTagLength:        cfg.MaxTagLength,
+		TagPolicy:           cfg.TagPolicy,
+		TagCounter:          makeTagMetrics(),
+	}
+	if err := influxdb.EnsureDatabase(client, cfg.DBName, influxdb.DatabaseConfig{
+		Create:   cfg.DBCreate && !cfg.DryRun,
+		Duration: cfg.DBDuration,
+	}); err != nil {
+		logger.Error(fmt.Sprintf("Failed to ensure InfluxDB database: %s", err))
+		os.Exit(1)
+	}
+	if err := influxdb.ValidateRetention(client, repoCfg); err != nil {
+		logger.Error(fmt.Sprintf("Invalid retention configuration: %s", err))
+		os.Exit(1)
+	}
+	if err := influxdb.ValidateRoutes(repoCfg, pipeline.Routes); err != nil {
+		logger.Error(fmt.Sprintf("Invalid pipeline routes: %s", err))
 		os.Exit(1)
 	}
-	defer client.Close()
 
-	repo := influxdb.New(client, cfg.dbName)
+	repo := influxdb.NewWithConfig(client, repoCfg)
+	checks := makeHealthChecks(client, pubSub)
+	checks["influxdb_authz"] = authz.Authorized
+	if cfg.SecondaryURL != "" {
+		secondary, err := connectToInflux([]influxdata.HTTPConfig{{
+			Addr:     cfg.SecondaryURL,
+			Username: cfg.SecondaryUser,
+			Password: cfg.SecondaryPass,
+		}}, cfg.DBRetries, cfg.DBInterval, logger)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to connect to secondary InfluxDB: %s", err))
+			os.Exit(1)
+		}
+		defer secondary.Close()
+		if cfg.DryRun {
+			secondary = influxdb.NewDryRunClient(secondary, logger)
+		}
+		secondary = influxdb.NewRetryClient(secondary, retryCfg)
+
+		secondaryCfg := repoCfg
+		if cfg.SecondaryDB != "" {
+			secondaryCfg.Database = cfg.SecondaryDB
+		}
+		counter, latency := makeSinkMetrics()
+		repo, err = writers.NewFanout([]writers.Sink{
+			{Name: "primary", Repo: repo},
+			{Name: "secondary", Repo: influxdb.NewWithConfig(secondary, secondaryCfg)},
+		}, writers.FanoutConfig{
+			Policy:  cfg.FanoutPolicy,
+			Counter: counter,
+			Latency: latency,
+		}, logger)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to create fan-out writer: %s", err))
+			os.Exit(1)
+		}
+		checks["influxdb_secondary"] = pingCheck(secondary)
+	}
 
-	counter, latency := makeMetrics()
 	repo = api.LoggingMiddleware(repo, logger)
 	repo = api.MetricsMiddleware(repo, counter, latency)
-	st := senml.New(cfg.contentType)
+	st := pipeline.Transformer
+	if st == nil {
+		st = makeTransformer(cfg.Transformer, cfg.ContentType)
+	}
+
+	consumerCfg := writers.Config{
+		SubjectsConfigPath: cfg.ConfigPath,
+		QueueSize:          cfg.QueueSize,
+		Streams:            pipeline.Streams,
+		Counter:            makeSubjectMetrics(),
+		DecodeCounter:      makeDecodeMetrics(),
+		DedupWindow:        cfg.DedupWindow,
+		DedupSize:          cfg.DedupSize,
+		TimestampPolicy:    cfg.TSPolicy,
+		MaxFutureSkew:      cfg.FutureSkew,
+		MaxPastSkew:        cfg.PastSkew,
+		SubjectPolicy:      cfg.SubjectPolicy,
+		DefaultChannel:     cfg.DefChannel,
+	}
+	if cfg.DLQSubject != "" {
+		consumerCfg.DeadLetter = pubSub
+		consumerCfg.DeadLetterSubject = cfg.DLQSubject
+	}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	ctx, cancel := context.WithCancel(context.Background())
+	ready := &readiness{}
+	h := makeHandler(checks, cfg.Admin, summary, ready)
 
-	if err := writers.Start(pubSub, repo, st, cfg.configPath, logger); err != nil {
+	// Serve the probes before subscribing, so that the writer is seen
+	// alive but not ready until it can persist the consumed messages.
+	// Each producer sends at most one error, so with a slot per producer
+	// none of them blocks once the first error terminates the service.
+	producers := []func(chan<- error){
+		func(errs chan<- error) { handleSignals(sigs, errs) },
+		func(errs chan<- error) { startHTTPService(ctx, cfg.Port, cfg.StopTimeout, cfg.Root, h, logger, errs) },
+	}
+	errs := make(chan error, len(producers))
+	for _, p := range producers {
+		go p(errs)
+	}
+
+	consumer, err := writers.StartConsumer(pubSub, repo, st, consumerCfg, logger)
+	if err != nil {
 		logger.Error(fmt.Sprintf("Failed to start InfluxDB writer: %s", err))
 		os.Exit(1)
 	}
+	if err := waitForInflux(client, cfg.DBRetries, cfg.DBInterval, logger); err != nil {
+		logger.Error(fmt.Sprintf("Failed to check InfluxDB: %s", err))
+		os.Exit(1)
+	}
+	ready.set()
 
-	errs := make(chan error, 2)
-	go func() {
-		c := make(chan os.Signal)
-		signal.Notify(c, syscall.SIGINT)
-		errs <- fmt.Errorf("%s", <-c)
-	}()
-
-	go startHTTPService(cfg.port, logger, errs)
+	hups := make(chan os.Signal, 1)
+	signal.Notify(hups, syscall.SIGHUP)
+	go reloadOnSignal(hups, cfg.ConfigPath, repoCfg, consumer, logger)
 
 	err = <-errs
 	logger.Error(fmt.Sprintf("InfluxDB writer service terminated: %s", err))
+
+	// Stop accepting health and metrics requests while the consumer drains.
+	cancel()
+	shutdown(consumer, cfg.StopTimeout, logger)
+}
+
+// handleSignals reports the first received signal as the error that
+// terminates the service, so that main returns through the graceful
+// shutdown and the deferred cleanup instead of the process being killed.
+func handleSignals(sigs <-chan os.Signal, errs chan<- error) {
+	errs <- fmt.Errorf("%s", <-sigs)
+}
+
+// reloadOnSignal reloads the pipeline whenever a signal is received.
+func reloadOnSignal(sigs <-chan os.Signal, path string, cfg influxdb.Config, consumer writers.Consumer, logger logger.Logger) {
+	for range sigs {
+		if err := reloadPipeline(path, cfg, consumer); err != nil {
+			logger.Warn(fmt.Sprintf("Failed to reload pipeline, keeping the current one: %s", err))
+			continue
+		}
+		logger.Info("Reloaded pipeline")
+	}
+}
+
+// reloadPipeline loads and validates the pipeline and swaps in its
+// transformers, routes, subject and content routes. If the pipeline is
+// invalid, the current one is kept.
+func reloadPipeline(path string, cfg influxdb.Config, consumer writers.Consumer) error {
+	p, err := writers.LoadPipeline(path)
+	if err != nil {
+		return err
+	}
+	if err := influxdb.ValidateRoutes(cfg, p.Routes); err != nil {
+		return err
+	}
+	if err := consumer.Reload(p); err != nil {
+		return err
+	}
+	cfg.Routes.Store(p.Routes)
+	cfg.Measurements.Store(p.SubjectRoutes)
+	cfg.ContentMeasurements.Store(p.ContentRoutes)
+	return nil
 }
 
-func loadConfigs() (config, influxdata.HTTPConfig) {
-	cfg := config{
-		natsURL:     mainflux.Env(envNatsURL, defNatsURL),
-		logLevel:    mainflux.Env(envLogLevel, defLogLevel),
-		port:        mainflux.Env(envPort, defPort),
-		dbName:      mainflux.Env(envDB, defDB),
-		dbHost:      mainflux.Env(envDBHost, defDBHost),
-		dbPort:      mainflux.Env(envDBPort, defDBPort),
-		dbUser:      mainflux.Env(envDBUser, defDBUser),
-		dbPass:      mainflux.Env(envDBPass, defDBPass),
-		configPath:  mainflux.Env(envConfigPath, defConfigPath),
-		contentType: mainflux.Env(envContentType, defContentType),
+func shutdown(consumer writers.Consumer, timeout time.Duration, logger logger.Logger) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	rep, err := consumer.Shutdown(ctx)
+	summary := fmt.Sprintf("consumed %d, written %d, dead-lettered %d, failed %d, duplicate %d, empty %d, republished %d, dropped %d messages, accepted %d, clamped %d, rejected %d bad timestamps, %d malformed subjects, buffer depth %d",
+		rep.Consumed, rep.Written, rep.DeadLettered, rep.Failed, rep.Duplicates, rep.Empty, rep.Republished, rep.Dropped, rep.TimestampsAccepted, rep.TimestampsClamped, rep.TimestampsRejected, rep.MalformedSubjects, rep.BufferDepth)
+	if err != nil {
+		logger.Warn(fmt.Sprintf("InfluxDB writer shutdown: flushed %d and abandoned %d in-flight writes, %s: %s", rep.Flushed, rep.Abandoned, summary, err))
+		return
+	}
+	logger.Info(fmt.Sprintf("InfluxDB writer shutdown: flushed %d in-flight writes, %s", rep.Flushed, summary))
+}
+
+// connectToInflux creates the client of the only endpoint, or the client
+// failing over between endpoints in the configured order.
+func connectToInflux(cfgs []influxdata.HTTPConfig, retries int, interval time.Duration, logger logger.Logger) (influxdata.Client, error) {
+	var clients []influxdata.Client
+	for _, cfg := range cfgs {
+		c, err := influxdb.NewHTTPClient(cfg)
+		if err != nil {
+			return nil, err
+		}
+		clients = append(clients, c)
+	}
+
+	client := clients[0]
+	if len(clients) > 1 {
+		for i, c := range clients {
+			if _, _, err := c.Ping(defPingTimeout); err != nil {
+				logger.Warn(fmt.Sprintf("InfluxDB endpoint %s is unreachable: %s", cfgs[i].Addr, err))
+			}
+		}
+		client = influxdb.NewFailoverClient(clients...)
 	}
 
-	clientCfg := influxdata.HTTPConfig{
-		Addr:     fmt.Sprintf("http://%s:%s", cfg.dbHost, cfg.dbPort),
-		Username: cfg.dbUser,
-		Password: cfg.dbPass,
+	if err := waitForInflux(client, retries, interval, logger); err != nil {
+		client.Close()
+		return nil, err
 	}
+	var addrs []string
+	for _, cfg := range cfgs {
+		addrs = append(addrs, cfg.Addr)
+	}
+	logger.Info(fmt.Sprintf("Connected to InfluxDB at %s", strings.Join(addrs, ", ")))
+	return client, nil
+}
+
+// waitForInflux pings InfluxDB until it responds, retrying with exponential
+// backoff so that the writer can start before the database is up. A ping
+// rejected for lack of authorization is not retried.
+func waitForInflux(client influxdata.Client, retries int, interval time.Duration, logger logger.Logger) error {
+	for attempt := 1; ; attempt++ {
+		_, _, err := client.Ping(defPingTimeout)
+		if err == nil {
+			return nil
+		}
+		if influxdb.IsUnauthorized(err) {
+			return errors.Wrap(influxdb.ErrUnauthorized, err)
+		}
+		if attempt > retries {
+			return err
+		}
 
-	return cfg, clientCfg
+		logger.Warn(fmt.Sprintf("InfluxDB is unreachable, retrying in %s (%d/%d): %s", interval, attempt, retries, err))
+		time.Sleep(interval)
+		if interval *= 2; interval > defMaxInterval {
+			interval = defMaxInterval
+		}
+	}
+}
+
+func loadConfigs() (config, []influxdata.HTTPConfig) {
+	var cfg config
+	if err := env.Load(&cfg); err != nil {
+		log.Fatalf(err.Error())
+	}
+
+	if err := influxdb.ValidateConsistency(cfg.Consistency); err != nil {
+		log.Fatalf("Invalid %s value: %s", envConsistency, err.Error())
+	}
+
+	tsPolicy, err := writers.ParseTimestampPolicy(string(cfg.TSPolicy))
+	if err != nil {
+		log.Fatalf("Invalid %s value: %s", envTSPolicy, err.Error())
+	}
+	cfg.TSPolicy = tsPolicy
+
+	cfg.actions, err = influxdb.ParseStatusActions(cfg.StatusActions)
+	if err != nil {
+		log.Fatalf("Invalid %s value: %s", envStatus, err.Error())
+	}
+
+	cfg.retention, err = loadRetention(cfg.RetentionPath)
+	if err != nil {
+		log.Fatalf("Invalid %s value: %s", envRetention, err.Error())
+	}
+
+	cfg.natsTLS, err = loadNatsTLS(cfg)
+	if err != nil {
+		log.Fatalf("Invalid NATS TLS configuration: %s", err.Error())
+	}
+	if cfg.NatsConnName == "" {
+		cfg.NatsConnName = defaultConnName()
+	}
+
+	urls, err := dbURLs(cfg)
+	if err != nil {
+		log.Fatalf(err.Error())
+	}
+
+	var clientCfgs []influxdata.HTTPConfig
+	for _, u := range urls {
+		clientCfgs = append(clientCfgs, influxdata.HTTPConfig{
+			Addr:     u,
+			Username: cfg.DBUser,
+			Password: cfg.DBPass,
+		})
+	}
+
+	return cfg, clientCfgs
+}
+
+// dbURLs returns the URLs of the InfluxDB instances, which are either the
+// configured URLs or the one made of the host and the port. It fails if
+// any of them, or the secondary InfluxDB URL, can't be connected to, so
+// that a misconfigured writer stops at startup instead of on the first
+// write.
+func dbURLs(cfg config) ([]string, error) {
+	urls := cfg.DBURLs
+	if len(urls) == 0 {
+		if strings.Contains(cfg.DBHost, "/") || strings.Contains(cfg.DBHost, ":") {
+			return nil, errors.Wrap(errInvalidDB, fmt.Errorf("%s: %q is not a host name, set %s to use URLs", envDBHost, cfg.DBHost, envDBURLs))
+		}
+		if port, err := strconv.Atoi(cfg.DBPort); err != nil || port < 1 || port > 65535 {
+			return nil, errors.Wrap(errInvalidDB, fmt.Errorf("%s: %q is not a port number", envDBPort, cfg.DBPort))
+		}
+		urls = []string{fmt.Sprintf("http://%s:%s", cfg.DBHost, cfg.DBPort)}
+	}
+
+	for _, u := range urls {
+		if err := checkDBURL(u); err != nil {
+			return nil, errors.Wrap(errInvalidDB, fmt.Errorf("%s: %s", envDBURLs, err))
+		}
+	}
+	if cfg.SecondaryURL != "" {
+		if err := checkDBURL(cfg.SecondaryURL); err != nil {
+			return nil, errors.Wrap(errInvalidDB, fmt.Errorf("%s: %s", envSecondary, err))
+		}
+	}
+	return urls, nil
+}
+
+func checkDBURL(s string) error {
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%q is not an http or https URL", s)
+	}
+	return nil
+}
+
+func loadRetention(path string) (influxdb.Retention, error) {
+	var cfg struct {
+		Retention influxdb.Retention `toml:"retention"`
+	}
+	if path == "" {
+		return cfg.Retention, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return cfg.Retention, err
+	}
+	if err := toml.Unmarshal(data, &cfg); err != nil {
+		return cfg.Retention, err
+	}
+	return cfg.Retention, nil
+}
+
+// loadNatsTLS validates the NATS TLS files of the configuration and loads
+// them. It returns nil if NATS TLS is not configured.
+func loadNatsTLS(cfg config) (*tls.Config, error) {
+	return nats.LoadTLS(nats.TLSConfig{
+		CACert:     cfg.NatsCACert,
+		ClientCert: cfg.NatsCert,
+		ClientKey:  cfg.NatsKey,
+		ServerName: cfg.NatsServer,
+	})
+}
+
+// defaultConnName returns the name of the NATS connection made of the
+// service name and the host name, which tells the writer replicas apart.
+func defaultConnName() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		return svcName
+	}
+	return fmt.Sprintf("%s-%s", svcName, host)
+}
+
+// natsOptions returns the options of the NATS connection, which is named
+// so that it can be identified by the NATS monitoring, and secured if TLS
+// is configured.
+func natsOptions(cfg config) []broker.Option {
+	opts := []broker.Option{broker.Name(cfg.NatsConnName)}
+	if cfg.natsTLS != nil {
+		opts = append(opts, broker.Secure(cfg.natsTLS))
+	}
+	return opts
 }
 
 func makeMetrics() (*kitprometheus.Counter, *kitprometheus.Summary) {
@@ -150,8 +603,182 @@ func makeMetrics() (*kitprometheus.Counter, *kitprometheus.Summary) {
 	return counter, latency
 }
 
-func startHTTPService(port string, logger logger.Logger, errs chan error) {
-	p := fmt.Sprintf(":%s", port)
-	logger.Info(fmt.Sprintf("InfluxDB writer service started, exposed port %s", p))
-	errs <- http.ListenAndServe(p, api.MakeHandler(svcName))
+func makeSubjectMetrics() *kitprometheus.Counter {
+	return kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
+		Namespace: "influxdb",
+		Subsystem: "message_writer",
+		Name:      "subject_message_count",
+		Help:      "Number of processed messages by subject and status.",
+	}, []string{"subject", "status"})
+}
+
+func makeDecodeMetrics() *kitprometheus.Counter {
+	return kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
+		Namespace: "influxdb",
+		Subsystem: "message_writer",
+		Name:      "decode_failure_count",
+		Help:      "Number of messages which failed to decode by format and subject.",
+	}, []string{"format", "subject"})
+}
+
+func makeTagMetrics() *kitprometheus.Counter {
+	return kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
+		Namespace: "influxdb",
+		Subsystem: "message_writer",
+		Name:      "long_tag_count",
+		Help:      "Number of tag values longer than the maximum length by tag and status.",
+	}, []string{"tag", "status"})
+}
+
+func makeRetryMetrics() *kitprometheus.Counter {
+	return kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
+		Namespace: "influxdb",
+		Subsystem: "message_writer",
+		Name:      "unsuccessful_write_count",
+		Help:      "Number of InfluxDB writes answered with an error by status and action.",
+	}, []string{"status", "action"})
+}
+
+func makeBatchMetrics() *kitprometheus.Gauge {
+	return kitprometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+		Namespace: "influxdb",
+		Subsystem: "message_writer",
+		Name:      "batch_buffer_points",
+		Help:      "Number of points buffered for the next batch write.",
+	}, []string{})
+}
+
+func makeAgeMetrics() *kitprometheus.Gauge {
+	return kitprometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+		Namespace: "influxdb",
+		Subsystem: "message_writer",
+		Name:      "batch_buffer_oldest_age_seconds",
+		Help:      "Time in seconds the oldest buffered point waited for the last flush.",
+	}, []string{})
+}
+
+func makeProcessingMetrics() *kitprometheus.Histogram {
+	return kitprometheus.NewHistogramFrom(stdprometheus.HistogramOpts{
+		Namespace: "influxdb",
+		Subsystem: "message_writer",
+		Name:      "processing_latency_seconds",
+		Help:      "Time between the receipt of points and their batch write in seconds.",
+		Buckets:   stdprometheus.ExponentialBuckets(0.001, 2, 16),
+	}, []string{})
+}
+
+func makeSinkMetrics() (*kitprometheus.Counter, *kitprometheus.Histogram) {
+	counter := kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
+		Namespace: "influxdb",
+		Subsystem: "message_writer",
+		Name:      "sink_write_count",
+		Help:      "Number of writes to each database by status.",
+	}, []string{"sink", "status"})
+
+	latency := kitprometheus.NewHistogramFrom(stdprometheus.HistogramOpts{
+		Namespace: "influxdb",
+		Subsystem: "message_writer",
+		Name:      "sink_write_latency_seconds",
+		Help:      "Duration of writes to each database in seconds.",
+		Buckets:   stdprometheus.ExponentialBuckets(0.001, 2, 16),
+	}, []string{"sink"})
+
+	return counter, latency
+}
+
+// makeTransformer returns the transformer of the messages of the subjects
+// the pipeline sets no transformer for. The SenML transformer decodes the
+// payloads of the content type.
+func makeTransformer(name, contentType string) transformers.Transformer {
+	if name == "json" {
+		return mfjson.New()
+	}
+	return senml.New(contentType)
+}
+
+// makeHealthChecks returns the checks of the InfluxDB and NATS connections
+// run by the health endpoint, so that it fails once either drops.
+func makeHealthChecks(client influxdata.Client, pubSub nats.PubSub) map[string]mainflux.HealthCheck {
+	return map[string]mainflux.HealthCheck{
+		"influxdb": pingCheck(client),
+		"nats": func() error {
+			if !pubSub.Connected() {
+				return errNatsDisconnected
+			}
+			return nil
+		},
+	}
+}
+
+func pingCheck(client influxdata.Client) mainflux.HealthCheck {
+	return func() error {
+		_, _, err := client.Ping(defPingTimeout)
+		return err
+	}
+}
+
+// emptySummary is the buffer summary of the writer writing without
+// batching.
+func emptySummary() influxdb.BufferSummary {
+	return influxdb.BufferSummary{Series: []influxdb.SeriesSummary{}}
+}
+
+// readiness is set once the writer is subscribed to NATS and InfluxDB
+// passed the health check, so that it can persist the consumed messages.
+type readiness struct {
+	ready int32
+}
+
+func (r *readiness) set() {
+	atomic.StoreInt32(&r.ready, 1)
+}
+
+func (r *readiness) isSet() bool {
+	return atomic.LoadInt32(&r.ready) == 1
+}
+
+// makeHandler returns the HTTP API handler of the writer. The liveness
+// probe on /healthz succeeds as long as the writer serves, and the
+// readiness probe on /readyz once the writer is ready. If admin is set,
+// the summary of the points buffered for the next batch write is served
+// under /debug/buffer.
+func makeHandler(checks map[string]mainflux.HealthCheck, admin bool, summary func() influxdb.BufferSummary, ready *readiness) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/", api.MakeCheckedHandler(svcName, checks))
+	mux.HandleFunc("/healthz", func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/readyz", func(rw http.ResponseWriter, r *http.Request) {
+		if !ready.isSet() {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		rw.WriteHeader(http.StatusOK)
+	})
+	if !admin {
+		return mux
+	}
+
+	mux.HandleFunc("/debug/buffer", func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			rw.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		data, err := json.Marshal(summary())
+		if err != nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		rw.Header().Set("Content-Type", "application/json")
+		rw.Write(data)
+	})
+
+	return mux
+}
+
+func startHTTPService(ctx context.Context, port string, stopTimeout time.Duration, root bool, h http.Handler, logger logger.Logger, errs chan<- error) {
+	logger.Info(fmt.Sprintf("InfluxDB writer service started, exposed port %s", port))
+	errs <- servers.Start(ctx, h, servers.Config{Port: port, StopWaitTime: stopTimeout, Root: root, Service: svcName}, logger)
 }
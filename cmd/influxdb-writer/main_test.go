@@ -0,0 +1,571 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	influxdata "github.com/influxdata/influxdb/client/v2"
+	log "github.com/mainflux/mainflux/logger"
+	"github.com/mainflux/mainflux/pkg/env"
+	"github.com/mainflux/mainflux/pkg/errors"
+	"github.com/mainflux/mainflux/pkg/messaging"
+	"github.com/mainflux/mainflux/pkg/messaging/nats"
+	mfjson "github.com/mainflux/mainflux/pkg/transformers/json"
+	"github.com/mainflux/mainflux/pkg/transformers/senml"
+	"github.com/mainflux/mainflux/writers"
+	"github.com/mainflux/mainflux/writers/influxdb"
+	"github.com/mainflux/mainflux/writers/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleSignals(t *testing.T) {
+	cases := []struct {
+		desc string
+		sig  os.Signal
+		err  string
+	}{
+		{
+			desc: "handle interrupt signal",
+			sig:  syscall.SIGINT,
+			err:  "interrupt",
+		},
+		{
+			desc: "handle terminate signal",
+			sig:  syscall.SIGTERM,
+			err:  "terminated",
+		},
+	}
+
+	for _, tc := range cases {
+		sigs := make(chan os.Signal, 1)
+		errs := make(chan error, 1)
+		go handleSignals(sigs, errs)
+		sigs <- tc.sig
+
+		select {
+		case err := <-errs:
+			require.NotNil(t, err, fmt.Sprintf("%s: expected error\n", tc.desc))
+			assert.Equal(t, tc.err, err.Error(), fmt.Sprintf("%s: expected %s got %s\n", tc.desc, tc.err, err))
+		case <-time.After(time.Second):
+			t.Errorf("%s: expected the signal to be reported", tc.desc)
+		}
+	}
+}
+
+type clientMock struct {
+	influxdata.Client
+	err error
+}
+
+func (c clientMock) Ping(time.Duration) (time.Duration, string, error) {
+	return 0, "", c.err
+}
+
+type pubSubMock struct {
+	nats.PubSub
+	connected bool
+}
+
+func (ps pubSubMock) Connected() bool {
+	return ps.connected
+}
+
+func TestMakeHealthChecks(t *testing.T) {
+	errPing := errors.New("connection refused")
+
+	cases := []struct {
+		desc      string
+		pingErr   error
+		connected bool
+		errs      map[string]error
+	}{
+		{
+			desc:      "check connected dependencies",
+			pingErr:   nil,
+			connected: true,
+			errs:      map[string]error{"influxdb": nil, "nats": nil},
+		},
+		{
+			desc:      "check unavailable InfluxDB",
+			pingErr:   errPing,
+			connected: true,
+			errs:      map[string]error{"influxdb": errPing, "nats": nil},
+		},
+		{
+			desc:      "check disconnected NATS",
+			pingErr:   nil,
+			connected: false,
+			errs:      map[string]error{"influxdb": nil, "nats": errNatsDisconnected},
+		},
+	}
+
+	for _, tc := range cases {
+		checks := makeHealthChecks(clientMock{err: tc.pingErr}, pubSubMock{connected: tc.connected})
+		require.Len(t, checks, len(tc.errs), fmt.Sprintf("%s: expected %d checks got %d\n", tc.desc, len(tc.errs), len(checks)))
+		for name, expected := range tc.errs {
+			check, ok := checks[name]
+			require.True(t, ok, fmt.Sprintf("%s: expected %s check\n", tc.desc, name))
+			err := check()
+			assert.Equal(t, expected, err, fmt.Sprintf("%s: %s: expected %v got %v\n", tc.desc, name, expected, err))
+		}
+	}
+}
+
+func TestMakeTransformer(t *testing.T) {
+	msg := messaging.Message{
+		Channel:   "45",
+		Publisher: "2580",
+		Protocol:  "http",
+	}
+
+	cases := []struct {
+		desc        string
+		transformer string
+		payload     []byte
+		res         interface{}
+	}{
+		{
+			desc:        "transform SenML message",
+			transformer: "senml",
+			payload:     []byte(`[{"n":"temp","v":21}]`),
+			res:         []senml.Message{},
+		},
+		{
+			desc:        "transform JSON message",
+			transformer: "json",
+			payload:     []byte(`{"temp":21,"sensor":{"hum":40}}`),
+			res:         mfjson.Messages{},
+		},
+	}
+
+	for _, tc := range cases {
+		msg.Payload = tc.payload
+		msgs, err := makeTransformer(tc.transformer, senml.JSON).Transform(msg)
+		require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s\n", tc.desc, err))
+		assert.IsType(t, tc.res, msgs, fmt.Sprintf("%s: expected %T got %T\n", tc.desc, tc.res, msgs))
+	}
+}
+
+func TestPrecisionConfig(t *testing.T) {
+	cases := []struct {
+		desc      string
+		precision string
+		expected  string
+		err       error
+	}{
+		{
+			desc:      "load default precision",
+			precision: "",
+			expected:  "ns",
+			err:       nil,
+		},
+		{
+			desc:      "load millisecond precision",
+			precision: "ms",
+			expected:  "ms",
+			err:       nil,
+		},
+		{
+			desc:      "load InfluxDB microsecond precision",
+			precision: "u",
+			err:       env.ErrInvalidConfig,
+		},
+		{
+			desc:      "load minute precision",
+			precision: "m",
+			err:       env.ErrInvalidConfig,
+		},
+	}
+
+	for _, tc := range cases {
+		if tc.precision != "" {
+			os.Setenv("MF_INFLUX_WRITER_PRECISION", tc.precision)
+		}
+		var cfg config
+		err := env.Load(&cfg)
+		os.Unsetenv("MF_INFLUX_WRITER_PRECISION")
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s\n", tc.desc, tc.err, err))
+		if tc.err != nil {
+			continue
+		}
+		assert.Equal(t, tc.expected, cfg.Precision, fmt.Sprintf("%s: expected precision %s got %s\n", tc.desc, tc.expected, cfg.Precision))
+		err = influxdb.ValidatePrecision(cfg.Precision)
+		assert.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s\n", tc.desc, err))
+	}
+}
+
+func TestLogSamplingIntervalConfig(t *testing.T) {
+	cases := []struct {
+		desc     string
+		interval string
+		expected time.Duration
+		err      error
+	}{
+		{
+			desc:     "load default interval",
+			interval: "",
+			expected: time.Minute,
+			err:      nil,
+		},
+		{
+			desc:     "load one second interval",
+			interval: "1s",
+			expected: time.Second,
+			err:      nil,
+		},
+		{
+			desc:     "load zero interval",
+			interval: "0s",
+			err:      env.ErrInvalidConfig,
+		},
+		{
+			desc:     "load sub-second interval",
+			interval: "500ms",
+			err:      env.ErrInvalidConfig,
+		},
+	}
+
+	for _, tc := range cases {
+		if tc.interval != "" {
+			os.Setenv("MF_INFLUX_WRITER_LOG_SAMPLING_INTERVAL", tc.interval)
+		}
+		var cfg config
+		err := env.Load(&cfg)
+		os.Unsetenv("MF_INFLUX_WRITER_LOG_SAMPLING_INTERVAL")
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s\n", tc.desc, tc.err, err))
+		if tc.err != nil {
+			continue
+		}
+		assert.Equal(t, tc.expected, cfg.LogInterval, fmt.Sprintf("%s: expected interval %s got %s\n", tc.desc, tc.expected, cfg.LogInterval))
+	}
+}
+
+func TestDBURLs(t *testing.T) {
+	cases := []struct {
+		desc string
+		cfg  config
+		urls []string
+		err  error
+	}{
+		{
+			desc: "make URL of host and port",
+			cfg:  config{DBHost: "localhost", DBPort: "8086"},
+			urls: []string{"http://localhost:8086"},
+			err:  nil,
+		},
+		{
+			desc: "use configured URLs",
+			cfg:  config{DBHost: "localhost", DBPort: "8086", DBURLs: []string{"http://influx-1:8086", "https://influx-2:8086"}},
+			urls: []string{"http://influx-1:8086", "https://influx-2:8086"},
+			err:  nil,
+		},
+		{
+			desc: "make URL of host holding a URL",
+			cfg:  config{DBHost: "http://influx", DBPort: "8086"},
+			err:  errInvalidDB,
+		},
+		{
+			desc: "make URL of invalid port",
+			cfg:  config{DBHost: "localhost", DBPort: "influx"},
+			err:  errInvalidDB,
+		},
+		{
+			desc: "use configured URL without scheme",
+			cfg:  config{DBHost: "localhost", DBPort: "8086", DBURLs: []string{"http://influx-1:8086", "influx-2:8086"}},
+			err:  errInvalidDB,
+		},
+		{
+			desc: "use invalid secondary URL",
+			cfg:  config{DBHost: "localhost", DBPort: "8086", SecondaryURL: "tcp://influx:8086"},
+			err:  errInvalidDB,
+		},
+	}
+
+	for _, tc := range cases {
+		urls, err := dbURLs(tc.cfg)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s\n", tc.desc, tc.err, err))
+		assert.Equal(t, tc.urls, urls, fmt.Sprintf("%s: expected %v got %v\n", tc.desc, tc.urls, urls))
+	}
+}
+
+func TestWaitForInfluxUnauthorized(t *testing.T) {
+	logger, err := log.New(os.Stdout, log.Error.String())
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+
+	// The interval would make a retry time the test out.
+	client := clientMock{err: errors.New(`{"error":"unable to parse authentication credentials"}`)}
+	done := make(chan error, 1)
+	go func() { done <- waitForInflux(client, 5, time.Hour, logger) }()
+
+	select {
+	case err := <-done:
+		assert.True(t, errors.Contains(err, influxdb.ErrUnauthorized), fmt.Sprintf("expected %s got %s", influxdb.ErrUnauthorized, err))
+	case <-time.After(time.Second):
+		t.Error("expected the rejected ping not to be retried")
+	}
+}
+
+func TestBufferEndpoint(t *testing.T) {
+	logger, err := log.New(os.Stdout, log.Info.String())
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	client := influxdb.NewBatchingClient(clientMock{}, influxdb.BatchConfig{Size: 100}, logger)
+
+	bp, err := influxdata.NewBatchPoints(influxdata.BatchPointsConfig{Database: "mainflux"})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	for i := 0; i < 3; i++ {
+		pt, err := influxdata.NewPoint("messages", map[string]string{"channel": "1"}, map[string]interface{}{"value": float64(i)}, time.Now())
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+		bp.AddPoint(pt)
+	}
+	err = client.Write(bp)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+
+	checks := makeHealthChecks(clientMock{}, pubSubMock{connected: true})
+
+	cases := []struct {
+		desc    string
+		admin   bool
+		summary func() influxdb.BufferSummary
+		method  string
+		status  int
+		points  int
+		series  []influxdb.SeriesSummary
+	}{
+		{
+			desc:    "retrieve buffer summary",
+			admin:   true,
+			summary: client.Summary,
+			method:  http.MethodGet,
+			status:  http.StatusOK,
+			points:  3,
+			series:  []influxdb.SeriesSummary{{Database: "mainflux", Series: "messages,channel=1", Points: 3}},
+		},
+		{
+			desc:    "retrieve buffer summary without batching",
+			admin:   true,
+			summary: emptySummary,
+			method:  http.MethodGet,
+			status:  http.StatusOK,
+			points:  0,
+			series:  []influxdb.SeriesSummary{},
+		},
+		{
+			desc:    "retrieve buffer summary with invalid method",
+			admin:   true,
+			summary: client.Summary,
+			method:  http.MethodPost,
+			status:  http.StatusMethodNotAllowed,
+		},
+		{
+			desc:    "retrieve buffer summary with admin endpoints disabled",
+			admin:   false,
+			summary: client.Summary,
+			method:  http.MethodGet,
+			status:  http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range cases {
+		rec := httptest.NewRecorder()
+		makeHandler(checks, tc.admin, tc.summary, &readiness{}).ServeHTTP(rec, httptest.NewRequest(tc.method, "/debug/buffer", nil))
+		assert.Equal(t, tc.status, rec.Code, fmt.Sprintf("%s: expected status %d got %d\n", tc.desc, tc.status, rec.Code))
+		if tc.status != http.StatusOK {
+			continue
+		}
+
+		var sum influxdb.BufferSummary
+		err := json.Unmarshal(rec.Body.Bytes(), &sum)
+		require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s\n", tc.desc, err))
+		assert.Equal(t, tc.points, sum.Points, fmt.Sprintf("%s: expected %d points got %d\n", tc.desc, tc.points, sum.Points))
+		assert.Equal(t, tc.series, sum.Series, fmt.Sprintf("%s: expected series %v got %v\n", tc.desc, tc.series, sum.Series))
+		assert.Equal(t, tc.points > 0, sum.Since != nil, fmt.Sprintf("%s: unexpected buffering time %v\n", tc.desc, sum.Since))
+	}
+
+	rec := httptest.NewRecorder()
+	makeHandler(checks, true, client.Summary, &readiness{}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+	assert.Equal(t, http.StatusOK, rec.Code, fmt.Sprintf("expected health endpoint to be served got status %d", rec.Code))
+}
+
+func TestProbes(t *testing.T) {
+	checks := makeHealthChecks(clientMock{}, pubSubMock{connected: false})
+	ready := &readiness{}
+	h := makeHandler(checks, false, emptySummary, ready)
+
+	cases := []struct {
+		desc   string
+		ready  bool
+		path   string
+		status int
+	}{
+		{
+			desc:   "check liveness before the writer is ready",
+			path:   "/healthz",
+			status: http.StatusOK,
+		},
+		{
+			desc:   "check readiness before the writer is ready",
+			path:   "/readyz",
+			status: http.StatusServiceUnavailable,
+		},
+		{
+			desc:   "check liveness once the writer is ready",
+			ready:  true,
+			path:   "/healthz",
+			status: http.StatusOK,
+		},
+		{
+			desc:   "check readiness once the writer is ready",
+			ready:  true,
+			path:   "/readyz",
+			status: http.StatusOK,
+		},
+	}
+
+	for _, tc := range cases {
+		if tc.ready {
+			ready.set()
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.path, nil))
+		assert.Equal(t, tc.status, rec.Code, fmt.Sprintf("%s: expected status %d got %d\n", tc.desc, tc.status, rec.Code))
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code, fmt.Sprintf("expected failing health check to fail the health endpoint got status %d", rec.Code))
+}
+
+func TestStartHTTPServiceBindError(t *testing.T) {
+	l, err := net.Listen("tcp", ":0")
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	defer l.Close()
+	_, port, err := net.SplitHostPort(l.Addr().String())
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+
+	logger, err := log.New(os.Stdout, log.Error.String())
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+
+	errs := make(chan error, 1)
+	go startHTTPService(context.Background(), port, time.Second, false, http.NotFoundHandler(), logger, errs)
+
+	select {
+	case err := <-errs:
+		assert.NotNil(t, err, "expected bind error")
+	case <-time.After(time.Second):
+		t.Error("expected the bind error to be reported")
+	}
+}
+
+func TestReloadPipeline(t *testing.T) {
+	f, err := ioutil.TempFile("", "pipeline-*.toml")
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	defer os.Remove(f.Name())
+	f.Close()
+
+	write := func(data string) {
+		err := ioutil.WriteFile(f.Name(), []byte(data), 0644)
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	}
+	write(`[subjects]
+filter = ["channels.>"]
+`)
+
+	cfg := influxdb.Config{
+		Retention:           influxdb.Retention{Tiers: map[string]string{"short": "one_day", "long": "one_year"}},
+		Routes:              writers.NewRoutes(map[string]string{"telemetry": "short"}),
+		Measurements:        writers.NewSubjectRoutes(nil),
+		ContentMeasurements: writers.NewContentRoutes(nil),
+	}
+	logger, err := log.New(os.Stdout, log.Error.String())
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	consumer, err := writers.StartConsumer(mocks.NewPubSub(), mocks.NewMessageRepository(), senml.New(senml.JSON), writers.Config{SubjectsConfigPath: f.Name()}, logger)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+
+	cases := []struct {
+		desc        string
+		data        string
+		route       string
+		measurement string
+		err         error
+	}{
+		{
+			desc: "reload valid pipeline",
+			data: `[subjects]
+filter = ["channels.>"]
+
+[pipeline]
+  [[pipeline.routes]]
+  channels = ["telemetry"]
+  target = "long"
+
+  [[pipeline.subject_routes]]
+  subject = "channels.telemetry.>"
+  target = "sensors"
+`,
+			route:       "long",
+			measurement: "sensors",
+			err:         nil,
+		},
+		{
+			desc: "reload pipeline routed to unknown tier",
+			data: `[subjects]
+filter = ["channels.>"]
+
+[pipeline]
+  [[pipeline.routes]]
+  channels = ["telemetry"]
+  target = "forever"
+`,
+			route:       "long",
+			measurement: "sensors",
+			err:         influxdb.ErrUnknownTier,
+		},
+		{
+			desc: "reload pipeline with unknown transformer",
+			data: `[subjects]
+filter = ["channels.>"]
+
+[pipeline]
+  [pipeline.transformer]
+  name = "xml"
+
+  [[pipeline.routes]]
+  channels = ["telemetry"]
+  target = "short"
+`,
+			route:       "long",
+			measurement: "sensors",
+			err:         writers.ErrInvalidPipeline,
+		},
+		{
+			desc:        "reload malformed pipeline",
+			data:        `[pipeline`,
+			route:       "long",
+			measurement: "sensors",
+			err:         errors.New("unable to parse configuration file"),
+		},
+	}
+
+	for _, tc := range cases {
+		write(tc.data)
+		err := reloadPipeline(f.Name(), cfg, consumer)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s\n", tc.desc, tc.err, err))
+		route, _ := cfg.Routes.Target("telemetry")
+		assert.Equal(t, tc.route, route, fmt.Sprintf("%s: expected route %s got %s\n", tc.desc, tc.route, route))
+		measurement, _ := cfg.Measurements.Target("channels.telemetry.temp")
+		assert.Equal(t, tc.measurement, measurement, fmt.Sprintf("%s: expected measurement %s got %s\n", tc.desc, tc.measurement, measurement))
+	}
+}
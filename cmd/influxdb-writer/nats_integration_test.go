@@ -0,0 +1,50 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+// +build integration
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	log "github.com/mainflux/mainflux/logger"
+	"github.com/mainflux/mainflux/pkg/env"
+	"github.com/mainflux/mainflux/pkg/messaging/nats"
+	broker "github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestNatsTLSConnection connects to the TLS-enabled NATS configured with
+// MF_NATS_URL and the MF_INFLUX_WRITER_NATS_* variables, e.g.
+//
+//	MF_NATS_URL=tls://localhost:4222 MF_INFLUX_WRITER_NATS_CA_CERTS=ca.crt \
+//	go test -tags integration -run TestNatsTLSConnection ./cmd/influxdb-writer
+func TestNatsTLSConnection(t *testing.T) {
+	var cfg config
+	err := env.Load(&cfg)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	tlsCfg, err := loadNatsTLS(cfg)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	if tlsCfg == nil {
+		t.Skip("NATS TLS is not configured")
+	}
+
+	logger, err := log.New(os.Stdout, log.Error.String())
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	pubSub, err := nats.NewPubSubWithTLS(cfg.NatsURL, cfg.NatsQueue, tlsCfg, logger)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	defer pubSub.Close()
+	assert.True(t, pubSub.Connected(), "expected the writer to connect to NATS")
+
+	conn, err := broker.Connect(cfg.NatsURL, broker.Secure(tlsCfg))
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	defer conn.Close()
+	assert.True(t, conn.TLSRequired(), "expected a secure connection to NATS")
+
+	_, err = broker.Connect(cfg.NatsURL)
+	assert.NotNil(t, err, "expected NATS to refuse an insecure connection")
+}
@@ -0,0 +1,201 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mainflux/mainflux/pkg/env"
+	"github.com/mainflux/mainflux/pkg/errors"
+	"github.com/mainflux/mainflux/pkg/messaging/nats"
+	broker "github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newCert writes a self-signed certificate and its key to the directory,
+// and returns their paths.
+func newCert(t *testing.T, dir string) (string, string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "nats"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment | x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+
+	write := func(name, typ string, data []byte) string {
+		path := filepath.Join(dir, name)
+		err := ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: data}), 0600)
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+		return path
+	}
+	return write("nats.crt", "CERTIFICATE", der), write("nats.key", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(key))
+}
+
+func TestNatsTLSConfig(t *testing.T) {
+	vars := map[string]string{
+		"MF_INFLUX_WRITER_NATS_CA_CERTS":    "/certs/ca.crt",
+		"MF_INFLUX_WRITER_NATS_CLIENT_CERT": "/certs/client.crt",
+		"MF_INFLUX_WRITER_NATS_CLIENT_KEY":  "/certs/client.key",
+		"MF_INFLUX_WRITER_NATS_SERVER_NAME": "nats.example.com",
+	}
+	for k, v := range vars {
+		os.Setenv(k, v)
+		defer os.Unsetenv(k)
+	}
+
+	var cfg config
+	err := env.Load(&cfg)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	assert.Equal(t, "/certs/ca.crt", cfg.NatsCACert, fmt.Sprintf("expected CA /certs/ca.crt got %s", cfg.NatsCACert))
+	assert.Equal(t, "/certs/client.crt", cfg.NatsCert, fmt.Sprintf("expected client cert /certs/client.crt got %s", cfg.NatsCert))
+	assert.Equal(t, "/certs/client.key", cfg.NatsKey, fmt.Sprintf("expected client key /certs/client.key got %s", cfg.NatsKey))
+	assert.Equal(t, "nats.example.com", cfg.NatsServer, fmt.Sprintf("expected server name nats.example.com got %s", cfg.NatsServer))
+}
+
+func TestLoadNatsTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nats-certs")
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	defer os.RemoveAll(dir)
+	cert, key := newCert(t, dir)
+
+	cases := []struct {
+		desc   string
+		cfg    config
+		secure bool
+		certs  int
+		err    error
+	}{
+		{
+			desc:   "load configuration without TLS",
+			cfg:    config{},
+			secure: false,
+			err:    nil,
+		},
+		{
+			desc:   "load configuration with CA",
+			cfg:    config{NatsCACert: cert},
+			secure: true,
+			err:    nil,
+		},
+		{
+			desc:   "load configuration with server name only",
+			cfg:    config{NatsServer: "nats.example.com"},
+			secure: true,
+			err:    nil,
+		},
+		{
+			desc:   "load configuration with CA and client certificate",
+			cfg:    config{NatsCACert: cert, NatsCert: cert, NatsKey: key, NatsServer: "nats"},
+			secure: true,
+			certs:  1,
+			err:    nil,
+		},
+		{
+			desc: "load configuration with client certificate without key",
+			cfg:  config{NatsCert: cert},
+			err:  nats.ErrClientCertKey,
+		},
+		{
+			desc: "load configuration with client key without certificate",
+			cfg:  config{NatsKey: key},
+			err:  nats.ErrClientCertKey,
+		},
+		{
+			desc: "load configuration with missing CA",
+			cfg:  config{NatsCACert: filepath.Join(dir, "missing.crt")},
+			err:  nats.ErrLoadTLS,
+		},
+		{
+			desc: "load configuration with key as CA",
+			cfg:  config{NatsCACert: key},
+			err:  nats.ErrLoadTLS,
+		},
+		{
+			desc: "load configuration with certificate as key",
+			cfg:  config{NatsCert: cert, NatsKey: cert},
+			err:  nats.ErrLoadTLS,
+		},
+	}
+
+	for _, tc := range cases {
+		tlsCfg, err := loadNatsTLS(tc.cfg)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s\n", tc.desc, tc.err, err))
+		if tc.err != nil {
+			continue
+		}
+		assert.Equal(t, tc.secure, tlsCfg != nil, fmt.Sprintf("%s: expected secure %t got %t\n", tc.desc, tc.secure, tlsCfg != nil))
+		if tlsCfg == nil {
+			continue
+		}
+		assert.Equal(t, tc.cfg.NatsServer, tlsCfg.ServerName, fmt.Sprintf("%s: expected server name %s got %s\n", tc.desc, tc.cfg.NatsServer, tlsCfg.ServerName))
+		assert.Equal(t, tc.cfg.NatsCACert != "", tlsCfg.RootCAs != nil, fmt.Sprintf("%s: expected CA to be loaded\n", tc.desc))
+		assert.Len(t, tlsCfg.Certificates, tc.certs, fmt.Sprintf("%s: expected %d client certificates got %d\n", tc.desc, tc.certs, len(tlsCfg.Certificates)))
+	}
+}
+
+func TestNatsConnName(t *testing.T) {
+	host, err := os.Hostname()
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+
+	cases := []struct {
+		desc string
+		name string
+		tls  bool
+		want string
+	}{
+		{
+			desc: "name connection from configuration",
+			name: "influxdb-writer-eu-1",
+			want: "influxdb-writer-eu-1",
+		},
+		{
+			desc: "name connection by default",
+			name: "",
+			want: fmt.Sprintf("%s-%s", svcName, host),
+		},
+		{
+			desc: "name secured connection",
+			name: "influxdb-writer-eu-1",
+			tls:  true,
+			want: "influxdb-writer-eu-1",
+		},
+	}
+
+	for _, tc := range cases {
+		os.Setenv("MF_NATS_CONN_NAME", tc.name)
+		cfg, _ := loadConfigs()
+		os.Unsetenv("MF_NATS_CONN_NAME")
+		if tc.tls {
+			cfg.natsTLS = &tls.Config{ServerName: "nats"}
+		}
+
+		var opts broker.Options
+		for _, opt := range natsOptions(cfg) {
+			err := opt(&opts)
+			require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", tc.desc, err))
+		}
+		assert.Equal(t, tc.want, opts.Name, fmt.Sprintf("%s: expected connection name %s got %s\n", tc.desc, tc.want, opts.Name))
+		assert.Equal(t, tc.tls, opts.Secure, fmt.Sprintf("%s: expected secure %t got %t\n", tc.desc, tc.tls, opts.Secure))
+	}
+}
@@ -4,6 +4,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -13,6 +14,7 @@ import (
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -52,6 +54,7 @@ const (
 	defDBSSLCert       = ""
 	defDBSSLKey        = ""
 	defDBSSLRootCert   = ""
+	defDBReplicaHost   = ""
 	defClientTLS       = "false"
 	defCACerts         = ""
 	defCacheURL        = "localhost:6379"
@@ -70,6 +73,15 @@ const (
 	defJaegerURL       = ""
 	defAuthnURL        = "localhost:8181"
 	defAuthnTimeout    = "1s"
+	defChannelLimit    = "0"
+	defViewCacheTTL    = "0s"
+	defViewCacheSize   = "1000"
+	defKeySweep        = "1m"
+	defStrictGroups    = "false"
+	defCrossGroups     = ""
+	defMetadataKeys    = "0"
+	defMetadataBytes   = "0"
+	defAdminEmail      = ""
 
 	envLogLevel        = "MF_THINGS_LOG_LEVEL"
 	envDBHost          = "MF_THINGS_DB_HOST"
@@ -81,6 +93,8 @@ const (
 	envDBSSLCert       = "MF_THINGS_DB_SSL_CERT"
 	envDBSSLKey        = "MF_THINGS_DB_SSL_KEY"
 	envDBSSLRootCert   = "MF_THINGS_DB_SSL_ROOT_CERT"
+	envDBReplicaHost   = "MF_THINGS_DB_REPLICA_HOST"
+	envDBReplicaPort   = "MF_THINGS_DB_REPLICA_PORT"
 	envClientTLS       = "MF_THINGS_CLIENT_TLS"
 	envCACerts         = "MF_THINGS_CA_CERTS"
 	envCacheURL        = "MF_THINGS_CACHE_URL"
@@ -99,11 +113,23 @@ const (
 	envJaegerURL       = "MF_JAEGER_URL"
 	envAuthnURL        = "MF_AUTH_GRPC_URL"
 	envAuthnTimeout    = "MF_AUTH_GRPC_TIMEOUT"
+	envChannelLimit    = "MF_THINGS_CHANNEL_THINGS_LIMIT"
+	envViewCacheTTL    = "MF_THINGS_VIEW_CACHE_TTL"
+	envViewCacheSize   = "MF_THINGS_VIEW_CACHE_SIZE"
+	envKeySweep        = "MF_THINGS_KEY_SWEEP_INTERVAL"
+	envStrictGroups    = "MF_THINGS_STRICT_GROUPS"
+	envCrossGroups     = "MF_THINGS_CROSS_GROUPS"
+	envMetaSoftKeys    = "MF_THINGS_METADATA_SOFT_KEYS"
+	envMetaMaxKeys     = "MF_THINGS_METADATA_MAX_KEYS"
+	envMetaSoftBytes   = "MF_THINGS_METADATA_SOFT_BYTES"
+	envMetaMaxBytes    = "MF_THINGS_METADATA_MAX_BYTES"
+	envAdminEmail      = "MF_THINGS_ADMIN_EMAIL"
 )
 
 type config struct {
 	logLevel        string
 	dbConfig        postgres.Config
+	replicaConfig   *postgres.Config
 	clientTLS       bool
 	caCerts         string
 	cacheURL        string
@@ -122,6 +148,8 @@ type config struct {
 	jaegerURL       string
 	authnURL        string
 	authnTimeout    time.Duration
+	keySweep        time.Duration
+	svcConfig       things.Config
 }
 
 func main() {
@@ -142,6 +170,12 @@ func main() {
 	db := connectToDB(cfg.dbConfig, logger)
 	defer db.Close()
 
+	var replica *sqlx.DB
+	if cfg.replicaConfig != nil {
+		replica = connectToReplica(*cfg.replicaConfig, logger)
+		defer replica.Close()
+	}
+
 	authTracer, authCloser := initJaeger("auth", cfg.jaegerURL, logger)
 	defer authCloser.Close()
 
@@ -156,13 +190,22 @@ func main() {
 	cacheTracer, cacheCloser := initJaeger("things_cache", cfg.jaegerURL, logger)
 	defer cacheCloser.Close()
 
-	svc := newService(auth, dbTracer, cacheTracer, db, cacheClient, esClient, logger)
+	svc := newService(auth, dbTracer, cacheTracer, db, replica, cacheClient, esClient, cfg.svcConfig, logger)
 	errs := make(chan error, 2)
 
 	go startHTTPServer(thhttpapi.MakeHandler(thingsTracer, svc), cfg.httpPort, cfg, logger, errs)
 	go startHTTPServer(authhttpapi.MakeHandler(thingsTracer, svc), cfg.authHTTPPort, cfg, logger, errs)
 	go startGRPCServer(svc, thingsTracer, cfg, logger, errs)
 
+	if cfg.keySweep > 0 {
+		thingsRepo := tracing.ThingRepositoryMiddleware(dbTracer, postgres.NewThingRepository(postgres.NewDatabase(db)))
+		thingCache := tracing.ThingCacheMiddleware(cacheTracer, rediscache.NewThingCache(cacheClient))
+		sweeper := things.NewKeySweeper(thingsRepo, thingCache, time.Now)
+		go sweeper.Run(context.Background(), cfg.keySweep, func(err error) {
+			logger.Warn(fmt.Sprintf("Failed to remove expired thing keys: %s", err))
+		})
+	}
+
 	go func() {
 		c := make(chan os.Signal)
 		signal.Notify(c, syscall.SIGINT)
@@ -184,6 +227,43 @@ func loadConfig() config {
 		log.Fatalf("Invalid %s value: %s", envAuthnTimeout, err.Error())
 	}
 
+	channelLimit, err := strconv.ParseUint(mainflux.Env(envChannelLimit, defChannelLimit), 10, 64)
+	if err != nil {
+		log.Fatalf("Invalid %s value: %s", envChannelLimit, err.Error())
+	}
+
+	viewCacheTTL, err := time.ParseDuration(mainflux.Env(envViewCacheTTL, defViewCacheTTL))
+	if err != nil {
+		log.Fatalf("Invalid %s value: %s", envViewCacheTTL, err.Error())
+	}
+
+	viewCacheSize, err := strconv.Atoi(mainflux.Env(envViewCacheSize, defViewCacheSize))
+	if err != nil {
+		log.Fatalf("Invalid %s value: %s", envViewCacheSize, err.Error())
+	}
+
+	keySweep, err := time.ParseDuration(mainflux.Env(envKeySweep, defKeySweep))
+	if err != nil {
+		log.Fatalf("Invalid %s value: %s", envKeySweep, err.Error())
+	}
+
+	strictGroups, err := strconv.ParseBool(mainflux.Env(envStrictGroups, defStrictGroups))
+	if err != nil {
+		log.Fatalf("Invalid %s value: %s", envStrictGroups, err.Error())
+	}
+
+	crossGroups, err := parseCrossGroups(mainflux.Env(envCrossGroups, defCrossGroups))
+	if err != nil {
+		log.Fatalf("Invalid %s value: %s", envCrossGroups, err.Error())
+	}
+
+	metadataLimits := things.MetadataLimits{
+		SoftKeys:  envInt(envMetaSoftKeys, defMetadataKeys),
+		MaxKeys:   envInt(envMetaMaxKeys, defMetadataKeys),
+		SoftBytes: envInt(envMetaSoftBytes, defMetadataBytes),
+		MaxBytes:  envInt(envMetaMaxBytes, defMetadataBytes),
+	}
+
 	dbConfig := postgres.Config{
 		Host:        mainflux.Env(envDBHost, defDBHost),
 		Port:        mainflux.Env(envDBPort, defDBPort),
@@ -196,9 +276,18 @@ func loadConfig() config {
 		SSLRootCert: mainflux.Env(envDBSSLRootCert, defDBSSLRootCert),
 	}
 
+	var replicaConfig *postgres.Config
+	if host := mainflux.Env(envDBReplicaHost, defDBReplicaHost); host != "" {
+		rc := dbConfig
+		rc.Host = host
+		rc.Port = mainflux.Env(envDBReplicaPort, dbConfig.Port)
+		replicaConfig = &rc
+	}
+
 	return config{
 		logLevel:        mainflux.Env(envLogLevel, defLogLevel),
 		dbConfig:        dbConfig,
+		replicaConfig:   replicaConfig,
 		clientTLS:       tls,
 		caCerts:         mainflux.Env(envCACerts, defCACerts),
 		cacheURL:        mainflux.Env(envCacheURL, defCacheURL),
@@ -217,7 +306,49 @@ func loadConfig() config {
 		jaegerURL:       mainflux.Env(envJaegerURL, defJaegerURL),
 		authnURL:        mainflux.Env(envAuthnURL, defAuthnURL),
 		authnTimeout:    authnTimeout,
+		keySweep:        keySweep,
+		svcConfig: things.Config{
+			ChannelThingsLimit: channelLimit,
+			ViewCacheTTL:       viewCacheTTL,
+			ViewCacheSize:      viewCacheSize,
+			StrictGroups:       strictGroups,
+			CrossGroups:        crossGroups,
+			MetadataLimits:     metadataLimits,
+			AdminEmail:         mainflux.Env(envAdminEmail, defAdminEmail),
+		},
+	}
+}
+
+// envInt returns the non-negative integer value of the environment
+// variable.
+func envInt(key, fallback string) int {
+	v, err := strconv.Atoi(mainflux.Env(key, fallback))
+	if err == nil && v < 0 {
+		err = fmt.Errorf("negative value %d", v)
+	}
+	if err != nil {
+		log.Fatalf("Invalid %s value: %s", key, err.Error())
+	}
+	return v
+}
+
+// parseCrossGroups parses the comma separated thingGroup:channelGroup
+// pairs of the groups whose things can be connected to the channels of
+// the other group.
+func parseCrossGroups(s string) (map[string][]string, error) {
+	groups := make(map[string][]string)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		ids := strings.Split(pair, ":")
+		if len(ids) != 2 || ids[0] == "" || ids[1] == "" {
+			return nil, fmt.Errorf("%s is not a thingGroup:channelGroup pair", pair)
+		}
+		groups[ids[0]] = append(groups[ids[0]], ids[1])
 	}
+	return groups, nil
 }
 
 func initJaeger(svcName, url string, logger logger.Logger) (opentracing.Tracer, io.Closer) {
@@ -267,6 +398,15 @@ func connectToDB(dbConfig postgres.Config, logger logger.Logger) *sqlx.DB {
 	return db
 }
 
+func connectToReplica(dbConfig postgres.Config, logger logger.Logger) *sqlx.DB {
+	db, err := postgres.ConnectReplica(dbConfig)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to connect to postgres replica: %s", err))
+		os.Exit(1)
+	}
+	return db
+}
+
 func createAuthClient(cfg config, tracer opentracing.Tracer, logger logger.Logger) (mainflux.AuthServiceClient, func() error) {
 	if cfg.singleUserEmail != "" && cfg.singleUserToken != "" {
 		return localusers.NewSingleUserService(cfg.singleUserEmail, cfg.singleUserToken), nil
@@ -301,27 +441,57 @@ func connectToAuth(cfg config, logger logger.Logger) *grpc.ClientConn {
 	return conn
 }
 
-func newService(auth mainflux.AuthServiceClient, dbTracer opentracing.Tracer, cacheTracer opentracing.Tracer, db *sqlx.DB, cacheClient *redis.Client, esClient *redis.Client, logger logger.Logger) things.Service {
+func newService(auth mainflux.AuthServiceClient, dbTracer opentracing.Tracer, cacheTracer opentracing.Tracer, db, replica *sqlx.DB, cacheClient *redis.Client, esClient *redis.Client, svcConfig things.Config, logger logger.Logger) things.Service {
 	database := postgres.NewDatabase(db)
+	reader := database
+	if replica != nil {
+		reader = postgres.NewReplicaDatabase(database, postgres.NewDatabase(replica), logger)
+	}
 
-	thingsRepo := postgres.NewThingRepository(database)
+	thingsRepo := postgres.NewThingRepositoryWithReader(database, reader)
 	thingsRepo = tracing.ThingRepositoryMiddleware(dbTracer, thingsRepo)
 
-	channelsRepo := postgres.NewChannelRepository(database)
+	channelsRepo := postgres.NewChannelRepositoryWithReader(database, reader)
 	channelsRepo = tracing.ChannelRepositoryMiddleware(dbTracer, channelsRepo)
 
 	groupsRepo := postgres.NewGroupRepo(database)
 	groupsRepo = tracing.GroupRepositoryMiddleware(dbTracer, groupsRepo)
 
+	eventsRepo := postgres.NewConnectionEventRepository(database)
+	svcConfig.ConnectionEvents = tracing.ConnectionEventRepositoryMiddleware(dbTracer, eventsRepo)
+	svcConfig.Logger = logger
+	svcConfig.MetadataCounter = kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
+		Namespace: "things",
+		Subsystem: "api",
+		Name:      "metadata_soft_limit_count",
+		Help:      "Number of saved metadata exceeding the soft limits by entity and limit.",
+	}, []string{"entity", "limit"})
+
 	chanCache := rediscache.NewChannelCache(cacheClient)
 	chanCache = tracing.ChannelCacheMiddleware(cacheTracer, chanCache)
 
 	thingCache := rediscache.NewThingCache(cacheClient)
 	thingCache = tracing.ThingCacheMiddleware(cacheTracer, thingCache)
+	thingCache = api.CacheMetricsMiddleware(
+		thingCache,
+		kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
+			Namespace: "things",
+			Subsystem: "cache",
+			Name:      "key_lookup_count",
+			Help:      "Number of thing key lookups by result.",
+		}, []string{"result"}),
+		kitprometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+			Namespace: "things",
+			Subsystem: "cache",
+			Name:      "key_lookup_hit_ratio",
+			Help:      "Ratio of thing key lookups served by the cache.",
+		}, []string{}),
+	)
 	up := uuidProvider.New()
 
-	svc := things.New(auth, thingsRepo, channelsRepo, groupsRepo, chanCache, thingCache, up)
+	svc := things.NewWithConfig(auth, thingsRepo, channelsRepo, groupsRepo, chanCache, thingCache, up, svcConfig)
 	svc = rediscache.NewEventStoreMiddleware(svc, esClient)
+	svc = api.AuthorizationMiddleware(svc, auth, groupsRepo)
 	svc = api.LoggingMiddleware(svc, logger)
 	svc = api.MetricsMiddleware(
 		svc,
@@ -0,0 +1,135 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package logger
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Sampling defines how repeated identical warning and error messages are
+// logged.
+type Sampling struct {
+	// First is the number of occurrences of a message logged in each
+	// interval before the message is sampled.
+	First int
+
+	// Every makes the logger log one in Every occurrences of a message
+	// after the first ones. If zero, the remaining occurrences are dropped.
+	Every int
+
+	// Interval is how often the occurrence counts are reset and the number
+	// of suppressed messages is logged. If not positive, the counts are
+	// never reset, so the number of distinct messages should be bounded.
+	Interval time.Duration
+}
+
+var _ Logger = (*sampler)(nil)
+
+type sampler struct {
+	Logger
+	cfg        Sampling
+	mu         sync.Mutex
+	seen       map[entry]int
+	suppressed map[entry]int
+	since      time.Time
+}
+
+// entry identifies the messages counted together.
+type entry struct {
+	level Level
+	msg   string
+}
+
+// NewSampler returns a logger which limits the number of identical warning
+// and error messages written to the wrapped logger, so that a repeated
+// failure doesn't flood the log and hide its cause. The suppressed
+// messages are summarized once per interval, on the first message of the
+// next interval. If First is not positive, the logger is returned intact.
+func NewSampler(logger Logger, cfg Sampling) Logger {
+	if cfg.First <= 0 {
+		return logger
+	}
+	return &sampler{
+		Logger:     logger,
+		cfg:        cfg,
+		seen:       make(map[entry]int),
+		suppressed: make(map[entry]int),
+		since:      time.Now(),
+	}
+}
+
+func (s *sampler) Debug(msg string) {
+	s.rotate()
+	s.Logger.Debug(msg)
+}
+
+func (s *sampler) Info(msg string) {
+	s.rotate()
+	s.Logger.Info(msg)
+}
+
+func (s *sampler) Warn(msg string) {
+	if s.sample(Warn, msg) {
+		s.Logger.Warn(msg)
+	}
+}
+
+func (s *sampler) Error(msg string) {
+	if s.sample(Error, msg) {
+		s.Logger.Error(msg)
+	}
+}
+
+// sample reports whether the occurrence of the message is logged.
+func (s *sampler) sample(level Level, msg string) bool {
+	s.rotate()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e := entry{level, msg}
+	s.seen[e]++
+	n := s.seen[e]
+	if n <= s.cfg.First || (s.cfg.Every > 0 && (n-s.cfg.First)%s.cfg.Every == 0) {
+		return true
+	}
+	s.suppressed[e]++
+	return false
+}
+
+// rotate starts a new interval once the current one elapses, logging the
+// number of messages suppressed during it.
+func (s *sampler) rotate() {
+	if s.cfg.Interval <= 0 {
+		return
+	}
+
+	s.mu.Lock()
+	if time.Since(s.since) < s.cfg.Interval {
+		s.mu.Unlock()
+		return
+	}
+	suppressed := s.suppressed
+	s.seen = make(map[entry]int)
+	s.suppressed = make(map[entry]int)
+	s.since = time.Now()
+	s.mu.Unlock()
+
+	entries := make([]entry, 0, len(suppressed))
+	for e := range suppressed {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].msg != entries[j].msg {
+			return entries[i].msg < entries[j].msg
+		}
+		return entries[i].level < entries[j].level
+	})
+	for _, e := range entries {
+		s.Logger.Warn(fmt.Sprintf("Suppressed %d repeated %s messages: %s", suppressed[e], e.level, e.msg))
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package logger_test
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	log "github.com/mainflux/mainflux/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+var _ log.Logger = (*loggerMock)(nil)
+
+// loggerMock records the logged messages.
+type loggerMock struct {
+	mu   sync.Mutex
+	msgs []string
+}
+
+func (l *loggerMock) Debug(msg string) { l.log(msg) }
+func (l *loggerMock) Info(msg string)  { l.log(msg) }
+func (l *loggerMock) Warn(msg string)  { l.log(msg) }
+func (l *loggerMock) Error(msg string) { l.log(msg) }
+
+func (l *loggerMock) log(msg string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.msgs = append(l.msgs, msg)
+}
+
+func (l *loggerMock) count(prefix string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n := 0
+	for _, msg := range l.msgs {
+		if strings.HasPrefix(msg, prefix) {
+			n++
+		}
+	}
+	return n
+}
+
+func TestSampler(t *testing.T) {
+	cases := []struct {
+		desc     string
+		sampling log.Sampling
+		errors   int
+		logged   int
+	}{
+		{
+			desc:     "log first messages only",
+			sampling: log.Sampling{First: 5},
+			errors:   1000,
+			logged:   5,
+		},
+		{
+			desc:     "log first messages and then sample them",
+			sampling: log.Sampling{First: 5, Every: 100},
+			errors:   1000,
+			logged:   5 + 9,
+		},
+		{
+			desc:     "log messages below the sampling threshold",
+			sampling: log.Sampling{First: 5, Every: 100},
+			errors:   3,
+			logged:   3,
+		},
+		{
+			desc:     "log all messages with sampling disabled",
+			sampling: log.Sampling{},
+			errors:   1000,
+			logged:   1000,
+		},
+	}
+
+	for _, tc := range cases {
+		lm := &loggerMock{}
+		logger := log.NewSampler(lm, tc.sampling)
+		for i := 0; i < tc.errors; i++ {
+			logger.Warn("Failed to write message: connection refused")
+			logger.Error("Failed to write message: connection refused")
+		}
+		logged := lm.count("Failed to write message")
+		assert.Equal(t, 2*tc.logged, logged, fmt.Sprintf("%s: expected %d messages got %d", tc.desc, 2*tc.logged, logged))
+	}
+}
+
+func TestSamplerDistinctMessages(t *testing.T) {
+	lm := &loggerMock{}
+	logger := log.NewSampler(lm, log.Sampling{First: 2})
+	for i := 0; i < 100; i++ {
+		logger.Warn("Failed to write message: connection refused")
+		logger.Warn("Failed to write message: timeout")
+	}
+	logger.Info("Method save took 1ms to complete without errors.")
+
+	assert.Equal(t, 2, lm.count("Failed to write message: connection refused"), "expected each message to be sampled independently")
+	assert.Equal(t, 2, lm.count("Failed to write message: timeout"), "expected each message to be sampled independently")
+	assert.Equal(t, 1, lm.count("Method save"), "expected info messages not to be sampled")
+}
+
+func TestSamplerSummary(t *testing.T) {
+	lm := &loggerMock{}
+	interval := 50 * time.Millisecond
+	logger := log.NewSampler(lm, log.Sampling{First: 3, Interval: interval})
+
+	for i := 0; i < 1000; i++ {
+		logger.Warn("Failed to write message: connection refused")
+	}
+	assert.Equal(t, 0, lm.count("Suppressed"), "expected no summary before the interval elapses")
+
+	time.Sleep(interval)
+	logger.Info("Method save took 1ms to complete without errors.")
+
+	assert.Equal(t, 3, lm.count("Failed to write message"), "expected only the first messages to be logged")
+	assert.Equal(t, 1, lm.count("Suppressed 997 repeated warn messages: Failed to write message: connection refused"), fmt.Sprintf("expected suppressed count summary got %v", lm.msgs))
+
+	// A new interval logs the first messages again.
+	for i := 0; i < 10; i++ {
+		logger.Warn("Failed to write message: connection refused")
+	}
+	assert.Equal(t, 6, lm.count("Failed to write message"), "expected the first messages of the new interval to be logged")
+}
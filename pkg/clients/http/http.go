@@ -0,0 +1,496 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+// Package http provides an HTTP client for the requests Mainflux services
+// send to each other and to external services.
+package http
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"mime/multipart"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/mainflux/mainflux/pkg/errors"
+)
+
+var (
+	// ErrCreateRequest indicates that the request couldn't be created.
+	ErrCreateRequest = errors.New("failed to create request")
+
+	// ErrSendRequest indicates that the request couldn't be sent or that
+	// its response couldn't be read.
+	ErrSendRequest = errors.New("failed to send request")
+
+	// ErrLoadCerts indicates that the TLS certificates couldn't be loaded.
+	ErrLoadCerts = errors.New("failed to load certificates")
+
+	// ErrDecodeResponse indicates that the response was received, but its
+	// body couldn't be decoded.
+	ErrDecodeResponse = errors.New("failed to decode response")
+
+	errNoCACerts = errors.New("no CA certificates found")
+)
+
+const (
+	gzipEncoding = "gzip"
+	contentJSON  = "application/json"
+)
+
+// maxSnippet is the number of response body bytes kept in a StatusError.
+const maxSnippet = 256
+
+// defClient is shared by the package-level functions.
+var defClient Client = client{http: &http.Client{}}
+
+// Config defines the options of the client.
+type Config struct {
+	// Timeout is the time after which requests, including reading the
+	// response body, time out. If zero, requests are limited only by their
+	// context.
+	Timeout time.Duration
+
+	// ClientCert and ClientKey are the paths of the PEM encoded certificate
+	// and key the client authenticates with for mutual TLS. If empty, the
+	// client doesn't present a certificate.
+	ClientCert string
+	ClientKey  string
+
+	// CACerts is the path of the PEM encoded CA certificates the server
+	// certificates are verified with. If empty, the system roots are used.
+	CACerts string
+
+	// HTTPClient, if set, sends the requests instead of a client built from
+	// the other options, e.g. to use a custom transport.
+	HTTPClient *http.Client
+
+	// Retry defines how failed requests are retried. By default, requests
+	// are not retried.
+	Retry RetryConfig
+
+	// Headers are the default headers of every request, such as the
+	// authorization token. The headers passed to a request override them,
+	// but an empty Content-Type of a request doesn't override the default
+	// one.
+	Headers map[string]string
+}
+
+// RetryConfig defines how requests failing to be sent, or answered with a
+// status code in the 5xx range, are retried.
+type RetryConfig struct {
+	// MaxAttempts is the maximum number of times a request is sent. If
+	// less than two, requests are not retried.
+	MaxAttempts int
+
+	// BaseDelay is the delay before the first retry, doubled on each
+	// following retry.
+	BaseDelay time.Duration
+
+	// Jitter is the maximum random delay added to each retry delay, so
+	// that clients failing together don't retry together.
+	Jitter time.Duration
+
+	// Methods is the list of retried methods. If empty, the idempotent
+	// methods GET, HEAD, OPTIONS, PUT and DELETE are retried, and POST
+	// never is.
+	Methods []string
+}
+
+var defRetryMethods = []string{http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete}
+
+// retries reports whether requests with the method are retried.
+func (rc RetryConfig) retries(method string) bool {
+	if rc.MaxAttempts < 2 {
+		return false
+	}
+	methods := rc.Methods
+	if len(methods) == 0 {
+		methods = defRetryMethods
+	}
+	for _, m := range methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// delay returns the delay before the retry following the attempt, which
+// starts from 1.
+func (rc RetryConfig) delay(attempt int) time.Duration {
+	d := rc.BaseDelay << (attempt - 1)
+	if rc.Jitter > 0 {
+		d += time.Duration(rand.Int63n(int64(rc.Jitter)))
+	}
+	return d
+}
+
+var _ errors.Error = (*StatusError)(nil)
+
+// StatusError indicates a response with a status code outside of the 2xx
+// range. It wraps ErrSendRequest.
+type StatusError struct {
+	// Code is the status code of the response.
+	Code int
+
+	// Body is the beginning of the response body.
+	Body string
+}
+
+func (se *StatusError) Error() string {
+	return fmt.Sprintf("%s : %s", se.Msg(), se.Err())
+}
+
+// Msg returns the message of the wrapped ErrSendRequest.
+func (se *StatusError) Msg() string {
+	return ErrSendRequest.Msg()
+}
+
+// Err returns the description of the response.
+func (se *StatusError) Err() errors.Error {
+	return errors.New(fmt.Sprintf("unexpected status code %d: %s", se.Code, se.Body))
+}
+
+// Client sends HTTP requests.
+type Client interface {
+	// SendRequest sends the request and returns the response body and
+	// status code. A status code outside of the 2xx range is returned
+	// together with a StatusError.
+	SendRequest(method, path string, body []byte, headers map[string]string) ([]byte, int, error)
+
+	// SendRequestWithContext sends the request, which is cancelled once the
+	// context is done, and returns the response body and status code.
+	SendRequestWithContext(ctx context.Context, method, path string, body []byte, headers map[string]string) ([]byte, int, error)
+
+	// SendCompressedRequest sends the request with the gzip compressed
+	// body and returns the response body and status code.
+	SendCompressedRequest(method, path string, body []byte, headers map[string]string) ([]byte, int, error)
+
+	// SendMultipart sends the multipart/form-data request made of the
+	// fields and the files, keyed by their form names, and returns the
+	// response body and status code. The parts are streamed as they are
+	// written, so the request is never retried. Its Content-Type is always
+	// the multipart one, which carries the boundary of the parts.
+	SendMultipart(method, path string, fields map[string]string, files map[string]io.Reader, headers map[string]string) ([]byte, int, error)
+
+	// SendJSON sends the request with the JSON encoded reqObj as the body,
+	// unless it's nil, and decodes the JSON response body into respObj,
+	// unless it's nil or the body is empty. The Content-Type and Accept
+	// headers default to application/json. A response body which can't be
+	// decoded fails with ErrDecodeResponse.
+	SendJSON(method, path string, reqObj, respObj interface{}, headers map[string]string) error
+}
+
+var _ Client = (*client)(nil)
+
+type client struct {
+	http    *http.Client
+	retry   RetryConfig
+	headers http.Header
+}
+
+// NewClient returns a client configured with the provided options.
+func NewClient(cfg Config) (Client, error) {
+	headers := http.Header{}
+	for k, v := range cfg.Headers {
+		headers.Set(k, v)
+	}
+	if cfg.HTTPClient != nil {
+		return client{http: cfg.HTTPClient, retry: cfg.Retry, headers: headers}, nil
+	}
+
+	c := &http.Client{Timeout: cfg.Timeout}
+	if cfg.ClientCert == "" && cfg.CACerts == "" {
+		return client{http: c, retry: cfg.Retry, headers: headers}, nil
+	}
+
+	tlsCfg, err := loadTLSConfig(cfg)
+	if err != nil {
+		return nil, errors.Wrap(ErrLoadCerts, err)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsCfg
+	c.Transport = transport
+
+	return client{http: c, retry: cfg.Retry, headers: headers}, nil
+}
+
+func loadTLSConfig(cfg Config) (*tls.Config, error) {
+	tlsCfg := &tls.Config{}
+	if cfg.ClientCert != "" || cfg.ClientKey != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.ClientCert, cfg.ClientKey)
+		if err != nil {
+			return nil, err
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+	if cfg.CACerts != "" {
+		data, err := ioutil.ReadFile(cfg.CACerts)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, errNoCACerts
+		}
+		tlsCfg.RootCAs = pool
+	}
+	return tlsCfg, nil
+}
+
+// SendRequest sends the request using the default client, which is shared
+// by all the callers of the package-level functions, has no timeout and
+// uses the system TLS configuration. Use NewClient to configure them.
+func SendRequest(method, path string, body []byte, headers map[string]string) ([]byte, int, error) {
+	return defClient.SendRequest(method, path, body, headers)
+}
+
+// SendRequestWithContext sends the request using the default shared client,
+// which has no timeout, so the request is limited only by the context.
+func SendRequestWithContext(ctx context.Context, method, path string, body []byte, headers map[string]string) ([]byte, int, error) {
+	return defClient.SendRequestWithContext(ctx, method, path, body, headers)
+}
+
+// SendCompressedRequest sends the request with the gzip compressed body
+// using the default shared client, which has no timeout.
+func SendCompressedRequest(method, path string, body []byte, headers map[string]string) ([]byte, int, error) {
+	return defClient.SendCompressedRequest(method, path, body, headers)
+}
+
+// SendMultipart sends the multipart/form-data request using the default
+// shared client, which has no timeout.
+func SendMultipart(method, path string, fields map[string]string, files map[string]io.Reader, headers map[string]string) ([]byte, int, error) {
+	return defClient.SendMultipart(method, path, fields, files, headers)
+}
+
+// SendJSON sends the JSON request and decodes the JSON response using the
+// default shared client, which has no timeout.
+func SendJSON(method, path string, reqObj, respObj interface{}, headers map[string]string) error {
+	return defClient.SendJSON(method, path, reqObj, respObj, headers)
+}
+
+func (c client) SendRequest(method, path string, body []byte, headers map[string]string) ([]byte, int, error) {
+	return c.SendRequestWithContext(context.Background(), method, path, body, headers)
+}
+
+func (c client) SendRequestWithContext(ctx context.Context, method, path string, body []byte, headers map[string]string) ([]byte, int, error) {
+	return c.send(ctx, method, path, body, headers, false)
+}
+
+func (c client) SendCompressedRequest(method, path string, body []byte, headers map[string]string) ([]byte, int, error) {
+	return c.send(context.Background(), method, path, body, headers, true)
+}
+
+func (c client) send(ctx context.Context, method, path string, body []byte, headers map[string]string, compress bool) ([]byte, int, error) {
+	if compress {
+		var err error
+		if body, err = gzipBody(body); err != nil {
+			return nil, 0, errors.Wrap(ErrCreateRequest, err)
+		}
+	}
+
+	if !c.retry.retries(method) {
+		return c.sendOnce(ctx, method, path, body, headers, compress)
+	}
+	for attempt := 1; ; attempt++ {
+		data, code, err := c.sendOnce(ctx, method, path, body, headers, compress)
+		if attempt == c.retry.MaxAttempts || !retriable(err) {
+			return data, code, err
+		}
+
+		t := time.NewTimer(c.retry.delay(attempt))
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return data, code, err
+		}
+	}
+}
+
+func (c client) SendMultipart(method, path string, fields map[string]string, files map[string]io.Reader, headers map[string]string) ([]byte, int, error) {
+	pr, pw := io.Pipe()
+	req, err := http.NewRequest(method, path, pr)
+	if err != nil {
+		return nil, 0, errors.Wrap(ErrCreateRequest, err)
+	}
+
+	mw := multipart.NewWriter(pw)
+	c.setHeaders(req, headers)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	// The request body is closed once it's sent or the request fails,
+	// which stops the writing.
+	go func() {
+		pw.CloseWithError(writeParts(mw, fields, files))
+	}()
+	return c.do(req)
+}
+
+func (c client) SendJSON(method, path string, reqObj, respObj interface{}, headers map[string]string) error {
+	var body []byte
+	if reqObj != nil {
+		var err error
+		if body, err = json.Marshal(reqObj); err != nil {
+			return errors.Wrap(ErrCreateRequest, err)
+		}
+	}
+
+	hdrs := map[string]string{"Content-Type": contentJSON, "Accept": contentJSON}
+	for k, v := range headers {
+		hdrs[http.CanonicalHeaderKey(k)] = v
+	}
+	data, _, err := c.send(context.Background(), method, path, body, hdrs, false)
+	if err != nil {
+		return err
+	}
+
+	if respObj == nil || len(bytes.TrimSpace(data)) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(data, respObj); err != nil {
+		return errors.Wrap(ErrDecodeResponse, err)
+	}
+	return nil
+}
+
+// writeParts writes the fields and then the files, both ordered by name,
+// and closes the multipart writer. The files are named after their forms.
+func writeParts(mw *multipart.Writer, fields map[string]string, files map[string]io.Reader) error {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := mw.WriteField(name, fields[name]); err != nil {
+			return err
+		}
+	}
+
+	names = names[:0]
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		w, err := mw.CreateFormFile(name, name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(w, files[name]); err != nil {
+			return err
+		}
+	}
+	return mw.Close()
+}
+
+// retriable reports whether the request failed with an error which may
+// not occur again: a transport error or a status code in the 5xx range.
+func retriable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Contains(err, ErrCreateRequest) {
+		return false
+	}
+	if se, ok := err.(*StatusError); ok {
+		return se.Code >= http.StatusInternalServerError
+	}
+	return true
+}
+
+// sendOnce sends the request a single time. The body is read from the
+// provided slice on every call, so that it can be sent again.
+func (c client) sendOnce(ctx context.Context, method, path string, body []byte, headers map[string]string, compress bool) ([]byte, int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, path, bytes.NewReader(body))
+	if err != nil {
+		return nil, 0, errors.Wrap(ErrCreateRequest, err)
+	}
+
+	c.setHeaders(req, headers)
+	if compress {
+		req.Header.Set("Content-Encoding", gzipEncoding)
+		req.Header.Set("Accept-Encoding", gzipEncoding)
+	}
+	return c.do(req)
+}
+
+// do sends the request and reads its response.
+func (c client) do(req *http.Request) ([]byte, int, error) {
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, 0, errors.Wrap(ErrSendRequest, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := readBody(resp)
+	if err != nil {
+		return nil, resp.StatusCode, errors.Wrap(ErrSendRequest, err)
+	}
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		snippet := data
+		if len(snippet) > maxSnippet {
+			snippet = snippet[:maxSnippet]
+		}
+		return data, resp.StatusCode, &StatusError{Code: resp.StatusCode, Body: string(snippet)}
+	}
+
+	return data, resp.StatusCode, nil
+}
+
+// setHeaders sets the default headers of the client and then the headers
+// of the request, which win on collision regardless of the case of their
+// names. An empty Content-Type of the request keeps the default one.
+func (c client) setHeaders(req *http.Request, headers map[string]string) {
+	for k, v := range c.headers {
+		req.Header[k] = append([]string{}, v...)
+	}
+	for k, v := range headers {
+		if v == "" && http.CanonicalHeaderKey(k) == "Content-Type" {
+			continue
+		}
+		req.Header.Set(k, v)
+	}
+}
+
+func gzipBody(body []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(body); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// readBody reads the response body, decompressing it if it is gzip
+// encoded. The transport decompresses the responses itself unless the
+// request sets its own Accept-Encoding header.
+func readBody(resp *http.Response) ([]byte, error) {
+	if resp.Header.Get("Content-Encoding") != gzipEncoding {
+		return ioutil.ReadAll(resp.Body)
+	}
+	r, err := gzip.NewReader(resp.Body)
+	if err == io.EOF {
+		return []byte{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
@@ -0,0 +1,836 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package http_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	client "github.com/mainflux/mainflux/pkg/clients/http"
+	"github.com/mainflux/mainflux/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newClient(t *testing.T, cfg client.Config) client.Client {
+	c, err := client.NewClient(cfg)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	return c
+}
+
+func newServer(delay time.Duration) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, "%s %s %s", r.Method, r.Header.Get("Content-Type"), body)
+	}))
+}
+
+// closeTransport records whether the response bodies it returns are closed.
+type closeTransport struct {
+	http.RoundTripper
+	closed int32
+}
+
+func (ct *closeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := ct.RoundTripper.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = closeBody{ReadCloser: resp.Body, closed: &ct.closed}
+	return resp, nil
+}
+
+type closeBody struct {
+	io.ReadCloser
+	closed *int32
+}
+
+func (cb closeBody) Close() error {
+	atomic.StoreInt32(cb.closed, 1)
+	return cb.ReadCloser.Close()
+}
+
+func TestSendRequest(t *testing.T) {
+	ts := newServer(0)
+	defer ts.Close()
+
+	body, code, err := client.SendRequest(http.MethodPost, ts.URL, []byte("payload"), map[string]string{"Content-Type": "text/plain"})
+	assert.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	assert.Equal(t, http.StatusCreated, code, fmt.Sprintf("expected status %d got %d", http.StatusCreated, code))
+	assert.Equal(t, "POST text/plain payload", string(body), fmt.Sprintf("expected request to be echoed got %s", body))
+
+	_, _, err = client.SendRequest(http.MethodGet, "http://[::1", nil, nil)
+	assert.True(t, errors.Contains(err, client.ErrCreateRequest), fmt.Sprintf("expected %s got %s", client.ErrCreateRequest, err))
+}
+
+func TestSendRequestWithContext(t *testing.T) {
+	ts := newServer(time.Second)
+	defer ts.Close()
+
+	cases := []struct {
+		desc    string
+		client  client.Client
+		timeout time.Duration
+		err     error
+	}{
+		{
+			desc:    "send request to slow server with context deadline",
+			client:  newClient(t, client.Config{}),
+			timeout: 50 * time.Millisecond,
+			err:     client.ErrSendRequest,
+		},
+		{
+			desc:    "send request to slow server with client timeout",
+			client:  newClient(t, client.Config{Timeout: 50 * time.Millisecond}),
+			timeout: time.Minute,
+			err:     client.ErrSendRequest,
+		},
+		{
+			desc:    "send request to slow server within deadline",
+			client:  newClient(t, client.Config{}),
+			timeout: time.Minute,
+			err:     nil,
+		},
+	}
+
+	for _, tc := range cases {
+		ctx, cancel := context.WithTimeout(context.Background(), tc.timeout)
+		start := time.Now()
+		_, _, err := tc.client.SendRequestWithContext(ctx, http.MethodGet, ts.URL, nil, nil)
+		elapsed := time.Since(start)
+		cancel()
+
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s", tc.desc, tc.err, err))
+		if tc.err != nil {
+			assert.Less(t, int64(elapsed), int64(time.Second), fmt.Sprintf("%s: expected request to be cancelled got %s", tc.desc, elapsed))
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, _, err := client.SendRequestWithContext(ctx, http.MethodGet, ts.URL, nil, nil)
+	assert.True(t, err != nil && strings.Contains(err.Error(), context.DeadlineExceeded.Error()), fmt.Sprintf("expected %s got %s", context.DeadlineExceeded, err))
+}
+
+func TestSendRequestStatus(t *testing.T) {
+	long := strings.Repeat("e", 1024)
+	cases := []struct {
+		desc string
+		code int
+		body string
+		err  error
+	}{
+		{
+			desc: "send request with OK response",
+			code: http.StatusOK,
+			body: "ok",
+			err:  nil,
+		},
+		{
+			desc: "send request with bad request response",
+			code: http.StatusBadRequest,
+			body: "malformed request",
+			err:  client.ErrSendRequest,
+		},
+		{
+			desc: "send request with internal server error response",
+			code: http.StatusInternalServerError,
+			body: long,
+			err:  client.ErrSendRequest,
+		},
+	}
+
+	for _, tc := range cases {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tc.code)
+			fmt.Fprint(w, tc.body)
+		}))
+		body, code, err := client.SendRequest(http.MethodGet, ts.URL, nil, nil)
+		ts.Close()
+
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s", tc.desc, tc.err, err))
+		assert.Equal(t, tc.code, code, fmt.Sprintf("%s: expected status %d got %d", tc.desc, tc.code, code))
+		assert.Equal(t, tc.body, string(body), fmt.Sprintf("%s: expected body %s got %s", tc.desc, tc.body, body))
+		if tc.err == nil {
+			continue
+		}
+		se, ok := err.(*client.StatusError)
+		if !assert.True(t, ok, fmt.Sprintf("%s: expected status error got %T", tc.desc, err)) {
+			continue
+		}
+		assert.Equal(t, tc.code, se.Code, fmt.Sprintf("%s: expected error status %d got %d", tc.desc, tc.code, se.Code))
+		assert.True(t, strings.HasPrefix(tc.body, se.Body), fmt.Sprintf("%s: expected body snippet got %s", tc.desc, se.Body))
+		assert.LessOrEqual(t, len(se.Body), 256, fmt.Sprintf("%s: expected truncated body got %d bytes", tc.desc, len(se.Body)))
+		assert.Contains(t, err.Error(), fmt.Sprintf("%d", tc.code), fmt.Sprintf("%s: expected status code in error got %s", tc.desc, err))
+	}
+}
+
+func TestSendRequestTruncatedBody(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Announce more bytes than are sent and drop the connection.
+		w.Header().Set("Content-Length", "1024")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, "truncated")
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err == nil {
+			conn.Close()
+		}
+	}))
+	defer ts.Close()
+
+	ct := &closeTransport{RoundTripper: http.DefaultTransport}
+	c := newClient(t, client.Config{HTTPClient: &http.Client{Transport: ct, Timeout: time.Second}})
+
+	_, _, err := c.SendRequest(http.MethodGet, ts.URL, nil, nil)
+	assert.True(t, errors.Contains(err, client.ErrSendRequest), fmt.Sprintf("expected %s got %s", client.ErrSendRequest, err))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&ct.closed), "expected response body to be closed after a read error")
+}
+
+// newGzipServer returns a server which echoes the request body, decompressing
+// it if it is gzip encoded and compressing the response if the client
+// accepts it.
+func newGzipServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			defer zr.Close()
+			body = zr
+		}
+		data, err := ioutil.ReadAll(body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if r.Header.Get("Accept-Encoding") != "gzip" {
+			w.Write(data)
+			return
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		zw := gzip.NewWriter(w)
+		zw.Write(data)
+		zw.Close()
+	}))
+}
+
+func TestSendCompressedRequest(t *testing.T) {
+	ts := newGzipServer()
+	defer ts.Close()
+
+	var payload bytes.Buffer
+	payload.WriteString("[")
+	for i := 0; i < 1000; i++ {
+		if i > 0 {
+			payload.WriteString(",")
+		}
+		fmt.Fprintf(&payload, `{"bn":"base-name:","n":"temperature","u":"C","v":%d}`, i)
+	}
+	payload.WriteString("]")
+
+	cases := []struct {
+		desc    string
+		send    func(method, path string, body []byte, headers map[string]string) ([]byte, int, error)
+		body    []byte
+		headers map[string]string
+	}{
+		{
+			desc: "send compressed request",
+			send: client.SendCompressedRequest,
+			body: payload.Bytes(),
+		},
+		{
+			desc: "send compressed request with client",
+			send: newClient(t, client.Config{Timeout: time.Second}).SendCompressedRequest,
+			body: payload.Bytes(),
+		},
+		{
+			desc:    "send request accepting compressed response",
+			send:    client.SendRequest,
+			body:    payload.Bytes(),
+			headers: map[string]string{"Accept-Encoding": "gzip"},
+		},
+		{
+			desc: "send uncompressed request",
+			send: client.SendRequest,
+			body: payload.Bytes(),
+		},
+		{
+			desc: "send empty compressed request",
+			send: client.SendCompressedRequest,
+			body: []byte{},
+		},
+	}
+
+	for _, tc := range cases {
+		data, code, err := tc.send(http.MethodPost, ts.URL, tc.body, tc.headers)
+		assert.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", tc.desc, err))
+		assert.Equal(t, http.StatusOK, code, fmt.Sprintf("%s: expected status %d got %d", tc.desc, http.StatusOK, code))
+		assert.True(t, bytes.Equal(tc.body, data), fmt.Sprintf("%s: expected the decompressed body to match the sent one", tc.desc))
+	}
+}
+
+// certs holds the paths of the generated CA, server and client files.
+type certs struct {
+	ca, serverCert, serverKey, clientCert, clientKey string
+}
+
+func newCerts(t *testing.T, dir string) certs {
+	caKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Mainflux Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	ca, err := x509.ParseCertificate(caDER)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+
+	write := func(name, typ string, data []byte) string {
+		path := filepath.Join(dir, name)
+		err := ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: data}), 0600)
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+		return path
+	}
+	issue := func(name string, serial int64, usage x509.ExtKeyUsage) (string, string) {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+		tmpl := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: name},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+			ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+			IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, caKey)
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+		return write(name+".crt", "CERTIFICATE", der), write(name+".key", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(key))
+	}
+
+	c := certs{ca: write("ca.crt", "CERTIFICATE", caDER)}
+	c.serverCert, c.serverKey = issue("server", 2, x509.ExtKeyUsageServerAuth)
+	c.clientCert, c.clientKey = issue("client", 3, x509.ExtKeyUsageClientAuth)
+	return c
+}
+
+func TestNewClientMutualTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "http-client-certs")
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	defer os.RemoveAll(dir)
+	c := newCerts(t, dir)
+
+	pool := x509.NewCertPool()
+	data, err := ioutil.ReadFile(c.ca)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	pool.AppendCertsFromPEM(data)
+	serverCert, err := tls.LoadX509KeyPair(c.serverCert, c.serverKey)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.TLS.PeerCertificates[0].Subject.CommonName)
+	}))
+	ts.TLS = &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+	ts.StartTLS()
+	defer ts.Close()
+
+	cases := []struct {
+		desc string
+		cfg  client.Config
+		body string
+		err  error
+	}{
+		{
+			desc: "send request with client certificate",
+			cfg:  client.Config{ClientCert: c.clientCert, ClientKey: c.clientKey, CACerts: c.ca},
+			body: "client",
+			err:  nil,
+		},
+		{
+			desc: "send request without client certificate",
+			cfg:  client.Config{CACerts: c.ca},
+			err:  client.ErrSendRequest,
+		},
+		{
+			desc: "send request without CA certificates",
+			cfg:  client.Config{ClientCert: c.clientCert, ClientKey: c.clientKey},
+			err:  client.ErrSendRequest,
+		},
+	}
+
+	for _, tc := range cases {
+		body, _, err := newClient(t, tc.cfg).SendRequest(http.MethodGet, ts.URL, nil, nil)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s", tc.desc, tc.err, err))
+		assert.Equal(t, tc.body, string(body), fmt.Sprintf("%s: expected body %s got %s", tc.desc, tc.body, body))
+	}
+}
+
+func TestNewClientInvalidCerts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "http-client-certs")
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	defer os.RemoveAll(dir)
+	c := newCerts(t, dir)
+
+	cases := []struct {
+		desc string
+		cfg  client.Config
+	}{
+		{
+			desc: "create client with missing certificate",
+			cfg:  client.Config{ClientCert: filepath.Join(dir, "missing.crt"), ClientKey: c.clientKey},
+		},
+		{
+			desc: "create client with mismatched key",
+			cfg:  client.Config{ClientCert: c.clientCert, ClientKey: c.serverKey},
+		},
+		{
+			desc: "create client with missing CA certificates",
+			cfg:  client.Config{CACerts: filepath.Join(dir, "missing.crt")},
+		},
+		{
+			desc: "create client with malformed CA certificates",
+			cfg:  client.Config{CACerts: c.clientKey},
+		},
+	}
+
+	for _, tc := range cases {
+		_, err := client.NewClient(tc.cfg)
+		assert.True(t, errors.Contains(err, client.ErrLoadCerts), fmt.Sprintf("%s: expected %s got %s", tc.desc, client.ErrLoadCerts, err))
+	}
+}
+
+// newFlakyServer returns the server answering the first failures requests
+// with 503 and the following ones by echoing the request body, and the
+// counter of the received requests.
+func newFlakyServer(failures int32) (*httptest.Server, *int32) {
+	var count int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if atomic.AddInt32(&count, 1) <= failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintf(w, "%s %s", r.Method, body)
+	}))
+	return ts, &count
+}
+
+func TestSendRequestRetry(t *testing.T) {
+	retry := client.RetryConfig{MaxAttempts: 3, BaseDelay: time.Millisecond, Jitter: time.Millisecond}
+
+	cases := []struct {
+		desc     string
+		retry    client.RetryConfig
+		method   string
+		failures int32
+		code     int
+		body     string
+		requests int32
+		err      error
+	}{
+		{
+			desc:     "retry GET request until it succeeds",
+			retry:    retry,
+			method:   http.MethodGet,
+			failures: 2,
+			code:     http.StatusOK,
+			body:     "GET payload",
+			requests: 3,
+			err:      nil,
+		},
+		{
+			desc:     "retry PUT request with the same body",
+			retry:    retry,
+			method:   http.MethodPut,
+			failures: 2,
+			code:     http.StatusOK,
+			body:     "PUT payload",
+			requests: 3,
+			err:      nil,
+		},
+		{
+			desc:     "retry DELETE request until attempts run out",
+			retry:    client.RetryConfig{MaxAttempts: 2, BaseDelay: time.Millisecond},
+			method:   http.MethodDelete,
+			failures: 2,
+			code:     http.StatusServiceUnavailable,
+			body:     "",
+			requests: 2,
+			err:      client.ErrSendRequest,
+		},
+		{
+			desc:     "don't retry POST request by default",
+			retry:    retry,
+			method:   http.MethodPost,
+			failures: 2,
+			code:     http.StatusServiceUnavailable,
+			body:     "",
+			requests: 1,
+			err:      client.ErrSendRequest,
+		},
+		{
+			desc:     "retry POST request when configured",
+			retry:    client.RetryConfig{MaxAttempts: 3, BaseDelay: time.Millisecond, Methods: []string{http.MethodPost}},
+			method:   http.MethodPost,
+			failures: 2,
+			code:     http.StatusOK,
+			body:     "POST payload",
+			requests: 3,
+			err:      nil,
+		},
+		{
+			desc:     "don't retry request without retry configuration",
+			retry:    client.RetryConfig{},
+			method:   http.MethodGet,
+			failures: 2,
+			code:     http.StatusServiceUnavailable,
+			body:     "",
+			requests: 1,
+			err:      client.ErrSendRequest,
+		},
+	}
+
+	for _, tc := range cases {
+		ts, count := newFlakyServer(tc.failures)
+		c := newClient(t, client.Config{Retry: tc.retry})
+		body, code, err := c.SendRequest(tc.method, ts.URL, []byte("payload"), nil)
+		ts.Close()
+
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s", tc.desc, tc.err, err))
+		assert.Equal(t, tc.code, code, fmt.Sprintf("%s: expected status %d got %d", tc.desc, tc.code, code))
+		assert.Equal(t, tc.body, string(body), fmt.Sprintf("%s: expected body %s got %s", tc.desc, tc.body, body))
+		assert.Equal(t, tc.requests, atomic.LoadInt32(count), fmt.Sprintf("%s: expected %d requests got %d", tc.desc, tc.requests, atomic.LoadInt32(count)))
+	}
+}
+
+func TestSendRequestRetryStatus(t *testing.T) {
+	var count int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer ts.Close()
+
+	c := newClient(t, client.Config{Retry: client.RetryConfig{MaxAttempts: 3, BaseDelay: time.Millisecond}})
+	_, code, err := c.SendRequest(http.MethodGet, ts.URL, nil, nil)
+	assert.True(t, errors.Contains(err, client.ErrSendRequest), fmt.Sprintf("expected %s got %s", client.ErrSendRequest, err))
+	assert.Equal(t, http.StatusBadRequest, code, fmt.Sprintf("expected status %d got %d", http.StatusBadRequest, code))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&count), fmt.Sprintf("expected client error not to be retried got %d requests", atomic.LoadInt32(&count)))
+}
+
+func TestSendRequestRetryConnection(t *testing.T) {
+	// The listener is closed, so that connections to it are refused.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	url := "http://" + l.Addr().String()
+	l.Close()
+
+	c := newClient(t, client.Config{Retry: client.RetryConfig{MaxAttempts: 3, BaseDelay: 20 * time.Millisecond}})
+	start := time.Now()
+	_, _, err = c.SendRequest(http.MethodGet, url, nil, nil)
+	elapsed := time.Since(start)
+	assert.True(t, errors.Contains(err, client.ErrSendRequest), fmt.Sprintf("expected %s got %s", client.ErrSendRequest, err))
+	// Two retries, delayed by the base delay and its double.
+	assert.GreaterOrEqual(t, int64(elapsed), int64(60*time.Millisecond), fmt.Sprintf("expected connection errors to be retried got %s", elapsed))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	c = newClient(t, client.Config{Retry: client.RetryConfig{MaxAttempts: 3, BaseDelay: time.Minute}})
+	start = time.Now()
+	_, _, err = c.SendRequestWithContext(ctx, http.MethodGet, url, nil, nil)
+	elapsed = time.Since(start)
+	assert.True(t, errors.Contains(err, client.ErrSendRequest), fmt.Sprintf("expected %s got %s", client.ErrSendRequest, err))
+	assert.Less(t, int64(elapsed), int64(time.Second), fmt.Sprintf("expected retries to stop with the context got %s", elapsed))
+}
+
+func TestDefaultHeaders(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s|%s|%s", r.Header.Get("Authorization"), r.Header.Get("Content-Type"), r.Header.Get("X-Request-Id"))
+	}))
+	defer ts.Close()
+
+	cases := []struct {
+		desc     string
+		defaults map[string]string
+		headers  map[string]string
+		body     string
+	}{
+		{
+			desc:     "send request with default headers",
+			defaults: map[string]string{"Authorization": "token", "Content-Type": "application/json"},
+			headers:  nil,
+			body:     "token|application/json|",
+		},
+		{
+			desc:     "send request merging default and request headers",
+			defaults: map[string]string{"Authorization": "token"},
+			headers:  map[string]string{"X-Request-Id": "id"},
+			body:     "token||id",
+		},
+		{
+			desc:     "send request overriding default header",
+			defaults: map[string]string{"Authorization": "token"},
+			headers:  map[string]string{"Authorization": "other"},
+			body:     "other||",
+		},
+		{
+			desc:     "send request overriding default header of other case",
+			defaults: map[string]string{"authorization": "token"},
+			headers:  map[string]string{"AUTHORIZATION": "other"},
+			body:     "other||",
+		},
+		{
+			desc:     "send request with explicit content type",
+			defaults: map[string]string{"Content-Type": "application/json"},
+			headers:  map[string]string{"content-type": "application/senml+json"},
+			body:     "|application/senml+json|",
+		},
+		{
+			desc:     "send request with empty content type",
+			defaults: map[string]string{"Content-Type": "application/json"},
+			headers:  map[string]string{"Content-Type": ""},
+			body:     "|application/json|",
+		},
+		{
+			desc:     "send request with content type without default",
+			defaults: nil,
+			headers:  map[string]string{"Content-Type": "text/plain"},
+			body:     "|text/plain|",
+		},
+	}
+
+	for _, tc := range cases {
+		c := newClient(t, client.Config{Headers: tc.defaults})
+		body, _, err := c.SendRequest(http.MethodPost, ts.URL, []byte("payload"), tc.headers)
+		assert.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", tc.desc, err))
+		assert.Equal(t, tc.body, string(body), fmt.Sprintf("%s: expected headers %s got %s", tc.desc, tc.body, body))
+	}
+
+	// The defaults are copied, so that changing them doesn't change the
+	// headers of the client, and they aren't shared between requests.
+	defaults := map[string]string{"Authorization": "token"}
+	c := newClient(t, client.Config{Headers: defaults})
+	defaults["Authorization"] = "changed"
+	body, _, err := c.SendRequest(http.MethodGet, ts.URL, nil, map[string]string{"Authorization": "other"})
+	assert.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	assert.Equal(t, "other||", string(body), fmt.Sprintf("expected headers other|| got %s", body))
+	body, _, err = c.SendRequest(http.MethodGet, ts.URL, nil, nil)
+	assert.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	assert.Equal(t, "token||", string(body), fmt.Sprintf("expected headers token|| got %s", body))
+}
+
+func TestSendMultipart(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, err)
+			return
+		}
+		var parts []string
+		for name, vals := range r.MultipartForm.Value {
+			parts = append(parts, fmt.Sprintf("%s=%s", name, strings.Join(vals, ",")))
+		}
+		for name, fhs := range r.MultipartForm.File {
+			for _, fh := range fhs {
+				f, err := fh.Open()
+				if err != nil {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				data, _ := ioutil.ReadAll(f)
+				f.Close()
+				parts = append(parts, fmt.Sprintf("%s:%s=%s", name, fh.Filename, data))
+			}
+		}
+		sort.Strings(parts)
+		fmt.Fprintf(w, "%s|%s", r.Header.Get("Authorization"), strings.Join(parts, ";"))
+	}))
+	defer ts.Close()
+
+	cases := []struct {
+		desc     string
+		defaults map[string]string
+		fields   map[string]string
+		files    map[string]io.Reader
+		headers  map[string]string
+		body     string
+	}{
+		{
+			desc:   "send fields and files",
+			fields: map[string]string{"version": "1.2.0", "board": "esp32"},
+			files: map[string]io.Reader{
+				"firmware":  strings.NewReader("binary"),
+				"bootstrap": strings.NewReader("id,key\n1,a\n"),
+			},
+			body: "|board=esp32;bootstrap:bootstrap=id,key\n1,a\n;firmware:firmware=binary;version=1.2.0",
+		},
+		{
+			desc:     "send file with default content type",
+			defaults: map[string]string{"Authorization": "token", "Content-Type": "application/json"},
+			files:    map[string]io.Reader{"firmware": strings.NewReader("binary")},
+			body:     "token|firmware:firmware=binary",
+		},
+		{
+			desc:    "send file with explicit content type",
+			files:   map[string]io.Reader{"firmware": strings.NewReader("binary")},
+			headers: map[string]string{"Content-Type": "application/octet-stream"},
+			body:    "|firmware:firmware=binary",
+		},
+		{
+			desc: "send empty form",
+			body: "|",
+		},
+	}
+
+	for _, tc := range cases {
+		c := newClient(t, client.Config{Headers: tc.defaults})
+		body, code, err := c.SendMultipart(http.MethodPost, ts.URL, tc.fields, tc.files, tc.headers)
+		assert.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", tc.desc, err))
+		assert.Equal(t, http.StatusOK, code, fmt.Sprintf("%s: expected status %d got %d", tc.desc, http.StatusOK, code))
+		assert.Equal(t, tc.body, string(body), fmt.Sprintf("%s: expected body %q got %q", tc.desc, tc.body, body))
+	}
+
+	errRead := errors.New("failed to read file")
+	_, _, err := client.SendMultipart(http.MethodPost, ts.URL, nil, map[string]io.Reader{"firmware": failingReader{err: errRead}}, nil)
+	assert.True(t, errors.Contains(err, client.ErrSendRequest), fmt.Sprintf("send failing file: expected %s got %s", client.ErrSendRequest, err))
+}
+
+type failingReader struct {
+	err error
+}
+
+func (fr failingReader) Read(p []byte) (int, error) {
+	return 0, fr.err
+}
+
+func TestSendJSON(t *testing.T) {
+	type thing struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept") != "application/json" || r.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(http.StatusNotAcceptable)
+			return
+		}
+		switch r.URL.Path {
+		case "/malformed":
+			fmt.Fprint(w, `{"id":`)
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error":"not found"}`)
+		case "/empty":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			var th thing
+			if err := json.NewDecoder(r.Body).Decode(&th); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			th.ID = "1"
+			json.NewEncoder(w).Encode(th)
+		}
+	}))
+	defer ts.Close()
+
+	cases := []struct {
+		desc string
+		path string
+		req  interface{}
+		res  thing
+		err  error
+	}{
+		{
+			desc: "send JSON request and decode response",
+			path: "/things",
+			req:  thing{Name: "sensor"},
+			res:  thing{ID: "1", Name: "sensor"},
+			err:  nil,
+		},
+		{
+			desc: "send JSON request with empty response",
+			path: "/empty",
+			req:  nil,
+			res:  thing{},
+			err:  nil,
+		},
+		{
+			desc: "send JSON request with malformed response",
+			path: "/malformed",
+			req:  thing{Name: "sensor"},
+			res:  thing{},
+			err:  client.ErrDecodeResponse,
+		},
+		{
+			desc: "send JSON request with error status",
+			path: "/missing",
+			req:  nil,
+			res:  thing{},
+			err:  client.ErrSendRequest,
+		},
+		{
+			desc: "send request which can't be encoded",
+			path: "/things",
+			req:  map[string]interface{}{"value": make(chan int)},
+			res:  thing{},
+			err:  client.ErrCreateRequest,
+		},
+	}
+
+	for _, tc := range cases {
+		var res thing
+		err := client.SendJSON(http.MethodPost, ts.URL+tc.path, tc.req, &res, nil)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s", tc.desc, tc.err, err))
+		assert.Equal(t, tc.res, res, fmt.Sprintf("%s: expected %v got %v", tc.desc, tc.res, res))
+	}
+
+	// Decode errors are told apart from transport errors.
+	err := client.SendJSON(http.MethodGet, ts.URL+"/malformed", nil, &thing{}, nil)
+	assert.False(t, errors.Contains(err, client.ErrSendRequest), fmt.Sprintf("expected decode error not to be a send error got %s", err))
+	_, ok := err.(*client.StatusError)
+	assert.False(t, ok, "expected decode error not to be a status error")
+}
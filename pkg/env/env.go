@@ -0,0 +1,244 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+// Package env loads service configuration from environment variables.
+//
+// The configuration is a struct whose fields are tagged with the name of
+// the variable they are loaded from, the default value used when the
+// variable is unset or empty, and the rules the value has to satisfy:
+//
+//	type config struct {
+//		Port      string        `env:"MF_PORT" envDefault:"8180"`
+//		QueueSize int           `env:"MF_QUEUE_SIZE" envDefault:"0" validate:"min=0"`
+//		Timeout   time.Duration `env:"MF_TIMEOUT" envDefault:"10s" validate:"min=1s"`
+//		Policy    string        `env:"MF_POLICY" envDefault:"accept" validate:"oneof=accept reject"`
+//		URLs      []string      `env:"MF_URLS"`
+//	}
+//
+// Supported field kinds are strings, booleans, integers, floats, durations
+// and comma-separated string slices. Fields whose variable is unset and
+// which have no default get the zero value. Untagged struct fields are
+// loaded recursively.
+package env
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mainflux/mainflux/pkg/errors"
+)
+
+const (
+	nameTag     = "env"
+	defaultTag  = "envDefault"
+	validateTag = "validate"
+)
+
+var (
+	// ErrInvalidConfig indicates that one or more variables have invalid
+	// values.
+	ErrInvalidConfig = errors.New("invalid configuration")
+
+	// ErrUnsupportedType indicates that the configuration is not a pointer
+	// to a struct or that it has a field of unsupported type.
+	ErrUnsupportedType = errors.New("unsupported configuration type")
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Load populates the struct cfg points to from the environment. All the
+// invalid values are reported at once, wrapped in ErrInvalidConfig.
+func Load(cfg interface{}) error {
+	v := reflect.ValueOf(cfg)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return errors.Wrap(ErrUnsupportedType, fmt.Errorf("%T", cfg))
+	}
+
+	var invalid []string
+	if err := load(v.Elem(), &invalid); err != nil {
+		return err
+	}
+	if len(invalid) > 0 {
+		return errors.Wrap(ErrInvalidConfig, fmt.Errorf("%s", strings.Join(invalid, "; ")))
+	}
+	return nil
+}
+
+func load(v reflect.Value, invalid *[]string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		fv := v.Field(i)
+		name, ok := f.Tag.Lookup(nameTag)
+		if !ok {
+			if f.Type.Kind() == reflect.Struct && fv.CanSet() {
+				if err := load(fv, invalid); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if !fv.CanSet() {
+			return errors.Wrap(ErrUnsupportedType, fmt.Errorf("field %s is not exported", f.Name))
+		}
+
+		val := os.Getenv(name)
+		if val == "" {
+			val = f.Tag.Get(defaultTag)
+		}
+		// Variables without a value nor a default keep the zero value.
+		if val == "" {
+			fv.Set(reflect.Zero(f.Type))
+		} else if err := set(fv, val); err != nil {
+			if errors.Contains(err, ErrUnsupportedType) {
+				return err
+			}
+			*invalid = append(*invalid, fmt.Sprintf("%s: %s", name, err))
+			continue
+		}
+		if err := validate(fv, f.Tag.Get(validateTag)); err != nil {
+			if errors.Contains(err, ErrUnsupportedType) {
+				return err
+			}
+			*invalid = append(*invalid, fmt.Sprintf("%s: %s", name, err))
+		}
+	}
+	return nil
+}
+
+func set(v reflect.Value, val string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(val)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", val)
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(val)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", val)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(val, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", val)
+		}
+		v.SetInt(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(val, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid number %q", val)
+		}
+		v.SetFloat(n)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return errors.Wrap(ErrUnsupportedType, fmt.Errorf("%s", v.Type()))
+		}
+		items := reflect.MakeSlice(v.Type(), 0, 0)
+		for _, s := range strings.Split(val, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				items = reflect.Append(items, reflect.ValueOf(s).Convert(v.Type().Elem()))
+			}
+		}
+		v.Set(items)
+	default:
+		return errors.Wrap(ErrUnsupportedType, fmt.Errorf("%s", v.Type()))
+	}
+	return nil
+}
+
+// validate checks the value against the comma-separated rules. Supported
+// rules are min and max, which bound numbers, durations and the length of
+// strings and slices, and oneof, which lists the allowed string values.
+func validate(v reflect.Value, rules string) error {
+	if rules == "" {
+		return nil
+	}
+	for _, rule := range strings.Split(rules, ",") {
+		parts := strings.SplitN(rule, "=", 2)
+		if len(parts) != 2 {
+			return errors.Wrap(ErrUnsupportedType, fmt.Errorf("invalid rule %q", rule))
+		}
+		name, arg := parts[0], parts[1]
+
+		switch name {
+		case "oneof":
+			if !contains(strings.Fields(arg), v.String()) {
+				return fmt.Errorf("%q is not one of %s", v.String(), arg)
+			}
+		case "min", "max":
+			c, err := compare(v, arg)
+			if err != nil {
+				return err
+			}
+			if name == "min" && c < 0 {
+				return fmt.Errorf("must be at least %s", arg)
+			}
+			if name == "max" && c > 0 {
+				return fmt.Errorf("must be at most %s", arg)
+			}
+		default:
+			return errors.Wrap(ErrUnsupportedType, fmt.Errorf("unknown rule %q", name))
+		}
+	}
+	return nil
+}
+
+// compare returns -1, 0 or 1 if the value is less than, equal to or greater
+// than the bound.
+func compare(v reflect.Value, arg string) (int, error) {
+	var n, bound float64
+	switch {
+	case v.Type() == durationType:
+		d, err := time.ParseDuration(arg)
+		if err != nil {
+			return 0, errors.Wrap(ErrUnsupportedType, fmt.Errorf("invalid bound %q", arg))
+		}
+		n, bound = float64(v.Int()), float64(d)
+	default:
+		b, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return 0, errors.Wrap(ErrUnsupportedType, fmt.Errorf("invalid bound %q", arg))
+		}
+		bound = b
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			n = float64(v.Int())
+		case reflect.Float32, reflect.Float64:
+			n = v.Float()
+		case reflect.String, reflect.Slice:
+			n = float64(v.Len())
+		default:
+			return 0, errors.Wrap(ErrUnsupportedType, fmt.Errorf("%s can't be bounded", v.Type()))
+		}
+	}
+
+	switch {
+	case n < bound:
+		return -1, nil
+	case n > bound:
+		return 1, nil
+	default:
+		return 0, nil
+	}
+}
+
+func contains(vals []string, val string) bool {
+	for _, v := range vals {
+		if v == val {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,185 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package env_test
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/mainflux/mainflux/pkg/env"
+	"github.com/mainflux/mainflux/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type policy string
+
+type nested struct {
+	Create bool `env:"MF_TEST_DB_CREATE" envDefault:"false"`
+}
+
+type config struct {
+	Port     string        `env:"MF_TEST_PORT" envDefault:"8180"`
+	Size     int           `env:"MF_TEST_SIZE" envDefault:"10" validate:"min=1,max=100"`
+	Ratio    float64       `env:"MF_TEST_RATIO" envDefault:"0.5" validate:"max=1"`
+	Enabled  bool          `env:"MF_TEST_ENABLED" envDefault:"true"`
+	Timeout  time.Duration `env:"MF_TEST_TIMEOUT" envDefault:"10s" validate:"min=1s"`
+	Policy   policy        `env:"MF_TEST_POLICY" envDefault:"accept" validate:"oneof=accept reject"`
+	URLs     []string      `env:"MF_TEST_URLS"`
+	Database nested
+	ignored  string
+}
+
+var vars = []string{
+	"MF_TEST_PORT",
+	"MF_TEST_SIZE",
+	"MF_TEST_RATIO",
+	"MF_TEST_ENABLED",
+	"MF_TEST_TIMEOUT",
+	"MF_TEST_POLICY",
+	"MF_TEST_URLS",
+	"MF_TEST_DB_CREATE",
+}
+
+func TestLoad(t *testing.T) {
+	defaults := config{
+		Port:    "8180",
+		Size:    10,
+		Ratio:   0.5,
+		Enabled: true,
+		Timeout: 10 * time.Second,
+		Policy:  "accept",
+	}
+
+	cases := []struct {
+		desc    string
+		env     map[string]string
+		cfg     config
+		err     error
+		invalid []string
+	}{
+		{
+			desc: "load defaults",
+			env:  map[string]string{},
+			cfg:  defaults,
+			err:  nil,
+		},
+		{
+			desc: "load overridden values",
+			env: map[string]string{
+				"MF_TEST_PORT":      "9000",
+				"MF_TEST_SIZE":      "100",
+				"MF_TEST_RATIO":     "0.25",
+				"MF_TEST_ENABLED":   "false",
+				"MF_TEST_TIMEOUT":   "1m",
+				"MF_TEST_POLICY":    "reject",
+				"MF_TEST_URLS":      "http://a:8086, http://b:8086,",
+				"MF_TEST_DB_CREATE": "true",
+			},
+			cfg: config{
+				Port:     "9000",
+				Size:     100,
+				Ratio:    0.25,
+				Enabled:  false,
+				Timeout:  time.Minute,
+				Policy:   "reject",
+				URLs:     []string{"http://a:8086", "http://b:8086"},
+				Database: nested{Create: true},
+			},
+			err: nil,
+		},
+		{
+			desc: "load empty value",
+			env:  map[string]string{"MF_TEST_PORT": ""},
+			cfg:  defaults,
+			err:  nil,
+		},
+		{
+			desc: "load malformed values",
+			env: map[string]string{
+				"MF_TEST_SIZE":    "ten",
+				"MF_TEST_ENABLED": "maybe",
+				"MF_TEST_TIMEOUT": "10",
+			},
+			err:     env.ErrInvalidConfig,
+			invalid: []string{"MF_TEST_SIZE", "MF_TEST_ENABLED", "MF_TEST_TIMEOUT"},
+		},
+		{
+			desc: "load values failing validation",
+			env: map[string]string{
+				"MF_TEST_SIZE":    "0",
+				"MF_TEST_RATIO":   "1.5",
+				"MF_TEST_TIMEOUT": "1ms",
+				"MF_TEST_POLICY":  "clamp",
+			},
+			err:     env.ErrInvalidConfig,
+			invalid: []string{"MF_TEST_SIZE", "MF_TEST_RATIO", "MF_TEST_TIMEOUT", "MF_TEST_POLICY"},
+		},
+	}
+
+	for _, tc := range cases {
+		for _, v := range vars {
+			os.Unsetenv(v)
+		}
+		for k, v := range tc.env {
+			os.Setenv(k, v)
+		}
+
+		var cfg config
+		err := env.Load(&cfg)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s\n", tc.desc, tc.err, err))
+		for _, v := range tc.invalid {
+			require.NotNil(t, err, fmt.Sprintf("%s: expected error\n", tc.desc))
+			assert.Contains(t, err.Error(), v, fmt.Sprintf("%s: expected %s to be reported\n", tc.desc, v))
+		}
+		if tc.err == nil {
+			assert.Equal(t, tc.cfg, cfg, fmt.Sprintf("%s: expected %v got %v\n", tc.desc, tc.cfg, cfg))
+		}
+	}
+
+	for _, v := range vars {
+		os.Unsetenv(v)
+	}
+}
+
+func TestLoadUnsupportedType(t *testing.T) {
+	cases := []struct {
+		desc string
+		cfg  interface{}
+	}{
+		{
+			desc: "load non-pointer",
+			cfg:  config{},
+		},
+		{
+			desc: "load pointer to non-struct",
+			cfg:  new(string),
+		},
+		{
+			desc: "load unsupported field type",
+			cfg: &struct {
+				Sizes []int `env:"MF_TEST_SIZES" envDefault:"1,2"`
+			}{},
+		},
+		{
+			desc: "load unexported tagged field",
+			cfg: &struct {
+				port string `env:"MF_TEST_PORT"`
+			}{},
+		},
+		{
+			desc: "load unknown validation rule",
+			cfg: &struct {
+				Port string `env:"MF_TEST_PORT" envDefault:"8180" validate:"port=1"`
+			}{},
+		},
+	}
+
+	for _, tc := range cases {
+		err := env.Load(tc.cfg)
+		assert.True(t, errors.Contains(err, env.ErrUnsupportedType), fmt.Sprintf("%s: expected %s got %s\n", tc.desc, env.ErrUnsupportedType, err))
+	}
+}
@@ -4,6 +4,7 @@
 package nats
 
 import (
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"sync"
@@ -32,6 +33,14 @@ var _ messaging.PubSub = (*pubsub)(nil)
 // Close() method for NATS connection.
 type PubSub interface {
 	messaging.PubSub
+
+	// Connected reports whether the NATS connection is established.
+	Connected() bool
+
+	// PublishSubject publishes the message to the subject as is, unlike
+	// Publish which publishes it to the subject of its channel.
+	PublishSubject(subject string, msg messaging.Message) error
+
 	Close()
 }
 
@@ -51,7 +60,24 @@ type pubsub struct {
 // here: https://docs.nats.io/developing-with-nats/receiving/queues.
 // If the queue is empty, Subscribe will be used.
 func NewPubSub(url, queue string, logger log.Logger) (PubSub, error) {
-	conn, err := broker.Connect(url)
+	return NewPubSubWithTLS(url, queue, nil, logger)
+}
+
+// NewPubSubWithTLS returns NATS message publisher/subscriber, which
+// secures the connection with the TLS configuration unless it is nil.
+func NewPubSubWithTLS(url, queue string, tc *tls.Config, logger log.Logger) (PubSub, error) {
+	var opts []broker.Option
+	if tc != nil {
+		opts = append(opts, broker.Secure(tc))
+	}
+	return NewPubSubWithOptions(url, queue, logger, opts...)
+}
+
+// NewPubSubWithOptions returns NATS message publisher/subscriber, which
+// connects with the options, such as the connection name shown by the NATS
+// monitoring or the TLS configuration.
+func NewPubSubWithOptions(url, queue string, logger log.Logger, opts ...broker.Option) (PubSub, error) {
+	conn, err := broker.Connect(url, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -81,6 +107,14 @@ func (ps *pubsub) Publish(topic string, msg messaging.Message) error {
 	return nil
 }
 
+func (ps *pubsub) PublishSubject(subject string, msg messaging.Message) error {
+	data, err := proto.Marshal(&msg)
+	if err != nil {
+		return err
+	}
+	return ps.conn.Publish(subject, data)
+}
+
 func (ps *pubsub) Subscribe(topic string, handler messaging.MessageHandler) error {
 	if topic == "" {
 		return errEmptyTopic
@@ -128,6 +162,10 @@ func (ps *pubsub) Unsubscribe(topic string) error {
 	return nil
 }
 
+func (ps *pubsub) Connected() bool {
+	return ps.conn.IsConnected()
+}
+
 func (ps *pubsub) Close() {
 	ps.conn.Close()
 }
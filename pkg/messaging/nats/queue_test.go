@@ -0,0 +1,78 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+// +build integration
+
+package nats_test
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mainflux/mainflux/logger"
+	"github.com/mainflux/mainflux/pkg/messaging"
+	"github.com/mainflux/mainflux/pkg/messaging/nats"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	queue      = "writers"
+	queueTopic = "queue"
+	queueMsgs  = 100
+)
+
+func TestQueueGroup(t *testing.T) {
+	logger, err := logger.New(os.Stdout, "error")
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	var mu sync.Mutex
+	received := make(map[int64]int)
+	handled := make([]int, 2)
+	for i := range handled {
+		ps, err := nats.NewPubSub(address, queue, logger)
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+		defer ps.Close()
+
+		i := i
+		err = ps.Subscribe(fmt.Sprintf("%s.%s", chansPrefix, queueTopic), func(msg messaging.Message) error {
+			mu.Lock()
+			defer mu.Unlock()
+			received[msg.Created]++
+			handled[i]++
+			return nil
+		})
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	}
+
+	for i := 0; i < queueMsgs; i++ {
+		err := publisher.Publish(queueTopic, messaging.Message{Channel: queueTopic, Created: int64(i)})
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	}
+
+	total := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		n := 0
+		for _, c := range received {
+			n += c
+		}
+		return n
+	}
+	assert.Eventually(t, func() bool { return total() >= queueMsgs }, 5*time.Second, 10*time.Millisecond, "expected all messages to be delivered")
+	// Leave time for duplicate deliveries to arrive.
+	time.Sleep(100 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, queueMsgs, len(received), fmt.Sprintf("expected %d distinct messages got %d", queueMsgs, len(received)))
+	for created, c := range received {
+		assert.Equal(t, 1, c, fmt.Sprintf("expected message %d to be delivered once got %d", created, c))
+	}
+	for i, c := range handled {
+		assert.NotZero(t, c, fmt.Sprintf("expected subscriber %d to handle messages", i))
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package nats
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+
+	"github.com/mainflux/mainflux/pkg/errors"
+)
+
+var (
+	// ErrLoadTLS indicates that the TLS configuration of the NATS
+	// connection could not be loaded.
+	ErrLoadTLS = errors.New("failed to load NATS TLS configuration")
+
+	// ErrClientCertKey indicates that only one of the client certificate
+	// and key is set.
+	ErrClientCertKey = errors.New("client certificate and key must be set together")
+
+	errParseCA = errors.New("no certificates found in CA file")
+)
+
+// TLSConfig defines the TLS options of the NATS connection.
+type TLSConfig struct {
+	// CACert is the path of the PEM encoded certificates used to verify
+	// the NATS server. If empty, the system certificates are used.
+	CACert string
+
+	// ClientCert and ClientKey are the paths of the PEM encoded
+	// certificate and key the client authenticates with.
+	ClientCert string
+	ClientKey  string
+
+	// ServerName overrides the name used to verify the server certificate.
+	ServerName string
+}
+
+// LoadTLS reads the files of the configuration and returns the TLS
+// configuration of the NATS connection. It returns nil if none of the
+// options is set, in which case the connection is not secured.
+func LoadTLS(cfg TLSConfig) (*tls.Config, error) {
+	if cfg == (TLSConfig{}) {
+		return nil, nil
+	}
+	if (cfg.ClientCert == "") != (cfg.ClientKey == "") {
+		return nil, errors.Wrap(ErrLoadTLS, ErrClientCertKey)
+	}
+
+	tc := &tls.Config{ServerName: cfg.ServerName}
+	if cfg.CACert != "" {
+		data, err := ioutil.ReadFile(cfg.CACert)
+		if err != nil {
+			return nil, errors.Wrap(ErrLoadTLS, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, errors.Wrap(ErrLoadTLS, errParseCA)
+		}
+		tc.RootCAs = pool
+	}
+	if cfg.ClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.ClientCert, cfg.ClientKey)
+		if err != nil {
+			return nil, errors.Wrap(ErrLoadTLS, err)
+		}
+		tc.Certificates = []tls.Certificate{cert}
+	}
+	return tc, nil
+}
@@ -0,0 +1,205 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package servers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/mainflux/mainflux/logger"
+	"github.com/mainflux/mainflux/pkg/errors"
+)
+
+var (
+	// ErrServe indicates that a server of the group stopped serving before
+	// the group was shut down.
+	ErrServe = errors.New("server stopped serving")
+
+	// ErrStopGroup indicates that some of the servers of the group failed
+	// to stop gracefully. It wraps the names and the errors of the failed
+	// servers.
+	ErrStopGroup = errors.New("failed to stop servers gracefully")
+)
+
+// Server is a server run by a Group.
+type Server interface {
+	// Serve serves until the server is shut down. It returns nil or
+	// http.ErrServerClosed once the server is shut down.
+	Serve() error
+
+	// Shutdown stops the server, waiting for the in-flight requests until
+	// the context is done.
+	Shutdown(ctx context.Context) error
+}
+
+// NewCloser returns the server which serves with serve, and is shut down
+// by closing c, such as a gRPC server that stops on Close.
+func NewCloser(serve func() error, c io.Closer) Server {
+	return closer{serve: serve, c: c}
+}
+
+type closer struct {
+	serve func() error
+	c     io.Closer
+}
+
+func (c closer) Serve() error {
+	return c.serve()
+}
+
+func (c closer) Shutdown(ctx context.Context) error {
+	return c.c.Close()
+}
+
+// Group runs several servers of a service, such as its HTTP and gRPC
+// servers, and shuts them down together.
+type Group struct {
+	stopWaitTime time.Duration
+	logger       logger.Logger
+
+	mu      sync.Mutex
+	names   []string
+	servers []Server
+}
+
+// NewGroup returns an empty group whose servers are waited for up to
+// stopWaitTime on shutdown. If zero, DefaultStopWaitTime is used.
+func NewGroup(stopWaitTime time.Duration, logger logger.Logger) *Group {
+	return &Group{
+		stopWaitTime: orDefault(stopWaitTime, DefaultStopWaitTime),
+		logger:       logger,
+	}
+}
+
+// Add registers the server under the name, which identifies the server in
+// the logs and the errors. Servers added after Run are not started.
+func (g *Group) Add(name string, srv Server) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.names = append(g.names, name)
+	g.servers = append(g.servers, srv)
+}
+
+// Run serves all the servers until the context is done or one of them
+// stops serving, and then shuts them all down. It returns the error of the
+// server which stopped serving, combined with the errors of the shutdown.
+func (g *Group) Run(ctx context.Context) error {
+	names, servers := g.snapshot()
+	errs := make(chan error, len(servers))
+	for i, srv := range servers {
+		go func(name string, srv Server) {
+			g.logger.Info(fmt.Sprintf("Server %s started", name))
+			if err := srv.Serve(); err != nil && err != http.ErrServerClosed {
+				errs <- errors.Wrap(ErrServe, errors.Wrap(fmt.Errorf("%s", name), err))
+				return
+			}
+			errs <- errors.Wrap(ErrServe, fmt.Errorf("%s", name))
+		}(names[i], srv)
+	}
+
+	var serveErr error
+	select {
+	case serveErr = <-errs:
+	case <-ctx.Done():
+	}
+
+	if err := g.Shutdown(context.Background()); err != nil {
+		if serveErr == nil {
+			return err
+		}
+		return join(serveErr, err)
+	}
+	return serveErr
+}
+
+// Shutdown stops all the servers concurrently, waiting for them until the
+// context is done or the stop wait time elapses. It returns ErrStopGroup
+// wrapping the names and the errors of the servers which failed to stop,
+// including the ones still stopping once the wait is over.
+func (g *Group) Shutdown(ctx context.Context) error {
+	names, servers := g.snapshot()
+	ctx, cancel := context.WithTimeout(ctx, g.stopWaitTime)
+	defer cancel()
+
+	type result struct {
+		i   int
+		err error
+	}
+	results := make(chan result, len(servers))
+	for i, srv := range servers {
+		go func(i int, srv Server) {
+			results <- result{i: i, err: srv.Shutdown(ctx)}
+		}(i, srv)
+	}
+
+	errs := make([]error, len(servers))
+	stopped := make([]bool, len(servers))
+	for n := 0; n < len(servers); n++ {
+		select {
+		case r := <-results:
+			stopped[r.i] = true
+			errs[r.i] = r.err
+		case <-ctx.Done():
+			n = len(servers)
+		}
+	}
+
+	var failed []error
+	for i, name := range names {
+		err := errs[i]
+		if !stopped[i] {
+			err = ctx.Err()
+		}
+		if err == nil {
+			g.logger.Info(fmt.Sprintf("Server %s stopped", name))
+			continue
+		}
+		g.logger.Error(fmt.Sprintf("Failed to stop server %s gracefully: %s", name, err))
+		failed = append(failed, errors.Wrap(fmt.Errorf("%s", name), err))
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	return errors.Wrap(ErrStopGroup, join(failed...))
+}
+
+func (g *Group) snapshot() ([]string, []Server) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]string{}, g.names...), append([]Server{}, g.servers...)
+}
+
+// join chains the layers of the errors one after another, so that
+// errors.Contains finds each layer of each of them.
+func join(errs ...error) error {
+	var msgs []string
+	for _, err := range errs {
+		for e := err; e != nil; {
+			ce, ok := e.(errors.Error)
+			if !ok {
+				msgs = append(msgs, e.Error())
+				break
+			}
+			msgs = append(msgs, ce.Msg())
+			if ce.Err() == nil {
+				break
+			}
+			e = ce.Err()
+		}
+	}
+
+	var res error
+	for i := len(msgs) - 1; i >= 0; i-- {
+		if res == nil {
+			res = errors.New(msgs[i])
+			continue
+		}
+		res = errors.Wrap(errors.New(msgs[i]), res)
+	}
+	return res
+}
@@ -0,0 +1,178 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package servers_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mainflux/mainflux/pkg/errors"
+	"github.com/mainflux/mainflux/pkg/servers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serverMock serves until it's shut down, and fails the shutdown with err.
+// If hang is set, the shutdown waits until the context is done.
+type serverMock struct {
+	mu       sync.Mutex
+	err      error
+	hang     bool
+	serveErr error
+	done     chan struct{}
+	stopped  bool
+}
+
+func newServerMock(err error) *serverMock {
+	return &serverMock{err: err, done: make(chan struct{})}
+}
+
+func (s *serverMock) Serve() error {
+	if s.serveErr != nil {
+		return s.serveErr
+	}
+	<-s.done
+	return http.ErrServerClosed
+}
+
+func (s *serverMock) Shutdown(ctx context.Context) error {
+	if s.hang {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.stopped {
+		s.stopped = true
+		close(s.done)
+	}
+	return s.err
+}
+
+func (s *serverMock) isStopped() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stopped
+}
+
+func TestGroupShutdown(t *testing.T) {
+	errHTTP := errors.New("http shutdown failed")
+	errGRPC := errors.New("grpc shutdown failed")
+
+	cases := []struct {
+		desc   string
+		errs   []error
+		hang   bool
+		failed []error
+	}{
+		{
+			desc:   "shut down servers",
+			errs:   []error{nil, nil},
+			failed: nil,
+		},
+		{
+			desc:   "shut down servers with one failing",
+			errs:   []error{errHTTP, nil},
+			failed: []error{errHTTP},
+		},
+		{
+			desc:   "shut down servers with both failing",
+			errs:   []error{errHTTP, errGRPC},
+			failed: []error{errHTTP, errGRPC},
+		},
+		{
+			desc:   "shut down servers with one hanging",
+			errs:   []error{nil, nil},
+			hang:   true,
+			failed: []error{context.DeadlineExceeded},
+		},
+	}
+
+	for _, tc := range cases {
+		g := servers.NewGroup(50*time.Millisecond, testLog)
+		srvs := []*serverMock{newServerMock(tc.errs[0]), newServerMock(tc.errs[1])}
+		srvs[1].hang = tc.hang
+		g.Add("http", srvs[0])
+		g.Add("grpc", srvs[1])
+
+		begin := time.Now()
+		err := g.Shutdown(context.Background())
+		assert.Less(t, int64(time.Since(begin)), int64(time.Second), fmt.Sprintf("%s: expected shutdown to be bounded by the stop wait time", tc.desc))
+		if tc.failed == nil {
+			assert.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", tc.desc, err))
+		} else {
+			assert.True(t, errors.Contains(err, servers.ErrStopGroup), fmt.Sprintf("%s: expected %s got %s", tc.desc, servers.ErrStopGroup, err))
+		}
+		for _, e := range tc.failed {
+			assert.True(t, errors.Contains(err, e), fmt.Sprintf("%s: expected %s got %s", tc.desc, e, err))
+		}
+		assert.True(t, srvs[0].isStopped(), fmt.Sprintf("%s: expected http server to be shut down", tc.desc))
+		assert.Equal(t, !tc.hang, srvs[1].isStopped(), fmt.Sprintf("%s: expected grpc server to be shut down", tc.desc))
+	}
+}
+
+func TestGroupRun(t *testing.T) {
+	g := servers.NewGroup(time.Second, testLog)
+	srvs := []*serverMock{newServerMock(nil), newServerMock(nil)}
+	g.Add("http", srvs[0])
+	g.Add("grpc", srvs[1])
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() { errs <- g.Run(ctx) }()
+	cancel()
+
+	select {
+	case err := <-errs:
+		assert.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	case <-time.After(time.Second):
+		require.Fail(t, "expected group to stop")
+	}
+	for i, s := range srvs {
+		assert.True(t, s.isStopped(), fmt.Sprintf("expected server %d to be shut down", i))
+	}
+}
+
+func TestGroupRunServeFailure(t *testing.T) {
+	errServe := errors.New("listen failed")
+	errStop := errors.New("shutdown failed")
+
+	g := servers.NewGroup(time.Second, testLog)
+	failing := newServerMock(nil)
+	failing.serveErr = errServe
+	other := newServerMock(errStop)
+	g.Add("http", other)
+	g.Add("grpc", failing)
+
+	err := g.Run(context.Background())
+	for _, e := range []error{servers.ErrServe, errServe, servers.ErrStopGroup, errStop} {
+		assert.True(t, errors.Contains(err, e), fmt.Sprintf("expected %s got %s", e, err))
+	}
+	assert.True(t, other.isStopped(), "expected the other server to be shut down")
+}
+
+func TestNewCloser(t *testing.T) {
+	s := newServerMock(nil)
+	srv := servers.NewCloser(s.Serve, closerFunc(func() error {
+		return s.Shutdown(context.Background())
+	}))
+
+	g := servers.NewGroup(time.Second, testLog)
+	g.Add("closer", srv)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := g.Run(ctx)
+	assert.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	assert.True(t, s.isStopped(), "expected server to be closed")
+}
+
+type closerFunc func() error
+
+func (f closerFunc) Close() error {
+	return f()
+}
@@ -0,0 +1,158 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+// Package servers provides the lifecycle of the HTTP servers exposed by
+// Mainflux services.
+package servers
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/mainflux/mainflux"
+	"github.com/mainflux/mainflux/logger"
+	"github.com/mainflux/mainflux/pkg/errors"
+)
+
+const (
+	// DefaultStopWaitTime is how long the server waits for the in-flight
+	// requests on shutdown if StopWaitTime is not set.
+	DefaultStopWaitTime = 5 * time.Second
+
+	// DefaultReadTimeout, DefaultWriteTimeout and DefaultIdleTimeout are
+	// the server timeouts used if the respective timeout is not set.
+	DefaultReadTimeout  = 10 * time.Second
+	DefaultWriteTimeout = 10 * time.Second
+	DefaultIdleTimeout  = 60 * time.Second
+)
+
+var (
+	// ErrStopServer indicates that the in-flight requests did not complete
+	// before the stop wait time elapsed.
+	ErrStopServer = errors.New("failed to stop server gracefully")
+
+	// ErrLoadCerts indicates that the server certificate and key could not
+	// be loaded.
+	ErrLoadCerts = errors.New("failed to load server certificate and key")
+)
+
+// Config defines the options of the server.
+type Config struct {
+	// Host is the address the server listens on. If empty, the server
+	// listens on all the interfaces.
+	Host string
+
+	// Port is the port the server listens on.
+	Port string
+
+	// ServerCert and ServerKey are the paths of the PEM encoded certificate
+	// and key the server uses for TLS. Unless both are set, the server
+	// serves plain HTTP.
+	ServerCert string
+	ServerKey  string
+
+	// StopWaitTime is how long the server waits for the in-flight requests
+	// on shutdown. If zero, DefaultStopWaitTime is used.
+	StopWaitTime time.Duration
+
+	// ReadTimeout, WriteTimeout and IdleTimeout bound how long the server
+	// reads a request, writes a response and keeps an idle connection
+	// open, so that slow clients can't exhaust its connections. If zero,
+	// the respective default is used.
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	IdleTimeout  time.Duration
+
+	// Root enables the descriptor of the service named Service, served as
+	// JSON on GET "/" with its version and the links to the health and
+	// metrics endpoints. It's disabled by default so that the service
+	// doesn't disclose its version to unauthenticated clients.
+	Root    bool
+	Service string
+}
+
+// Start serves the handler until the context is done, and then shuts the
+// server down, waiting for the in-flight requests for up to StopWaitTime.
+// It returns the first error preventing the server from serving, or the
+// error of the shutdown.
+func Start(ctx context.Context, handler http.Handler, cfg Config, logger logger.Logger) error {
+	srv := newServer(handler, cfg)
+	useTLS := cfg.ServerCert != "" && cfg.ServerKey != ""
+	if useTLS {
+		// Load the pair up front so that a bad pair fails the start rather
+		// than every handshake.
+		cert, err := tls.LoadX509KeyPair(cfg.ServerCert, cfg.ServerKey)
+		if err != nil {
+			return errors.Wrap(ErrLoadCerts, err)
+		}
+		srv.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+
+	addr := net.JoinHostPort(cfg.Host, cfg.Port)
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		if useTLS {
+			logger.Info(fmt.Sprintf("HTTP server started using https on %s, cert %s key %s", l.Addr(), cfg.ServerCert, cfg.ServerKey))
+			errs <- srv.ServeTLS(l, "", "")
+			return
+		}
+		logger.Info(fmt.Sprintf("HTTP server started using http on %s", l.Addr()))
+		errs <- srv.Serve(l)
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	sctx, cancel := context.WithTimeout(context.Background(), orDefault(cfg.StopWaitTime, DefaultStopWaitTime))
+	defer cancel()
+	if err := srv.Shutdown(sctx); err != nil {
+		srv.Close()
+		return errors.Wrap(ErrStopServer, err)
+	}
+	logger.Info(fmt.Sprintf("HTTP server on %s stopped", l.Addr()))
+	return nil
+}
+
+func newServer(handler http.Handler, cfg Config) *http.Server {
+	return &http.Server{
+		Handler:      rootHandler(handler, cfg),
+		ReadTimeout:  orDefault(cfg.ReadTimeout, DefaultReadTimeout),
+		WriteTimeout: orDefault(cfg.WriteTimeout, DefaultWriteTimeout),
+		IdleTimeout:  orDefault(cfg.IdleTimeout, DefaultIdleTimeout),
+	}
+}
+
+// rootHandler serves the service descriptor on GET "/" if the root is
+// enabled, and the rest of the requests with the handler.
+func rootHandler(handler http.Handler, cfg Config) http.Handler {
+	if !cfg.Root {
+		return handler
+	}
+	desc := mainflux.Descriptor(cfg.Service)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" && r.Method == http.MethodGet {
+			desc(w, r)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+func orDefault(d, def time.Duration) time.Duration {
+	if d <= 0 {
+		return def
+	}
+	return d
+}
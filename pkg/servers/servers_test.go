@@ -0,0 +1,331 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package servers_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mainflux/mainflux"
+	log "github.com/mainflux/mainflux/logger"
+	"github.com/mainflux/mainflux/pkg/errors"
+	"github.com/mainflux/mainflux/pkg/servers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testLog, _ = log.New(os.Stdout, log.Error.String())
+
+func freePort(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	defer l.Close()
+	_, port, err := net.SplitHostPort(l.Addr().String())
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	return port
+}
+
+// start serves the handler until the returned cancel function is called,
+// and reports the result of Start on the returned channel.
+func start(t *testing.T, h http.Handler, cfg servers.Config) (string, context.CancelFunc, <-chan error) {
+	cfg.Host = "127.0.0.1"
+	cfg.Port = freePort(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() { errs <- servers.Start(ctx, h, cfg, testLog) }()
+
+	url := fmt.Sprintf("http://%s", net.JoinHostPort(cfg.Host, cfg.Port))
+	require.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", net.JoinHostPort(cfg.Host, cfg.Port))
+		if err != nil {
+			return false
+		}
+		conn.Close()
+		return true
+	}, time.Second, 5*time.Millisecond, "expected server to start")
+	return url, cancel, errs
+}
+
+func TestStart(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "pong")
+	})
+	url, cancel, errs := start(t, h, servers.Config{})
+
+	resp, err := http.Get(url)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	assert.Equal(t, "pong", string(body), fmt.Sprintf("expected pong got %s", body))
+
+	cancel()
+	select {
+	case err := <-errs:
+		assert.Nil(t, err, fmt.Sprintf("expected graceful shutdown got %s", err))
+	case <-time.After(time.Second):
+		t.Fatal("expected the server to stop")
+	}
+
+	_, err = http.Get(url)
+	assert.NotNil(t, err, "expected stopped server to refuse requests")
+}
+
+func TestStartShutdown(t *testing.T) {
+	cases := []struct {
+		desc  string
+		delay time.Duration
+		wait  time.Duration
+		err   error
+	}{
+		{
+			desc:  "stop server waiting for in-flight request",
+			delay: 50 * time.Millisecond,
+			wait:  time.Second,
+			err:   nil,
+		},
+		{
+			desc:  "stop server with in-flight request exceeding stop wait time",
+			delay: time.Second,
+			wait:  50 * time.Millisecond,
+			err:   servers.ErrStopServer,
+		},
+	}
+
+	for _, tc := range cases {
+		started := make(chan struct{})
+		h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			time.Sleep(tc.delay)
+			fmt.Fprint(w, "done")
+		})
+		url, cancel, errs := start(t, h, servers.Config{StopWaitTime: tc.wait})
+
+		reqErrs := make(chan error, 1)
+		go func() {
+			resp, err := http.Get(url)
+			if err == nil {
+				resp.Body.Close()
+			}
+			reqErrs <- err
+		}()
+		<-started
+		cancel()
+
+		select {
+		case err := <-errs:
+			assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s", tc.desc, tc.err, err))
+		case <-time.After(2 * time.Second):
+			t.Fatalf("%s: expected the server to stop", tc.desc)
+		}
+		err := <-reqErrs
+		if tc.err == nil {
+			assert.Nil(t, err, fmt.Sprintf("%s: expected in-flight request to complete got %s", tc.desc, err))
+		}
+	}
+}
+
+func TestStartBindError(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	defer l.Close()
+	host, port, err := net.SplitHostPort(l.Addr().String())
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+
+	err = servers.Start(context.Background(), http.NotFoundHandler(), servers.Config{Host: host, Port: port}, testLog)
+	assert.NotNil(t, err, "expected bind error")
+}
+
+// newSelfSigned writes a self-signed certificate for 127.0.0.1 and its key
+// to the directory, and returns their paths.
+func newSelfSigned(t *testing.T, dir string) (string, string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+
+	write := func(name, typ string, data []byte) string {
+		path := filepath.Join(dir, name)
+		err := ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: data}), 0600)
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+		return path
+	}
+	return write("server.crt", "CERTIFICATE", der), write("server.key", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(key))
+}
+
+func TestStartTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "servers-certs")
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	defer os.RemoveAll(dir)
+	cert, key := newSelfSigned(t, dir)
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.TLS != nil)
+	})
+	url, cancel, errs := start(t, h, servers.Config{ServerCert: cert, ServerKey: key})
+	defer cancel()
+
+	data, err := ioutil.ReadFile(cert)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(data)
+	c := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+
+	resp, err := c.Get("https" + url[len("http"):])
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	assert.Equal(t, "true", string(body), fmt.Sprintf("expected request served over TLS got %s", body))
+
+	cancel()
+	err = <-errs
+	assert.Nil(t, err, fmt.Sprintf("expected graceful shutdown got %s", err))
+}
+
+func TestStartInvalidCerts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "servers-certs")
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	defer os.RemoveAll(dir)
+	cert, key := newSelfSigned(t, dir)
+
+	cases := []struct {
+		desc string
+		cert string
+		key  string
+	}{
+		{
+			desc: "start server with missing certificate",
+			cert: filepath.Join(dir, "missing.crt"),
+			key:  key,
+		},
+		{
+			desc: "start server with certificate as key",
+			cert: cert,
+			key:  cert,
+		},
+	}
+
+	for _, tc := range cases {
+		cfg := servers.Config{Host: "127.0.0.1", Port: freePort(t), ServerCert: tc.cert, ServerKey: tc.key}
+		err := servers.Start(context.Background(), http.NotFoundHandler(), cfg, testLog)
+		assert.True(t, errors.Contains(err, servers.ErrLoadCerts), fmt.Sprintf("%s: expected %s got %s", tc.desc, servers.ErrLoadCerts, err))
+	}
+}
+
+func TestStartReadTimeout(t *testing.T) {
+	url, cancel, errs := start(t, http.NotFoundHandler(), servers.Config{ReadTimeout: 50 * time.Millisecond})
+	defer func() {
+		cancel()
+		<-errs
+	}()
+
+	// Send an incomplete request, the way slowloris clients do, and expect
+	// the server to close the connection once the read timeout elapses.
+	conn, err := net.Dial("tcp", url[len("http://"):])
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	defer conn.Close()
+	_, err = conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n"))
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = ioutil.ReadAll(conn)
+	nerr, ok := err.(net.Error)
+	assert.False(t, ok && nerr.Timeout(), "expected the server to close the slow connection")
+}
+
+func TestStartRoot(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "pong")
+	})
+
+	cases := []struct {
+		desc   string
+		cfg    servers.Config
+		method string
+		path   string
+		root   bool
+	}{
+		{
+			desc:   "get root with root enabled",
+			cfg:    servers.Config{Root: true, Service: "test"},
+			method: http.MethodGet,
+			path:   "/",
+			root:   true,
+		},
+		{
+			desc:   "get root with root disabled",
+			cfg:    servers.Config{Service: "test"},
+			method: http.MethodGet,
+			path:   "/",
+			root:   false,
+		},
+		{
+			desc:   "get other path with root enabled",
+			cfg:    servers.Config{Root: true, Service: "test"},
+			method: http.MethodGet,
+			path:   "/health",
+			root:   false,
+		},
+		{
+			desc:   "post root with root enabled",
+			cfg:    servers.Config{Root: true, Service: "test"},
+			method: http.MethodPost,
+			path:   "/",
+			root:   false,
+		},
+	}
+
+	for _, tc := range cases {
+		url, cancel, errs := start(t, h, tc.cfg)
+		req, err := http.NewRequest(tc.method, url+tc.path, nil)
+		require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", tc.desc, err))
+		resp, err := http.DefaultClient.Do(req)
+		require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", tc.desc, err))
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", tc.desc, err))
+		cancel()
+		<-errs
+
+		if !tc.root {
+			assert.Equal(t, "pong", string(body), fmt.Sprintf("%s: expected pong got %s", tc.desc, body))
+			continue
+		}
+		var desc mainflux.ServiceDescriptor
+		err = json.Unmarshal(body, &desc)
+		require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", tc.desc, err))
+		assert.Equal(t, "application/json", resp.Header.Get("Content-Type"), fmt.Sprintf("%s: expected JSON content type got %s", tc.desc, resp.Header.Get("Content-Type")))
+		assert.Equal(t, tc.cfg.Service, desc.Service, fmt.Sprintf("%s: expected service %s got %s", tc.desc, tc.cfg.Service, desc.Service))
+		assert.NotEmpty(t, desc.Version, fmt.Sprintf("%s: expected version", tc.desc))
+		links := map[string]string{"health": "/health", "metrics": "/metrics"}
+		assert.Equal(t, links, desc.Links, fmt.Sprintf("%s: expected links %v got %v", tc.desc, links, desc.Links))
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package servers
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewServerTimeouts(t *testing.T) {
+	cases := []struct {
+		desc  string
+		cfg   Config
+		read  time.Duration
+		write time.Duration
+		idle  time.Duration
+	}{
+		{
+			desc:  "create server with configured timeouts",
+			cfg:   Config{ReadTimeout: time.Second, WriteTimeout: 2 * time.Second, IdleTimeout: 3 * time.Second},
+			read:  time.Second,
+			write: 2 * time.Second,
+			idle:  3 * time.Second,
+		},
+		{
+			desc:  "create server with default timeouts",
+			cfg:   Config{},
+			read:  DefaultReadTimeout,
+			write: DefaultWriteTimeout,
+			idle:  DefaultIdleTimeout,
+		},
+		{
+			desc:  "create server with some timeouts configured",
+			cfg:   Config{WriteTimeout: time.Minute},
+			read:  DefaultReadTimeout,
+			write: time.Minute,
+			idle:  DefaultIdleTimeout,
+		},
+	}
+
+	for _, tc := range cases {
+		srv := newServer(http.NotFoundHandler(), tc.cfg)
+		assert.Equal(t, tc.read, srv.ReadTimeout, fmt.Sprintf("%s: expected read timeout %s got %s", tc.desc, tc.read, srv.ReadTimeout))
+		assert.Equal(t, tc.write, srv.WriteTimeout, fmt.Sprintf("%s: expected write timeout %s got %s", tc.desc, tc.write, srv.WriteTimeout))
+		assert.Equal(t, tc.idle, srv.IdleTimeout, fmt.Sprintf("%s: expected idle timeout %s got %s", tc.desc, tc.idle, srv.IdleTimeout))
+	}
+}
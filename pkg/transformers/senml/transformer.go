@@ -17,9 +17,17 @@ const (
 	CBOR = "application/senml+cbor"
 )
 
+// relativeTime is the threshold below which SenML time values are
+// relative to the current time, as defined by RFC 8428 (section 4.5.3).
+const relativeTime = 1 << 28
+
 var (
-	errDecode    = errors.New("failed to decode senml")
-	errNormalize = errors.New("failed to normalize senml")
+	// ErrDecode indicates that the payload is not valid SenML.
+	ErrDecode = errors.New("failed to decode senml")
+
+	// ErrNormalize indicates that the decoded SenML records can't be
+	// resolved, e.g. because a record has no name.
+	ErrNormalize = errors.New("failed to normalize senml")
 )
 
 var formats = map[string]senml.Format{
@@ -46,23 +54,19 @@ func New(contentFormat string) transformers.Transformer {
 func (t transformer) Transform(msg messaging.Message) (interface{}, error) {
 	raw, err := senml.Decode(msg.Payload, t.format)
 	if err != nil {
-		return nil, errors.Wrap(errDecode, err)
+		return nil, errors.Wrap(ErrDecode, err)
 	}
 
 	normalized, err := senml.Normalize(raw)
 	if err != nil {
-		return nil, errors.Wrap(errNormalize, err)
+		return nil, errors.Wrap(ErrNormalize, err)
 	}
 
+	// Convert the Unix timestamp in nanoseconds to float64
+	created := float64(msg.Created) / float64(1e9)
+
 	msgs := make([]Message, len(normalized.Records))
 	for i, v := range normalized.Records {
-		// Use reception timestamp if SenML messsage Time is missing
-		t := v.Time
-		if t == 0 {
-			// Convert the Unix timestamp in nanoseconds to float64
-			t = float64(msg.Created) / float64(1e9)
-		}
-
 		msgs[i] = Message{
 			Channel:     msg.Channel,
 			Subtopic:    msg.Subtopic,
@@ -70,7 +74,7 @@ func (t transformer) Transform(msg messaging.Message) (interface{}, error) {
 			Protocol:    msg.Protocol,
 			Name:        v.Name,
 			Unit:        v.Unit,
-			Time:        t,
+			Time:        resolveTime(v.Time, created),
 			UpdateTime:  v.UpdateTime,
 			Value:       v.Value,
 			BoolValue:   v.BoolValue,
@@ -82,3 +86,18 @@ func (t transformer) Transform(msg messaging.Message) (interface{}, error) {
 
 	return msgs, nil
 }
+
+// resolveTime converts the resolved SenML time (base time plus record time)
+// into an absolute Unix time in seconds. Missing time is replaced with the
+// message reception time, and time values lower than 2^28 are interpreted
+// as relative to the reception time.
+func resolveTime(t, created float64) float64 {
+	switch {
+	case t == 0:
+		return created
+	case t < relativeTime:
+		return created + t
+	default:
+		return t
+	}
+}
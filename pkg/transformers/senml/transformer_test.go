@@ -151,3 +151,62 @@ func TestTransformCBOR(t *testing.T) {
 		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s expected %s, got %s", tc.desc, tc.err, err))
 	}
 }
+
+func TestTransformTime(t *testing.T) {
+	tr := senml.New(senml.JSON)
+	created := int64(1600000000 * 1e9)
+	msg := messaging.Message{
+		Channel:   "channel",
+		Publisher: "publisher",
+		Protocol:  "protocol",
+		Created:   created,
+	}
+
+	cases := []struct {
+		desc    string
+		payload string
+		times   []float64
+	}{
+		{
+			desc:    "transform absolute base time with offsets",
+			payload: `[{"bt":1550000000,"n":"a","v":1,"t":0},{"n":"b","v":2,"t":10},{"n":"c","v":3,"t":-5}]`,
+			times:   []float64{1549999995, 1550000000, 1550000010},
+		},
+		{
+			desc:    "transform absolute record times without base time",
+			payload: `[{"n":"a","v":1,"t":1550000000},{"n":"b","v":2,"t":1550000001}]`,
+			times:   []float64{1550000000, 1550000001},
+		},
+		{
+			desc:    "transform missing time",
+			payload: `[{"n":"a","v":1}]`,
+			times:   []float64{1600000000},
+		},
+		{
+			desc:    "transform relative base time with offsets",
+			payload: `[{"bt":-60,"n":"a","v":1,"t":0},{"n":"b","v":2,"t":30}]`,
+			times:   []float64{1599999940, 1599999970},
+		},
+		{
+			desc:    "transform relative time at the threshold boundary",
+			payload: `[{"n":"a","v":1,"t":268435455},{"n":"b","v":2,"t":268435456}]`,
+			times:   []float64{268435456, 1600000000 + 268435455},
+		},
+	}
+
+	for _, tc := range cases {
+		m := msg
+		m.Payload = []byte(tc.payload)
+		res, err := tr.Transform(m)
+		require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", tc.desc, err))
+
+		msgs, ok := res.([]senml.Message)
+		require.True(t, ok, fmt.Sprintf("%s: expected SenML messages", tc.desc))
+
+		var times []float64
+		for _, m := range msgs {
+			times = append(times, m.Time)
+		}
+		assert.ElementsMatch(t, tc.times, times, fmt.Sprintf("%s: expected %v got %v", tc.desc, tc.times, times))
+	}
+}
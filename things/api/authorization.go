@@ -0,0 +1,287 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package api
+
+import (
+	"context"
+
+	"github.com/mainflux/mainflux"
+	"github.com/mainflux/mainflux/internal/groups"
+	"github.com/mainflux/mainflux/pkg/errors"
+	"github.com/mainflux/mainflux/things"
+)
+
+const membershipsLimit = 100
+
+var _ things.Service = (*authorizationMiddleware)(nil)
+
+type authorizationMiddleware struct {
+	auth   mainflux.AuthServiceClient
+	groups groups.Repository
+	svc    things.Service
+}
+
+// AuthorizationMiddleware enforces that the caller owns at least one of
+// the groups the accessed thing or channel belongs to. Entities which
+// don't belong to any group are left to the ownership checks of the
+// core service.
+func AuthorizationMiddleware(svc things.Service, auth mainflux.AuthServiceClient, groups groups.Repository) things.Service {
+	return &authorizationMiddleware{
+		auth:   auth,
+		groups: groups,
+		svc:    svc,
+	}
+}
+
+func (am *authorizationMiddleware) CreateThings(ctx context.Context, token string, ths ...things.Thing) ([]things.Thing, error) {
+	return am.svc.CreateThings(ctx, token, ths...)
+}
+
+func (am *authorizationMiddleware) SaveBestEffort(ctx context.Context, token string, ths ...things.Thing) ([]things.Result, error) {
+	return am.svc.SaveBestEffort(ctx, token, ths...)
+}
+
+func (am *authorizationMiddleware) UpdateThing(ctx context.Context, token string, thing things.Thing) error {
+	if err := am.authorize(ctx, token, thing.ID); err != nil {
+		return err
+	}
+
+	return am.svc.UpdateThing(ctx, token, thing)
+}
+
+func (am *authorizationMiddleware) UpdateKey(ctx context.Context, token, id, key string) error {
+	if err := am.authorize(ctx, token, id); err != nil {
+		return err
+	}
+
+	return am.svc.UpdateKey(ctx, token, id, key)
+}
+
+func (am *authorizationMiddleware) ViewThing(ctx context.Context, token, id string) (things.Thing, error) {
+	if err := am.authorize(ctx, token, id); err != nil {
+		return things.Thing{}, err
+	}
+
+	return am.svc.ViewThing(ctx, token, id)
+}
+
+func (am *authorizationMiddleware) ListThings(ctx context.Context, token string, pm things.PageMetadata) (things.Page, error) {
+	return am.svc.ListThings(ctx, token, pm)
+}
+
+func (am *authorizationMiddleware) ListThingsByChannel(ctx context.Context, token, channel string, connected bool, pm things.PageMetadata) (things.Page, error) {
+	if err := am.authorize(ctx, token, channel); err != nil {
+		return things.Page{}, err
+	}
+
+	return am.svc.ListThingsByChannel(ctx, token, channel, connected, pm)
+}
+
+func (am *authorizationMiddleware) RemoveThing(ctx context.Context, token, id string) error {
+	if err := am.authorize(ctx, token, id); err != nil {
+		return err
+	}
+
+	return am.svc.RemoveThing(ctx, token, id)
+}
+
+func (am *authorizationMiddleware) CreateChannels(ctx context.Context, token string, channels ...things.Channel) ([]things.Channel, error) {
+	return am.svc.CreateChannels(ctx, token, channels...)
+}
+
+func (am *authorizationMiddleware) UpdateChannel(ctx context.Context, token string, channel things.Channel) error {
+	if err := am.authorize(ctx, token, channel.ID); err != nil {
+		return err
+	}
+
+	return am.svc.UpdateChannel(ctx, token, channel)
+}
+
+func (am *authorizationMiddleware) ViewChannel(ctx context.Context, token, id string) (things.Channel, error) {
+	if err := am.authorize(ctx, token, id); err != nil {
+		return things.Channel{}, err
+	}
+
+	return am.svc.ViewChannel(ctx, token, id)
+}
+
+func (am *authorizationMiddleware) ListChannels(ctx context.Context, token string, pm things.PageMetadata) (things.ChannelsPage, error) {
+	return am.svc.ListChannels(ctx, token, pm)
+}
+
+func (am *authorizationMiddleware) ListChannelsByThing(ctx context.Context, token, thing string, offset, limit uint64, connected bool) (things.ChannelsPage, error) {
+	if err := am.authorize(ctx, token, thing); err != nil {
+		return things.ChannelsPage{}, err
+	}
+
+	return am.svc.ListChannelsByThing(ctx, token, thing, offset, limit, connected)
+}
+
+func (am *authorizationMiddleware) ListConnectionEventsByThing(ctx context.Context, token, thing string, offset, limit uint64) (things.ConnectionEventsPage, error) {
+	if err := am.authorize(ctx, token, thing); err != nil {
+		return things.ConnectionEventsPage{}, err
+	}
+
+	return am.svc.ListConnectionEventsByThing(ctx, token, thing, offset, limit)
+}
+
+func (am *authorizationMiddleware) ListConnectionEventsByChannel(ctx context.Context, token, channel string, offset, limit uint64) (things.ConnectionEventsPage, error) {
+	if err := am.authorize(ctx, token, channel); err != nil {
+		return things.ConnectionEventsPage{}, err
+	}
+
+	return am.svc.ListConnectionEventsByChannel(ctx, token, channel, offset, limit)
+}
+
+func (am *authorizationMiddleware) RemoveChannel(ctx context.Context, token, id string) error {
+	if err := am.authorize(ctx, token, id); err != nil {
+		return err
+	}
+
+	return am.svc.RemoveChannel(ctx, token, id)
+}
+
+func (am *authorizationMiddleware) Connect(ctx context.Context, token string, chIDs, thIDs []string) error {
+	ids := append(append([]string{}, chIDs...), thIDs...)
+	if err := am.authorize(ctx, token, ids...); err != nil {
+		return err
+	}
+
+	return am.svc.Connect(ctx, token, chIDs, thIDs)
+}
+
+func (am *authorizationMiddleware) Disconnect(ctx context.Context, token, chanID, thingID string) error {
+	if err := am.authorize(ctx, token, chanID, thingID); err != nil {
+		return err
+	}
+
+	return am.svc.Disconnect(ctx, token, chanID, thingID)
+}
+
+func (am *authorizationMiddleware) CanAccessByKey(ctx context.Context, chanID, key string) (string, error) {
+	return am.svc.CanAccessByKey(ctx, chanID, key)
+}
+
+func (am *authorizationMiddleware) CanAccessByID(ctx context.Context, chanID, thingID string) error {
+	return am.svc.CanAccessByID(ctx, chanID, thingID)
+}
+
+func (am *authorizationMiddleware) Identify(ctx context.Context, key string) (string, error) {
+	return am.svc.Identify(ctx, key)
+}
+
+func (am *authorizationMiddleware) ConnectionsByKey(ctx context.Context, key string) ([]string, error) {
+	return am.svc.ConnectionsByKey(ctx, key)
+}
+
+func (am *authorizationMiddleware) RebuildConnectionCache(ctx context.Context, token string) (things.CacheReport, error) {
+	return am.svc.RebuildConnectionCache(ctx, token)
+}
+
+func (am *authorizationMiddleware) CountAll(ctx context.Context, token string) (uint64, uint64, uint64, error) {
+	return am.svc.CountAll(ctx, token)
+}
+
+func (am *authorizationMiddleware) ReconcileGroups(ctx context.Context, token, defaultGroupID string) (things.GroupReport, error) {
+	return am.svc.ReconcileGroups(ctx, token, defaultGroupID)
+}
+
+func (am *authorizationMiddleware) CreateGroup(ctx context.Context, token string, g groups.Group) (string, error) {
+	return am.svc.CreateGroup(ctx, token, g)
+}
+
+func (am *authorizationMiddleware) UpdateGroup(ctx context.Context, token string, g groups.Group) (groups.Group, error) {
+	return am.svc.UpdateGroup(ctx, token, g)
+}
+
+func (am *authorizationMiddleware) RemoveGroup(ctx context.Context, token string, id string) error {
+	return am.svc.RemoveGroup(ctx, token, id)
+}
+
+func (am *authorizationMiddleware) ViewGroup(ctx context.Context, token, id string) (groups.Group, error) {
+	return am.svc.ViewGroup(ctx, token, id)
+}
+
+func (am *authorizationMiddleware) ListGroups(ctx context.Context, token string, level uint64, gm groups.Metadata) (groups.GroupPage, error) {
+	return am.svc.ListGroups(ctx, token, level, gm)
+}
+
+func (am *authorizationMiddleware) ListParents(ctx context.Context, token, childID string, level uint64, gm groups.Metadata) (groups.GroupPage, error) {
+	return am.svc.ListParents(ctx, token, childID, level, gm)
+}
+
+func (am *authorizationMiddleware) ListChildren(ctx context.Context, token, parentID string, level uint64, gm groups.Metadata) (groups.GroupPage, error) {
+	return am.svc.ListChildren(ctx, token, parentID, level, gm)
+}
+
+func (am *authorizationMiddleware) ListMembers(ctx context.Context, token, groupID string, offset, limit uint64, gm groups.Metadata) (groups.MemberPage, error) {
+	return am.svc.ListMembers(ctx, token, groupID, offset, limit, gm)
+}
+
+func (am *authorizationMiddleware) RetrieveGroupContents(ctx context.Context, token, groupID string, pm things.PageMetadata) (things.GroupContents, error) {
+	return am.svc.RetrieveGroupContents(ctx, token, groupID, pm)
+}
+
+func (am *authorizationMiddleware) ListMemberships(ctx context.Context, token, memberID string, offset, limit uint64, gm groups.Metadata) (groups.GroupPage, error) {
+	return am.svc.ListMemberships(ctx, token, memberID, offset, limit, gm)
+}
+
+func (am *authorizationMiddleware) Assign(ctx context.Context, token, memberID, groupID string) error {
+	if err := am.authorize(ctx, token, memberID); err != nil {
+		return err
+	}
+
+	return am.svc.Assign(ctx, token, memberID, groupID)
+}
+
+func (am *authorizationMiddleware) Unassign(ctx context.Context, token, memberID, groupID string) error {
+	if err := am.authorize(ctx, token, memberID); err != nil {
+		return err
+	}
+
+	return am.svc.Unassign(ctx, token, memberID, groupID)
+}
+
+// authorize checks that the caller owns one of the groups of each of the
+// given entities.
+func (am *authorizationMiddleware) authorize(ctx context.Context, token string, ids ...string) error {
+	user, err := am.auth.Identify(ctx, &mainflux.Token{Value: token})
+	if err != nil {
+		return errors.Wrap(things.ErrUnauthorizedAccess, err)
+	}
+
+	for _, id := range ids {
+		allowed, err := am.ownsGroupOf(ctx, user.GetId(), id)
+		if err != nil {
+			return err
+		}
+		if !allowed {
+			return things.ErrAuthorization
+		}
+	}
+	return nil
+}
+
+func (am *authorizationMiddleware) ownsGroupOf(ctx context.Context, userID, memberID string) (bool, error) {
+	var offset uint64
+	for {
+		gp, err := am.groups.Memberships(ctx, memberID, offset, membershipsLimit, nil)
+		if err != nil {
+			return false, err
+		}
+		if gp.Total == 0 {
+			return true, nil
+		}
+		for _, g := range gp.Groups {
+			if g.OwnerID == userID {
+				return true, nil
+			}
+		}
+
+		offset += membershipsLimit
+		if len(gp.Groups) == 0 || offset >= gp.Total {
+			return false, nil
+		}
+	}
+}
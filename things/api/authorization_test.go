@@ -0,0 +1,199 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package api_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/mainflux/mainflux/internal/groups"
+	"github.com/mainflux/mainflux/pkg/errors"
+	"github.com/mainflux/mainflux/pkg/uuid"
+	"github.com/mainflux/mainflux/things"
+	"github.com/mainflux/mainflux/things/api"
+	"github.com/mainflux/mainflux/things/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	otherToken = "other-token"
+	otherEmail = "other@example.com"
+)
+
+func TestAuthorization(t *testing.T) {
+	auth := mocks.NewAuthService(map[string]string{token: email, otherToken: otherEmail})
+	conns := make(chan mocks.Connection)
+	thingsRepo := mocks.NewThingRepository(conns)
+	channelsRepo := mocks.NewChannelRepository(thingsRepo, conns)
+	groupsRepo := mocks.NewGroupRepository()
+	svc := things.New(auth, thingsRepo, channelsRepo, groupsRepo, mocks.NewChannelCache(), mocks.NewThingCache(), uuid.NewMock())
+	svc = api.AuthorizationMiddleware(svc, auth, groupsRepo)
+
+	ths, err := svc.CreateThings(context.Background(), token, things.Thing{Name: "own"}, things.Thing{Name: "foreign"}, things.Thing{Name: "free"})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	own, foreign, free := ths[0], ths[1], ths[2]
+	chs, err := svc.CreateChannels(context.Background(), token, things.Channel{Name: "own"}, things.Channel{Name: "foreign"})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	ownCh, foreignCh := chs[0], chs[1]
+
+	// The user owns the things, but one of them and one of the channels
+	// belong to the group of the other user.
+	ownGroup, err := groupsRepo.Save(context.Background(), groups.Group{ID: "own-group", OwnerID: email})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	otherGroup, err := groupsRepo.Save(context.Background(), groups.Group{ID: "other-group", OwnerID: otherEmail})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	for id, groupID := range map[string]string{own.ID: ownGroup.ID, ownCh.ID: ownGroup.ID, foreign.ID: otherGroup.ID, foreignCh.ID: otherGroup.ID} {
+		err := groupsRepo.Assign(context.Background(), id, groupID)
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	}
+
+	cases := []struct {
+		desc string
+		op   func() error
+		err  error
+	}{
+		{
+			desc: "view thing in owned group",
+			op: func() error {
+				_, err := svc.ViewThing(context.Background(), token, own.ID)
+				return err
+			},
+			err: nil,
+		},
+		{
+			desc: "view thing without group",
+			op: func() error {
+				_, err := svc.ViewThing(context.Background(), token, free.ID)
+				return err
+			},
+			err: nil,
+		},
+		{
+			desc: "view thing in group of other user",
+			op: func() error {
+				_, err := svc.ViewThing(context.Background(), token, foreign.ID)
+				return err
+			},
+			err: things.ErrAuthorization,
+		},
+		{
+			desc: "view thing by group owner not owning the thing",
+			op: func() error {
+				_, err := svc.ViewThing(context.Background(), otherToken, foreign.ID)
+				return err
+			},
+			err: things.ErrNotFound,
+		},
+		{
+			desc: "view thing with invalid token",
+			op: func() error {
+				_, err := svc.ViewThing(context.Background(), "invalid", own.ID)
+				return err
+			},
+			err: things.ErrUnauthorizedAccess,
+		},
+		{
+			desc: "update thing in group of other user",
+			op: func() error {
+				return svc.UpdateThing(context.Background(), token, foreign)
+			},
+			err: things.ErrAuthorization,
+		},
+		{
+			desc: "update key of thing in owned group",
+			op: func() error {
+				return svc.UpdateKey(context.Background(), token, own.ID, "new-key")
+			},
+			err: nil,
+		},
+		{
+			desc: "list channels by thing in group of other user",
+			op: func() error {
+				_, err := svc.ListChannelsByThing(context.Background(), token, foreign.ID, 0, 10, true)
+				return err
+			},
+			err: things.ErrAuthorization,
+		},
+		{
+			desc: "view channel in owned group",
+			op: func() error {
+				_, err := svc.ViewChannel(context.Background(), token, ownCh.ID)
+				return err
+			},
+			err: nil,
+		},
+		{
+			desc: "view channel in group of other user",
+			op: func() error {
+				_, err := svc.ViewChannel(context.Background(), token, foreignCh.ID)
+				return err
+			},
+			err: things.ErrAuthorization,
+		},
+		{
+			desc: "list things by channel in group of other user",
+			op: func() error {
+				_, err := svc.ListThingsByChannel(context.Background(), token, foreignCh.ID, true, things.PageMetadata{Offset: 0, Limit: 10})
+				return err
+			},
+			err: things.ErrAuthorization,
+		},
+		{
+			desc: "connect things in owned group and without group",
+			op: func() error {
+				return svc.Connect(context.Background(), token, []string{ownCh.ID}, []string{own.ID, free.ID})
+			},
+			err: nil,
+		},
+		{
+			desc: "connect thing in group of other user",
+			op: func() error {
+				return svc.Connect(context.Background(), token, []string{ownCh.ID}, []string{foreign.ID})
+			},
+			err: things.ErrAuthorization,
+		},
+		{
+			desc: "disconnect thing in owned group",
+			op: func() error {
+				return svc.Disconnect(context.Background(), token, ownCh.ID, own.ID)
+			},
+			err: nil,
+		},
+		{
+			desc: "assign thing in group of other user",
+			op: func() error {
+				return svc.Assign(context.Background(), token, foreign.ID, ownGroup.ID)
+			},
+			err: things.ErrAuthorization,
+		},
+		{
+			desc: "remove channel in group of other user",
+			op: func() error {
+				return svc.RemoveChannel(context.Background(), token, foreignCh.ID)
+			},
+			err: things.ErrAuthorization,
+		},
+		{
+			desc: "remove thing in group of other user",
+			op: func() error {
+				return svc.RemoveThing(context.Background(), token, foreign.ID)
+			},
+			err: things.ErrAuthorization,
+		},
+		{
+			desc: "remove thing in owned group",
+			op: func() error {
+				return svc.RemoveThing(context.Background(), token, own.ID)
+			},
+			err: nil,
+		},
+	}
+
+	for _, tc := range cases {
+		err := tc.op()
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s\n", tc.desc, tc.err, err))
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package api
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/go-kit/kit/metrics"
+	"github.com/mainflux/mainflux/things"
+)
+
+var _ things.ThingCache = (*cacheMetricsMiddleware)(nil)
+
+type cacheMetricsMiddleware struct {
+	counter metrics.Counter
+	ratio   metrics.Gauge
+	hits    uint64
+	misses  uint64
+	cache   things.ThingCache
+}
+
+// CacheMetricsMiddleware instruments thing cache by counting hits and misses
+// of the key lookups and tracking the resulting hit ratio.
+func CacheMetricsMiddleware(cache things.ThingCache, counter metrics.Counter, ratio metrics.Gauge) things.ThingCache {
+	return &cacheMetricsMiddleware{
+		counter: counter,
+		ratio:   ratio,
+		cache:   cache,
+	}
+}
+
+func (cm *cacheMetricsMiddleware) Save(ctx context.Context, key, id string) error {
+	return cm.cache.Save(ctx, key, id)
+}
+
+func (cm *cacheMetricsMiddleware) ID(ctx context.Context, key string) (string, error) {
+	id, err := cm.cache.ID(ctx, key)
+	if err != nil {
+		cm.record(0, 1)
+	} else {
+		cm.record(1, 0)
+	}
+
+	return id, err
+}
+
+func (cm *cacheMetricsMiddleware) IDs(ctx context.Context, keys []string) (map[string]string, error) {
+	ids, err := cm.cache.IDs(ctx, keys)
+	if err != nil {
+		cm.record(0, uint64(len(keys)))
+		return ids, err
+	}
+
+	cm.record(uint64(len(ids)), uint64(len(keys)-len(ids)))
+	return ids, nil
+}
+
+func (cm *cacheMetricsMiddleware) record(hits, misses uint64) {
+	if hits == 0 && misses == 0 {
+		return
+	}
+	if hits > 0 {
+		atomic.AddUint64(&cm.hits, hits)
+		cm.counter.With("result", "hit").Add(float64(hits))
+	}
+	if misses > 0 {
+		atomic.AddUint64(&cm.misses, misses)
+		cm.counter.With("result", "miss").Add(float64(misses))
+	}
+
+	h := atomic.LoadUint64(&cm.hits)
+	m := atomic.LoadUint64(&cm.misses)
+	cm.ratio.Set(float64(h) / float64(h+m))
+}
+
+func (cm *cacheMetricsMiddleware) Remove(ctx context.Context, id string) error {
+	return cm.cache.Remove(ctx, id)
+}
+
+func (cm *cacheMetricsMiddleware) RemoveKey(ctx context.Context, key string) error {
+	return cm.cache.RemoveKey(ctx, key)
+}
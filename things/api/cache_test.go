@@ -0,0 +1,128 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package api_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-kit/kit/metrics"
+	"github.com/mainflux/mainflux/pkg/uuid"
+	"github.com/mainflux/mainflux/things"
+	"github.com/mainflux/mainflux/things/api"
+	"github.com/mainflux/mainflux/things/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	token = "token"
+	email = "user@example.com"
+)
+
+type counterMock struct {
+	mu     *sync.Mutex
+	values map[string]float64
+	labels []string
+}
+
+func (c counterMock) With(labelValues ...string) metrics.Counter {
+	return counterMock{mu: c.mu, values: c.values, labels: labelValues}
+}
+
+func (c counterMock) Add(delta float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[strings.Join(c.labels, ",")] += delta
+}
+
+type gaugeMock struct {
+	value float64
+}
+
+func (g *gaugeMock) With(labelValues ...string) metrics.Gauge { return g }
+
+func (g *gaugeMock) Set(value float64) { g.value = value }
+
+func (g *gaugeMock) Add(delta float64) { g.value += delta }
+
+func TestCacheMetrics(t *testing.T) {
+	counter := counterMock{mu: &sync.Mutex{}, values: make(map[string]float64)}
+	ratio := &gaugeMock{}
+
+	auth := mocks.NewAuthService(map[string]string{token: email})
+	conns := make(chan mocks.Connection)
+	thingsRepo := mocks.NewThingRepository(conns)
+	channelsRepo := mocks.NewChannelRepository(thingsRepo, conns)
+	thingCache := api.CacheMetricsMiddleware(mocks.NewThingCache(), counter, ratio)
+	svc := things.New(auth, thingsRepo, channelsRepo, nil, mocks.NewChannelCache(), thingCache, uuid.NewMock())
+
+	ths, err := svc.CreateThings(context.Background(), token, things.Thing{Name: "a"}, things.Thing{Name: "b"})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	a, b := ths[0], ths[1]
+
+	cases := []struct {
+		desc   string
+		key    string
+		id     string
+		hits   float64
+		misses float64
+		ratio  float64
+	}{
+		{
+			desc:   "identify thing not yet cached",
+			key:    a.Key,
+			id:     a.ID,
+			hits:   0,
+			misses: 1,
+			ratio:  0,
+		},
+		{
+			desc:   "identify cached thing",
+			key:    a.Key,
+			id:     a.ID,
+			hits:   1,
+			misses: 1,
+			ratio:  0.5,
+		},
+		{
+			desc:   "identify other thing not yet cached",
+			key:    b.Key,
+			id:     b.ID,
+			hits:   1,
+			misses: 2,
+			ratio:  float64(1) / 3,
+		},
+		{
+			desc:   "identify other cached thing",
+			key:    b.Key,
+			id:     b.ID,
+			hits:   2,
+			misses: 2,
+			ratio:  0.5,
+		},
+		{
+			desc:   "identify non-existing thing",
+			key:    "non-existing",
+			id:     "",
+			hits:   2,
+			misses: 3,
+			ratio:  0.4,
+		},
+	}
+
+	for _, tc := range cases {
+		id, _ := svc.Identify(context.Background(), tc.key)
+		assert.Equal(t, tc.id, id, fmt.Sprintf("%s: expected %s got %s\n", tc.desc, tc.id, id))
+
+		hits := counter.values["result,hit"]
+		misses := counter.values["result,miss"]
+		assert.Equal(t, tc.hits, hits, fmt.Sprintf("%s: expected %v hits got %v\n", tc.desc, tc.hits, hits))
+		assert.Equal(t, tc.misses, misses, fmt.Sprintf("%s: expected %v misses got %v\n", tc.desc, tc.misses, misses))
+		assert.InDelta(t, tc.ratio, ratio.value, 1e-9, fmt.Sprintf("%s: expected ratio %v got %v\n", tc.desc, tc.ratio, ratio.value))
+	}
+}
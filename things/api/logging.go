@@ -29,7 +29,7 @@ func LoggingMiddleware(svc things.Service, logger log.Logger) things.Service {
 
 func (lm *loggingMiddleware) CreateThings(ctx context.Context, token string, ths ...things.Thing) (saved []things.Thing, err error) {
 	defer func(begin time.Time) {
-		message := fmt.Sprintf("Method create_things for token %s and things %s took %s to complete", token, saved, time.Since(begin))
+		message := fmt.Sprintf("Method create_things for token %s and things %v took %s to complete", token, saved, time.Since(begin))
 		if err != nil {
 			lm.logger.Warn(fmt.Sprintf("%s with error: %s.", message, err))
 			return
@@ -40,6 +40,25 @@ func (lm *loggingMiddleware) CreateThings(ctx context.Context, token string, ths
 	return lm.svc.CreateThings(ctx, token, ths...)
 }
 
+func (lm *loggingMiddleware) SaveBestEffort(ctx context.Context, token string, ths ...things.Thing) (res []things.Result, err error) {
+	defer func(begin time.Time) {
+		failed := 0
+		for _, r := range res {
+			if r.Err != nil {
+				failed++
+			}
+		}
+		message := fmt.Sprintf("Method save_best_effort for token %s saved %d of %d things and took %s to complete", token, len(res)-failed, len(ths), time.Since(begin))
+		if err != nil {
+			lm.logger.Warn(fmt.Sprintf("%s with error: %s.", message, err))
+			return
+		}
+		lm.logger.Info(fmt.Sprintf("%s without errors.", message))
+	}(time.Now())
+
+	return lm.svc.SaveBestEffort(ctx, token, ths...)
+}
+
 func (lm *loggingMiddleware) UpdateThing(ctx context.Context, token string, thing things.Thing) (err error) {
 	defer func(begin time.Time) {
 		message := fmt.Sprintf("Method update_thing for token %s and thing %s took %s to complete", token, thing.ID, time.Since(begin))
@@ -96,7 +115,7 @@ func (lm *loggingMiddleware) ListThings(ctx context.Context, token string, pm th
 	return lm.svc.ListThings(ctx, token, pm)
 }
 
-func (lm *loggingMiddleware) ListThingsByChannel(ctx context.Context, token, id string, offset, limit uint64, connected bool) (_ things.Page, err error) {
+func (lm *loggingMiddleware) ListThingsByChannel(ctx context.Context, token, id string, connected bool, pm things.PageMetadata) (_ things.Page, err error) {
 	defer func(begin time.Time) {
 		message := fmt.Sprintf("Method list_things_by_channel for channel %s took %s to complete", id, time.Since(begin))
 		if err != nil {
@@ -105,7 +124,7 @@ func (lm *loggingMiddleware) ListThingsByChannel(ctx context.Context, token, id
 		lm.logger.Info(fmt.Sprintf("%s without errors.", message))
 	}(time.Now())
 
-	return lm.svc.ListThingsByChannel(ctx, token, id, offset, limit, connected)
+	return lm.svc.ListThingsByChannel(ctx, token, id, connected, pm)
 }
 
 func (lm *loggingMiddleware) RemoveThing(ctx context.Context, token, id string) (err error) {
@@ -189,6 +208,32 @@ func (lm *loggingMiddleware) ListChannelsByThing(ctx context.Context, token, id
 	return lm.svc.ListChannelsByThing(ctx, token, id, offset, limit, connected)
 }
 
+func (lm *loggingMiddleware) ListConnectionEventsByThing(ctx context.Context, token, id string, offset, limit uint64) (_ things.ConnectionEventsPage, err error) {
+	defer func(begin time.Time) {
+		message := fmt.Sprintf("Method list_connection_events_by_thing for thing %s took %s to complete", id, time.Since(begin))
+		if err != nil {
+			lm.logger.Warn(fmt.Sprintf("%s with error: %s.", message, err))
+			return
+		}
+		lm.logger.Info(fmt.Sprintf("%s without errors.", message))
+	}(time.Now())
+
+	return lm.svc.ListConnectionEventsByThing(ctx, token, id, offset, limit)
+}
+
+func (lm *loggingMiddleware) ListConnectionEventsByChannel(ctx context.Context, token, id string, offset, limit uint64) (_ things.ConnectionEventsPage, err error) {
+	defer func(begin time.Time) {
+		message := fmt.Sprintf("Method list_connection_events_by_channel for channel %s took %s to complete", id, time.Since(begin))
+		if err != nil {
+			lm.logger.Warn(fmt.Sprintf("%s with error: %s.", message, err))
+			return
+		}
+		lm.logger.Info(fmt.Sprintf("%s without errors.", message))
+	}(time.Now())
+
+	return lm.svc.ListConnectionEventsByChannel(ctx, token, id, offset, limit)
+}
+
 func (lm *loggingMiddleware) RemoveChannel(ctx context.Context, token, id string) (err error) {
 	defer func(begin time.Time) {
 		message := fmt.Sprintf("Method remove_channel for token %s and channel %s took %s to complete", token, id, time.Since(begin))
@@ -253,6 +298,19 @@ func (lm *loggingMiddleware) CanAccessByID(ctx context.Context, chanID, thingID
 
 	return lm.svc.CanAccessByID(ctx, chanID, thingID)
 }
+func (lm *loggingMiddleware) ConnectionsByKey(ctx context.Context, key string) (chIDs []string, err error) {
+	defer func(begin time.Time) {
+		message := fmt.Sprintf("Method connections_by_key returning %d channels took %s to complete", len(chIDs), time.Since(begin))
+		if err != nil {
+			lm.logger.Warn(fmt.Sprintf("%s with error: %s.", message, err))
+			return
+		}
+		lm.logger.Info(fmt.Sprintf("%s without errors.", message))
+	}(time.Now())
+
+	return lm.svc.ConnectionsByKey(ctx, key)
+}
+
 func (lm *loggingMiddleware) Identify(ctx context.Context, key string) (id string, err error) {
 	defer func(begin time.Time) {
 		message := fmt.Sprintf("Method identify for token %s and thing %s took %s to complete", key, id, time.Since(begin))
@@ -266,6 +324,58 @@ func (lm *loggingMiddleware) Identify(ctx context.Context, key string) (id strin
 	return lm.svc.Identify(ctx, key)
 }
 
+func (lm *loggingMiddleware) RebuildConnectionCache(ctx context.Context, token string) (rep things.CacheReport, err error) {
+	defer func(begin time.Time) {
+		message := fmt.Sprintf("Method rebuild_connection_cache for token %s added %d and removed %d entries and took %s to complete", token, rep.Added, rep.Removed, time.Since(begin))
+		if err != nil {
+			lm.logger.Warn(fmt.Sprintf("%s with error: %s.", message, err))
+			return
+		}
+		lm.logger.Info(fmt.Sprintf("%s without errors.", message))
+	}(time.Now())
+
+	return lm.svc.RebuildConnectionCache(ctx, token)
+}
+
+func (lm *loggingMiddleware) CountAll(ctx context.Context, token string) (ths, chs, conns uint64, err error) {
+	defer func(begin time.Time) {
+		message := fmt.Sprintf("Method count_all for token %s counted %d things, %d channels and %d connections and took %s to complete", token, ths, chs, conns, time.Since(begin))
+		if err != nil {
+			lm.logger.Warn(fmt.Sprintf("%s with error: %s.", message, err))
+			return
+		}
+		lm.logger.Info(fmt.Sprintf("%s without errors.", message))
+	}(time.Now())
+
+	return lm.svc.CountAll(ctx, token)
+}
+
+func (lm *loggingMiddleware) ReconcileGroups(ctx context.Context, token, defaultGroupID string) (rep things.GroupReport, err error) {
+	defer func(begin time.Time) {
+		message := fmt.Sprintf("Method reconcile_groups for token %s and default group %s found %d orphaned and reassigned %d memberships and took %s to complete", token, defaultGroupID, len(rep.Orphaned), rep.Reassigned, time.Since(begin))
+		if err != nil {
+			lm.logger.Warn(fmt.Sprintf("%s with error: %s.", message, err))
+			return
+		}
+		lm.logger.Info(fmt.Sprintf("%s without errors.", message))
+	}(time.Now())
+
+	return lm.svc.ReconcileGroups(ctx, token, defaultGroupID)
+}
+
+func (lm *loggingMiddleware) RetrieveGroupContents(ctx context.Context, token, groupID string, pm things.PageMetadata) (gc things.GroupContents, err error) {
+	defer func(begin time.Time) {
+		message := fmt.Sprintf("Method retrieve_group_contents for token %s and group %s took %s to complete", token, groupID, time.Since(begin))
+		if err != nil {
+			lm.logger.Warn(fmt.Sprintf("%s with error: %s.", message, err))
+			return
+		}
+		lm.logger.Info(fmt.Sprintf("%s without errors.", message))
+	}(time.Now())
+
+	return lm.svc.RetrieveGroupContents(ctx, token, groupID, pm)
+}
+
 func (lm *loggingMiddleware) CreateGroup(ctx context.Context, token string, g groups.Group) (id string, err error) {
 	defer func(begin time.Time) {
 		message := fmt.Sprintf("Method create_group for token %s and name %s took %s to complete", token, g.Name, time.Since(begin))
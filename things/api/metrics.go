@@ -40,6 +40,15 @@ func (ms *metricsMiddleware) CreateThings(ctx context.Context, token string, ths
 	return ms.svc.CreateThings(ctx, token, ths...)
 }
 
+func (ms *metricsMiddleware) SaveBestEffort(ctx context.Context, token string, ths ...things.Thing) ([]things.Result, error) {
+	defer func(begin time.Time) {
+		ms.counter.With("method", "save_best_effort").Add(1)
+		ms.latency.With("method", "save_best_effort").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return ms.svc.SaveBestEffort(ctx, token, ths...)
+}
+
 func (ms *metricsMiddleware) UpdateThing(ctx context.Context, token string, thing things.Thing) error {
 	defer func(begin time.Time) {
 		ms.counter.With("method", "update_thing").Add(1)
@@ -76,13 +85,13 @@ func (ms *metricsMiddleware) ListThings(ctx context.Context, token string, pm th
 	return ms.svc.ListThings(ctx, token, pm)
 }
 
-func (ms *metricsMiddleware) ListThingsByChannel(ctx context.Context, token, id string, offset, limit uint64, connected bool) (things.Page, error) {
+func (ms *metricsMiddleware) ListThingsByChannel(ctx context.Context, token, id string, connected bool, pm things.PageMetadata) (things.Page, error) {
 	defer func(begin time.Time) {
 		ms.counter.With("method", "list_things_by_channel").Add(1)
 		ms.latency.With("method", "list_things_by_channel").Observe(time.Since(begin).Seconds())
 	}(time.Now())
 
-	return ms.svc.ListThingsByChannel(ctx, token, id, offset, limit, connected)
+	return ms.svc.ListThingsByChannel(ctx, token, id, connected, pm)
 }
 
 func (ms *metricsMiddleware) RemoveThing(ctx context.Context, token, id string) error {
@@ -139,6 +148,24 @@ func (ms *metricsMiddleware) ListChannelsByThing(ctx context.Context, token, id
 	return ms.svc.ListChannelsByThing(ctx, token, id, offset, limit, connected)
 }
 
+func (ms *metricsMiddleware) ListConnectionEventsByThing(ctx context.Context, token, id string, offset, limit uint64) (things.ConnectionEventsPage, error) {
+	defer func(begin time.Time) {
+		ms.counter.With("method", "list_connection_events_by_thing").Add(1)
+		ms.latency.With("method", "list_connection_events_by_thing").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return ms.svc.ListConnectionEventsByThing(ctx, token, id, offset, limit)
+}
+
+func (ms *metricsMiddleware) ListConnectionEventsByChannel(ctx context.Context, token, id string, offset, limit uint64) (things.ConnectionEventsPage, error) {
+	defer func(begin time.Time) {
+		ms.counter.With("method", "list_connection_events_by_channel").Add(1)
+		ms.latency.With("method", "list_connection_events_by_channel").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return ms.svc.ListConnectionEventsByChannel(ctx, token, id, offset, limit)
+}
+
 func (ms *metricsMiddleware) RemoveChannel(ctx context.Context, token, id string) error {
 	defer func(begin time.Time) {
 		ms.counter.With("method", "remove_channel").Add(1)
@@ -184,6 +211,15 @@ func (ms *metricsMiddleware) CanAccessByID(ctx context.Context, chanID, thingID
 	return ms.svc.CanAccessByID(ctx, chanID, thingID)
 }
 
+func (ms *metricsMiddleware) ConnectionsByKey(ctx context.Context, key string) ([]string, error) {
+	defer func(begin time.Time) {
+		ms.counter.With("method", "connections_by_key").Add(1)
+		ms.latency.With("method", "connections_by_key").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return ms.svc.ConnectionsByKey(ctx, key)
+}
+
 func (ms *metricsMiddleware) Identify(ctx context.Context, key string) (string, error) {
 	defer func(begin time.Time) {
 		ms.counter.With("method", "identify").Add(1)
@@ -193,6 +229,42 @@ func (ms *metricsMiddleware) Identify(ctx context.Context, key string) (string,
 	return ms.svc.Identify(ctx, key)
 }
 
+func (ms *metricsMiddleware) RebuildConnectionCache(ctx context.Context, token string) (things.CacheReport, error) {
+	defer func(begin time.Time) {
+		ms.counter.With("method", "rebuild_connection_cache").Add(1)
+		ms.latency.With("method", "rebuild_connection_cache").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return ms.svc.RebuildConnectionCache(ctx, token)
+}
+
+func (ms *metricsMiddleware) CountAll(ctx context.Context, token string) (uint64, uint64, uint64, error) {
+	defer func(begin time.Time) {
+		ms.counter.With("method", "count_all").Add(1)
+		ms.latency.With("method", "count_all").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return ms.svc.CountAll(ctx, token)
+}
+
+func (ms *metricsMiddleware) ReconcileGroups(ctx context.Context, token, defaultGroupID string) (things.GroupReport, error) {
+	defer func(begin time.Time) {
+		ms.counter.With("method", "reconcile_groups").Add(1)
+		ms.latency.With("method", "reconcile_groups").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return ms.svc.ReconcileGroups(ctx, token, defaultGroupID)
+}
+
+func (ms *metricsMiddleware) RetrieveGroupContents(ctx context.Context, token, groupID string, pm things.PageMetadata) (things.GroupContents, error) {
+	defer func(begin time.Time) {
+		ms.counter.With("method", "retrieve_group_contents").Add(1)
+		ms.latency.With("method", "retrieve_group_contents").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return ms.svc.RetrieveGroupContents(ctx, token, groupID, pm)
+}
+
 func (ms *metricsMiddleware) CreateGroup(ctx context.Context, token string, g groups.Group) (id string, err error) {
 	defer func(begin time.Time) {
 		ms.counter.With("method", "create_group").Add(1)
@@ -174,6 +174,11 @@ func listThingsEndpoint(svc things.Service) endpoint.Endpoint {
 				Key:      thing.Key,
 				Metadata: thing.Metadata,
 			}
+			if req.pageMetadata.WithConnections {
+				connected, connections := thing.Connected, thing.Connections
+				view.Connected = &connected
+				view.Connections = &connections
+			}
 			res.Things = append(res.Things, view)
 		}
 
@@ -189,7 +194,7 @@ func listThingsByChannelEndpoint(svc things.Service) endpoint.Endpoint {
 			return nil, err
 		}
 
-		page, err := svc.ListThingsByChannel(ctx, req.token, req.id, req.offset, req.limit, req.connected)
+		page, err := svc.ListThingsByChannel(ctx, req.token, req.id, req.connected, things.PageMetadata{Offset: req.offset, Limit: req.limit, Order: req.order, Dir: req.dir})
 		if err != nil {
 			return nil, err
 		}
@@ -423,6 +428,62 @@ func listChannelsByThingEndpoint(svc things.Service) endpoint.Endpoint {
 	}
 }
 
+func listConnectionEventsByThingEndpoint(svc things.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(listConnectionEventsReq)
+
+		if err := req.validate(); err != nil {
+			return nil, err
+		}
+
+		page, err := svc.ListConnectionEventsByThing(ctx, req.token, req.id, req.offset, req.limit)
+		if err != nil {
+			return nil, err
+		}
+
+		return buildConnectionEventsResponse(page), nil
+	}
+}
+
+func listConnectionEventsByChannelEndpoint(svc things.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(listConnectionEventsReq)
+
+		if err := req.validate(); err != nil {
+			return nil, err
+		}
+
+		page, err := svc.ListConnectionEventsByChannel(ctx, req.token, req.id, req.offset, req.limit)
+		if err != nil {
+			return nil, err
+		}
+
+		return buildConnectionEventsResponse(page), nil
+	}
+}
+
+func buildConnectionEventsResponse(page things.ConnectionEventsPage) connectionEventsPageRes {
+	res := connectionEventsPageRes{
+		pageRes: pageRes{
+			Total:  page.Total,
+			Offset: page.Offset,
+			Limit:  page.Limit,
+		},
+		Events: []connectionEventRes{},
+	}
+	for _, e := range page.Events {
+		res.Events = append(res.Events, connectionEventRes{
+			ChannelID: e.ChannelID,
+			ThingID:   e.ThingID,
+			Actor:     e.Actor,
+			Type:      e.Type,
+			Timestamp: e.Timestamp,
+		})
+	}
+
+	return res
+}
+
 func removeChannelEndpoint(svc things.Service) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
 		req := request.(viewResourceReq)
@@ -489,3 +550,20 @@ func disconnectEndpoint(svc things.Service) endpoint.Endpoint {
 		return disconnectionRes{}, nil
 	}
 }
+
+func rebuildConnectionCacheEndpoint(svc things.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(adminReq)
+
+		if err := req.validate(); err != nil {
+			return nil, err
+		}
+
+		rep, err := svc.RebuildConnectionCache(ctx, req.token)
+		if err != nil {
+			return nil, err
+		}
+
+		return cacheReportRes{Added: rep.Added, Removed: rep.Removed}, nil
+	}
+}
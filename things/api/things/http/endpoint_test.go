@@ -807,6 +807,80 @@ func TestListThings(t *testing.T) {
 	}
 }
 
+func TestListThingsWithConnections(t *testing.T) {
+	svc := newService(map[string]string{token: email})
+	ts := newServer(svc)
+	defer ts.Close()
+
+	chs, err := svc.CreateChannels(context.Background(), token, channel)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	ths, err := svc.CreateThings(context.Background(), token, thing, thing)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	err = svc.Connect(context.Background(), token, []string{chs[0].ID}, []string{ths[0].ID})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+
+	// Wait for things and channels to connect.
+	time.Sleep(100 * time.Millisecond)
+
+	connected := map[string]bool{ths[0].ID: true, ths[1].ID: false}
+	thingURL := fmt.Sprintf("%s/things", ts.URL)
+	cases := []struct {
+		desc   string
+		status int
+		url    string
+		inline bool
+	}{
+		{
+			desc:   "get a list of things without connection status",
+			status: http.StatusOK,
+			url:    fmt.Sprintf("%s?offset=%d&limit=%d", thingURL, 0, 5),
+			inline: false,
+		},
+		{
+			desc:   "get a list of things with connection status",
+			status: http.StatusOK,
+			url:    fmt.Sprintf("%s?offset=%d&limit=%d&with_connections=true", thingURL, 0, 5),
+			inline: true,
+		},
+		{
+			desc:   "get a list of things with invalid connection status flag",
+			status: http.StatusBadRequest,
+			url:    fmt.Sprintf("%s?offset=%d&limit=%d&with_connections=invalid", thingURL, 0, 5),
+		},
+	}
+
+	for _, tc := range cases {
+		req := testRequest{
+			client: ts.Client(),
+			method: http.MethodGet,
+			url:    tc.url,
+			token:  token,
+		}
+		res, err := req.make()
+		assert.Nil(t, err, fmt.Sprintf("%s: unexpected error %s", tc.desc, err))
+		var data struct {
+			Things []struct {
+				ID          string  `json:"id"`
+				Connected   *bool   `json:"connected"`
+				Connections *uint64 `json:"connections"`
+			} `json:"things"`
+		}
+		json.NewDecoder(res.Body).Decode(&data)
+		assert.Equal(t, tc.status, res.StatusCode, fmt.Sprintf("%s: expected status code %d got %d", tc.desc, tc.status, res.StatusCode))
+		for _, th := range data.Things {
+			if !tc.inline {
+				assert.Nil(t, th.Connected, fmt.Sprintf("%s: unexpected connection status", tc.desc))
+				assert.Nil(t, th.Connections, fmt.Sprintf("%s: unexpected connections count", tc.desc))
+				continue
+			}
+			require.NotNil(t, th.Connected, fmt.Sprintf("%s: expected connection status", tc.desc))
+			require.NotNil(t, th.Connections, fmt.Sprintf("%s: expected connections count", tc.desc))
+			assert.Equal(t, connected[th.ID], *th.Connected, fmt.Sprintf("%s: expected connected %t got %t", tc.desc, connected[th.ID], *th.Connected))
+			assert.Equal(t, connected[th.ID], *th.Connections == 1, fmt.Sprintf("%s: unexpected connections count %d", tc.desc, *th.Connections))
+		}
+	}
+}
+
 func TestListThingsByChannel(t *testing.T) {
 	svc := newService(map[string]string{token: email})
 	ts := newServer(svc)
@@ -850,6 +924,13 @@ func TestListThingsByChannel(t *testing.T) {
 			url:    fmt.Sprintf("%s/%s/things?offset=%d&limit=%d", thingURL, ch.ID, 0, 5),
 			res:    data[0:5],
 		},
+		{
+			desc:   "get a list of things by channel sorted by connection time",
+			auth:   token,
+			status: http.StatusOK,
+			url:    fmt.Sprintf("%s/%s/things?offset=%d&limit=%d&order=connectedAt&dir=asc", thingURL, ch.ID, 0, 5),
+			res:    data[0:5],
+		},
 		{
 			desc:   "get a list of things by channel with invalid token",
 			auth:   wrongValue,
@@ -1745,6 +1826,115 @@ func TestListChannelsByThing(t *testing.T) {
 	}
 }
 
+func TestListConnectionEvents(t *testing.T) {
+	auth := mocks.NewAuthService(map[string]string{token: email})
+	conns := make(chan mocks.Connection)
+	thingsRepo := mocks.NewThingRepository(conns)
+	channelsRepo := mocks.NewChannelRepository(thingsRepo, conns)
+	cfg := things.Config{ConnectionEvents: mocks.NewConnectionEventRepository()}
+	svc := things.NewWithConfig(auth, thingsRepo, channelsRepo, nil, mocks.NewChannelCache(), mocks.NewThingCache(), uuid.NewMock(), cfg)
+	ts := newServer(svc)
+	defer ts.Close()
+
+	ths, err := svc.CreateThings(context.Background(), token, thing)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	th := ths[0]
+	chs, err := svc.CreateChannels(context.Background(), token, channel)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	ch := chs[0]
+
+	events := []connectionEventRes{}
+	for i := 0; i < 3; i++ {
+		err = svc.Connect(context.Background(), token, []string{ch.ID}, []string{th.ID})
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+		err = svc.Disconnect(context.Background(), token, ch.ID, th.ID)
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+		events = append(events,
+			connectionEventRes{ChannelID: ch.ID, ThingID: th.ID, Actor: email, Type: things.ConnectEvent},
+			connectionEventRes{ChannelID: ch.ID, ThingID: th.ID, Actor: email, Type: things.DisconnectEvent},
+		)
+	}
+
+	cases := []struct {
+		desc   string
+		auth   string
+		status int
+		url    string
+		res    []connectionEventRes
+		total  uint64
+	}{
+		{
+			desc:   "get connection events by thing",
+			auth:   token,
+			status: http.StatusOK,
+			url:    fmt.Sprintf("%s/things/%s/connection-events", ts.URL, th.ID),
+			res:    events,
+			total:  6,
+		},
+		{
+			desc:   "get connection events by channel with offset and limit",
+			auth:   token,
+			status: http.StatusOK,
+			url:    fmt.Sprintf("%s/channels/%s/connection-events?offset=%d&limit=%d", ts.URL, ch.ID, 1, 2),
+			res:    events[1:3],
+			total:  6,
+		},
+		{
+			desc:   "get connection events by thing with invalid token",
+			auth:   wrongValue,
+			status: http.StatusUnauthorized,
+			url:    fmt.Sprintf("%s/things/%s/connection-events", ts.URL, th.ID),
+			res:    nil,
+			total:  0,
+		},
+		{
+			desc:   "get connection events by thing with empty token",
+			auth:   "",
+			status: http.StatusUnauthorized,
+			url:    fmt.Sprintf("%s/things/%s/connection-events", ts.URL, th.ID),
+			res:    nil,
+			total:  0,
+		},
+		{
+			desc:   "get connection events by channel with limit greater than max",
+			auth:   token,
+			status: http.StatusBadRequest,
+			url:    fmt.Sprintf("%s/channels/%s/connection-events?limit=%d", ts.URL, ch.ID, 110),
+			res:    nil,
+			total:  0,
+		},
+		{
+			desc:   "get connection events by channel with invalid offset",
+			auth:   token,
+			status: http.StatusBadRequest,
+			url:    fmt.Sprintf("%s/channels/%s/connection-events?offset=e", ts.URL, ch.ID),
+			res:    nil,
+			total:  0,
+		},
+	}
+
+	for _, tc := range cases {
+		req := testRequest{
+			client: ts.Client(),
+			method: http.MethodGet,
+			url:    tc.url,
+			token:  tc.auth,
+		}
+		res, err := req.make()
+		assert.Nil(t, err, fmt.Sprintf("%s: unexpected error %s", tc.desc, err))
+		var body connectionEventsPageRes
+		json.NewDecoder(res.Body).Decode(&body)
+		assert.Equal(t, tc.status, res.StatusCode, fmt.Sprintf("%s: expected status code %d got %d", tc.desc, tc.status, res.StatusCode))
+		assert.Equal(t, tc.total, body.Total, fmt.Sprintf("%s: expected total %d got %d", tc.desc, tc.total, body.Total))
+		require.Equal(t, len(tc.res), len(body.Events), fmt.Sprintf("%s: expected %d events got %d", tc.desc, len(tc.res), len(body.Events)))
+		for i, e := range body.Events {
+			assert.False(t, e.Timestamp.IsZero(), fmt.Sprintf("%s: expected event timestamp", tc.desc))
+			e.Timestamp = time.Time{}
+			assert.Equal(t, tc.res[i], e, fmt.Sprintf("%s: expected event %v got %v", tc.desc, tc.res[i], e))
+		}
+	}
+}
+
 func TestRemoveChannel(t *testing.T) {
 	svc := newService(map[string]string{token: email})
 	ts := newServer(svc)
@@ -2191,6 +2381,86 @@ func TestDisconnnect(t *testing.T) {
 	}
 }
 
+func TestRebuildConnectionCache(t *testing.T) {
+	otherToken := "other_token"
+	auth := mocks.NewAuthService(map[string]string{
+		token:      email,
+		otherToken: "other_user@example.com",
+	})
+	conns := make(chan mocks.Connection)
+	thingsRepo := mocks.NewThingRepository(conns)
+	channelsRepo := mocks.NewChannelRepository(thingsRepo, conns)
+	chanCache := mocks.NewChannelCache()
+	svc := things.NewWithConfig(auth, thingsRepo, channelsRepo, nil, chanCache, mocks.NewThingCache(), uuid.NewMock(), things.Config{AdminEmail: email})
+	ts := newServer(svc)
+	defer ts.Close()
+
+	ths, err := svc.CreateThings(context.Background(), token, thing)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	chs, err := svc.CreateChannels(context.Background(), token, channel, channel)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	err = svc.Connect(context.Background(), token, []string{chs[0].ID}, []string{ths[0].ID})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+
+	// Leave a stale entry in the cache.
+	err = chanCache.Connect(context.Background(), chs[1].ID, ths[0].ID)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+
+	cases := []struct {
+		desc   string
+		auth   string
+		status int
+		res    string
+	}{
+		{
+			desc:   "rebuild connection cache with invalid token",
+			auth:   wrongValue,
+			status: http.StatusUnauthorized,
+			res:    unauthRes,
+		},
+		{
+			desc:   "rebuild connection cache with empty token",
+			auth:   "",
+			status: http.StatusUnauthorized,
+			res:    unauthRes,
+		},
+		{
+			desc:   "rebuild connection cache as non-admin user",
+			auth:   otherToken,
+			status: http.StatusForbidden,
+			res:    toJSON(errorRes{things.ErrAuthorization.Error()}),
+		},
+		{
+			desc:   "rebuild connection cache as admin",
+			auth:   token,
+			status: http.StatusOK,
+			res:    toJSON(cacheReportRes{Added: 1, Removed: 1}),
+		},
+		{
+			desc:   "rebuild consistent connection cache as admin",
+			auth:   token,
+			status: http.StatusOK,
+			res:    toJSON(cacheReportRes{}),
+		},
+	}
+
+	for _, tc := range cases {
+		req := testRequest{
+			client: ts.Client(),
+			method: http.MethodPost,
+			url:    fmt.Sprintf("%s/admin/connection-cache", ts.URL),
+			token:  tc.auth,
+		}
+		res, err := req.make()
+		assert.Nil(t, err, fmt.Sprintf("%s: unexpected error %s", tc.desc, err))
+		assert.Equal(t, tc.status, res.StatusCode, fmt.Sprintf("%s: expected status code %d got %d", tc.desc, tc.status, res.StatusCode))
+		body, err := ioutil.ReadAll(res.Body)
+		assert.Nil(t, err, fmt.Sprintf("%s: unexpected error %s", tc.desc, err))
+		data := strings.Trim(string(body), "\n")
+		assert.Equal(t, tc.res, data, fmt.Sprintf("%s: expected body %s got %s", tc.desc, tc.res, data))
+	}
+}
+
 type thingRes struct {
 	ID       string                 `json:"id"`
 	Name     string                 `json:"name,omitempty"`
@@ -2216,6 +2486,21 @@ type thingsPageRes struct {
 	Limit  uint64     `json:"limit"`
 }
 
+type connectionEventRes struct {
+	ChannelID string    `json:"channel_id"`
+	ThingID   string    `json:"thing_id"`
+	Actor     string    `json:"actor"`
+	Type      string    `json:"type"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+type connectionEventsPageRes struct {
+	Events []connectionEventRes `json:"events"`
+	Total  uint64               `json:"total"`
+	Offset uint64               `json:"offset"`
+	Limit  uint64               `json:"limit"`
+}
+
 type channelsPageRes struct {
 	Channels []channelRes `json:"channels"`
 	Total    uint64       `json:"total"`
@@ -2226,3 +2511,8 @@ type channelsPageRes struct {
 type errorRes struct {
 	Err string `json:"error"`
 }
+
+type cacheReportRes struct {
+	Added   uint64 `json:"added"`
+	Removed uint64 `json:"removed"`
+}
@@ -214,6 +214,8 @@ type listByConnectionReq struct {
 	id        string
 	offset    uint64
 	limit     uint64
+	order     string
+	dir       string
 	connected bool
 }
 
@@ -233,6 +235,29 @@ func (req listByConnectionReq) validate() error {
 	return nil
 }
 
+type listConnectionEventsReq struct {
+	token  string
+	id     string
+	offset uint64
+	limit  uint64
+}
+
+func (req listConnectionEventsReq) validate() error {
+	if req.token == "" {
+		return things.ErrUnauthorizedAccess
+	}
+
+	if req.id == "" {
+		return things.ErrMalformedEntity
+	}
+
+	if req.limit == 0 || req.limit > maxLimitSize {
+		return things.ErrMalformedEntity
+	}
+
+	return nil
+}
+
 type connectionReq struct {
 	token   string
 	chanID  string
@@ -279,3 +304,15 @@ func (req createConnectionsReq) validate() error {
 
 	return nil
 }
+
+type adminReq struct {
+	token string
+}
+
+func (req adminReq) validate() error {
+	if req.token == "" {
+		return things.ErrUnauthorizedAccess
+	}
+
+	return nil
+}
@@ -6,6 +6,7 @@ package http
 import (
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/mainflux/mainflux"
 )
@@ -18,6 +19,7 @@ var (
 	_ mainflux.Response = (*channelRes)(nil)
 	_ mainflux.Response = (*viewChannelRes)(nil)
 	_ mainflux.Response = (*channelsPageRes)(nil)
+	_ mainflux.Response = (*connectionEventsPageRes)(nil)
 	_ mainflux.Response = (*connectionRes)(nil)
 	_ mainflux.Response = (*disconnectionRes)(nil)
 )
@@ -94,6 +96,10 @@ type viewThingRes struct {
 	Name     string                 `json:"name,omitempty"`
 	Key      string                 `json:"key"`
 	Metadata map[string]interface{} `json:"metadata,omitempty"`
+	// Connected and Connections are set only if the connection status
+	// is requested.
+	Connected   *bool   `json:"connected,omitempty"`
+	Connections *uint64 `json:"connections,omitempty"`
 }
 
 func (res viewThingRes) Code() int {
@@ -213,6 +219,31 @@ func (res channelsPageRes) Empty() bool {
 	return false
 }
 
+type connectionEventRes struct {
+	ChannelID string    `json:"channel_id"`
+	ThingID   string    `json:"thing_id"`
+	Actor     string    `json:"actor"`
+	Type      string    `json:"type"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+type connectionEventsPageRes struct {
+	pageRes
+	Events []connectionEventRes `json:"events"`
+}
+
+func (res connectionEventsPageRes) Code() int {
+	return http.StatusOK
+}
+
+func (res connectionEventsPageRes) Headers() map[string]string {
+	return map[string]string{}
+}
+
+func (res connectionEventsPageRes) Empty() bool {
+	return false
+}
+
 type connectionRes struct{}
 
 func (res connectionRes) Code() int {
@@ -257,6 +288,23 @@ func (res disconnectionRes) Empty() bool {
 	return true
 }
 
+type cacheReportRes struct {
+	Added   uint64 `json:"added"`
+	Removed uint64 `json:"removed"`
+}
+
+func (res cacheReportRes) Code() int {
+	return http.StatusOK
+}
+
+func (res cacheReportRes) Headers() map[string]string {
+	return map[string]string{}
+}
+
+func (res cacheReportRes) Empty() bool {
+	return false
+}
+
 type pageRes struct {
 	Total  uint64 `json:"total"`
 	Offset uint64 `json:"offset"`
@@ -32,9 +32,12 @@ const (
 	dirKey      = "dir"
 	metadataKey = "metadata"
 	connKey     = "connected"
+	withConnKey = "with_connections"
 
-	defOffset = 0
-	defLimit  = 10
+	defOffset    = 0
+	defLimit     = 10
+	defConn      = true
+	defWithConns = false
 )
 
 var (
@@ -99,6 +102,13 @@ func MakeHandler(tracer opentracing.Tracer, svc things.Service) http.Handler {
 		opts...,
 	))
 
+	r.Get("/things/:id/connection-events", kithttp.NewServer(
+		kitot.TraceServer(tracer, "list_connection_events_by_thing")(listConnectionEventsByThingEndpoint(svc)),
+		decodeListConnectionEvents,
+		encodeResponse,
+		opts...,
+	))
+
 	r.Get("/things", kithttp.NewServer(
 		kitot.TraceServer(tracer, "list_things")(listThingsEndpoint(svc)),
 		decodeList,
@@ -148,6 +158,13 @@ func MakeHandler(tracer opentracing.Tracer, svc things.Service) http.Handler {
 		opts...,
 	))
 
+	r.Get("/channels/:id/connection-events", kithttp.NewServer(
+		kitot.TraceServer(tracer, "list_connection_events_by_channel")(listConnectionEventsByChannelEndpoint(svc)),
+		decodeListConnectionEvents,
+		encodeResponse,
+		opts...,
+	))
+
 	r.Get("/channels", kithttp.NewServer(
 		kitot.TraceServer(tracer, "list_channels")(listChannelsEndpoint(svc)),
 		decodeList,
@@ -253,6 +270,13 @@ func MakeHandler(tracer opentracing.Tracer, svc things.Service) http.Handler {
 		opts...,
 	))
 
+	r.Post("/admin/connection-cache", kithttp.NewServer(
+		kitot.TraceServer(tracer, "rebuild_connection_cache")(rebuildConnectionCacheEndpoint(svc)),
+		decodeAdmin,
+		encodeResponse,
+		opts...,
+	))
+
 	r.GetFunc("/version", mainflux.Version("things"))
 	r.Handle("/metrics", promhttp.Handler())
 
@@ -369,6 +393,12 @@ func decodeView(_ context.Context, r *http.Request) (interface{}, error) {
 	return req, nil
 }
 
+func decodeAdmin(_ context.Context, r *http.Request) (interface{}, error) {
+	req := adminReq{token: r.Header.Get("Authorization")}
+
+	return req, nil
+}
+
 func decodeList(_ context.Context, r *http.Request) (interface{}, error) {
 	o, err := readUintQuery(r, offsetKey, defOffset)
 	if err != nil {
@@ -400,15 +430,21 @@ func decodeList(_ context.Context, r *http.Request) (interface{}, error) {
 		return nil, err
 	}
 
+	wc, err := readBoolQuery(r, withConnKey, defWithConns)
+	if err != nil {
+		return nil, err
+	}
+
 	req := listResourcesReq{
 		token: r.Header.Get("Authorization"),
 		pageMetadata: things.PageMetadata{
-			Offset:   o,
-			Limit:    l,
-			Name:     n,
-			Order:    or,
-			Dir:      d,
-			Metadata: m,
+			Offset:          o,
+			Limit:           l,
+			Name:            n,
+			Order:           or,
+			Dir:             d,
+			Metadata:        m,
+			WithConnections: wc,
 		},
 	}
 
@@ -426,7 +462,17 @@ func decodeListByConnection(_ context.Context, r *http.Request) (interface{}, er
 		return nil, err
 	}
 
-	c, err := readBoolQuery(r, connKey)
+	c, err := readBoolQuery(r, connKey, defConn)
+	if err != nil {
+		return nil, err
+	}
+
+	or, err := readStringQuery(r, orderKey)
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := readStringQuery(r, dirKey)
 	if err != nil {
 		return nil, err
 	}
@@ -437,6 +483,29 @@ func decodeListByConnection(_ context.Context, r *http.Request) (interface{}, er
 		connected: c,
 		offset:    o,
 		limit:     l,
+		order:     or,
+		dir:       d,
+	}
+
+	return req, nil
+}
+
+func decodeListConnectionEvents(_ context.Context, r *http.Request) (interface{}, error) {
+	o, err := readUintQuery(r, offsetKey, defOffset)
+	if err != nil {
+		return nil, err
+	}
+
+	l, err := readUintQuery(r, limitKey, defLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	req := listConnectionEventsReq{
+		token:  r.Header.Get("Authorization"),
+		id:     bone.GetValue(r, "id"),
+		offset: o,
+		limit:  l,
 	}
 
 	return req, nil
@@ -491,17 +560,22 @@ func encodeError(_ context.Context, err error, w http.ResponseWriter) {
 		case errors.Contains(errorVal, things.ErrUnauthorizedAccess),
 			errors.Contains(errorVal, things.ErrEntityConnected):
 			w.WriteHeader(http.StatusUnauthorized)
+		case errors.Contains(errorVal, things.ErrAuthorization),
+			errors.Contains(errorVal, things.ErrGroupMismatch):
+			w.WriteHeader(http.StatusForbidden)
 
 		case errors.Contains(errorVal, errInvalidQueryParams):
 			w.WriteHeader(http.StatusBadRequest)
 		case errors.Contains(errorVal, errUnsupportedContentType):
 			w.WriteHeader(http.StatusUnsupportedMediaType)
 
-		case errors.Contains(errorVal, things.ErrMalformedEntity):
+		case errors.Contains(errorVal, things.ErrMalformedEntity),
+			errors.Contains(errorVal, things.ErrMetadataLimit):
 			w.WriteHeader(http.StatusBadRequest)
 		case errors.Contains(errorVal, things.ErrNotFound):
 			w.WriteHeader(http.StatusNotFound)
-		case errors.Contains(errorVal, things.ErrConflict):
+		case errors.Contains(errorVal, things.ErrConflict),
+			errors.Contains(errorVal, things.ErrChannelFull):
 			w.WriteHeader(http.StatusConflict)
 
 		case errors.Contains(errorVal, things.ErrScanMetadata),
@@ -588,19 +662,19 @@ func readMetadataQuery(r *http.Request, key string) (map[string]interface{}, err
 	return m, nil
 }
 
-func readBoolQuery(r *http.Request, key string) (bool, error) {
+func readBoolQuery(r *http.Request, key string, def bool) (bool, error) {
 	vals := bone.GetQuery(r, key)
 	if len(vals) > 1 {
-		return true, errInvalidQueryParams
+		return def, errInvalidQueryParams
 	}
 
 	if len(vals) == 0 {
-		return true, nil
+		return def, nil
 	}
 
 	b, err := strconv.ParseBool(vals[0])
 	if err != nil {
-		return true, errInvalidQueryParams
+		return def, errInvalidQueryParams
 	}
 
 	return b, nil
@@ -5,8 +5,35 @@ package things
 
 import (
 	"context"
+	"fmt"
+
+	"github.com/mainflux/mainflux/pkg/errors"
 )
 
+// Actions is the set of the actions a connection allows the thing.
+type Actions uint8
+
+const (
+	// ActionPublish allows the connected thing to publish to the channel.
+	ActionPublish Actions = 1 << iota
+
+	// ActionSubscribe allows the connected thing to subscribe to the
+	// channel.
+	ActionSubscribe
+)
+
+var actionNames = []struct {
+	action Actions
+	name   string
+}{
+	{ActionPublish, "publish"},
+	{ActionSubscribe, "subscribe"},
+}
+
+// ErrActionNotAllowed indicates that the connection of the thing to the
+// channel doesn't allow the required action.
+var ErrActionNotAllowed = errors.New("action not allowed by the connection")
+
 // Channel represents a Mainflux "communication group". This group contains the
 // things that can exchange messages between eachother.
 type Channel struct {
@@ -16,6 +43,63 @@ type Channel struct {
 	Metadata map[string]interface{}
 }
 
+// Connection represents a connection between a channel and a thing.
+type Connection struct {
+	ChannelID string
+	ThingID   string
+
+	// Actions are the actions the connection allows the thing. A
+	// connection without actions allows all of them.
+	Actions Actions
+}
+
+// ParseActions returns the set of the named actions, such as "publish"
+// and "subscribe".
+func ParseActions(names ...string) (Actions, error) {
+	var a Actions
+	for _, n := range names {
+		found := false
+		for _, an := range actionNames {
+			if an.name == n {
+				a |= an.action
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0, errors.Wrap(ErrMalformedEntity, fmt.Errorf("unknown connection action %q", n))
+		}
+	}
+	return a, nil
+}
+
+// Names returns the names of the actions of the set.
+func (a Actions) Names() []string {
+	var names []string
+	for _, an := range actionNames {
+		if a&an.action != 0 {
+			names = append(names, an.name)
+		}
+	}
+	return names
+}
+
+// Allows reports whether the set allows all the required actions. The
+// empty set allows all the actions.
+func (a Actions) Allows(required Actions) bool {
+	return a == 0 || a&required == required
+}
+
+// Union returns the set of all the provided actions, which is empty if
+// none is provided.
+func Union(actions ...Actions) Actions {
+	var u Actions
+	for _, a := range actions {
+		u |= a
+	}
+	return u
+}
+
 // ChannelsPage contains page related metadata as well as list of channels that
 // belong to this page.
 type ChannelsPage struct {
@@ -30,14 +114,21 @@ type ChannelRepository interface {
 	// error response.
 	Save(ctx context.Context, chs ...Channel) ([]Channel, error)
 
-	// Update performs an update to the existing channel. A non-nil error is
-	// returned to indicate operation failure.
+	// Update performs an update to the name and metadata of the existing
+	// channel, keeping its connections. The groups of the channel are
+	// changed by assigning it to groups rather than by updates. A non-nil
+	// error is returned to indicate operation failure.
 	Update(ctx context.Context, c Channel) error
 
 	// RetrieveByID retrieves the channel having the provided identifier, that is owned
 	// by the specified user.
 	RetrieveByID(ctx context.Context, owner, id string) (Channel, error)
 
+	// RetrieveByIDs retrieves the channels having the provided identifiers,
+	// in the order of the identifiers. The identifiers of non-existing
+	// channels are skipped.
+	RetrieveByIDs(ctx context.Context, ids []string) ([]Channel, error)
+
 	// RetrieveAll retrieves the subset of channels owned by the specified user.
 	RetrieveAll(ctx context.Context, owner string, pm PageMetadata) (ChannelsPage, error)
 
@@ -49,13 +140,23 @@ type ChannelRepository interface {
 	// by the specified user.
 	Remove(ctx context.Context, owner, id string) error
 
-	// Connect adds things to the channel's list of connected things.
-	Connect(ctx context.Context, owner string, chIDs, thIDs []string) error
+	// Connect adds things to the channel's list of connected things. If
+	// limit is positive and any of the channels would have more than limit
+	// things connected, no connection is added and ErrChannelFull is
+	// returned. The connections allow the things only the provided
+	// actions, or all of them if none is provided.
+	Connect(ctx context.Context, owner string, chIDs, thIDs []string, limit uint64, actions ...Actions) error
 
 	// Disconnect removes thing from the channel's list of connected
 	// things.
 	Disconnect(ctx context.Context, owner, chanID, thingID string) error
 
+	// DisconnectMany removes the things from the lists of connected things
+	// of all the channels, which is the reverse of Connect. If any of the
+	// things isn't connected to any of the channels, no connection is
+	// removed and ErrNotFound is returned.
+	DisconnectMany(ctx context.Context, owner string, chIDs, thIDs []string) error
+
 	// HasThing determines whether the thing with the provided access key, is
 	// "connected" to the specified channel. If that's the case, it returns
 	// thing's ID.
@@ -63,8 +164,21 @@ type ChannelRepository interface {
 
 	// HasThingByID determines whether the thing with the provided ID, is
 	// "connected" to the specified channel. If that's the case, then
-	// returned error will be nil.
-	HasThingByID(ctx context.Context, chanID, thingID string) error
+	// returned error will be nil. If actions are provided, the connection
+	// must allow all of them, or ErrActionNotAllowed is returned.
+	HasThingByID(ctx context.Context, chanID, thingID string, actions ...Actions) error
+
+	// RetrieveAllConnections retrieves all the channel-thing connections,
+	// together with the actions they allow.
+	RetrieveAllConnections(ctx context.Context) ([]Connection, error)
+
+	// RetrieveConnectionsByThing retrieves the identifiers of the channels
+	// the thing with the provided ID is connected to.
+	RetrieveConnectionsByThing(ctx context.Context, thingID string) ([]string, error)
+
+	// CountAll returns the number of channels and of channel-thing
+	// connections of all the users.
+	CountAll(ctx context.Context) (channels uint64, connections uint64, err error)
 }
 
 // ChannelCache contains channel-thing connection caching interface.
@@ -80,4 +194,19 @@ type ChannelCache interface {
 
 	// Removes channel from cache.
 	Remove(context.Context, string) error
+
+	// RetrieveAll returns all the cached channel-thing connections.
+	RetrieveAll(context.Context) ([]Connection, error)
+
+	// Connections returns the identifiers of the channels the thing is
+	// connected to, as saved by SaveConnections. Disconnecting the thing
+	// or removing any of the channels drops them from the cache, which
+	// results in ErrNotFound.
+	Connections(context.Context, string) ([]string, error)
+
+	// SaveConnections caches all the channels the thing is connected to.
+	SaveConnections(context.Context, string, []string) error
+
+	// RemoveConnections drops the cached channels of the thing.
+	RemoveConnections(context.Context, string) error
 }
@@ -0,0 +1,56 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package things_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/mainflux/mainflux/pkg/errors"
+	"github.com/mainflux/mainflux/things"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseActions(t *testing.T) {
+	cases := []struct {
+		desc    string
+		names   []string
+		actions things.Actions
+		err     error
+	}{
+		{
+			desc:    "parse publish action",
+			names:   []string{"publish"},
+			actions: things.ActionPublish,
+			err:     nil,
+		},
+		{
+			desc:    "parse publish and subscribe actions",
+			names:   []string{"subscribe", "publish"},
+			actions: things.ActionPublish | things.ActionSubscribe,
+			err:     nil,
+		},
+		{
+			desc:    "parse no actions",
+			names:   nil,
+			actions: 0,
+			err:     nil,
+		},
+		{
+			desc:    "parse unknown action",
+			names:   []string{"publish", "delete"},
+			actions: 0,
+			err:     things.ErrMalformedEntity,
+		},
+	}
+
+	for _, tc := range cases {
+		actions, err := things.ParseActions(tc.names...)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s", tc.desc, tc.err, err))
+		assert.Equal(t, tc.actions, actions, fmt.Sprintf("%s: expected actions %d got %d", tc.desc, tc.actions, actions))
+		if tc.err == nil {
+			assert.ElementsMatch(t, tc.names, actions.Names(), fmt.Sprintf("%s: expected names %v got %v", tc.desc, tc.names, actions.Names()))
+		}
+	}
+}
@@ -0,0 +1,44 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package things
+
+import (
+	"encoding/base64"
+	"encoding/json"
+
+	"github.com/mainflux/mainflux/pkg/errors"
+)
+
+// ErrInvalidCursor indicates a page cursor that wasn't returned as the
+// next cursor of a page.
+var ErrInvalidCursor = errors.New("invalid page cursor")
+
+type cursor struct {
+	Name string `json:"n"`
+	ID   string `json:"i"`
+}
+
+// EncodeCursor returns the cursor resuming a listing ordered by name and
+// ID after the entity with the given name and ID.
+func EncodeCursor(name, id string) string {
+	b, _ := json.Marshal(cursor{Name: name, ID: id})
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeCursor returns the name and ID of the entity encoded by the
+// cursor.
+func DecodeCursor(c string) (string, string, error) {
+	b, err := base64.RawURLEncoding.DecodeString(c)
+	if err != nil {
+		return "", "", errors.Wrap(ErrInvalidCursor, err)
+	}
+	var cur cursor
+	if err := json.Unmarshal(b, &cur); err != nil {
+		return "", "", errors.Wrap(ErrInvalidCursor, err)
+	}
+	if cur.ID == "" {
+		return "", "", ErrInvalidCursor
+	}
+	return cur.Name, cur.ID, nil
+}
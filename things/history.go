@@ -0,0 +1,53 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package things
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	// ConnectEvent is the type of the event recorded when a thing is
+	// connected to a channel.
+	ConnectEvent = "connect"
+
+	// DisconnectEvent is the type of the event recorded when a thing is
+	// disconnected from a channel.
+	DisconnectEvent = "disconnect"
+)
+
+// ConnectionEvent represents a single connect or disconnect of a thing
+// and a channel, performed by the actor at the given time.
+type ConnectionEvent struct {
+	ChannelID string
+	ThingID   string
+	Owner     string
+	Actor     string
+	Type      string
+	Timestamp time.Time
+}
+
+// ConnectionEventsPage contains page related metadata as well as list of
+// connection events that belong to this page.
+type ConnectionEventsPage struct {
+	PageMetadata
+	Events []ConnectionEvent
+}
+
+// ConnectionEventRepository specifies an append-only connection history
+// persistence API. The events outlive the things and channels they refer
+// to, so that the history of removed entities remains available.
+type ConnectionEventRepository interface {
+	// Save appends the events to the history.
+	Save(ctx context.Context, events ...ConnectionEvent) error
+
+	// RetrieveByThing retrieves the subset of events of the specified
+	// thing, owned by the specified user, in chronological order.
+	RetrieveByThing(ctx context.Context, owner, thingID string, offset, limit uint64) (ConnectionEventsPage, error)
+
+	// RetrieveByChannel retrieves the subset of events of the specified
+	// channel, owned by the specified user, in chronological order.
+	RetrieveByChannel(ctx context.Context, owner, chanID string, offset, limit uint64) (ConnectionEventsPage, error)
+}
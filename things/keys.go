@@ -0,0 +1,59 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package things
+
+import (
+	"context"
+	"time"
+)
+
+// KeySweeper removes the expired temporary keys of things.
+type KeySweeper struct {
+	things ThingRepository
+	cache  ThingCache
+	now    func() time.Time
+}
+
+// NewKeySweeper returns the sweeper of the temporary keys expired by the
+// time of the provided clock.
+func NewKeySweeper(things ThingRepository, cache ThingCache, now func() time.Time) *KeySweeper {
+	return &KeySweeper{
+		things: things,
+		cache:  cache,
+		now:    now,
+	}
+}
+
+// Sweep removes the expired keys from the repository and the cache, and
+// returns them.
+func (ks *KeySweeper) Sweep(ctx context.Context) ([]string, error) {
+	keys, err := ks.things.RemoveExpiredKeys(ctx, ks.now())
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range keys {
+		if err := ks.cache.RemoveKey(ctx, key); err != nil {
+			return keys, err
+		}
+	}
+	return keys, nil
+}
+
+// Run sweeps the expired keys on every tick of the interval until the
+// context is done. Sweep errors are passed to the handler, if any.
+func (ks *KeySweeper) Run(ctx context.Context, interval time.Duration, handle func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := ks.Sweep(ctx); err != nil && handle != nil {
+				handle(err)
+			}
+		}
+	}
+}
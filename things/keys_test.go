@@ -0,0 +1,81 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package things_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mainflux/mainflux/pkg/errors"
+	"github.com/mainflux/mainflux/things"
+	"github.com/mainflux/mainflux/things/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeySweeper(t *testing.T) {
+	now := time.Now()
+	clock := func() time.Time { return now }
+	repo := mocks.NewThingRepositoryWithClock(make(chan mocks.Connection), clock)
+	cache := mocks.NewThingCache()
+	sweeper := things.NewKeySweeper(repo, cache, clock)
+
+	ths, err := repo.Save(context.Background(), things.Thing{Owner: email, Key: "key"})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	err = cache.Save(context.Background(), "key", ths[0].ID)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	for key, ttl := range map[string]time.Duration{"short": time.Minute, "long": time.Hour} {
+		err := repo.SaveTemporaryKey(context.Background(), email, ths[0].ID, key, now.Add(ttl))
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+		err = cache.Save(context.Background(), key, ths[0].ID)
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	}
+
+	cases := []struct {
+		desc    string
+		advance time.Duration
+		removed []string
+	}{
+		{
+			desc:    "sweep keys before expiry",
+			removed: []string{},
+		},
+		{
+			desc:    "sweep keys after expiry of short-lived key",
+			advance: time.Minute,
+			removed: []string{"short"},
+		},
+		{
+			desc:    "sweep keys after expiry of all keys",
+			advance: time.Hour,
+			removed: []string{"long"},
+		},
+		{
+			desc:    "sweep keys after removal of expired keys",
+			removed: []string{},
+		},
+	}
+
+	for _, tc := range cases {
+		now = now.Add(tc.advance)
+		removed, err := sweeper.Sweep(context.Background())
+		require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", tc.desc, err))
+		assert.Equal(t, tc.removed, removed, fmt.Sprintf("%s: expected removed keys %v got %v", tc.desc, tc.removed, removed))
+		for _, key := range tc.removed {
+			_, err := repo.RetrieveByKey(context.Background(), key)
+			assert.True(t, errors.Contains(err, things.ErrNotFound), fmt.Sprintf("%s: expected %s got %s", tc.desc, things.ErrNotFound, err))
+			_, err = cache.ID(context.Background(), key)
+			assert.True(t, errors.Contains(err, things.ErrNotFound), fmt.Sprintf("%s: expected cached key to be removed got %s", tc.desc, err))
+		}
+	}
+
+	id, err := repo.RetrieveByKey(context.Background(), "key")
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	assert.Equal(t, ths[0].ID, id, fmt.Sprintf("expected primary key to identify %s got %s", ths[0].ID, id))
+	id, err = cache.ID(context.Background(), "key")
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	assert.Equal(t, ths[0].ID, id, fmt.Sprintf("expected cached primary key to identify %s got %s", ths[0].ID, id))
+}
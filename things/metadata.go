@@ -0,0 +1,74 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package things
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/mainflux/mainflux/pkg/errors"
+)
+
+// ErrMetadataLimit indicates metadata exceeding the hard metadata limits.
+var ErrMetadataLimit = errors.New("metadata exceeds the limit")
+
+// MetadataLimits limits the metadata of the created and updated things and
+// channels by their number of top-level keys and the size of their JSON
+// encoding in bytes. Zero limits are not enforced.
+type MetadataLimits struct {
+	// MaxKeys and MaxBytes are the hard limits. Metadata exceeding them is
+	// rejected with ErrMetadataLimit.
+	MaxKeys  int
+	MaxBytes int
+
+	// SoftKeys and SoftBytes are the soft limits. Metadata exceeding them
+	// is saved, but it's logged and counted, so that growing metadata can
+	// be observed before it hits the hard limits.
+	SoftKeys  int
+	SoftBytes int
+}
+
+// checkMetadata rejects the metadata exceeding the hard limits and reports
+// the metadata exceeding the soft limits. The entity is either "thing" or
+// "channel".
+func (ts *thingsService) checkMetadata(entity, id string, md map[string]interface{}) error {
+	lim := ts.cfg.MetadataLimits
+	if lim == (MetadataLimits{}) || len(md) == 0 {
+		return nil
+	}
+
+	keys := len(md)
+	if lim.MaxKeys > 0 && keys > lim.MaxKeys {
+		return errors.Wrap(ErrMetadataLimit, fmt.Errorf("%d keys of %s metadata exceed the limit of %d", keys, entity, lim.MaxKeys))
+	}
+
+	var size int
+	if lim.MaxBytes > 0 || lim.SoftBytes > 0 {
+		data, err := json.Marshal(md)
+		if err != nil {
+			return errors.Wrap(ErrMalformedEntity, err)
+		}
+		size = len(data)
+	}
+	if lim.MaxBytes > 0 && size > lim.MaxBytes {
+		return errors.Wrap(ErrMetadataLimit, fmt.Errorf("%d bytes of %s metadata exceed the limit of %d", size, entity, lim.MaxBytes))
+	}
+
+	if lim.SoftKeys > 0 && keys > lim.SoftKeys {
+		ts.warnMetadata(entity, "keys", fmt.Sprintf("Metadata of %s %s has %d keys, above the soft limit of %d", entity, id, keys, lim.SoftKeys))
+	}
+	if lim.SoftBytes > 0 && size > lim.SoftBytes {
+		ts.warnMetadata(entity, "bytes", fmt.Sprintf("Metadata of %s %s has %d bytes, above the soft limit of %d", entity, id, size, lim.SoftBytes))
+	}
+	return nil
+}
+
+func (ts *thingsService) warnMetadata(entity, limit, msg string) {
+	if ts.cfg.MetadataCounter != nil {
+		ts.cfg.MetadataCounter.With("entity", entity, "limit", limit).Add(1)
+	}
+	if ts.cfg.Logger != nil {
+		ts.cfg.Logger.Warn(msg)
+	}
+}
@@ -0,0 +1,192 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package things_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-kit/kit/metrics"
+	"github.com/mainflux/mainflux/pkg/errors"
+	"github.com/mainflux/mainflux/pkg/uuid"
+	"github.com/mainflux/mainflux/things"
+	"github.com/mainflux/mainflux/things/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// counterMock sums the counted values by label values.
+type counterMock struct {
+	mu     *sync.Mutex
+	values map[string]float64
+	labels []string
+}
+
+func newCounterMock() counterMock {
+	return counterMock{
+		mu:     &sync.Mutex{},
+		values: make(map[string]float64),
+	}
+}
+
+func (c counterMock) With(labelValues ...string) metrics.Counter {
+	return counterMock{
+		mu:     c.mu,
+		values: c.values,
+		labels: append(append([]string{}, c.labels...), labelValues...),
+	}
+}
+
+func (c counterMock) Add(delta float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[strings.Join(c.labels, ",")] += delta
+}
+
+func (c counterMock) value(labelValues ...string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[strings.Join(labelValues, ",")]
+}
+
+// loggerMock records the logged warnings.
+type loggerMock struct {
+	warns []string
+}
+
+func (l *loggerMock) Debug(msg string) {}
+func (l *loggerMock) Info(msg string)  {}
+func (l *loggerMock) Warn(msg string)  { l.warns = append(l.warns, msg) }
+func (l *loggerMock) Error(msg string) {}
+
+func newMetadataService(limits things.MetadataLimits, counter counterMock, logger *loggerMock) things.Service {
+	auth := mocks.NewAuthService(map[string]string{token: email})
+	conns := make(chan mocks.Connection)
+	thingsRepo := mocks.NewThingRepository(conns)
+	channelsRepo := mocks.NewChannelRepository(thingsRepo, conns)
+	cfg := things.Config{
+		MetadataLimits:  limits,
+		MetadataCounter: counter,
+		Logger:          logger,
+	}
+	return things.NewWithConfig(auth, thingsRepo, channelsRepo, nil, mocks.NewChannelCache(), mocks.NewThingCache(), uuid.NewMock(), cfg)
+}
+
+// metadata returns the metadata with n keys.
+func metadata(n int) map[string]interface{} {
+	md := make(map[string]interface{})
+	for i := 0; i < n; i++ {
+		md[fmt.Sprintf("key-%d", i)] = "value"
+	}
+	return md
+}
+
+func TestMetadataLimits(t *testing.T) {
+	limits := things.MetadataLimits{SoftKeys: 2, MaxKeys: 4, SoftBytes: 60, MaxBytes: 100}
+
+	cases := []struct {
+		desc     string
+		metadata map[string]interface{}
+		err      error
+		keys     float64
+		bytes    float64
+	}{
+		{
+			desc:     "save metadata below the soft limits",
+			metadata: metadata(2),
+			err:      nil,
+			keys:     0,
+			bytes:    0,
+		},
+		{
+			desc:     "save metadata between the soft and hard key limits",
+			metadata: metadata(3),
+			err:      nil,
+			keys:     1,
+			bytes:    0,
+		},
+		{
+			desc:     "save metadata between the soft and hard limits",
+			metadata: metadata(4),
+			err:      nil,
+			keys:     1,
+			bytes:    1,
+		},
+		{
+			desc:     "save metadata between the soft and hard size limits",
+			metadata: map[string]interface{}{"key": strings.Repeat("v", 60)},
+			err:      nil,
+			keys:     0,
+			bytes:    1,
+		},
+		{
+			desc:     "save metadata above the hard key limit",
+			metadata: metadata(5),
+			err:      things.ErrMetadataLimit,
+			keys:     0,
+			bytes:    0,
+		},
+		{
+			desc:     "save metadata above the hard size limit",
+			metadata: map[string]interface{}{"key": strings.Repeat("v", 100)},
+			err:      things.ErrMetadataLimit,
+			keys:     0,
+			bytes:    0,
+		},
+	}
+
+	for _, tc := range cases {
+		counter := newCounterMock()
+		logger := &loggerMock{}
+		svc := newMetadataService(limits, counter, logger)
+
+		ths, err := svc.CreateThings(context.Background(), token, things.Thing{Name: "thing", Metadata: tc.metadata})
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s\n", tc.desc, tc.err, err))
+		_, err = svc.CreateChannels(context.Background(), token, things.Channel{Name: "channel", Metadata: tc.metadata})
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s\n", tc.desc, tc.err, err))
+
+		for _, entity := range []string{"thing", "channel"} {
+			keys := counter.value("entity", entity, "limit", "keys")
+			assert.Equal(t, tc.keys, keys, fmt.Sprintf("%s: expected %v %s key warnings got %v\n", tc.desc, tc.keys, entity, keys))
+			bytes := counter.value("entity", entity, "limit", "bytes")
+			assert.Equal(t, tc.bytes, bytes, fmt.Sprintf("%s: expected %v %s size warnings got %v\n", tc.desc, tc.bytes, entity, bytes))
+		}
+		warns := int(2 * (tc.keys + tc.bytes))
+		assert.Equal(t, warns, len(logger.warns), fmt.Sprintf("%s: expected %d logged warnings got %d\n", tc.desc, warns, len(logger.warns)))
+
+		if tc.err != nil {
+			continue
+		}
+		th := ths[0]
+		th.Metadata = tc.metadata
+		err = svc.UpdateThing(context.Background(), token, th)
+		assert.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s\n", tc.desc, err))
+		keys := counter.value("entity", "thing", "limit", "keys")
+		assert.Equal(t, 2*tc.keys, keys, fmt.Sprintf("%s: expected %v thing key warnings after update got %v\n", tc.desc, 2*tc.keys, keys))
+	}
+}
+
+func TestMetadataLimitsBestEffort(t *testing.T) {
+	counter := newCounterMock()
+	logger := &loggerMock{}
+	svc := newMetadataService(things.MetadataLimits{SoftKeys: 1, MaxKeys: 2}, counter, logger)
+
+	res, err := svc.SaveBestEffort(context.Background(), token,
+		things.Thing{Name: "a", Metadata: metadata(1)},
+		things.Thing{Name: "b", Metadata: metadata(2)},
+		things.Thing{Name: "c", Metadata: metadata(3)},
+	)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+	expected := []error{nil, nil, things.ErrMetadataLimit}
+	for i, r := range res {
+		assert.True(t, errors.Contains(r.Err, expected[i]), fmt.Sprintf("expected %s got %s for thing %d\n", expected[i], r.Err, i))
+	}
+	keys := counter.value("entity", "thing", "limit", "keys")
+	assert.Equal(t, float64(1), keys, fmt.Sprintf("expected 1 key warning got %v\n", keys))
+	require.Equal(t, 1, len(logger.warns), fmt.Sprintf("expected 1 logged warning got %d\n", len(logger.warns)))
+	assert.Contains(t, logger.warns[0], res[1].Thing.ID, fmt.Sprintf("expected warning %q to hold the thing ID\n", logger.warns[0]))
+}
@@ -10,6 +10,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/mainflux/mainflux/things"
 )
@@ -17,9 +18,10 @@ import (
 // Connection represents connection between channel and thing that is used for
 // testing purposes.
 type Connection struct {
-	chanID    string
-	thing     things.Thing
-	connected bool
+	chanID      string
+	thing       things.Thing
+	connected   bool
+	connectedAt time.Time
 }
 
 var _ things.ChannelRepository = (*channelRepositoryMock)(nil)
@@ -31,16 +33,26 @@ type channelRepositoryMock struct {
 	tconns   chan Connection                      // used for syncronization with thing repo
 	cconns   map[string]map[string]things.Channel // used to track connections
 	things   things.ThingRepository
+	// actions holds the actions of the connections by their channel and
+	// thing, unless they allow all of them.
+	actions map[string]things.Actions
 }
 
 // NewChannelRepository creates in-memory channel repository.
 func NewChannelRepository(repo things.ThingRepository, tconns chan Connection) things.ChannelRepository {
-	return &channelRepositoryMock{
+	crm := &channelRepositoryMock{
 		channels: make(map[string]things.Channel),
 		tconns:   tconns,
 		cconns:   make(map[string]map[string]things.Channel),
 		things:   repo,
+		actions:  make(map[string]things.Actions),
 	}
+	if trm, ok := repo.(*thingRepositoryMock); ok {
+		trm.mu.Lock()
+		trm.onRemove = crm.disconnectThing
+		trm.mu.Unlock()
+	}
+	return crm
 }
 
 func (crm *channelRepositoryMock) Save(_ context.Context, channels ...things.Channel) ([]things.Channel, error) {
@@ -62,15 +74,29 @@ func (crm *channelRepositoryMock) Update(_ context.Context, channel things.Chann
 
 	dbKey := key(channel.Owner, channel.ID)
 
-	if _, ok := crm.channels[dbKey]; !ok {
+	stored, ok := crm.channels[dbKey]
+	if !ok {
 		return things.ErrNotFound
 	}
 
-	crm.channels[dbKey] = channel
+	// Only the name and metadata are updated, like in the database, and
+	// the connected copies are refreshed, so that the connections are
+	// kept with the updated channel.
+	stored.Name = channel.Name
+	stored.Metadata = channel.Metadata
+	crm.channels[dbKey] = stored
+	for _, chs := range crm.cconns {
+		if _, ok := chs[stored.ID]; ok {
+			chs[stored.ID] = stored
+		}
+	}
 	return nil
 }
 
 func (crm *channelRepositoryMock) RetrieveByID(_ context.Context, owner, id string) (things.Channel, error) {
+	crm.mu.Lock()
+	defer crm.mu.Unlock()
+
 	if c, ok := crm.channels[key(owner, id)]; ok {
 		return c, nil
 	}
@@ -78,6 +104,25 @@ func (crm *channelRepositoryMock) RetrieveByID(_ context.Context, owner, id stri
 	return things.Channel{}, things.ErrNotFound
 }
 
+func (crm *channelRepositoryMock) RetrieveByIDs(_ context.Context, ids []string) ([]things.Channel, error) {
+	crm.mu.Lock()
+	defer crm.mu.Unlock()
+
+	byID := make(map[string]things.Channel, len(crm.channels))
+	for _, ch := range crm.channels {
+		byID[ch.ID] = ch
+	}
+
+	chs := []things.Channel{}
+	for _, id := range ids {
+		if ch, ok := byID[id]; ok {
+			chs = append(chs, ch)
+		}
+	}
+
+	return chs, nil
+}
+
 func (crm *channelRepositoryMock) RetrieveAll(_ context.Context, owner string, pm things.PageMetadata) (things.ChannelsPage, error) {
 	channels := make([]things.Channel, 0)
 
@@ -85,35 +130,64 @@ func (crm *channelRepositoryMock) RetrieveAll(_ context.Context, owner string, p
 		return things.ChannelsPage{}, nil
 	}
 
-	first := uint64(pm.Offset) + 1
-	last := first + uint64(pm.Limit)
-
 	// This obscure way to examine map keys is enforced by the key structure
 	// itself (see mocks/commons.go).
 	prefix := fmt.Sprintf("%s-", owner)
+	if len(pm.AnyOf) > 0 {
+		return crm.retrieveAnyOf(prefix, pm), nil
+	}
+
 	for k, v := range crm.channels {
-		id, _ := strconv.ParseUint(v.ID, 10, 64)
-		if strings.HasPrefix(k, prefix) && id >= first && id < last {
+		if strings.HasPrefix(k, prefix) && hasMetadataKeys(v.Metadata, pm) {
 			channels = append(channels, v)
 		}
 	}
 
-	sort.SliceStable(channels, func(i, j int) bool {
-		return channels[i].ID < channels[j].ID
-	})
+	sortChannels(pm, channels)
+	total := uint64(len(channels))
+	start, end := pageRange(total, pm.Offset, pm.Limit)
 
 	page := things.ChannelsPage{
-		Channels: channels,
+		Channels: channels[start:end],
 		PageMetadata: things.PageMetadata{
-			Total:  crm.counter,
+			Total:  total,
 			Offset: pm.Offset,
 			Limit:  pm.Limit,
+			Order:  pm.Order,
+			Dir:    pm.Dir,
 		},
 	}
 
 	return page, nil
 }
 
+// retrieveAnyOf returns the page of the owner's channels matching the
+// union of filters, paginated over the matching channels.
+func (crm *channelRepositoryMock) retrieveAnyOf(prefix string, pm things.PageMetadata) things.ChannelsPage {
+	channels := make([]things.Channel, 0)
+	for k, v := range crm.channels {
+		if strings.HasPrefix(k, prefix) && hasMetadataKeys(v.Metadata, pm) && matchesAny(v.Name, v.Metadata, pm.AnyOf) {
+			channels = append(channels, v)
+		}
+	}
+
+	sortChannels(pm, channels)
+
+	total := uint64(len(channels))
+	start, end := pageRange(total, pm.Offset, pm.Limit)
+
+	return things.ChannelsPage{
+		Channels: channels[start:end],
+		PageMetadata: things.PageMetadata{
+			Total:  total,
+			Offset: pm.Offset,
+			Limit:  pm.Limit,
+			Order:  pm.Order,
+			Dir:    pm.Dir,
+		},
+	}
+}
+
 func (crm *channelRepositoryMock) RetrieveByThing(_ context.Context, owner, thingID string, offset, limit uint64, connected bool) (things.ChannelsPage, error) {
 	channels := make([]things.Channel, 0)
 
@@ -121,45 +195,31 @@ func (crm *channelRepositoryMock) RetrieveByThing(_ context.Context, owner, thin
 		return things.ChannelsPage{}, nil
 	}
 
-	first := uint64(offset) + 1
-	last := first + uint64(limit)
-
 	// Append connected or not connected channels
 	switch connected {
 	case true:
 		for _, co := range crm.cconns[thingID] {
-			id, _ := strconv.ParseUint(co.ID, 10, 64)
-			if id >= first && id < last {
-				channels = append(channels, co)
-			}
+			channels = append(channels, co)
 		}
 	default:
 		for _, ch := range crm.channels {
-			conn := false
-			id, _ := strconv.ParseUint(ch.ID, 10, 64)
-			if id >= first && id < last {
-				for _, co := range crm.cconns[thingID] {
-					if ch.ID == co.ID {
-						conn = true
-					}
-				}
-
-				// Append if not found in connections list
-				if !conn {
-					channels = append(channels, ch)
-				}
+			// Append if not found in connections list
+			if _, ok := crm.cconns[thingID][ch.ID]; !ok {
+				channels = append(channels, ch)
 			}
 		}
 	}
 
 	sort.SliceStable(channels, func(i, j int) bool {
-		return channels[i].ID < channels[j].ID
+		return idLess(channels[i].ID, channels[j].ID)
 	})
+	total := uint64(len(channels))
+	start, end := pageRange(total, offset, limit)
 
 	page := things.ChannelsPage{
-		Channels: channels,
+		Channels: channels[start:end],
 		PageMetadata: things.PageMetadata{
-			Total:  crm.counter,
+			Total:  total,
 			Offset: offset,
 			Limit:  limit,
 		},
@@ -169,11 +229,15 @@ func (crm *channelRepositoryMock) RetrieveByThing(_ context.Context, owner, thin
 }
 
 func (crm *channelRepositoryMock) Remove(_ context.Context, owner, id string) error {
-	delete(crm.channels, key(owner, id))
-	// delete channel from any thing list
-	for thk := range crm.cconns {
-		delete(crm.cconns[thk], key(owner, id))
+	if _, ok := crm.channels[key(owner, id)]; ok {
+		// delete channel from any thing list, which is keyed by the
+		// channel ID
+		for thk := range crm.cconns {
+			delete(crm.cconns[thk], id)
+			delete(crm.actions, key(id, thk))
+		}
 	}
+	delete(crm.channels, key(owner, id))
 	crm.tconns <- Connection{
 		chanID:    id,
 		connected: false,
@@ -181,34 +245,96 @@ func (crm *channelRepositoryMock) Remove(_ context.Context, owner, id string) er
 	return nil
 }
 
-func (crm *channelRepositoryMock) Connect(_ context.Context, owner string, chIDs, thIDs []string) error {
-	for _, chID := range chIDs {
+func (crm *channelRepositoryMock) Connect(_ context.Context, owner string, chIDs, thIDs []string, limit uint64, actions ...things.Actions) error {
+	if limit > 0 {
+		for _, chID := range chIDs {
+			if crm.connectedThings(chID, thIDs) > limit {
+				return things.ErrChannelFull
+			}
+		}
+	}
+
+	// Like the database, reject the whole request if any of the things is
+	// already connected to any of the channels, while the things may be
+	// connected to other channels.
+	if crm.connected(chIDs, thIDs) {
+		return things.ErrConflict
+	}
+
+	// Retrieve all the channels and things before connecting any of them,
+	// so that a missing one leaves the connections as they were, like the
+	// rolled back transaction.
+	chs := make([]things.Channel, len(chIDs))
+	for i, chID := range chIDs {
 		ch, err := crm.RetrieveByID(context.Background(), owner, chID)
 		if err != nil {
 			return err
 		}
+		chs[i] = ch
+	}
+	ths := make([]things.Thing, len(thIDs))
+	for i, thID := range thIDs {
+		th, err := crm.things.RetrieveByID(context.Background(), owner, thID)
+		if err != nil {
+			return err
+		}
+		ths[i] = th
+	}
 
-		for _, thID := range thIDs {
-			th, err := crm.things.RetrieveByID(context.Background(), owner, thID)
-			if err != nil {
-				return err
-			}
-
+	for _, ch := range chs {
+		chID := ch.ID
+		for _, th := range ths {
+			thID := th.ID
 			crm.tconns <- Connection{
-				chanID:    chID,
-				thing:     th,
-				connected: true,
+				chanID:      chID,
+				thing:       th,
+				connected:   true,
+				connectedAt: time.Now(),
 			}
 			if _, ok := crm.cconns[thID]; !ok {
 				crm.cconns[thID] = make(map[string]things.Channel)
 			}
 			crm.cconns[thID][chID] = ch
+			if a := things.Union(actions...); a != 0 {
+				crm.actions[key(chID, thID)] = a
+			}
 		}
 	}
 
 	return nil
 }
 
+// connected reports whether any of the things is connected to any of the
+// channels.
+func (crm *channelRepositoryMock) connected(chIDs, thIDs []string) bool {
+	crm.mu.Lock()
+	defer crm.mu.Unlock()
+
+	for _, thID := range thIDs {
+		for _, chID := range chIDs {
+			if _, ok := crm.cconns[thID][chID]; ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// connectedThings returns the number of things connected to the channel
+// once the provided things are connected.
+func (crm *channelRepositoryMock) connectedThings(chID string, thIDs []string) uint64 {
+	ths := make(map[string]bool)
+	for thID, chs := range crm.cconns {
+		if _, ok := chs[chID]; ok {
+			ths[thID] = true
+		}
+	}
+	for _, thID := range thIDs {
+		ths[thID] = true
+	}
+	return uint64(len(ths))
+}
+
 func (crm *channelRepositoryMock) Disconnect(_ context.Context, owner, chanID, thingID string) error {
 	if _, ok := crm.cconns[thingID]; !ok {
 		return things.ErrNotFound
@@ -224,9 +350,57 @@ func (crm *channelRepositoryMock) Disconnect(_ context.Context, owner, chanID, t
 		connected: false,
 	}
 	delete(crm.cconns[thingID], chanID)
+	delete(crm.actions, key(chanID, thingID))
+	return nil
+}
+
+func (crm *channelRepositoryMock) DisconnectMany(_ context.Context, owner string, chIDs, thIDs []string) error {
+	// Check all the connections before removing any of them, like the
+	// rolled back transaction.
+	for _, chID := range chIDs {
+		if _, err := crm.RetrieveByID(context.Background(), owner, chID); err != nil {
+			return err
+		}
+		for _, thID := range thIDs {
+			if _, ok := crm.cconns[thID][chID]; !ok {
+				return things.ErrNotFound
+			}
+		}
+	}
+
+	for _, chID := range chIDs {
+		for _, thID := range thIDs {
+			crm.tconns <- Connection{
+				chanID:    chID,
+				thing:     things.Thing{ID: thID, Owner: owner},
+				connected: false,
+			}
+			delete(crm.cconns[thID], chID)
+			delete(crm.actions, key(chID, thID))
+		}
+	}
 	return nil
 }
 
+// disconnectThing disconnects the removed thing from all the channels.
+func (crm *channelRepositoryMock) disconnectThing(owner, thingID string) {
+	crm.mu.Lock()
+	chs := crm.cconns[thingID]
+	delete(crm.cconns, thingID)
+	for chanID := range chs {
+		delete(crm.actions, key(chanID, thingID))
+	}
+	crm.mu.Unlock()
+
+	for chanID := range chs {
+		crm.tconns <- Connection{
+			chanID:    chanID,
+			thing:     things.Thing{ID: thingID, Owner: owner},
+			connected: false,
+		}
+	}
+}
+
 func (crm *channelRepositoryMock) HasThing(_ context.Context, chanID, token string) (string, error) {
 	tid, err := crm.things.RetrieveByKey(context.Background(), token)
 	if err != nil {
@@ -245,7 +419,7 @@ func (crm *channelRepositoryMock) HasThing(_ context.Context, chanID, token stri
 	return tid, nil
 }
 
-func (crm *channelRepositoryMock) HasThingByID(_ context.Context, chanID, thingID string) error {
+func (crm *channelRepositoryMock) HasThingByID(_ context.Context, chanID, thingID string, actions ...things.Actions) error {
 	chans, ok := crm.cconns[thingID]
 	if !ok {
 		return things.ErrEntityConnected
@@ -255,18 +429,72 @@ func (crm *channelRepositoryMock) HasThingByID(_ context.Context, chanID, thingI
 		return things.ErrEntityConnected
 	}
 
+	if !crm.actions[key(chanID, thingID)].Allows(things.Union(actions...)) {
+		return things.ErrActionNotAllowed
+	}
+
 	return nil
 }
 
+func (crm *channelRepositoryMock) RetrieveConnectionsByThing(_ context.Context, thingID string) ([]string, error) {
+	crm.mu.Lock()
+	defer crm.mu.Unlock()
+
+	chIDs := []string{}
+	for chID := range crm.cconns[thingID] {
+		chIDs = append(chIDs, chID)
+	}
+	sort.Strings(chIDs)
+
+	return chIDs, nil
+}
+
+func (crm *channelRepositoryMock) RetrieveAllConnections(_ context.Context) ([]things.Connection, error) {
+	crm.mu.Lock()
+	defer crm.mu.Unlock()
+
+	var conns []things.Connection
+	for thID, chs := range crm.cconns {
+		for chID := range chs {
+			conns = append(conns, things.Connection{ChannelID: chID, ThingID: thID, Actions: crm.actions[key(chID, thID)]})
+		}
+	}
+
+	return conns, nil
+}
+
+func (crm *channelRepositoryMock) CountAll(_ context.Context) (uint64, uint64, error) {
+	crm.mu.Lock()
+	defer crm.mu.Unlock()
+
+	var conns uint64
+	for _, chs := range crm.cconns {
+		conns += uint64(len(chs))
+	}
+	return uint64(len(crm.channels)), conns, nil
+}
+
 type channelCacheMock struct {
 	mu       sync.Mutex
-	channels map[string]string
+	channels map[string]map[string]struct{}
+	// conns holds the channels of the things saved by SaveConnections.
+	conns map[string][]string
+	lru   *lru
 }
 
 // NewChannelCache returns mock cache instance.
 func NewChannelCache() things.ChannelCache {
+	return NewChannelCacheWithSize(0)
+}
+
+// NewChannelCacheWithSize returns mock cache instance which holds at most
+// size connections, evicting the least recently used ones when full. If
+// size is zero, the cache is unbounded.
+func NewChannelCacheWithSize(size int) things.ChannelCache {
 	return &channelCacheMock{
-		channels: make(map[string]string),
+		channels: make(map[string]map[string]struct{}),
+		conns:    make(map[string][]string),
+		lru:      newLRU(size),
 	}
 }
 
@@ -274,29 +502,109 @@ func (ccm *channelCacheMock) Connect(_ context.Context, chanID, thingID string)
 	ccm.mu.Lock()
 	defer ccm.mu.Unlock()
 
-	ccm.channels[chanID] = thingID
+	ccm.connect(chanID, thingID)
 	return nil
 }
 
+func (ccm *channelCacheMock) connect(chanID, thingID string) {
+	if _, ok := ccm.channels[chanID]; !ok {
+		ccm.channels[chanID] = make(map[string]struct{})
+	}
+	ccm.channels[chanID][thingID] = struct{}{}
+
+	if evicted, ok := ccm.lru.touch(things.Connection{ChannelID: chanID, ThingID: thingID}); ok {
+		conn := evicted.(things.Connection)
+		ccm.disconnect(conn.ChannelID, conn.ThingID)
+	}
+}
+
 func (ccm *channelCacheMock) HasThing(_ context.Context, chanID, thingID string) bool {
 	ccm.mu.Lock()
 	defer ccm.mu.Unlock()
 
-	return ccm.channels[chanID] == thingID
+	_, ok := ccm.channels[chanID][thingID]
+	if ok {
+		ccm.lru.touch(things.Connection{ChannelID: chanID, ThingID: thingID})
+	}
+	return ok
 }
 
 func (ccm *channelCacheMock) Disconnect(_ context.Context, chanID, thingID string) error {
 	ccm.mu.Lock()
 	defer ccm.mu.Unlock()
 
-	delete(ccm.channels, chanID)
+	ccm.lru.remove(things.Connection{ChannelID: chanID, ThingID: thingID})
+	ccm.disconnect(chanID, thingID)
+	delete(ccm.conns, thingID)
 	return nil
 }
 
+func (ccm *channelCacheMock) disconnect(chanID, thingID string) {
+	delete(ccm.channels[chanID], thingID)
+	if len(ccm.channels[chanID]) == 0 {
+		delete(ccm.channels, chanID)
+	}
+}
+
 func (ccm *channelCacheMock) Remove(_ context.Context, chanID string) error {
 	ccm.mu.Lock()
 	defer ccm.mu.Unlock()
 
+	for thID := range ccm.channels[chanID] {
+		ccm.lru.remove(things.Connection{ChannelID: chanID, ThingID: thID})
+	}
 	delete(ccm.channels, chanID)
+	for thID, chIDs := range ccm.conns {
+		for _, chID := range chIDs {
+			if chID == chanID {
+				delete(ccm.conns, thID)
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func (ccm *channelCacheMock) RetrieveAll(_ context.Context) ([]things.Connection, error) {
+	ccm.mu.Lock()
+	defer ccm.mu.Unlock()
+
+	var conns []things.Connection
+	for chID, ths := range ccm.channels {
+		for thID := range ths {
+			conns = append(conns, things.Connection{ChannelID: chID, ThingID: thID})
+		}
+	}
+
+	return conns, nil
+}
+
+func (ccm *channelCacheMock) Connections(_ context.Context, thingID string) ([]string, error) {
+	ccm.mu.Lock()
+	defer ccm.mu.Unlock()
+
+	chIDs, ok := ccm.conns[thingID]
+	if !ok {
+		return nil, things.ErrNotFound
+	}
+	return append([]string{}, chIDs...), nil
+}
+
+func (ccm *channelCacheMock) SaveConnections(_ context.Context, thingID string, chanIDs []string) error {
+	ccm.mu.Lock()
+	defer ccm.mu.Unlock()
+
+	for _, chID := range chanIDs {
+		ccm.connect(chID, thingID)
+	}
+	ccm.conns[thingID] = append([]string{}, chanIDs...)
+	return nil
+}
+
+func (ccm *channelCacheMock) RemoveConnections(_ context.Context, thingID string) error {
+	ccm.mu.Lock()
+	defer ccm.mu.Unlock()
+
+	delete(ccm.conns, thingID)
 	return nil
 }
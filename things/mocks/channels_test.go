@@ -0,0 +1,442 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package mocks_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/mainflux/mainflux/pkg/errors"
+	"github.com/mainflux/mainflux/pkg/uuid"
+	"github.com/mainflux/mainflux/things"
+	"github.com/mainflux/mainflux/things/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChannelCacheMultipleThings(t *testing.T) {
+	channelCache := mocks.NewChannelCache()
+
+	cid := "123"
+	tids := []string{"321", "322", "323"}
+	for _, tid := range tids {
+		err := channelCache.Connect(context.Background(), cid, tid)
+		require.Nil(t, err, fmt.Sprintf("connect thing %s to channel: fail to connect due to: %s\n", tid, err))
+	}
+
+	for _, tid := range tids {
+		hasAccess := channelCache.HasThing(context.Background(), cid, tid)
+		assert.True(t, hasAccess, fmt.Sprintf("access check for connected thing %s: expected access", tid))
+	}
+
+	conns, err := channelCache.RetrieveAll(context.Background())
+	require.Nil(t, err, fmt.Sprintf("retrieve all connections: unexpected error: %s\n", err))
+	assert.Len(t, conns, len(tids), fmt.Sprintf("retrieve all connections: expected %d connections got %d\n", len(tids), len(conns)))
+
+	err = channelCache.Disconnect(context.Background(), cid, tids[0])
+	require.Nil(t, err, fmt.Sprintf("disconnect thing from channel: fail to disconnect due to: %s\n", err))
+
+	cases := map[string]struct {
+		cid       string
+		tid       string
+		hasAccess bool
+	}{
+		"access check for disconnected thing": {
+			cid:       cid,
+			tid:       tids[0],
+			hasAccess: false,
+		},
+		"access check for thing still connected": {
+			cid:       cid,
+			tid:       tids[1],
+			hasAccess: true,
+		},
+		"access check for other thing still connected": {
+			cid:       cid,
+			tid:       tids[2],
+			hasAccess: true,
+		},
+	}
+	for desc, tc := range cases {
+		hasAccess := channelCache.HasThing(context.Background(), tc.cid, tc.tid)
+		assert.Equal(t, tc.hasAccess, hasAccess, fmt.Sprintf("%s: expected %t got %t\n", desc, tc.hasAccess, hasAccess))
+	}
+
+	err = channelCache.Remove(context.Background(), cid)
+	require.Nil(t, err, fmt.Sprintf("remove channel: fail to remove due to: %s\n", err))
+	for _, tid := range tids {
+		hasAccess := channelCache.HasThing(context.Background(), cid, tid)
+		assert.False(t, hasAccess, fmt.Sprintf("access check for thing %s of removed channel: expected no access", tid))
+	}
+}
+
+func TestChannelCacheEviction(t *testing.T) {
+	channelCache := mocks.NewChannelCacheWithSize(2)
+
+	cid := "123"
+	tids := []string{"321", "322", "323"}
+	for _, tid := range tids[:2] {
+		err := channelCache.Connect(context.Background(), cid, tid)
+		require.Nil(t, err, fmt.Sprintf("connect thing %s to channel: fail to connect due to: %s\n", tid, err))
+	}
+	// Use the first connection so that the second one becomes the least
+	// recently used.
+	require.True(t, channelCache.HasThing(context.Background(), cid, tids[0]), "access check for cached thing: expected access")
+	err := channelCache.Connect(context.Background(), cid, tids[2])
+	require.Nil(t, err, fmt.Sprintf("connect thing %s to channel: fail to connect due to: %s\n", tids[2], err))
+
+	cases := map[string]struct {
+		tid       string
+		hasAccess bool
+	}{
+		"access check for recently used thing":  {tid: tids[0], hasAccess: true},
+		"access check for evicted thing":        {tid: tids[1], hasAccess: false},
+		"access check for recently added thing": {tid: tids[2], hasAccess: true},
+	}
+	for desc, tc := range cases {
+		hasAccess := channelCache.HasThing(context.Background(), cid, tc.tid)
+		assert.Equal(t, tc.hasAccess, hasAccess, fmt.Sprintf("%s: expected %t got %t\n", desc, tc.hasAccess, hasAccess))
+	}
+
+	conns, err := channelCache.RetrieveAll(context.Background())
+	require.Nil(t, err, fmt.Sprintf("retrieve all connections: unexpected error: %s\n", err))
+	assert.Len(t, conns, 2, fmt.Sprintf("retrieve all connections: expected 2 connections got %d\n", len(conns)))
+}
+
+func TestChannelCacheRepopulation(t *testing.T) {
+	token, email := "token", "user@example.com"
+	conns := make(chan mocks.Connection)
+	thingsRepo := mocks.NewThingRepository(conns)
+	channelsRepo := mocks.NewChannelRepository(thingsRepo, conns)
+	channelCache := mocks.NewChannelCacheWithSize(1)
+	svc := things.New(mocks.NewAuthService(map[string]string{token: email}), thingsRepo, channelsRepo, nil, channelCache, mocks.NewThingCache(), uuid.NewMock())
+
+	ths, err := svc.CreateThings(context.Background(), token, things.Thing{Name: "a"}, things.Thing{Name: "b"})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+	chs, err := svc.CreateChannels(context.Background(), token, things.Channel{Name: "c"})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+	cid := chs[0].ID
+	err = svc.Connect(context.Background(), token, []string{cid}, []string{ths[0].ID, ths[1].ID})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+
+	for _, id := range []string{ths[0].ID, ths[1].ID, ths[0].ID} {
+		err := svc.CanAccessByID(context.Background(), cid, id)
+		assert.Nil(t, err, fmt.Sprintf("access check for thing %s: unexpected error: %s\n", id, err))
+		assert.True(t, channelCache.HasThing(context.Background(), cid, id), fmt.Sprintf("access check for thing %s: expected connection to be cached", id))
+	}
+	assert.False(t, channelCache.HasThing(context.Background(), cid, ths[1].ID), fmt.Sprintf("access check for thing %s: expected connection to be evicted", ths[1].ID))
+}
+
+func TestConnectMultipleChannels(t *testing.T) {
+	owner := "user@example.com"
+	conns := make(chan mocks.Connection)
+	thingsRepo := mocks.NewThingRepository(conns)
+	channelsRepo := mocks.NewChannelRepository(thingsRepo, conns)
+
+	ths, err := thingsRepo.Save(context.Background(), things.Thing{Owner: owner, Key: "key"})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	chs, err := channelsRepo.Save(context.Background(), things.Channel{Owner: owner}, things.Channel{Owner: owner})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	thID := ths[0].ID
+
+	for _, ch := range chs {
+		err := channelsRepo.Connect(context.Background(), owner, []string{ch.ID}, []string{thID}, 0)
+		assert.Nil(t, err, fmt.Sprintf("connect thing to channel %s: expected no error got %s", ch.ID, err))
+	}
+
+	err = channelsRepo.Connect(context.Background(), owner, []string{chs[0].ID}, []string{thID}, 0)
+	assert.True(t, errors.Contains(err, things.ErrConflict), fmt.Sprintf("connect thing to channel twice: expected %s got %s", things.ErrConflict, err))
+
+	stored, err := channelsRepo.RetrieveAllConnections(context.Background())
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	expected := []things.Connection{
+		{ChannelID: chs[0].ID, ThingID: thID},
+		{ChannelID: chs[1].ID, ThingID: thID},
+	}
+	assert.ElementsMatch(t, expected, stored, fmt.Sprintf("expected connections %v got %v", expected, stored))
+}
+
+func TestRemoveConnectedThing(t *testing.T) {
+	owner := "user@example.com"
+	conns := make(chan mocks.Connection)
+	thingsRepo := mocks.NewThingRepository(conns)
+	channelsRepo := mocks.NewChannelRepository(thingsRepo, conns)
+
+	ths, err := thingsRepo.Save(context.Background(), things.Thing{Owner: owner, Key: "key-1"}, things.Thing{Owner: owner, Key: "key-2"})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	chs, err := channelsRepo.Save(context.Background(), things.Channel{Owner: owner}, things.Channel{Owner: owner})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	removed, kept := ths[0].ID, ths[1].ID
+	chIDs := []string{chs[0].ID, chs[1].ID}
+
+	err = channelsRepo.Connect(context.Background(), owner, chIDs, []string{removed, kept}, 0)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+
+	err = thingsRepo.Remove(context.Background(), owner, removed)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+
+	stored, err := channelsRepo.RetrieveAllConnections(context.Background())
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	expected := []things.Connection{
+		{ChannelID: chs[0].ID, ThingID: kept},
+		{ChannelID: chs[1].ID, ThingID: kept},
+	}
+	assert.ElementsMatch(t, expected, stored, fmt.Sprintf("expected connections %v got %v", expected, stored))
+
+	for _, chID := range chIDs {
+		err := channelsRepo.HasThingByID(context.Background(), chID, removed)
+		assert.True(t, errors.Contains(err, things.ErrEntityConnected), fmt.Sprintf("access check for channel %s: expected %s got %s", chID, things.ErrEntityConnected, err))
+
+		page, err := thingsRepo.RetrieveByChannel(context.Background(), owner, chID, true, things.PageMetadata{Limit: 10})
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+		var ids []string
+		for _, th := range page.Things {
+			ids = append(ids, th.ID)
+		}
+		assert.Equal(t, []string{kept}, ids, fmt.Sprintf("things of channel %s: expected %v got %v", chID, []string{kept}, ids))
+	}
+}
+
+func TestUpdateConnectedChannel(t *testing.T) {
+	owner := "user@example.com"
+	conns := make(chan mocks.Connection)
+	thingsRepo := mocks.NewThingRepository(conns)
+	channelsRepo := mocks.NewChannelRepository(thingsRepo, conns)
+
+	ths, err := thingsRepo.Save(context.Background(), things.Thing{Owner: owner, Key: "key"})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	chs, err := channelsRepo.Save(context.Background(), things.Channel{Owner: owner, Name: "name"})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	thID, ch := ths[0].ID, chs[0]
+
+	err = channelsRepo.Connect(context.Background(), owner, []string{ch.ID}, []string{thID}, 0)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+
+	cases := []struct {
+		desc    string
+		channel things.Channel
+		err     error
+	}{
+		{
+			desc:    "update channel name and metadata",
+			channel: things.Channel{ID: ch.ID, Owner: owner, Name: "updated", Metadata: map[string]interface{}{"type": "sensor"}},
+			err:     nil,
+		},
+		{
+			desc:    "update channel of other owner",
+			channel: things.Channel{ID: ch.ID, Owner: "other@example.com", Name: "other"},
+			err:     things.ErrNotFound,
+		},
+		{
+			desc:    "update non-existing channel",
+			channel: things.Channel{ID: "123", Owner: owner, Name: "other"},
+			err:     things.ErrNotFound,
+		},
+	}
+
+	expected := things.Channel{ID: ch.ID, Owner: owner, Name: "updated", Metadata: map[string]interface{}{"type": "sensor"}}
+	for _, tc := range cases {
+		err := channelsRepo.Update(context.Background(), tc.channel)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s", tc.desc, tc.err, err))
+
+		stored, err := channelsRepo.RetrieveByID(context.Background(), owner, ch.ID)
+		require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", tc.desc, err))
+		assert.Equal(t, expected, stored, fmt.Sprintf("%s: expected channel %v got %v", tc.desc, expected, stored))
+
+		err = channelsRepo.HasThingByID(context.Background(), ch.ID, thID)
+		assert.Nil(t, err, fmt.Sprintf("%s: expected connection to be kept got %s", tc.desc, err))
+		page, err := channelsRepo.RetrieveByThing(context.Background(), owner, thID, 0, 10, true)
+		require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", tc.desc, err))
+		assert.Equal(t, []things.Channel{expected}, page.Channels, fmt.Sprintf("%s: expected connected channels %v got %v", tc.desc, []things.Channel{expected}, page.Channels))
+	}
+}
+
+func TestConnectionActions(t *testing.T) {
+	owner := "user@example.com"
+	conns := make(chan mocks.Connection)
+	thingsRepo := mocks.NewThingRepository(conns)
+	channelsRepo := mocks.NewChannelRepository(thingsRepo, conns)
+
+	ths, err := thingsRepo.Save(context.Background(),
+		things.Thing{Owner: owner, Key: "publisher"},
+		things.Thing{Owner: owner, Key: "subscriber"},
+		things.Thing{Owner: owner, Key: "both"},
+	)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	chs, err := channelsRepo.Save(context.Background(), things.Channel{Owner: owner})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	chID := chs[0].ID
+	pub, sub, both := ths[0].ID, ths[1].ID, ths[2].ID
+
+	err = channelsRepo.Connect(context.Background(), owner, []string{chID}, []string{pub}, 0, things.ActionPublish)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	err = channelsRepo.Connect(context.Background(), owner, []string{chID}, []string{sub}, 0, things.ActionSubscribe)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	err = channelsRepo.Connect(context.Background(), owner, []string{chID}, []string{both}, 0)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+
+	cases := []struct {
+		desc    string
+		thID    string
+		actions []things.Actions
+		err     error
+	}{
+		{
+			desc:    "check publish-only connection to publish",
+			thID:    pub,
+			actions: []things.Actions{things.ActionPublish},
+			err:     nil,
+		},
+		{
+			desc:    "check publish-only connection to subscribe",
+			thID:    pub,
+			actions: []things.Actions{things.ActionSubscribe},
+			err:     things.ErrActionNotAllowed,
+		},
+		{
+			desc:    "check subscribe-only connection to subscribe",
+			thID:    sub,
+			actions: []things.Actions{things.ActionSubscribe},
+			err:     nil,
+		},
+		{
+			desc:    "check subscribe-only connection to publish",
+			thID:    sub,
+			actions: []things.Actions{things.ActionPublish},
+			err:     things.ErrActionNotAllowed,
+		},
+		{
+			desc:    "check subscribe-only connection to publish and subscribe",
+			thID:    sub,
+			actions: []things.Actions{things.ActionPublish, things.ActionSubscribe},
+			err:     things.ErrActionNotAllowed,
+		},
+		{
+			desc:    "check subscribe-only connection without action",
+			thID:    sub,
+			actions: nil,
+			err:     nil,
+		},
+		{
+			desc:    "check connection without actions to publish and subscribe",
+			thID:    both,
+			actions: []things.Actions{things.ActionPublish, things.ActionSubscribe},
+			err:     nil,
+		},
+	}
+
+	for _, tc := range cases {
+		err := channelsRepo.HasThingByID(context.Background(), chID, tc.thID, tc.actions...)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s", tc.desc, tc.err, err))
+	}
+
+	stored, err := channelsRepo.RetrieveAllConnections(context.Background())
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	expected := []things.Connection{
+		{ChannelID: chID, ThingID: pub, Actions: things.ActionPublish},
+		{ChannelID: chID, ThingID: sub, Actions: things.ActionSubscribe},
+		{ChannelID: chID, ThingID: both},
+	}
+	assert.ElementsMatch(t, expected, stored, fmt.Sprintf("expected connections %v got %v", expected, stored))
+
+	// Reconnecting the thing doesn't keep the actions of the previous
+	// connection.
+	err = channelsRepo.Disconnect(context.Background(), owner, chID, pub)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	err = channelsRepo.Connect(context.Background(), owner, []string{chID}, []string{pub}, 0)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	err = channelsRepo.HasThingByID(context.Background(), chID, pub, things.ActionSubscribe)
+	assert.Nil(t, err, fmt.Sprintf("reconnected thing: expected no error got %s", err))
+}
+
+func TestConnectDisconnectMany(t *testing.T) {
+	owner := "user@example.com"
+	conns := make(chan mocks.Connection)
+	thingsRepo := mocks.NewThingRepository(conns)
+	channelsRepo := mocks.NewChannelRepository(thingsRepo, conns)
+
+	ths, err := thingsRepo.Save(context.Background(), things.Thing{Owner: owner, Key: "key"})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	chs, err := channelsRepo.Save(context.Background(), things.Channel{Owner: owner}, things.Channel{Owner: owner})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	thID := ths[0].ID
+	chIDs := []string{chs[0].ID, chs[1].ID}
+	invalid := []string{chs[0].ID, "invalid", chs[1].ID}
+
+	connected := func(desc string, expected bool) {
+		for _, chID := range chIDs {
+			err := channelsRepo.HasThingByID(context.Background(), chID, thID)
+			assert.Equal(t, expected, err == nil, fmt.Sprintf("%s: expected thing connected to channel %s to be %t got %s", desc, chID, expected, err))
+		}
+	}
+
+	err = channelsRepo.Connect(context.Background(), owner, invalid, []string{thID}, 0)
+	assert.True(t, errors.Contains(err, things.ErrNotFound), fmt.Sprintf("connect to invalid channel: expected %s got %s", things.ErrNotFound, err))
+	connected("connect to invalid channel", false)
+	stored, err := channelsRepo.RetrieveAllConnections(context.Background())
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	assert.Empty(t, stored, fmt.Sprintf("connect to invalid channel: expected no connections got %v", stored))
+
+	err = channelsRepo.Connect(context.Background(), owner, chIDs, []string{thID}, 0)
+	assert.Nil(t, err, fmt.Sprintf("connect to channels: expected no error got %s", err))
+	connected("connect to channels", true)
+
+	err = channelsRepo.DisconnectMany(context.Background(), owner, invalid, []string{thID})
+	assert.True(t, errors.Contains(err, things.ErrNotFound), fmt.Sprintf("disconnect from invalid channel: expected %s got %s", things.ErrNotFound, err))
+	connected("disconnect from invalid channel", true)
+
+	err = channelsRepo.DisconnectMany(context.Background(), owner, chIDs, []string{thID})
+	assert.Nil(t, err, fmt.Sprintf("disconnect from channels: expected no error got %s", err))
+	connected("disconnect from channels", false)
+
+	err = channelsRepo.DisconnectMany(context.Background(), owner, chIDs, []string{thID})
+	assert.True(t, errors.Contains(err, things.ErrNotFound), fmt.Sprintf("disconnect from disconnected channels: expected %s got %s", things.ErrNotFound, err))
+}
+
+func TestChannelRetrieveByIDs(t *testing.T) {
+	conns := make(chan mocks.Connection)
+	thingsRepo := mocks.NewThingRepository(conns)
+	repo := mocks.NewChannelRepository(thingsRepo, conns)
+
+	chs, err := repo.Save(context.Background(),
+		things.Channel{Owner: "user@example.com", Name: "a"},
+		things.Channel{Owner: "user@example.com", Name: "b"},
+		things.Channel{Owner: "other@example.com", Name: "c"},
+	)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+
+	cases := []struct {
+		desc     string
+		ids      []string
+		expected []things.Channel
+	}{
+		{
+			desc:     "retrieve existing channels in the order of the ids",
+			ids:      []string{chs[2].ID, chs[0].ID, chs[1].ID},
+			expected: []things.Channel{chs[2], chs[0], chs[1]},
+		},
+		{
+			desc:     "retrieve existing and missing channels",
+			ids:      []string{"missing", chs[1].ID, "other-missing", chs[0].ID},
+			expected: []things.Channel{chs[1], chs[0]},
+		},
+		{
+			desc:     "retrieve missing channels",
+			ids:      []string{"missing"},
+			expected: []things.Channel{},
+		},
+		{
+			desc:     "retrieve channels without ids",
+			ids:      []string{},
+			expected: []things.Channel{},
+		},
+	}
+
+	for _, tc := range cases {
+		res, err := repo.RetrieveByIDs(context.Background(), tc.ids)
+		assert.Nil(t, err, fmt.Sprintf("%s: expected no error got %s\n", tc.desc, err))
+		assert.Equal(t, tc.expected, res, fmt.Sprintf("%s: expected %v got %v\n", tc.desc, tc.expected, res))
+	}
+}
@@ -3,7 +3,34 @@
 
 package mocks
 
-import "fmt"
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/mainflux/mainflux"
+	"github.com/mainflux/mainflux/things"
+)
+
+var _ mainflux.IDProvider = (*counterProvider)(nil)
+
+// counterProvider generates the sequential numeric identifiers the mocks
+// paginate by default.
+type counterProvider struct {
+	mu      sync.Mutex
+	counter uint64
+}
+
+func (cp *counterProvider) ID() (string, error) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	cp.counter++
+	return strconv.FormatUint(cp.counter, 10), nil
+}
 
 // Since mocks will store data in map, and they need to resemble the real
 // identifiers as much as possible, a key will be created as combination of
@@ -12,3 +39,90 @@ import "fmt"
 func key(owner string, id string) string {
 	return fmt.Sprintf("%s-%s", owner, id)
 }
+
+// sortThings orders the things the way the page metadata requests, by
+// name or by ID, in ascending order unless the direction is desc. Things
+// are ordered by ascending ID by default and when their names are equal,
+// so that the order is stable.
+func sortThings(pm things.PageMetadata, ths []things.Thing) {
+	sort.SliceStable(ths, func(i, j int) bool {
+		return pageLess(pm, ths[i].Name, ths[i].ID, ths[j].Name, ths[j].ID)
+	})
+}
+
+// sortChannels orders the channels the same way sortThings orders things.
+func sortChannels(pm things.PageMetadata, chs []things.Channel) {
+	sort.SliceStable(chs, func(i, j int) bool {
+		return pageLess(pm, chs[i].Name, chs[i].ID, chs[j].Name, chs[j].ID)
+	})
+}
+
+func pageLess(pm things.PageMetadata, name1, id1, name2, id2 string) bool {
+	desc := pm.Dir == "desc"
+	if pm.Order == "name" && name1 != name2 {
+		if desc {
+			return name1 > name2
+		}
+		return name1 < name2
+	}
+	if pm.Order != "name" && desc {
+		return idLess(id2, id1)
+	}
+	return idLess(id1, id2)
+}
+
+// hasMetadataKeys checks whether the metadata contains all the keys
+// required and none of the keys forbidden by the page metadata.
+func hasMetadataKeys(m map[string]interface{}, pm things.PageMetadata) bool {
+	for _, k := range pm.HasMetadataKeys {
+		if _, ok := m[k]; !ok {
+			return false
+		}
+	}
+	for _, k := range pm.MissingMetadataKeys {
+		if _, ok := m[k]; ok {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesAny checks whether the entity satisfies at least one of the
+// filters. It matches every entity if there are no filters.
+func matchesAny(name string, m map[string]interface{}, filters []things.Filter) bool {
+	if len(filters) == 0 {
+		return true
+	}
+	for _, f := range filters {
+		if f.Name != "" && !strings.Contains(strings.ToLower(name), strings.ToLower(f.Name)) {
+			continue
+		}
+		if !containsMetadata(m, f.Metadata) {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+func containsMetadata(m, sub map[string]interface{}) bool {
+	for k, v := range sub {
+		if !reflect.DeepEqual(m[k], v) {
+			return false
+		}
+	}
+	return true
+}
+
+// pageRange returns the bounds of the page items when the items are
+// filtered, so the ID range can't be used for pagination.
+func pageRange(total, offset, limit uint64) (uint64, uint64) {
+	if offset > total {
+		offset = total
+	}
+	end := offset + limit
+	if end > total {
+		end = total
+	}
+	return offset, end
+}
@@ -0,0 +1,237 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package mocks
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/mainflux/mainflux/internal/groups"
+)
+
+var _ groups.Repository = (*groupRepositoryMock)(nil)
+
+type groupRepositoryMock struct {
+	mu     sync.Mutex
+	groups map[string]groups.Group
+	// Memberships are kept by member ID and are not removed when the
+	// group is deleted, mimicking a store without referential integrity.
+	memberships map[string]map[string]bool
+	// members indexes the memberships by group ID, so that listing the
+	// members of a group doesn't scan every membership.
+	members map[string]map[string]bool
+}
+
+// NewGroupRepository creates in-memory thing group repository.
+func NewGroupRepository() groups.Repository {
+	return &groupRepositoryMock{
+		groups:      make(map[string]groups.Group),
+		memberships: make(map[string]map[string]bool),
+		members:     make(map[string]map[string]bool),
+	}
+}
+
+func (grm *groupRepositoryMock) Save(_ context.Context, g groups.Group) (groups.Group, error) {
+	grm.mu.Lock()
+	defer grm.mu.Unlock()
+
+	if _, ok := grm.groups[g.ID]; ok {
+		return groups.Group{}, groups.ErrGroupConflict
+	}
+	if g.ParentID != "" {
+		if _, ok := grm.groups[g.ParentID]; !ok {
+			return groups.Group{}, groups.ErrMissingParent
+		}
+	}
+	grm.groups[g.ID] = g
+	return g, nil
+}
+
+func (grm *groupRepositoryMock) Update(_ context.Context, g groups.Group) (groups.Group, error) {
+	grm.mu.Lock()
+	defer grm.mu.Unlock()
+
+	up, ok := grm.groups[g.ID]
+	if !ok {
+		return groups.Group{}, groups.ErrNotFound
+	}
+	up.Name = g.Name
+	up.Description = g.Description
+	up.Metadata = g.Metadata
+	grm.groups[g.ID] = up
+	return up, nil
+}
+
+func (grm *groupRepositoryMock) Delete(_ context.Context, id string) error {
+	grm.mu.Lock()
+	defer grm.mu.Unlock()
+
+	if _, ok := grm.groups[id]; !ok {
+		return groups.ErrNotFound
+	}
+	delete(grm.groups, id)
+	return nil
+}
+
+func (grm *groupRepositoryMock) RetrieveByID(_ context.Context, id string) (groups.Group, error) {
+	grm.mu.Lock()
+	defer grm.mu.Unlock()
+
+	g, ok := grm.groups[id]
+	if !ok {
+		return groups.Group{}, groups.ErrNotFound
+	}
+	return g, nil
+}
+
+func (grm *groupRepositoryMock) RetrieveAll(_ context.Context, level uint64, m groups.Metadata) (groups.GroupPage, error) {
+	grm.mu.Lock()
+	defer grm.mu.Unlock()
+
+	var items []groups.Group
+	for _, g := range grm.groups {
+		items = append(items, g)
+	}
+	return groups.GroupPage{
+		Groups: items,
+		PageMetadata: groups.PageMetadata{
+			Total: uint64(len(items)),
+		},
+	}, nil
+}
+
+func (grm *groupRepositoryMock) RetrieveAllParents(_ context.Context, groupID string, level uint64, m groups.Metadata) (groups.GroupPage, error) {
+	grm.mu.Lock()
+	defer grm.mu.Unlock()
+
+	var items []groups.Group
+	for g, ok := grm.groups[groupID]; ok; g, ok = grm.groups[g.ParentID] {
+		items = append(items, g)
+	}
+	return groups.GroupPage{
+		Groups: items,
+		PageMetadata: groups.PageMetadata{
+			Total: uint64(len(items)),
+		},
+	}, nil
+}
+
+func (grm *groupRepositoryMock) RetrieveAllChildren(_ context.Context, groupID string, level uint64, m groups.Metadata) (groups.GroupPage, error) {
+	grm.mu.Lock()
+	defer grm.mu.Unlock()
+
+	var items []groups.Group
+	for _, g := range grm.groups {
+		if g.ParentID == groupID {
+			items = append(items, g)
+		}
+	}
+	return groups.GroupPage{
+		Groups: items,
+		PageMetadata: groups.PageMetadata{
+			Total: uint64(len(items)),
+		},
+	}, nil
+}
+
+func (grm *groupRepositoryMock) Memberships(_ context.Context, memberID string, offset, limit uint64, m groups.Metadata) (groups.GroupPage, error) {
+	grm.mu.Lock()
+	defer grm.mu.Unlock()
+
+	var items []groups.Group
+	for id := range grm.memberships[memberID] {
+		g, ok := grm.groups[id]
+		if !ok {
+			// Membership of a deleted group.
+			g = groups.Group{ID: id}
+		}
+		items = append(items, g)
+	}
+	return groups.GroupPage{
+		Groups: items,
+		PageMetadata: groups.PageMetadata{
+			Offset: offset,
+			Limit:  limit,
+			Total:  uint64(len(items)),
+		},
+	}, nil
+}
+
+func (grm *groupRepositoryMock) Members(_ context.Context, groupID string, offset, limit uint64, m groups.Metadata) (groups.MemberPage, error) {
+	grm.mu.Lock()
+	defer grm.mu.Unlock()
+
+	var ids []string
+	for memberID := range grm.members[groupID] {
+		ids = append(ids, memberID)
+	}
+	sort.Strings(ids)
+
+	total := uint64(len(ids))
+	end := offset + limit
+	if end > total {
+		end = total
+	}
+	items := []groups.Member{}
+	for i := offset; i < end; i++ {
+		items = append(items, ids[i])
+	}
+	return groups.MemberPage{
+		Members: items,
+		PageMetadata: groups.PageMetadata{
+			Offset: offset,
+			Limit:  limit,
+			Total:  total,
+		},
+	}, nil
+}
+
+func (grm *groupRepositoryMock) Assign(_ context.Context, memberID, groupID string) error {
+	grm.mu.Lock()
+	defer grm.mu.Unlock()
+
+	if _, ok := grm.groups[groupID]; !ok {
+		return groups.ErrNotFound
+	}
+	if _, ok := grm.memberships[memberID]; !ok {
+		grm.memberships[memberID] = make(map[string]bool)
+	}
+	grm.memberships[memberID][groupID] = true
+	if _, ok := grm.members[groupID]; !ok {
+		grm.members[groupID] = make(map[string]bool)
+	}
+	grm.members[groupID][memberID] = true
+	return nil
+}
+
+func (grm *groupRepositoryMock) Unassign(_ context.Context, memberID, groupID string) error {
+	grm.mu.Lock()
+	defer grm.mu.Unlock()
+
+	if !grm.memberships[memberID][groupID] {
+		return groups.ErrNotFound
+	}
+	delete(grm.memberships[memberID], groupID)
+	delete(grm.members[groupID], memberID)
+	if len(grm.members[groupID]) == 0 {
+		delete(grm.members, groupID)
+	}
+	return nil
+}
+
+// scanMembers returns the members of the group by scanning every
+// membership. It is the reference the members index is checked against.
+func (grm *groupRepositoryMock) scanMembers(groupID string) []string {
+	grm.mu.Lock()
+	defer grm.mu.Unlock()
+
+	var ids []string
+	for memberID, gs := range grm.memberships {
+		if gs[groupID] {
+			ids = append(ids, memberID)
+		}
+	}
+	return ids
+}
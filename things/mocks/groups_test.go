@@ -0,0 +1,86 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package mocks
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/mainflux/mainflux/internal/groups"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newGroupFixture(groupsNum, membersNum int) (*groupRepositoryMock, []string) {
+	grm := NewGroupRepository().(*groupRepositoryMock)
+	var gids []string
+	for i := 0; i < groupsNum; i++ {
+		g, _ := grm.Save(context.Background(), groups.Group{ID: fmt.Sprintf("group-%d", i)})
+		gids = append(gids, g.ID)
+	}
+	for i := 0; i < membersNum; i++ {
+		grm.Assign(context.Background(), fmt.Sprintf("thing-%d", i), gids[i%groupsNum])
+	}
+	return grm, gids
+}
+
+func memberIDs(mp groups.MemberPage) []string {
+	var ids []string
+	for _, m := range mp.Members {
+		ids = append(ids, m.(string))
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func TestMembersIndex(t *testing.T) {
+	grm, gids := newGroupFixture(5, 50)
+
+	// Reassign and remove some of the members, and delete a group, so
+	// that the index has to follow every kind of membership change.
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 100; i++ {
+		memberID := fmt.Sprintf("thing-%d", r.Intn(50))
+		groupID := gids[r.Intn(len(gids))]
+		switch r.Intn(2) {
+		case 0:
+			err := grm.Assign(context.Background(), memberID, groupID)
+			require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+		default:
+			grm.Unassign(context.Background(), memberID, groupID)
+		}
+	}
+	err := grm.Delete(context.Background(), gids[0])
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+
+	for _, gid := range append(gids, "non-existing") {
+		mp, err := grm.Members(context.Background(), gid, 0, 100, nil)
+		require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", gid, err))
+
+		expected := grm.scanMembers(gid)
+		sort.Strings(expected)
+		actual := memberIDs(mp)
+		assert.Equal(t, expected, actual, fmt.Sprintf("%s: expected members %v got %v", gid, expected, actual))
+		assert.Equal(t, uint64(len(expected)), mp.Total, fmt.Sprintf("%s: expected total %d got %d", gid, len(expected), mp.Total))
+	}
+}
+
+func BenchmarkMembers(b *testing.B) {
+	grm, gids := newGroupFixture(1000, 100000)
+
+	b.Run("index", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			grm.Members(context.Background(), gids[i%len(gids)], 0, 100, nil)
+		}
+	})
+
+	b.Run("scan", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			grm.scanMembers(gids[i%len(gids)])
+		}
+	})
+}
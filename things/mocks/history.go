@@ -0,0 +1,68 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package mocks
+
+import (
+	"context"
+	"sync"
+
+	"github.com/mainflux/mainflux/things"
+)
+
+var _ things.ConnectionEventRepository = (*connectionEventRepositoryMock)(nil)
+
+type connectionEventRepositoryMock struct {
+	mu     sync.Mutex
+	events []things.ConnectionEvent
+}
+
+// NewConnectionEventRepository creates in-memory connection history.
+func NewConnectionEventRepository() things.ConnectionEventRepository {
+	return &connectionEventRepositoryMock{}
+}
+
+func (erm *connectionEventRepositoryMock) Save(_ context.Context, events ...things.ConnectionEvent) error {
+	erm.mu.Lock()
+	defer erm.mu.Unlock()
+
+	erm.events = append(erm.events, events...)
+	return nil
+}
+
+func (erm *connectionEventRepositoryMock) RetrieveByThing(_ context.Context, owner, thingID string, offset, limit uint64) (things.ConnectionEventsPage, error) {
+	return erm.retrieve(offset, limit, func(e things.ConnectionEvent) bool {
+		return e.Owner == owner && e.ThingID == thingID
+	}), nil
+}
+
+func (erm *connectionEventRepositoryMock) RetrieveByChannel(_ context.Context, owner, chanID string, offset, limit uint64) (things.ConnectionEventsPage, error) {
+	return erm.retrieve(offset, limit, func(e things.ConnectionEvent) bool {
+		return e.Owner == owner && e.ChannelID == chanID
+	}), nil
+}
+
+// retrieve returns the page of the matching events. The events are kept
+// in the order they were saved, which is their chronological order.
+func (erm *connectionEventRepositoryMock) retrieve(offset, limit uint64, match func(things.ConnectionEvent) bool) things.ConnectionEventsPage {
+	erm.mu.Lock()
+	defer erm.mu.Unlock()
+
+	events := []things.ConnectionEvent{}
+	for _, e := range erm.events {
+		if match(e) {
+			events = append(events, e)
+		}
+	}
+
+	total := uint64(len(events))
+	start, end := pageRange(total, offset, limit)
+	return things.ConnectionEventsPage{
+		Events: events[start:end],
+		PageMetadata: things.PageMetadata{
+			Total:  total,
+			Offset: offset,
+			Limit:  limit,
+		},
+	}
+}
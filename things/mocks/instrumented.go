@@ -0,0 +1,197 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package mocks
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/mainflux/mainflux/things"
+)
+
+// Recorder records the calls of the repository methods and their duration.
+type Recorder interface {
+	// Record records a call of the method which took the given time.
+	Record(method string, d time.Duration)
+}
+
+var _ Recorder = (*CallRecorder)(nil)
+
+// CallRecorder is the recorder keeping the calls in memory.
+type CallRecorder struct {
+	mu        sync.Mutex
+	durations map[string][]time.Duration
+}
+
+// NewCallRecorder creates the recorder with no calls recorded.
+func NewCallRecorder() *CallRecorder {
+	return &CallRecorder{
+		durations: make(map[string][]time.Duration),
+	}
+}
+
+// Record records the call of the method.
+func (cr *CallRecorder) Record(method string, d time.Duration) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	cr.durations[method] = append(cr.durations[method], d)
+}
+
+// Count returns the number of recorded calls of the method.
+func (cr *CallRecorder) Count(method string) int {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	return len(cr.durations[method])
+}
+
+// Durations returns the durations of the recorded calls of the method, in
+// the order the calls returned.
+func (cr *CallRecorder) Durations(method string) []time.Duration {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	return append([]time.Duration(nil), cr.durations[method]...)
+}
+
+var _ things.ThingRepository = (*instrumentedThingRepository)(nil)
+
+type instrumentedThingRepository struct {
+	repo     things.ThingRepository
+	recorder Recorder
+}
+
+// NewInstrumentedRepo returns the thing repository recording each call of
+// the wrapped repository and its duration, keyed by the method name, such
+// as "RetrieveByID". It's meant for tests and load tests, unlike the
+// Prometheus metrics middleware of the service.
+func NewInstrumentedRepo(next things.ThingRepository, recorder Recorder) things.ThingRepository {
+	return instrumentedThingRepository{
+		repo:     next,
+		recorder: recorder,
+	}
+}
+
+func (irm instrumentedThingRepository) record(method string, begin time.Time) {
+	irm.recorder.Record(method, time.Since(begin))
+}
+
+func (irm instrumentedThingRepository) Save(ctx context.Context, ths ...things.Thing) ([]things.Thing, error) {
+	defer irm.record("Save", time.Now())
+	return irm.repo.Save(ctx, ths...)
+}
+
+func (irm instrumentedThingRepository) Update(ctx context.Context, th things.Thing) error {
+	defer irm.record("Update", time.Now())
+	return irm.repo.Update(ctx, th)
+}
+
+func (irm instrumentedThingRepository) UpdateKey(ctx context.Context, owner, id, key string) error {
+	defer irm.record("UpdateKey", time.Now())
+	return irm.repo.UpdateKey(ctx, owner, id, key)
+}
+
+func (irm instrumentedThingRepository) UpdateMetadata(ctx context.Context, owner, id string, md things.Metadata) error {
+	defer irm.record("UpdateMetadata", time.Now())
+	return irm.repo.UpdateMetadata(ctx, owner, id, md)
+}
+
+func (irm instrumentedThingRepository) RetrieveByID(ctx context.Context, owner, id string) (things.Thing, error) {
+	defer irm.record("RetrieveByID", time.Now())
+	return irm.repo.RetrieveByID(ctx, owner, id)
+}
+
+func (irm instrumentedThingRepository) RetrieveByIDsMap(ctx context.Context, ids []string) (map[string]things.Thing, error) {
+	defer irm.record("RetrieveByIDsMap", time.Now())
+	return irm.repo.RetrieveByIDsMap(ctx, ids)
+}
+
+func (irm instrumentedThingRepository) RetrieveByIDs(ctx context.Context, ids []string) ([]things.Thing, error) {
+	defer irm.record("RetrieveByIDs", time.Now())
+	return irm.repo.RetrieveByIDs(ctx, ids)
+}
+
+func (irm instrumentedThingRepository) RetrieveByGroupIDs(ctx context.Context, owner string, groupIDs []string, pm things.PageMetadata) (things.Page, error) {
+	defer irm.record("RetrieveByGroupIDs", time.Now())
+	return irm.repo.RetrieveByGroupIDs(ctx, owner, groupIDs, pm)
+}
+
+func (irm instrumentedThingRepository) RetrieveCompactByGroupIDs(ctx context.Context, owner string, groupIDs []string, pm things.PageMetadata) (things.CompactPage, error) {
+	defer irm.record("RetrieveCompactByGroupIDs", time.Now())
+	return irm.repo.RetrieveCompactByGroupIDs(ctx, owner, groupIDs, pm)
+}
+
+func (irm instrumentedThingRepository) RetrieveByMetadata(ctx context.Context, owner string, groupIDs []string, filter things.Metadata, pm things.PageMetadata) (things.Page, error) {
+	defer irm.record("RetrieveByMetadata", time.Now())
+	return irm.repo.RetrieveByMetadata(ctx, owner, groupIDs, filter, pm)
+}
+
+func (irm instrumentedThingRepository) Search(ctx context.Context, groupIDs []string, query string, pm things.PageMetadata) (things.Page, error) {
+	defer irm.record("Search", time.Now())
+	return irm.repo.Search(ctx, groupIDs, query, pm)
+}
+
+func (irm instrumentedThingRepository) CountByGroupIDs(ctx context.Context, groupIDs []string) (uint64, error) {
+	defer irm.record("CountByGroupIDs", time.Now())
+	return irm.repo.CountByGroupIDs(ctx, groupIDs)
+}
+
+func (irm instrumentedThingRepository) CountAll(ctx context.Context) (uint64, error) {
+	defer irm.record("CountAll", time.Now())
+	return irm.repo.CountAll(ctx)
+}
+
+func (irm instrumentedThingRepository) MetadataFacet(ctx context.Context, groupIDs []string, key string) (map[string]uint64, error) {
+	defer irm.record("MetadataFacet", time.Now())
+	return irm.repo.MetadataFacet(ctx, groupIDs, key)
+}
+
+func (irm instrumentedThingRepository) ChangeStatus(ctx context.Context, id, status string) error {
+	defer irm.record("ChangeStatus", time.Now())
+	return irm.repo.ChangeStatus(ctx, id, status)
+}
+
+func (irm instrumentedThingRepository) SaveTemporaryKey(ctx context.Context, owner, id, key string, expiresAt time.Time) error {
+	defer irm.record("SaveTemporaryKey", time.Now())
+	return irm.repo.SaveTemporaryKey(ctx, owner, id, key, expiresAt)
+}
+
+func (irm instrumentedThingRepository) RemoveExpiredKeys(ctx context.Context, now time.Time) ([]string, error) {
+	defer irm.record("RemoveExpiredKeys", time.Now())
+	return irm.repo.RemoveExpiredKeys(ctx, now)
+}
+
+func (irm instrumentedThingRepository) RetrieveByKey(ctx context.Context, key string) (string, error) {
+	defer irm.record("RetrieveByKey", time.Now())
+	return irm.repo.RetrieveByKey(ctx, key)
+}
+
+func (irm instrumentedThingRepository) RetrieveKeyExpiry(ctx context.Context, key string) (time.Time, error) {
+	defer irm.record("RetrieveKeyExpiry", time.Now())
+	return irm.repo.RetrieveKeyExpiry(ctx, key)
+}
+
+func (irm instrumentedThingRepository) RetrieveAll(ctx context.Context, owner string, pm things.PageMetadata) (things.Page, error) {
+	defer irm.record("RetrieveAll", time.Now())
+	return irm.repo.RetrieveAll(ctx, owner, pm)
+}
+
+// RetrieveAllStream records the time it takes to start streaming, as the
+// things are streamed after it returns.
+func (irm instrumentedThingRepository) RetrieveAllStream(ctx context.Context, batchSize int) (<-chan things.Thing, <-chan error) {
+	defer irm.record("RetrieveAllStream", time.Now())
+	return irm.repo.RetrieveAllStream(ctx, batchSize)
+}
+
+func (irm instrumentedThingRepository) RetrieveByChannel(ctx context.Context, owner, channel string, connected bool, pm things.PageMetadata) (things.Page, error) {
+	defer irm.record("RetrieveByChannel", time.Now())
+	return irm.repo.RetrieveByChannel(ctx, owner, channel, connected, pm)
+}
+
+func (irm instrumentedThingRepository) Remove(ctx context.Context, owner, id string) error {
+	defer irm.record("Remove", time.Now())
+	return irm.repo.Remove(ctx, owner, id)
+}
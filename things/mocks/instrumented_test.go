@@ -0,0 +1,70 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package mocks_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/mainflux/mainflux/pkg/uuid"
+	"github.com/mainflux/mainflux/things"
+	"github.com/mainflux/mainflux/things/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInstrumentedRepo(t *testing.T) {
+	token, email := "token", "user@example.com"
+	conns := make(chan mocks.Connection)
+	recorder := mocks.NewCallRecorder()
+	thingsRepo := mocks.NewInstrumentedRepo(mocks.NewThingRepository(conns), recorder)
+	channelsRepo := mocks.NewChannelRepository(thingsRepo, conns)
+	svc := things.New(mocks.NewAuthService(map[string]string{token: email}), thingsRepo, channelsRepo, nil, mocks.NewChannelCache(), mocks.NewThingCache(), uuid.NewMock())
+
+	ths, err := svc.CreateThings(context.Background(), token, things.Thing{Name: "a", Key: "key-a"}, things.Thing{Name: "b", Key: "key-b"})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	for i := 0; i < 3; i++ {
+		_, err := svc.ViewThing(context.Background(), token, ths[0].ID)
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+		_, err = svc.Identify(context.Background(), ths[0].Key)
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	}
+	_, err = svc.Identify(context.Background(), ths[1].Key)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+
+	cases := []struct {
+		desc   string
+		method string
+		count  int
+	}{
+		{
+			desc:   "count saves",
+			method: "Save",
+			count:  1,
+		},
+		{
+			desc:   "count uncached retrievals by identifier",
+			method: "RetrieveByID",
+			count:  3,
+		},
+		{
+			desc:   "count retrievals by key missing the cache",
+			method: "RetrieveByKey",
+			count:  2,
+		},
+		{
+			desc:   "count uncalled method",
+			method: "Remove",
+			count:  0,
+		},
+	}
+
+	for _, tc := range cases {
+		count := recorder.Count(tc.method)
+		assert.Equal(t, tc.count, count, fmt.Sprintf("%s: expected %d calls got %d", tc.desc, tc.count, count))
+		durations := recorder.Durations(tc.method)
+		assert.Len(t, durations, tc.count, fmt.Sprintf("%s: expected %d durations got %d", tc.desc, tc.count, len(durations)))
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package mocks
+
+import "container/list"
+
+// lru tracks the order in which cache entries were used, so that the least
+// recently used entry can be evicted once the cache is full. A nil lru
+// tracks nothing and never evicts.
+type lru struct {
+	size  int
+	order *list.List
+	elems map[interface{}]*list.Element
+}
+
+func newLRU(size int) *lru {
+	if size <= 0 {
+		return nil
+	}
+	return &lru{
+		size:  size,
+		order: list.New(),
+		elems: make(map[interface{}]*list.Element),
+	}
+}
+
+// touch marks the entry as the most recently used one, adding it if it's not
+// tracked yet, and returns the evicted entry if the cache was full.
+func (l *lru) touch(key interface{}) (interface{}, bool) {
+	if l == nil {
+		return nil, false
+	}
+	if e, ok := l.elems[key]; ok {
+		l.order.MoveToFront(e)
+		return nil, false
+	}
+
+	l.elems[key] = l.order.PushFront(key)
+	if l.order.Len() <= l.size {
+		return nil, false
+	}
+
+	oldest := l.order.Back()
+	l.order.Remove(oldest)
+	delete(l.elems, oldest.Value)
+	return oldest.Value, true
+}
+
+func (l *lru) remove(key interface{}) {
+	if l == nil {
+		return
+	}
+	if e, ok := l.elems[key]; ok {
+		l.order.Remove(e)
+		delete(l.elems, key)
+	}
+}
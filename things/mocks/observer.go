@@ -0,0 +1,56 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package mocks
+
+import (
+	"context"
+	"sync"
+
+	"github.com/mainflux/mainflux/things"
+)
+
+// ConnectionEvent is the connection change the observer was notified of.
+type ConnectionEvent struct {
+	things.Connection
+	Connected bool
+}
+
+var _ things.ConnectionObserver = (*ConnectionObserver)(nil)
+
+// ConnectionObserver records the connection changes it's notified of.
+type ConnectionObserver struct {
+	mu     sync.Mutex
+	events []ConnectionEvent
+}
+
+// NewConnectionObserver creates the connection observer recording the
+// connection changes in order.
+func NewConnectionObserver() *ConnectionObserver {
+	return &ConnectionObserver{}
+}
+
+// OnConnect records the connection.
+func (co *ConnectionObserver) OnConnect(_ context.Context, conn things.Connection) {
+	co.record(ConnectionEvent{Connection: conn, Connected: true})
+}
+
+// OnDisconnect records the disconnection.
+func (co *ConnectionObserver) OnDisconnect(_ context.Context, conn things.Connection) {
+	co.record(ConnectionEvent{Connection: conn, Connected: false})
+}
+
+// Events returns the recorded connection changes.
+func (co *ConnectionObserver) Events() []ConnectionEvent {
+	co.mu.Lock()
+	defer co.mu.Unlock()
+
+	return append([]ConnectionEvent(nil), co.events...)
+}
+
+func (co *ConnectionObserver) record(e ConnectionEvent) {
+	co.mu.Lock()
+	defer co.mu.Unlock()
+
+	co.events = append(co.events, e)
+}
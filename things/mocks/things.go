@@ -5,12 +5,18 @@ package mocks
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"math/rand"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/mainflux/mainflux"
+	"github.com/mainflux/mainflux/internal/groups"
+	"github.com/mainflux/mainflux/pkg/errors"
 	"github.com/mainflux/mainflux/things"
 )
 
@@ -19,28 +25,68 @@ var _ things.ThingRepository = (*thingRepositoryMock)(nil)
 type thingRepositoryMock struct {
 	mu      sync.Mutex
 	counter uint64
+	ids     mainflux.IDProvider
 	conns   chan Connection
 	tconns  map[string]map[string]things.Thing
+	connAt  map[string]map[string]time.Time
 	things  map[string]things.Thing
+	groups  groups.Repository
+	// expiries holds the expiry of the temporary keys.
+	expiries map[string]time.Time
+	now      func() time.Time
+	// onRemove disconnects the removed thing from the channels of the
+	// channel repository, if any.
+	onRemove func(owner, id string)
 }
 
 // NewThingRepository creates in-memory thing repository.
 func NewThingRepository(conns chan Connection) things.ThingRepository {
+	return NewBatchedThingRepository(conns, 1)
+}
+
+// NewBatchedThingRepository creates in-memory thing repository which
+// applies up to batchSize connection events that are already waiting to
+// be received at once, instead of one by one.
+func NewBatchedThingRepository(conns chan Connection, batchSize int) things.ThingRepository {
+	if batchSize < 1 {
+		batchSize = 1
+	}
 	repo := &thingRepositoryMock{
-		conns:  conns,
-		things: make(map[string]things.Thing),
-		tconns: make(map[string]map[string]things.Thing),
-	}
-	go func(conns chan Connection, repo *thingRepositoryMock) {
-		for conn := range conns {
-			if !conn.connected {
-				repo.disconnect(conn)
-				continue
-			}
-			repo.connect(conn)
-		}
-	}(conns, repo)
+		ids:      &counterProvider{},
+		conns:    conns,
+		things:   make(map[string]things.Thing),
+		tconns:   make(map[string]map[string]things.Thing),
+		connAt:   make(map[string]map[string]time.Time),
+		expiries: make(map[string]time.Time),
+		now:      time.Now,
+	}
+	go repo.sync(conns, batchSize)
+
+	return repo
+}
+
+// NewThingRepositoryWithGroups creates in-memory thing repository which
+// resolves the things of groups using the provided group repository.
+func NewThingRepositoryWithGroups(conns chan Connection, groups groups.Repository) things.ThingRepository {
+	repo := NewThingRepository(conns).(*thingRepositoryMock)
+	repo.groups = groups
+	return repo
+}
 
+// NewThingRepositoryWithClock creates in-memory thing repository which
+// checks the expiry of the temporary keys against the provided clock.
+func NewThingRepositoryWithClock(conns chan Connection, now func() time.Time) things.ThingRepository {
+	repo := NewThingRepository(conns).(*thingRepositoryMock)
+	repo.now = now
+	return repo
+}
+
+// NewThingRepositoryWithIDs creates in-memory thing repository which
+// identifies the saved things using the provided ID provider, instead of
+// sequential numbers.
+func NewThingRepositoryWithIDs(conns chan Connection, ids mainflux.IDProvider) things.ThingRepository {
+	repo := NewThingRepository(conns).(*thingRepositoryMock)
+	repo.ids = ids
 	return repo
 }
 
@@ -48,19 +94,48 @@ func (trm *thingRepositoryMock) Save(_ context.Context, ths ...things.Thing) ([]
 	trm.mu.Lock()
 	defer trm.mu.Unlock()
 
-	for i := range ths {
-		for _, th := range trm.things {
-			if th.Key == ths[i].Key {
+	keys := make(map[string]bool)
+	for _, th := range trm.things {
+		for _, k := range thingKeys(th) {
+			keys[k] = true
+		}
+	}
+	for _, th := range ths {
+		for _, k := range thingKeys(th) {
+			if keys[k] {
 				return []things.Thing{}, things.ErrConflict
 			}
+			keys[k] = true
+		}
+	}
+
+	// Identify every thing before storing any of them, so that a failure
+	// leaves the repository as it was, like the rolled back transaction.
+	saved := make([]things.Thing, len(ths))
+	ids := make(map[string]bool)
+	for i, th := range ths {
+		id, err := trm.ids.ID()
+		if err != nil {
+			return []things.Thing{}, err
+		}
+		k := key(th.Owner, id)
+		if _, ok := trm.things[k]; ok || ids[k] {
+			return []things.Thing{}, things.ErrConflict
+		}
+		ids[k] = true
+		th.ID = id
+		if th.Status == "" {
+			th.Status = things.EnabledStatus
 		}
+		saved[i] = th
+	}
 
+	for _, th := range saved {
 		trm.counter++
-		ths[i].ID = strconv.FormatUint(trm.counter, 10)
-		trm.things[key(ths[i].Owner, ths[i].ID)] = ths[i]
+		trm.things[key(th.Owner, th.ID)] = th
 	}
 
-	return ths, nil
+	return saved, nil
 }
 
 func (trm *thingRepositoryMock) Update(_ context.Context, thing things.Thing) error {
@@ -69,22 +144,55 @@ func (trm *thingRepositoryMock) Update(_ context.Context, thing things.Thing) er
 
 	dbKey := key(thing.Owner, thing.ID)
 
-	if _, ok := trm.things[dbKey]; !ok {
+	th, ok := trm.things[dbKey]
+	if !ok {
 		return things.ErrNotFound
 	}
 
+	thing.Status = th.Status
 	trm.things[dbKey] = thing
 
 	return nil
 }
 
+func (trm *thingRepositoryMock) UpdateMetadata(_ context.Context, owner, id string, md things.Metadata) error {
+	trm.mu.Lock()
+	defer trm.mu.Unlock()
+
+	dbKey := key(owner, id)
+
+	th, ok := trm.things[dbKey]
+	if !ok {
+		return things.ErrNotFound
+	}
+
+	// Copy the metadata, which is shared with the things returned before.
+	merged := make(things.Metadata, len(th.Metadata)+len(md))
+	for k, v := range th.Metadata {
+		merged[k] = v
+	}
+	for k, v := range md {
+		if v == nil {
+			delete(merged, k)
+			continue
+		}
+		merged[k] = v
+	}
+	th.Metadata = merged
+	trm.things[dbKey] = th
+
+	return nil
+}
+
 func (trm *thingRepositoryMock) UpdateKey(_ context.Context, owner, id, val string) error {
 	trm.mu.Lock()
 	defer trm.mu.Unlock()
 
 	for _, th := range trm.things {
-		if th.Key == val {
-			return things.ErrConflict
+		for _, k := range thingKeys(th) {
+			if k == val {
+				return things.ErrConflict
+			}
 		}
 	}
 
@@ -112,6 +220,25 @@ func (trm *thingRepositoryMock) RetrieveByID(_ context.Context, owner, id string
 	return things.Thing{}, things.ErrNotFound
 }
 
+func (trm *thingRepositoryMock) RetrieveByIDsMap(_ context.Context, ids []string) (map[string]things.Thing, error) {
+	trm.mu.Lock()
+	defer trm.mu.Unlock()
+
+	wanted := make(map[string]bool)
+	for _, id := range ids {
+		wanted[id] = true
+	}
+
+	ths := make(map[string]things.Thing)
+	for _, th := range trm.things {
+		if wanted[th.ID] {
+			ths[th.ID] = th
+		}
+	}
+
+	return ths, nil
+}
+
 func (trm *thingRepositoryMock) RetrieveAll(_ context.Context, owner string, pm things.PageMetadata) (things.Page, error) {
 	trm.mu.Lock()
 	defer trm.mu.Unlock()
@@ -122,86 +249,230 @@ func (trm *thingRepositoryMock) RetrieveAll(_ context.Context, owner string, pm
 		return things.Page{}, nil
 	}
 
-	first := uint64(pm.Offset) + 1
-	last := first + uint64(pm.Limit)
+	connected := make(map[string]uint64)
+	for _, ths := range trm.tconns {
+		for thID := range ths {
+			connected[thID]++
+		}
+	}
 
 	// This obscure way to examine map keys is enforced by the key structure
 	// itself (see mocks/commons.go).
 	prefix := fmt.Sprintf("%s-", owner)
+	if len(pm.AnyOf) > 0 {
+		return trm.retrieveAnyOf(prefix, connected, pm), nil
+	}
+
 	for k, v := range trm.things {
-		id, _ := strconv.ParseUint(v.ID, 10, 64)
-		if strings.HasPrefix(k, prefix) && id >= first && id < last {
+		if pm.ConnectedOnly && connected[v.ID] == 0 {
+			continue
+		}
+		if strings.HasPrefix(k, prefix) && hasMetadataKeys(v.Metadata, pm) {
 			items = append(items, v)
 		}
 	}
 
-	sort.SliceStable(items, func(i, j int) bool {
-		return items[i].ID < items[j].ID
-	})
+	// Page over the sorted things rather than by their identifiers, which
+	// aren't sequential numbers unless generated by the mock.
+	sortThings(pm, items)
+	total := uint64(len(items))
+	start, end := pageRange(total, pm.Offset, pm.Limit)
+	items = items[start:end]
+	if pm.WithConnections {
+		setConnections(items, connected)
+	}
 
 	page := things.Page{
 		Things: items,
 		PageMetadata: things.PageMetadata{
-			Total:  trm.counter,
+			Total:  total,
 			Offset: pm.Offset,
 			Limit:  pm.Limit,
+			Order:  pm.Order,
+			Dir:    pm.Dir,
 		},
 	}
 
 	return page, nil
 }
 
-func (trm *thingRepositoryMock) RetrieveByChannel(_ context.Context, owner, chanID string, offset, limit uint64, connected bool) (things.Page, error) {
+func (trm *thingRepositoryMock) RetrieveAllStream(ctx context.Context, batchSize int) (<-chan things.Thing, <-chan error) {
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	ths := make(chan things.Thing)
+	errs := make(chan error, 1)
+	go func() {
+		defer close(errs)
+		defer close(ths)
+
+		var last string
+		for {
+			batch := trm.batchAfter(last, batchSize)
+			for _, th := range batch {
+				select {
+				case ths <- th:
+				case <-ctx.Done():
+					errs <- ctx.Err()
+					return
+				}
+			}
+			if len(batch) < batchSize {
+				return
+			}
+			last = key(batch[len(batch)-1].Owner, batch[len(batch)-1].ID)
+		}
+	}()
+	return ths, errs
+}
+
+// batchAfter returns up to n things whose keys follow the given key, so
+// that the streamed things are copied out of the map a batch at a time.
+func (trm *thingRepositoryMock) batchAfter(last string, n int) []things.Thing {
+	trm.mu.Lock()
+	defer trm.mu.Unlock()
+
+	var keys []string
+	for k := range trm.things {
+		if k > last {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	if len(keys) > n {
+		keys = keys[:n]
+	}
+
+	batch := make([]things.Thing, len(keys))
+	for i, k := range keys {
+		batch[i] = trm.things[k]
+	}
+	return batch
+}
+
+// retrieveAnyOf returns the page of the owner's things matching the union
+// of filters, paginated over the matching things.
+func (trm *thingRepositoryMock) retrieveAnyOf(prefix string, connected map[string]uint64, pm things.PageMetadata) things.Page {
+	items := make([]things.Thing, 0)
+	for k, v := range trm.things {
+		if pm.ConnectedOnly && connected[v.ID] == 0 {
+			continue
+		}
+		if strings.HasPrefix(k, prefix) && hasMetadataKeys(v.Metadata, pm) && matchesAny(v.Name, v.Metadata, pm.AnyOf) {
+			items = append(items, v)
+		}
+	}
+
+	sortThings(pm, items)
+
+	total := uint64(len(items))
+	start, end := pageRange(total, pm.Offset, pm.Limit)
+	if pm.WithConnections {
+		setConnections(items[start:end], connected)
+	}
+
+	return things.Page{
+		Things: items[start:end],
+		PageMetadata: things.PageMetadata{
+			Total:  total,
+			Offset: pm.Offset,
+			Limit:  pm.Limit,
+			Order:  pm.Order,
+			Dir:    pm.Dir,
+		},
+	}
+}
+
+// retrieveByConnectedAt returns the page of things connected to the channel
+// ordered by the connection time.
+func (trm *thingRepositoryMock) retrieveByConnectedAt(chanID string, pm things.PageMetadata) things.Page {
+	ths := make([]things.Thing, 0, len(trm.tconns[chanID]))
+	for _, th := range trm.tconns[chanID] {
+		ths = append(ths, th)
+	}
+
+	at := trm.connAt[chanID]
+	sort.SliceStable(ths, func(i, j int) bool {
+		ti, tj := at[ths[i].ID], at[ths[j].ID]
+		if ti.Equal(tj) {
+			return ths[i].ID < ths[j].ID
+		}
+		if pm.Dir == "asc" {
+			return ti.Before(tj)
+		}
+		return ti.After(tj)
+	})
+
+	total := uint64(len(ths))
+	first, last := pm.Offset, pm.Offset+pm.Limit
+	if first > total {
+		first = total
+	}
+	if last > total {
+		last = total
+	}
+
+	return things.Page{
+		Things: ths[first:last],
+		PageMetadata: things.PageMetadata{
+			Total:  total,
+			Offset: pm.Offset,
+			Limit:  pm.Limit,
+			Order:  pm.Order,
+			Dir:    pm.Dir,
+		},
+	}
+}
+
+// setConnections sets the connection status of the things from the
+// number of channels each thing is connected to.
+func setConnections(ths []things.Thing, connected map[string]uint64) {
+	for i := range ths {
+		ths[i].Connections = connected[ths[i].ID]
+		ths[i].Connected = ths[i].Connections > 0
+	}
+}
+
+func (trm *thingRepositoryMock) RetrieveByChannel(_ context.Context, owner, chanID string, connected bool, pm things.PageMetadata) (things.Page, error) {
 	trm.mu.Lock()
 	defer trm.mu.Unlock()
 
 	ths := make([]things.Thing, 0)
+	offset, limit := pm.Offset, pm.Limit
 
 	if offset < 0 || limit <= 0 {
 		return things.Page{}, nil
 	}
 
-	first := uint64(offset) + 1
-	last := first + uint64(limit)
+	if connected && pm.Order == things.OrderConnectedAt {
+		return trm.retrieveByConnectedAt(chanID, pm), nil
+	}
 
-	// Append connected or not connected channels
-	switch connected {
-	case true:
-		for _, co := range trm.tconns[chanID] {
-			id, _ := strconv.ParseUint(co.ID, 10, 64)
-			if id >= first && id < last {
-				ths = append(ths, co)
-			}
+	// Things of the owner which are connected or not connected to the
+	// channel, depending on the requested mode.
+	conns := trm.tconns[chanID]
+	for k, th := range trm.things {
+		if !strings.HasPrefix(k, fmt.Sprintf("%s-", owner)) {
+			continue
 		}
-	default:
-		for _, th := range trm.things {
-			conn := false
-			id, _ := strconv.ParseUint(th.ID, 10, 64)
-			if id >= first && id < last {
-				for _, co := range trm.tconns[chanID] {
-					if th.ID == co.ID {
-						conn = true
-					}
-				}
-
-				// Append if not found in connections list
-				if !conn {
-					ths = append(ths, th)
-				}
-			}
+		if _, ok := conns[th.ID]; ok == connected {
+			ths = append(ths, th)
 		}
 	}
 
-	sort.SliceStable(ths, func(i, j int) bool {
-		return ths[i].ID < ths[j].ID
-	})
+	sortThings(pm, ths)
+
+	total := uint64(len(ths))
+	start, end := pageRange(total, offset, limit)
 
 	page := things.Page{
-		Things: ths,
+		Things: ths[start:end],
 		PageMetadata: things.PageMetadata{
-			Total:  trm.counter,
+			Total:  total,
 			Offset: offset,
 			Limit:  limit,
+			Order:  pm.Order,
+			Dir:    pm.Dir,
 		},
 	}
 
@@ -210,17 +481,428 @@ func (trm *thingRepositoryMock) RetrieveByChannel(_ context.Context, owner, chan
 
 func (trm *thingRepositoryMock) Remove(_ context.Context, owner, id string) error {
 	trm.mu.Lock()
-	defer trm.mu.Unlock()
+	_, ok := trm.things[key(owner, id)]
 	delete(trm.things, key(owner, id))
+	// Like the database, cascade the removal to the connections.
+	if ok {
+		for chanID := range trm.tconns {
+			trm.disconnect(Connection{chanID: chanID, thing: things.Thing{ID: id, Owner: owner}})
+		}
+	}
+	onRemove := trm.onRemove
+	trm.mu.Unlock()
+
+	// Notify the channel repository without holding the lock, since its
+	// disconnection events are applied under the lock.
+	if ok && onRemove != nil {
+		onRemove(owner, id)
+	}
 	return nil
 }
 
+func (trm *thingRepositoryMock) RetrieveByIDs(_ context.Context, ids []string) ([]things.Thing, error) {
+	trm.mu.Lock()
+	defer trm.mu.Unlock()
+
+	byID := make(map[string]things.Thing, len(trm.things))
+	for _, th := range trm.things {
+		byID[th.ID] = th
+	}
+
+	ths := []things.Thing{}
+	for _, id := range ids {
+		if th, ok := byID[id]; ok {
+			ths = append(ths, th)
+		}
+	}
+
+	return ths, nil
+}
+
+func (trm *thingRepositoryMock) RetrieveByGroupIDs(ctx context.Context, owner string, groupIDs []string, pm things.PageMetadata) (things.Page, error) {
+	members, err := trm.members(ctx, groupIDs)
+	if err != nil {
+		return things.Page{}, err
+	}
+
+	status, err := statusFilter(pm.Status)
+	if err != nil {
+		return things.Page{}, err
+	}
+
+	var thGroups map[string][]things.ThingGroup
+	if pm.WithGroups {
+		if thGroups, err = trm.thingGroups(ctx, groupIDs); err != nil {
+			return things.Page{}, err
+		}
+	}
+
+	trm.mu.Lock()
+	defer trm.mu.Unlock()
+
+	filter := []things.Filter{{Name: pm.Name, Metadata: pm.Metadata}}
+	var ths []things.Thing
+	for _, th := range trm.things {
+		if status != things.AllStatus && th.Status != status {
+			continue
+		}
+		if th.Owner == owner && members[th.ID] && matchesAny(th.Name, th.Metadata, filter) {
+			th.Groups = thGroups[th.ID]
+			ths = append(ths, th)
+		}
+	}
+	keyset := pm.Order == "name" && !pm.Sample
+	sort.SliceStable(ths, func(i, j int) bool {
+		if keyset && ths[i].Name != ths[j].Name {
+			return ths[i].Name < ths[j].Name
+		}
+		return idLess(ths[i].ID, ths[j].ID)
+	})
+
+	total := uint64(len(ths))
+	switch {
+	case pm.Sample:
+		ths = sample(ths, pm.Limit, pm.Seed)
+	case keyset && pm.Cursor != "":
+		name, id, err := things.DecodeCursor(pm.Cursor)
+		if err != nil {
+			return things.Page{}, errors.Wrap(things.ErrMalformedEntity, err)
+		}
+		start := sort.Search(len(ths), func(i int) bool {
+			return ths[i].Name > name || ths[i].Name == name && idLess(id, ths[i].ID)
+		})
+		ths = ths[start:]
+		if uint64(len(ths)) > pm.Limit {
+			ths = ths[:pm.Limit]
+		}
+	default:
+		start, end := pageRange(total, pm.Offset, pm.Limit)
+		ths = ths[start:end]
+	}
+
+	page := things.Page{
+		Things: ths,
+		PageMetadata: things.PageMetadata{
+			Total:    total,
+			Offset:   pm.Offset,
+			Limit:    pm.Limit,
+			Name:     pm.Name,
+			Order:    pm.Order,
+			Metadata: pm.Metadata,
+			Sample:   pm.Sample,
+			Seed:     pm.Seed,
+			Cursor:   pm.Cursor,
+			Status:   pm.Status,
+
+			WithGroups: pm.WithGroups,
+		},
+	}
+	if n := len(ths); keyset && n > 0 && uint64(n) == pm.Limit {
+		page.NextCursor = things.EncodeCursor(ths[n-1].Name, ths[n-1].ID)
+	}
+	return page, nil
+}
+
+// statusFilter returns the status of the listed things, or AllStatus.
+func statusFilter(status string) (string, error) {
+	switch status {
+	case "":
+		return things.EnabledStatus, nil
+	case things.EnabledStatus, things.DisabledStatus, things.AllStatus:
+		return status, nil
+	default:
+		return "", things.ErrMalformedEntity
+	}
+}
+
+func (trm *thingRepositoryMock) ChangeStatus(_ context.Context, id, status string) error {
+	if status != things.EnabledStatus && status != things.DisabledStatus {
+		return things.ErrMalformedEntity
+	}
+
+	trm.mu.Lock()
+	defer trm.mu.Unlock()
+
+	for k, th := range trm.things {
+		if th.ID == id {
+			th.Status = status
+			trm.things[k] = th
+			return nil
+		}
+	}
+
+	return things.ErrNotFound
+}
+
+// idLess orders the identifiers of the mock things numerically, unless
+// they aren't numbers.
+func idLess(a, b string) bool {
+	x, errx := strconv.ParseUint(a, 10, 64)
+	y, erry := strconv.ParseUint(b, 10, 64)
+	if errx != nil || erry != nil {
+		return a < b
+	}
+	return x < y
+}
+
+func (trm *thingRepositoryMock) CountByGroupIDs(ctx context.Context, groupIDs []string) (uint64, error) {
+	members, err := trm.members(ctx, groupIDs)
+	if err != nil {
+		return 0, err
+	}
+
+	trm.mu.Lock()
+	defer trm.mu.Unlock()
+
+	// Count the stored things rather than the members, since the removed
+	// things may still be members of the groups.
+	var n uint64
+	for _, th := range trm.things {
+		if members[th.ID] {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (trm *thingRepositoryMock) CountAll(_ context.Context) (uint64, error) {
+	trm.mu.Lock()
+	defer trm.mu.Unlock()
+
+	return uint64(len(trm.things)), nil
+}
+
+func (trm *thingRepositoryMock) MetadataFacet(ctx context.Context, groupIDs []string, key string) (map[string]uint64, error) {
+	members, err := trm.members(ctx, groupIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	trm.mu.Lock()
+	defer trm.mu.Unlock()
+
+	facet := make(map[string]uint64)
+	for _, th := range trm.things {
+		if members[th.ID] {
+			facet[facetValue(th.Metadata[key])]++
+		}
+	}
+	return facet, nil
+}
+
+// facetValue returns the text of the metadata value, the way PostgreSQL
+// ->> operator does.
+func facetValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return things.NullFacet
+	case string:
+		return v
+	default:
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+}
+
+func (trm *thingRepositoryMock) RetrieveCompactByGroupIDs(ctx context.Context, owner string, groupIDs []string, pm things.PageMetadata) (things.CompactPage, error) {
+	page, err := trm.RetrieveByGroupIDs(ctx, owner, groupIDs, pm)
+	if err != nil {
+		return things.CompactPage{}, err
+	}
+
+	trm.mu.Lock()
+	defer trm.mu.Unlock()
+
+	cp := things.CompactPage{PageMetadata: page.PageMetadata}
+	for _, th := range page.Things {
+		connected := false
+		for _, ths := range trm.tconns {
+			if _, ok := ths[th.ID]; ok {
+				connected = true
+				break
+			}
+		}
+		cp.Things = append(cp.Things, things.CompactThing{ID: th.ID, Name: th.Name, Connected: connected})
+	}
+	return cp, nil
+}
+
+func (trm *thingRepositoryMock) RetrieveByMetadata(ctx context.Context, owner string, groupIDs []string, filter things.Metadata, pm things.PageMetadata) (things.Page, error) {
+	members, err := trm.members(ctx, groupIDs)
+	if err != nil {
+		return things.Page{}, err
+	}
+
+	trm.mu.Lock()
+	defer trm.mu.Unlock()
+
+	var ths []things.Thing
+	for _, th := range trm.things {
+		if th.Owner != owner || (len(groupIDs) > 0 && !members[th.ID]) {
+			continue
+		}
+		if containsMetadata(th.Metadata, filter) {
+			ths = append(ths, th)
+		}
+	}
+	sort.SliceStable(ths, func(i, j int) bool {
+		return idLess(ths[i].ID, ths[j].ID)
+	})
+
+	total := uint64(len(ths))
+	start, end := pageRange(total, pm.Offset, pm.Limit)
+
+	return things.Page{
+		Things: ths[start:end],
+		PageMetadata: things.PageMetadata{
+			Total:  total,
+			Offset: pm.Offset,
+			Limit:  pm.Limit,
+		},
+	}, nil
+}
+
+func (trm *thingRepositoryMock) Search(ctx context.Context, groupIDs []string, query string, pm things.PageMetadata) (things.Page, error) {
+	members, err := trm.members(ctx, groupIDs)
+	if err != nil {
+		return things.Page{}, err
+	}
+
+	trm.mu.Lock()
+	defer trm.mu.Unlock()
+
+	query = strings.ToLower(query)
+	var ths []things.Thing
+	for _, th := range trm.things {
+		if len(groupIDs) > 0 && !members[th.ID] {
+			continue
+		}
+		if matchesQuery(th, query) {
+			ths = append(ths, th)
+		}
+	}
+	sort.SliceStable(ths, func(i, j int) bool {
+		return idLess(ths[i].ID, ths[j].ID)
+	})
+
+	total := uint64(len(ths))
+	start, end := pageRange(total, pm.Offset, pm.Limit)
+
+	return things.Page{
+		Things: ths[start:end],
+		PageMetadata: things.PageMetadata{
+			Total:  total,
+			Offset: pm.Offset,
+			Limit:  pm.Limit,
+		},
+	}, nil
+}
+
+// matchesQuery reports whether the name or any string value of the
+// top-level metadata of the thing contains the lower case query.
+func matchesQuery(th things.Thing, query string) bool {
+	if strings.Contains(strings.ToLower(th.Name), query) {
+		return true
+	}
+	for _, v := range th.Metadata {
+		if s, ok := v.(string); ok && strings.Contains(strings.ToLower(s), query) {
+			return true
+		}
+	}
+	return false
+}
+
+// members returns the IDs of the things that are members of any of the
+// groups, resolved using the group repository, if any.
+func (trm *thingRepositoryMock) members(ctx context.Context, groupIDs []string) (map[string]bool, error) {
+	members := make(map[string]bool)
+	if trm.groups == nil {
+		return members, nil
+	}
+	for _, groupID := range groupIDs {
+		mp, err := trm.groups.Members(ctx, groupID, 0, ^uint64(0)>>1, nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range mp.Members {
+			if id, ok := m.(string); ok {
+				members[id] = true
+			}
+		}
+	}
+	return members, nil
+}
+
+// thingGroups returns the groups of the things that are members of any of
+// the groups, ordered by name, resolved using the group repository, if any.
+func (trm *thingRepositoryMock) thingGroups(ctx context.Context, groupIDs []string) (map[string][]things.ThingGroup, error) {
+	thGroups := make(map[string][]things.ThingGroup)
+	if trm.groups == nil {
+		return thGroups, nil
+	}
+	for _, groupID := range groupIDs {
+		g, err := trm.groups.RetrieveByID(ctx, groupID)
+		if errors.Contains(err, groups.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		mp, err := trm.groups.Members(ctx, groupID, 0, ^uint64(0)>>1, nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range mp.Members {
+			if id, ok := m.(string); ok {
+				thGroups[id] = append(thGroups[id], things.ThingGroup{ID: g.ID, Name: g.Name, Owner: g.OwnerID})
+			}
+		}
+	}
+	for _, gs := range thGroups {
+		sort.Slice(gs, func(i, j int) bool {
+			if gs[i].Name != gs[j].Name {
+				return gs[i].Name < gs[j].Name
+			}
+			return gs[i].ID < gs[j].ID
+		})
+	}
+	return thGroups, nil
+}
+
+// sample returns up to n of the things chosen using reservoir sampling.
+// A zero seed is replaced with a random one.
+func sample(ths []things.Thing, n uint64, seed int64) []things.Thing {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	rnd := rand.New(rand.NewSource(seed))
+
+	res := make([]things.Thing, 0, n)
+	for i, th := range ths {
+		if uint64(i) < n {
+			res = append(res, th)
+			continue
+		}
+		if j := uint64(rnd.Int63n(int64(i + 1))); j < n {
+			res[j] = th
+		}
+	}
+
+	return res
+}
+
 func (trm *thingRepositoryMock) RetrieveByKey(_ context.Context, key string) (string, error) {
 	trm.mu.Lock()
 	defer trm.mu.Unlock()
 
 	for _, thing := range trm.things {
-		if thing.Key == key {
+		for _, k := range thingKeys(thing) {
+			if k != key {
+				continue
+			}
+			if exp, ok := trm.expiries[k]; ok && !trm.now().Before(exp) {
+				return "", things.ErrAuthorization
+			}
 			return thing.ID, nil
 		}
 	}
@@ -228,36 +910,163 @@ func (trm *thingRepositoryMock) RetrieveByKey(_ context.Context, key string) (st
 	return "", things.ErrNotFound
 }
 
-func (trm *thingRepositoryMock) connect(conn Connection) {
+func (trm *thingRepositoryMock) RetrieveKeyExpiry(_ context.Context, key string) (time.Time, error) {
+	trm.mu.Lock()
+	defer trm.mu.Unlock()
+
+	for _, thing := range trm.things {
+		for _, k := range thingKeys(thing) {
+			if k == key {
+				return trm.expiries[k], nil
+			}
+		}
+	}
+
+	return time.Time{}, things.ErrNotFound
+}
+
+func (trm *thingRepositoryMock) SaveTemporaryKey(_ context.Context, owner, id, val string, expiresAt time.Time) error {
+	trm.mu.Lock()
+	defer trm.mu.Unlock()
+
+	for _, th := range trm.things {
+		for _, k := range thingKeys(th) {
+			if k == val {
+				return things.ErrConflict
+			}
+		}
+	}
+
+	dbKey := key(owner, id)
+	th, ok := trm.things[dbKey]
+	if !ok {
+		return things.ErrNotFound
+	}
+
+	th.Keys = append(th.Keys, val)
+	trm.things[dbKey] = th
+	trm.expiries[val] = expiresAt
+
+	return nil
+}
+
+func (trm *thingRepositoryMock) RemoveExpiredKeys(_ context.Context, now time.Time) ([]string, error) {
+	trm.mu.Lock()
+	defer trm.mu.Unlock()
+
+	expired := make(map[string]bool)
+	for k, exp := range trm.expiries {
+		if !now.Before(exp) {
+			expired[k] = true
+			delete(trm.expiries, k)
+		}
+	}
+	if len(expired) == 0 {
+		return []string{}, nil
+	}
+
+	removed := []string{}
+	for dbKey, th := range trm.things {
+		var keys []string
+		for _, k := range th.Keys {
+			if expired[k] {
+				removed = append(removed, k)
+				continue
+			}
+			keys = append(keys, k)
+		}
+		if len(keys) < len(th.Keys) {
+			th.Keys = keys
+			trm.things[dbKey] = th
+		}
+	}
+	sort.Strings(removed)
+
+	return removed, nil
+}
+
+// thingKeys returns the primary and the additional keys of the thing.
+func thingKeys(th things.Thing) []string {
+	return append([]string{th.Key}, th.Keys...)
+}
+
+func (trm *thingRepositoryMock) sync(conns chan Connection, batchSize int) {
+	batch := make([]Connection, 0, batchSize)
+	for conn := range conns {
+		batch = append(batch[:0], conn)
+	drain:
+		for len(batch) < batchSize {
+			select {
+			case conn, ok := <-conns:
+				if !ok {
+					break drain
+				}
+				batch = append(batch, conn)
+			default:
+				break drain
+			}
+		}
+		trm.apply(batch)
+	}
+}
+
+// apply applies the connection events in order under a single lock.
+func (trm *thingRepositoryMock) apply(batch []Connection) {
 	trm.mu.Lock()
 	defer trm.mu.Unlock()
 
+	for _, conn := range batch {
+		if !conn.connected {
+			trm.disconnect(conn)
+			continue
+		}
+		trm.connect(conn)
+	}
+}
+
+func (trm *thingRepositoryMock) connect(conn Connection) {
 	if _, ok := trm.tconns[conn.chanID]; !ok {
 		trm.tconns[conn.chanID] = make(map[string]things.Thing)
 	}
+	if _, ok := trm.connAt[conn.chanID]; !ok {
+		trm.connAt[conn.chanID] = make(map[string]time.Time)
+	}
+	if _, ok := trm.connAt[conn.chanID][conn.thing.ID]; !ok {
+		trm.connAt[conn.chanID][conn.thing.ID] = conn.connectedAt
+	}
 	trm.tconns[conn.chanID][conn.thing.ID] = conn.thing
 }
 
 func (trm *thingRepositoryMock) disconnect(conn Connection) {
-	trm.mu.Lock()
-	defer trm.mu.Unlock()
-
 	if conn.thing.ID == "" {
 		delete(trm.tconns, conn.chanID)
+		delete(trm.connAt, conn.chanID)
 		return
 	}
 	delete(trm.tconns[conn.chanID], conn.thing.ID)
+	delete(trm.connAt[conn.chanID], conn.thing.ID)
 }
 
 type thingCacheMock struct {
 	mu     sync.Mutex
 	things map[string]string
+	lru    *lru
 }
 
-// NewThingCache returns mock cache instance.
+// NewThingCache returns mock cache instance. The cached keys and their
+// usage order are guarded by a single mutex, so the cache is safe for
+// concurrent use.
 func NewThingCache() things.ThingCache {
+	return NewThingCacheWithSize(0)
+}
+
+// NewThingCacheWithSize returns mock cache instance which holds at most
+// size things, evicting the least recently used ones when full. If size
+// is zero, the cache is unbounded.
+func NewThingCacheWithSize(size int) things.ThingCache {
 	return &thingCacheMock{
 		things: make(map[string]string),
+		lru:    newLRU(size),
 	}
 }
 
@@ -266,6 +1075,9 @@ func (tcm *thingCacheMock) Save(_ context.Context, key, id string) error {
 	defer tcm.mu.Unlock()
 
 	tcm.things[key] = id
+	if evicted, ok := tcm.lru.touch(key); ok {
+		delete(tcm.things, evicted.(string))
+	}
 	return nil
 }
 
@@ -277,10 +1089,26 @@ func (tcm *thingCacheMock) ID(_ context.Context, key string) (string, error) {
 	if !ok {
 		return "", things.ErrNotFound
 	}
+	tcm.lru.touch(key)
 
 	return id, nil
 }
 
+func (tcm *thingCacheMock) IDs(_ context.Context, keys []string) (map[string]string, error) {
+	tcm.mu.Lock()
+	defer tcm.mu.Unlock()
+
+	ids := make(map[string]string)
+	for _, key := range keys {
+		if id, ok := tcm.things[key]; ok {
+			ids[key] = id
+			tcm.lru.touch(key)
+		}
+	}
+
+	return ids, nil
+}
+
 func (tcm *thingCacheMock) Remove(_ context.Context, id string) error {
 	tcm.mu.Lock()
 	defer tcm.mu.Unlock()
@@ -288,9 +1116,20 @@ func (tcm *thingCacheMock) Remove(_ context.Context, id string) error {
 	for key, val := range tcm.things {
 		if val == id {
 			delete(tcm.things, key)
+			tcm.lru.remove(key)
 			return nil
 		}
 	}
 
 	return nil
 }
+
+func (tcm *thingCacheMock) RemoveKey(_ context.Context, key string) error {
+	tcm.mu.Lock()
+	defer tcm.mu.Unlock()
+
+	delete(tcm.things, key)
+	tcm.lru.remove(key)
+
+	return nil
+}
@@ -0,0 +1,1872 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package mocks
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mainflux/mainflux/internal/groups"
+	"github.com/mainflux/mainflux/pkg/errors"
+	"github.com/mainflux/mainflux/pkg/uuid"
+	"github.com/mainflux/mainflux/things"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnectionBurst(t *testing.T) {
+	owner := "user@example.com"
+	chansNum, thingsNum := 20, 50
+
+	cases := []struct {
+		desc      string
+		batchSize int
+	}{
+		{
+			desc:      "apply connection events one by one",
+			batchSize: 1,
+		},
+		{
+			desc:      "apply connection events in batches",
+			batchSize: 16,
+		},
+	}
+
+	for _, tc := range cases {
+		conns := make(chan Connection)
+		repo := NewBatchedThingRepository(conns, tc.batchSize).(*thingRepositoryMock)
+
+		var ths []things.Thing
+		for i := 0; i < thingsNum; i++ {
+			ths = append(ths, things.Thing{Owner: owner, Key: fmt.Sprintf("key-%d", i)})
+		}
+		ths, err := repo.Save(context.Background(), ths...)
+		require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", tc.desc, err))
+
+		// Every channel gets all the things connected, and then the odd
+		// ones disconnected, concurrently with the other channels.
+		expected := make(map[string]map[string]things.Thing)
+		var wg sync.WaitGroup
+		for i := 0; i < chansNum; i++ {
+			chanID := fmt.Sprintf("chan-%d", i)
+			expected[chanID] = make(map[string]things.Thing)
+			for j, th := range ths {
+				if j%2 == 0 {
+					expected[chanID][th.ID] = th
+				}
+			}
+
+			wg.Add(1)
+			go func(chanID string) {
+				defer wg.Done()
+				for _, th := range ths {
+					conns <- Connection{chanID: chanID, thing: th, connected: true}
+				}
+				for j, th := range ths {
+					if j%2 == 1 {
+						conns <- Connection{chanID: chanID, thing: things.Thing{ID: th.ID, Owner: owner}, connected: false}
+					}
+				}
+			}(chanID)
+		}
+		wg.Wait()
+
+		applied := func() bool {
+			repo.mu.Lock()
+			defer repo.mu.Unlock()
+			return reflect.DeepEqual(expected, repo.tconns)
+		}
+		assert.Eventually(t, applied, time.Second, time.Millisecond, fmt.Sprintf("%s: expected connections of every channel to be applied", tc.desc))
+		close(conns)
+	}
+}
+
+func TestRetrieveByChannel(t *testing.T) {
+	owner := "user@example.com"
+	conns := make(chan Connection)
+	repo := NewThingRepository(conns)
+	chanID := "chan"
+
+	var ths []things.Thing
+	for i := 0; i < 10; i++ {
+		ths = append(ths, things.Thing{Owner: owner, Key: fmt.Sprintf("key-%d", i)})
+	}
+	ths, err := repo.Save(context.Background(), ths...)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	// Things of another owner are neither connected nor disconnected
+	// things of the owner.
+	_, err = repo.Save(context.Background(), things.Thing{Owner: "other@example.com", Key: "other-key"})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+
+	// The first four things are connected to the channel.
+	for _, th := range ths[:4] {
+		conns <- Connection{chanID: chanID, thing: th, connected: true}
+	}
+	connected := func() bool {
+		page, err := repo.RetrieveByChannel(context.Background(), owner, chanID, true, things.PageMetadata{Limit: 10})
+		return err == nil && page.Total == 4
+	}
+	require.Eventually(t, connected, time.Second, time.Millisecond, "expected connections to be applied")
+
+	ids := func(ths []things.Thing) []string {
+		res := []string{}
+		for _, th := range ths {
+			res = append(res, th.ID)
+		}
+		return res
+	}
+
+	cases := []struct {
+		desc      string
+		owner     string
+		connected bool
+		pm        things.PageMetadata
+		ids       []string
+		total     uint64
+	}{
+		{
+			desc:      "retrieve connected things",
+			owner:     owner,
+			connected: true,
+			pm:        things.PageMetadata{Limit: 10},
+			ids:       ids(ths[:4]),
+			total:     4,
+		},
+		{
+			desc:      "retrieve page of connected things",
+			owner:     owner,
+			connected: true,
+			pm:        things.PageMetadata{Offset: 1, Limit: 2},
+			ids:       ids(ths[1:3]),
+			total:     4,
+		},
+		{
+			desc:      "retrieve disconnected things",
+			owner:     owner,
+			connected: false,
+			pm:        things.PageMetadata{Limit: 10},
+			ids:       ids(ths[4:]),
+			total:     6,
+		},
+		{
+			desc:      "retrieve last page of disconnected things",
+			owner:     owner,
+			connected: false,
+			pm:        things.PageMetadata{Offset: 4, Limit: 4},
+			ids:       ids(ths[8:]),
+			total:     6,
+		},
+		{
+			desc:      "retrieve connected things of another owner",
+			owner:     "other@example.com",
+			connected: true,
+			pm:        things.PageMetadata{Limit: 10},
+			ids:       []string{},
+			total:     0,
+		},
+	}
+
+	for _, tc := range cases {
+		page, err := repo.RetrieveByChannel(context.Background(), tc.owner, chanID, tc.connected, tc.pm)
+		require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", tc.desc, err))
+		got := ids(page.Things)
+		assert.Equal(t, tc.ids, got, fmt.Sprintf("%s: expected things %v got %v", tc.desc, tc.ids, got))
+		assert.Equal(t, tc.total, page.Total, fmt.Sprintf("%s: expected total %d got %d", tc.desc, tc.total, page.Total))
+	}
+	close(conns)
+}
+
+func TestRetrieveByGroupIDsSample(t *testing.T) {
+	owner := "user@example.com"
+	groupsRepo := NewGroupRepository()
+	repo := NewThingRepositoryWithGroups(make(chan Connection), groupsRepo)
+
+	var ths []things.Thing
+	for i := 0; i < 100; i++ {
+		ths = append(ths, things.Thing{Owner: owner, Key: fmt.Sprintf("key-%d", i)})
+	}
+	ths, err := repo.Save(context.Background(), ths...)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+
+	for _, id := range []string{"group-1", "group-2", "group-3"} {
+		_, err := groupsRepo.Save(context.Background(), groups.Group{ID: id, Name: id})
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	}
+	// The first 60 things are members of the first two groups, and the
+	// rest of the third one.
+	for i, th := range ths {
+		groupID := "group-3"
+		if i < 60 {
+			groupID = fmt.Sprintf("group-%d", i%2+1)
+		}
+		err := groupsRepo.Assign(context.Background(), th.ID, groupID)
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	}
+
+	members := make(map[string]bool)
+	for _, th := range ths[:60] {
+		members[th.ID] = true
+	}
+	groupIDs := []string{"group-1", "group-2"}
+
+	cases := []struct {
+		desc  string
+		pm    things.PageMetadata
+		size  int
+		first string
+	}{
+		{
+			desc:  "retrieve page of group things",
+			pm:    things.PageMetadata{Offset: 10, Limit: 5},
+			size:  5,
+			first: ths[10].ID,
+		},
+		{
+			desc: "retrieve sample of group things",
+			pm:   things.PageMetadata{Limit: 10, Sample: true},
+			size: 10,
+		},
+		{
+			desc: "retrieve sample of group things with seed",
+			pm:   things.PageMetadata{Limit: 10, Sample: true, Seed: 42},
+			size: 10,
+		},
+		{
+			desc: "retrieve sample larger than the group things",
+			pm:   things.PageMetadata{Limit: 100, Sample: true, Seed: 42},
+			size: 60,
+		},
+	}
+
+	for _, tc := range cases {
+		page, err := repo.RetrieveByGroupIDs(context.Background(), owner, groupIDs, tc.pm)
+		require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", tc.desc, err))
+		assert.Equal(t, uint64(60), page.Total, fmt.Sprintf("%s: expected total 60 got %d", tc.desc, page.Total))
+		assert.Len(t, page.Things, tc.size, fmt.Sprintf("%s: expected %d things got %d", tc.desc, tc.size, len(page.Things)))
+
+		seen := make(map[string]bool)
+		for _, th := range page.Things {
+			assert.True(t, members[th.ID], fmt.Sprintf("%s: expected thing %s to be a member of the groups", tc.desc, th.ID))
+			assert.False(t, seen[th.ID], fmt.Sprintf("%s: expected thing %s to be sampled once", tc.desc, th.ID))
+			seen[th.ID] = true
+		}
+		if tc.first != "" {
+			assert.Equal(t, tc.first, page.Things[0].ID, fmt.Sprintf("%s: expected first thing %s got %s", tc.desc, tc.first, page.Things[0].ID))
+		}
+	}
+
+	pm := things.PageMetadata{Limit: 10, Sample: true, Seed: 42}
+	first, err := repo.RetrieveByGroupIDs(context.Background(), owner, groupIDs, pm)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	second, err := repo.RetrieveByGroupIDs(context.Background(), owner, groupIDs, pm)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	assert.Equal(t, first.Things, second.Things, "expected samples with the same seed to be equal")
+
+	pm.Seed = 7
+	other, err := repo.RetrieveByGroupIDs(context.Background(), owner, groupIDs, pm)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	assert.NotEqual(t, first.Things, other.Things, "expected samples with different seeds to differ")
+}
+
+func TestRetrieveByGroupIDsCursor(t *testing.T) {
+	owner := "user@example.com"
+	groupsRepo := NewGroupRepository()
+	repo := NewThingRepositoryWithGroups(make(chan Connection), groupsRepo)
+
+	// The names repeat, so that the things with the same name are ordered
+	// by ID, and every other thing is on the first floor.
+	var ths []things.Thing
+	for i := 0; i < 50; i++ {
+		kind := "sensor"
+		if i%3 == 0 {
+			kind = "actuator"
+		}
+		th := things.Thing{
+			Owner:    owner,
+			Key:      fmt.Sprintf("key-%d", i),
+			Name:     fmt.Sprintf("%s-%d", kind, i%4),
+			Metadata: things.Metadata{"floor": fmt.Sprintf("%d", i%2)},
+		}
+		ths = append(ths, th)
+	}
+	ths, err := repo.Save(context.Background(), ths...)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+
+	_, err = groupsRepo.Save(context.Background(), groups.Group{ID: "group", Name: "group"})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	for _, th := range ths[:40] {
+		err := groupsRepo.Assign(context.Background(), th.ID, "group")
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	}
+
+	cases := []struct {
+		desc     string
+		pm       things.PageMetadata
+		expected func(th things.Thing) bool
+	}{
+		{
+			desc:     "page group things by name",
+			pm:       things.PageMetadata{Order: "name", Limit: 7},
+			expected: func(th things.Thing) bool { return true },
+		},
+		{
+			desc:     "page group things filtered by name",
+			pm:       things.PageMetadata{Order: "name", Limit: 4, Name: "SENSOR"},
+			expected: func(th things.Thing) bool { return strings.HasPrefix(th.Name, "sensor") },
+		},
+		{
+			desc: "page group things filtered by name and metadata",
+			pm:   things.PageMetadata{Order: "name", Limit: 3, Name: "sensor", Metadata: things.Metadata{"floor": "1"}},
+			expected: func(th things.Thing) bool {
+				return strings.HasPrefix(th.Name, "sensor") && th.Metadata["floor"] == "1"
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		var expected []string
+		for _, th := range ths[:40] {
+			if tc.expected(th) {
+				expected = append(expected, th.ID)
+			}
+		}
+
+		var ids []string
+		seen := make(map[string]bool)
+		var last things.Thing
+		pm := tc.pm
+		for pages := 0; pages <= len(expected); pages++ {
+			page, err := repo.RetrieveByGroupIDs(context.Background(), owner, []string{"group"}, pm)
+			require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", tc.desc, err))
+			assert.Equal(t, uint64(len(expected)), page.Total, fmt.Sprintf("%s: expected total %d got %d", tc.desc, len(expected), page.Total))
+			for _, th := range page.Things {
+				assert.False(t, seen[th.ID], fmt.Sprintf("%s: expected thing %s to be listed once", tc.desc, th.ID))
+				assert.False(t, th.Name < last.Name, fmt.Sprintf("%s: expected thing %s to be ordered by name", tc.desc, th.ID))
+				seen[th.ID] = true
+				ids = append(ids, th.ID)
+				last = th
+			}
+			if page.NextCursor == "" {
+				break
+			}
+			pm.Cursor = page.NextCursor
+		}
+		assert.ElementsMatch(t, expected, ids, fmt.Sprintf("%s: expected things %v got %v", tc.desc, expected, ids))
+	}
+
+	_, err = repo.RetrieveByGroupIDs(context.Background(), owner, []string{"group"}, things.PageMetadata{Order: "name", Limit: 5, Cursor: "invalid"})
+	assert.True(t, errors.Contains(err, things.ErrInvalidCursor), fmt.Sprintf("expected %s got %s", things.ErrInvalidCursor, err))
+}
+
+func TestRetrieveByGroupIDsTotal(t *testing.T) {
+	owner := "user@example.com"
+	groupsRepo := NewGroupRepository()
+	repo := NewThingRepositoryWithGroups(make(chan Connection), groupsRepo)
+
+	// Seven things are members of the first group, three of them named
+	// "sensor", and three of the second one.
+	var ths []things.Thing
+	for i := 0; i < 10; i++ {
+		name := "actuator"
+		if i%3 == 0 {
+			name = "sensor"
+		}
+		ths = append(ths, things.Thing{Owner: owner, Name: name, Key: fmt.Sprintf("key-%d", i)})
+	}
+	ths, err := repo.Save(context.Background(), ths...)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	// Things of another owner don't count towards the total.
+	other, err := repo.Save(context.Background(), things.Thing{Owner: "other@example.com", Name: "sensor", Key: "other-key"})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+
+	for _, id := range []string{"group-1", "group-2"} {
+		_, err := groupsRepo.Save(context.Background(), groups.Group{ID: id, Name: id})
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	}
+	for i, th := range append(ths, other...) {
+		groupID := "group-1"
+		if i >= 7 && i < 10 {
+			groupID = "group-2"
+		}
+		err := groupsRepo.Assign(context.Background(), th.ID, groupID)
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	}
+
+	cases := []struct {
+		desc     string
+		groupIDs []string
+		pm       things.PageMetadata
+		size     int
+		total    uint64
+	}{
+		{
+			desc:     "retrieve first page of the first group",
+			groupIDs: []string{"group-1"},
+			pm:       things.PageMetadata{Limit: 2},
+			size:     2,
+			total:    7,
+		},
+		{
+			desc:     "retrieve last page of the first group",
+			groupIDs: []string{"group-1"},
+			pm:       things.PageMetadata{Offset: 6, Limit: 2},
+			size:     1,
+			total:    7,
+		},
+		{
+			desc:     "retrieve first page of the second group",
+			groupIDs: []string{"group-2"},
+			pm:       things.PageMetadata{Limit: 2},
+			size:     2,
+			total:    3,
+		},
+		{
+			desc:     "retrieve page of the first group filtered by name",
+			groupIDs: []string{"group-1"},
+			pm:       things.PageMetadata{Limit: 2, Name: "sensor"},
+			size:     2,
+			total:    3,
+		},
+		{
+			desc:     "retrieve page of the second group filtered by name",
+			groupIDs: []string{"group-2"},
+			pm:       things.PageMetadata{Limit: 2, Name: "sensor"},
+			size:     1,
+			total:    1,
+		},
+		{
+			desc:     "retrieve page of both groups",
+			groupIDs: []string{"group-1", "group-2"},
+			pm:       things.PageMetadata{Limit: 5},
+			size:     5,
+			total:    10,
+		},
+		{
+			desc:     "retrieve page of a non-existing group",
+			groupIDs: []string{"non-existing"},
+			pm:       things.PageMetadata{Limit: 2},
+			size:     0,
+			total:    0,
+		},
+	}
+
+	for _, tc := range cases {
+		page, err := repo.RetrieveByGroupIDs(context.Background(), owner, tc.groupIDs, tc.pm)
+		require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", tc.desc, err))
+		assert.Equal(t, tc.size, len(page.Things), fmt.Sprintf("%s: expected %d things got %d", tc.desc, tc.size, len(page.Things)))
+		assert.Equal(t, tc.total, page.Total, fmt.Sprintf("%s: expected total %d got %d", tc.desc, tc.total, page.Total))
+
+		cp, err := repo.RetrieveCompactByGroupIDs(context.Background(), owner, tc.groupIDs, tc.pm)
+		require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", tc.desc, err))
+		assert.Equal(t, tc.total, cp.Total, fmt.Sprintf("%s: expected compact total %d got %d", tc.desc, tc.total, cp.Total))
+	}
+}
+
+func TestRetrieveByGroupIDsWithGroups(t *testing.T) {
+	owner := "user@example.com"
+	groupsRepo := NewGroupRepository()
+	repo := NewThingRepositoryWithGroups(make(chan Connection), groupsRepo)
+
+	ths, err := repo.Save(context.Background(),
+		things.Thing{Owner: owner, Name: "a", Key: "key-a"},
+		things.Thing{Owner: owner, Name: "b", Key: "key-b"},
+	)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+
+	sensors := groups.Group{ID: "group-1", Name: "sensors", OwnerID: "owner-1"}
+	gateways := groups.Group{ID: "group-2", Name: "gateways", OwnerID: "owner-2"}
+	other := groups.Group{ID: "group-3", Name: "other", OwnerID: "owner-1"}
+	for _, g := range []groups.Group{sensors, gateways, other} {
+		_, err := groupsRepo.Save(context.Background(), g)
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	}
+	// The first thing is a member of every group, and the second one of
+	// the sensors group only.
+	for _, groupID := range []string{sensors.ID, gateways.ID, other.ID} {
+		err := groupsRepo.Assign(context.Background(), ths[0].ID, groupID)
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	}
+	err = groupsRepo.Assign(context.Background(), ths[1].ID, sensors.ID)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+
+	sensorsGroup := things.ThingGroup{ID: sensors.ID, Name: sensors.Name, Owner: sensors.OwnerID}
+	gatewaysGroup := things.ThingGroup{ID: gateways.ID, Name: gateways.Name, Owner: gateways.OwnerID}
+
+	cases := []struct {
+		desc   string
+		pm     things.PageMetadata
+		groups map[string][]things.ThingGroup
+	}{
+		{
+			desc: "retrieve group things with groups",
+			pm:   things.PageMetadata{Limit: 10, WithGroups: true},
+			groups: map[string][]things.ThingGroup{
+				ths[0].ID: {gatewaysGroup, sensorsGroup},
+				ths[1].ID: {sensorsGroup},
+			},
+		},
+		{
+			desc: "retrieve group things without groups",
+			pm:   things.PageMetadata{Limit: 10},
+			groups: map[string][]things.ThingGroup{
+				ths[0].ID: nil,
+				ths[1].ID: nil,
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		page, err := repo.RetrieveByGroupIDs(context.Background(), owner, []string{sensors.ID, gateways.ID, "non-existing"}, tc.pm)
+		require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", tc.desc, err))
+		require.Len(t, page.Things, len(tc.groups), fmt.Sprintf("%s: expected %d things got %d", tc.desc, len(tc.groups), len(page.Things)))
+		for _, th := range page.Things {
+			expected := tc.groups[th.ID]
+			assert.Equal(t, expected, th.Groups, fmt.Sprintf("%s: expected groups %v of thing %s got %v", tc.desc, expected, th.Name, th.Groups))
+		}
+	}
+
+	// The groups are not kept with the things.
+	th, err := repo.RetrieveByID(context.Background(), owner, ths[0].ID)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	assert.Nil(t, th.Groups, fmt.Sprintf("expected no groups of retrieved thing got %v", th.Groups))
+}
+
+func TestCountByGroupIDs(t *testing.T) {
+	owner := "user@example.com"
+	groupsRepo := NewGroupRepository()
+	repo := NewThingRepositoryWithGroups(make(chan Connection), groupsRepo)
+
+	var ths []things.Thing
+	for i := 0; i < 10; i++ {
+		ths = append(ths, things.Thing{Owner: owner, Key: fmt.Sprintf("key-%d", i)})
+	}
+	ths, err := repo.Save(context.Background(), ths...)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+
+	for _, id := range []string{"group-1", "group-2", "group-3"} {
+		_, err := groupsRepo.Save(context.Background(), groups.Group{ID: id, Name: id})
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	}
+	// The first six things are members of the first two groups, and the
+	// rest of the third one.
+	for i, th := range ths {
+		groupID := "group-3"
+		if i < 6 {
+			groupID = fmt.Sprintf("group-%d", i%2+1)
+		}
+		err := groupsRepo.Assign(context.Background(), th.ID, groupID)
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	}
+
+	// Remove two things of the first group, which stay its members.
+	for _, th := range []things.Thing{ths[0], ths[2]} {
+		err := repo.Remove(context.Background(), owner, th.ID)
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	}
+
+	cases := []struct {
+		desc     string
+		groupIDs []string
+		count    uint64
+	}{
+		{
+			desc:     "count things of a group with removed things",
+			groupIDs: []string{"group-1"},
+			count:    1,
+		},
+		{
+			desc:     "count things of a group",
+			groupIDs: []string{"group-2"},
+			count:    3,
+		},
+		{
+			desc:     "count things of multiple groups",
+			groupIDs: []string{"group-1", "group-2", "group-3"},
+			count:    8,
+		},
+		{
+			desc:     "count things of a non-existing group",
+			groupIDs: []string{"non-existing"},
+			count:    0,
+		},
+		{
+			desc:     "count things without groups",
+			groupIDs: []string{},
+			count:    0,
+		},
+	}
+
+	for _, tc := range cases {
+		count, err := repo.CountByGroupIDs(context.Background(), tc.groupIDs)
+		require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", tc.desc, err))
+		assert.Equal(t, tc.count, count, fmt.Sprintf("%s: expected %d got %d", tc.desc, tc.count, count))
+	}
+}
+
+func TestMetadataFacet(t *testing.T) {
+	owner := "user@example.com"
+	groupsRepo := NewGroupRepository()
+	repo := NewThingRepositoryWithGroups(make(chan Connection), groupsRepo)
+
+	metadata := []things.Metadata{
+		{"firmware": "1.0"},
+		{"firmware": "1.0"},
+		{"firmware": "1.1"},
+		{"firmware": 2},
+		{"firmware": nil},
+		{"model": "a"},
+		nil,
+		{"firmware": "1.1"},
+	}
+	var ths []things.Thing
+	for i, m := range metadata {
+		ths = append(ths, things.Thing{Owner: owner, Key: fmt.Sprintf("key-%d", i), Metadata: m})
+	}
+	ths, err := repo.Save(context.Background(), ths...)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+
+	for _, id := range []string{"group-1", "group-2"} {
+		_, err := groupsRepo.Save(context.Background(), groups.Group{ID: id, Name: id})
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	}
+	// All the things but the last one are members of the first group.
+	for i, th := range ths {
+		groupID := "group-1"
+		if i == len(ths)-1 {
+			groupID = "group-2"
+		}
+		err := groupsRepo.Assign(context.Background(), th.ID, groupID)
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	}
+
+	cases := []struct {
+		desc     string
+		groupIDs []string
+		key      string
+		facet    map[string]uint64
+	}{
+		{
+			desc:     "retrieve facet of a group",
+			groupIDs: []string{"group-1"},
+			key:      "firmware",
+			facet:    map[string]uint64{"1.0": 2, "1.1": 1, "2": 1, things.NullFacet: 3},
+		},
+		{
+			desc:     "retrieve facet of multiple groups",
+			groupIDs: []string{"group-1", "group-2"},
+			key:      "firmware",
+			facet:    map[string]uint64{"1.0": 2, "1.1": 2, "2": 1, things.NullFacet: 3},
+		},
+		{
+			desc:     "retrieve facet of a key set by few things",
+			groupIDs: []string{"group-1"},
+			key:      "model",
+			facet:    map[string]uint64{"a": 1, things.NullFacet: 6},
+		},
+		{
+			desc:     "retrieve facet of a non-existing group",
+			groupIDs: []string{"non-existing"},
+			key:      "firmware",
+			facet:    map[string]uint64{},
+		},
+		{
+			desc:     "retrieve facet without groups",
+			groupIDs: []string{},
+			key:      "firmware",
+			facet:    map[string]uint64{},
+		},
+	}
+
+	for _, tc := range cases {
+		facet, err := repo.MetadataFacet(context.Background(), tc.groupIDs, tc.key)
+		require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", tc.desc, err))
+		assert.Equal(t, tc.facet, facet, fmt.Sprintf("%s: expected %v got %v", tc.desc, tc.facet, facet))
+	}
+}
+
+func TestChangeStatus(t *testing.T) {
+	owner := "user@example.com"
+	groupsRepo := NewGroupRepository()
+	repo := NewThingRepositoryWithGroups(make(chan Connection), groupsRepo)
+
+	var ths []things.Thing
+	for i := 0; i < 3; i++ {
+		ths = append(ths, things.Thing{Owner: owner, Key: fmt.Sprintf("key-%d", i)})
+	}
+	ths, err := repo.Save(context.Background(), ths...)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	_, err = groupsRepo.Save(context.Background(), groups.Group{ID: "group", Name: "group"})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	for _, th := range ths {
+		err := groupsRepo.Assign(context.Background(), th.ID, "group")
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	}
+
+	list := func(status string) ([]string, uint64, error) {
+		page, err := repo.RetrieveByGroupIDs(context.Background(), owner, []string{"group"}, things.PageMetadata{Limit: 10, Status: status})
+		var ids []string
+		for _, th := range page.Things {
+			ids = append(ids, th.ID)
+		}
+		return ids, page.Total, err
+	}
+
+	cases := []struct {
+		desc     string
+		id       string
+		status   string
+		err      error
+		enabled  []string
+		disabled []string
+	}{
+		{
+			desc:     "disable thing",
+			id:       ths[0].ID,
+			status:   things.DisabledStatus,
+			err:      nil,
+			enabled:  []string{ths[1].ID, ths[2].ID},
+			disabled: []string{ths[0].ID},
+		},
+		{
+			desc:     "disable another thing",
+			id:       ths[2].ID,
+			status:   things.DisabledStatus,
+			err:      nil,
+			enabled:  []string{ths[1].ID},
+			disabled: []string{ths[0].ID, ths[2].ID},
+		},
+		{
+			desc:     "enable disabled thing",
+			id:       ths[0].ID,
+			status:   things.EnabledStatus,
+			err:      nil,
+			enabled:  []string{ths[0].ID, ths[1].ID},
+			disabled: []string{ths[2].ID},
+		},
+		{
+			desc:     "change status to invalid status",
+			id:       ths[1].ID,
+			status:   "unknown",
+			err:      things.ErrMalformedEntity,
+			enabled:  []string{ths[0].ID, ths[1].ID},
+			disabled: []string{ths[2].ID},
+		},
+		{
+			desc:     "change status of non-existing thing",
+			id:       "non-existing",
+			status:   things.DisabledStatus,
+			err:      things.ErrNotFound,
+			enabled:  []string{ths[0].ID, ths[1].ID},
+			disabled: []string{ths[2].ID},
+		},
+	}
+
+	for _, tc := range cases {
+		err := repo.ChangeStatus(context.Background(), tc.id, tc.status)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s", tc.desc, tc.err, err))
+
+		enabled, total, err := list("")
+		require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", tc.desc, err))
+		assert.Equal(t, tc.enabled, enabled, fmt.Sprintf("%s: expected enabled things %v got %v", tc.desc, tc.enabled, enabled))
+		assert.Equal(t, uint64(len(tc.enabled)), total, fmt.Sprintf("%s: expected total %d got %d", tc.desc, len(tc.enabled), total))
+
+		disabled, _, err := list(things.DisabledStatus)
+		require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", tc.desc, err))
+		assert.Equal(t, tc.disabled, disabled, fmt.Sprintf("%s: expected disabled things %v got %v", tc.desc, tc.disabled, disabled))
+
+		all, _, err := list(things.AllStatus)
+		require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", tc.desc, err))
+		assert.Equal(t, len(ths), len(all), fmt.Sprintf("%s: expected %d things of any status got %d", tc.desc, len(ths), len(all)))
+
+		// Disabled things are still retrievable by ID.
+		for _, id := range tc.disabled {
+			th, err := repo.RetrieveByID(context.Background(), owner, id)
+			require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", tc.desc, err))
+			assert.Equal(t, things.DisabledStatus, th.Status, fmt.Sprintf("%s: expected status %s got %s", tc.desc, things.DisabledStatus, th.Status))
+		}
+	}
+
+	_, _, err = list("unknown")
+	assert.True(t, errors.Contains(err, things.ErrMalformedEntity), fmt.Sprintf("list things with invalid status: expected %s got %s", things.ErrMalformedEntity, err))
+}
+
+func TestUpdateMetadata(t *testing.T) {
+	owner := "user@example.com"
+	repo := NewThingRepository(make(chan Connection))
+
+	ths, err := repo.Save(context.Background(), things.Thing{
+		Owner:    owner,
+		Name:     "name",
+		Key:      "key",
+		Metadata: things.Metadata{"room": "kitchen", "floor": float64(1)},
+	})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	th := ths[0]
+
+	cases := []struct {
+		desc     string
+		owner    string
+		id       string
+		metadata things.Metadata
+		err      error
+		expected things.Metadata
+	}{
+		{
+			desc:     "add metadata key",
+			owner:    owner,
+			id:       th.ID,
+			metadata: things.Metadata{"zone": "north"},
+			err:      nil,
+			expected: things.Metadata{"room": "kitchen", "floor": float64(1), "zone": "north"},
+		},
+		{
+			desc:     "overwrite metadata key",
+			owner:    owner,
+			id:       th.ID,
+			metadata: things.Metadata{"room": "hall"},
+			err:      nil,
+			expected: things.Metadata{"room": "hall", "floor": float64(1), "zone": "north"},
+		},
+		{
+			desc:     "delete metadata key by null value",
+			owner:    owner,
+			id:       th.ID,
+			metadata: things.Metadata{"floor": nil, "missing": nil},
+			err:      nil,
+			expected: things.Metadata{"room": "hall", "zone": "north"},
+		},
+		{
+			desc:     "update metadata of non-existing thing",
+			owner:    owner,
+			id:       "non-existing",
+			metadata: things.Metadata{"room": "attic"},
+			err:      things.ErrNotFound,
+			expected: things.Metadata{"room": "hall", "zone": "north"},
+		},
+		{
+			desc:     "update metadata of thing of another owner",
+			owner:    "other@example.com",
+			id:       th.ID,
+			metadata: things.Metadata{"room": "attic"},
+			err:      things.ErrNotFound,
+			expected: things.Metadata{"room": "hall", "zone": "north"},
+		},
+	}
+
+	for _, tc := range cases {
+		err := repo.UpdateMetadata(context.Background(), tc.owner, tc.id, tc.metadata)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s", tc.desc, tc.err, err))
+
+		res, err := repo.RetrieveByID(context.Background(), owner, th.ID)
+		require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", tc.desc, err))
+		assert.Equal(t, tc.expected, res.Metadata, fmt.Sprintf("%s: expected metadata %v got %v", tc.desc, tc.expected, res.Metadata))
+		// The other fields are left untouched.
+		assert.Equal(t, th.Name, res.Name, fmt.Sprintf("%s: expected name %s got %s", tc.desc, th.Name, res.Name))
+		assert.Equal(t, th.Key, res.Key, fmt.Sprintf("%s: expected key %s got %s", tc.desc, th.Key, res.Key))
+	}
+
+	// Metadata of the things retrieved before the update is not modified.
+	assert.Equal(t, things.Metadata{"room": "kitchen", "floor": float64(1)}, th.Metadata, "expected metadata of previously returned thing to be unchanged")
+}
+
+// fakeClock is the clock which moves only when advanced.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestTemporaryKeys(t *testing.T) {
+	owner := "user@example.com"
+	clock := &fakeClock{now: time.Now()}
+	repo := NewThingRepositoryWithClock(make(chan Connection), clock.Now)
+
+	ths, err := repo.Save(context.Background(), things.Thing{Owner: owner, Key: "key"}, things.Thing{Owner: owner, Key: "other-key"})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	th := ths[0]
+
+	saves := []struct {
+		desc  string
+		owner string
+		id    string
+		key   string
+		ttl   time.Duration
+		err   error
+	}{
+		{
+			desc:  "save short-lived temporary key",
+			owner: owner,
+			id:    th.ID,
+			key:   "short",
+			ttl:   time.Minute,
+			err:   nil,
+		},
+		{
+			desc:  "save long-lived temporary key",
+			owner: owner,
+			id:    th.ID,
+			key:   "long",
+			ttl:   time.Hour,
+			err:   nil,
+		},
+		{
+			desc:  "save temporary key taken by another thing",
+			owner: owner,
+			id:    th.ID,
+			key:   "other-key",
+			ttl:   time.Hour,
+			err:   things.ErrConflict,
+		},
+		{
+			desc:  "save temporary key of non-existing thing",
+			owner: owner,
+			id:    "non-existing",
+			key:   "orphan",
+			ttl:   time.Hour,
+			err:   things.ErrNotFound,
+		},
+		{
+			desc:  "save temporary key of thing of another owner",
+			owner: "other@example.com",
+			id:    th.ID,
+			key:   "foreign",
+			ttl:   time.Hour,
+			err:   things.ErrNotFound,
+		},
+	}
+
+	for _, tc := range saves {
+		err := repo.SaveTemporaryKey(context.Background(), tc.owner, tc.id, tc.key, clock.Now().Add(tc.ttl))
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s", tc.desc, tc.err, err))
+	}
+
+	cases := []struct {
+		desc    string
+		advance time.Duration
+		key     string
+		id      string
+		err     error
+	}{
+		{
+			desc: "retrieve by temporary key before expiry",
+			key:  "short",
+			id:   th.ID,
+			err:  nil,
+		},
+		{
+			desc:    "retrieve by temporary key at expiry",
+			advance: time.Minute,
+			key:     "short",
+			err:     things.ErrAuthorization,
+		},
+		{
+			desc: "retrieve by temporary key not yet expired",
+			key:  "long",
+			id:   th.ID,
+			err:  nil,
+		},
+		{
+			desc: "retrieve by primary key",
+			key:  "key",
+			id:   th.ID,
+			err:  nil,
+		},
+		{
+			desc:    "retrieve by temporary key after expiry",
+			advance: time.Hour,
+			key:     "long",
+			err:     things.ErrAuthorization,
+		},
+		{
+			desc: "retrieve by primary key after expiry of temporary keys",
+			key:  "key",
+			id:   th.ID,
+			err:  nil,
+		},
+	}
+
+	for _, tc := range cases {
+		clock.advance(tc.advance)
+		id, err := repo.RetrieveByKey(context.Background(), tc.key)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s", tc.desc, tc.err, err))
+		assert.Equal(t, tc.id, id, fmt.Sprintf("%s: expected %s got %s", tc.desc, tc.id, id))
+	}
+
+	removed, err := repo.RemoveExpiredKeys(context.Background(), clock.Now())
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	assert.Equal(t, []string{"long", "short"}, removed, fmt.Sprintf("expected removed keys [long short] got %v", removed))
+
+	_, err = repo.RetrieveByKey(context.Background(), "short")
+	assert.True(t, errors.Contains(err, things.ErrNotFound), fmt.Sprintf("retrieve by removed key: expected %s got %s", things.ErrNotFound, err))
+	saved, err := repo.RetrieveByID(context.Background(), owner, th.ID)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	assert.Empty(t, saved.Keys, fmt.Sprintf("expected no additional keys got %v", saved.Keys))
+
+	removed, err = repo.RemoveExpiredKeys(context.Background(), clock.Now())
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	assert.Empty(t, removed, fmt.Sprintf("expected no removed keys got %v", removed))
+}
+
+func TestRetrieveByMetadata(t *testing.T) {
+	owner := "user@example.com"
+	groupsRepo := NewGroupRepository()
+	repo := NewThingRepositoryWithGroups(make(chan Connection), groupsRepo)
+
+	// Every third thing is an actuator, and the others are sensors, half
+	// of which report the temperature in a nested location object.
+	var ths []things.Thing
+	for i := 0; i < 30; i++ {
+		md := things.Metadata{"type": "sensor"}
+		if i%3 == 0 {
+			md = things.Metadata{"type": "actuator"}
+		}
+		if i%2 == 0 {
+			md["location"] = map[string]interface{}{"building": "a", "floor": "1"}
+		}
+		ths = append(ths, things.Thing{Owner: owner, Key: fmt.Sprintf("key-%d", i), Metadata: md})
+	}
+	ths = append(ths, things.Thing{Owner: "other@example.com", Key: "other-key", Metadata: things.Metadata{"type": "sensor"}})
+	ths, err := repo.Save(context.Background(), ths...)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+
+	_, err = groupsRepo.Save(context.Background(), groups.Group{ID: "group", Name: "group"})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	for _, th := range ths[:10] {
+		err := groupsRepo.Assign(context.Background(), th.ID, "group")
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	}
+
+	cases := []struct {
+		desc     string
+		groupIDs []string
+		filter   things.Metadata
+		pm       things.PageMetadata
+		size     int
+		total    uint64
+	}{
+		{
+			desc:   "retrieve things by metadata",
+			filter: things.Metadata{"type": "sensor"},
+			pm:     things.PageMetadata{Limit: 100},
+			size:   20,
+			total:  20,
+		},
+		{
+			desc:   "retrieve page of things by metadata",
+			filter: things.Metadata{"type": "sensor"},
+			pm:     things.PageMetadata{Offset: 15, Limit: 10},
+			size:   5,
+			total:  20,
+		},
+		{
+			desc:   "retrieve things by multiple metadata keys",
+			filter: things.Metadata{"type": "sensor", "location": map[string]interface{}{"building": "a", "floor": "1"}},
+			pm:     things.PageMetadata{Limit: 100},
+			size:   10,
+			total:  10,
+		},
+		{
+			desc:   "retrieve things by partial nested metadata",
+			filter: things.Metadata{"location": map[string]interface{}{"building": "a"}},
+			pm:     things.PageMetadata{Limit: 100},
+			size:   0,
+			total:  0,
+		},
+		{
+			desc:     "retrieve group things by metadata",
+			groupIDs: []string{"group"},
+			filter:   things.Metadata{"type": "actuator"},
+			pm:       things.PageMetadata{Limit: 100},
+			size:     4,
+			total:    4,
+		},
+		{
+			desc:   "retrieve things by empty metadata",
+			filter: things.Metadata{},
+			pm:     things.PageMetadata{Limit: 100},
+			size:   30,
+			total:  30,
+		},
+		{
+			desc:   "retrieve things by non-existent metadata",
+			filter: things.Metadata{"type": "gateway"},
+			pm:     things.PageMetadata{Limit: 100},
+			size:   0,
+			total:  0,
+		},
+	}
+
+	for _, tc := range cases {
+		page, err := repo.RetrieveByMetadata(context.Background(), owner, tc.groupIDs, tc.filter, tc.pm)
+		require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", tc.desc, err))
+		assert.Equal(t, tc.total, page.Total, fmt.Sprintf("%s: expected total %d got %d", tc.desc, tc.total, page.Total))
+		assert.Len(t, page.Things, tc.size, fmt.Sprintf("%s: expected %d things got %d", tc.desc, tc.size, len(page.Things)))
+		for _, th := range page.Things {
+			assert.Equal(t, owner, th.Owner, fmt.Sprintf("%s: expected owner %s got %s", tc.desc, owner, th.Owner))
+			for k, v := range tc.filter {
+				assert.True(t, reflect.DeepEqual(v, th.Metadata[k]), fmt.Sprintf("%s: expected metadata %s %v got %v", tc.desc, k, v, th.Metadata[k]))
+			}
+		}
+	}
+}
+
+func TestSearch(t *testing.T) {
+	groupsRepo := NewGroupRepository()
+	repo := NewThingRepositoryWithGroups(make(chan Connection), groupsRepo)
+
+	// The first half of the things are named sensors, and the others
+	// gateways. Every second thing is located in the north building, and
+	// every thing has the numeric port.
+	var ths []things.Thing
+	for i := 0; i < 20; i++ {
+		name := fmt.Sprintf("Temperature Sensor %d", i)
+		if i >= 10 {
+			name = fmt.Sprintf("gateway-%d", i)
+		}
+		md := things.Metadata{"port": 4242}
+		if i%2 == 0 {
+			md["location"] = "Building North"
+		}
+		ths = append(ths, things.Thing{Owner: fmt.Sprintf("user%d@example.com", i%2), Name: name, Key: fmt.Sprintf("key-%d", i), Metadata: md})
+	}
+	ths, err := repo.Save(context.Background(), ths...)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+
+	_, err = groupsRepo.Save(context.Background(), groups.Group{ID: "group", Name: "group"})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	for _, th := range ths[:5] {
+		err := groupsRepo.Assign(context.Background(), th.ID, "group")
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	}
+
+	cases := []struct {
+		desc     string
+		groupIDs []string
+		query    string
+		pm       things.PageMetadata
+		size     int
+		total    uint64
+	}{
+		{
+			desc:  "search things by name",
+			query: "SENSOR",
+			pm:    things.PageMetadata{Limit: 100},
+			size:  10,
+			total: 10,
+		},
+		{
+			desc:  "search things by metadata only",
+			query: "north",
+			pm:    things.PageMetadata{Limit: 100},
+			size:  10,
+			total: 10,
+		},
+		{
+			desc:  "search things by name or metadata",
+			query: "n",
+			pm:    things.PageMetadata{Limit: 100},
+			size:  15,
+			total: 15,
+		},
+		{
+			desc:  "search page of things",
+			query: "sensor",
+			pm:    things.PageMetadata{Offset: 8, Limit: 5},
+			size:  2,
+			total: 10,
+		},
+		{
+			desc:  "search things by numeric metadata",
+			query: "4242",
+			pm:    things.PageMetadata{Limit: 100},
+			size:  0,
+			total: 0,
+		},
+		{
+			desc:     "search group things",
+			groupIDs: []string{"group"},
+			query:    "north",
+			pm:       things.PageMetadata{Limit: 100},
+			size:     3,
+			total:    3,
+		},
+		{
+			desc:  "search things by non-existent query",
+			query: "actuator",
+			pm:    things.PageMetadata{Limit: 100},
+			size:  0,
+			total: 0,
+		},
+	}
+
+	for _, tc := range cases {
+		page, err := repo.Search(context.Background(), tc.groupIDs, tc.query, tc.pm)
+		require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", tc.desc, err))
+		assert.Equal(t, tc.total, page.Total, fmt.Sprintf("%s: expected total %d got %d", tc.desc, tc.total, page.Total))
+		assert.Len(t, page.Things, tc.size, fmt.Sprintf("%s: expected %d things got %d", tc.desc, tc.size, len(page.Things)))
+		query := strings.ToLower(tc.query)
+		for _, th := range page.Things {
+			location, _ := th.Metadata["location"].(string)
+			matched := strings.Contains(strings.ToLower(th.Name), query) || strings.Contains(strings.ToLower(location), query)
+			assert.True(t, matched, fmt.Sprintf("%s: expected thing %s to match %s", tc.desc, th.Name, tc.query))
+		}
+	}
+}
+
+func TestRetrieveByIDs(t *testing.T) {
+	repo := NewThingRepository(make(chan Connection))
+
+	var ths []things.Thing
+	for i := 0; i < 3; i++ {
+		ths = append(ths, things.Thing{Owner: "user@example.com", Key: fmt.Sprintf("key-%d", i)})
+	}
+	ths = append(ths, things.Thing{Owner: "other@example.com", Key: "other-key"})
+	ths, err := repo.Save(context.Background(), ths...)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+
+	cases := []struct {
+		desc     string
+		ids      []string
+		expected []things.Thing
+	}{
+		{
+			desc:     "retrieve existing things in the order of the ids",
+			ids:      []string{ths[2].ID, ths[0].ID, ths[3].ID},
+			expected: []things.Thing{ths[2], ths[0], ths[3]},
+		},
+		{
+			desc:     "retrieve existing and missing things",
+			ids:      []string{"missing", ths[1].ID, "other-missing", ths[0].ID},
+			expected: []things.Thing{ths[1], ths[0]},
+		},
+		{
+			desc:     "retrieve missing things",
+			ids:      []string{"missing"},
+			expected: []things.Thing{},
+		},
+		{
+			desc:     "retrieve things without ids",
+			ids:      []string{},
+			expected: []things.Thing{},
+		},
+	}
+
+	for _, tc := range cases {
+		res, err := repo.RetrieveByIDs(context.Background(), tc.ids)
+		assert.Nil(t, err, fmt.Sprintf("%s: expected no error got %s\n", tc.desc, err))
+		assert.Equal(t, tc.expected, res, fmt.Sprintf("%s: expected %v got %v\n", tc.desc, tc.expected, res))
+	}
+}
+
+// listProvider returns the listed identifiers in order.
+type listProvider struct {
+	ids []string
+}
+
+func (lp *listProvider) ID() (string, error) {
+	if len(lp.ids) == 0 {
+		return "", errors.New("no identifiers left")
+	}
+	id := lp.ids[0]
+	lp.ids = lp.ids[1:]
+	return id, nil
+}
+
+func TestSaveAtomic(t *testing.T) {
+	owner := "user@example.com"
+	batch := func(keys ...string) []things.Thing {
+		var ths []things.Thing
+		for i, k := range keys {
+			ths = append(ths, things.Thing{Owner: owner, Name: fmt.Sprintf("thing-%d", i), Key: k})
+		}
+		return ths
+	}
+
+	cases := []struct {
+		desc  string
+		ids   []string
+		batch []things.Thing
+		err   error
+	}{
+		{
+			desc:  "save batch with last key of saved thing",
+			ids:   []string{"2", "3", "4"},
+			batch: batch("key-2", "key-3", "key-1"),
+			err:   things.ErrConflict,
+		},
+		{
+			desc:  "save batch with last key repeated",
+			ids:   []string{"2", "3", "4"},
+			batch: batch("key-2", "key-3", "key-2"),
+			err:   things.ErrConflict,
+		},
+		{
+			desc:  "save batch with last ID of saved thing",
+			ids:   []string{"2", "3", "1"},
+			batch: batch("key-2", "key-3", "key-4"),
+			err:   things.ErrConflict,
+		},
+		{
+			desc:  "save batch with last ID repeated",
+			ids:   []string{"2", "3", "2"},
+			batch: batch("key-2", "key-3", "key-4"),
+			err:   things.ErrConflict,
+		},
+		{
+			desc:  "save batch failing to identify last thing",
+			ids:   []string{"2", "3"},
+			batch: batch("key-2", "key-3", "key-4"),
+			err:   errors.New("no identifiers left"),
+		},
+	}
+
+	for _, tc := range cases {
+		ids := &listProvider{ids: append([]string{"1"}, tc.ids...)}
+		repo := NewThingRepositoryWithIDs(make(chan Connection), ids)
+		saved, err := repo.Save(context.Background(), batch("key-1")...)
+		require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", tc.desc, err))
+
+		ths, err := repo.Save(context.Background(), tc.batch...)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s", tc.desc, tc.err, err))
+		assert.Empty(t, ths, fmt.Sprintf("%s: expected no saved things got %v", tc.desc, ths))
+
+		page, err := repo.RetrieveAll(context.Background(), owner, things.PageMetadata{Limit: 10})
+		require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", tc.desc, err))
+		assert.Equal(t, saved, page.Things, fmt.Sprintf("%s: expected things %v got %v", tc.desc, saved, page.Things))
+		for _, th := range tc.batch[:2] {
+			_, err := repo.RetrieveByKey(context.Background(), th.Key)
+			assert.True(t, errors.Contains(err, things.ErrNotFound), fmt.Sprintf("%s: expected %s got %s", tc.desc, things.ErrNotFound, err))
+		}
+		for _, th := range tc.batch {
+			assert.Empty(t, th.ID, fmt.Sprintf("%s: expected submitted thing to stay unidentified got %s", tc.desc, th.ID))
+		}
+	}
+}
+
+func TestIDProviders(t *testing.T) {
+	owner := "user@example.com"
+	cases := []struct {
+		desc string
+		repo func() *thingRepositoryMock
+	}{
+		{
+			desc: "counter-based identifiers",
+			repo: func() *thingRepositoryMock {
+				return NewThingRepository(make(chan Connection)).(*thingRepositoryMock)
+			},
+		},
+		{
+			desc: "UUID-based identifiers",
+			repo: func() *thingRepositoryMock {
+				return NewThingRepositoryWithIDs(make(chan Connection), uuid.New()).(*thingRepositoryMock)
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		groupsRepo := NewGroupRepository()
+		repo := tc.repo()
+		repo.groups = groupsRepo
+
+		var ths []things.Thing
+		for i := 0; i < 5; i++ {
+			ths = append(ths, things.Thing{Owner: owner, Name: fmt.Sprintf("thing-%d", i), Key: fmt.Sprintf("key-%d", i)})
+		}
+		ths, err := repo.Save(context.Background(), ths...)
+		require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", tc.desc, err))
+		_, err = groupsRepo.Save(context.Background(), groups.Group{ID: "group", Name: "group"})
+		require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", tc.desc, err))
+
+		ids := make(map[string]bool)
+		for _, th := range ths {
+			assert.False(t, ids[th.ID], fmt.Sprintf("%s: expected unique identifiers got %s twice", tc.desc, th.ID))
+			ids[th.ID] = true
+
+			got, err := repo.RetrieveByID(context.Background(), owner, th.ID)
+			assert.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", tc.desc, err))
+			assert.Equal(t, th, got, fmt.Sprintf("%s: expected %v got %v", tc.desc, th, got))
+
+			id, err := repo.RetrieveByKey(context.Background(), th.Key)
+			assert.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", tc.desc, err))
+			assert.Equal(t, th.ID, id, fmt.Sprintf("%s: expected %s got %s", tc.desc, th.ID, id))
+
+			err = groupsRepo.Assign(context.Background(), th.ID, "group")
+			require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", tc.desc, err))
+		}
+
+		// Page through the group and expect every thing exactly once.
+		seen := make(map[string]bool)
+		for offset := uint64(0); offset < uint64(len(ths)); offset += 2 {
+			page, err := repo.RetrieveByGroupIDs(context.Background(), owner, []string{"group"}, things.PageMetadata{Offset: offset, Limit: 2})
+			require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", tc.desc, err))
+			assert.Equal(t, uint64(len(ths)), page.Total, fmt.Sprintf("%s: expected total %d got %d", tc.desc, len(ths), page.Total))
+			for _, th := range page.Things {
+				assert.False(t, seen[th.ID], fmt.Sprintf("%s: expected thing %s on a single page", tc.desc, th.ID))
+				seen[th.ID] = true
+			}
+		}
+		assert.Equal(t, ids, seen, fmt.Sprintf("%s: expected things %v got %v", tc.desc, ids, seen))
+
+		err = repo.Remove(context.Background(), owner, ths[0].ID)
+		assert.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", tc.desc, err))
+		_, err = repo.RetrieveByID(context.Background(), owner, ths[0].ID)
+		assert.True(t, errors.Contains(err, things.ErrNotFound), fmt.Sprintf("%s: expected %s got %s", tc.desc, things.ErrNotFound, err))
+	}
+}
+
+func TestUUIDPageBoundaries(t *testing.T) {
+	owner := "user@example.com"
+	groupsRepo := NewGroupRepository()
+	repo := NewThingRepositoryWithIDs(make(chan Connection), uuid.New()).(*thingRepositoryMock)
+	repo.groups = groupsRepo
+	_, err := groupsRepo.Save(context.Background(), groups.Group{ID: "group", Name: "group"})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+
+	var ids []string
+	for i := 0; i < 7; i++ {
+		ths, err := repo.Save(context.Background(), things.Thing{Owner: owner, Key: fmt.Sprintf("key-%d", i)})
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+		err = groupsRepo.Assign(context.Background(), ths[0].ID, "group")
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+		ids = append(ids, ths[0].ID)
+	}
+	sort.Strings(ids)
+
+	retrieve := map[string]func(pm things.PageMetadata) (things.Page, error){
+		"retrieve all": func(pm things.PageMetadata) (things.Page, error) {
+			return repo.RetrieveAll(context.Background(), owner, pm)
+		},
+		"retrieve by channel": func(pm things.PageMetadata) (things.Page, error) {
+			return repo.RetrieveByChannel(context.Background(), owner, "channel", false, pm)
+		},
+		"retrieve by groups": func(pm things.PageMetadata) (things.Page, error) {
+			return repo.RetrieveByGroupIDs(context.Background(), owner, []string{"group"}, pm)
+		},
+	}
+
+	cases := []struct {
+		desc   string
+		offset uint64
+		limit  uint64
+		ids    []string
+	}{
+		{
+			desc:   "first page",
+			offset: 0,
+			limit:  3,
+			ids:    ids[0:3],
+		},
+		{
+			desc:   "middle page",
+			offset: 3,
+			limit:  3,
+			ids:    ids[3:6],
+		},
+		{
+			desc:   "last partial page",
+			offset: 6,
+			limit:  3,
+			ids:    ids[6:7],
+		},
+		{
+			desc:   "page past the things",
+			offset: 9,
+			limit:  3,
+			ids:    nil,
+		},
+	}
+
+	for name, r := range retrieve {
+		for _, tc := range cases {
+			page, err := r(things.PageMetadata{Offset: tc.offset, Limit: tc.limit})
+			require.Nil(t, err, fmt.Sprintf("%s %s: unexpected error: %s", name, tc.desc, err))
+			var got []string
+			for _, th := range page.Things {
+				got = append(got, th.ID)
+			}
+			assert.Equal(t, tc.ids, got, fmt.Sprintf("%s %s: expected things %v got %v", name, tc.desc, tc.ids, got))
+			assert.Equal(t, uint64(len(ids)), page.Total, fmt.Sprintf("%s %s: expected total %d got %d", name, tc.desc, len(ids), page.Total))
+		}
+	}
+}
+
+func TestRetrieveAllOrder(t *testing.T) {
+	owner := "user@example.com"
+	conns := make(chan Connection)
+	trm := NewThingRepository(conns)
+	crm := NewChannelRepository(trm, conns)
+
+	names := []string{"c", "a", "b", "a", "d"}
+	var ths []things.Thing
+	var chs []things.Channel
+	for i, name := range names {
+		ths = append(ths, things.Thing{Owner: owner, Name: name, Key: fmt.Sprintf("key-%d", i)})
+		chs = append(chs, things.Channel{Owner: owner, Name: name})
+	}
+	_, err := trm.Save(context.Background(), ths...)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	_, err = crm.Save(context.Background(), chs...)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+
+	cases := []struct {
+		desc  string
+		order string
+		dir   string
+		ids   []string
+	}{
+		{desc: "retrieve with default order", ids: []string{"1", "2", "3", "4", "5"}},
+		{desc: "retrieve in descending default order", dir: "desc", ids: []string{"5", "4", "3", "2", "1"}},
+		{desc: "retrieve by ID", order: "id", ids: []string{"1", "2", "3", "4", "5"}},
+		{desc: "retrieve by ascending ID", order: "id", dir: "asc", ids: []string{"1", "2", "3", "4", "5"}},
+		{desc: "retrieve by descending ID", order: "id", dir: "desc", ids: []string{"5", "4", "3", "2", "1"}},
+		{desc: "retrieve by name", order: "name", ids: []string{"2", "4", "3", "1", "5"}},
+		{desc: "retrieve by ascending name", order: "name", dir: "asc", ids: []string{"2", "4", "3", "1", "5"}},
+		{desc: "retrieve by descending name", order: "name", dir: "desc", ids: []string{"5", "1", "3", "2", "4"}},
+	}
+
+	for _, tc := range cases {
+		for _, anyOf := range []bool{false, true} {
+			pm := things.PageMetadata{Limit: 10, Order: tc.order, Dir: tc.dir}
+			desc := tc.desc
+			if anyOf {
+				pm.AnyOf = []things.Filter{{Metadata: things.Metadata{}}}
+				desc += " matching any filter"
+			}
+
+			tp, err := trm.RetrieveAll(context.Background(), owner, pm)
+			require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", desc, err))
+			var ids []string
+			for _, th := range tp.Things {
+				ids = append(ids, th.ID)
+			}
+			assert.Equal(t, tc.ids, ids, fmt.Sprintf("%s: expected things %v got %v", desc, tc.ids, ids))
+			assert.Equal(t, tc.order, tp.Order, fmt.Sprintf("%s: expected order %s got %s", desc, tc.order, tp.Order))
+			assert.Equal(t, tc.dir, tp.Dir, fmt.Sprintf("%s: expected direction %s got %s", desc, tc.dir, tp.Dir))
+
+			cp, err := crm.RetrieveAll(context.Background(), owner, pm)
+			require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", desc, err))
+			ids = nil
+			for _, ch := range cp.Channels {
+				ids = append(ids, ch.ID)
+			}
+			assert.Equal(t, tc.ids, ids, fmt.Sprintf("%s: expected channels %v got %v", desc, tc.ids, ids))
+		}
+	}
+}
+
+func TestRetrieveAllStream(t *testing.T) {
+	conns := make(chan Connection)
+	trm := NewThingRepository(conns)
+
+	n := 23
+	for i := 0; i < n; i++ {
+		owner := fmt.Sprintf("user-%d@example.com", i%3)
+		_, err := trm.Save(context.Background(), things.Thing{Owner: owner, Name: fmt.Sprintf("thing-%d", i), Key: fmt.Sprintf("key-%d", i)})
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	}
+
+	cases := []struct {
+		desc      string
+		batchSize int
+	}{
+		{
+			desc:      "stream things in batches",
+			batchSize: 5,
+		},
+		{
+			desc:      "stream things in a batch dividing their number",
+			batchSize: 23,
+		},
+		{
+			desc:      "stream things in a batch larger than their number",
+			batchSize: 100,
+		},
+		{
+			desc:      "stream things one by one",
+			batchSize: 0,
+		},
+	}
+
+	for _, tc := range cases {
+		ths, errs := trm.RetrieveAllStream(context.Background(), tc.batchSize)
+		delivered := make(map[string]int)
+		for th := range ths {
+			delivered[key(th.Owner, th.ID)]++
+		}
+		err, ok := <-errs
+		assert.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", tc.desc, err))
+		assert.False(t, ok, fmt.Sprintf("%s: expected error channel to be closed", tc.desc))
+		assert.Equal(t, n, len(delivered), fmt.Sprintf("%s: expected %d things got %d", tc.desc, n, len(delivered)))
+		for k, count := range delivered {
+			assert.Equal(t, 1, count, fmt.Sprintf("%s: expected thing %s once got %d times", tc.desc, k, count))
+		}
+	}
+}
+
+func TestRetrieveAllStreamCancel(t *testing.T) {
+	conns := make(chan Connection)
+	trm := NewThingRepository(conns)
+	for i := 0; i < 10; i++ {
+		_, err := trm.Save(context.Background(), things.Thing{Owner: "user@example.com", Key: fmt.Sprintf("key-%d", i)})
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ths, errs := trm.RetrieveAllStream(ctx, 2)
+	<-ths
+	cancel()
+
+	err := <-errs
+	assert.True(t, errors.Contains(err, context.Canceled), fmt.Sprintf("expected %s got %s", context.Canceled, err))
+	var received int
+	for range ths {
+		received++
+	}
+	assert.Equal(t, 0, received, fmt.Sprintf("expected streaming to stop on cancel got %d more things", received))
+}
+
+func TestThingCacheIDs(t *testing.T) {
+	cache := NewThingCache()
+	cached := map[string]string{"key1": "id1", "key2": "id2", "key3": "id3"}
+	for key, id := range cached {
+		err := cache.Save(context.Background(), key, id)
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	}
+
+	cases := []struct {
+		desc string
+		keys []string
+		ids  map[string]string
+	}{
+		{
+			desc: "retrieve cached keys",
+			keys: []string{"key1", "key3"},
+			ids:  map[string]string{"key1": "id1", "key3": "id3"},
+		},
+		{
+			desc: "retrieve cached and missing keys",
+			keys: []string{"key2", "missing"},
+			ids:  map[string]string{"key2": "id2"},
+		},
+		{
+			desc: "retrieve missing keys",
+			keys: []string{"missing"},
+			ids:  map[string]string{},
+		},
+		{
+			desc: "retrieve without keys",
+			keys: nil,
+			ids:  map[string]string{},
+		},
+	}
+
+	for _, tc := range cases {
+		ids, err := cache.IDs(context.Background(), tc.keys)
+		require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", tc.desc, err))
+		assert.Equal(t, tc.ids, ids, fmt.Sprintf("%s: expected %v got %v", tc.desc, tc.ids, ids))
+
+		for _, key := range tc.keys {
+			id, err := cache.ID(context.Background(), key)
+			bulk, ok := ids[key]
+			assert.Equal(t, err == nil, ok, fmt.Sprintf("%s: bulk and single lookup of %s disagree on presence", tc.desc, key))
+			assert.Equal(t, id, bulk, fmt.Sprintf("%s: expected %s for %s got %s", tc.desc, id, key, bulk))
+		}
+	}
+}
+
+func TestThingCacheEviction(t *testing.T) {
+	cache := NewThingCacheWithSize(2)
+	keys := []string{"key1", "key2", "key3"}
+
+	for _, key := range keys[:2] {
+		err := cache.Save(context.Background(), key, "id-"+key)
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	}
+	// Use the first key so that the second one becomes the least recently
+	// used.
+	_, err := cache.ID(context.Background(), keys[0])
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	err = cache.Save(context.Background(), keys[2], "id-"+keys[2])
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+
+	cases := []struct {
+		desc string
+		key  string
+		err  error
+	}{
+		{desc: "retrieve recently used key", key: keys[0], err: nil},
+		{desc: "retrieve evicted key", key: keys[1], err: things.ErrNotFound},
+		{desc: "retrieve recently added key", key: keys[2], err: nil},
+	}
+	for _, tc := range cases {
+		_, err := cache.ID(context.Background(), tc.key)
+		assert.Equal(t, tc.err, err, fmt.Sprintf("%s: expected %v got %v", tc.desc, tc.err, err))
+	}
+}
+
+func TestThingCacheRepopulation(t *testing.T) {
+	token, email := "token", "user@example.com"
+	conns := make(chan Connection)
+	thingsRepo := NewThingRepository(conns)
+	cache := NewThingCacheWithSize(1)
+	svc := things.New(NewAuthService(map[string]string{token: email}), thingsRepo, NewChannelRepository(thingsRepo, conns), nil, NewChannelCache(), cache, uuid.NewMock())
+
+	ths, err := svc.CreateThings(context.Background(), token, things.Thing{Name: "a", Key: "key-a"}, things.Thing{Name: "b", Key: "key-b"})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+
+	for _, th := range []things.Thing{ths[0], ths[1], ths[0]} {
+		id, err := svc.Identify(context.Background(), th.Key)
+		assert.Nil(t, err, fmt.Sprintf("identify thing %s: unexpected error: %s", th.Key, err))
+		assert.Equal(t, th.ID, id, fmt.Sprintf("identify thing %s: expected %s got %s", th.Key, th.ID, id))
+
+		cached, err := cache.ID(context.Background(), th.Key)
+		assert.Nil(t, err, fmt.Sprintf("identify thing %s: expected key to be cached: %s", th.Key, err))
+		assert.Equal(t, th.ID, cached, fmt.Sprintf("identify thing %s: expected cached %s got %s", th.Key, th.ID, cached))
+	}
+	_, err = cache.ID(context.Background(), ths[1].Key)
+	assert.Equal(t, things.ErrNotFound, err, fmt.Sprintf("identify thing %s: expected key to be evicted", ths[1].Key))
+}
+
+func TestThingCacheConcurrency(t *testing.T) {
+	workers, rounds := 16, 200
+
+	cases := []struct {
+		desc string
+		size int
+	}{
+		{desc: "access unbounded cache concurrently", size: 0},
+		{desc: "access bounded cache concurrently", size: workers / 2},
+	}
+
+	for _, tc := range cases {
+		cache := NewThingCacheWithSize(tc.size)
+		errs := make(chan error, workers)
+		var wg sync.WaitGroup
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				key, id := fmt.Sprintf("key-%d", i), fmt.Sprintf("id-%d", i)
+				for j := 0; j < rounds; j++ {
+					if err := cache.Save(context.Background(), key, id); err != nil {
+						errs <- err
+						return
+					}
+					// Only the bounded cache evicts the key of a worker,
+					// and no worker saves another worker's key.
+					if got, err := cache.ID(context.Background(), key); err == nil && got != id {
+						errs <- fmt.Errorf("expected %s for %s got %s", id, key, got)
+						return
+					}
+					ids, err := cache.IDs(context.Background(), []string{key, fmt.Sprintf("key-%d", (i+1)%workers)})
+					if err != nil {
+						errs <- err
+						return
+					}
+					if got, ok := ids[key]; ok && got != id {
+						errs <- fmt.Errorf("expected %s for %s got %s", id, key, got)
+						return
+					}
+					if j%10 == 0 {
+						if err := cache.Remove(context.Background(), id); err != nil {
+							errs <- err
+							return
+						}
+					}
+				}
+			}(i)
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			assert.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", tc.desc, err))
+		}
+
+		cached := 0
+		for i := 0; i < workers; i++ {
+			key := fmt.Sprintf("key-%d", i)
+			id, err := cache.ID(context.Background(), key)
+			if tc.size == 0 {
+				assert.Nil(t, err, fmt.Sprintf("%s: expected %s to be cached: %s", tc.desc, key, err))
+			}
+			if err == nil {
+				cached++
+				assert.Equal(t, fmt.Sprintf("id-%d", i), id, fmt.Sprintf("%s: expected id-%d got %s", tc.desc, i, id))
+			}
+		}
+		if tc.size > 0 {
+			assert.LessOrEqual(t, cached, tc.size, fmt.Sprintf("%s: expected at most %d cached keys got %d", tc.desc, tc.size, cached))
+		}
+	}
+}
+
+// scanByID looks the entity up the way the mocks did before they used
+// the key of the entity.
+func scanByID(keys []string, owner, id string) bool {
+	for _, k := range keys {
+		if k == key(owner, id) {
+			return true
+		}
+	}
+	return false
+}
+
+func BenchmarkRetrieveByID(b *testing.B) {
+	owner := "user@example.com"
+	n := 10000
+	trm := NewThingRepository(make(chan Connection))
+	crm := NewChannelRepository(trm, make(chan Connection))
+
+	var ths []things.Thing
+	var chs []things.Channel
+	for i := 0; i < n; i++ {
+		ths = append(ths, things.Thing{Owner: owner, Key: fmt.Sprintf("key-%d", i)})
+		chs = append(chs, things.Channel{Owner: owner})
+	}
+	ths, err := trm.Save(context.Background(), ths...)
+	require.Nil(b, err, fmt.Sprintf("unexpected error: %s", err))
+	chs, err = crm.Save(context.Background(), chs...)
+	require.Nil(b, err, fmt.Sprintf("unexpected error: %s", err))
+
+	var keys []string
+	for k := range trm.(*thingRepositoryMock).things {
+		keys = append(keys, k)
+	}
+	b.ResetTimer()
+
+	b.Run("things", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			trm.RetrieveByID(context.Background(), owner, ths[i%n].ID)
+		}
+	})
+
+	b.Run("channels", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			crm.RetrieveByID(context.Background(), owner, chs[i%n].ID)
+		}
+	})
+
+	b.Run("scan", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			scanByID(keys, owner, ths[i%n].ID)
+		}
+	})
+}
@@ -0,0 +1,115 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package things
+
+import (
+	"context"
+	"sync"
+)
+
+// ConnectionObserver is notified of the channel-thing connection changes,
+// e.g. to update a routing cache.
+type ConnectionObserver interface {
+	// OnConnect is called once the thing is connected to the channel.
+	OnConnect(ctx context.Context, conn Connection)
+
+	// OnDisconnect is called once the thing is disconnected from the
+	// channel. Once a channel is removed, it's called with the connection
+	// holding the channel ID alone, which stands for all the things
+	// connected to the channel.
+	OnDisconnect(ctx context.Context, conn Connection)
+}
+
+// ObservableChannelRepository is the channel repository notifying the
+// registered observers of the connection changes it makes.
+type ObservableChannelRepository interface {
+	ChannelRepository
+
+	// Register adds the observer, which is notified of the connection
+	// changes made from then on, after the observers registered before.
+	Register(o ConnectionObserver)
+}
+
+var _ ObservableChannelRepository = (*observedChannels)(nil)
+
+type observedChannels struct {
+	ChannelRepository
+	mu        sync.RWMutex
+	observers []ConnectionObserver
+}
+
+// NewObservableChannelRepository returns the channel repository which
+// notifies the registered observers of the successful Connect, Disconnect
+// and Remove calls, in the order the connections change. The observers are
+// called synchronously, so they shouldn't block. Removing a thing
+// disconnects it through the thing repository, which is not observed.
+func NewObservableChannelRepository(repo ChannelRepository) ObservableChannelRepository {
+	return &observedChannels{ChannelRepository: repo}
+}
+
+func (oc *observedChannels) Register(o ConnectionObserver) {
+	oc.mu.Lock()
+	defer oc.mu.Unlock()
+
+	oc.observers = append(oc.observers, o)
+}
+
+func (oc *observedChannels) Connect(ctx context.Context, owner string, chIDs, thIDs []string, limit uint64, actions ...Actions) error {
+	if err := oc.ChannelRepository.Connect(ctx, owner, chIDs, thIDs, limit, actions...); err != nil {
+		return err
+	}
+
+	for _, o := range oc.registered() {
+		for _, chID := range chIDs {
+			for _, thID := range thIDs {
+				o.OnConnect(ctx, Connection{ChannelID: chID, ThingID: thID, Actions: Union(actions...)})
+			}
+		}
+	}
+	return nil
+}
+
+func (oc *observedChannels) Disconnect(ctx context.Context, owner, chanID, thingID string) error {
+	if err := oc.ChannelRepository.Disconnect(ctx, owner, chanID, thingID); err != nil {
+		return err
+	}
+
+	for _, o := range oc.registered() {
+		o.OnDisconnect(ctx, Connection{ChannelID: chanID, ThingID: thingID})
+	}
+	return nil
+}
+
+func (oc *observedChannels) DisconnectMany(ctx context.Context, owner string, chIDs, thIDs []string) error {
+	if err := oc.ChannelRepository.DisconnectMany(ctx, owner, chIDs, thIDs); err != nil {
+		return err
+	}
+
+	for _, o := range oc.registered() {
+		for _, chID := range chIDs {
+			for _, thID := range thIDs {
+				o.OnDisconnect(ctx, Connection{ChannelID: chID, ThingID: thID})
+			}
+		}
+	}
+	return nil
+}
+
+func (oc *observedChannels) Remove(ctx context.Context, owner, id string) error {
+	if err := oc.ChannelRepository.Remove(ctx, owner, id); err != nil {
+		return err
+	}
+
+	for _, o := range oc.registered() {
+		o.OnDisconnect(ctx, Connection{ChannelID: id})
+	}
+	return nil
+}
+
+func (oc *observedChannels) registered() []ConnectionObserver {
+	oc.mu.RLock()
+	defer oc.mu.RUnlock()
+
+	return oc.observers
+}
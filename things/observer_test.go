@@ -0,0 +1,94 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package things_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/mainflux/mainflux/pkg/errors"
+	"github.com/mainflux/mainflux/things"
+	"github.com/mainflux/mainflux/things/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestObservableChannelRepository(t *testing.T) {
+	conns := make(chan mocks.Connection)
+	thingsRepo := mocks.NewThingRepository(conns)
+	repo := things.NewObservableChannelRepository(mocks.NewChannelRepository(thingsRepo, conns))
+
+	ths, err := thingsRepo.Save(context.Background(), things.Thing{Owner: email, Key: "a"}, things.Thing{Owner: email, Key: "b"})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	chs, err := repo.Save(context.Background(), things.Channel{Owner: email}, things.Channel{Owner: email})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	th1, th2, ch1, ch2 := ths[0].ID, ths[1].ID, chs[0].ID, chs[1].ID
+
+	first, second := mocks.NewConnectionObserver(), mocks.NewConnectionObserver()
+	repo.Register(first)
+	repo.Register(second)
+
+	cases := []struct {
+		desc   string
+		run    func() error
+		err    error
+		events []mocks.ConnectionEvent
+	}{
+		{
+			desc: "connect things to channels",
+			run: func() error {
+				return repo.Connect(context.Background(), email, []string{ch1, ch2}, []string{th1, th2}, 0)
+			},
+			events: []mocks.ConnectionEvent{
+				{Connection: things.Connection{ChannelID: ch1, ThingID: th1}, Connected: true},
+				{Connection: things.Connection{ChannelID: ch1, ThingID: th2}, Connected: true},
+				{Connection: things.Connection{ChannelID: ch2, ThingID: th1}, Connected: true},
+				{Connection: things.Connection{ChannelID: ch2, ThingID: th2}, Connected: true},
+			},
+		},
+		{
+			desc: "connect connected thing",
+			run: func() error {
+				return repo.Connect(context.Background(), email, []string{ch1}, []string{th1}, 0)
+			},
+			err: things.ErrConflict,
+		},
+		{
+			desc: "disconnect thing from channel",
+			run: func() error {
+				return repo.Disconnect(context.Background(), email, ch1, th2)
+			},
+			events: []mocks.ConnectionEvent{
+				{Connection: things.Connection{ChannelID: ch1, ThingID: th2}, Connected: false},
+			},
+		},
+		{
+			desc: "disconnect disconnected thing",
+			run: func() error {
+				return repo.Disconnect(context.Background(), email, ch1, th2)
+			},
+			err: things.ErrNotFound,
+		},
+		{
+			desc: "remove channel",
+			run: func() error {
+				return repo.Remove(context.Background(), email, ch2)
+			},
+			events: []mocks.ConnectionEvent{
+				{Connection: things.Connection{ChannelID: ch2}, Connected: false},
+			},
+		},
+	}
+
+	var events []mocks.ConnectionEvent
+	for _, tc := range cases {
+		err := tc.run()
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s\n", tc.desc, tc.err, err))
+		events = append(events, tc.events...)
+		for i, o := range []*mocks.ConnectionObserver{first, second} {
+			assert.Equal(t, events, o.Events(), fmt.Sprintf("%s: expected observer %d events %v got %v\n", tc.desc, i, events, o.Events()))
+		}
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/gofrs/uuid"
 	"github.com/lib/pq"
@@ -20,20 +21,32 @@ import (
 var _ things.ChannelRepository = (*channelRepository)(nil)
 
 type channelRepository struct {
-	db Database
+	db     Database
+	reader Database
+	now    func() time.Time
 }
 
 type dbConnection struct {
 	Channel string `db:"channel"`
 	Thing   string `db:"thing"`
 	Owner   string `db:"owner"`
+	Actions int    `db:"actions"`
 }
 
 // NewChannelRepository instantiates a PostgreSQL implementation of channel
 // repository.
 func NewChannelRepository(db Database) things.ChannelRepository {
+	return NewChannelRepositoryWithReader(db, db)
+}
+
+// NewChannelRepositoryWithReader instantiates a PostgreSQL implementation
+// of channel repository which runs the list queries on the reader, and the
+// others on the database.
+func NewChannelRepositoryWithReader(db, reader Database) things.ChannelRepository {
 	return &channelRepository{
-		db: db,
+		db:     db,
+		reader: reader,
+		now:    time.Now,
 	}
 }
 
@@ -120,6 +133,49 @@ func (cr channelRepository) RetrieveByID(ctx context.Context, owner, id string)
 	return toChannel(dbch), nil
 }
 
+func (cr channelRepository) RetrieveByIDs(ctx context.Context, ids []string) ([]things.Channel, error) {
+	chs := []things.Channel{}
+	if len(ids) == 0 {
+		return chs, nil
+	}
+
+	// Skip malformed identifiers to avoid internal Postgres error.
+	var uuids []string
+	for _, id := range ids {
+		if _, err := uuid.FromString(id); err == nil {
+			uuids = append(uuids, id)
+		}
+	}
+
+	q := `SELECT id, owner, name, metadata FROM channels WHERE id = ANY(CAST(:ids AS UUID[]));`
+	params := map[string]interface{}{
+		"ids": pq.StringArray(uuids),
+	}
+
+	rows, err := cr.db.NamedQueryContext(ctx, q, params)
+	if err != nil {
+		return nil, errors.Wrap(things.ErrSelectEntity, err)
+	}
+	defer rows.Close()
+
+	byID := make(map[string]things.Channel)
+	for rows.Next() {
+		var dbch dbChannel
+		if err := rows.StructScan(&dbch); err != nil {
+			return nil, errors.Wrap(things.ErrSelectEntity, err)
+		}
+		byID[dbch.ID] = toChannel(dbch)
+	}
+
+	for _, id := range ids {
+		if ch, ok := byID[id]; ok {
+			chs = append(chs, ch)
+		}
+	}
+
+	return chs, nil
+}
+
 func (cr channelRepository) RetrieveAll(ctx context.Context, owner string, pm things.PageMetadata) (things.ChannelsPage, error) {
 	nq, name := getNameQuery(pm.Name)
 	oq := getOrderQuery(pm.Order)
@@ -128,18 +184,26 @@ func (cr channelRepository) RetrieveAll(ctx context.Context, owner string, pm th
 	if err != nil {
 		return things.ChannelsPage{}, errors.Wrap(things.ErrSelectEntity, err)
 	}
-
-	q := fmt.Sprintf(`SELECT id, name, metadata FROM channels
-	      WHERE owner = :owner %s%s ORDER BY %s %s LIMIT :limit OFFSET :offset;`, mq, nq, oq, dq)
+	kq := getMetadataKeysQuery(pm.HasMetadataKeys, pm.MissingMetadataKeys)
 
 	params := map[string]interface{}{
-		"owner":    owner,
-		"limit":    pm.Limit,
-		"offset":   pm.Offset,
-		"name":     name,
-		"metadata": meta,
+		"owner":        owner,
+		"limit":        pm.Limit,
+		"offset":       pm.Offset,
+		"name":         name,
+		"metadata":     meta,
+		"has_keys":     pq.StringArray(pm.HasMetadataKeys),
+		"missing_keys": pq.StringArray(pm.MissingMetadataKeys),
+	}
+	aq, err := getAnyOfQuery(pm.AnyOf, params)
+	if err != nil {
+		return things.ChannelsPage{}, errors.Wrap(things.ErrSelectEntity, err)
 	}
-	rows, err := cr.db.NamedQueryContext(ctx, q, params)
+	kq = fmt.Sprintf("%s%s", kq, aq)
+
+	q := fmt.Sprintf(`SELECT id, name, metadata FROM channels
+	      WHERE owner = :owner %s%s%s ORDER BY %s %s LIMIT :limit OFFSET :offset;`, mq, nq, kq, oq, dq)
+	rows, err := cr.reader.NamedQueryContext(ctx, q, params)
 	if err != nil {
 		return things.ChannelsPage{}, errors.Wrap(things.ErrSelectEntity, err)
 	}
@@ -156,9 +220,9 @@ func (cr channelRepository) RetrieveAll(ctx context.Context, owner string, pm th
 		items = append(items, ch)
 	}
 
-	cq := fmt.Sprintf(`SELECT COUNT(*) FROM channels WHERE owner = :owner %s%s;`, nq, mq)
+	cq := fmt.Sprintf(`SELECT COUNT(*) FROM channels WHERE owner = :owner %s%s%s;`, nq, mq, kq)
 
-	total, err := total(ctx, cr.db, cq, params)
+	total, err := total(ctx, cr.reader, cq, params)
 	if err != nil {
 		return things.ChannelsPage{}, errors.Wrap(things.ErrSelectEntity, err)
 	}
@@ -226,7 +290,7 @@ func (cr channelRepository) RetrieveByThing(ctx context.Context, owner, thing st
 		"offset": offset,
 	}
 
-	rows, err := cr.db.NamedQueryContext(ctx, q, params)
+	rows, err := cr.reader.NamedQueryContext(ctx, q, params)
 	if err != nil {
 		return things.ChannelsPage{}, errors.Wrap(things.ErrSelectEntity, err)
 	}
@@ -244,7 +308,7 @@ func (cr channelRepository) RetrieveByThing(ctx context.Context, owner, thing st
 	}
 
 	var total uint64
-	if err := cr.db.GetContext(ctx, &total, qc, owner, thing); err != nil {
+	if err := cr.reader.GetContext(ctx, &total, qc, owner, thing); err != nil {
 		return things.ChannelsPage{}, errors.Wrap(things.ErrSelectEntity, err)
 	}
 
@@ -268,21 +332,36 @@ func (cr channelRepository) Remove(ctx context.Context, owner, id string) error
 	return nil
 }
 
-func (cr channelRepository) Connect(ctx context.Context, owner string, chIDs, thIDs []string) error {
+func (cr channelRepository) Connect(ctx context.Context, owner string, chIDs, thIDs []string, limit uint64, actions ...things.Actions) error {
 	tx, err := cr.db.BeginTxx(ctx, nil)
 	if err != nil {
 		return errors.Wrap(things.ErrConnect, err)
 	}
 
-	q := `INSERT INTO connections (channel_id, channel_owner, thing_id, thing_owner)
-	      VALUES (:channel, :owner, :thing, :owner);`
+	q := `INSERT INTO connections (channel_id, channel_owner, thing_id, thing_owner, actions)
+	      VALUES (:channel, :owner, :thing, :owner, :actions);`
 
 	for _, chID := range chIDs {
+		if limit > 0 {
+			// Lock the channel so that concurrent connections can't
+			// exceed the limit.
+			lq := `SELECT id FROM channels WHERE id = $1 AND owner = $2 FOR UPDATE;`
+			if _, err := tx.ExecContext(ctx, lq, chID, owner); err != nil {
+				tx.Rollback()
+				pqErr, ok := err.(*pq.Error)
+				if ok && pqErr.Code.Name() == errInvalid {
+					return things.ErrNotFound
+				}
+				return errors.Wrap(things.ErrConnect, err)
+			}
+		}
+
 		for _, thID := range thIDs {
 			dbco := dbConnection{
 				Channel: chID,
 				Thing:   thID,
 				Owner:   owner,
+				Actions: int(things.Union(actions...)),
 			}
 
 			_, err := tx.NamedExecContext(ctx, q, dbco)
@@ -301,6 +380,19 @@ func (cr channelRepository) Connect(ctx context.Context, owner string, chIDs, th
 				return errors.Wrap(things.ErrConnect, err)
 			}
 		}
+
+		if limit > 0 {
+			cq := `SELECT COUNT(*) FROM connections WHERE channel_id = $1 AND channel_owner = $2;`
+			var cnt uint64
+			if err := tx.GetContext(ctx, &cnt, cq, chID, owner); err != nil {
+				tx.Rollback()
+				return errors.Wrap(things.ErrConnect, err)
+			}
+			if cnt > limit {
+				tx.Rollback()
+				return things.ErrChannelFull
+			}
+		}
 	}
 
 	if err = tx.Commit(); err != nil {
@@ -338,12 +430,63 @@ func (cr channelRepository) Disconnect(ctx context.Context, owner, chanID, thing
 	return nil
 }
 
+func (cr channelRepository) DisconnectMany(ctx context.Context, owner string, chIDs, thIDs []string) error {
+	tx, err := cr.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(things.ErrDisconnect, err)
+	}
+
+	q := `DELETE FROM connections
+	      WHERE channel_id = :channel AND channel_owner = :owner
+	      AND thing_id = :thing AND thing_owner = :owner`
+
+	for _, chID := range chIDs {
+		for _, thID := range thIDs {
+			conn := dbConnection{
+				Channel: chID,
+				Thing:   thID,
+				Owner:   owner,
+			}
+
+			res, err := tx.NamedExecContext(ctx, q, conn)
+			if err != nil {
+				tx.Rollback()
+				pqErr, ok := err.(*pq.Error)
+				if ok && pqErr.Code.Name() == errInvalid {
+					return things.ErrNotFound
+				}
+				return errors.Wrap(things.ErrDisconnect, err)
+			}
+
+			cnt, err := res.RowsAffected()
+			if err != nil {
+				tx.Rollback()
+				return errors.Wrap(things.ErrDisconnect, err)
+			}
+			if cnt == 0 {
+				tx.Rollback()
+				return things.ErrNotFound
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(things.ErrDisconnect, err)
+	}
+
+	return nil
+}
+
 func (cr channelRepository) HasThing(ctx context.Context, chanID, thingKey string) (string, error) {
 	var thingID string
-	q := `SELECT id FROM things WHERE key = $1`
-	if err := cr.db.QueryRowxContext(ctx, q, thingKey).Scan(&thingID); err != nil {
+	var expiresAt sql.NullTime
+	q := `SELECT thing_id, expires_at FROM thing_keys WHERE key = $1`
+	if err := cr.db.QueryRowxContext(ctx, q, thingKey).Scan(&thingID, &expiresAt); err != nil {
 		return "", errors.Wrap(things.ErrEntityConnected, err)
 	}
+	if expiresAt.Valid && !cr.now().Before(expiresAt.Time) {
+		return "", things.ErrAuthorization
+	}
 
 	if err := cr.hasThing(ctx, chanID, thingID); err != nil {
 		return "", err
@@ -352,8 +495,47 @@ func (cr channelRepository) HasThing(ctx context.Context, chanID, thingKey strin
 	return thingID, nil
 }
 
-func (cr channelRepository) HasThingByID(ctx context.Context, chanID, thingID string) error {
-	return cr.hasThing(ctx, chanID, thingID)
+func (cr channelRepository) RetrieveConnectionsByThing(ctx context.Context, thingID string) ([]string, error) {
+	q := `SELECT channel_id FROM connections WHERE thing_id = :thing ORDER BY channel_id;`
+	params := map[string]interface{}{"thing": thingID}
+
+	rows, err := cr.db.NamedQueryContext(ctx, q, params)
+	if err != nil {
+		return nil, errors.Wrap(things.ErrSelectEntity, err)
+	}
+	defer rows.Close()
+
+	chIDs := []string{}
+	for rows.Next() {
+		var chID string
+		if err := rows.Scan(&chID); err != nil {
+			return nil, errors.Wrap(things.ErrSelectEntity, err)
+		}
+		chIDs = append(chIDs, chID)
+	}
+
+	return chIDs, nil
+}
+
+func (cr channelRepository) HasThingByID(ctx context.Context, chanID, thingID string, actions ...things.Actions) error {
+	required := things.Union(actions...)
+	if required == 0 {
+		return cr.hasThing(ctx, chanID, thingID)
+	}
+
+	q := `SELECT actions FROM connections WHERE channel_id = $1 AND thing_id = $2;`
+	var allowed int
+	if err := cr.db.QueryRowxContext(ctx, q, chanID, thingID).Scan(&allowed); err != nil {
+		if err == sql.ErrNoRows {
+			return things.ErrNotFound
+		}
+		return errors.Wrap(things.ErrEntityConnected, err)
+	}
+	if !things.Actions(allowed).Allows(required) {
+		return things.ErrActionNotAllowed
+	}
+
+	return nil
 }
 
 func (cr channelRepository) hasThing(ctx context.Context, chanID, thingID string) error {
@@ -431,6 +613,39 @@ func toChannel(ch dbChannel) things.Channel {
 	}
 }
 
+func (cr channelRepository) RetrieveAllConnections(ctx context.Context) ([]things.Connection, error) {
+	q := `SELECT channel_id, thing_id, actions FROM connections;`
+
+	rows, err := cr.db.NamedQueryContext(ctx, q, map[string]interface{}{})
+	if err != nil {
+		return nil, errors.Wrap(things.ErrSelectEntity, err)
+	}
+	defer rows.Close()
+
+	var conns []things.Connection
+	for rows.Next() {
+		var c things.Connection
+		var actions int
+		if err := rows.Scan(&c.ChannelID, &c.ThingID, &actions); err != nil {
+			return nil, errors.Wrap(things.ErrSelectEntity, err)
+		}
+		c.Actions = things.Actions(actions)
+		conns = append(conns, c)
+	}
+
+	return conns, nil
+}
+
+func (cr channelRepository) CountAll(ctx context.Context) (uint64, uint64, error) {
+	q := `SELECT (SELECT COUNT(*) FROM channels), (SELECT COUNT(*) FROM connections);`
+
+	var chs, conns uint64
+	if err := cr.db.QueryRowxContext(ctx, q).Scan(&chs, &conns); err != nil {
+		return 0, 0, errors.Wrap(things.ErrSelectEntity, err)
+	}
+	return chs, conns, nil
+}
+
 func getNameQuery(name string) (string, string) {
 	if name == "" {
 		return "", ""
@@ -473,6 +688,49 @@ func getMetadataQuery(m things.Metadata) ([]byte, string, error) {
 	return mb, mq, nil
 }
 
+func getMetadataKeysQuery(has, missing []string) string {
+	kq := ""
+	if len(has) > 0 {
+		kq = ` AND metadata ?& :has_keys`
+	}
+	if len(missing) > 0 {
+		kq = fmt.Sprintf(`%s AND NOT (metadata ?| :missing_keys)`, kq)
+	}
+	return kq
+}
+
+// getAnyOfQuery returns the clause matching the entities which satisfy at
+// least one of the filters and adds the clause parameters to params.
+func getAnyOfQuery(filters []things.Filter, params map[string]interface{}) (string, error) {
+	var fqs []string
+	for i, f := range filters {
+		var preds []string
+		if f.Name != "" {
+			p := fmt.Sprintf("any_name_%d", i)
+			params[p] = fmt.Sprintf(`%%%s%%`, strings.ToLower(f.Name))
+			preds = append(preds, fmt.Sprintf("LOWER(name) LIKE :%s", p))
+		}
+		if len(f.Metadata) > 0 {
+			b, err := json.Marshal(f.Metadata)
+			if err != nil {
+				return "", err
+			}
+			p := fmt.Sprintf("any_metadata_%d", i)
+			params[p] = b
+			preds = append(preds, fmt.Sprintf("metadata @> :%s", p))
+		}
+		if len(preds) == 0 {
+			// An empty filter matches every entity.
+			return "", nil
+		}
+		fqs = append(fqs, fmt.Sprintf("(%s)", strings.Join(preds, " AND ")))
+	}
+	if len(fqs) == 0 {
+		return "", nil
+	}
+	return fmt.Sprintf(" AND (%s)", strings.Join(fqs, " OR ")), nil
+}
+
 func total(ctx context.Context, db Database, query string, params interface{}) (uint64, error) {
 	rows, err := db.NamedQueryContext(ctx, query, params)
 	if err != nil {
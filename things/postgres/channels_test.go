@@ -7,6 +7,7 @@ import (
 	"context"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 
@@ -167,7 +168,7 @@ func TestSingleChannelRetrieval(t *testing.T) {
 	}
 	chs, _ := chanRepo.Save(context.Background(), ch)
 	ch.ID = chs[0].ID
-	chanRepo.Connect(context.Background(), email, []string{ch.ID}, []string{th.ID})
+	chanRepo.Connect(context.Background(), email, []string{ch.ID}, []string{th.ID}, 0)
 
 	nonexistentChanID, err := uuidProvider.New().ID()
 	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
@@ -205,6 +206,55 @@ func TestSingleChannelRetrieval(t *testing.T) {
 	}
 }
 
+func TestChannelRetrieveByIDs(t *testing.T) {
+	email := "channel-retrieval-by-ids@example.com"
+	chanRepo := postgres.NewChannelRepository(postgres.NewDatabase(db))
+
+	var ids []string
+	for i := 0; i < 3; i++ {
+		id, err := uuidProvider.New().ID()
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+		_, err = chanRepo.Save(context.Background(), things.Channel{ID: id, Owner: email})
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+		ids = append(ids, id)
+	}
+
+	nonexistentChanID, err := uuidProvider.New().ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	cases := map[string]struct {
+		ids      []string
+		expected []string
+	}{
+		"retrieve existing channels in the order of the ids": {
+			ids:      []string{ids[2], ids[0], ids[1]},
+			expected: []string{ids[2], ids[0], ids[1]},
+		},
+		"retrieve existing and non-existing channels": {
+			ids:      []string{nonexistentChanID, ids[1], wrongValue, ids[0]},
+			expected: []string{ids[1], ids[0]},
+		},
+		"retrieve non-existing channels": {
+			ids:      []string{nonexistentChanID},
+			expected: []string{},
+		},
+		"retrieve channels without ids": {
+			ids:      []string{},
+			expected: []string{},
+		},
+	}
+
+	for desc, tc := range cases {
+		chs, err := chanRepo.RetrieveByIDs(context.Background(), tc.ids)
+		assert.Nil(t, err, fmt.Sprintf("%s: expected no error got %s\n", desc, err))
+		got := []string{}
+		for _, ch := range chs {
+			got = append(got, ch.ID)
+		}
+		assert.Equal(t, tc.expected, got, fmt.Sprintf("%s: expected %v got %v\n", desc, tc.expected, got))
+	}
+}
+
 func TestMultiChannelRetrieval(t *testing.T) {
 	dbMiddleware := postgres.NewDatabase(db)
 	chanRepo := postgres.NewChannelRepository(dbMiddleware)
@@ -415,7 +465,7 @@ func TestRetrieveByThing(t *testing.T) {
 			break
 		}
 
-		err = chanRepo.Connect(context.Background(), email, []string{cid}, []string{thid})
+		err = chanRepo.Connect(context.Background(), email, []string{cid}, []string{thid}, 0)
 		require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
 	}
 
@@ -597,11 +647,76 @@ func TestConnect(t *testing.T) {
 	}
 
 	for _, tc := range cases {
-		err := chanRepo.Connect(context.Background(), tc.owner, []string{tc.chid}, []string{tc.thid})
+		err := chanRepo.Connect(context.Background(), tc.owner, []string{tc.chid}, []string{tc.thid}, 0)
 		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s\n", tc.desc, tc.err, err))
 	}
 }
 
+func TestConnectLimit(t *testing.T) {
+	email := "channel-connect-limit@example.com"
+	dbMiddleware := postgres.NewDatabase(db)
+	thingRepo := postgres.NewThingRepository(dbMiddleware)
+	chanRepo := postgres.NewChannelRepository(dbMiddleware)
+
+	var thids []string
+	for i := 0; i < 4; i++ {
+		thid, err := uuidProvider.New().ID()
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+		thkey, err := uuidProvider.New().ID()
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+		ths, err := thingRepo.Save(context.Background(), things.Thing{ID: thid, Owner: email, Key: thkey})
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+		thids = append(thids, ths[0].ID)
+	}
+
+	chid, err := uuidProvider.New().ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	chs, err := chanRepo.Save(context.Background(), things.Channel{ID: chid, Owner: email})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+	chid = chs[0].ID
+
+	cases := []struct {
+		desc  string
+		thids []string
+		limit uint64
+		err   error
+	}{
+		{
+			desc:  "connect things under the limit",
+			thids: thids[:2],
+			limit: 3,
+			err:   nil,
+		},
+		{
+			desc:  "connect things over the limit",
+			thids: thids[2:],
+			limit: 3,
+			err:   things.ErrChannelFull,
+		},
+		{
+			desc:  "connect thing up to the limit",
+			thids: thids[2:3],
+			limit: 3,
+			err:   nil,
+		},
+		{
+			desc:  "connect thing without limit",
+			thids: thids[3:],
+			limit: 0,
+			err:   nil,
+		},
+	}
+
+	for _, tc := range cases {
+		err := chanRepo.Connect(context.Background(), email, []string{chid}, tc.thids, tc.limit)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s\n", tc.desc, tc.err, err))
+	}
+
+	page, err := thingRepo.RetrieveByChannel(context.Background(), email, chid, true, things.PageMetadata{Offset: 0, Limit: 10})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+	assert.Equal(t, uint64(4), page.Total, fmt.Sprintf("expected rejected connections to be rolled back got %d connected things", page.Total))
+}
+
 func TestDisconnect(t *testing.T) {
 	email := "channel-disconnect@example.com"
 	dbMiddleware := postgres.NewDatabase(db)
@@ -630,7 +745,7 @@ func TestDisconnect(t *testing.T) {
 	})
 	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
 	chid = chs[0].ID
-	chanRepo.Connect(context.Background(), email, []string{chid}, []string{thid})
+	chanRepo.Connect(context.Background(), email, []string{chid}, []string{thid}, 0)
 
 	nonexistentThingID, err := uuidProvider.New().ID()
 	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
@@ -688,6 +803,69 @@ func TestDisconnect(t *testing.T) {
 	}
 }
 
+func TestDisconnectMany(t *testing.T) {
+	email := "disconnect-many@example.com"
+	dbMiddleware := postgres.NewDatabase(db)
+	thingRepo := postgres.NewThingRepository(dbMiddleware)
+	chanRepo := postgres.NewChannelRepository(dbMiddleware)
+
+	thid, err := uuidProvider.New().ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	thkey, err := uuidProvider.New().ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	_, err = thingRepo.Save(context.Background(), things.Thing{ID: thid, Owner: email, Key: thkey})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+
+	var chids []string
+	for i := 0; i < 2; i++ {
+		chid, err := uuidProvider.New().ID()
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+		_, err = chanRepo.Save(context.Background(), things.Channel{ID: chid, Owner: email})
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+		chids = append(chids, chid)
+	}
+	err = chanRepo.Connect(context.Background(), email, chids, []string{thid}, 0)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+
+	nonexistentChanID, err := uuidProvider.New().ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	cases := []struct {
+		desc      string
+		chids     []string
+		err       error
+		connected bool
+	}{
+		{
+			desc:      "disconnect from connected and non-existing channels",
+			chids:     []string{chids[0], nonexistentChanID, chids[1]},
+			err:       things.ErrNotFound,
+			connected: true,
+		},
+		{
+			desc:      "disconnect from connected channels",
+			chids:     chids,
+			err:       nil,
+			connected: false,
+		},
+		{
+			desc:      "disconnect from disconnected channels",
+			chids:     chids,
+			err:       things.ErrNotFound,
+			connected: false,
+		},
+	}
+
+	for _, tc := range cases {
+		err := chanRepo.DisconnectMany(context.Background(), email, tc.chids, []string{thid})
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s\n", tc.desc, tc.err, err))
+		for _, chid := range chids {
+			err := chanRepo.HasThingByID(context.Background(), chid, thid)
+			assert.Equal(t, tc.connected, err == nil, fmt.Sprintf("%s: expected connection to channel %s to be %t got %s\n", tc.desc, chid, tc.connected, err))
+		}
+	}
+}
+
 func TestHasThing(t *testing.T) {
 	email := "channel-access-check@example.com"
 	dbMiddleware := postgres.NewDatabase(db)
@@ -697,15 +875,22 @@ func TestHasThing(t *testing.T) {
 	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
 	thkey, err := uuidProvider.New().ID()
 	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	extraKey, err := uuidProvider.New().ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	expiredKey, err := uuidProvider.New().ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
 
 	th := things.Thing{
 		ID:    thid,
 		Owner: email,
 		Key:   thkey,
+		Keys:  []string{extraKey},
 	}
 	ths, err := thingRepo.Save(context.Background(), th)
 	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
 	thid = ths[0].ID
+	err = thingRepo.SaveTemporaryKey(context.Background(), email, thid, expiredKey, time.Now().Add(-time.Minute))
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
 
 	chanRepo := postgres.NewChannelRepository(dbMiddleware)
 	chid, err := uuidProvider.New().ID()
@@ -716,7 +901,7 @@ func TestHasThing(t *testing.T) {
 	})
 	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
 	chid = chs[0].ID
-	chanRepo.Connect(context.Background(), email, []string{chid}, []string{thid})
+	chanRepo.Connect(context.Background(), email, []string{chid}, []string{thid}, 0)
 
 	nonexistentChanID, err := uuidProvider.New().ID()
 	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
@@ -731,6 +916,16 @@ func TestHasThing(t *testing.T) {
 			key:       th.Key,
 			hasAccess: true,
 		},
+		"access check for thing that has access by additional key": {
+			chid:      chid,
+			key:       extraKey,
+			hasAccess: true,
+		},
+		"access check for thing with expired key": {
+			chid:      chid,
+			key:       expiredKey,
+			hasAccess: false,
+		},
 		"access check for thing without access": {
 			chid:      chid,
 			key:       wrongValue,
@@ -791,7 +986,7 @@ func TestHasThingByID(t *testing.T) {
 	})
 	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
 	chid = chs[0].ID
-	chanRepo.Connect(context.Background(), email, []string{chid}, []string{thid})
+	chanRepo.Connect(context.Background(), email, []string{chid}, []string{thid}, 0)
 
 	nonexistentChanID, err := uuidProvider.New().ID()
 	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
@@ -829,3 +1024,175 @@ func TestHasThingByID(t *testing.T) {
 		assert.Equal(t, tc.hasAccess, hasAccess, fmt.Sprintf("%s: expected %t got %t\n", desc, tc.hasAccess, hasAccess))
 	}
 }
+
+func TestHasThingByIDActions(t *testing.T) {
+	email := "channel-actions-check@example.com"
+	dbMiddleware := postgres.NewDatabase(db)
+	thingRepo := postgres.NewThingRepository(dbMiddleware)
+	chanRepo := postgres.NewChannelRepository(dbMiddleware)
+
+	var thids []string
+	for i := 0; i < 2; i++ {
+		thid, err := uuidProvider.New().ID()
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+		thkey, err := uuidProvider.New().ID()
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+		_, err = thingRepo.Save(context.Background(), things.Thing{ID: thid, Owner: email, Key: thkey})
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+		thids = append(thids, thid)
+	}
+	pub, sub := thids[0], thids[1]
+
+	chid, err := uuidProvider.New().ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	_, err = chanRepo.Save(context.Background(), things.Channel{ID: chid, Owner: email})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+	err = chanRepo.Connect(context.Background(), email, []string{chid}, []string{pub}, 0, things.ActionPublish)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+	err = chanRepo.Connect(context.Background(), email, []string{chid}, []string{sub}, 0, things.ActionSubscribe)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+
+	cases := map[string]struct {
+		thid   string
+		action things.Actions
+		err    error
+	}{
+		"publish over publish-only connection": {
+			thid:   pub,
+			action: things.ActionPublish,
+			err:    nil,
+		},
+		"subscribe over publish-only connection": {
+			thid:   pub,
+			action: things.ActionSubscribe,
+			err:    things.ErrActionNotAllowed,
+		},
+		"subscribe over subscribe-only connection": {
+			thid:   sub,
+			action: things.ActionSubscribe,
+			err:    nil,
+		},
+		"publish over subscribe-only connection": {
+			thid:   sub,
+			action: things.ActionPublish,
+			err:    things.ErrActionNotAllowed,
+		},
+	}
+
+	for desc, tc := range cases {
+		err := chanRepo.HasThingByID(context.Background(), chid, tc.thid, tc.action)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s\n", desc, tc.err, err))
+	}
+
+	conns, err := chanRepo.RetrieveAllConnections(context.Background())
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+	assert.Contains(t, conns, things.Connection{ChannelID: chid, ThingID: pub, Actions: things.ActionPublish}, "expected publish-only connection")
+	assert.Contains(t, conns, things.Connection{ChannelID: chid, ThingID: sub, Actions: things.ActionSubscribe}, "expected subscribe-only connection")
+}
+
+func TestRetrieveConnectionsByThing(t *testing.T) {
+	email := "channel-connections-by-thing@example.com"
+	dbMiddleware := postgres.NewDatabase(db)
+	thingRepo := postgres.NewThingRepository(dbMiddleware)
+	chanRepo := postgres.NewChannelRepository(dbMiddleware)
+
+	var thids []string
+	for i := 0; i < 2; i++ {
+		thid, err := uuidProvider.New().ID()
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+		thkey, err := uuidProvider.New().ID()
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+		_, err = thingRepo.Save(context.Background(), things.Thing{ID: thid, Owner: email, Key: thkey})
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+		thids = append(thids, thid)
+	}
+
+	var chids []string
+	for i := 0; i < 2; i++ {
+		chid, err := uuidProvider.New().ID()
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+		_, err = chanRepo.Save(context.Background(), things.Channel{ID: chid, Owner: email})
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+		chids = append(chids, chid)
+	}
+	err := chanRepo.Connect(context.Background(), email, chids, thids[:1], 0)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+
+	nonexistentThID, err := uuidProvider.New().ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	cases := map[string]struct {
+		thid  string
+		chids []string
+	}{
+		"retrieve connections of connected thing": {
+			thid:  thids[0],
+			chids: chids,
+		},
+		"retrieve connections of disconnected thing": {
+			thid:  thids[1],
+			chids: []string{},
+		},
+		"retrieve connections of non-existing thing": {
+			thid:  nonexistentThID,
+			chids: []string{},
+		},
+	}
+
+	for desc, tc := range cases {
+		chids, err := chanRepo.RetrieveConnectionsByThing(context.Background(), tc.thid)
+		assert.Nil(t, err, fmt.Sprintf("%s: expected no error got %s\n", desc, err))
+		assert.ElementsMatch(t, tc.chids, chids, fmt.Sprintf("%s: expected %v got %v\n", desc, tc.chids, chids))
+	}
+}
+
+func TestCountAll(t *testing.T) {
+	email := "count-all@example.com"
+	dbMiddleware := postgres.NewDatabase(db)
+	thingRepo := postgres.NewThingRepository(dbMiddleware)
+	chanRepo := postgres.NewChannelRepository(dbMiddleware)
+
+	// The database is shared by the tests, so the counts are compared to
+	// the ones before the entities are created.
+	ths, err := thingRepo.CountAll(context.Background())
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+	chs, conns, err := chanRepo.CountAll(context.Background())
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+
+	var thids []string
+	for i := 0; i < 2; i++ {
+		thid, err := uuidProvider.New().ID()
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+		thkey, err := uuidProvider.New().ID()
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+		_, err = thingRepo.Save(context.Background(), things.Thing{ID: thid, Owner: email, Key: thkey})
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+		thids = append(thids, thid)
+	}
+
+	var chids []string
+	for i := 0; i < 3; i++ {
+		chid, err := uuidProvider.New().ID()
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+		_, err = chanRepo.Save(context.Background(), things.Channel{ID: chid, Owner: email})
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+		chids = append(chids, chid)
+	}
+	err = chanRepo.Connect(context.Background(), email, chids[:2], thids, 0)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+
+	gotThs, err := thingRepo.CountAll(context.Background())
+	assert.Nil(t, err, fmt.Sprintf("count created entities: unexpected error: %s\n", err))
+	assert.Equal(t, ths+2, gotThs, fmt.Sprintf("count created entities: expected %d things got %d\n", ths+2, gotThs))
+	gotChs, gotConns, err := chanRepo.CountAll(context.Background())
+	assert.Nil(t, err, fmt.Sprintf("count created entities: unexpected error: %s\n", err))
+	assert.Equal(t, chs+3, gotChs, fmt.Sprintf("count created entities: expected %d channels got %d\n", chs+3, gotChs))
+	assert.Equal(t, conns+4, gotConns, fmt.Sprintf("count created entities: expected %d connections got %d\n", conns+4, gotConns))
+
+	err = chanRepo.Remove(context.Background(), email, chids[0])
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+	gotChs, gotConns, err = chanRepo.CountAll(context.Background())
+	assert.Nil(t, err, fmt.Sprintf("count after channel removal: unexpected error: %s\n", err))
+	assert.Equal(t, chs+2, gotChs, fmt.Sprintf("count after channel removal: expected %d channels got %d\n", chs+2, gotChs))
+	assert.Equal(t, conns+2, gotConns, fmt.Sprintf("count after channel removal: expected %d connections got %d\n", conns+2, gotConns))
+}
@@ -3,8 +3,11 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"fmt"
+	"sync"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/mainflux/mainflux/logger"
 	"github.com/opentracing/opentracing-go"
 )
 
@@ -60,6 +63,82 @@ func (dm database) BeginTxx(ctx context.Context, opts *sql.TxOptions) (*sqlx.Tx,
 	return dm.db.BeginTxx(ctx, opts)
 }
 
+var _ Database = (*replicaDatabase)(nil)
+
+type replicaDatabase struct {
+	primary  Database
+	replica  Database
+	logger   logger.Logger
+	mu       sync.Mutex
+	degraded bool
+}
+
+// NewReplicaDatabase returns the database which runs the queries on the
+// read-only replica and falls back to the primary when the replica fails
+// to run them. The statements which may modify the data, and the
+// transactions, always run on the primary. Entering and leaving the
+// fallback is logged as a warning and as info.
+func NewReplicaDatabase(primary, replica Database, logger logger.Logger) Database {
+	return &replicaDatabase{
+		primary: primary,
+		replica: replica,
+		logger:  logger,
+	}
+}
+
+func (rd *replicaDatabase) NamedExecContext(ctx context.Context, query string, args interface{}) (sql.Result, error) {
+	return rd.primary.NamedExecContext(ctx, query, args)
+}
+
+func (rd *replicaDatabase) QueryRowxContext(ctx context.Context, query string, args ...interface{}) *sqlx.Row {
+	row := rd.replica.QueryRowxContext(ctx, query, args...)
+	if !rd.fallback(ctx, row.Err()) {
+		return row
+	}
+	return rd.primary.QueryRowxContext(ctx, query, args...)
+}
+
+func (rd *replicaDatabase) NamedQueryContext(ctx context.Context, query string, args interface{}) (*sqlx.Rows, error) {
+	rows, err := rd.replica.NamedQueryContext(ctx, query, args)
+	if !rd.fallback(ctx, err) {
+		return rows, err
+	}
+	return rd.primary.NamedQueryContext(ctx, query, args)
+}
+
+func (rd *replicaDatabase) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	err := rd.replica.GetContext(ctx, dest, query, args...)
+	if !rd.fallback(ctx, err) {
+		return err
+	}
+	return rd.primary.GetContext(ctx, dest, query, args...)
+}
+
+func (rd *replicaDatabase) BeginTxx(ctx context.Context, opts *sql.TxOptions) (*sqlx.Tx, error) {
+	return rd.primary.BeginTxx(ctx, opts)
+}
+
+// fallback reports whether the query which failed on the replica with the
+// error is to be run on the primary, and tracks whether the replica is
+// failing. Queries without results and canceled queries don't fall back.
+func (rd *replicaDatabase) fallback(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	failed := err != nil && err != sql.ErrNoRows
+
+	rd.mu.Lock()
+	defer rd.mu.Unlock()
+	switch {
+	case failed && !rd.degraded:
+		rd.logger.Warn(fmt.Sprintf("Failed to query the read replica, querying the primary database: %s", err))
+	case !failed && rd.degraded:
+		rd.logger.Info("Querying the read replica again")
+	}
+	rd.degraded = failed
+	return failed
+}
+
 func addSpanTags(ctx context.Context, query string) {
 	span := opentracing.SpanFromContext(ctx)
 	if span != nil {
@@ -0,0 +1,181 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package postgres_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/mainflux/mainflux/pkg/errors"
+	"github.com/mainflux/mainflux/things/postgres"
+	"github.com/stretchr/testify/assert"
+)
+
+var errUnavailable = errors.New("connection refused")
+
+// databaseStub counts the statements it runs, failing the queries with
+// the error. Without the error, the statements run on the database, if
+// any.
+type databaseStub struct {
+	db    postgres.Database
+	err   error
+	calls map[string]int
+}
+
+func newDatabaseStub(db postgres.Database, err error) *databaseStub {
+	return &databaseStub{db: db, err: err, calls: make(map[string]int)}
+}
+
+func (ds *databaseStub) NamedExecContext(ctx context.Context, query string, args interface{}) (sql.Result, error) {
+	ds.calls["exec"]++
+	if ds.db == nil {
+		return nil, nil
+	}
+	return ds.db.NamedExecContext(ctx, query, args)
+}
+
+func (ds *databaseStub) QueryRowxContext(ctx context.Context, query string, args ...interface{}) *sqlx.Row {
+	ds.calls["row"]++
+	if ds.db == nil {
+		return &sqlx.Row{}
+	}
+	return ds.db.QueryRowxContext(ctx, query, args...)
+}
+
+func (ds *databaseStub) NamedQueryContext(ctx context.Context, query string, args interface{}) (*sqlx.Rows, error) {
+	ds.calls["query"]++
+	if ds.err != nil || ds.db == nil {
+		return nil, ds.err
+	}
+	return ds.db.NamedQueryContext(ctx, query, args)
+}
+
+func (ds *databaseStub) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	ds.calls["get"]++
+	if ds.err != nil || ds.db == nil {
+		return ds.err
+	}
+	return ds.db.GetContext(ctx, dest, query, args...)
+}
+
+func (ds *databaseStub) BeginTxx(ctx context.Context, opts *sql.TxOptions) (*sqlx.Tx, error) {
+	ds.calls["tx"]++
+	if ds.db == nil {
+		return nil, nil
+	}
+	return ds.db.BeginTxx(ctx, opts)
+}
+
+func TestReplicaDatabase(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	cases := []struct {
+		desc    string
+		ctx     context.Context
+		err     error
+		run     func(context.Context, postgres.Database) error
+		res     error
+		replica map[string]int
+		primary map[string]int
+	}{
+		{
+			desc: "query available replica",
+			ctx:  context.Background(),
+			run: func(ctx context.Context, db postgres.Database) error {
+				_, err := db.NamedQueryContext(ctx, "SELECT", nil)
+				return err
+			},
+			replica: map[string]int{"query": 1},
+			primary: map[string]int{},
+		},
+		{
+			desc: "query row of available replica",
+			ctx:  context.Background(),
+			run: func(ctx context.Context, db postgres.Database) error {
+				return db.QueryRowxContext(ctx, "SELECT").Err()
+			},
+			replica: map[string]int{"row": 1},
+			primary: map[string]int{},
+		},
+		{
+			desc: "get missing row from available replica",
+			ctx:  context.Background(),
+			err:  sql.ErrNoRows,
+			run: func(ctx context.Context, db postgres.Database) error {
+				var n uint64
+				return db.GetContext(ctx, &n, "SELECT")
+			},
+			res:     sql.ErrNoRows,
+			replica: map[string]int{"get": 1},
+			primary: map[string]int{},
+		},
+		{
+			desc: "query unavailable replica",
+			ctx:  context.Background(),
+			err:  errUnavailable,
+			run: func(ctx context.Context, db postgres.Database) error {
+				_, err := db.NamedQueryContext(ctx, "SELECT", nil)
+				return err
+			},
+			replica: map[string]int{"query": 1},
+			primary: map[string]int{"query": 1},
+		},
+		{
+			desc: "get from unavailable replica",
+			ctx:  context.Background(),
+			err:  errUnavailable,
+			run: func(ctx context.Context, db postgres.Database) error {
+				var n uint64
+				return db.GetContext(ctx, &n, "SELECT")
+			},
+			replica: map[string]int{"get": 1},
+			primary: map[string]int{"get": 1},
+		},
+		{
+			desc: "query unavailable replica with canceled context",
+			ctx:  canceled,
+			err:  errUnavailable,
+			run: func(ctx context.Context, db postgres.Database) error {
+				_, err := db.NamedQueryContext(ctx, "SELECT", nil)
+				return err
+			},
+			res:     errUnavailable,
+			replica: map[string]int{"query": 1},
+			primary: map[string]int{},
+		},
+		{
+			desc: "execute statement",
+			ctx:  context.Background(),
+			run: func(ctx context.Context, db postgres.Database) error {
+				_, err := db.NamedExecContext(ctx, "UPDATE", nil)
+				return err
+			},
+			replica: map[string]int{},
+			primary: map[string]int{"exec": 1},
+		},
+		{
+			desc: "begin transaction",
+			ctx:  context.Background(),
+			run: func(ctx context.Context, db postgres.Database) error {
+				_, err := db.BeginTxx(ctx, nil)
+				return err
+			},
+			replica: map[string]int{},
+			primary: map[string]int{"tx": 1},
+		},
+	}
+
+	for _, tc := range cases {
+		primary, replica := newDatabaseStub(nil, nil), newDatabaseStub(nil, tc.err)
+		db := postgres.NewReplicaDatabase(primary, replica, testLog)
+		err := tc.run(tc.ctx, db)
+		assert.Equal(t, tc.res, err, fmt.Sprintf("%s: expected %s got %s\n", tc.desc, tc.res, err))
+		assert.Equal(t, tc.replica, replica.calls, fmt.Sprintf("%s: expected replica statements %v got %v\n", tc.desc, tc.replica, replica.calls))
+		assert.Equal(t, tc.primary, primary.calls, fmt.Sprintf("%s: expected primary statements %v got %v\n", tc.desc, tc.primary, primary.calls))
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/mainflux/mainflux/pkg/errors"
+	"github.com/mainflux/mainflux/things"
+)
+
+var _ things.ConnectionEventRepository = (*connectionEventRepository)(nil)
+
+type connectionEventRepository struct {
+	db Database
+}
+
+type dbConnectionEvent struct {
+	ChannelID  string    `db:"channel_id"`
+	ThingID    string    `db:"thing_id"`
+	Owner      string    `db:"owner"`
+	Actor      string    `db:"actor"`
+	Type       string    `db:"type"`
+	OccurredAt time.Time `db:"occurred_at"`
+}
+
+// NewConnectionEventRepository instantiates a PostgreSQL implementation of
+// connection history.
+func NewConnectionEventRepository(db Database) things.ConnectionEventRepository {
+	return &connectionEventRepository{
+		db: db,
+	}
+}
+
+func (er connectionEventRepository) Save(ctx context.Context, events ...things.ConnectionEvent) error {
+	tx, err := er.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(things.ErrCreateEntity, err)
+	}
+
+	q := `INSERT INTO connection_events (channel_id, thing_id, owner, actor, type, occurred_at)
+	      VALUES (:channel_id, :thing_id, :owner, :actor, :type, :occurred_at);`
+
+	for _, e := range events {
+		dbe := dbConnectionEvent{
+			ChannelID:  e.ChannelID,
+			ThingID:    e.ThingID,
+			Owner:      e.Owner,
+			Actor:      e.Actor,
+			Type:       e.Type,
+			OccurredAt: e.Timestamp,
+		}
+		if _, err := tx.NamedExecContext(ctx, q, dbe); err != nil {
+			tx.Rollback()
+			return errors.Wrap(things.ErrCreateEntity, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(things.ErrCreateEntity, err)
+	}
+	return nil
+}
+
+func (er connectionEventRepository) RetrieveByThing(ctx context.Context, owner, thingID string, offset, limit uint64) (things.ConnectionEventsPage, error) {
+	return er.retrieve(ctx, "thing_id", owner, thingID, offset, limit)
+}
+
+func (er connectionEventRepository) RetrieveByChannel(ctx context.Context, owner, chanID string, offset, limit uint64) (things.ConnectionEventsPage, error) {
+	return er.retrieve(ctx, "channel_id", owner, chanID, offset, limit)
+}
+
+// retrieve returns the page of the owner's events whose column matches the
+// ID. Events recorded at the same time are ordered by insertion.
+func (er connectionEventRepository) retrieve(ctx context.Context, col, owner, id string, offset, limit uint64) (things.ConnectionEventsPage, error) {
+	page := things.ConnectionEventsPage{
+		PageMetadata: things.PageMetadata{
+			Offset: offset,
+			Limit:  limit,
+		},
+		Events: []things.ConnectionEvent{},
+	}
+	// Only UUIDs can have events, and other IDs would fail the query.
+	if _, err := uuid.FromString(id); err != nil {
+		return page, nil
+	}
+
+	wq := fmt.Sprintf(`WHERE owner = :owner AND %s = :id`, col)
+	q := fmt.Sprintf(`SELECT channel_id, thing_id, owner, actor, type, occurred_at FROM connection_events
+	      %s ORDER BY occurred_at, id LIMIT :limit OFFSET :offset;`, wq)
+	params := map[string]interface{}{
+		"owner":  owner,
+		"id":     id,
+		"limit":  limit,
+		"offset": offset,
+	}
+
+	rows, err := er.db.NamedQueryContext(ctx, q, params)
+	if err != nil {
+		return things.ConnectionEventsPage{}, errors.Wrap(things.ErrSelectEntity, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var dbe dbConnectionEvent
+		if err := rows.StructScan(&dbe); err != nil {
+			return things.ConnectionEventsPage{}, errors.Wrap(things.ErrSelectEntity, err)
+		}
+		page.Events = append(page.Events, things.ConnectionEvent{
+			ChannelID: dbe.ChannelID,
+			ThingID:   dbe.ThingID,
+			Owner:     dbe.Owner,
+			Actor:     dbe.Actor,
+			Type:      dbe.Type,
+			Timestamp: dbe.OccurredAt,
+		})
+	}
+
+	cq := fmt.Sprintf(`SELECT COUNT(*) FROM connection_events %s;`, wq)
+	if page.Total, err = total(ctx, er.db, cq, params); err != nil {
+		return things.ConnectionEventsPage{}, errors.Wrap(things.ErrSelectEntity, err)
+	}
+
+	return page, nil
+}
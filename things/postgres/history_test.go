@@ -0,0 +1,137 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package postgres_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	uuidProvider "github.com/mainflux/mainflux/pkg/uuid"
+	"github.com/mainflux/mainflux/things"
+	"github.com/mainflux/mainflux/things/postgres"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnectionEventsRetrieval(t *testing.T) {
+	email := "connection-events@example.com"
+	dbMiddleware := postgres.NewDatabase(db)
+	eventRepo := postgres.NewConnectionEventRepository(dbMiddleware)
+
+	chID, err := uuidProvider.New().ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	otherChID, err := uuidProvider.New().ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	thID, err := uuidProvider.New().ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	// Save the events out of order to assert they are retrieved by time.
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	n := 6
+	var events []things.ConnectionEvent
+	for i := n - 1; i >= 0; i-- {
+		typ := things.ConnectEvent
+		if i%2 == 1 {
+			typ = things.DisconnectEvent
+		}
+		events = append(events, things.ConnectionEvent{
+			ChannelID: chID,
+			ThingID:   thID,
+			Owner:     email,
+			Actor:     email,
+			Type:      typ,
+			Timestamp: now.Add(time.Duration(i) * time.Second),
+		})
+	}
+	events = append(events, things.ConnectionEvent{
+		ChannelID: otherChID,
+		ThingID:   thID,
+		Owner:     email,
+		Actor:     email,
+		Type:      things.ConnectEvent,
+		Timestamp: now.Add(time.Minute),
+	})
+	err = eventRepo.Save(context.Background(), events...)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+
+	cases := map[string]struct {
+		retrieve func(ctx context.Context, owner, id string, offset, limit uint64) (things.ConnectionEventsPage, error)
+		owner    string
+		id       string
+		offset   uint64
+		limit    uint64
+		size     uint64
+		total    uint64
+	}{
+		"retrieve thing events": {
+			retrieve: eventRepo.RetrieveByThing,
+			owner:    email,
+			id:       thID,
+			offset:   0,
+			limit:    10,
+			size:     uint64(n) + 1,
+			total:    uint64(n) + 1,
+		},
+		"retrieve channel events": {
+			retrieve: eventRepo.RetrieveByChannel,
+			owner:    email,
+			id:       chID,
+			offset:   0,
+			limit:    10,
+			size:     uint64(n),
+			total:    uint64(n),
+		},
+		"retrieve channel events with offset": {
+			retrieve: eventRepo.RetrieveByChannel,
+			owner:    email,
+			id:       chID,
+			offset:   4,
+			limit:    10,
+			size:     2,
+			total:    uint64(n),
+		},
+		"retrieve channel events of other owner": {
+			retrieve: eventRepo.RetrieveByChannel,
+			owner:    wrongValue,
+			id:       chID,
+			offset:   0,
+			limit:    10,
+			size:     0,
+			total:    0,
+		},
+		"retrieve events of invalid ID": {
+			retrieve: eventRepo.RetrieveByThing,
+			owner:    email,
+			id:       wrongValue,
+			offset:   0,
+			limit:    10,
+			size:     0,
+			total:    0,
+		},
+	}
+
+	for desc, tc := range cases {
+		page, err := tc.retrieve(context.Background(), tc.owner, tc.id, tc.offset, tc.limit)
+		assert.Nil(t, err, fmt.Sprintf("%s: expected no error got %s\n", desc, err))
+		size := uint64(len(page.Events))
+		assert.Equal(t, tc.size, size, fmt.Sprintf("%s: expected %d events got %d\n", desc, tc.size, size))
+		assert.Equal(t, tc.total, page.Total, fmt.Sprintf("%s: expected total %d got %d\n", desc, tc.total, page.Total))
+		for i := 1; i < len(page.Events); i++ {
+			assert.False(t, page.Events[i].Timestamp.Before(page.Events[i-1].Timestamp), fmt.Sprintf("%s: expected events in chronological order\n", desc))
+		}
+	}
+
+	page, err := eventRepo.RetrieveByChannel(context.Background(), email, chID, 0, 10)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	for i, e := range page.Events {
+		typ := things.ConnectEvent
+		if i%2 == 1 {
+			typ = things.DisconnectEvent
+		}
+		assert.Equal(t, typ, e.Type, fmt.Sprintf("expected event %d to be %s got %s\n", i, typ, e.Type))
+		assert.Equal(t, email, e.Actor, fmt.Sprintf("expected event %d actor %s got %s\n", i, email, e.Actor))
+	}
+}
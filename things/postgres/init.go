@@ -42,6 +42,13 @@ func Connect(cfg Config) (*sqlx.DB, error) {
 	return db, nil
 }
 
+// ConnectReplica creates a connection to the read-only PostgreSQL replica,
+// which doesn't apply the migrations.
+func ConnectReplica(cfg Config) (*sqlx.DB, error) {
+	url := fmt.Sprintf("host=%s port=%s user=%s dbname=%s password=%s sslmode=%s sslcert=%s sslkey=%s sslrootcert=%s", cfg.Host, cfg.Port, cfg.User, cfg.Name, cfg.Pass, cfg.SSLMode, cfg.SSLCert, cfg.SSLKey, cfg.SSLRootCert)
+	return sqlx.Open("postgres", url)
+}
+
 func migrateDB(db *sqlx.DB) error {
 	migrations := &migrate.MemoryMigrationSource{
 		Migrations: []*migrate.Migration{
@@ -121,6 +128,77 @@ func migrateDB(db *sqlx.DB) error {
 					`CREATE INDEX path_gist_idx ON thing_groups USING GIST (path);`,
 				},
 			},
+			{
+				Id: "things_5",
+				Up: []string{
+					`ALTER TABLE IF EXISTS connections ADD COLUMN IF NOT EXISTS
+					 connected_at TIMESTAMPTZ NOT NULL DEFAULT NOW()`,
+				},
+			},
+			{
+				Id: "things_6",
+				Up: []string{
+					`CREATE TABLE IF NOT EXISTS thing_keys (
+						key         VARCHAR(4096) PRIMARY KEY,
+						thing_id    UUID NOT NULL,
+						thing_owner VARCHAR(254) NOT NULL,
+						FOREIGN KEY (thing_id, thing_owner) REFERENCES things (id, owner) ON DELETE CASCADE ON UPDATE CASCADE
+					)`,
+					`INSERT INTO thing_keys (key, thing_id, thing_owner)
+					 SELECT key, id, owner FROM things ON CONFLICT DO NOTHING`,
+				},
+				Down: []string{
+					"DROP TABLE thing_keys",
+				},
+			},
+			{
+				Id: "things_7",
+				Up: []string{
+					`CREATE TABLE IF NOT EXISTS connection_events (
+						id          BIGSERIAL PRIMARY KEY,
+						channel_id  UUID NOT NULL,
+						thing_id    UUID NOT NULL,
+						owner       VARCHAR(254) NOT NULL,
+						actor       VARCHAR(254) NOT NULL,
+						type        VARCHAR(16) NOT NULL,
+						occurred_at TIMESTAMPTZ NOT NULL
+					)`,
+					`CREATE INDEX IF NOT EXISTS connection_events_thing_idx ON connection_events (owner, thing_id, occurred_at)`,
+					`CREATE INDEX IF NOT EXISTS connection_events_channel_idx ON connection_events (owner, channel_id, occurred_at)`,
+				},
+				Down: []string{
+					"DROP TABLE connection_events",
+				},
+			},
+			{
+				Id: "things_8",
+				Up: []string{
+					`ALTER TABLE IF EXISTS things ADD COLUMN IF NOT EXISTS status VARCHAR(16) NOT NULL DEFAULT 'enabled'`,
+				},
+				Down: []string{
+					"ALTER TABLE IF EXISTS things DROP COLUMN IF EXISTS status",
+				},
+			},
+			{
+				Id: "things_9",
+				Up: []string{
+					`ALTER TABLE IF EXISTS thing_keys ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ`,
+					`CREATE INDEX IF NOT EXISTS thing_keys_expires_at_idx ON thing_keys (expires_at) WHERE expires_at IS NOT NULL`,
+				},
+				Down: []string{
+					"DROP INDEX IF EXISTS thing_keys_expires_at_idx",
+					"ALTER TABLE IF EXISTS thing_keys DROP COLUMN IF EXISTS expires_at",
+				},
+			},
+			{
+				Id: "things_10",
+				Up: []string{
+					`ALTER TABLE IF EXISTS connections ADD COLUMN IF NOT EXISTS actions SMALLINT NOT NULL DEFAULT 0`,
+				},
+				Down: []string{
+					"ALTER TABLE IF EXISTS connections DROP COLUMN IF EXISTS actions",
+				},
+			},
 		},
 	}
 
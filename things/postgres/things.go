@@ -8,6 +8,10 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gofrs/uuid"
 	"github.com/lib/pq" // required for DB access
@@ -30,14 +34,36 @@ var (
 var _ things.ThingRepository = (*thingRepository)(nil)
 
 type thingRepository struct {
-	db Database
+	db     Database
+	reader Database
+	now    func() time.Time
 }
 
 // NewThingRepository instantiates a PostgreSQL implementation of thing
 // repository.
 func NewThingRepository(db Database) things.ThingRepository {
+	return NewThingRepositoryWithClock(db, time.Now)
+}
+
+// NewThingRepositoryWithClock instantiates a PostgreSQL implementation of
+// thing repository which checks the expiry of the temporary keys against
+// the provided clock.
+func NewThingRepositoryWithClock(db Database, now func() time.Time) things.ThingRepository {
 	return &thingRepository{
-		db: db,
+		db:     db,
+		reader: db,
+		now:    now,
+	}
+}
+
+// NewThingRepositoryWithReader instantiates a PostgreSQL implementation of
+// thing repository which runs the list queries on the reader, such as the
+// database returned by NewReplicaDatabase, and the others on the database.
+func NewThingRepositoryWithReader(db, reader Database) things.ThingRepository {
+	return &thingRepository{
+		db:     db,
+		reader: reader,
+		now:    time.Now,
 	}
 }
 
@@ -47,28 +73,33 @@ func (tr thingRepository) Save(ctx context.Context, ths ...things.Thing) ([]thin
 		return []things.Thing{}, errors.Wrap(things.ErrCreateEntity, err)
 	}
 
-	q := `INSERT INTO things (id, owner, name, key, metadata)
-		  VALUES (:id, :owner, :name, :key, :metadata);`
+	q := `INSERT INTO things (id, owner, name, key, metadata, status)
+		  VALUES (:id, :owner, :name, :key, :metadata, :status);`
+	kq := `INSERT INTO thing_keys (key, thing_id, thing_owner)
+		   VALUES (:key, :thing_id, :thing_owner);`
 
 	for _, thing := range ths {
 		dbth, err := toDBThing(thing)
 		if err != nil {
+			tx.Rollback()
 			return []things.Thing{}, errors.Wrap(things.ErrCreateEntity, err)
 		}
 
 		if _, err := tx.NamedExecContext(ctx, q, dbth); err != nil {
 			tx.Rollback()
-			pqErr, ok := err.(*pq.Error)
-			if ok {
-				switch pqErr.Code.Name() {
-				case errInvalid, errTruncation:
-					return []things.Thing{}, errors.Wrap(things.ErrMalformedEntity, err)
-				case errDuplicate:
-					return []things.Thing{}, errors.Wrap(things.ErrConflict, err)
-				}
-			}
+			return []things.Thing{}, saveError(err)
+		}
 
-			return []things.Thing{}, errors.Wrap(things.ErrCreateEntity, err)
+		for _, key := range append([]string{thing.Key}, thing.Keys...) {
+			dbk := dbThingKey{
+				Key:        key,
+				ThingID:    thing.ID,
+				ThingOwner: thing.Owner,
+			}
+			if _, err := tx.NamedExecContext(ctx, kq, dbk); err != nil {
+				tx.Rollback()
+				return []things.Thing{}, saveError(err)
+			}
 		}
 	}
 
@@ -79,6 +110,21 @@ func (tr thingRepository) Save(ctx context.Context, ths ...things.Thing) ([]thin
 	return ths, nil
 }
 
+// saveError maps the error of an insert to the things error.
+func saveError(err error) error {
+	pqErr, ok := err.(*pq.Error)
+	if ok {
+		switch pqErr.Code.Name() {
+		case errInvalid, errTruncation:
+			return errors.Wrap(things.ErrMalformedEntity, err)
+		case errDuplicate:
+			return errors.Wrap(things.ErrConflict, err)
+		}
+	}
+
+	return errors.Wrap(things.ErrCreateEntity, err)
+}
+
 func (tr thingRepository) Update(ctx context.Context, t things.Thing) error {
 	q := `UPDATE things SET name = :name, metadata = :metadata WHERE owner = :owner AND id = :id;`
 
@@ -112,24 +158,38 @@ func (tr thingRepository) Update(ctx context.Context, t things.Thing) error {
 	return nil
 }
 
-func (tr thingRepository) UpdateKey(ctx context.Context, owner, id, key string) error {
-	q := `UPDATE things SET key = :key WHERE owner = :owner AND id = :id;`
+func (tr thingRepository) UpdateMetadata(ctx context.Context, owner, id string, md things.Metadata) error {
+	q := `UPDATE things SET metadata = (COALESCE(metadata, '{}') || CAST(:set AS JSONB)) - CAST(:remove AS TEXT[])
+		  WHERE owner = :owner AND id = :id;`
 
-	dbth := dbThing{
-		ID:    id,
-		Owner: owner,
-		Key:   key,
+	set := make(things.Metadata, len(md))
+	remove := []string{}
+	for k, v := range md {
+		if v == nil {
+			remove = append(remove, k)
+			continue
+		}
+		set[k] = v
+	}
+	data, err := json.Marshal(set)
+	if err != nil {
+		return errors.Wrap(things.ErrMalformedEntity, err)
 	}
 
-	res, err := tr.db.NamedExecContext(ctx, q, dbth)
+	params := map[string]interface{}{
+		"owner":  owner,
+		"id":     id,
+		"set":    string(data),
+		"remove": pq.StringArray(remove),
+	}
+
+	res, err := tr.db.NamedExecContext(ctx, q, params)
 	if err != nil {
 		pqErr, ok := err.(*pq.Error)
 		if ok {
 			switch pqErr.Code.Name() {
-			case errInvalid:
+			case errInvalid, errTruncation:
 				return errors.Wrap(things.ErrMalformedEntity, err)
-			case errDuplicate:
-				return errors.Wrap(things.ErrConflict, err)
 			}
 		}
 
@@ -148,8 +208,73 @@ func (tr thingRepository) UpdateKey(ctx context.Context, owner, id, key string)
 	return nil
 }
 
+func (tr thingRepository) UpdateKey(ctx context.Context, owner, id, key string) error {
+	// The primary key entry is replaced before the thing is updated, while
+	// its previous value is still known.
+	kq := `UPDATE thing_keys SET key = :key
+		   WHERE thing_id = :id AND thing_owner = :owner
+		   AND key = (SELECT key FROM things WHERE owner = :owner AND id = :id);`
+	q := `UPDATE things SET key = :key WHERE owner = :owner AND id = :id;`
+
+	dbth := dbThing{
+		ID:    id,
+		Owner: owner,
+		Key:   key,
+	}
+
+	tx, err := tr.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(things.ErrUpdateEntity, err)
+	}
+
+	if _, err := tx.NamedExecContext(ctx, kq, dbth); err != nil {
+		tx.Rollback()
+		return updateKeyError(err)
+	}
+
+	res, err := tx.NamedExecContext(ctx, q, dbth)
+	if err != nil {
+		tx.Rollback()
+		return updateKeyError(err)
+	}
+
+	cnt, err := res.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return errors.Wrap(things.ErrUpdateEntity, err)
+	}
+
+	if cnt == 0 {
+		tx.Rollback()
+		return things.ErrNotFound
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(things.ErrUpdateEntity, err)
+	}
+
+	return nil
+}
+
+func updateKeyError(err error) error {
+	pqErr, ok := err.(*pq.Error)
+	if ok {
+		switch pqErr.Code.Name() {
+		case errInvalid:
+			return errors.Wrap(things.ErrMalformedEntity, err)
+		case errDuplicate:
+			return errors.Wrap(things.ErrConflict, err)
+		}
+	}
+
+	return errors.Wrap(things.ErrUpdateEntity, err)
+}
+
 func (tr thingRepository) RetrieveByID(ctx context.Context, owner, id string) (things.Thing, error) {
-	q := `SELECT name, key, metadata FROM things WHERE id = $1 AND owner = $2;`
+	q := `SELECT name, key, metadata, status,
+		  ARRAY(SELECT tk.key FROM thing_keys tk
+		    WHERE tk.thing_id = things.id AND tk.key <> things.key ORDER BY tk.key) AS keys
+		  FROM things WHERE id = $1 AND owner = $2;`
 
 	dbth := dbThing{
 		ID:    id,
@@ -167,20 +292,552 @@ func (tr thingRepository) RetrieveByID(ctx context.Context, owner, id string) (t
 	return toThing(dbth)
 }
 
+func (tr thingRepository) RetrieveByIDsMap(ctx context.Context, ids []string) (map[string]things.Thing, error) {
+	ths := make(map[string]things.Thing)
+	if len(ids) == 0 {
+		return ths, nil
+	}
+
+	// Skip malformed identifiers to avoid internal Postgres error.
+	var uuids []string
+	for _, id := range ids {
+		if _, err := uuid.FromString(id); err == nil {
+			uuids = append(uuids, id)
+		}
+	}
+
+	q := `SELECT id, owner, name, key, metadata, status FROM things WHERE id = ANY(CAST(:ids AS UUID[]));`
+	params := map[string]interface{}{
+		"ids": pq.StringArray(uuids),
+	}
+
+	rows, err := tr.db.NamedQueryContext(ctx, q, params)
+	if err != nil {
+		return nil, errors.Wrap(things.ErrSelectEntity, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var dbth dbThing
+		if err := rows.StructScan(&dbth); err != nil {
+			return nil, errors.Wrap(things.ErrSelectEntity, err)
+		}
+
+		th, err := toThing(dbth)
+		if err != nil {
+			return nil, errors.Wrap(things.ErrViewEntity, err)
+		}
+
+		ths[th.ID] = th
+	}
+
+	return ths, nil
+}
+
+func (tr thingRepository) RetrieveByIDs(ctx context.Context, ids []string) ([]things.Thing, error) {
+	byID, err := tr.RetrieveByIDsMap(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	ths := []things.Thing{}
+	for _, id := range ids {
+		if th, ok := byID[id]; ok {
+			ths = append(ths, th)
+		}
+	}
+
+	return ths, nil
+}
+
+func (tr thingRepository) RetrieveByGroupIDs(ctx context.Context, owner string, groupIDs []string, pm things.PageMetadata) (things.Page, error) {
+	page := things.Page{PageMetadata: groupPageMetadata(pm)}
+	if len(groupIDs) == 0 {
+		return page, nil
+	}
+
+	cols := "id, name, key, metadata, status"
+	if pm.WithGroups {
+		cols += `, COALESCE((SELECT json_agg(json_build_object('id', tg.id, 'name', tg.name, 'owner', tg.owner_id) ORDER BY tg.name, tg.id)
+	      FROM thing_group_relations gr JOIN thing_groups tg ON tg.id = gr.group_id
+	      WHERE gr.thing_id = th.id AND gr.group_id = ANY(:groups)), '[]') AS member_groups`
+	}
+	q, cq, params, err := groupQueries(cols, owner, groupIDs, pm)
+	if err != nil {
+		return things.Page{}, err
+	}
+	rows, err := tr.reader.NamedQueryContext(ctx, q, params)
+	if err != nil {
+		return things.Page{}, errors.Wrap(things.ErrSelectEntity, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		dbth := dbThing{Owner: owner}
+		if err := rows.StructScan(&dbth); err != nil {
+			return things.Page{}, errors.Wrap(things.ErrSelectEntity, err)
+		}
+
+		th, err := toThing(dbth)
+		if err != nil {
+			return things.Page{}, errors.Wrap(things.ErrViewEntity, err)
+		}
+		if pm.WithGroups {
+			if th.Groups, err = toThingGroups(dbth.Groups); err != nil {
+				return things.Page{}, errors.Wrap(things.ErrViewEntity, err)
+			}
+		}
+
+		page.Things = append(page.Things, th)
+	}
+	if n := len(page.Things); keyset(pm) && n > 0 && uint64(n) == pm.Limit {
+		page.NextCursor = things.EncodeCursor(page.Things[n-1].Name, page.Things[n-1].ID)
+	}
+
+	if page.Total, err = total(ctx, tr.reader, cq, params); err != nil {
+		return things.Page{}, errors.Wrap(things.ErrSelectEntity, err)
+	}
+
+	return page, nil
+}
+
+func (tr thingRepository) CountByGroupIDs(ctx context.Context, groupIDs []string) (uint64, error) {
+	if len(groupIDs) == 0 {
+		return 0, nil
+	}
+
+	q := `SELECT COUNT(*) FROM things th WHERE th.id IN
+	        (SELECT g.thing_id FROM thing_group_relations g WHERE g.group_id = ANY(:groups));`
+	params := map[string]interface{}{
+		"groups": pq.StringArray(groupIDs),
+	}
+
+	n, err := total(ctx, tr.db, q, params)
+	if err != nil {
+		return 0, errors.Wrap(things.ErrSelectEntity, err)
+	}
+	return n, nil
+}
+
+func (tr thingRepository) CountAll(ctx context.Context) (uint64, error) {
+	n, err := total(ctx, tr.db, `SELECT COUNT(*) FROM things;`, map[string]interface{}{})
+	if err != nil {
+		return 0, errors.Wrap(things.ErrSelectEntity, err)
+	}
+	return n, nil
+}
+
+func (tr thingRepository) MetadataFacet(ctx context.Context, groupIDs []string, key string) (map[string]uint64, error) {
+	facet := make(map[string]uint64)
+	if len(groupIDs) == 0 {
+		return facet, nil
+	}
+
+	q := `SELECT COALESCE(th.metadata ->> :key, '') AS value, COUNT(*) AS count FROM things th WHERE th.id IN
+	        (SELECT g.thing_id FROM thing_group_relations g WHERE g.group_id = ANY(:groups))
+	      GROUP BY value;`
+	params := map[string]interface{}{
+		"key":    key,
+		"groups": pq.StringArray(groupIDs),
+	}
+
+	rows, err := tr.db.NamedQueryContext(ctx, q, params)
+	if err != nil {
+		return nil, errors.Wrap(things.ErrSelectEntity, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var value string
+		var count uint64
+		if err := rows.Scan(&value, &count); err != nil {
+			return nil, errors.Wrap(things.ErrSelectEntity, err)
+		}
+		facet[value] += count
+	}
+
+	return facet, nil
+}
+
+func (tr thingRepository) RetrieveCompactByGroupIDs(ctx context.Context, owner string, groupIDs []string, pm things.PageMetadata) (things.CompactPage, error) {
+	page := things.CompactPage{PageMetadata: groupPageMetadata(pm)}
+	if len(groupIDs) == 0 {
+		return page, nil
+	}
+
+	cols := `id, name, EXISTS (SELECT 1 FROM connections conn
+	      WHERE conn.thing_id = th.id AND conn.thing_owner = th.owner) AS connected`
+	q, cq, params, err := groupQueries(cols, owner, groupIDs, pm)
+	if err != nil {
+		return things.CompactPage{}, err
+	}
+	rows, err := tr.reader.NamedQueryContext(ctx, q, params)
+	if err != nil {
+		return things.CompactPage{}, errors.Wrap(things.ErrSelectEntity, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var dbth dbCompactThing
+		if err := rows.StructScan(&dbth); err != nil {
+			return things.CompactPage{}, errors.Wrap(things.ErrSelectEntity, err)
+		}
+
+		page.Things = append(page.Things, things.CompactThing{
+			ID:        dbth.ID,
+			Name:      dbth.Name,
+			Connected: dbth.Connected,
+		})
+	}
+	if n := len(page.Things); keyset(pm) && n > 0 && uint64(n) == pm.Limit {
+		page.NextCursor = things.EncodeCursor(page.Things[n-1].Name, page.Things[n-1].ID)
+	}
+
+	if page.Total, err = total(ctx, tr.reader, cq, params); err != nil {
+		return things.CompactPage{}, errors.Wrap(things.ErrSelectEntity, err)
+	}
+
+	return page, nil
+}
+
+func (tr thingRepository) RetrieveByMetadata(ctx context.Context, owner string, groupIDs []string, filter things.Metadata, pm things.PageMetadata) (things.Page, error) {
+	params := map[string]interface{}{
+		"owner":  owner,
+		"groups": pq.StringArray(groupIDs),
+		"limit":  pm.Limit,
+		"offset": pm.Offset,
+	}
+
+	wq := "WHERE th.owner = :owner"
+	if len(groupIDs) > 0 {
+		wq = fmt.Sprintf(`%s AND th.id IN
+		        (SELECT g.thing_id FROM thing_group_relations g WHERE g.group_id = ANY(:groups))`, wq)
+	}
+
+	// Every filter value is compared as a whole, so that nested objects
+	// and arrays match only if they are equal rather than containing.
+	keys := make([]string, 0, len(filter))
+	for k := range filter {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for i, k := range keys {
+		v, err := json.Marshal(filter[k])
+		if err != nil {
+			return things.Page{}, errors.Wrap(things.ErrMalformedEntity, err)
+		}
+		kp, vp := fmt.Sprintf("mkey%d", i), fmt.Sprintf("mval%d", i)
+		params[kp], params[vp] = k, string(v)
+		wq = fmt.Sprintf("%s AND th.metadata -> :%s = CAST(:%s AS JSONB)", wq, kp, vp)
+	}
+
+	q := fmt.Sprintf(`SELECT id, name, key, metadata, status FROM things th %s ORDER BY th.id LIMIT :limit OFFSET :offset;`, wq)
+	rows, err := tr.reader.NamedQueryContext(ctx, q, params)
+	if err != nil {
+		return things.Page{}, errors.Wrap(things.ErrSelectEntity, err)
+	}
+	defer rows.Close()
+
+	page := things.Page{
+		PageMetadata: things.PageMetadata{
+			Offset: pm.Offset,
+			Limit:  pm.Limit,
+		},
+	}
+	for rows.Next() {
+		dbth := dbThing{Owner: owner}
+		if err := rows.StructScan(&dbth); err != nil {
+			return things.Page{}, errors.Wrap(things.ErrSelectEntity, err)
+		}
+
+		th, err := toThing(dbth)
+		if err != nil {
+			return things.Page{}, errors.Wrap(things.ErrViewEntity, err)
+		}
+
+		page.Things = append(page.Things, th)
+	}
+
+	cq := fmt.Sprintf(`SELECT COUNT(*) FROM things th %s;`, wq)
+	if page.Total, err = total(ctx, tr.reader, cq, params); err != nil {
+		return things.Page{}, errors.Wrap(things.ErrSelectEntity, err)
+	}
+
+	return page, nil
+}
+
+func (tr thingRepository) Search(ctx context.Context, groupIDs []string, query string, pm things.PageMetadata) (things.Page, error) {
+	params := map[string]interface{}{
+		"query":  fmt.Sprintf(`%%%s%%`, strings.ToLower(query)),
+		"groups": pq.StringArray(groupIDs),
+		"limit":  pm.Limit,
+		"offset": pm.Offset,
+	}
+
+	// Only the string values of the metadata are matched, so that numbers
+	// and nested objects don't match by their JSON encoding.
+	wq := `WHERE (LOWER(th.name) LIKE :query OR EXISTS
+	        (SELECT 1 FROM jsonb_each(th.metadata) m
+	        WHERE jsonb_typeof(m.value) = 'string' AND LOWER(m.value #>> '{}') LIKE :query))`
+	if len(groupIDs) > 0 {
+		wq = fmt.Sprintf(`%s AND th.id IN
+		        (SELECT g.thing_id FROM thing_group_relations g WHERE g.group_id = ANY(:groups))`, wq)
+	}
+
+	q := fmt.Sprintf(`SELECT id, owner, name, key, metadata, status FROM things th %s ORDER BY th.id LIMIT :limit OFFSET :offset;`, wq)
+	rows, err := tr.reader.NamedQueryContext(ctx, q, params)
+	if err != nil {
+		return things.Page{}, errors.Wrap(things.ErrSelectEntity, err)
+	}
+	defer rows.Close()
+
+	page := things.Page{
+		PageMetadata: things.PageMetadata{
+			Offset: pm.Offset,
+			Limit:  pm.Limit,
+		},
+	}
+	for rows.Next() {
+		var dbth dbThing
+		if err := rows.StructScan(&dbth); err != nil {
+			return things.Page{}, errors.Wrap(things.ErrSelectEntity, err)
+		}
+
+		th, err := toThing(dbth)
+		if err != nil {
+			return things.Page{}, errors.Wrap(things.ErrViewEntity, err)
+		}
+
+		page.Things = append(page.Things, th)
+	}
+
+	cq := fmt.Sprintf(`SELECT COUNT(*) FROM things th %s;`, wq)
+	if page.Total, err = total(ctx, tr.reader, cq, params); err != nil {
+		return things.Page{}, errors.Wrap(things.ErrSelectEntity, err)
+	}
+
+	return page, nil
+}
+
+func groupPageMetadata(pm things.PageMetadata) things.PageMetadata {
+	return things.PageMetadata{
+		Offset:   pm.Offset,
+		Limit:    pm.Limit,
+		Name:     pm.Name,
+		Order:    pm.Order,
+		Metadata: pm.Metadata,
+		Sample:   pm.Sample,
+		Seed:     pm.Seed,
+		Cursor:   pm.Cursor,
+		Status:   pm.Status,
+	}
+}
+
+// keyset reports whether the group things are paged by the cursor.
+func keyset(pm things.PageMetadata) bool {
+	return pm.Order == "name" && !pm.Sample
+}
+
+// groupQueries returns the query selecting the columns of the page of the
+// owner's things that are members of the groups and match the name and
+// metadata filters, the query counting all of them, and their parameters.
+// Things listed by name are paged by the cursor, which holds the name and
+// ID of the last thing of the previous page.
+func groupQueries(cols, owner string, groupIDs []string, pm things.PageMetadata) (string, string, map[string]interface{}, error) {
+	nq, name := getNameQuery(pm.Name)
+	m, mq, err := getMetadataQuery(pm.Metadata)
+	if err != nil {
+		return "", "", nil, errors.Wrap(things.ErrSelectEntity, err)
+	}
+
+	sq, status, err := getStatusQuery(pm.Status)
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	params := map[string]interface{}{
+		"owner":    owner,
+		"groups":   pq.StringArray(groupIDs),
+		"name":     name,
+		"metadata": m,
+		"status":   status,
+		"limit":    pm.Limit,
+		"offset":   pm.Offset,
+		"seed":     strconv.FormatInt(pm.Seed, 10),
+	}
+
+	// Seeded samples are ordered by a hash of the seed and the ID rather
+	// than by random(), so that they don't depend on the session state.
+	oq, lq, kq := "th.id", "LIMIT :limit OFFSET :offset", ""
+	switch {
+	case pm.Sample:
+		oq, lq = "random()", "LIMIT :limit"
+		if pm.Seed != 0 {
+			oq = "md5(:seed || CAST(th.id AS TEXT)), th.id"
+		}
+	case keyset(pm):
+		oq = "th.name, th.id"
+		if pm.Cursor != "" {
+			cname, cid, err := things.DecodeCursor(pm.Cursor)
+			if err != nil {
+				return "", "", nil, errors.Wrap(things.ErrMalformedEntity, err)
+			}
+			if _, err := uuid.FromString(cid); err != nil {
+				return "", "", nil, errors.Wrap(things.ErrMalformedEntity, things.ErrInvalidCursor)
+			}
+			kq, lq = " AND (th.name, th.id) > (:cursor_name, CAST(:cursor_id AS UUID))", "LIMIT :limit"
+			params["cursor_name"], params["cursor_id"] = cname, cid
+		}
+	}
+
+	wq := fmt.Sprintf(`WHERE th.owner = :owner AND th.id IN
+	        (SELECT g.thing_id FROM thing_group_relations g WHERE g.group_id = ANY(:groups))%s%s%s`, nq, mq, sq)
+	q := fmt.Sprintf(`SELECT %s FROM things th %s%s ORDER BY %s %s;`, cols, wq, kq, oq, lq)
+	cq := fmt.Sprintf(`SELECT COUNT(*) FROM things th %s;`, wq)
+	return q, cq, params, nil
+}
+
+func (tr thingRepository) ChangeStatus(ctx context.Context, id, status string) error {
+	if status != things.EnabledStatus && status != things.DisabledStatus {
+		return things.ErrMalformedEntity
+	}
+
+	q := `UPDATE things SET status = :status WHERE id = :id;`
+	dbth := dbThing{
+		ID:     id,
+		Status: status,
+	}
+
+	res, err := tr.db.NamedExecContext(ctx, q, dbth)
+	if err != nil {
+		pqErr, ok := err.(*pq.Error)
+		if ok && pqErr.Code.Name() == errInvalid {
+			return errors.Wrap(things.ErrNotFound, err)
+		}
+		return errors.Wrap(things.ErrUpdateEntity, err)
+	}
+
+	cnt, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(things.ErrUpdateEntity, err)
+	}
+
+	if cnt == 0 {
+		return things.ErrNotFound
+	}
+
+	return nil
+}
+
+// getStatusQuery returns the condition restricting the group things to the
+// status, enabled by default, and its parameter.
+func getStatusQuery(status string) (string, string, error) {
+	switch status {
+	case "":
+		return " AND th.status = :status", things.EnabledStatus, nil
+	case things.EnabledStatus, things.DisabledStatus:
+		return " AND th.status = :status", status, nil
+	case things.AllStatus:
+		return "", "", nil
+	default:
+		return "", "", things.ErrMalformedEntity
+	}
+}
+
 func (tr thingRepository) RetrieveByKey(ctx context.Context, key string) (string, error) {
-	q := `SELECT id FROM things WHERE key = $1;`
+	q := `SELECT thing_id, expires_at FROM thing_keys WHERE key = $1;`
 
 	var id string
-	if err := tr.db.QueryRowxContext(ctx, q, key).Scan(&id); err != nil {
+	var expiresAt sql.NullTime
+	if err := tr.db.QueryRowxContext(ctx, q, key).Scan(&id, &expiresAt); err != nil {
 		if err == sql.ErrNoRows {
 			return "", errors.Wrap(things.ErrNotFound, err)
 		}
 		return "", errors.Wrap(things.ErrSelectEntity, err)
 	}
+	if expiresAt.Valid && !tr.now().Before(expiresAt.Time) {
+		return "", things.ErrAuthorization
+	}
 
 	return id, nil
 }
 
+func (tr thingRepository) RetrieveKeyExpiry(ctx context.Context, key string) (time.Time, error) {
+	q := `SELECT expires_at FROM thing_keys WHERE key = $1;`
+
+	var expiresAt sql.NullTime
+	if err := tr.db.QueryRowxContext(ctx, q, key).Scan(&expiresAt); err != nil {
+		if err == sql.ErrNoRows {
+			return time.Time{}, errors.Wrap(things.ErrNotFound, err)
+		}
+		return time.Time{}, errors.Wrap(things.ErrSelectEntity, err)
+	}
+
+	return expiresAt.Time, nil
+}
+
+func (tr thingRepository) SaveTemporaryKey(ctx context.Context, owner, id, key string, expiresAt time.Time) error {
+	q := `INSERT INTO thing_keys (key, thing_id, thing_owner, expires_at)
+		  SELECT :key, id, owner, :expires_at FROM things WHERE owner = :thing_owner AND id = :thing_id;`
+
+	dbk := dbThingKey{
+		Key:        key,
+		ThingID:    id,
+		ThingOwner: owner,
+		ExpiresAt:  sql.NullTime{Time: expiresAt, Valid: true},
+	}
+
+	res, err := tr.db.NamedExecContext(ctx, q, dbk)
+	if err != nil {
+		pqErr, ok := err.(*pq.Error)
+		if ok {
+			switch pqErr.Code.Name() {
+			case errInvalid:
+				return errors.Wrap(things.ErrMalformedEntity, err)
+			case errDuplicate:
+				return errors.Wrap(things.ErrConflict, err)
+			}
+		}
+		return errors.Wrap(things.ErrCreateEntity, err)
+	}
+
+	cnt, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(things.ErrCreateEntity, err)
+	}
+
+	if cnt == 0 {
+		return things.ErrNotFound
+	}
+
+	return nil
+}
+
+func (tr thingRepository) RemoveExpiredKeys(ctx context.Context, now time.Time) ([]string, error) {
+	q := `DELETE FROM thing_keys WHERE expires_at <= :now RETURNING key;`
+	params := map[string]interface{}{
+		"now": now,
+	}
+
+	rows, err := tr.db.NamedQueryContext(ctx, q, params)
+	if err != nil {
+		return nil, errors.Wrap(things.ErrRemoveEntity, err)
+	}
+	defer rows.Close()
+
+	keys := []string{}
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, errors.Wrap(things.ErrRemoveEntity, err)
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys, nil
+}
+
 func (tr thingRepository) RetrieveAll(ctx context.Context, owner string, pm things.PageMetadata) (things.Page, error) {
 	nq, name := getNameQuery(pm.Name)
 	oq := getOrderQuery(pm.Order)
@@ -189,18 +846,37 @@ func (tr thingRepository) RetrieveAll(ctx context.Context, owner string, pm thin
 	if err != nil {
 		return things.Page{}, errors.Wrap(things.ErrSelectEntity, err)
 	}
+	kq := getMetadataKeysQuery(pm.HasMetadataKeys, pm.MissingMetadataKeys)
+	if pm.ConnectedOnly {
+		kq = fmt.Sprintf(`%s AND EXISTS (SELECT 1 FROM connections conn
+		      WHERE conn.thing_id = things.id AND conn.thing_owner = things.owner)`, kq)
+	}
 
-	q := fmt.Sprintf(`SELECT id, name, key, metadata FROM things
-	      WHERE owner = :owner %s%s ORDER BY %s %s LIMIT :limit OFFSET :offset;`, mq, nq, oq, dq)
 	params := map[string]interface{}{
-		"owner":    owner,
-		"limit":    pm.Limit,
-		"offset":   pm.Offset,
-		"name":     name,
-		"metadata": m,
+		"owner":        owner,
+		"limit":        pm.Limit,
+		"offset":       pm.Offset,
+		"name":         name,
+		"metadata":     m,
+		"has_keys":     pq.StringArray(pm.HasMetadataKeys),
+		"missing_keys": pq.StringArray(pm.MissingMetadataKeys),
 	}
+	aq, err := getAnyOfQuery(pm.AnyOf, params)
+	if err != nil {
+		return things.Page{}, errors.Wrap(things.ErrSelectEntity, err)
+	}
+	kq = fmt.Sprintf("%s%s", kq, aq)
 
-	rows, err := tr.db.NamedQueryContext(ctx, q, params)
+	cols := "id, name, key, metadata, status"
+	if pm.WithConnections {
+		cols = fmt.Sprintf(`%s, (SELECT COUNT(*) FROM connections conn
+		      WHERE conn.thing_id = things.id AND conn.thing_owner = things.owner) AS connections`, cols)
+	}
+
+	q := fmt.Sprintf(`SELECT %s FROM things
+	      WHERE owner = :owner %s%s%s ORDER BY %s %s LIMIT :limit OFFSET :offset;`, cols, mq, nq, kq, oq, dq)
+
+	rows, err := tr.reader.NamedQueryContext(ctx, q, params)
 	if err != nil {
 		return things.Page{}, errors.Wrap(things.ErrSelectEntity, err)
 	}
@@ -221,9 +897,9 @@ func (tr thingRepository) RetrieveAll(ctx context.Context, owner string, pm thin
 		items = append(items, th)
 	}
 
-	cq := fmt.Sprintf(`SELECT COUNT(*) FROM things WHERE owner = :owner %s%s;`, nq, mq)
+	cq := fmt.Sprintf(`SELECT COUNT(*) FROM things WHERE owner = :owner %s%s%s;`, nq, mq, kq)
 
-	total, err := total(ctx, tr.db, cq, params)
+	total, err := total(ctx, tr.reader, cq, params)
 	if err != nil {
 		return things.Page{}, errors.Wrap(things.ErrSelectEntity, err)
 	}
@@ -241,7 +917,77 @@ func (tr thingRepository) RetrieveAll(ctx context.Context, owner string, pm thin
 	return page, nil
 }
 
-func (tr thingRepository) RetrieveByChannel(ctx context.Context, owner, channel string, offset, limit uint64, connected bool) (things.Page, error) {
+func (tr thingRepository) RetrieveAllStream(ctx context.Context, batchSize int) (<-chan things.Thing, <-chan error) {
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	ths := make(chan things.Thing)
+	errs := make(chan error, 1)
+	go func() {
+		defer close(errs)
+		defer close(ths)
+
+		// Start before the first owner with an identifier that parses as
+		// the UUID the identifiers are compared to.
+		last := dbThing{ID: uuid.Nil.String()}
+		for {
+			batch, err := tr.batchAfter(ctx, last, batchSize)
+			if err != nil {
+				errs <- err
+				return
+			}
+			for _, dbth := range batch {
+				th, err := toThing(dbth)
+				if err != nil {
+					errs <- errors.Wrap(things.ErrViewEntity, err)
+					return
+				}
+				select {
+				case ths <- th:
+				case <-ctx.Done():
+					errs <- ctx.Err()
+					return
+				}
+			}
+			if len(batch) < batchSize {
+				return
+			}
+			last = batch[len(batch)-1]
+		}
+	}()
+	return ths, errs
+}
+
+// batchAfter retrieves up to limit things following the given thing in
+// the order of owners and identifiers, so that the stream pages through the
+// things by key rather than by offset.
+func (tr thingRepository) batchAfter(ctx context.Context, last dbThing, limit int) ([]dbThing, error) {
+	q := `SELECT id, owner, name, key, metadata, status FROM things
+	      WHERE (owner, id) > (:owner, :id) ORDER BY owner, id LIMIT :limit;`
+	params := map[string]interface{}{
+		"owner": last.Owner,
+		"id":    last.ID,
+		"limit": limit,
+	}
+
+	rows, err := tr.reader.NamedQueryContext(ctx, q, params)
+	if err != nil {
+		return nil, errors.Wrap(things.ErrSelectEntity, err)
+	}
+	defer rows.Close()
+
+	var batch []dbThing
+	for rows.Next() {
+		var dbth dbThing
+		if err := rows.StructScan(&dbth); err != nil {
+			return nil, errors.Wrap(things.ErrSelectEntity, err)
+		}
+		batch = append(batch, dbth)
+	}
+	return batch, nil
+}
+
+func (tr thingRepository) RetrieveByChannel(ctx context.Context, owner, channel string, connected bool, pm things.PageMetadata) (things.Page, error) {
 	// Verify if UUID format is valid to avoid internal Postgres error
 	if _, err := uuid.FromString(channel); err != nil {
 		return things.Page{}, things.ErrNotFound
@@ -250,14 +996,18 @@ func (tr thingRepository) RetrieveByChannel(ctx context.Context, owner, channel
 	var q, qc string
 	switch connected {
 	case true:
-		q = `SELECT id, name, key, metadata
+		oq := "th.id"
+		if pm.Order == things.OrderConnectedAt {
+			oq = fmt.Sprintf("conn.connected_at %s, th.id", getDirQuery(pm.Dir))
+		}
+		q = fmt.Sprintf(`SELECT id, name, key, metadata, status
 		        FROM things th
 		        INNER JOIN connections conn
 		        ON th.id = conn.thing_id
 		        WHERE th.owner = :owner AND conn.channel_id = :channel
-		        ORDER BY th.id
+		        ORDER BY %s
 		        LIMIT :limit
-		        OFFSET :offset;`
+		        OFFSET :offset;`, oq)
 
 		qc = `SELECT COUNT(*)
 		        FROM things th
@@ -265,7 +1015,7 @@ func (tr thingRepository) RetrieveByChannel(ctx context.Context, owner, channel
 		        ON th.id = conn.thing_id
 		        WHERE th.owner = $1 AND conn.channel_id = $2;`
 	default:
-		q = `SELECT id, name, key, metadata
+		q = `SELECT id, name, key, metadata, status
 		        FROM things th
 		        WHERE th.owner = :owner AND th.id NOT IN
 		        (SELECT id FROM things th
@@ -288,11 +1038,11 @@ func (tr thingRepository) RetrieveByChannel(ctx context.Context, owner, channel
 	params := map[string]interface{}{
 		"owner":   owner,
 		"channel": channel,
-		"limit":   limit,
-		"offset":  offset,
+		"limit":   pm.Limit,
+		"offset":  pm.Offset,
 	}
 
-	rows, err := tr.db.NamedQueryContext(ctx, q, params)
+	rows, err := tr.reader.NamedQueryContext(ctx, q, params)
 	if err != nil {
 		return things.Page{}, errors.Wrap(things.ErrSelectEntity, err)
 	}
@@ -314,7 +1064,7 @@ func (tr thingRepository) RetrieveByChannel(ctx context.Context, owner, channel
 	}
 
 	var total uint64
-	if err := tr.db.GetContext(ctx, &total, qc, owner, channel); err != nil {
+	if err := tr.reader.GetContext(ctx, &total, qc, owner, channel); err != nil {
 		return things.Page{}, errors.Wrap(things.ErrSelectEntity, err)
 	}
 
@@ -322,8 +1072,10 @@ func (tr thingRepository) RetrieveByChannel(ctx context.Context, owner, channel
 		Things: items,
 		PageMetadata: things.PageMetadata{
 			Total:  total,
-			Offset: offset,
-			Limit:  limit,
+			Offset: pm.Offset,
+			Limit:  pm.Limit,
+			Order:  pm.Order,
+			Dir:    pm.Dir,
 		},
 	}, nil
 }
@@ -346,6 +1098,30 @@ type dbThing struct {
 	Name     string `db:"name"`
 	Key      string `db:"key"`
 	Metadata []byte `db:"metadata"`
+	Status   string `db:"status"`
+
+	Keys        pq.StringArray `db:"keys"`
+	Connections uint64         `db:"connections"`
+	Groups      []byte         `db:"member_groups"`
+}
+
+type dbThingGroup struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Owner string `json:"owner"`
+}
+
+type dbCompactThing struct {
+	ID        string `db:"id"`
+	Name      string `db:"name"`
+	Connected bool   `db:"connected"`
+}
+
+type dbThingKey struct {
+	Key        string       `db:"key"`
+	ThingID    string       `db:"thing_id"`
+	ThingOwner string       `db:"thing_owner"`
+	ExpiresAt  sql.NullTime `db:"expires_at"`
 }
 
 func toDBThing(th things.Thing) (dbThing, error) {
@@ -358,12 +1134,18 @@ func toDBThing(th things.Thing) (dbThing, error) {
 		data = b
 	}
 
+	status := th.Status
+	if status == "" {
+		status = things.EnabledStatus
+	}
+
 	return dbThing{
 		ID:       th.ID,
 		Owner:    th.Owner,
 		Name:     th.Name,
 		Key:      th.Key,
 		Metadata: data,
+		Status:   status,
 	}, nil
 }
 
@@ -373,11 +1155,32 @@ func toThing(dbth dbThing) (things.Thing, error) {
 		return things.Thing{}, errors.Wrap(things.ErrMalformedEntity, err)
 	}
 
-	return things.Thing{
-		ID:       dbth.ID,
-		Owner:    dbth.Owner,
-		Name:     dbth.Name,
-		Key:      dbth.Key,
-		Metadata: metadata,
-	}, nil
+	th := things.Thing{
+		ID:          dbth.ID,
+		Owner:       dbth.Owner,
+		Name:        dbth.Name,
+		Key:         dbth.Key,
+		Metadata:    metadata,
+		Status:      dbth.Status,
+		Connected:   dbth.Connections > 0,
+		Connections: dbth.Connections,
+	}
+	if len(dbth.Keys) > 0 {
+		th.Keys = dbth.Keys
+	}
+
+	return th, nil
+}
+
+func toThingGroups(data []byte) ([]things.ThingGroup, error) {
+	var dbgs []dbThingGroup
+	if err := json.Unmarshal(data, &dbgs); err != nil {
+		return nil, err
+	}
+
+	gs := []things.ThingGroup{}
+	for _, g := range dbgs {
+		gs = append(gs, things.ThingGroup{ID: g.ID, Name: g.Name, Owner: g.Owner})
+	}
+	return gs, nil
 }
@@ -6,9 +6,12 @@ package postgres_test
 import (
 	"context"
 	"fmt"
+	"sort"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/mainflux/mainflux/internal/groups"
 	"github.com/mainflux/mainflux/pkg/errors"
 	uuidProvider "github.com/mainflux/mainflux/pkg/uuid"
 	"github.com/mainflux/mainflux/things"
@@ -47,6 +50,13 @@ func TestThingsSave(t *testing.T) {
 	thkey := ths[0].Key
 	thid := ths[0].ID
 
+	multiKeyID, err := uuidProvider.New().ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	multiKey, err := uuidProvider.New().ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	extraKey, err := uuidProvider.New().ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
 	cases := []struct {
 		desc   string
 		things []things.Thing
@@ -88,6 +98,27 @@ func TestThingsSave(t *testing.T) {
 			things: ths,
 			err:    things.ErrConflict,
 		},
+		{
+			desc: "create thing with additional key of an existing thing",
+			things: []things.Thing{
+				{ID: multiKeyID, Owner: email, Key: multiKey, Keys: []string{thkey}},
+			},
+			err: things.ErrConflict,
+		},
+		{
+			desc: "create thing with additional keys",
+			things: []things.Thing{
+				{ID: multiKeyID, Owner: email, Key: multiKey, Keys: []string{extraKey}},
+			},
+			err: nil,
+		},
+		{
+			desc: "create thing with primary key equal to an additional key of an existing thing",
+			things: []things.Thing{
+				{ID: thid, Owner: email, Key: extraKey},
+			},
+			err: things.ErrConflict,
+		},
 	}
 
 	for _, tc := range cases {
@@ -184,6 +215,92 @@ func TestThingUpdate(t *testing.T) {
 	}
 }
 
+func TestThingUpdateMetadata(t *testing.T) {
+	dbMiddleware := postgres.NewDatabase(db)
+	thingRepo := postgres.NewThingRepository(dbMiddleware)
+
+	email := "thing-update-metadata@example.com"
+
+	thid, err := uuidProvider.New().ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	thkey, err := uuidProvider.New().ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	thing := things.Thing{
+		ID:       thid,
+		Owner:    email,
+		Key:      thkey,
+		Name:     "mfx_device",
+		Metadata: things.Metadata{"room": "kitchen", "floor": float64(1)},
+	}
+	_, err = thingRepo.Save(context.Background(), thing)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+
+	nonexistentThingID, err := uuidProvider.New().ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	cases := []struct {
+		desc     string
+		owner    string
+		id       string
+		metadata things.Metadata
+		err      error
+		expected things.Metadata
+	}{
+		{
+			desc:     "add metadata key",
+			owner:    email,
+			id:       thid,
+			metadata: things.Metadata{"zone": "north"},
+			err:      nil,
+			expected: things.Metadata{"room": "kitchen", "floor": float64(1), "zone": "north"},
+		},
+		{
+			desc:     "overwrite metadata key",
+			owner:    email,
+			id:       thid,
+			metadata: things.Metadata{"room": "hall"},
+			err:      nil,
+			expected: things.Metadata{"room": "hall", "floor": float64(1), "zone": "north"},
+		},
+		{
+			desc:     "delete metadata key by null value",
+			owner:    email,
+			id:       thid,
+			metadata: things.Metadata{"floor": nil, "missing": nil},
+			err:      nil,
+			expected: things.Metadata{"room": "hall", "zone": "north"},
+		},
+		{
+			desc:     "update metadata of non-existing thing with existing user",
+			owner:    email,
+			id:       nonexistentThingID,
+			metadata: things.Metadata{"room": "attic"},
+			err:      things.ErrNotFound,
+			expected: things.Metadata{"room": "hall", "zone": "north"},
+		},
+		{
+			desc:     "update metadata of existing thing with non-existing user",
+			owner:    wrongValue,
+			id:       thid,
+			metadata: things.Metadata{"room": "attic"},
+			err:      things.ErrNotFound,
+			expected: things.Metadata{"room": "hall", "zone": "north"},
+		},
+	}
+
+	for _, tc := range cases {
+		err := thingRepo.UpdateMetadata(context.Background(), tc.owner, tc.id, tc.metadata)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s\n", tc.desc, tc.err, err))
+
+		th, err := thingRepo.RetrieveByID(context.Background(), email, thid)
+		require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", tc.desc, err))
+		assert.Equal(t, tc.expected, th.Metadata, fmt.Sprintf("%s: expected metadata %v got %v\n", tc.desc, tc.expected, th.Metadata))
+		assert.Equal(t, thing.Name, th.Name, fmt.Sprintf("%s: expected name %s got %s\n", tc.desc, thing.Name, th.Name))
+		assert.Equal(t, thing.Key, th.Key, fmt.Sprintf("%s: expected key %s got %s\n", tc.desc, thing.Key, th.Key))
+	}
+}
+
 func TestUpdateKey(t *testing.T) {
 	email := "thing-update=key@example.com"
 	newKey := "new-key"
@@ -194,10 +311,13 @@ func TestUpdateKey(t *testing.T) {
 	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
 	key, err := uuidProvider.New().ID()
 	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	extraKey, err := uuidProvider.New().ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
 	th1 := things.Thing{
 		ID:    id,
 		Owner: email,
 		Key:   key,
+		Keys:  []string{extraKey},
 	}
 	ths, err := thingRepo.Save(context.Background(), th1)
 	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
@@ -261,6 +381,13 @@ func TestUpdateKey(t *testing.T) {
 			key:   th1.Key,
 			err:   things.ErrConflict,
 		},
+		{
+			desc:  "update key with additional key value of another thing",
+			owner: th2.Owner,
+			id:    th2.ID,
+			key:   extraKey,
+			err:   things.ErrConflict,
+		},
 	}
 
 	for _, tc := range cases {
@@ -292,35 +419,1011 @@ func TestSingleThingRetrieval(t *testing.T) {
 	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
 
 	cases := map[string]struct {
-		owner string
-		ID    string
-		err   error
+		owner string
+		ID    string
+		err   error
+	}{
+		"retrieve thing with existing user": {
+			owner: th.Owner,
+			ID:    th.ID,
+			err:   nil,
+		},
+		"retrieve non-existing thing with existing user": {
+			owner: th.Owner,
+			ID:    nonexistentThingID,
+			err:   things.ErrNotFound,
+		},
+		"retrieve thing with non-existing owner": {
+			owner: wrongValue,
+			ID:    th.ID,
+			err:   things.ErrNotFound,
+		},
+		"retrieve thing with malformed ID": {
+			owner: th.Owner,
+			ID:    wrongValue,
+			err:   things.ErrNotFound,
+		},
+	}
+
+	for desc, tc := range cases {
+		_, err := thingRepo.RetrieveByID(context.Background(), tc.owner, tc.ID)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s\n", desc, tc.err, err))
+	}
+}
+
+func TestThingRetrieveByIDsMap(t *testing.T) {
+	email := "thing-retrieval-by-ids-map@example.com"
+	dbMiddleware := postgres.NewDatabase(db)
+	thingRepo := postgres.NewThingRepository(dbMiddleware)
+
+	var ids []string
+	for i := 0; i < 3; i++ {
+		id, err := uuidProvider.New().ID()
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+		key, err := uuidProvider.New().ID()
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+		th := things.Thing{
+			ID:    id,
+			Owner: email,
+			Key:   key,
+		}
+		_, err = thingRepo.Save(context.Background(), th)
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+		ids = append(ids, id)
+	}
+
+	nonexistentThingID, err := uuidProvider.New().ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	cases := map[string]struct {
+		ids      []string
+		expected []string
+	}{
+		"retrieve existing things": {
+			ids:      ids,
+			expected: ids,
+		},
+		"retrieve existing and non-existing things": {
+			ids:      []string{ids[0], nonexistentThingID, wrongValue},
+			expected: []string{ids[0]},
+		},
+		"retrieve non-existing things": {
+			ids:      []string{nonexistentThingID},
+			expected: []string{},
+		},
+		"retrieve things without ids": {
+			ids:      []string{},
+			expected: []string{},
+		},
+	}
+
+	for desc, tc := range cases {
+		ths, err := thingRepo.RetrieveByIDsMap(context.Background(), tc.ids)
+		assert.Nil(t, err, fmt.Sprintf("%s: expected no error got %s\n", desc, err))
+		assert.Equal(t, len(tc.expected), len(ths), fmt.Sprintf("%s: expected %d things got %d\n", desc, len(tc.expected), len(ths)))
+		for _, id := range tc.expected {
+			th, ok := ths[id]
+			assert.True(t, ok, fmt.Sprintf("%s: expected thing %s to be found\n", desc, id))
+			assert.Equal(t, id, th.ID, fmt.Sprintf("%s: expected thing %s got %s\n", desc, id, th.ID))
+		}
+	}
+}
+
+func TestThingRetrieveByIDs(t *testing.T) {
+	email := "thing-retrieval-by-ids@example.com"
+	dbMiddleware := postgres.NewDatabase(db)
+	thingRepo := postgres.NewThingRepository(dbMiddleware)
+
+	var ids []string
+	for i := 0; i < 3; i++ {
+		id, err := uuidProvider.New().ID()
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+		key, err := uuidProvider.New().ID()
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+		th := things.Thing{
+			ID:    id,
+			Owner: email,
+			Key:   key,
+		}
+		_, err = thingRepo.Save(context.Background(), th)
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+		ids = append(ids, id)
+	}
+
+	nonexistentThingID, err := uuidProvider.New().ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	cases := map[string]struct {
+		ids      []string
+		expected []string
+	}{
+		"retrieve existing things in the order of the ids": {
+			ids:      []string{ids[2], ids[0], ids[1]},
+			expected: []string{ids[2], ids[0], ids[1]},
+		},
+		"retrieve existing and non-existing things": {
+			ids:      []string{nonexistentThingID, ids[1], wrongValue, ids[0]},
+			expected: []string{ids[1], ids[0]},
+		},
+		"retrieve non-existing things": {
+			ids:      []string{nonexistentThingID},
+			expected: []string{},
+		},
+		"retrieve things without ids": {
+			ids:      []string{},
+			expected: []string{},
+		},
+	}
+
+	for desc, tc := range cases {
+		ths, err := thingRepo.RetrieveByIDs(context.Background(), tc.ids)
+		assert.Nil(t, err, fmt.Sprintf("%s: expected no error got %s\n", desc, err))
+		got := []string{}
+		for _, th := range ths {
+			got = append(got, th.ID)
+		}
+		assert.Equal(t, tc.expected, got, fmt.Sprintf("%s: expected %v got %v\n", desc, tc.expected, got))
+	}
+}
+
+func TestThingRetrieveByGroupIDs(t *testing.T) {
+	email := "thing-retrieval-by-group-ids@example.com"
+	dbMiddleware := postgres.NewDatabase(db)
+	thingRepo := postgres.NewThingRepository(dbMiddleware)
+	groupRepo := postgres.NewGroupRepo(dbMiddleware)
+
+	gid, err := uuidProvider.New().ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	_, err = groupRepo.Save(context.Background(), groups.Group{ID: gid, OwnerID: email, Name: "sampled"})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+
+	n := uint64(10)
+	for i := uint64(0); i < n; i++ {
+		id, err := uuidProvider.New().ID()
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+		key, err := uuidProvider.New().ID()
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+		_, err = thingRepo.Save(context.Background(), things.Thing{ID: id, Owner: email, Key: key})
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+		err = groupRepo.Assign(context.Background(), id, gid)
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+	}
+
+	cases := map[string]struct {
+		groupIDs []string
+		pm       things.PageMetadata
+		size     uint64
+	}{
+		"retrieve group things": {
+			groupIDs: []string{gid},
+			pm:       things.PageMetadata{Offset: 0, Limit: n},
+			size:     n,
+		},
+		"retrieve group things with offset": {
+			groupIDs: []string{gid},
+			pm:       things.PageMetadata{Offset: 8, Limit: n},
+			size:     2,
+		},
+		"retrieve random sample of group things": {
+			groupIDs: []string{gid},
+			pm:       things.PageMetadata{Limit: 4, Sample: true},
+			size:     4,
+		},
+		"retrieve seeded sample of group things": {
+			groupIDs: []string{gid},
+			pm:       things.PageMetadata{Limit: 4, Sample: true, Seed: 42},
+			size:     4,
+		},
+		"retrieve things without groups": {
+			groupIDs: []string{},
+			pm:       things.PageMetadata{Limit: n},
+			size:     0,
+		},
+	}
+
+	for desc, tc := range cases {
+		page, err := thingRepo.RetrieveByGroupIDs(context.Background(), email, tc.groupIDs, tc.pm)
+		assert.Nil(t, err, fmt.Sprintf("%s: expected no error got %s\n", desc, err))
+		size := uint64(len(page.Things))
+		assert.Equal(t, tc.size, size, fmt.Sprintf("%s: expected %d things got %d\n", desc, tc.size, size))
+	}
+
+	pm := things.PageMetadata{Limit: 4, Sample: true, Seed: 42}
+	first, err := thingRepo.RetrieveByGroupIDs(context.Background(), email, []string{gid}, pm)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+	second, err := thingRepo.RetrieveByGroupIDs(context.Background(), email, []string{gid}, pm)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+	assert.Equal(t, first.Things, second.Things, "expected the same sample for the same seed")
+	assert.Equal(t, n, first.Total, fmt.Sprintf("expected total %d got %d", n, first.Total))
+}
+
+func TestThingRetrieveByGroupIDsWithGroups(t *testing.T) {
+	email := "thing-retrieval-with-groups@example.com"
+	dbMiddleware := postgres.NewDatabase(db)
+	thingRepo := postgres.NewThingRepository(dbMiddleware)
+	groupRepo := postgres.NewGroupRepo(dbMiddleware)
+
+	ownerID, err := uuidProvider.New().ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	var gs []groups.Group
+	for _, name := range []string{"sensors", "gateways", "other"} {
+		gid, err := uuidProvider.New().ID()
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+		g, err := groupRepo.Save(context.Background(), groups.Group{ID: gid, OwnerID: ownerID, Name: name})
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+		gs = append(gs, g)
+	}
+
+	var ths []things.Thing
+	for _, name := range []string{"a", "b"} {
+		id, err := uuidProvider.New().ID()
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+		key, err := uuidProvider.New().ID()
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+		saved, err := thingRepo.Save(context.Background(), things.Thing{ID: id, Owner: email, Name: name, Key: key})
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+		ths = append(ths, saved[0])
+	}
+	// The first thing is a member of every group, and the second one of
+	// the sensors group only.
+	for _, g := range gs {
+		err := groupRepo.Assign(context.Background(), ths[0].ID, g.ID)
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+	}
+	err = groupRepo.Assign(context.Background(), ths[1].ID, gs[0].ID)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+
+	sensors := things.ThingGroup{ID: gs[0].ID, Name: gs[0].Name, Owner: ownerID}
+	gateways := things.ThingGroup{ID: gs[1].ID, Name: gs[1].Name, Owner: ownerID}
+
+	cases := map[string]struct {
+		pm     things.PageMetadata
+		groups map[string][]things.ThingGroup
+	}{
+		"retrieve group things with groups": {
+			pm: things.PageMetadata{Limit: 10, WithGroups: true},
+			groups: map[string][]things.ThingGroup{
+				ths[0].ID: {gateways, sensors},
+				ths[1].ID: {sensors},
+			},
+		},
+		"retrieve group things without groups": {
+			pm: things.PageMetadata{Limit: 10},
+			groups: map[string][]things.ThingGroup{
+				ths[0].ID: nil,
+				ths[1].ID: nil,
+			},
+		},
+	}
+
+	for desc, tc := range cases {
+		page, err := thingRepo.RetrieveByGroupIDs(context.Background(), email, []string{gs[0].ID, gs[1].ID}, tc.pm)
+		require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s\n", desc, err))
+		require.Len(t, page.Things, len(tc.groups), fmt.Sprintf("%s: expected %d things got %d\n", desc, len(tc.groups), len(page.Things)))
+		for _, th := range page.Things {
+			expected := tc.groups[th.ID]
+			assert.Equal(t, expected, th.Groups, fmt.Sprintf("%s: expected groups %v of thing %s got %v\n", desc, expected, th.Name, th.Groups))
+		}
+	}
+}
+
+func TestThingRetrieveByGroupIDsCursor(t *testing.T) {
+	email := "thing-retrieval-by-group-ids-cursor@example.com"
+	dbMiddleware := postgres.NewDatabase(db)
+	thingRepo := postgres.NewThingRepository(dbMiddleware)
+	groupRepo := postgres.NewGroupRepo(dbMiddleware)
+
+	gid, err := uuidProvider.New().ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	_, err = groupRepo.Save(context.Background(), groups.Group{ID: gid, OwnerID: email, Name: "paged"})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+
+	// The names repeat, so that the things with the same name are ordered
+	// by ID, and every other thing is on the first floor.
+	var ths []things.Thing
+	for i := 0; i < 20; i++ {
+		id, err := uuidProvider.New().ID()
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+		key, err := uuidProvider.New().ID()
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+		kind := "sensor"
+		if i%3 == 0 {
+			kind = "actuator"
+		}
+		th := things.Thing{
+			ID:       id,
+			Owner:    email,
+			Key:      key,
+			Name:     fmt.Sprintf("%s-%d", kind, i%4),
+			Metadata: things.Metadata{"floor": fmt.Sprintf("%d", i%2)},
+		}
+		_, err = thingRepo.Save(context.Background(), th)
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+		err = groupRepo.Assign(context.Background(), id, gid)
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+		ths = append(ths, th)
+	}
+
+	cases := map[string]struct {
+		pm       things.PageMetadata
+		expected func(th things.Thing) bool
+	}{
+		"page group things by name": {
+			pm:       things.PageMetadata{Order: "name", Limit: 3},
+			expected: func(th things.Thing) bool { return true },
+		},
+		"page group things filtered by name": {
+			pm:       things.PageMetadata{Order: "name", Limit: 4, Name: "SENSOR"},
+			expected: func(th things.Thing) bool { return strings.HasPrefix(th.Name, "sensor") },
+		},
+		"page group things filtered by name and metadata": {
+			pm: things.PageMetadata{Order: "name", Limit: 2, Name: "sensor", Metadata: things.Metadata{"floor": "1"}},
+			expected: func(th things.Thing) bool {
+				return strings.HasPrefix(th.Name, "sensor") && th.Metadata["floor"] == "1"
+			},
+		},
+	}
+
+	for desc, tc := range cases {
+		var expected []things.Thing
+		for _, th := range ths {
+			if tc.expected(th) {
+				expected = append(expected, th)
+			}
+		}
+		sort.Slice(expected, func(i, j int) bool {
+			if expected[i].Name != expected[j].Name {
+				return expected[i].Name < expected[j].Name
+			}
+			return expected[i].ID < expected[j].ID
+		})
+		var expectedIDs []string
+		for _, th := range expected {
+			expectedIDs = append(expectedIDs, th.ID)
+		}
+
+		var ids []string
+		pm := tc.pm
+		for pages := 0; pages <= len(expected); pages++ {
+			page, err := thingRepo.RetrieveByGroupIDs(context.Background(), email, []string{gid}, pm)
+			require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s\n", desc, err))
+			assert.Equal(t, uint64(len(expected)), page.Total, fmt.Sprintf("%s: expected total %d got %d\n", desc, len(expected), page.Total))
+			for _, th := range page.Things {
+				ids = append(ids, th.ID)
+			}
+			if page.NextCursor == "" {
+				break
+			}
+			pm.Cursor = page.NextCursor
+		}
+		assert.Equal(t, expectedIDs, ids, fmt.Sprintf("%s: expected things %v got %v\n", desc, expectedIDs, ids))
+	}
+
+	_, err = thingRepo.RetrieveByGroupIDs(context.Background(), email, []string{gid}, things.PageMetadata{Order: "name", Limit: 5, Cursor: "invalid"})
+	assert.True(t, errors.Contains(err, things.ErrInvalidCursor), fmt.Sprintf("expected %s got %s\n", things.ErrInvalidCursor, err))
+}
+
+func TestThingCountByGroupIDs(t *testing.T) {
+	email := "thing-count-by-group-ids@example.com"
+	dbMiddleware := postgres.NewDatabase(db)
+	thingRepo := postgres.NewThingRepository(dbMiddleware)
+	groupRepo := postgres.NewGroupRepo(dbMiddleware)
+
+	var gids []string
+	for i := 0; i < 2; i++ {
+		gid, err := uuidProvider.New().ID()
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+		_, err = groupRepo.Save(context.Background(), groups.Group{ID: gid, OwnerID: email, Name: fmt.Sprintf("counted-%d", i)})
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+		gids = append(gids, gid)
+	}
+
+	var ids []string
+	for i := 0; i < 5; i++ {
+		id, err := uuidProvider.New().ID()
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+		key, err := uuidProvider.New().ID()
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+		_, err = thingRepo.Save(context.Background(), things.Thing{ID: id, Owner: email, Key: key})
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+		err = groupRepo.Assign(context.Background(), id, gids[i%2])
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+		ids = append(ids, id)
+	}
+	err := thingRepo.Remove(context.Background(), email, ids[0])
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+
+	cases := map[string]struct {
+		groupIDs []string
+		count    uint64
+	}{
+		"count things of a group with a removed thing": {
+			groupIDs: []string{gids[0]},
+			count:    2,
+		},
+		"count things of a group": {
+			groupIDs: []string{gids[1]},
+			count:    2,
+		},
+		"count things of multiple groups": {
+			groupIDs: gids,
+			count:    4,
+		},
+		"count things of non-existing group": {
+			groupIDs: []string{wrongValue},
+			count:    0,
+		},
+		"count things without groups": {
+			groupIDs: []string{},
+			count:    0,
+		},
+	}
+
+	for desc, tc := range cases {
+		count, err := thingRepo.CountByGroupIDs(context.Background(), tc.groupIDs)
+		assert.Nil(t, err, fmt.Sprintf("%s: expected no error got %s\n", desc, err))
+		assert.Equal(t, tc.count, count, fmt.Sprintf("%s: expected %d got %d\n", desc, tc.count, count))
+	}
+}
+
+func TestThingMetadataFacet(t *testing.T) {
+	email := "thing-metadata-facet@example.com"
+	dbMiddleware := postgres.NewDatabase(db)
+	thingRepo := postgres.NewThingRepository(dbMiddleware)
+	groupRepo := postgres.NewGroupRepo(dbMiddleware)
+
+	var gids []string
+	for i := 0; i < 2; i++ {
+		gid, err := uuidProvider.New().ID()
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+		_, err = groupRepo.Save(context.Background(), groups.Group{ID: gid, OwnerID: email, Name: fmt.Sprintf("faceted-%d", i)})
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+		gids = append(gids, gid)
+	}
+
+	// All the things but the last one are members of the first group.
+	metadata := []things.Metadata{
+		{"firmware": "1.0"},
+		{"firmware": "1.0"},
+		{"firmware": "1.1"},
+		{"firmware": 2},
+		{"firmware": nil},
+		{"model": "a"},
+		{"firmware": "1.1"},
+	}
+	for i, m := range metadata {
+		id, err := uuidProvider.New().ID()
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+		key, err := uuidProvider.New().ID()
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+		_, err = thingRepo.Save(context.Background(), things.Thing{ID: id, Owner: email, Key: key, Metadata: m})
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+		gid := gids[0]
+		if i == len(metadata)-1 {
+			gid = gids[1]
+		}
+		err = groupRepo.Assign(context.Background(), id, gid)
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+	}
+
+	cases := map[string]struct {
+		groupIDs []string
+		key      string
+		facet    map[string]uint64
+	}{
+		"retrieve facet of a group": {
+			groupIDs: []string{gids[0]},
+			key:      "firmware",
+			facet:    map[string]uint64{"1.0": 2, "1.1": 1, "2": 1, things.NullFacet: 2},
+		},
+		"retrieve facet of multiple groups": {
+			groupIDs: gids,
+			key:      "firmware",
+			facet:    map[string]uint64{"1.0": 2, "1.1": 2, "2": 1, things.NullFacet: 2},
+		},
+		"retrieve facet of a key set by few things": {
+			groupIDs: []string{gids[0]},
+			key:      "model",
+			facet:    map[string]uint64{"a": 1, things.NullFacet: 5},
+		},
+		"retrieve facet of non-existing group": {
+			groupIDs: []string{wrongValue},
+			key:      "firmware",
+			facet:    map[string]uint64{},
+		},
+		"retrieve facet without groups": {
+			groupIDs: []string{},
+			key:      "firmware",
+			facet:    map[string]uint64{},
+		},
+	}
+
+	for desc, tc := range cases {
+		facet, err := thingRepo.MetadataFacet(context.Background(), tc.groupIDs, tc.key)
+		assert.Nil(t, err, fmt.Sprintf("%s: expected no error got %s\n", desc, err))
+		assert.Equal(t, tc.facet, facet, fmt.Sprintf("%s: expected %v got %v\n", desc, tc.facet, facet))
+	}
+}
+
+func TestThingChangeStatus(t *testing.T) {
+	email := "thing-change-status@example.com"
+	dbMiddleware := postgres.NewDatabase(db)
+	thingRepo := postgres.NewThingRepository(dbMiddleware)
+	groupRepo := postgres.NewGroupRepo(dbMiddleware)
+
+	gid, err := uuidProvider.New().ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	_, err = groupRepo.Save(context.Background(), groups.Group{ID: gid, OwnerID: email, Name: "status"})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+
+	var ids []string
+	for i := 0; i < 3; i++ {
+		id, err := uuidProvider.New().ID()
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+		key, err := uuidProvider.New().ID()
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+		_, err = thingRepo.Save(context.Background(), things.Thing{ID: id, Owner: email, Key: key})
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+		err = groupRepo.Assign(context.Background(), id, gid)
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+		ids = append(ids, id)
+	}
+
+	missing, err := uuidProvider.New().ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	th, err := thingRepo.RetrieveByID(context.Background(), email, ids[0])
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+	assert.Equal(t, things.EnabledStatus, th.Status, fmt.Sprintf("expected saved thing status %s got %s\n", things.EnabledStatus, th.Status))
+	err = thingRepo.ChangeStatus(context.Background(), ids[1], things.DisabledStatus)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+
+	cases := map[string]struct {
+		id     string
+		status string
+		err    error
+	}{
+		"disable existing thing": {
+			id:     ids[0],
+			status: things.DisabledStatus,
+			err:    nil,
+		},
+		"enable disabled thing": {
+			id:     ids[1],
+			status: things.EnabledStatus,
+			err:    nil,
+		},
+		"change status to invalid status": {
+			id:     ids[2],
+			status: wrongValue,
+			err:    things.ErrMalformedEntity,
+		},
+		"change status of non-existing thing": {
+			id:     missing,
+			status: things.DisabledStatus,
+			err:    things.ErrNotFound,
+		},
+		"change status of thing with malformed ID": {
+			id:     wrongValue,
+			status: things.DisabledStatus,
+			err:    things.ErrNotFound,
+		},
+	}
+
+	for desc, tc := range cases {
+		err := thingRepo.ChangeStatus(context.Background(), tc.id, tc.status)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s\n", desc, tc.err, err))
+	}
+
+	th, err = thingRepo.RetrieveByID(context.Background(), email, ids[0])
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+	assert.Equal(t, things.DisabledStatus, th.Status, fmt.Sprintf("expected disabled thing status %s got %s\n", things.DisabledStatus, th.Status))
+
+	listings := map[string]struct {
+		status string
+		ids    []string
+		err    error
+	}{
+		"list enabled things by default": {
+			status: "",
+			ids:    ids[1:],
+		},
+		"list disabled things": {
+			status: things.DisabledStatus,
+			ids:    ids[:1],
+		},
+		"list things of any status": {
+			status: things.AllStatus,
+			ids:    ids,
+		},
+		"list things with invalid status": {
+			status: wrongValue,
+			err:    things.ErrMalformedEntity,
+		},
+	}
+
+	for desc, tc := range listings {
+		page, err := thingRepo.RetrieveByGroupIDs(context.Background(), email, []string{gid}, things.PageMetadata{Limit: 10, Status: tc.status})
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s\n", desc, tc.err, err))
+		if tc.err != nil {
+			continue
+		}
+		var got []string
+		for _, th := range page.Things {
+			got = append(got, th.ID)
+		}
+		assert.ElementsMatch(t, tc.ids, got, fmt.Sprintf("%s: expected things %v got %v\n", desc, tc.ids, got))
+		assert.Equal(t, uint64(len(tc.ids)), page.Total, fmt.Sprintf("%s: expected total %d got %d\n", desc, len(tc.ids), page.Total))
+	}
+}
+
+func TestThingTemporaryKeys(t *testing.T) {
+	email := "thing-temporary-keys@example.com"
+	now := time.Now().Truncate(time.Millisecond)
+	clock := func() time.Time { return now }
+	thingRepo := postgres.NewThingRepositoryWithClock(postgres.NewDatabase(db), clock)
+
+	id, err := uuidProvider.New().ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	key, err := uuidProvider.New().ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	_, err = thingRepo.Save(context.Background(), things.Thing{ID: id, Owner: email, Key: key})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+
+	missing, err := uuidProvider.New().ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	tempKey, err := uuidProvider.New().ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	saves := map[string]struct {
+		owner string
+		id    string
+		key   string
+		err   error
+	}{
+		"save temporary key of existing thing": {
+			owner: email,
+			id:    id,
+			key:   tempKey,
+			err:   nil,
+		},
+		"save temporary key equal to primary key": {
+			owner: email,
+			id:    id,
+			key:   key,
+			err:   things.ErrConflict,
+		},
+		"save temporary key of non-existing thing": {
+			owner: email,
+			id:    missing,
+			key:   "orphan-key",
+			err:   things.ErrNotFound,
+		},
+		"save temporary key of thing of another owner": {
+			owner: wrongValue,
+			id:    id,
+			key:   "foreign-key",
+			err:   things.ErrNotFound,
+		},
+		"save temporary key of thing with malformed ID": {
+			owner: email,
+			id:    wrongValue,
+			key:   "malformed-key",
+			err:   things.ErrMalformedEntity,
+		},
+	}
+
+	for desc, tc := range saves {
+		err := thingRepo.SaveTemporaryKey(context.Background(), tc.owner, tc.id, tc.key, now.Add(time.Minute))
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s\n", desc, tc.err, err))
+	}
+
+	got, err := thingRepo.RetrieveByKey(context.Background(), tempKey)
+	assert.Nil(t, err, fmt.Sprintf("retrieve by temporary key before expiry: expected no error got %s\n", err))
+	assert.Equal(t, id, got, fmt.Sprintf("retrieve by temporary key before expiry: expected %s got %s\n", id, got))
+
+	expiresAt, err := thingRepo.RetrieveKeyExpiry(context.Background(), tempKey)
+	assert.Nil(t, err, fmt.Sprintf("retrieve temporary key expiry: expected no error got %s\n", err))
+	assert.WithinDuration(t, now.Add(time.Minute), expiresAt, time.Millisecond, fmt.Sprintf("retrieve temporary key expiry: expected %s got %s\n", now.Add(time.Minute), expiresAt))
+	expiresAt, err = thingRepo.RetrieveKeyExpiry(context.Background(), key)
+	assert.Nil(t, err, fmt.Sprintf("retrieve primary key expiry: expected no error got %s\n", err))
+	assert.True(t, expiresAt.IsZero(), fmt.Sprintf("retrieve primary key expiry: expected zero time got %s\n", expiresAt))
+
+	removed, err :=thingRepo.RemoveExpiredKeys(context.Background(), now)
+	assert.Nil(t, err, fmt.Sprintf("remove keys before expiry: expected no error got %s\n", err))
+	assert.Empty(t, removed, fmt.Sprintf("remove keys before expiry: expected no keys got %v\n", removed))
+
+	now = now.Add(time.Minute)
+	_, err = thingRepo.RetrieveByKey(context.Background(), tempKey)
+	assert.True(t, errors.Contains(err, things.ErrAuthorization), fmt.Sprintf("retrieve by temporary key after expiry: expected %s got %s\n", things.ErrAuthorization, err))
+	got, err = thingRepo.RetrieveByKey(context.Background(), key)
+	assert.Nil(t, err, fmt.Sprintf("retrieve by primary key after expiry: expected no error got %s\n", err))
+	assert.Equal(t, id, got, fmt.Sprintf("retrieve by primary key after expiry: expected %s got %s\n", id, got))
+
+	removed, err = thingRepo.RemoveExpiredKeys(context.Background(), now)
+	assert.Nil(t, err, fmt.Sprintf("remove expired keys: expected no error got %s\n", err))
+	assert.Equal(t, []string{tempKey}, removed, fmt.Sprintf("remove expired keys: expected %v got %v\n", []string{tempKey}, removed))
+	_, err = thingRepo.RetrieveByKey(context.Background(), tempKey)
+	assert.True(t, errors.Contains(err, things.ErrNotFound), fmt.Sprintf("retrieve by removed key: expected %s got %s\n", things.ErrNotFound, err))
+}
+
+func TestThingRetrieveCompactByGroupIDs(t *testing.T) {
+	email := "thing-compact-retrieval-by-group-ids@example.com"
+	dbMiddleware := postgres.NewDatabase(db)
+	thingRepo := postgres.NewThingRepository(dbMiddleware)
+	channelRepo := postgres.NewChannelRepository(dbMiddleware)
+	groupRepo := postgres.NewGroupRepo(dbMiddleware)
+
+	gid, err := uuidProvider.New().ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	_, err = groupRepo.Save(context.Background(), groups.Group{ID: gid, OwnerID: email, Name: "compact"})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+
+	chid, err := uuidProvider.New().ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	_, err = channelRepo.Save(context.Background(), things.Channel{ID: chid, Owner: email})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+
+	n := uint64(10)
+	connNum := 4
+	connected := make(map[string]bool)
+	names := make(map[string]string)
+	for i := 0; i < int(n); i++ {
+		id, err := uuidProvider.New().ID()
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+		key, err := uuidProvider.New().ID()
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+		th := things.Thing{
+			ID:       id,
+			Owner:    email,
+			Name:     fmt.Sprintf("compact-%d", i),
+			Key:      key,
+			Metadata: things.Metadata{"firmware": "v1.0.0"},
+		}
+		_, err = thingRepo.Save(context.Background(), th)
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+		err = groupRepo.Assign(context.Background(), id, gid)
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+		names[id] = th.Name
+
+		if i < connNum {
+			err = channelRepo.Connect(context.Background(), email, []string{chid}, []string{id}, 0)
+			require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+			connected[id] = true
+		}
+	}
+
+	cases := map[string]struct {
+		groupIDs []string
+		pm       things.PageMetadata
+		size     uint64
+	}{
+		"retrieve compact group things": {
+			groupIDs: []string{gid},
+			pm:       things.PageMetadata{Offset: 0, Limit: n},
+			size:     n,
+		},
+		"retrieve compact group things with offset": {
+			groupIDs: []string{gid},
+			pm:       things.PageMetadata{Offset: 6, Limit: 3},
+			size:     3,
+		},
+		"retrieve compact group things with offset past the end": {
+			groupIDs: []string{gid},
+			pm:       things.PageMetadata{Offset: 8, Limit: n},
+			size:     2,
+		},
+		"retrieve compact things without groups": {
+			groupIDs: []string{},
+			pm:       things.PageMetadata{Limit: n},
+			size:     0,
+		},
+	}
+
+	for desc, tc := range cases {
+		page, err := thingRepo.RetrieveCompactByGroupIDs(context.Background(), email, tc.groupIDs, tc.pm)
+		assert.Nil(t, err, fmt.Sprintf("%s: expected no error got %s\n", desc, err))
+		size := uint64(len(page.Things))
+		assert.Equal(t, tc.size, size, fmt.Sprintf("%s: expected %d things got %d\n", desc, tc.size, size))
+		assert.Equal(t, tc.pm.Offset, page.Offset, fmt.Sprintf("%s: expected offset %d got %d\n", desc, tc.pm.Offset, page.Offset))
+		if len(tc.groupIDs) > 0 {
+			assert.Equal(t, n, page.Total, fmt.Sprintf("%s: expected total %d got %d\n", desc, n, page.Total))
+		}
+		for _, th := range page.Things {
+			assert.Equal(t, names[th.ID], th.Name, fmt.Sprintf("%s: expected name %s got %s\n", desc, names[th.ID], th.Name))
+			assert.Equal(t, connected[th.ID], th.Connected, fmt.Sprintf("%s: expected connected %t got %t\n", desc, connected[th.ID], th.Connected))
+		}
+	}
+
+	full, err := thingRepo.RetrieveByGroupIDs(context.Background(), email, []string{gid}, things.PageMetadata{Limit: n})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+	compact, err := thingRepo.RetrieveCompactByGroupIDs(context.Background(), email, []string{gid}, things.PageMetadata{Limit: n})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+	require.Equal(t, len(full.Things), len(compact.Things), "expected the same things in the full and compact pages")
+	for i := range full.Things {
+		assert.Equal(t, full.Things[i].ID, compact.Things[i].ID, fmt.Sprintf("expected thing %s at %d got %s\n", full.Things[i].ID, i, compact.Things[i].ID))
+	}
+}
+
+func TestThingRetrieveByMetadata(t *testing.T) {
+	email := "thing-retrieval-by-metadata@example.com"
+	dbMiddleware := postgres.NewDatabase(db)
+	thingRepo := postgres.NewThingRepository(dbMiddleware)
+	groupRepo := postgres.NewGroupRepo(dbMiddleware)
+
+	gid, err := uuidProvider.New().ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	_, err = groupRepo.Save(context.Background(), groups.Group{ID: gid, OwnerID: email, Name: "by-metadata"})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+
+	n := 12
+	for i := 0; i < n; i++ {
+		id, err := uuidProvider.New().ID()
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+		key, err := uuidProvider.New().ID()
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+		md := things.Metadata{"type": "sensor", "location": map[string]interface{}{"building": "a", "floor": "1"}}
+		if i%3 == 0 {
+			md = things.Metadata{"type": "actuator"}
+		}
+		_, err = thingRepo.Save(context.Background(), things.Thing{ID: id, Owner: email, Key: key, Metadata: md})
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+		if i < n/2 {
+			err = groupRepo.Assign(context.Background(), id, gid)
+			require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+		}
+	}
+
+	cases := map[string]struct {
+		groupIDs []string
+		filter   things.Metadata
+		pm       things.PageMetadata
+		size     uint64
+		total    uint64
+	}{
+		"retrieve things by metadata": {
+			filter: things.Metadata{"type": "sensor"},
+			pm:     things.PageMetadata{Limit: 100},
+			size:   8,
+			total:  8,
+		},
+		"retrieve page of things by metadata": {
+			filter: things.Metadata{"type": "sensor"},
+			pm:     things.PageMetadata{Offset: 6, Limit: 5},
+			size:   2,
+			total:  8,
+		},
+		"retrieve things by nested metadata": {
+			filter: things.Metadata{"location": map[string]interface{}{"building": "a", "floor": "1"}},
+			pm:     things.PageMetadata{Limit: 100},
+			size:   8,
+			total:  8,
+		},
+		"retrieve things by partial nested metadata": {
+			filter: things.Metadata{"location": map[string]interface{}{"building": "a"}},
+			pm:     things.PageMetadata{Limit: 100},
+			size:   0,
+			total:  0,
+		},
+		"retrieve group things by metadata": {
+			groupIDs: []string{gid},
+			filter:   things.Metadata{"type": "actuator"},
+			pm:       things.PageMetadata{Limit: 100},
+			size:     2,
+			total:    2,
+		},
+	}
+
+	for desc, tc := range cases {
+		page, err := thingRepo.RetrieveByMetadata(context.Background(), email, tc.groupIDs, tc.filter, tc.pm)
+		assert.Nil(t, err, fmt.Sprintf("%s: expected no error got %s\n", desc, err))
+		size := uint64(len(page.Things))
+		assert.Equal(t, tc.size, size, fmt.Sprintf("%s: expected %d things got %d\n", desc, tc.size, size))
+		assert.Equal(t, tc.total, page.Total, fmt.Sprintf("%s: expected total %d got %d\n", desc, tc.total, page.Total))
+	}
+}
+
+func TestThingSearch(t *testing.T) {
+	email := "thing-search@example.com"
+	dbMiddleware := postgres.NewDatabase(db)
+	thingRepo := postgres.NewThingRepository(dbMiddleware)
+	groupRepo := postgres.NewGroupRepo(dbMiddleware)
+
+	gid, err := uuidProvider.New().ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	_, err = groupRepo.Save(context.Background(), groups.Group{ID: gid, OwnerID: email, Name: "search"})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+
+	// The first half of the things are named sensors, and the others
+	// gateways. Every second thing is located in the north building.
+	n := 12
+	for i := 0; i < n; i++ {
+		id, err := uuidProvider.New().ID()
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+		key, err := uuidProvider.New().ID()
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+		name := fmt.Sprintf("Search Sensor %d", i)
+		if i >= n/2 {
+			name = fmt.Sprintf("search-gateway-%d", i)
+		}
+		md := things.Metadata{"port": 4242}
+		if i%2 == 0 {
+			md["location"] = "Building North"
+		}
+		_, err = thingRepo.Save(context.Background(), things.Thing{ID: id, Owner: email, Name: name, Key: key, Metadata: md})
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+		err = groupRepo.Assign(context.Background(), id, gid)
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+	}
+
+	cases := map[string]struct {
+		query string
+		pm    things.PageMetadata
+		size  uint64
+		total uint64
 	}{
-		"retrieve thing with existing user": {
-			owner: th.Owner,
-			ID:    th.ID,
-			err:   nil,
+		"search things by name": {
+			query: "SENSOR",
+			pm:    things.PageMetadata{Limit: 100},
+			size:  6,
+			total: 6,
 		},
-		"retrieve non-existing thing with existing user": {
-			owner: th.Owner,
-			ID:    nonexistentThingID,
-			err:   things.ErrNotFound,
+		"search things by metadata only": {
+			query: "north",
+			pm:    things.PageMetadata{Limit: 100},
+			size:  6,
+			total: 6,
 		},
-		"retrieve thing with non-existing owner": {
-			owner: wrongValue,
-			ID:    th.ID,
-			err:   things.ErrNotFound,
+		"search page of things by name or metadata": {
+			query: "n",
+			pm:    things.PageMetadata{Offset: 5, Limit: 5},
+			size:  4,
+			total: 9,
 		},
-		"retrieve thing with malformed ID": {
-			owner: th.Owner,
-			ID:    wrongValue,
-			err:   things.ErrNotFound,
+		"search things by numeric metadata": {
+			query: "4242",
+			pm:    things.PageMetadata{Limit: 100},
+			size:  0,
+			total: 0,
 		},
 	}
 
 	for desc, tc := range cases {
-		_, err := thingRepo.RetrieveByID(context.Background(), tc.owner, tc.ID)
-		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s\n", desc, tc.err, err))
+		page, err := thingRepo.Search(context.Background(), []string{gid}, tc.query, tc.pm)
+		assert.Nil(t, err, fmt.Sprintf("%s: expected no error got %s\n", desc, err))
+		size := uint64(len(page.Things))
+		assert.Equal(t, tc.size, size, fmt.Sprintf("%s: expected %d things got %d\n", desc, tc.size, size))
+		assert.Equal(t, tc.total, page.Total, fmt.Sprintf("%s: expected total %d got %d\n", desc, tc.total, page.Total))
+	}
+}
+
+func TestThingRetrieveAllStream(t *testing.T) {
+	dbMiddleware := postgres.NewDatabase(db)
+	thingRepo := postgres.NewThingRepository(dbMiddleware)
+
+	saved := make(map[string]bool)
+	for i := 0; i < 7; i++ {
+		id, err := uuidProvider.New().ID()
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+		key, err := uuidProvider.New().ID()
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+		owner := fmt.Sprintf("thing-stream-%d@example.com", i%2)
+		_, err = thingRepo.Save(context.Background(), things.Thing{ID: id, Owner: owner, Key: key})
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+		saved[id] = true
+	}
+
+	for _, batchSize := range []int{1, 3, 100} {
+		ths, errs := thingRepo.RetrieveAllStream(context.Background(), batchSize)
+		delivered := make(map[string]int)
+		for th := range ths {
+			delivered[th.ID]++
+		}
+		err := <-errs
+		assert.Nil(t, err, fmt.Sprintf("batch of %d: expected no error got %s\n", batchSize, err))
+		for id := range saved {
+			assert.Equal(t, 1, delivered[id], fmt.Sprintf("batch of %d: expected thing %s once got %d times\n", batchSize, id, delivered[id]))
+		}
 	}
 }
 
@@ -334,10 +1437,14 @@ func TestThingRetrieveByKey(t *testing.T) {
 	key, err := uuidProvider.New().ID()
 	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
 
+	extraKey, err := uuidProvider.New().ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
 	th := things.Thing{
 		ID:    id,
 		Owner: email,
 		Key:   key,
+		Keys:  []string{extraKey},
 	}
 
 	ths, err := thingRepo.Save(context.Background(), th)
@@ -354,6 +1461,11 @@ func TestThingRetrieveByKey(t *testing.T) {
 			ID:  th.ID,
 			err: nil,
 		},
+		"retrieve existing thing by additional key": {
+			key: extraKey,
+			ID:  th.ID,
+			err: nil,
+		},
 		"retrieve non-existent thing by key": {
 			key: wrongValue,
 			ID:  "",
@@ -500,6 +1612,37 @@ func TestMultiThingRetrieval(t *testing.T) {
 			},
 			size: nameMetaNum,
 		},
+		"retrieve things having metadata key": {
+			owner: email,
+			pageMetadata: things.PageMetadata{
+				Offset:          0,
+				Limit:           n,
+				Total:           metaNum + nameMetaNum,
+				HasMetadataKeys: []string{"field"},
+			},
+			size: metaNum + nameMetaNum,
+		},
+		"retrieve things missing metadata key": {
+			owner: email,
+			pageMetadata: things.PageMetadata{
+				Offset:              0,
+				Limit:               n,
+				Total:               n - metaNum - nameMetaNum,
+				MissingMetadataKeys: []string{"field"},
+			},
+			size: n - metaNum - nameMetaNum,
+		},
+		"retrieve things having and missing metadata keys": {
+			owner: email,
+			pageMetadata: things.PageMetadata{
+				Offset:              0,
+				Limit:               n,
+				Total:               metaNum + nameMetaNum,
+				HasMetadataKeys:     []string{"field"},
+				MissingMetadataKeys: []string{"wrong"},
+			},
+			size: metaNum + nameMetaNum,
+		},
 		"retrieve things sorted by name ascendent": {
 			owner: email,
 			pageMetadata: things.PageMetadata{
@@ -549,6 +1692,254 @@ func TestMultiThingRetrieval(t *testing.T) {
 	}
 }
 
+func TestMultiThingRetrievalAnyOf(t *testing.T) {
+	email := "thing-multi-retrieval-any-of@example.com"
+	dbMiddleware := postgres.NewDatabase(db)
+	thingRepo := postgres.NewThingRepository(dbMiddleware)
+
+	names := []string{"lamp-a", "lamp-b", "lamp-c", "sensor-a", "sensor-b"}
+	for i, name := range names {
+		id, err := uuidProvider.New().ID()
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+		key, err := uuidProvider.New().ID()
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+		th := things.Thing{
+			ID:       id,
+			Owner:    email,
+			Key:      key,
+			Name:     name,
+			Metadata: things.Metadata{},
+		}
+		// The first lamp and the first sensor are in the kitchen.
+		if i == 0 || i == 3 {
+			th.Metadata["room"] = "kitchen"
+		}
+		_, err = thingRepo.Save(context.Background(), th)
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+	}
+
+	anyOf := []things.Filter{
+		{Name: "lamp"},
+		{Metadata: map[string]interface{}{"room": "kitchen"}},
+	}
+
+	cases := map[string]struct {
+		pageMetadata things.PageMetadata
+		size         uint64
+		total        uint64
+	}{
+		"retrieve things matching any of the filters": {
+			pageMetadata: things.PageMetadata{
+				Offset: 0,
+				Limit:  10,
+				AnyOf:  anyOf,
+			},
+			size:  4,
+			total: 4,
+		},
+		"retrieve page of things matching any of the filters": {
+			pageMetadata: things.PageMetadata{
+				Offset: 2,
+				Limit:  3,
+				AnyOf:  anyOf,
+			},
+			size:  2,
+			total: 4,
+		},
+		"retrieve things matching a filter with multiple predicates": {
+			pageMetadata: things.PageMetadata{
+				Offset: 0,
+				Limit:  10,
+				AnyOf: []things.Filter{
+					{Name: "sensor", Metadata: map[string]interface{}{"room": "kitchen"}},
+				},
+			},
+			size:  1,
+			total: 1,
+		},
+		"retrieve things matching an empty filter": {
+			pageMetadata: things.PageMetadata{
+				Offset: 0,
+				Limit:  10,
+				AnyOf:  []things.Filter{{Name: "lamp"}, {}},
+			},
+			size:  uint64(len(names)),
+			total: uint64(len(names)),
+		},
+	}
+
+	for desc, tc := range cases {
+		page, err := thingRepo.RetrieveAll(context.Background(), email, tc.pageMetadata)
+		require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s\n", desc, err))
+		size := uint64(len(page.Things))
+		assert.Equal(t, tc.size, size, fmt.Sprintf("%s: expected size %d got %d\n", desc, tc.size, size))
+		assert.Equal(t, tc.total, page.Total, fmt.Sprintf("%s: expected total %d got %d\n", desc, tc.total, page.Total))
+	}
+}
+
+func TestMultiThingRetrievalConnectedOnly(t *testing.T) {
+	email := "thing-multi-retrieval-connected-only@example.com"
+	up := uuidProvider.New()
+	dbMiddleware := postgres.NewDatabase(db)
+	thingRepo := postgres.NewThingRepository(dbMiddleware)
+	channelRepo := postgres.NewChannelRepository(dbMiddleware)
+
+	n := uint64(10)
+	connNum := uint64(4)
+
+	chid, err := up.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	chs, err := channelRepo.Save(context.Background(), things.Channel{
+		ID:    chid,
+		Owner: email,
+	})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	cid := chs[0].ID
+
+	for i := uint64(0); i < n; i++ {
+		thid, err := up.ID()
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+		thkey, err := up.ID()
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+		th := things.Thing{
+			ID:    thid,
+			Owner: email,
+			Key:   thkey,
+		}
+
+		ths, err := thingRepo.Save(context.Background(), th)
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+
+		if i < connNum {
+			err = channelRepo.Connect(context.Background(), email, []string{cid}, []string{ths[0].ID}, 0)
+			require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+		}
+	}
+
+	cases := map[string]struct {
+		pageMetadata things.PageMetadata
+		size         uint64
+		total        uint64
+	}{
+		"retrieve all things": {
+			pageMetadata: things.PageMetadata{
+				Offset: 0,
+				Limit:  n,
+			},
+			size:  n,
+			total: n,
+		},
+		"retrieve connected things": {
+			pageMetadata: things.PageMetadata{
+				Offset:        0,
+				Limit:         n,
+				ConnectedOnly: true,
+			},
+			size:  connNum,
+			total: connNum,
+		},
+		"retrieve connected things with limit": {
+			pageMetadata: things.PageMetadata{
+				Offset:        0,
+				Limit:         connNum / 2,
+				ConnectedOnly: true,
+			},
+			size:  connNum / 2,
+			total: connNum,
+		},
+	}
+
+	for desc, tc := range cases {
+		page, err := thingRepo.RetrieveAll(context.Background(), email, tc.pageMetadata)
+		require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s\n", desc, err))
+		size := uint64(len(page.Things))
+		assert.Equal(t, tc.size, size, fmt.Sprintf("%s: expected size %d got %d\n", desc, tc.size, size))
+		assert.Equal(t, tc.total, page.Total, fmt.Sprintf("%s: expected total %d got %d\n", desc, tc.total, page.Total))
+	}
+}
+
+func TestMultiThingRetrievalWithConnections(t *testing.T) {
+	email := "thing-multi-retrieval-with-connections@example.com"
+	up := uuidProvider.New()
+	dbMiddleware := postgres.NewDatabase(db)
+	thingRepo := postgres.NewThingRepository(dbMiddleware)
+	channelRepo := postgres.NewChannelRepository(dbMiddleware)
+
+	n := uint64(10)
+	chNum := 2
+
+	var cids []string
+	for i := 0; i < chNum; i++ {
+		chid, err := up.ID()
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+		chs, err := channelRepo.Save(context.Background(), things.Channel{
+			ID:    chid,
+			Owner: email,
+		})
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+		cids = append(cids, chs[0].ID)
+	}
+
+	// The things are connected to none, one or both channels in turn.
+	connections := make(map[string]uint64)
+	for i := uint64(0); i < n; i++ {
+		thid, err := up.ID()
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+		thkey, err := up.ID()
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+		th := things.Thing{
+			ID:    thid,
+			Owner: email,
+			Key:   thkey,
+		}
+
+		ths, err := thingRepo.Save(context.Background(), th)
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+
+		connNum := i % uint64(chNum+1)
+		if connNum > 0 {
+			err = channelRepo.Connect(context.Background(), email, cids[:connNum], []string{ths[0].ID}, 0)
+			require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+		}
+		connections[ths[0].ID] = connNum
+	}
+
+	cases := map[string]struct {
+		pageMetadata things.PageMetadata
+		status       bool
+	}{
+		"retrieve things without connection status": {
+			pageMetadata: things.PageMetadata{
+				Offset: 0,
+				Limit:  n,
+			},
+			status: false,
+		},
+		"retrieve things with connection status": {
+			pageMetadata: things.PageMetadata{
+				Offset:          0,
+				Limit:           n,
+				WithConnections: true,
+			},
+			status: true,
+		},
+	}
+
+	for desc, tc := range cases {
+		page, err := thingRepo.RetrieveAll(context.Background(), email, tc.pageMetadata)
+		require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s\n", desc, err))
+		assert.Equal(t, n, uint64(len(page.Things)), fmt.Sprintf("%s: expected size %d got %d\n", desc, n, len(page.Things)))
+		for _, th := range page.Things {
+			expected := uint64(0)
+			if tc.status {
+				expected = connections[th.ID]
+			}
+			assert.Equal(t, expected, th.Connections, fmt.Sprintf("%s: expected %d connections got %d\n", desc, expected, th.Connections))
+			assert.Equal(t, expected > 0, th.Connected, fmt.Sprintf("%s: expected connected %t got %t\n", desc, expected > 0, th.Connected))
+		}
+	}
+}
+
 func TestMultiThingRetrievalByChannel(t *testing.T) {
 	email := "thing-multi-retrieval-by-channel@example.com"
 	up := uuidProvider.New()
@@ -588,7 +1979,7 @@ func TestMultiThingRetrievalByChannel(t *testing.T) {
 			break
 		}
 
-		err = channelRepo.Connect(context.Background(), email, []string{cid}, []string{thid})
+		err = channelRepo.Connect(context.Background(), email, []string{cid}, []string{thid}, 0)
 		require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
 	}
 
@@ -656,13 +2047,88 @@ func TestMultiThingRetrievalByChannel(t *testing.T) {
 	}
 
 	for desc, tc := range cases {
-		page, err := thingRepo.RetrieveByChannel(context.Background(), tc.owner, tc.channel, tc.offset, tc.limit, tc.connected)
+		page, err := thingRepo.RetrieveByChannel(context.Background(), tc.owner, tc.channel, tc.connected, things.PageMetadata{Offset: tc.offset, Limit: tc.limit})
 		size := uint64(len(page.Things))
 		assert.Equal(t, tc.size, size, fmt.Sprintf("%s: expected size %d got %d\n", desc, tc.size, size))
 		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected no error got %d\n", desc, err))
 	}
 }
 
+func TestMultiThingRetrievalByChannelConnectedAt(t *testing.T) {
+	email := "thing-multi-retrieval-by-connected-at@example.com"
+	up := uuidProvider.New()
+	dbMiddleware := postgres.NewDatabase(db)
+	thingRepo := postgres.NewThingRepository(dbMiddleware)
+	channelRepo := postgres.NewChannelRepository(dbMiddleware)
+
+	chid, err := up.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	chs, err := channelRepo.Save(context.Background(), things.Channel{
+		ID:    chid,
+		Owner: email,
+	})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	cid := chs[0].ID
+
+	var ids []string
+	for i := 0; i < 3; i++ {
+		thid, err := up.ID()
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+		thkey, err := up.ID()
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+		ths, err := thingRepo.Save(context.Background(), things.Thing{ID: thid, Owner: email, Key: thkey})
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+		ids = append(ids, ths[0].ID)
+	}
+
+	// Connect things in an order different from the creation order.
+	connected := []string{ids[2], ids[0], ids[1]}
+	for _, id := range connected {
+		err = channelRepo.Connect(context.Background(), email, []string{cid}, []string{id}, 0)
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+		time.Sleep(time.Millisecond)
+	}
+
+	cases := map[string]struct {
+		offset uint64
+		limit  uint64
+		dir    string
+		ids    []string
+	}{
+		"retrieve things ordered by connection time ascending": {
+			offset: 0,
+			limit:  10,
+			dir:    "asc",
+			ids:    connected,
+		},
+		"retrieve things ordered by connection time descending": {
+			offset: 0,
+			limit:  10,
+			dir:    "desc",
+			ids:    []string{connected[2], connected[1], connected[0]},
+		},
+		"retrieve things ordered by connection time with offset and limit": {
+			offset: 1,
+			limit:  1,
+			dir:    "desc",
+			ids:    []string{connected[1]},
+		},
+	}
+
+	for desc, tc := range cases {
+		pm := things.PageMetadata{Offset: tc.offset, Limit: tc.limit, Order: things.OrderConnectedAt, Dir: tc.dir}
+		page, err := thingRepo.RetrieveByChannel(context.Background(), email, cid, true, pm)
+		require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", desc, err))
+		var got []string
+		for _, th := range page.Things {
+			got = append(got, th.ID)
+		}
+		assert.Equal(t, tc.ids, got, fmt.Sprintf("%s: expected %v got %v\n", desc, tc.ids, got))
+		assert.Equal(t, uint64(len(connected)), page.Total, fmt.Sprintf("%s: expected total %d got %d\n", desc, len(connected), page.Total))
+	}
+}
+
 func TestThingRemoval(t *testing.T) {
 	email := "thing-removal@example.com"
 	dbMiddleware := postgres.NewDatabase(db)
@@ -691,3 +2157,46 @@ func TestThingRemoval(t *testing.T) {
 		require.True(t, errors.Contains(err, things.ErrNotFound), fmt.Sprintf("#%d: expected %s got %s", i, things.ErrNotFound, err))
 	}
 }
+
+func TestThingRetrieveAllReplica(t *testing.T) {
+	email := "thing-replica@example.com"
+	up := uuidProvider.New()
+	id, err := up.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	key, err := up.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	cases := map[string]struct {
+		err     error
+		replica map[string]int
+		primary map[string]int
+	}{
+		"retrieve all things from available replica": {
+			err:     nil,
+			replica: map[string]int{"query": 2},
+			primary: map[string]int{},
+		},
+		"retrieve all things from unavailable replica": {
+			err:     errUnavailable,
+			replica: map[string]int{"query": 2},
+			primary: map[string]int{"query": 2},
+		},
+	}
+
+	write := newDatabaseStub(postgres.NewDatabase(db), nil)
+	thingRepo := postgres.NewThingRepositoryWithReader(write, postgres.NewDatabase(db))
+	_, err = thingRepo.Save(context.Background(), things.Thing{ID: id, Owner: email, Key: key})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	assert.Equal(t, map[string]int{"tx": 1}, write.calls, fmt.Sprintf("expected the write on the primary got %v", write.calls))
+
+	for desc, tc := range cases {
+		primary := newDatabaseStub(postgres.NewDatabase(db), nil)
+		replica := newDatabaseStub(postgres.NewDatabase(db), tc.err)
+		thingRepo := postgres.NewThingRepositoryWithReader(primary, postgres.NewReplicaDatabase(primary, replica, testLog))
+		page, err := thingRepo.RetrieveAll(context.Background(), email, things.PageMetadata{Limit: 10})
+		assert.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", desc, err))
+		assert.Equal(t, uint64(1), page.Total, fmt.Sprintf("%s: expected total 1 got %d", desc, page.Total))
+		assert.Equal(t, tc.replica, replica.calls, fmt.Sprintf("%s: expected replica statements %v got %v", desc, tc.replica, replica.calls))
+		assert.Equal(t, tc.primary, primary.calls, fmt.Sprintf("%s: expected primary statements %v got %v", desc, tc.primary, primary.calls))
+	}
+}
@@ -6,13 +6,18 @@ package redis
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"github.com/go-redis/redis"
 	"github.com/mainflux/mainflux/pkg/errors"
 	"github.com/mainflux/mainflux/things"
 )
 
-const chanPrefix = "channel"
+const (
+	chanPrefix  = "channel"
+	connsPrefix = "connections"
+	connsSep    = ","
+)
 
 var _ things.ChannelCache = (*channelCache)(nil)
 
@@ -40,7 +45,10 @@ func (cc channelCache) HasThing(_ context.Context, chanID, thingID string) bool
 
 func (cc channelCache) Disconnect(_ context.Context, chanID, thingID string) error {
 	cid, tid := kv(chanID, thingID)
-	if err := cc.client.SRem(cid, tid).Err(); err != nil {
+	pipe := cc.client.TxPipeline()
+	pipe.SRem(cid, tid)
+	pipe.Del(connsKey(thingID))
+	if _, err := pipe.Exec(); err != nil {
 		return errors.Wrap(things.ErrDisconnect, err)
 	}
 	return nil
@@ -48,12 +56,90 @@ func (cc channelCache) Disconnect(_ context.Context, chanID, thingID string) err
 
 func (cc channelCache) Remove(_ context.Context, chanID string) error {
 	cid, _ := kv(chanID, "0")
-	if err := cc.client.Del(cid).Err(); err != nil {
+	// SaveConnections caches the connections of the things as well, so the
+	// members of the channel include all the things whose cached
+	// connections list it.
+	tids, err := cc.client.SMembers(cid).Result()
+	if err != nil {
+		return errors.Wrap(things.ErrRemoveEntity, err)
+	}
+	keys := []string{cid}
+	for _, tid := range tids {
+		keys = append(keys, connsKey(tid))
+	}
+	if err := cc.client.Del(keys...).Err(); err != nil {
+		return errors.Wrap(things.ErrRemoveEntity, err)
+	}
+	return nil
+}
+
+func (cc channelCache) RetrieveAll(_ context.Context) ([]things.Connection, error) {
+	var conns []things.Connection
+	prefix := fmt.Sprintf("%s:", chanPrefix)
+	var cursor uint64
+	for {
+		keys, next, err := cc.client.Scan(cursor, fmt.Sprintf("%s*", prefix), 0).Result()
+		if err != nil {
+			return nil, errors.Wrap(things.ErrSelectEntity, err)
+		}
+		for _, k := range keys {
+			tids, err := cc.client.SMembers(k).Result()
+			if err != nil {
+				return nil, errors.Wrap(things.ErrSelectEntity, err)
+			}
+			for _, tid := range tids {
+				conns = append(conns, things.Connection{
+					ChannelID: strings.TrimPrefix(k, prefix),
+					ThingID:   tid,
+				})
+			}
+		}
+		if next == 0 {
+			return conns, nil
+		}
+		cursor = next
+	}
+}
+
+func (cc channelCache) Connections(_ context.Context, thingID string) ([]string, error) {
+	val, err := cc.client.Get(connsKey(thingID)).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, things.ErrNotFound
+		}
+		return nil, errors.Wrap(things.ErrSelectEntity, err)
+	}
+	if val == "" {
+		return []string{}, nil
+	}
+	return strings.Split(val, connsSep), nil
+}
+
+func (cc channelCache) SaveConnections(_ context.Context, thingID string, chanIDs []string) error {
+	pipe := cc.client.TxPipeline()
+	for _, chanID := range chanIDs {
+		cid, tid := kv(chanID, thingID)
+		pipe.SAdd(cid, tid)
+	}
+	pipe.Set(connsKey(thingID), strings.Join(chanIDs, connsSep), 0)
+	if _, err := pipe.Exec(); err != nil {
+		return errors.Wrap(things.ErrConnect, err)
+	}
+	return nil
+}
+
+func (cc channelCache) RemoveConnections(_ context.Context, thingID string) error {
+	if err := cc.client.Del(connsKey(thingID)).Err(); err != nil {
 		return errors.Wrap(things.ErrRemoveEntity, err)
 	}
 	return nil
 }
 
+// connsKey returns the key of the cached connections of the thing.
+func connsKey(thingID string) string {
+	return fmt.Sprintf("%s:%s", connsPrefix, thingID)
+}
+
 // Generates key-value pair
 func kv(chanID, thingID string) (string, string) {
 	cid := fmt.Sprintf("%s:%s", chanPrefix, chanID)
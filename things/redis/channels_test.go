@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"testing"
 
+	"github.com/mainflux/mainflux/things"
 	"github.com/mainflux/mainflux/things/redis"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -155,3 +156,92 @@ func TestRemove(t *testing.T) {
 		assert.Equal(t, tc.hasAccess, hasAcces, "%s - check access after removing channel: expected %t got %t\n", tc.desc, tc.hasAccess, hasAcces)
 	}
 }
+
+func TestRetrieveAllConnections(t *testing.T) {
+	channelCache := redis.NewChannelCache(redisClient)
+
+	conns := []things.Connection{
+		{ChannelID: "retrieve-all-1", ThingID: "1"},
+		{ChannelID: "retrieve-all-1", ThingID: "2"},
+		{ChannelID: "retrieve-all-2", ThingID: "1"},
+	}
+	for _, c := range conns {
+		err := channelCache.Connect(context.Background(), c.ChannelID, c.ThingID)
+		require.Nil(t, err, fmt.Sprintf("connect thing to channel: fail to connect due to: %s\n", err))
+	}
+
+	cached, err := channelCache.RetrieveAll(context.Background())
+	require.Nil(t, err, fmt.Sprintf("retrieve all connections: unexpected error: %s\n", err))
+	for _, c := range conns {
+		assert.Contains(t, cached, c, fmt.Sprintf("expected %v to be cached\n", c))
+	}
+}
+
+func TestConnections(t *testing.T) {
+	channelCache := redis.NewChannelCache(redisClient)
+
+	tid := "331"
+	cids := []string{"131", "132"}
+
+	cases := []struct {
+		desc    string
+		prepare func() error
+		cids    []string
+		err     error
+	}{
+		{
+			desc:    "retrieve non-cached connections",
+			prepare: func() error { return nil },
+			cids:    nil,
+			err:     things.ErrNotFound,
+		},
+		{
+			desc:    "retrieve cached connections",
+			prepare: func() error { return channelCache.SaveConnections(context.Background(), tid, cids) },
+			cids:    cids,
+			err:     nil,
+		},
+		{
+			desc:    "retrieve cached connections after disconnecting",
+			prepare: func() error { return channelCache.Disconnect(context.Background(), cids[0], tid) },
+			cids:    nil,
+			err:     things.ErrNotFound,
+		},
+		{
+			desc: "retrieve cached connections after removing one of the channels",
+			prepare: func() error {
+				if err := channelCache.SaveConnections(context.Background(), tid, cids); err != nil {
+					return err
+				}
+				return channelCache.Remove(context.Background(), cids[1])
+			},
+			cids: nil,
+			err:  things.ErrNotFound,
+		},
+		{
+			desc: "retrieve cached connections after removing them",
+			prepare: func() error {
+				if err := channelCache.SaveConnections(context.Background(), tid, cids); err != nil {
+					return err
+				}
+				return channelCache.RemoveConnections(context.Background(), tid)
+			},
+			cids: nil,
+			err:  things.ErrNotFound,
+		},
+		{
+			desc:    "retrieve cached empty connections",
+			prepare: func() error { return channelCache.SaveConnections(context.Background(), tid, []string{}) },
+			cids:    []string{},
+			err:     nil,
+		},
+	}
+
+	for _, tc := range cases {
+		err := tc.prepare()
+		require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s\n", tc.desc, err))
+		cids, err := channelCache.Connections(context.Background(), tid)
+		assert.Equal(t, tc.err, err, fmt.Sprintf("%s: expected %s got %s\n", tc.desc, tc.err, err))
+		assert.Equal(t, tc.cids, cids, fmt.Sprintf("%s: expected %v got %v\n", tc.desc, tc.cids, cids))
+	}
+}
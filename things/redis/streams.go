@@ -39,23 +39,42 @@ func (es eventStore) CreateThings(ctx context.Context, token string, ths ...thin
 	}
 
 	for _, thing := range sths {
-		event := createThingEvent{
-			id:       thing.ID,
-			owner:    thing.Owner,
-			name:     thing.Name,
-			metadata: thing.Metadata,
-		}
-		record := &redis.XAddArgs{
-			Stream:       streamID,
-			MaxLenApprox: streamLen,
-			Values:       event.Encode(),
-		}
-		es.client.XAdd(record).Err()
+		es.createThing(thing)
 	}
 
 	return sths, nil
 }
 
+func (es eventStore) SaveBestEffort(ctx context.Context, token string, ths ...things.Thing) ([]things.Result, error) {
+	res, err := es.svc.SaveBestEffort(ctx, token, ths...)
+	if err != nil {
+		return res, err
+	}
+
+	for _, r := range res {
+		if r.Err == nil {
+			es.createThing(r.Thing)
+		}
+	}
+
+	return res, nil
+}
+
+func (es eventStore) createThing(thing things.Thing) {
+	event := createThingEvent{
+		id:       thing.ID,
+		owner:    thing.Owner,
+		name:     thing.Name,
+		metadata: thing.Metadata,
+	}
+	record := &redis.XAddArgs{
+		Stream:       streamID,
+		MaxLenApprox: streamLen,
+		Values:       event.Encode(),
+	}
+	es.client.XAdd(record).Err()
+}
+
 func (es eventStore) UpdateThing(ctx context.Context, token string, thing things.Thing) error {
 	if err := es.svc.UpdateThing(ctx, token, thing); err != nil {
 		return err
@@ -91,8 +110,8 @@ func (es eventStore) ListThings(ctx context.Context, token string, pm things.Pag
 	return es.svc.ListThings(ctx, token, pm)
 }
 
-func (es eventStore) ListThingsByChannel(ctx context.Context, token, id string, offset, limit uint64, connected bool) (things.Page, error) {
-	return es.svc.ListThingsByChannel(ctx, token, id, offset, limit, connected)
+func (es eventStore) ListThingsByChannel(ctx context.Context, token, id string, connected bool, pm things.PageMetadata) (things.Page, error) {
+	return es.svc.ListThingsByChannel(ctx, token, id, connected, pm)
 }
 
 func (es eventStore) RemoveThing(ctx context.Context, token, id string) error {
@@ -169,6 +188,14 @@ func (es eventStore) ListChannelsByThing(ctx context.Context, token, id string,
 	return es.svc.ListChannelsByThing(ctx, token, id, offset, limit, connected)
 }
 
+func (es eventStore) ListConnectionEventsByThing(ctx context.Context, token, id string, offset, limit uint64) (things.ConnectionEventsPage, error) {
+	return es.svc.ListConnectionEventsByThing(ctx, token, id, offset, limit)
+}
+
+func (es eventStore) ListConnectionEventsByChannel(ctx context.Context, token, id string, offset, limit uint64) (things.ConnectionEventsPage, error) {
+	return es.svc.ListConnectionEventsByChannel(ctx, token, id, offset, limit)
+}
+
 func (es eventStore) RemoveChannel(ctx context.Context, token, id string) error {
 	if err := es.svc.RemoveChannel(ctx, token, id); err != nil {
 		return err
@@ -241,6 +268,26 @@ func (es eventStore) Identify(ctx context.Context, key string) (string, error) {
 	return es.svc.Identify(ctx, key)
 }
 
+func (es eventStore) ConnectionsByKey(ctx context.Context, key string) ([]string, error) {
+	return es.svc.ConnectionsByKey(ctx, key)
+}
+
+func (es eventStore) RebuildConnectionCache(ctx context.Context, token string) (things.CacheReport, error) {
+	return es.svc.RebuildConnectionCache(ctx, token)
+}
+
+func (es eventStore) CountAll(ctx context.Context, token string) (uint64, uint64, uint64, error) {
+	return es.svc.CountAll(ctx, token)
+}
+
+func (es eventStore) ReconcileGroups(ctx context.Context, token, defaultGroupID string) (things.GroupReport, error) {
+	return es.svc.ReconcileGroups(ctx, token, defaultGroupID)
+}
+
+func (es eventStore) RetrieveGroupContents(ctx context.Context, token, groupID string, pm things.PageMetadata) (things.GroupContents, error) {
+	return es.svc.RetrieveGroupContents(ctx, token, groupID, pm)
+}
+
 func (es eventStore) CreateGroup(ctx context.Context, token string, g groups.Group) (string, error) {
 	return es.svc.CreateGroup(ctx, token, g)
 }
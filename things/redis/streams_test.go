@@ -214,8 +214,8 @@ func TestListThingsByChannel(t *testing.T) {
 	require.Nil(t, err, fmt.Sprintf("unexpected error %s", err))
 
 	essvc := redis.NewEventStoreMiddleware(svc, redisClient)
-	esths, eserr := essvc.ListThingsByChannel(context.Background(), token, sch.ID, 0, 10, true)
-	thps, err := svc.ListThingsByChannel(context.Background(), token, sch.ID, 0, 10, true)
+	esths, eserr := essvc.ListThingsByChannel(context.Background(), token, sch.ID, true, things.PageMetadata{Offset: 0, Limit: 10})
+	thps, err := svc.ListThingsByChannel(context.Background(), token, sch.ID, true, things.PageMetadata{Offset: 0, Limit: 10})
 	assert.Equal(t, thps, esths, fmt.Sprintf("event sourcing changed service behaviour: expected %v got %v", thps, esths))
 	assert.Equal(t, err, eserr, fmt.Sprintf("event sourcing changed service behaviour: expected %v got %v", err, eserr))
 }
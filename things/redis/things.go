@@ -53,6 +53,32 @@ func (tc *thingCache) ID(_ context.Context, thingKey string) (string, error) {
 	return thingID, nil
 }
 
+func (tc *thingCache) IDs(_ context.Context, thingKeys []string) (map[string]string, error) {
+	ids := make(map[string]string)
+	if len(thingKeys) == 0 {
+		return ids, nil
+	}
+
+	tkeys := make([]string, len(thingKeys))
+	for i, key := range thingKeys {
+		tkeys[i] = fmt.Sprintf("%s:%s", keyPrefix, key)
+	}
+
+	vals, err := tc.client.MGet(tkeys...).Result()
+	if err != nil {
+		return nil, errors.Wrap(things.ErrNotFound, err)
+	}
+
+	for i, val := range vals {
+		// Redis returns nil for the keys that don't exist.
+		if id, ok := val.(string); ok {
+			ids[thingKeys[i]] = id
+		}
+	}
+
+	return ids, nil
+}
+
 func (tc *thingCache) Remove(_ context.Context, thingID string) error {
 	tid := fmt.Sprintf("%s:%s", idPrefix, thingID)
 	key, err := tc.client.Get(tid).Result()
@@ -70,3 +96,35 @@ func (tc *thingCache) Remove(_ context.Context, thingID string) error {
 	}
 	return nil
 }
+
+func (tc *thingCache) RemoveKey(_ context.Context, thingKey string) error {
+	tkey := fmt.Sprintf("%s:%s", keyPrefix, thingKey)
+	thingID, err := tc.client.Get(tkey).Result()
+	// Redis returns Nil Reply when key does not exist.
+	if err == redis.Nil {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(things.ErrRemoveEntity, err)
+	}
+	if err := tc.client.Del(tkey).Err(); err != nil {
+		return errors.Wrap(things.ErrRemoveEntity, err)
+	}
+
+	// The thing is mapped to the last key saved, which may be another one.
+	tid := fmt.Sprintf("%s:%s", idPrefix, thingID)
+	key, err := tc.client.Get(tid).Result()
+	if err == redis.Nil {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(things.ErrRemoveEntity, err)
+	}
+	if key != thingKey {
+		return nil
+	}
+	if err := tc.client.Del(tid).Err(); err != nil {
+		return errors.Wrap(things.ErrRemoveEntity, err)
+	}
+	return nil
+}
@@ -86,6 +86,40 @@ func TestThingID(t *testing.T) {
 	}
 }
 
+func TestThingIDs(t *testing.T) {
+	thingCache := redis.NewThingCache(redisClient)
+
+	key, err := uuid.New().ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	id := "123"
+	err = thingCache.Save(context.Background(), key, id)
+	require.Nil(t, err, fmt.Sprintf("Save thing to cache: expected nil got %s", err))
+
+	cases := map[string]struct {
+		keys []string
+		ids  map[string]string
+	}{
+		"Get IDs by existing and non-existing thing-keys": {
+			keys: []string{key, wrongValue},
+			ids:  map[string]string{key: id},
+		},
+		"Get IDs by non-existing thing-keys": {
+			keys: []string{wrongValue},
+			ids:  map[string]string{},
+		},
+		"Get IDs without thing-keys": {
+			keys: []string{},
+			ids:  map[string]string{},
+		},
+	}
+
+	for desc, tc := range cases {
+		ids, err := thingCache.IDs(context.Background(), tc.keys)
+		assert.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s\n", desc, err))
+		assert.Equal(t, tc.ids, ids, fmt.Sprintf("%s: expected %v got %v\n", desc, tc.ids, ids))
+	}
+}
+
 func TestThingRemove(t *testing.T) {
 	thingCache := redis.NewThingCache(redisClient)
 
@@ -118,3 +152,54 @@ func TestThingRemove(t *testing.T) {
 	}
 
 }
+
+func TestThingRemoveKey(t *testing.T) {
+	thingCache := redis.NewThingCache(redisClient)
+
+	oldKey, err := uuid.New().ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	newKey, err := uuid.New().ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	id := "456"
+	err = thingCache.Save(context.Background(), oldKey, id)
+	require.Nil(t, err, fmt.Sprintf("Save thing to cache: expected nil got %s", err))
+	err = thingCache.Save(context.Background(), newKey, id)
+	require.Nil(t, err, fmt.Sprintf("Save thing to cache: expected nil got %s", err))
+
+	err = thingCache.RemoveKey(context.Background(), oldKey)
+	assert.Nil(t, err, fmt.Sprintf("Remove key from cache: expected nil got %s", err))
+	err = thingCache.RemoveKey(context.Background(), oldKey)
+	assert.Nil(t, err, fmt.Sprintf("Remove non-existing key from cache: expected nil got %s", err))
+
+	cases := []struct {
+		desc string
+		key  string
+		id   string
+		err  error
+	}{
+		{
+			desc: "Retrieve thing ID by removed key",
+			key:  oldKey,
+			id:   "",
+			err:  r.Nil,
+		},
+		{
+			desc: "Retrieve thing ID by other key",
+			key:  newKey,
+			id:   id,
+			err:  nil,
+		},
+	}
+
+	for _, tc := range cases {
+		cacheID, err := thingCache.ID(context.Background(), tc.key)
+		assert.Equal(t, tc.id, cacheID, fmt.Sprintf("%s: expected %s got %s\n", tc.desc, tc.id, cacheID))
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s\n", tc.desc, tc.err, err))
+	}
+
+	// The other key is still removed together with the thing.
+	err = thingCache.Remove(context.Background(), id)
+	assert.Nil(t, err, fmt.Sprintf("Remove thing from cache: expected nil got %s", err))
+	_, err = thingCache.ID(context.Background(), newKey)
+	assert.True(t, errors.Contains(err, r.Nil), fmt.Sprintf("Retrieve removed thing: expected %s got %s\n", r.Nil, err))
+}
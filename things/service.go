@@ -5,21 +5,40 @@ package things
 
 import (
 	"context"
+	"fmt"
+	"sort"
+	"time"
 
+	"github.com/go-kit/kit/metrics"
 	"github.com/mainflux/mainflux/internal/groups"
+	"github.com/mainflux/mainflux/logger"
 	"github.com/mainflux/mainflux/pkg/errors"
 
 	"github.com/mainflux/mainflux"
 	"github.com/mainflux/mainflux/pkg/ulid"
 )
 
-const things = "things"
+const (
+	things = "things"
+
+	// reconcileLimit is the page size used to traverse things and
+	// memberships during group reconciliation.
+	reconcileLimit = 100
+
+	// ChannelThingsLimitKey is the group metadata key of the maximum number
+	// of things connected to the channels the group's things connect to.
+	ChannelThingsLimitKey = "channel_things_limit"
+)
 
 var (
 	// ErrUnauthorizedAccess indicates missing or invalid credentials provided
 	// when accessing a protected resource.
 	ErrUnauthorizedAccess = errors.New("missing or invalid credentials provided")
 
+	// ErrAuthorization indicates that the caller doesn't own any of the
+	// groups the accessed entity belongs to, or isn't the admin.
+	ErrAuthorization = errors.New("missing permission for the entity groups")
+
 	// ErrCreateUUID indicates error in creating uuid for entity creation
 	ErrCreateUUID = errors.New("uuid creation failed")
 
@@ -41,6 +60,14 @@ var (
 	// ErrDisconnect indicates error in removing connection
 	ErrDisconnect = errors.New("remove connection failed")
 
+	// ErrChannelFull indicates that connecting the things would exceed the
+	// maximum number of things connected to a channel.
+	ErrChannelFull = errors.New("channel connected things limit exceeded")
+
+	// ErrGroupMismatch indicates that the thing and the channel share no
+	// group, and their groups are not allowed to be connected.
+	ErrGroupMismatch = errors.New("thing and channel share no group")
+
 	// ErrCreateGroup indicates error in creating group.
 	ErrCreateGroup = errors.New("failed to create group")
 
@@ -49,6 +76,10 @@ var (
 
 	// ErrFailedToRetrieveThings failed to retrieve things.
 	ErrFailedToRetrieveThings = errors.New("failed to retrieve group members")
+
+	// ErrRecordEvent indicates that the connection succeeded, but it could
+	// not be recorded in the connection history.
+	ErrRecordEvent = errors.New("failed to record connection event")
 )
 
 // Service specifies an API that must be fullfiled by the domain service
@@ -57,12 +88,20 @@ type Service interface {
 	// CreateThings adds a list of things to the user identified by the provided key.
 	CreateThings(ctx context.Context, token string, things ...Thing) ([]Thing, error)
 
+	// SaveBestEffort adds each of the things to the user identified by the
+	// provided key independently, so that a failed thing doesn't prevent
+	// the others from being saved. The returned results are in the order
+	// of the provided things.
+	SaveBestEffort(ctx context.Context, token string, things ...Thing) ([]Result, error)
+
 	// UpdateThing updates the thing identified by the provided ID, that
 	// belongs to the user identified by the provided key.
 	UpdateThing(ctx context.Context, token string, thing Thing) error
 
-	// UpdateKey updates key value of the existing thing. A non-nil error is
-	// returned to indicate operation failure.
+	// UpdateKey updates key value of the existing thing. The old key is
+	// removed from the cache and the new one is cached, so that the old key
+	// stops identifying the thing at once. A non-nil error is returned to
+	// indicate operation failure.
 	UpdateKey(ctx context.Context, token, id, key string) error
 
 	// ViewThing retrieves data about the thing identified with the provided
@@ -76,7 +115,7 @@ type Service interface {
 	// ListThingsByChannel retrieves data about subset of things that are
 	// connected or not connected to specified channel and belong to the user identified by
 	// the provided key.
-	ListThingsByChannel(ctx context.Context, token, channel string, offset, limit uint64, connected bool) (Page, error)
+	ListThingsByChannel(ctx context.Context, token, channel string, connected bool, pm PageMetadata) (Page, error)
 
 	// RemoveThing removes the thing identified with the provided ID, that
 	// belongs to the user identified by the provided key.
@@ -102,6 +141,16 @@ type Service interface {
 	// the provided key.
 	ListChannelsByThing(ctx context.Context, token, thing string, offset, limit uint64, connected bool) (ChannelsPage, error)
 
+	// ListConnectionEventsByThing retrieves the subset of the connection
+	// history of the thing identified by the provided ID, that belongs to
+	// the user identified by the provided key, in chronological order.
+	ListConnectionEventsByThing(ctx context.Context, token, thing string, offset, limit uint64) (ConnectionEventsPage, error)
+
+	// ListConnectionEventsByChannel retrieves the subset of the connection
+	// history of the channel identified by the provided ID, that belongs
+	// to the user identified by the provided key, in chronological order.
+	ListConnectionEventsByChannel(ctx context.Context, token, channel string, offset, limit uint64) (ConnectionEventsPage, error)
+
 	// RemoveChannel removes the thing identified by the provided ID, that
 	// belongs to the user identified by the provided key.
 	RemoveChannel(ctx context.Context, token, id string) error
@@ -124,23 +173,178 @@ type Service interface {
 	// Identify returns thing ID for given thing key.
 	Identify(ctx context.Context, key string) (string, error)
 
+	// ConnectionsByKey returns the identifiers of the channels the thing
+	// with the provided key is connected to.
+	ConnectionsByKey(ctx context.Context, key string) ([]string, error)
+
+	// RebuildConnectionCache brings the connection cache in line with the
+	// connections stored in the repository and reports the corrections.
+	// Only the admin can rebuild the cache.
+	RebuildConnectionCache(ctx context.Context, token string) (CacheReport, error)
+
+	// CountAll returns the number of things, channels and connections of
+	// all the users of the platform. Only the admin can count them.
+	CountAll(ctx context.Context, token string) (things uint64, channels uint64, connections uint64, err error)
+
+	// ReconcileGroups finds the user's things that are members of groups
+	// which no longer exist. If the default group ID is not empty, orphaned
+	// things are moved to the default group.
+	ReconcileGroups(ctx context.Context, token, defaultGroupID string) (GroupReport, error)
+
+	// RetrieveGroupContents retrieves the things that are members of the
+	// group identified by the provided ID, along with the channels of the
+	// user identified by the provided key that those things are connected
+	// to. Both collections are paginated using the same page metadata.
+	// Only the owner of the group can retrieve its contents.
+	RetrieveGroupContents(ctx context.Context, token, groupID string, pm PageMetadata) (GroupContents, error)
+
 	groups.Service
 }
 
+// Result represents the outcome of saving a single thing. If Err is nil,
+// Thing is the saved thing.
+type Result struct {
+	Thing Thing
+	Err   error
+}
+
+// CacheReport contains the number of cache entries that were added and
+// removed in order to match the repository.
+type CacheReport struct {
+	Added   uint64
+	Removed uint64
+}
+
+// OrphanedMembership represents the membership of a thing in a group
+// that no longer exists.
+type OrphanedMembership struct {
+	ThingID string
+	GroupID string
+}
+
+// GroupReport contains the orphaned memberships found during group
+// reconciliation and the number of them moved to the default group.
+type GroupReport struct {
+	Orphaned   []OrphanedMembership
+	Reassigned uint64
+}
+
+// GroupContents contains a page of the things of a group and a page of the
+// channels they are connected to.
+type GroupContents struct {
+	Things   Page
+	Channels ChannelsPage
+}
+
 // PageMetadata contains page metadata that helps navigation.
 type PageMetadata struct {
-	Total    uint64
-	Offset   uint64
-	Limit    uint64
-	Name     string
-	Order    string
+	Total  uint64
+	Offset uint64
+	Limit  uint64
+	Name   string
+	// Order is the field the entities are ordered by, name or id.
+	Order string
+	// Dir is the direction of the order, asc or desc.
 	Dir      string
 	Metadata map[string]interface{}
+	// HasMetadataKeys restricts the results to the entities whose
+	// metadata contains all of the given keys.
+	HasMetadataKeys []string
+	// MissingMetadataKeys restricts the results to the entities whose
+	// metadata contains none of the given keys.
+	MissingMetadataKeys []string
+	// ConnectedOnly restricts the results to the things connected
+	// to at least one channel.
+	ConnectedOnly bool
+	// AnyOf restricts the results to the entities matching at least one
+	// of the given filters. It is combined with the other filters using
+	// AND, and the total counts every matching entity once.
+	AnyOf []Filter
+	// WithConnections populates the connection status and the number of
+	// connected channels of the listed things.
+	WithConnections bool
+	// WithGroups populates the groups of the listed things, out of the
+	// listed groups, with their names and owners. It is supported by the
+	// retrieval of group things only.
+	WithGroups bool
+	// Sample returns a pseudo-random subset of up to Limit matching
+	// entities instead of the page at Offset.
+	Sample bool
+	// Seed makes the sample reproducible, so that the same seed returns
+	// the same sample as long as the matching entities don't change. If
+	// zero, each sample is different.
+	Seed int64
+	// Cursor resumes the listing ordered by name after the entity encoded
+	// by the cursor, instead of skipping Offset entities. It is supported
+	// by the retrieval of group things only.
+	Cursor string
+	// NextCursor encodes the last entity of a full page listed by name,
+	// and is passed as the Cursor of the next page.
+	NextCursor string
+	// Status restricts the group things to the ones having the status,
+	// EnabledStatus if empty. AllStatus lists things of any status.
+	Status string
+}
+
+// Filter combines the name and metadata predicates using AND. Empty
+// predicates are ignored.
+type Filter struct {
+	// Name matches the entities whose name contains the given value,
+	// ignoring case.
+	Name string
+	// Metadata matches the entities whose metadata contains the given one.
+	Metadata map[string]interface{}
 }
 
 var _ Service = (*thingsService)(nil)
 
+// Config contains the things service limits and caching options.
+type Config struct {
+	// ChannelThingsLimit is the maximum number of things connected to a
+	// channel. If zero, the number of things is limited only by the
+	// limits of the groups of the connected things.
+	ChannelThingsLimit uint64
+
+	// ViewCacheTTL is how long the things retrieved by ID are cached for.
+	// If zero, the things are not cached.
+	ViewCacheTTL time.Duration
+
+	// ViewCacheSize is the maximum number of cached things. If not
+	// positive, DefaultViewCacheSize is used.
+	ViewCacheSize int
+
+	// ConnectionEvents records every connect and disconnect. If nil, the
+	// connection history is not recorded.
+	ConnectionEvents ConnectionEventRepository
+
+	// StrictGroups makes Connect reject connecting a thing to a channel
+	// which shares none of its groups with ErrGroupMismatch, unless
+	// CrossGroups allows it. The things and channels belonging to no group
+	// can be connected to each other.
+	StrictGroups bool
+
+	// CrossGroups maps the groups of the things to the groups of the
+	// channels they can be connected to under StrictGroups.
+	CrossGroups map[string][]string
+
+	// MetadataLimits limits the metadata of the created and updated things
+	// and channels.
+	MetadataLimits MetadataLimits
+
+	// MetadataCounter, if set, counts the metadata exceeding the soft
+	// limits by entity (thing or channel) and limit (keys or bytes).
+	MetadataCounter metrics.Counter
+
+	// Logger, if set, logs the metadata exceeding the soft limits.
+	Logger logger.Logger
+
+	// AdminEmail is the email of the platform admin, the only user allowed
+	// to access the entities of all the users. If empty, no user is.
+	AdminEmail string
+}
+
 type thingsService struct {
+	cfg          Config
 	auth         mainflux.AuthServiceClient
 	things       ThingRepository
 	channels     ChannelRepository
@@ -153,7 +357,17 @@ type thingsService struct {
 
 // New instantiates the things service implementation.
 func New(auth mainflux.AuthServiceClient, things ThingRepository, channels ChannelRepository, groups groups.Repository, ccache ChannelCache, tcache ThingCache, up mainflux.IDProvider) Service {
+	return NewWithConfig(auth, things, channels, groups, ccache, tcache, up, Config{})
+}
+
+// NewWithConfig instantiates the things service implementation with the
+// provided limits and caching.
+func NewWithConfig(auth mainflux.AuthServiceClient, things ThingRepository, channels ChannelRepository, groups groups.Repository, ccache ChannelCache, tcache ThingCache, up mainflux.IDProvider, cfg Config) Service {
+	if cfg.ViewCacheTTL > 0 {
+		things = newViewCache(things, cfg.ViewCacheTTL, cfg.ViewCacheSize)
+	}
 	return &thingsService{
+		cfg:          cfg,
 		auth:         auth,
 		things:       things,
 		groups:       groups,
@@ -185,11 +399,61 @@ func (ts *thingsService) CreateThings(ctx context.Context, token string, things
 				return []Thing{}, errors.Wrap(ErrCreateUUID, err)
 			}
 		}
+
+		if err := ts.checkMetadata("thing", things[i].ID, things[i].Metadata); err != nil {
+			return []Thing{}, err
+		}
 	}
 
 	return ts.things.Save(ctx, things...)
 }
 
+func (ts *thingsService) SaveBestEffort(ctx context.Context, token string, things ...Thing) ([]Result, error) {
+	res, err := ts.auth.Identify(ctx, &mainflux.Token{Value: token})
+	if err != nil {
+		return []Result{}, errors.Wrap(ErrUnauthorizedAccess, err)
+	}
+
+	results := make([]Result, len(things))
+	for i, th := range things {
+		th, err := ts.saveThing(ctx, res.GetEmail(), th)
+		results[i] = Result{Thing: th, Err: err}
+	}
+
+	return results, nil
+}
+
+func (ts *thingsService) saveThing(ctx context.Context, owner string, th Thing) (Thing, error) {
+	var err error
+	th.ID, err = ts.uuidProvider.ID()
+	if err != nil {
+		return Thing{}, errors.Wrap(ErrCreateUUID, err)
+	}
+
+	th.Owner = owner
+
+	if th.Key == "" {
+		th.Key, err = ts.uuidProvider.ID()
+		if err != nil {
+			return Thing{}, errors.Wrap(ErrCreateUUID, err)
+		}
+	}
+
+	if err := ts.checkMetadata("thing", th.ID, th.Metadata); err != nil {
+		return Thing{}, err
+	}
+
+	ths, err := ts.things.Save(ctx, th)
+	if err != nil {
+		return Thing{}, err
+	}
+	if len(ths) == 0 {
+		return Thing{}, ErrCreateEntity
+	}
+
+	return ths[0], nil
+}
+
 func (ts *thingsService) UpdateThing(ctx context.Context, token string, thing Thing) error {
 	res, err := ts.auth.Identify(ctx, &mainflux.Token{Value: token})
 	if err != nil {
@@ -198,6 +462,10 @@ func (ts *thingsService) UpdateThing(ctx context.Context, token string, thing Th
 
 	thing.Owner = res.GetEmail()
 
+	if err := ts.checkMetadata("thing", thing.ID, thing.Metadata); err != nil {
+		return err
+	}
+
 	return ts.things.Update(ctx, thing)
 }
 
@@ -209,7 +477,20 @@ func (ts *thingsService) UpdateKey(ctx context.Context, token, id, key string) e
 
 	owner := res.GetEmail()
 
-	return ts.things.UpdateKey(ctx, owner, id, key)
+	th, err := ts.things.RetrieveByID(ctx, owner, id)
+	if err != nil {
+		return err
+	}
+	if err := ts.things.UpdateKey(ctx, owner, id, key); err != nil {
+		return err
+	}
+
+	// The old key is removed only once it's rotated, so that it can't be
+	// cached again afterwards and keep identifying the thing.
+	if err := ts.thingCache.RemoveKey(ctx, th.Key); err != nil {
+		return err
+	}
+	return ts.thingCache.Save(ctx, key, id)
 }
 
 func (ts *thingsService) ViewThing(ctx context.Context, token, id string) (Thing, error) {
@@ -230,13 +511,13 @@ func (ts *thingsService) ListThings(ctx context.Context, token string, pm PageMe
 	return ts.things.RetrieveAll(ctx, res.GetEmail(), pm)
 }
 
-func (ts *thingsService) ListThingsByChannel(ctx context.Context, token, channel string, offset, limit uint64, connected bool) (Page, error) {
+func (ts *thingsService) ListThingsByChannel(ctx context.Context, token, channel string, connected bool, pm PageMetadata) (Page, error) {
 	res, err := ts.auth.Identify(ctx, &mainflux.Token{Value: token})
 	if err != nil {
 		return Page{}, errors.Wrap(ErrUnauthorizedAccess, err)
 	}
 
-	return ts.things.RetrieveByChannel(ctx, res.GetEmail(), channel, offset, limit, connected)
+	return ts.things.RetrieveByChannel(ctx, res.GetEmail(), channel, connected, pm)
 }
 
 func (ts *thingsService) RemoveThing(ctx context.Context, token, id string) error {
@@ -264,6 +545,10 @@ func (ts *thingsService) CreateChannels(ctx context.Context, token string, chann
 		}
 
 		channels[i].Owner = res.GetEmail()
+
+		if err := ts.checkMetadata("channel", channels[i].ID, channels[i].Metadata); err != nil {
+			return []Channel{}, err
+		}
 	}
 
 	return ts.channels.Save(ctx, channels...)
@@ -276,6 +561,10 @@ func (ts *thingsService) UpdateChannel(ctx context.Context, token string, channe
 	}
 
 	channel.Owner = res.GetEmail()
+
+	if err := ts.checkMetadata("channel", channel.ID, channel.Metadata); err != nil {
+		return err
+	}
 	return ts.channels.Update(ctx, channel)
 }
 
@@ -325,7 +614,151 @@ func (ts *thingsService) Connect(ctx context.Context, token string, chIDs, thIDs
 		return errors.Wrap(ErrUnauthorizedAccess, err)
 	}
 
-	return ts.channels.Connect(ctx, res.GetEmail(), chIDs, thIDs)
+	if err := ts.checkGroups(ctx, chIDs, thIDs); err != nil {
+		return err
+	}
+
+	limit, err := ts.channelThingsLimit(ctx, thIDs)
+	if err != nil {
+		return errors.Wrap(ErrConnect, err)
+	}
+
+	if err := ts.channels.Connect(ctx, res.GetEmail(), chIDs, thIDs, limit); err != nil {
+		return err
+	}
+
+	// The cached connections of the things no longer list all of their
+	// channels.
+	for _, thID := range thIDs {
+		if err := ts.channelCache.RemoveConnections(ctx, thID); err != nil {
+			return err
+		}
+	}
+
+	var events []ConnectionEvent
+	for _, chID := range chIDs {
+		for _, thID := range thIDs {
+			events = append(events, ConnectionEvent{ChannelID: chID, ThingID: thID, Type: ConnectEvent})
+		}
+	}
+	return ts.recordEvents(ctx, res.GetEmail(), events...)
+}
+
+// channelThingsLimit returns the maximum number of things connected to a
+// channel the things connect to, which is the lowest of the global limit
+// and the limits of the things' groups. Zero means no limit.
+func (ts *thingsService) channelThingsLimit(ctx context.Context, thIDs []string) (uint64, error) {
+	limit := ts.cfg.ChannelThingsLimit
+	if ts.groups == nil {
+		return limit, nil
+	}
+
+	for _, thID := range thIDs {
+		gs, err := ts.memberships(ctx, thID)
+		if err != nil {
+			return 0, err
+		}
+
+		for _, g := range gs {
+			if l, ok := groupLimit(g.Metadata); ok && (limit == 0 || l < limit) {
+				limit = l
+			}
+		}
+	}
+
+	return limit, nil
+}
+
+// checkGroups checks that every thing shares a group with every channel
+// it connects to, or belongs to a group CrossGroups allows to connect to
+// any of the channel groups, if StrictGroups is set.
+func (ts *thingsService) checkGroups(ctx context.Context, chIDs, thIDs []string) error {
+	if !ts.cfg.StrictGroups || ts.groups == nil {
+		return nil
+	}
+
+	chGroups := make(map[string]map[string]bool, len(chIDs))
+	for _, chID := range chIDs {
+		gs, err := ts.memberships(ctx, chID)
+		if err != nil {
+			return errors.Wrap(ErrConnect, err)
+		}
+		chGroups[chID] = groupIDs(gs)
+	}
+
+	for _, thID := range thIDs {
+		gs, err := ts.memberships(ctx, thID)
+		if err != nil {
+			return errors.Wrap(ErrConnect, err)
+		}
+		thGroups := groupIDs(gs)
+		for _, chID := range chIDs {
+			if !ts.groupsConnect(thGroups, chGroups[chID]) {
+				return errors.Wrap(ErrGroupMismatch, fmt.Errorf("thing %s and channel %s", thID, chID))
+			}
+		}
+	}
+
+	return nil
+}
+
+// groupsConnect reports whether the thing and channel groups allow the
+// connection.
+func (ts *thingsService) groupsConnect(thGroups, chGroups map[string]bool) bool {
+	if len(thGroups) == 0 && len(chGroups) == 0 {
+		return true
+	}
+	for g := range thGroups {
+		if chGroups[g] {
+			return true
+		}
+		for _, cg := range ts.cfg.CrossGroups[g] {
+			if chGroups[cg] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// memberships returns all the groups the member belongs to.
+func (ts *thingsService) memberships(ctx context.Context, memberID string) ([]groups.Group, error) {
+	var gs []groups.Group
+	for offset := uint64(0); ; offset += reconcileLimit {
+		gp, err := ts.groups.Memberships(ctx, memberID, offset, reconcileLimit, nil)
+		if err != nil {
+			return nil, err
+		}
+		gs = append(gs, gp.Groups...)
+
+		if offset+reconcileLimit >= gp.Total {
+			return gs, nil
+		}
+	}
+}
+
+func groupIDs(gs []groups.Group) map[string]bool {
+	ids := make(map[string]bool, len(gs))
+	for _, g := range gs {
+		ids[g.ID] = true
+	}
+	return ids
+}
+
+// groupLimit returns the positive channel things limit of the group
+// metadata. Metadata are decoded from JSON, so numbers are float64.
+func groupLimit(m groups.Metadata) (uint64, bool) {
+	switch l := m[ChannelThingsLimitKey].(type) {
+	case float64:
+		if l >= 1 {
+			return uint64(l), true
+		}
+	case int:
+		if l > 0 {
+			return uint64(l), true
+		}
+	}
+	return 0, false
 }
 
 func (ts *thingsService) Disconnect(ctx context.Context, token, chanID, thingID string) error {
@@ -338,7 +771,64 @@ func (ts *thingsService) Disconnect(ctx context.Context, token, chanID, thingID
 		return err
 	}
 
-	return ts.channels.Disconnect(ctx, res.GetEmail(), chanID, thingID)
+	if err := ts.channels.Disconnect(ctx, res.GetEmail(), chanID, thingID); err != nil {
+		return err
+	}
+
+	return ts.recordEvents(ctx, res.GetEmail(), ConnectionEvent{ChannelID: chanID, ThingID: thingID, Type: DisconnectEvent})
+}
+
+// recordEvents appends the events performed by the user to the connection
+// history, if it is enabled.
+func (ts *thingsService) recordEvents(ctx context.Context, user string, events ...ConnectionEvent) error {
+	if ts.cfg.ConnectionEvents == nil || len(events) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	for i := range events {
+		events[i].Owner = user
+		events[i].Actor = user
+		events[i].Timestamp = now
+	}
+	if err := ts.cfg.ConnectionEvents.Save(ctx, events...); err != nil {
+		return errors.Wrap(ErrRecordEvent, err)
+	}
+	return nil
+}
+
+func (ts *thingsService) ListConnectionEventsByThing(ctx context.Context, token, thing string, offset, limit uint64) (ConnectionEventsPage, error) {
+	res, err := ts.auth.Identify(ctx, &mainflux.Token{Value: token})
+	if err != nil {
+		return ConnectionEventsPage{}, errors.Wrap(ErrUnauthorizedAccess, err)
+	}
+
+	if ts.cfg.ConnectionEvents == nil {
+		return emptyEventsPage(offset, limit), nil
+	}
+	return ts.cfg.ConnectionEvents.RetrieveByThing(ctx, res.GetEmail(), thing, offset, limit)
+}
+
+func (ts *thingsService) ListConnectionEventsByChannel(ctx context.Context, token, channel string, offset, limit uint64) (ConnectionEventsPage, error) {
+	res, err := ts.auth.Identify(ctx, &mainflux.Token{Value: token})
+	if err != nil {
+		return ConnectionEventsPage{}, errors.Wrap(ErrUnauthorizedAccess, err)
+	}
+
+	if ts.cfg.ConnectionEvents == nil {
+		return emptyEventsPage(offset, limit), nil
+	}
+	return ts.cfg.ConnectionEvents.RetrieveByChannel(ctx, res.GetEmail(), channel, offset, limit)
+}
+
+func emptyEventsPage(offset, limit uint64) ConnectionEventsPage {
+	return ConnectionEventsPage{
+		PageMetadata: PageMetadata{
+			Offset: offset,
+			Limit:  limit,
+		},
+		Events: []ConnectionEvent{},
+	}
 }
 
 func (ts *thingsService) CanAccessByKey(ctx context.Context, chanID, thingKey string) (string, error) {
@@ -352,7 +842,7 @@ func (ts *thingsService) CanAccessByKey(ctx context.Context, chanID, thingKey st
 		return "", err
 	}
 
-	if err := ts.thingCache.Save(ctx, thingKey, thingID); err != nil {
+	if err := ts.cacheKey(ctx, thingKey, thingID); err != nil {
 		return "", err
 	}
 	if err := ts.channelCache.Connect(ctx, chanID, thingID); err != nil {
@@ -387,12 +877,328 @@ func (ts *thingsService) Identify(ctx context.Context, key string) (string, erro
 		return "", err
 	}
 
-	if err := ts.thingCache.Save(ctx, key, id); err != nil {
+	if err := ts.cacheKey(ctx, key, id); err != nil {
 		return "", err
 	}
 	return id, nil
 }
 
+// cacheKey caches the thing key unless it's a temporary one. The cached
+// keys don't expire, so a temporary key would keep identifying the thing
+// after its expiry.
+func (ts *thingsService) cacheKey(ctx context.Context, key, id string) error {
+	expiresAt, err := ts.things.RetrieveKeyExpiry(ctx, key)
+	if err != nil {
+		return err
+	}
+	if !expiresAt.IsZero() {
+		return nil
+	}
+	return ts.thingCache.Save(ctx, key, id)
+}
+
+func (ts *thingsService) ConnectionsByKey(ctx context.Context, key string) ([]string, error) {
+	thingID, err := ts.Identify(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if chIDs, err := ts.channelCache.Connections(ctx, thingID); err == nil {
+		return chIDs, nil
+	}
+
+	chIDs, err := ts.channels.RetrieveConnectionsByThing(ctx, thingID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ts.channelCache.SaveConnections(ctx, thingID, chIDs); err != nil {
+		return nil, err
+	}
+	return chIDs, nil
+}
+
+func (ts *thingsService) RebuildConnectionCache(ctx context.Context, token string) (CacheReport, error) {
+	if err := ts.identifyAdmin(ctx, token); err != nil {
+		return CacheReport{}, err
+	}
+
+	conns, err := ts.channels.RetrieveAllConnections(ctx)
+	if err != nil {
+		return CacheReport{}, err
+	}
+	cached, err := ts.channelCache.RetrieveAll(ctx)
+	if err != nil {
+		return CacheReport{}, err
+	}
+
+	// The cache doesn't hold the actions of the connections, so they are
+	// compared by the channel and the thing alone.
+	stored := make(map[Connection]bool)
+	for _, c := range conns {
+		stored[Connection{ChannelID: c.ChannelID, ThingID: c.ThingID}] = true
+	}
+
+	var rep CacheReport
+	present := make(map[Connection]bool)
+	for _, c := range cached {
+		if stored[c] {
+			present[c] = true
+			continue
+		}
+		if err := ts.channelCache.Disconnect(ctx, c.ChannelID, c.ThingID); err != nil {
+			return rep, err
+		}
+		rep.Removed++
+	}
+
+	for _, c := range conns {
+		if present[Connection{ChannelID: c.ChannelID, ThingID: c.ThingID}] {
+			continue
+		}
+		if err := ts.channelCache.Connect(ctx, c.ChannelID, c.ThingID); err != nil {
+			return rep, err
+		}
+		rep.Added++
+	}
+
+	return rep, nil
+}
+
+func (ts *thingsService) CountAll(ctx context.Context, token string) (uint64, uint64, uint64, error) {
+	if err := ts.identifyAdmin(ctx, token); err != nil {
+		return 0, 0, 0, err
+	}
+
+	ths, err := ts.things.CountAll(ctx)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	chs, conns, err := ts.channels.CountAll(ctx)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	return ths, chs, conns, nil
+}
+
+// identifyAdmin checks that the token identifies the platform admin.
+func (ts *thingsService) identifyAdmin(ctx context.Context, token string) error {
+	res, err := ts.auth.Identify(ctx, &mainflux.Token{Value: token})
+	if err != nil {
+		return errors.Wrap(ErrUnauthorizedAccess, err)
+	}
+	if ts.cfg.AdminEmail == "" || res.GetEmail() != ts.cfg.AdminEmail {
+		return ErrAuthorization
+	}
+	return nil
+}
+
+func (ts *thingsService) ReconcileGroups(ctx context.Context, token, defaultGroupID string) (GroupReport, error) {
+	res, err := ts.auth.Identify(ctx, &mainflux.Token{Value: token})
+	if err != nil {
+		return GroupReport{}, errors.Wrap(ErrUnauthorizedAccess, err)
+	}
+
+	if defaultGroupID != "" {
+		if _, err := ts.groups.RetrieveByID(ctx, defaultGroupID); err != nil {
+			return GroupReport{}, err
+		}
+	}
+
+	rep := GroupReport{}
+	pm := PageMetadata{Limit: reconcileLimit}
+	for {
+		page, err := ts.things.RetrieveAll(ctx, res.GetEmail(), pm)
+		if err != nil {
+			return rep, err
+		}
+
+		for _, th := range page.Things {
+			orphaned, err := ts.orphanedMemberships(ctx, th.ID)
+			if err != nil {
+				return rep, err
+			}
+			for _, o := range orphaned {
+				rep.Orphaned = append(rep.Orphaned, o)
+				if defaultGroupID == "" {
+					continue
+				}
+				if err := ts.groups.Unassign(ctx, o.ThingID, o.GroupID); err != nil {
+					return rep, err
+				}
+				if err := ts.groups.Assign(ctx, o.ThingID, defaultGroupID); err != nil {
+					return rep, err
+				}
+				rep.Reassigned++
+			}
+		}
+
+		pm.Offset += pm.Limit
+		if pm.Offset >= page.Total {
+			return rep, nil
+		}
+	}
+}
+
+func (ts *thingsService) orphanedMemberships(ctx context.Context, thingID string) ([]OrphanedMembership, error) {
+	var orphaned []OrphanedMembership
+	for offset := uint64(0); ; offset += reconcileLimit {
+		gp, err := ts.groups.Memberships(ctx, thingID, offset, reconcileLimit, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, g := range gp.Groups {
+			_, err := ts.groups.RetrieveByID(ctx, g.ID)
+			switch {
+			case err == nil:
+			case errors.Contains(err, groups.ErrNotFound):
+				orphaned = append(orphaned, OrphanedMembership{ThingID: thingID, GroupID: g.ID})
+			default:
+				return nil, err
+			}
+		}
+
+		if offset+reconcileLimit >= gp.Total {
+			return orphaned, nil
+		}
+	}
+}
+
+func (ts *thingsService) RetrieveGroupContents(ctx context.Context, token, groupID string, pm PageMetadata) (GroupContents, error) {
+	res, err := ts.auth.Identify(ctx, &mainflux.Token{Value: token})
+	if err != nil {
+		return GroupContents{}, errors.Wrap(ErrUnauthorizedAccess, err)
+	}
+
+	g, err := ts.groups.RetrieveByID(ctx, groupID)
+	if err != nil {
+		return GroupContents{}, err
+	}
+	if g.OwnerID != res.GetId() {
+		return GroupContents{}, ErrAuthorization
+	}
+
+	mp, err := ts.groups.Members(ctx, groupID, pm.Offset, pm.Limit, nil)
+	if err != nil {
+		return GroupContents{}, errors.Wrap(ErrFailedToRetrieveThings, err)
+	}
+	ths, err := ts.groupThings(ctx, mp.Members)
+	if err != nil {
+		return GroupContents{}, err
+	}
+
+	chs, err := ts.groupChannels(ctx, res.GetEmail(), groupID)
+	if err != nil {
+		return GroupContents{}, err
+	}
+
+	contents := GroupContents{
+		Things: Page{
+			PageMetadata: PageMetadata{
+				Total:  mp.Total,
+				Offset: pm.Offset,
+				Limit:  pm.Limit,
+			},
+			Things: ths,
+		},
+		Channels: ChannelsPage{
+			PageMetadata: PageMetadata{
+				Total:  uint64(len(chs)),
+				Offset: pm.Offset,
+				Limit:  pm.Limit,
+			},
+			Channels: []Channel{},
+		},
+	}
+	if pm.Offset < uint64(len(chs)) {
+		end := pm.Offset + pm.Limit
+		if end > uint64(len(chs)) {
+			end = uint64(len(chs))
+		}
+		contents.Channels.Channels = chs[pm.Offset:end]
+	}
+	return contents, nil
+}
+
+// groupThings returns the things of the group members, in the order of
+// the members.
+func (ts *thingsService) groupThings(ctx context.Context, members []groups.Member) ([]Thing, error) {
+	ids := make([]string, 0, len(members))
+	for _, m := range members {
+		if id, ok := memberID(m); ok {
+			ids = append(ids, id)
+		}
+	}
+
+	ths, err := ts.things.RetrieveByIDs(ctx, ids)
+	if err != nil {
+		return nil, errors.Wrap(ErrFailedToRetrieveThings, err)
+	}
+	return ths, nil
+}
+
+// groupChannels returns the owner's channels connected to any thing of
+// the group, sorted by ID.
+func (ts *thingsService) groupChannels(ctx context.Context, owner, groupID string) ([]Channel, error) {
+	byID := make(map[string]Channel)
+	for offset := uint64(0); ; offset += reconcileLimit {
+		mp, err := ts.groups.Members(ctx, groupID, offset, reconcileLimit, nil)
+		if err != nil {
+			return nil, errors.Wrap(ErrFailedToRetrieveThings, err)
+		}
+
+		for _, m := range mp.Members {
+			thingID, ok := memberID(m)
+			if !ok {
+				continue
+			}
+			if err := ts.connectedChannels(ctx, owner, thingID, byID); err != nil {
+				return nil, err
+			}
+		}
+
+		if offset+reconcileLimit >= mp.Total {
+			break
+		}
+	}
+
+	chs := make([]Channel, 0, len(byID))
+	for _, ch := range byID {
+		chs = append(chs, ch)
+	}
+	sort.Slice(chs, func(i, j int) bool { return chs[i].ID < chs[j].ID })
+	return chs, nil
+}
+
+func (ts *thingsService) connectedChannels(ctx context.Context, owner, thingID string, byID map[string]Channel) error {
+	for offset := uint64(0); ; offset += reconcileLimit {
+		cp, err := ts.channels.RetrieveByThing(ctx, owner, thingID, offset, reconcileLimit, true)
+		if err != nil {
+			return err
+		}
+		for _, ch := range cp.Channels {
+			byID[ch.ID] = ch
+		}
+		if offset+reconcileLimit >= cp.Total {
+			return nil
+		}
+	}
+}
+
+// memberID returns the ID of the group member, which the repository
+// returns either as a thing or as the thing ID.
+func memberID(m groups.Member) (string, bool) {
+	switch m := m.(type) {
+	case Thing:
+		return m.ID, true
+	case string:
+		return m, true
+	default:
+		return "", false
+	}
+}
+
 func (ts *thingsService) hasThing(ctx context.Context, chanID, thingKey string) (string, error) {
 	thingID, err := ts.thingCache.ID(ctx, thingKey)
 	if err != nil {
@@ -9,6 +9,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/mainflux/mainflux/internal/groups"
 	"github.com/mainflux/mainflux/pkg/errors"
 	"github.com/mainflux/mainflux/pkg/uuid"
 	"github.com/mainflux/mainflux/things"
@@ -70,6 +71,57 @@ func TestCreateThings(t *testing.T) {
 	}
 }
 
+func TestSaveBestEffort(t *testing.T) {
+	svc := newService(map[string]string{token: email})
+	_, err := svc.CreateThings(context.Background(), token, things.Thing{Name: "existing", Key: "taken"})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+
+	cases := []struct {
+		desc    string
+		things  []things.Thing
+		token   string
+		results []error
+		err     error
+	}{
+		{
+			desc:    "save valid things",
+			things:  []things.Thing{{Name: "a"}, {Name: "b"}},
+			token:   token,
+			results: []error{nil, nil},
+			err:     nil,
+		},
+		{
+			desc:    "save valid and conflicting things",
+			things:  []things.Thing{{Name: "c"}, {Name: "d", Key: "taken"}, {Name: "e"}},
+			token:   token,
+			results: []error{nil, things.ErrConflict, nil},
+			err:     nil,
+		},
+		{
+			desc:    "save things with wrong credentials",
+			things:  []things.Thing{{Name: "f"}},
+			token:   wrongValue,
+			results: []error{},
+			err:     things.ErrUnauthorizedAccess,
+		},
+	}
+
+	for _, tc := range cases {
+		res, err := svc.SaveBestEffort(context.Background(), tc.token, tc.things...)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s\n", tc.desc, tc.err, err))
+		require.Equal(t, len(tc.results), len(res), fmt.Sprintf("%s: expected %d results got %d\n", tc.desc, len(tc.results), len(res)))
+		for i, r := range res {
+			assert.True(t, errors.Contains(r.Err, tc.results[i]), fmt.Sprintf("%s: expected %s got %s for thing %d\n", tc.desc, tc.results[i], r.Err, i))
+			if r.Err != nil {
+				continue
+			}
+			th, err := svc.ViewThing(context.Background(), tc.token, r.Thing.ID)
+			assert.Nil(t, err, fmt.Sprintf("%s: unexpected error viewing saved thing %d: %s\n", tc.desc, i, err))
+			assert.Equal(t, tc.things[i].Name, th.Name, fmt.Sprintf("%s: expected name %s got %s\n", tc.desc, tc.things[i].Name, th.Name))
+		}
+	}
+}
+
 func TestUpdateThing(t *testing.T) {
 	svc := newService(map[string]string{token: email})
 	ths, err := svc.CreateThings(context.Background(), token, thing)
@@ -152,6 +204,56 @@ func TestUpdateKey(t *testing.T) {
 	}
 }
 
+func TestUpdateKeyCache(t *testing.T) {
+	conns := make(chan mocks.Connection)
+	thingsRepo := mocks.NewThingRepository(conns)
+	thingCache := mocks.NewThingCache()
+	svc := things.New(mocks.NewAuthService(map[string]string{token: email}), thingsRepo, mocks.NewChannelRepository(thingsRepo, conns), nil, mocks.NewChannelCache(), thingCache, uuid.NewMock())
+
+	ths, err := svc.CreateThings(context.Background(), token, thing)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+	th := ths[0]
+
+	id, err := svc.Identify(context.Background(), th.Key)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+	require.Equal(t, th.ID, id, fmt.Sprintf("expected %s got %s\n", th.ID, id))
+	_, err = thingCache.ID(context.Background(), th.Key)
+	require.Nil(t, err, fmt.Sprintf("expected old key to be cached: %s\n", err))
+
+	key := "rotated-key"
+	err = svc.UpdateKey(context.Background(), token, th.ID, key)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+
+	cases := []struct {
+		desc string
+		key  string
+		id   string
+		err  error
+	}{
+		{
+			desc: "identify thing with old key",
+			key:  th.Key,
+			id:   "",
+			err:  things.ErrNotFound,
+		},
+		{
+			desc: "identify thing with new key",
+			key:  key,
+			id:   th.ID,
+			err:  nil,
+		},
+	}
+
+	for _, tc := range cases {
+		id, err := thingCache.ID(context.Background(), tc.key)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected cache error %s got %s\n", tc.desc, tc.err, err))
+		assert.Equal(t, tc.id, id, fmt.Sprintf("%s: expected cached id %s got %s\n", tc.desc, tc.id, id))
+		id, err = svc.Identify(context.Background(), tc.key)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s\n", tc.desc, tc.err, err))
+		assert.Equal(t, tc.id, id, fmt.Sprintf("%s: expected id %s got %s\n", tc.desc, tc.id, id))
+	}
+}
+
 func TestViewThing(t *testing.T) {
 	svc := newService(map[string]string{token: email})
 	ths, err := svc.CreateThings(context.Background(), token, thing)
@@ -186,6 +288,137 @@ func TestViewThing(t *testing.T) {
 	}
 }
 
+// readCounter counts the things retrieved by ID from the wrapped repository.
+type readCounter struct {
+	things.ThingRepository
+	reads int
+}
+
+func (rc *readCounter) RetrieveByID(ctx context.Context, owner, id string) (things.Thing, error) {
+	rc.reads++
+	return rc.ThingRepository.RetrieveByID(ctx, owner, id)
+}
+
+func newCachingService(tokens map[string]string, cfg things.Config) (things.Service, *readCounter) {
+	auth := mocks.NewAuthService(tokens)
+	conns := make(chan mocks.Connection)
+	thingsRepo := mocks.NewThingRepository(conns)
+	rc := &readCounter{ThingRepository: thingsRepo}
+	channelsRepo := mocks.NewChannelRepository(thingsRepo, conns)
+	chanCache := mocks.NewChannelCache()
+	thingCache := mocks.NewThingCache()
+	uuidProvider := uuid.NewMock()
+
+	return things.NewWithConfig(auth, rc, channelsRepo, nil, chanCache, thingCache, uuidProvider, cfg), rc
+}
+
+func TestViewThingCache(t *testing.T) {
+	otherToken := "other-token"
+	svc, rc := newCachingService(map[string]string{token: email, otherToken: "other@example.com"}, things.Config{ViewCacheTTL: time.Minute, ViewCacheSize: 1})
+	ths, err := svc.CreateThings(context.Background(), token, thing, thing)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+	th, other := ths[0], ths[1]
+
+	cases := []struct {
+		desc  string
+		view  func() (things.Thing, error)
+		name  string
+		reads int
+		err   error
+	}{
+		{
+			desc:  "view thing",
+			view:  func() (things.Thing, error) { return svc.ViewThing(context.Background(), token, th.ID) },
+			name:  th.Name,
+			reads: 1,
+		},
+		{
+			desc:  "view cached thing",
+			view:  func() (things.Thing, error) { return svc.ViewThing(context.Background(), token, th.ID) },
+			name:  th.Name,
+			reads: 1,
+		},
+		{
+			desc:  "view cached thing as another user",
+			view:  func() (things.Thing, error) { return svc.ViewThing(context.Background(), otherToken, th.ID) },
+			reads: 2,
+			err:   things.ErrNotFound,
+		},
+		{
+			desc: "view updated thing",
+			view: func() (things.Thing, error) {
+				updated := th
+				updated.Name = "updated"
+				if err := svc.UpdateThing(context.Background(), token, updated); err != nil {
+					return things.Thing{}, err
+				}
+				return svc.ViewThing(context.Background(), token, th.ID)
+			},
+			name:  "updated",
+			reads: 3,
+		},
+		{
+			desc: "view thing with updated key",
+			view: func() (things.Thing, error) {
+				if err := svc.UpdateKey(context.Background(), token, th.ID, "updated-key"); err != nil {
+					return things.Thing{}, err
+				}
+				return svc.ViewThing(context.Background(), token, th.ID)
+			},
+			name:  "updated",
+			reads: 4,
+		},
+		{
+			desc:  "view thing evicting the cached one",
+			view:  func() (things.Thing, error) { return svc.ViewThing(context.Background(), token, other.ID) },
+			name:  other.Name,
+			reads: 5,
+		},
+		{
+			desc:  "view evicted thing",
+			view:  func() (things.Thing, error) { return svc.ViewThing(context.Background(), token, th.ID) },
+			name:  "updated",
+			reads: 6,
+		},
+		{
+			desc: "view removed thing",
+			view: func() (things.Thing, error) {
+				if err := svc.RemoveThing(context.Background(), token, th.ID); err != nil {
+					return things.Thing{}, err
+				}
+				return svc.ViewThing(context.Background(), token, th.ID)
+			},
+			reads: 7,
+			err:   things.ErrNotFound,
+		},
+	}
+
+	for _, tc := range cases {
+		res, err := tc.view()
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s\n", tc.desc, tc.err, err))
+		assert.Equal(t, tc.name, res.Name, fmt.Sprintf("%s: expected name %s got %s\n", tc.desc, tc.name, res.Name))
+		assert.Equal(t, tc.reads, rc.reads, fmt.Sprintf("%s: expected %d reads got %d\n", tc.desc, tc.reads, rc.reads))
+	}
+}
+
+func TestViewThingCacheExpiry(t *testing.T) {
+	ttl := 20 * time.Millisecond
+	svc, rc := newCachingService(map[string]string{token: email}, things.Config{ViewCacheTTL: ttl})
+	ths, err := svc.CreateThings(context.Background(), token, thing)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+
+	for i := 0; i < 3; i++ {
+		_, err := svc.ViewThing(context.Background(), token, ths[0].ID)
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+	}
+	assert.Equal(t, 1, rc.reads, fmt.Sprintf("expected repeated views to be cached got %d reads", rc.reads))
+
+	time.Sleep(ttl)
+	_, err = svc.ViewThing(context.Background(), token, ths[0].ID)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+	assert.Equal(t, 2, rc.reads, fmt.Sprintf("expected expired thing to be read again got %d reads", rc.reads))
+}
+
 func TestListThings(t *testing.T) {
 	svc := newService(map[string]string{token: email})
 
@@ -279,509 +512,487 @@ func TestListThings(t *testing.T) {
 	}
 }
 
-func TestListThingsByChannel(t *testing.T) {
+func TestListThingsByMetadataKeys(t *testing.T) {
 	svc := newService(map[string]string{token: email})
 
-	chs, err := svc.CreateChannels(context.Background(), token, channel)
-	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
-	ch := chs[0]
-
-	n := uint64(10)
-	thsDisconNum := uint64(1)
-
+	locNum := uint64(4)
+	fwNum := uint64(3)
+	bothNum := uint64(3)
+	n := locNum + fwNum + bothNum
 	for i := uint64(0); i < n; i++ {
-		ths, err := svc.CreateThings(context.Background(), token, thing)
-		require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
-		th := ths[0]
-
-		// Don't connect last Channel
-		if i == n-thsDisconNum {
-			break
+		th := things.Thing{Name: "test", Metadata: things.Metadata{}}
+		if i < locNum || i >= locNum+fwNum {
+			th.Metadata["location"] = "lab"
 		}
-
-		err = svc.Connect(context.Background(), token, []string{ch.ID}, []string{th.ID})
+		if i >= locNum {
+			th.Metadata["firmware"] = "1.0.0"
+		}
+		_, err := svc.CreateThings(context.Background(), token, th)
 		require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
 	}
 
-	// Wait for things and channels to connect
-	time.Sleep(time.Second)
-
 	cases := map[string]struct {
-		token     string
-		channel   string
-		offset    uint64
-		limit     uint64
-		connected bool
-		size      uint64
-		err       error
+		pageMetadata things.PageMetadata
+		size         uint64
 	}{
-		"list all things by existing channel": {
-			token:     token,
-			channel:   ch.ID,
-			offset:    0,
-			limit:     n,
-			connected: true,
-			size:      n - thsDisconNum,
-			err:       nil,
-		},
-		"list half of things by existing channel": {
-			token:     token,
-			channel:   ch.ID,
-			offset:    n / 2,
-			limit:     n,
-			connected: true,
-			size:      (n / 2) - thsDisconNum,
-			err:       nil,
-		},
-		"list last thing by existing channel": {
-			token:     token,
-			channel:   ch.ID,
-			offset:    n - 1 - thsDisconNum,
-			limit:     n,
-			connected: true,
-			size:      1,
-			err:       nil,
-		},
-		"list empty set of things by existing channel": {
-			token:     token,
-			channel:   ch.ID,
-			offset:    n + 1,
-			limit:     n,
-			connected: true,
-			size:      0,
-			err:       nil,
-		},
-		"list things by existing channel with zero limit": {
-			token:     token,
-			channel:   ch.ID,
-			offset:    1,
-			limit:     0,
-			connected: true,
-			size:      0,
-			err:       nil,
+		"list things having a metadata key": {
+			pageMetadata: things.PageMetadata{
+				Offset:          0,
+				Limit:           n,
+				HasMetadataKeys: []string{"location"},
+			},
+			size: locNum + bothNum,
 		},
-		"list things by existing channel with wrong credentials": {
-			token:     wrongValue,
-			channel:   ch.ID,
-			offset:    0,
-			limit:     0,
-			connected: true,
-			size:      0,
-			err:       things.ErrUnauthorizedAccess,
+		"list things missing a metadata key": {
+			pageMetadata: things.PageMetadata{
+				Offset:              0,
+				Limit:               n,
+				MissingMetadataKeys: []string{"firmware"},
+			},
+			size: locNum,
 		},
-		"list things by non-existent channel with wrong credentials": {
-			token:     token,
-			channel:   "non-existent",
-			offset:    0,
-			limit:     10,
-			connected: true,
-			size:      0,
-			err:       nil,
+		"list things having and missing metadata keys": {
+			pageMetadata: things.PageMetadata{
+				Offset:              0,
+				Limit:               n,
+				HasMetadataKeys:     []string{"firmware"},
+				MissingMetadataKeys: []string{"location"},
+			},
+			size: fwNum,
 		},
-		"list all non connected things by existing channel": {
-			token:     token,
-			channel:   ch.ID,
-			offset:    0,
-			limit:     n,
-			connected: false,
-			size:      thsDisconNum,
-			err:       nil,
+		"list things having all of the metadata keys": {
+			pageMetadata: things.PageMetadata{
+				Offset:          0,
+				Limit:           n,
+				HasMetadataKeys: []string{"firmware", "location"},
+			},
+			size: bothNum,
 		},
 	}
 
 	for desc, tc := range cases {
-		page, err := svc.ListThingsByChannel(context.Background(), tc.token, tc.channel, tc.offset, tc.limit, tc.connected)
+		page, err := svc.ListThings(context.Background(), token, tc.pageMetadata)
+		assert.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s\n", desc, err))
 		size := uint64(len(page.Things))
 		assert.Equal(t, tc.size, size, fmt.Sprintf("%s: expected %d got %d\n", desc, tc.size, size))
-		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s\n", desc, tc.err, err))
 	}
 }
 
-func TestRemoveThing(t *testing.T) {
+func TestListThingsAnyOf(t *testing.T) {
 	svc := newService(map[string]string{token: email})
-	ths, err := svc.CreateThings(context.Background(), token, thing)
-	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
-	sth := ths[0]
 
-	cases := []struct {
-		desc  string
-		id    string
-		token string
-		err   error
+	// Lamps 0 and 1 are in the kitchen, so they match both filters.
+	for i := 0; i < 4; i++ {
+		th := things.Thing{Name: fmt.Sprintf("lamp-%d", i), Metadata: things.Metadata{}}
+		if i < 2 {
+			th.Metadata["room"] = "kitchen"
+		}
+		_, err := svc.CreateThings(context.Background(), token, th)
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+	}
+	for i := 0; i < 3; i++ {
+		th := things.Thing{Name: fmt.Sprintf("sensor-%d", i), Metadata: things.Metadata{}}
+		if i < 1 {
+			th.Metadata["room"] = "kitchen"
+		}
+		_, err := svc.CreateThings(context.Background(), token, th)
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+	}
+
+	anyOf := []things.Filter{
+		{Name: "lamp"},
+		{Metadata: map[string]interface{}{"room": "kitchen"}},
+	}
+
+	cases := map[string]struct {
+		pageMetadata things.PageMetadata
+		size         uint64
+		total        uint64
 	}{
-		{
-			desc:  "remove thing with wrong credentials",
-			id:    sth.ID,
-			token: wrongValue,
-			err:   things.ErrUnauthorizedAccess,
+		"list things matching any of the filters": {
+			pageMetadata: things.PageMetadata{
+				Offset: 0,
+				Limit:  10,
+				AnyOf:  anyOf,
+			},
+			size:  5,
+			total: 5,
 		},
-		{
-			desc:  "remove existing thing",
-			id:    sth.ID,
-			token: token,
-			err:   nil,
+		"list first page of things matching any of the filters": {
+			pageMetadata: things.PageMetadata{
+				Offset: 0,
+				Limit:  3,
+				AnyOf:  anyOf,
+			},
+			size:  3,
+			total: 5,
 		},
-		{
-			desc:  "remove removed thing",
-			id:    sth.ID,
-			token: token,
-			err:   nil,
+		"list last page of things matching any of the filters": {
+			pageMetadata: things.PageMetadata{
+				Offset: 3,
+				Limit:  3,
+				AnyOf:  anyOf,
+			},
+			size:  2,
+			total: 5,
 		},
-		{
-			desc:  "remove non-existing thing",
-			id:    wrongID,
-			token: token,
-			err:   nil,
+		"list things matching any of the filters combined with other filters": {
+			pageMetadata: things.PageMetadata{
+				Offset:              0,
+				Limit:               10,
+				AnyOf:               anyOf,
+				MissingMetadataKeys: []string{"room"},
+			},
+			size:  2,
+			total: 2,
+		},
+		"list things matching a single filter with multiple predicates": {
+			pageMetadata: things.PageMetadata{
+				Offset: 0,
+				Limit:  10,
+				AnyOf: []things.Filter{
+					{Name: "sensor", Metadata: map[string]interface{}{"room": "kitchen"}},
+				},
+			},
+			size:  1,
+			total: 1,
 		},
 	}
 
-	for _, tc := range cases {
-		err := svc.RemoveThing(context.Background(), tc.token, tc.id)
-		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s\n", tc.desc, tc.err, err))
-	}
-}
-
-func TestCreateChannels(t *testing.T) {
-	svc := newService(map[string]string{token: email})
+	for desc, tc := range cases {
+		page, err := svc.ListThings(context.Background(), token, tc.pageMetadata)
+		assert.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s\n", desc, err))
+		size := uint64(len(page.Things))
+		assert.Equal(t, tc.size, size, fmt.Sprintf("%s: expected size %d got %d\n", desc, tc.size, size))
+		assert.Equal(t, tc.total, page.Total, fmt.Sprintf("%s: expected total %d got %d\n", desc, tc.total, page.Total))
 
-	cases := []struct {
-		desc     string
-		channels []things.Channel
-		token    string
-		err      error
-	}{
-		{
-			desc:     "create new channels",
-			channels: []things.Channel{{Name: "a"}, {Name: "b"}, {Name: "c"}, {Name: "d"}},
-			token:    token,
-			err:      nil,
-		},
-		{
-			desc:     "create channel with wrong credentials",
-			channels: []things.Channel{{Name: "e"}},
-			token:    wrongValue,
-			err:      things.ErrUnauthorizedAccess,
-		},
+		seen := make(map[string]bool)
+		for _, th := range page.Things {
+			assert.False(t, seen[th.ID], fmt.Sprintf("%s: unexpected duplicate thing %s\n", desc, th.ID))
+			seen[th.ID] = true
+		}
 	}
 
-	for _, cc := range cases {
-		_, err := svc.CreateChannels(context.Background(), cc.token, cc.channels...)
-		assert.True(t, errors.Contains(err, cc.err), fmt.Sprintf("%s: expected %s got %s\n", cc.desc, cc.err, err))
+	first, err := svc.ListThings(context.Background(), token, things.PageMetadata{Offset: 0, Limit: 3, AnyOf: anyOf})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+	last, err := svc.ListThings(context.Background(), token, things.PageMetadata{Offset: 3, Limit: 3, AnyOf: anyOf})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+	for _, a := range first.Things {
+		for _, b := range last.Things {
+			assert.NotEqual(t, a.ID, b.ID, fmt.Sprintf("thing %s expected on a single page\n", a.ID))
+		}
 	}
 }
 
-func TestUpdateChannel(t *testing.T) {
+func TestListConnectedThings(t *testing.T) {
 	svc := newService(map[string]string{token: email})
+
 	chs, err := svc.CreateChannels(context.Background(), token, channel)
-	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
 	ch := chs[0]
-	other := things.Channel{ID: wrongID}
-
-	cases := []struct {
-		desc    string
-		channel things.Channel
-		token   string
-		err     error
-	}{
-		{
-			desc:    "update existing channel",
-			channel: ch,
-			token:   token,
-			err:     nil,
-		},
-		{
-			desc:    "update channel with wrong credentials",
-			channel: ch,
-			token:   wrongValue,
-			err:     things.ErrUnauthorizedAccess,
-		},
-		{
-			desc:    "update non-existing channel",
-			channel: other,
-			token:   token,
-			err:     things.ErrNotFound,
-		},
-	}
 
-	for _, tc := range cases {
-		err := svc.UpdateChannel(context.Background(), tc.token, tc.channel)
-		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s\n", tc.desc, tc.err, err))
+	n := uint64(10)
+	connNum := uint64(4)
+	for i := uint64(0); i < n; i++ {
+		ths, err := svc.CreateThings(context.Background(), token, thing)
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+		if i < connNum {
+			err = svc.Connect(context.Background(), token, []string{ch.ID}, []string{ths[0].ID})
+			require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+		}
 	}
-}
 
-func TestViewChannel(t *testing.T) {
-	svc := newService(map[string]string{token: email})
-	chs, err := svc.CreateChannels(context.Background(), token, channel)
-	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
-	ch := chs[0]
+	// Wait for things and channels to connect.
+	time.Sleep(time.Second)
 
 	cases := map[string]struct {
-		id       string
-		token    string
-		err      error
-		metadata things.Metadata
+		pageMetadata things.PageMetadata
+		size         uint64
 	}{
-		"view existing channel": {
-			id:    ch.ID,
-			token: token,
-			err:   nil,
-		},
-		"view channel with wrong credentials": {
-			id:    ch.ID,
-			token: wrongValue,
-			err:   things.ErrUnauthorizedAccess,
-		},
-		"view non-existing channel": {
-			id:    wrongID,
-			token: token,
-			err:   things.ErrNotFound,
+		"list all things": {
+			pageMetadata: things.PageMetadata{
+				Offset: 0,
+				Limit:  n,
+			},
+			size: n,
 		},
-		"view channel with metadata": {
-			id:    wrongID,
-			token: token,
-			err:   things.ErrNotFound,
+		"list connected things": {
+			pageMetadata: things.PageMetadata{
+				Offset:        0,
+				Limit:         n,
+				ConnectedOnly: true,
+			},
+			size: connNum,
 		},
 	}
 
 	for desc, tc := range cases {
-		_, err := svc.ViewChannel(context.Background(), tc.token, tc.id)
-		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s\n", desc, tc.err, err))
+		page, err := svc.ListThings(context.Background(), token, tc.pageMetadata)
+		assert.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s\n", desc, err))
+		size := uint64(len(page.Things))
+		assert.Equal(t, tc.size, size, fmt.Sprintf("%s: expected %d got %d\n", desc, tc.size, size))
 	}
 }
 
-func TestListChannels(t *testing.T) {
+func TestListThingsWithConnections(t *testing.T) {
 	svc := newService(map[string]string{token: email})
-	meta := things.Metadata{}
-	meta["name"] = "test-channel"
-	channel.Metadata = meta
+
+	chs, err := svc.CreateChannels(context.Background(), token, channel, channel)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	cids := []string{chs[0].ID, chs[1].ID}
+
+	// The things are connected to none, one or both channels in turn.
 	n := uint64(10)
+	connections := make(map[string]uint64)
 	for i := uint64(0); i < n; i++ {
-		svc.CreateChannels(context.Background(), token, channel)
+		ths, err := svc.CreateThings(context.Background(), token, thing)
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+		connNum := i % uint64(len(cids)+1)
+		if connNum > 0 {
+			err = svc.Connect(context.Background(), token, cids[:connNum], []string{ths[0].ID})
+			require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+		}
+		connections[ths[0].ID] = connNum
 	}
+
+	// Wait for things and channels to connect.
+	time.Sleep(time.Second)
+
 	cases := map[string]struct {
-		token    string
 		pageMetadata things.PageMetadata
-		size     uint64
-		err      error
+		status       bool
 	}{
-		"list all channels": {
-			token: token,
-			pageMetadata: things.PageMetadata{
-				Offset: 0,
-				Limit:  n,
-			},
-			size: n,
-			err:  nil,
-		},
-		"list half": {
-			token: token,
-			pageMetadata: things.PageMetadata{
-				Offset: n / 2,
-				Limit:  n,
-			},
-			size: n / 2,
-			err:  nil,
-		},
-		"list last channel": {
-			token: token,
-			pageMetadata: things.PageMetadata{
-				Offset: n - 1,
-				Limit:  n,
-			},
-			size: 1,
-			err:  nil,
-		},
-		"list empty set": {
-			token: token,
-			pageMetadata: things.PageMetadata{
-				Offset: n + 1,
-				Limit:  n,
-			},
-			size: 0,
-			err:  nil,
-		},
-		"list with zero limit": {
-			token: token,
-			pageMetadata: things.PageMetadata{
-				Offset: 1,
-				Limit:  0,
-			},
-			size: 0,
-			err:  nil,
-		},
-		"list with wrong credentials": {
-			token: wrongValue,
-			pageMetadata: things.PageMetadata{
-				Offset: 0,
-				Limit:  0,
-			},
-			size: 0,
-			err:  things.ErrUnauthorizedAccess,
-		},
-		"list with existing name": {
-			token: token,
+		"list things without connection status": {
 			pageMetadata: things.PageMetadata{
 				Offset: 0,
 				Limit:  n,
-				Name:   "chanel_name",
 			},
-			size: n,
-			err:  nil,
+			status: false,
 		},
-		"list with non-existent name": {
-			token: token,
+		"list things with connection status": {
 			pageMetadata: things.PageMetadata{
-				Offset: 0,
-				Limit:  n,
-				Name:   "wrong",
+				Offset:          0,
+				Limit:           n,
+				WithConnections: true,
 			},
-			size: n,
-			err:  nil,
+			status: true,
 		},
-		"list all channels with metadata": {
-			token: token,
+		"list filtered things with connection status": {
 			pageMetadata: things.PageMetadata{
-				Offset:   0,
-				Limit:    n,
-				Metadata: meta,
+				Offset:          0,
+				Limit:           n,
+				AnyOf:           []things.Filter{{Name: thing.Name}},
+				WithConnections: true,
 			},
-			size: n,
-			err:  nil,
+			status: true,
 		},
 	}
 
 	for desc, tc := range cases {
-		page, err := svc.ListChannels(context.Background(), tc.token, tc.pageMetadata)
-		size := uint64(len(page.Channels))
-		assert.Equal(t, tc.size, size, fmt.Sprintf("%s: expected %d got %d\n", desc, tc.size, size))
-		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s\n", desc, tc.err, err))
+		page, err := svc.ListThings(context.Background(), token, tc.pageMetadata)
+		require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s\n", desc, err))
+		assert.Equal(t, n, uint64(len(page.Things)), fmt.Sprintf("%s: expected %d got %d\n", desc, n, len(page.Things)))
+		for _, th := range page.Things {
+			expected := uint64(0)
+			if tc.status {
+				expected = connections[th.ID]
+			}
+			assert.Equal(t, expected, th.Connections, fmt.Sprintf("%s: expected %d connections got %d\n", desc, expected, th.Connections))
+			assert.Equal(t, expected > 0, th.Connected, fmt.Sprintf("%s: expected connected %t got %t\n", desc, expected > 0, th.Connected))
+		}
 	}
 }
 
-func TestListChannelsByThing(t *testing.T) {
+func TestListThingsByChannel(t *testing.T) {
 	svc := newService(map[string]string{token: email})
 
-	ths, err := svc.CreateThings(context.Background(), token, thing)
+	chs, err := svc.CreateChannels(context.Background(), token, channel)
 	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
-	th := ths[0]
+	ch := chs[0]
 
 	n := uint64(10)
-	chsDisconNum := uint64(1)
+	thsDisconNum := uint64(1)
 
 	for i := uint64(0); i < n; i++ {
-		schs, err := svc.CreateChannels(context.Background(), token, channel)
+		ths, err := svc.CreateThings(context.Background(), token, thing)
 		require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
-		sch := schs[0]
+		th := ths[0]
 
 		// Don't connect last Channel
-		if i == n-chsDisconNum {
+		if i == n-thsDisconNum {
 			break
 		}
 
-		err = svc.Connect(context.Background(), token, []string{sch.ID}, []string{th.ID})
+		err = svc.Connect(context.Background(), token, []string{ch.ID}, []string{th.ID})
 		require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
 	}
 
-	// Wait for things and channels to connect.
+	// Wait for things and channels to connect
 	time.Sleep(time.Second)
 
 	cases := map[string]struct {
 		token     string
-		thing     string
+		channel   string
 		offset    uint64
 		limit     uint64
 		connected bool
 		size      uint64
 		err       error
 	}{
-		"list all channels by existing thing": {
+		"list all things by existing channel": {
 			token:     token,
-			thing:     th.ID,
+			channel:   ch.ID,
 			offset:    0,
 			limit:     n,
 			connected: true,
-			size:      n - chsDisconNum,
+			size:      n - thsDisconNum,
 			err:       nil,
 		},
-		"list half of channels by existing thing": {
+		"list half of things by existing channel": {
 			token:     token,
-			thing:     th.ID,
+			channel:   ch.ID,
 			offset:    n / 2,
 			limit:     n,
 			connected: true,
-			size:      (n / 2) - chsDisconNum,
+			size:      (n / 2) - thsDisconNum,
 			err:       nil,
 		},
-		"list last channel by existing thing": {
+		"list last thing by existing channel": {
 			token:     token,
-			thing:     th.ID,
-			offset:    n - 1 - chsDisconNum,
+			channel:   ch.ID,
+			offset:    n - 1 - thsDisconNum,
 			limit:     n,
 			connected: true,
 			size:      1,
 			err:       nil,
 		},
-		"list empty set of channels by existing thing": {
+		"list empty set of things by existing channel": {
 			token:     token,
-			thing:     th.ID,
+			channel:   ch.ID,
 			offset:    n + 1,
 			limit:     n,
 			connected: true,
 			size:      0,
 			err:       nil,
 		},
-		"list channels by existing thing with zero limit": {
+		"list things by existing channel with zero limit": {
 			token:     token,
-			thing:     th.ID,
+			channel:   ch.ID,
 			offset:    1,
 			limit:     0,
 			connected: true,
 			size:      0,
 			err:       nil,
 		},
-		"list channels by existing thing with wrong credentials": {
+		"list things by existing channel with wrong credentials": {
 			token:     wrongValue,
-			thing:     th.ID,
+			channel:   ch.ID,
 			offset:    0,
 			limit:     0,
 			connected: true,
 			size:      0,
 			err:       things.ErrUnauthorizedAccess,
 		},
-		"list channels by non-existent thing": {
+		"list things by non-existent channel with wrong credentials": {
 			token:     token,
-			thing:     "non-existent",
+			channel:   "non-existent",
 			offset:    0,
 			limit:     10,
 			connected: true,
 			size:      0,
 			err:       nil,
 		},
-		"list all non connected channels by existing thing": {
+		"list all non connected things by existing channel": {
 			token:     token,
-			thing:     th.ID,
+			channel:   ch.ID,
 			offset:    0,
 			limit:     n,
 			connected: false,
-			size:      chsDisconNum,
+			size:      thsDisconNum,
 			err:       nil,
 		},
 	}
 
 	for desc, tc := range cases {
-		page, err := svc.ListChannelsByThing(context.Background(), tc.token, tc.thing, tc.offset, tc.limit, tc.connected)
-		size := uint64(len(page.Channels))
+		page, err := svc.ListThingsByChannel(context.Background(), tc.token, tc.channel, tc.connected, things.PageMetadata{Offset: tc.offset, Limit: tc.limit})
+		size := uint64(len(page.Things))
 		assert.Equal(t, tc.size, size, fmt.Sprintf("%s: expected %d got %d\n", desc, tc.size, size))
 		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s\n", desc, tc.err, err))
 	}
 }
 
-func TestRemoveChannel(t *testing.T) {
+func TestListThingsByChannelConnectedAt(t *testing.T) {
 	svc := newService(map[string]string{token: email})
+
 	chs, err := svc.CreateChannels(context.Background(), token, channel)
-	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
 	ch := chs[0]
 
+	ths, err := svc.CreateThings(context.Background(), token, thing, thing, thing)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+
+	// Connect things in an order different from the creation order.
+	connected := []string{ths[2].ID, ths[0].ID, ths[1].ID}
+	for _, id := range connected {
+		err = svc.Connect(context.Background(), token, []string{ch.ID}, []string{id})
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+		time.Sleep(time.Millisecond)
+	}
+
+	// Wait for things and channels to connect
+	time.Sleep(100 * time.Millisecond)
+
+	cases := map[string]struct {
+		offset uint64
+		limit  uint64
+		dir    string
+		ids    []string
+	}{
+		"list things ordered by connection time ascending": {
+			offset: 0,
+			limit:  10,
+			dir:    "asc",
+			ids:    connected,
+		},
+		"list things ordered by connection time descending": {
+			offset: 0,
+			limit:  10,
+			dir:    "desc",
+			ids:    []string{connected[2], connected[1], connected[0]},
+		},
+		"list things ordered by connection time with offset and limit": {
+			offset: 1,
+			limit:  1,
+			dir:    "desc",
+			ids:    []string{connected[1]},
+		},
+		"list things ordered by connection time with offset out of range": {
+			offset: 5,
+			limit:  10,
+			dir:    "asc",
+			ids:    []string{},
+		},
+	}
+
+	for desc, tc := range cases {
+		pm := things.PageMetadata{Offset: tc.offset, Limit: tc.limit, Order: things.OrderConnectedAt, Dir: tc.dir}
+		page, err := svc.ListThingsByChannel(context.Background(), token, ch.ID, true, pm)
+		require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s\n", desc, err))
+		ids := []string{}
+		for _, th := range page.Things {
+			ids = append(ids, th.ID)
+		}
+		assert.Equal(t, tc.ids, ids, fmt.Sprintf("%s: expected %v got %v\n", desc, tc.ids, ids))
+		assert.Equal(t, uint64(len(connected)), page.Total, fmt.Sprintf("%s: expected total %d got %d\n", desc, len(connected), page.Total))
+	}
+}
+
+func TestRemoveThing(t *testing.T) {
+	svc := newService(map[string]string{token: email})
+	ths, err := svc.CreateThings(context.Background(), token, thing)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+	sth := ths[0]
+
 	cases := []struct {
 		desc  string
 		id    string
@@ -789,268 +1000,1528 @@ func TestRemoveChannel(t *testing.T) {
 		err   error
 	}{
 		{
-			desc:  "remove channel with wrong credentials",
-			id:    ch.ID,
+			desc:  "remove thing with wrong credentials",
+			id:    sth.ID,
 			token: wrongValue,
 			err:   things.ErrUnauthorizedAccess,
 		},
 		{
-			desc:  "remove existing channel",
-			id:    ch.ID,
+			desc:  "remove existing thing",
+			id:    sth.ID,
 			token: token,
 			err:   nil,
 		},
 		{
-			desc:  "remove removed channel",
-			id:    ch.ID,
+			desc:  "remove removed thing",
+			id:    sth.ID,
 			token: token,
 			err:   nil,
 		},
 		{
-			desc:  "remove non-existing channel",
-			id:    ch.ID,
+			desc:  "remove non-existing thing",
+			id:    wrongID,
 			token: token,
 			err:   nil,
 		},
 	}
 
 	for _, tc := range cases {
-		err := svc.RemoveChannel(context.Background(), tc.token, tc.id)
+		err := svc.RemoveThing(context.Background(), tc.token, tc.id)
 		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s\n", tc.desc, tc.err, err))
 	}
 }
 
-func TestConnect(t *testing.T) {
+func TestCreateChannels(t *testing.T) {
 	svc := newService(map[string]string{token: email})
 
-	ths, err := svc.CreateThings(context.Background(), token, thing)
-	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
-	th := ths[0]
-	chs, err := svc.CreateChannels(context.Background(), token, channel)
-	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
-	ch := chs[0]
-
 	cases := []struct {
-		desc    string
-		token   string
-		chanID  string
-		thingID string
-		err     error
+		desc     string
+		channels []things.Channel
+		token    string
+		err      error
 	}{
 		{
-			desc:    "connect thing",
-			token:   token,
-			chanID:  ch.ID,
-			thingID: th.ID,
-			err:     nil,
-		},
-		{
-			desc:    "connect thing with wrong credentials",
-			token:   wrongValue,
-			chanID:  ch.ID,
-			thingID: th.ID,
-			err:     things.ErrUnauthorizedAccess,
-		},
-		{
-			desc:    "connect thing to non-existing channel",
-			token:   token,
-			chanID:  wrongID,
-			thingID: th.ID,
-			err:     things.ErrNotFound,
+			desc:     "create new channels",
+			channels: []things.Channel{{Name: "a"}, {Name: "b"}, {Name: "c"}, {Name: "d"}},
+			token:    token,
+			err:      nil,
 		},
 		{
-			desc:    "connect non-existing thing to channel",
-			token:   token,
-			chanID:  ch.ID,
-			thingID: wrongID,
-			err:     things.ErrNotFound,
+			desc:     "create channel with wrong credentials",
+			channels: []things.Channel{{Name: "e"}},
+			token:    wrongValue,
+			err:      things.ErrUnauthorizedAccess,
 		},
 	}
 
-	for _, tc := range cases {
-		err := svc.Connect(context.Background(), tc.token, []string{tc.chanID}, []string{tc.thingID})
-		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s\n", tc.desc, tc.err, err))
+	for _, cc := range cases {
+		_, err := svc.CreateChannels(context.Background(), cc.token, cc.channels...)
+		assert.True(t, errors.Contains(err, cc.err), fmt.Sprintf("%s: expected %s got %s\n", cc.desc, cc.err, err))
 	}
 }
 
-func TestDisconnect(t *testing.T) {
+func TestUpdateChannel(t *testing.T) {
 	svc := newService(map[string]string{token: email})
-
-	ths, err := svc.CreateThings(context.Background(), token, thing)
-	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
-	th := ths[0]
 	chs, err := svc.CreateChannels(context.Background(), token, channel)
 	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
 	ch := chs[0]
-	err = svc.Connect(context.Background(), token, []string{ch.ID}, []string{th.ID})
-	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+	other := things.Channel{ID: wrongID}
 
 	cases := []struct {
 		desc    string
+		channel things.Channel
 		token   string
-		chanID  string
-		thingID string
 		err     error
 	}{
 		{
-			desc:    "disconnect connected thing",
+			desc:    "update existing channel",
+			channel: ch,
 			token:   token,
-			chanID:  ch.ID,
-			thingID: th.ID,
 			err:     nil,
 		},
 		{
-			desc:    "disconnect disconnected thing",
-			token:   token,
-			chanID:  ch.ID,
-			thingID: th.ID,
-			err:     things.ErrNotFound,
-		},
-		{
-			desc:    "disconnect with wrong credentials",
+			desc:    "update channel with wrong credentials",
+			channel: ch,
 			token:   wrongValue,
-			chanID:  ch.ID,
-			thingID: th.ID,
 			err:     things.ErrUnauthorizedAccess,
 		},
 		{
-			desc:    "disconnect from non-existing channel",
-			token:   token,
-			chanID:  wrongID,
-			thingID: th.ID,
-			err:     things.ErrNotFound,
-		},
-		{
-			desc:    "disconnect non-existing thing",
+			desc:    "update non-existing channel",
+			channel: other,
 			token:   token,
-			chanID:  ch.ID,
-			thingID: wrongID,
 			err:     things.ErrNotFound,
 		},
 	}
 
 	for _, tc := range cases {
-		err := svc.Disconnect(context.Background(), tc.token, tc.chanID, tc.thingID)
+		err := svc.UpdateChannel(context.Background(), tc.token, tc.channel)
 		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s\n", tc.desc, tc.err, err))
 	}
-
 }
 
-func TestCanAccessByKey(t *testing.T) {
+func TestViewChannel(t *testing.T) {
 	svc := newService(map[string]string{token: email})
-
-	ths, err := svc.CreateThings(context.Background(), token, thing)
-	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
-	chs, err := svc.CreateChannels(context.Background(), token, channel, channel)
-	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
-	err = svc.Connect(context.Background(), token, []string{chs[0].ID}, []string{ths[0].ID})
+	chs, err := svc.CreateChannels(context.Background(), token, channel)
 	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+	ch := chs[0]
 
 	cases := map[string]struct {
-		token   string
-		channel string
-		err     error
+		id       string
+		token    string
+		err      error
+		metadata things.Metadata
 	}{
-		"allowed access": {
-			token:   ths[0].Key,
-			channel: chs[0].ID,
-			err:     nil,
+		"view existing channel": {
+			id:    ch.ID,
+			token: token,
+			err:   nil,
 		},
-		"non-existing thing": {
-			token:   wrongValue,
-			channel: chs[0].ID,
-			err:     things.ErrNotFound,
+		"view channel with wrong credentials": {
+			id:    ch.ID,
+			token: wrongValue,
+			err:   things.ErrUnauthorizedAccess,
 		},
-		"non-existing chan": {
-			token:   ths[0].Key,
-			channel: wrongValue,
-			err:     things.ErrEntityConnected,
+		"view non-existing channel": {
+			id:    wrongID,
+			token: token,
+			err:   things.ErrNotFound,
 		},
-		"non-connected channel": {
-			token:   ths[0].Key,
-			channel: chs[1].ID,
-			err:     things.ErrEntityConnected,
+		"view channel with metadata": {
+			id:    wrongID,
+			token: token,
+			err:   things.ErrNotFound,
 		},
 	}
 
 	for desc, tc := range cases {
-		_, err := svc.CanAccessByKey(context.Background(), tc.channel, tc.token)
-		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected '%s' got '%s'\n", desc, tc.err, err))
+		_, err := svc.ViewChannel(context.Background(), tc.token, tc.id)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s\n", desc, tc.err, err))
 	}
 }
 
-func TestCanAccessByID(t *testing.T) {
+func TestListChannels(t *testing.T) {
 	svc := newService(map[string]string{token: email})
-
-	ths, err := svc.CreateThings(context.Background(), token, thing, thing)
-	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
-	th := ths[0]
-	chs, err := svc.CreateChannels(context.Background(), token, channel)
-	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
-	ch := chs[0]
-	err = svc.Connect(context.Background(), token, []string{ch.ID}, []string{th.ID})
-	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
-
+	meta := things.Metadata{}
+	meta["name"] = "test-channel"
+	channel.Metadata = meta
+	n := uint64(10)
+	for i := uint64(0); i < n; i++ {
+		svc.CreateChannels(context.Background(), token, channel)
+	}
 	cases := map[string]struct {
-		thingID string
-		channel string
-		err     error
+		token    string
+		pageMetadata things.PageMetadata
+		size     uint64
+		err      error
 	}{
-		"allowed access": {
-			thingID: th.ID,
-			channel: ch.ID,
-			err:     nil,
+		"list all channels": {
+			token: token,
+			pageMetadata: things.PageMetadata{
+				Offset: 0,
+				Limit:  n,
+			},
+			size: n,
+			err:  nil,
 		},
-		"access to non-existing thing": {
-			thingID: wrongValue,
-			channel: ch.ID,
-			err:     things.ErrEntityConnected,
+		"list half": {
+			token: token,
+			pageMetadata: things.PageMetadata{
+				Offset: n / 2,
+				Limit:  n,
+			},
+			size: n / 2,
+			err:  nil,
 		},
-		"access to non-existing channel": {
-			thingID: th.ID,
-			channel: wrongID,
-			err:     things.ErrEntityConnected,
+		"list last channel": {
+			token: token,
+			pageMetadata: things.PageMetadata{
+				Offset: n - 1,
+				Limit:  n,
+			},
+			size: 1,
+			err:  nil,
 		},
-		"access to not-connected thing": {
-			thingID: ths[1].ID,
-			channel: ch.ID,
-			err:     things.ErrEntityConnected,
+		"list empty set": {
+			token: token,
+			pageMetadata: things.PageMetadata{
+				Offset: n + 1,
+				Limit:  n,
+			},
+			size: 0,
+			err:  nil,
+		},
+		"list with zero limit": {
+			token: token,
+			pageMetadata: things.PageMetadata{
+				Offset: 1,
+				Limit:  0,
+			},
+			size: 0,
+			err:  nil,
+		},
+		"list with wrong credentials": {
+			token: wrongValue,
+			pageMetadata: things.PageMetadata{
+				Offset: 0,
+				Limit:  0,
+			},
+			size: 0,
+			err:  things.ErrUnauthorizedAccess,
+		},
+		"list with existing name": {
+			token: token,
+			pageMetadata: things.PageMetadata{
+				Offset: 0,
+				Limit:  n,
+				Name:   "chanel_name",
+			},
+			size: n,
+			err:  nil,
+		},
+		"list with non-existent name": {
+			token: token,
+			pageMetadata: things.PageMetadata{
+				Offset: 0,
+				Limit:  n,
+				Name:   "wrong",
+			},
+			size: n,
+			err:  nil,
+		},
+		"list all channels with metadata": {
+			token: token,
+			pageMetadata: things.PageMetadata{
+				Offset:   0,
+				Limit:    n,
+				Metadata: meta,
+			},
+			size: n,
+			err:  nil,
 		},
 	}
 
 	for desc, tc := range cases {
-		err := svc.CanAccessByID(context.Background(), tc.channel, tc.thingID)
+		page, err := svc.ListChannels(context.Background(), tc.token, tc.pageMetadata)
+		size := uint64(len(page.Channels))
+		assert.Equal(t, tc.size, size, fmt.Sprintf("%s: expected %d got %d\n", desc, tc.size, size))
 		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s\n", desc, tc.err, err))
 	}
 }
 
-func TestIdentify(t *testing.T) {
+func TestListChannelsByThing(t *testing.T) {
 	svc := newService(map[string]string{token: email})
 
 	ths, err := svc.CreateThings(context.Background(), token, thing)
-	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
 	th := ths[0]
 
+	n := uint64(10)
+	chsDisconNum := uint64(1)
+
+	for i := uint64(0); i < n; i++ {
+		schs, err := svc.CreateChannels(context.Background(), token, channel)
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+		sch := schs[0]
+
+		// Don't connect last Channel
+		if i == n-chsDisconNum {
+			break
+		}
+
+		err = svc.Connect(context.Background(), token, []string{sch.ID}, []string{th.ID})
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+	}
+
+	// Wait for things and channels to connect.
+	time.Sleep(time.Second)
+
 	cases := map[string]struct {
-		token string
-		id    string
-		err   error
+		token     string
+		thing     string
+		offset    uint64
+		limit     uint64
+		connected bool
+		size      uint64
+		err       error
 	}{
-		"identify existing thing": {
-			token: th.Key,
-			id:    th.ID,
-			err:   nil,
+		"list all channels by existing thing": {
+			token:     token,
+			thing:     th.ID,
+			offset:    0,
+			limit:     n,
+			connected: true,
+			size:      n - chsDisconNum,
+			err:       nil,
 		},
-		"identify non-existing thing": {
-			token: wrongValue,
-			id:    wrongID,
-			err:   things.ErrNotFound,
+		"list half of channels by existing thing": {
+			token:     token,
+			thing:     th.ID,
+			offset:    n / 2,
+			limit:     n,
+			connected: true,
+			size:      (n / 2) - chsDisconNum,
+			err:       nil,
+		},
+		"list last channel by existing thing": {
+			token:     token,
+			thing:     th.ID,
+			offset:    n - 1 - chsDisconNum,
+			limit:     n,
+			connected: true,
+			size:      1,
+			err:       nil,
+		},
+		"list empty set of channels by existing thing": {
+			token:     token,
+			thing:     th.ID,
+			offset:    n + 1,
+			limit:     n,
+			connected: true,
+			size:      0,
+			err:       nil,
+		},
+		"list channels by existing thing with zero limit": {
+			token:     token,
+			thing:     th.ID,
+			offset:    1,
+			limit:     0,
+			connected: true,
+			size:      0,
+			err:       nil,
+		},
+		"list channels by existing thing with wrong credentials": {
+			token:     wrongValue,
+			thing:     th.ID,
+			offset:    0,
+			limit:     0,
+			connected: true,
+			size:      0,
+			err:       things.ErrUnauthorizedAccess,
+		},
+		"list channels by non-existent thing": {
+			token:     token,
+			thing:     "non-existent",
+			offset:    0,
+			limit:     10,
+			connected: true,
+			size:      0,
+			err:       nil,
+		},
+		"list all non connected channels by existing thing": {
+			token:     token,
+			thing:     th.ID,
+			offset:    0,
+			limit:     n,
+			connected: false,
+			size:      chsDisconNum,
+			err:       nil,
 		},
 	}
 
 	for desc, tc := range cases {
-		id, err := svc.Identify(context.Background(), tc.token)
-		assert.Equal(t, tc.id, id, fmt.Sprintf("%s: expected %s got %s\n", desc, tc.id, id))
+		page, err := svc.ListChannelsByThing(context.Background(), tc.token, tc.thing, tc.offset, tc.limit, tc.connected)
+		size := uint64(len(page.Channels))
+		assert.Equal(t, tc.size, size, fmt.Sprintf("%s: expected %d got %d\n", desc, tc.size, size))
 		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s\n", desc, tc.err, err))
 	}
 }
+
+func TestRemoveChannel(t *testing.T) {
+	svc := newService(map[string]string{token: email})
+	chs, err := svc.CreateChannels(context.Background(), token, channel)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+	ch := chs[0]
+
+	cases := []struct {
+		desc  string
+		id    string
+		token string
+		err   error
+	}{
+		{
+			desc:  "remove channel with wrong credentials",
+			id:    ch.ID,
+			token: wrongValue,
+			err:   things.ErrUnauthorizedAccess,
+		},
+		{
+			desc:  "remove existing channel",
+			id:    ch.ID,
+			token: token,
+			err:   nil,
+		},
+		{
+			desc:  "remove removed channel",
+			id:    ch.ID,
+			token: token,
+			err:   nil,
+		},
+		{
+			desc:  "remove non-existing channel",
+			id:    ch.ID,
+			token: token,
+			err:   nil,
+		},
+	}
+
+	for _, tc := range cases {
+		err := svc.RemoveChannel(context.Background(), tc.token, tc.id)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s\n", tc.desc, tc.err, err))
+	}
+}
+
+func TestConnect(t *testing.T) {
+	svc := newService(map[string]string{token: email})
+
+	ths, err := svc.CreateThings(context.Background(), token, thing)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+	th := ths[0]
+	chs, err := svc.CreateChannels(context.Background(), token, channel)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+	ch := chs[0]
+
+	cases := []struct {
+		desc    string
+		token   string
+		chanID  string
+		thingID string
+		err     error
+	}{
+		{
+			desc:    "connect thing",
+			token:   token,
+			chanID:  ch.ID,
+			thingID: th.ID,
+			err:     nil,
+		},
+		{
+			desc:    "connect thing with wrong credentials",
+			token:   wrongValue,
+			chanID:  ch.ID,
+			thingID: th.ID,
+			err:     things.ErrUnauthorizedAccess,
+		},
+		{
+			desc:    "connect thing to non-existing channel",
+			token:   token,
+			chanID:  wrongID,
+			thingID: th.ID,
+			err:     things.ErrNotFound,
+		},
+		{
+			desc:    "connect non-existing thing to channel",
+			token:   token,
+			chanID:  ch.ID,
+			thingID: wrongID,
+			err:     things.ErrNotFound,
+		},
+	}
+
+	for _, tc := range cases {
+		err := svc.Connect(context.Background(), tc.token, []string{tc.chanID}, []string{tc.thingID})
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s\n", tc.desc, tc.err, err))
+	}
+}
+
+func TestConnectLimit(t *testing.T) {
+	auth := mocks.NewAuthService(map[string]string{token: email})
+	conns := make(chan mocks.Connection)
+	thingsRepo := mocks.NewThingRepository(conns)
+	channelsRepo := mocks.NewChannelRepository(thingsRepo, conns)
+	cfg := things.Config{ChannelThingsLimit: 3}
+	svc := things.NewWithConfig(auth, thingsRepo, channelsRepo, mocks.NewGroupRepository(), mocks.NewChannelCache(), mocks.NewThingCache(), uuid.NewMock(), cfg)
+
+	ths, err := svc.CreateThings(context.Background(), token, thing, thing, thing, thing, thing, thing)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+	chs, err := svc.CreateChannels(context.Background(), token, channel, channel)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+
+	gID, err := svc.CreateGroup(context.Background(), token, groups.Group{
+		Name:     "gateways",
+		Metadata: groups.Metadata{things.ChannelThingsLimitKey: float64(2)},
+	})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+	for _, th := range ths[4:] {
+		err := svc.Assign(context.Background(), token, th.ID, gID)
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+	}
+
+	cases := []struct {
+		desc   string
+		chanID string
+		ths    []things.Thing
+		err    error
+	}{
+		{
+			desc:   "connect things under the global limit",
+			chanID: chs[0].ID,
+			ths:    ths[:2],
+			err:    nil,
+		},
+		{
+			desc:   "connect things over the global limit",
+			chanID: chs[0].ID,
+			ths:    ths[2:4],
+			err:    things.ErrChannelFull,
+		},
+		{
+			desc:   "connect thing up to the global limit",
+			chanID: chs[0].ID,
+			ths:    ths[2:3],
+			err:    nil,
+		},
+		{
+			desc:   "connect group things under the group limit",
+			chanID: chs[1].ID,
+			ths:    ths[4:],
+			err:    nil,
+		},
+		{
+			desc:   "connect thing without group to channel of group things",
+			chanID: chs[1].ID,
+			ths:    ths[:1],
+			err:    nil,
+		},
+		{
+			desc:   "connect group thing over the group limit",
+			chanID: chs[0].ID,
+			ths:    ths[4:5],
+			err:    things.ErrChannelFull,
+		},
+	}
+
+	for _, tc := range cases {
+		var thIDs []string
+		for _, th := range tc.ths {
+			thIDs = append(thIDs, th.ID)
+		}
+		err := svc.Connect(context.Background(), token, []string{tc.chanID}, thIDs)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s\n", tc.desc, tc.err, err))
+	}
+}
+
+func TestConnectStrictGroups(t *testing.T) {
+	cases := []struct {
+		desc     string
+		strict   bool
+		channels []string
+		thing    string
+		err      error
+	}{
+		{
+			desc:     "connect thing to channel of same group",
+			strict:   true,
+			channels: []string{"a"},
+			thing:    "a",
+			err:      nil,
+		},
+		{
+			desc:     "connect thing to channel of other group",
+			strict:   true,
+			channels: []string{"b"},
+			thing:    "a",
+			err:      things.ErrGroupMismatch,
+		},
+		{
+			desc:     "connect thing to channels of same and other group",
+			strict:   true,
+			channels: []string{"a", "b"},
+			thing:    "a",
+			err:      things.ErrGroupMismatch,
+		},
+		{
+			desc:     "connect thing to channel of allowed group",
+			strict:   true,
+			channels: []string{"c"},
+			thing:    "b",
+			err:      nil,
+		},
+		{
+			desc:     "connect thing to channel without group",
+			strict:   true,
+			channels: []string{"none"},
+			thing:    "a",
+			err:      things.ErrGroupMismatch,
+		},
+		{
+			desc:     "connect thing without group to channel without group",
+			strict:   true,
+			channels: []string{"none"},
+			thing:    "none",
+			err:      nil,
+		},
+		{
+			desc:     "connect thing to channel of other group without strict groups",
+			strict:   false,
+			channels: []string{"b"},
+			thing:    "a",
+			err:      nil,
+		},
+	}
+
+	for _, tc := range cases {
+		auth := mocks.NewAuthService(map[string]string{token: email})
+		conns := make(chan mocks.Connection)
+		// Group memberships are keyed by the member ID, so the things are
+		// identified apart from the sequentially numbered channels.
+		thingsRepo := mocks.NewThingRepositoryWithIDs(conns, uuid.NewMock())
+		channelsRepo := mocks.NewChannelRepository(thingsRepo, conns)
+		groupsRepo := mocks.NewGroupRepository()
+		cfg := things.Config{
+			StrictGroups: tc.strict,
+			CrossGroups:  map[string][]string{"group-b": {"group-c"}},
+		}
+		svc := things.NewWithConfig(auth, thingsRepo, channelsRepo, groupsRepo, mocks.NewChannelCache(), mocks.NewThingCache(), uuid.NewMock(), cfg)
+
+		ths, err := svc.CreateThings(context.Background(), token, thing, thing, thing)
+		require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s\n", tc.desc, err))
+		chs, err := svc.CreateChannels(context.Background(), token, channel, channel, channel, channel)
+		require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s\n", tc.desc, err))
+		thIDs := map[string]string{"a": ths[0].ID, "b": ths[1].ID, "none": ths[2].ID}
+		chIDs := map[string]string{"a": chs[0].ID, "b": chs[1].ID, "c": chs[2].ID, "none": chs[3].ID}
+
+		for _, name := range []string{"a", "b", "c"} {
+			g, err := groupsRepo.Save(context.Background(), groups.Group{ID: "group-" + name, Name: name})
+			require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s\n", tc.desc, err))
+			for _, id := range []string{thIDs[name], chIDs[name]} {
+				if id == "" {
+					continue
+				}
+				err := groupsRepo.Assign(context.Background(), id, g.ID)
+				require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s\n", tc.desc, err))
+			}
+		}
+
+		var ids []string
+		for _, ch := range tc.channels {
+			ids = append(ids, chIDs[ch])
+		}
+		err = svc.Connect(context.Background(), token, ids, []string{thIDs[tc.thing]})
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s\n", tc.desc, tc.err, err))
+	}
+}
+
+func TestDisconnect(t *testing.T) {
+	svc := newService(map[string]string{token: email})
+
+	ths, err := svc.CreateThings(context.Background(), token, thing)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+	th := ths[0]
+	chs, err := svc.CreateChannels(context.Background(), token, channel)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+	ch := chs[0]
+	err = svc.Connect(context.Background(), token, []string{ch.ID}, []string{th.ID})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+
+	cases := []struct {
+		desc    string
+		token   string
+		chanID  string
+		thingID string
+		err     error
+	}{
+		{
+			desc:    "disconnect connected thing",
+			token:   token,
+			chanID:  ch.ID,
+			thingID: th.ID,
+			err:     nil,
+		},
+		{
+			desc:    "disconnect disconnected thing",
+			token:   token,
+			chanID:  ch.ID,
+			thingID: th.ID,
+			err:     things.ErrNotFound,
+		},
+		{
+			desc:    "disconnect with wrong credentials",
+			token:   wrongValue,
+			chanID:  ch.ID,
+			thingID: th.ID,
+			err:     things.ErrUnauthorizedAccess,
+		},
+		{
+			desc:    "disconnect from non-existing channel",
+			token:   token,
+			chanID:  wrongID,
+			thingID: th.ID,
+			err:     things.ErrNotFound,
+		},
+		{
+			desc:    "disconnect non-existing thing",
+			token:   token,
+			chanID:  ch.ID,
+			thingID: wrongID,
+			err:     things.ErrNotFound,
+		},
+	}
+
+	for _, tc := range cases {
+		err := svc.Disconnect(context.Background(), tc.token, tc.chanID, tc.thingID)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s\n", tc.desc, tc.err, err))
+	}
+
+}
+
+func TestConnectionEvents(t *testing.T) {
+	otherToken := "other-token"
+	auth := mocks.NewAuthService(map[string]string{token: email, otherToken: "other@example.com"})
+	conns := make(chan mocks.Connection)
+	thingsRepo := mocks.NewThingRepository(conns)
+	channelsRepo := mocks.NewChannelRepository(thingsRepo, conns)
+	cfg := things.Config{ConnectionEvents: mocks.NewConnectionEventRepository()}
+	svc := things.NewWithConfig(auth, thingsRepo, channelsRepo, nil, mocks.NewChannelCache(), mocks.NewThingCache(), uuid.NewMock(), cfg)
+
+	ths, err := svc.CreateThings(context.Background(), token, thing, thing)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+	chs, err := svc.CreateChannels(context.Background(), token, channel)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+	th, other, ch := ths[0], ths[1], chs[0]
+
+	err = svc.Connect(context.Background(), token, []string{ch.ID}, []string{th.ID, other.ID})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+	err = svc.Disconnect(context.Background(), token, ch.ID, th.ID)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+	err = svc.Connect(context.Background(), token, []string{ch.ID}, []string{th.ID})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+	err = svc.Disconnect(context.Background(), token, ch.ID, wrongID)
+	assert.NotNil(t, err, "expected failed disconnect not to be recorded")
+
+	cases := []struct {
+		desc   string
+		list   func(ctx context.Context, token, id string, offset, limit uint64) (things.ConnectionEventsPage, error)
+		token  string
+		id     string
+		offset uint64
+		limit  uint64
+		events []things.ConnectionEvent
+		total  uint64
+		err    error
+	}{
+		{
+			desc:   "list connection events of thing",
+			list:   svc.ListConnectionEventsByThing,
+			token:  token,
+			id:     th.ID,
+			offset: 0,
+			limit:  10,
+			events: []things.ConnectionEvent{
+				{ChannelID: ch.ID, ThingID: th.ID, Type: things.ConnectEvent},
+				{ChannelID: ch.ID, ThingID: th.ID, Type: things.DisconnectEvent},
+				{ChannelID: ch.ID, ThingID: th.ID, Type: things.ConnectEvent},
+			},
+			total: 3,
+			err:   nil,
+		},
+		{
+			desc:   "list connection events of channel",
+			list:   svc.ListConnectionEventsByChannel,
+			token:  token,
+			id:     ch.ID,
+			offset: 0,
+			limit:  10,
+			events: []things.ConnectionEvent{
+				{ChannelID: ch.ID, ThingID: th.ID, Type: things.ConnectEvent},
+				{ChannelID: ch.ID, ThingID: other.ID, Type: things.ConnectEvent},
+				{ChannelID: ch.ID, ThingID: th.ID, Type: things.DisconnectEvent},
+				{ChannelID: ch.ID, ThingID: th.ID, Type: things.ConnectEvent},
+			},
+			total: 4,
+			err:   nil,
+		},
+		{
+			desc:   "list connection events of channel with offset and limit",
+			list:   svc.ListConnectionEventsByChannel,
+			token:  token,
+			id:     ch.ID,
+			offset: 1,
+			limit:  2,
+			events: []things.ConnectionEvent{
+				{ChannelID: ch.ID, ThingID: other.ID, Type: things.ConnectEvent},
+				{ChannelID: ch.ID, ThingID: th.ID, Type: things.DisconnectEvent},
+			},
+			total: 4,
+			err:   nil,
+		},
+		{
+			desc:   "list connection events of thing of other user",
+			list:   svc.ListConnectionEventsByThing,
+			token:  otherToken,
+			id:     th.ID,
+			offset: 0,
+			limit:  10,
+			events: []things.ConnectionEvent{},
+			total:  0,
+			err:    nil,
+		},
+		{
+			desc:   "list connection events with wrong credentials",
+			list:   svc.ListConnectionEventsByThing,
+			token:  wrongValue,
+			id:     th.ID,
+			offset: 0,
+			limit:  10,
+			events: nil,
+			total:  0,
+			err:    things.ErrUnauthorizedAccess,
+		},
+	}
+
+	for _, tc := range cases {
+		page, err := tc.list(context.Background(), tc.token, tc.id, tc.offset, tc.limit)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s\n", tc.desc, tc.err, err))
+		assert.Equal(t, tc.total, page.Total, fmt.Sprintf("%s: expected total %d got %d\n", tc.desc, tc.total, page.Total))
+		require.Equal(t, len(tc.events), len(page.Events), fmt.Sprintf("%s: expected %d events got %d\n", tc.desc, len(tc.events), len(page.Events)))
+		for i, e := range page.Events {
+			want := tc.events[i]
+			got := things.ConnectionEvent{ChannelID: e.ChannelID, ThingID: e.ThingID, Type: e.Type}
+			assert.Equal(t, want, got, fmt.Sprintf("%s: expected event %v got %v\n", tc.desc, want, got))
+			assert.Equal(t, email, e.Actor, fmt.Sprintf("%s: expected actor %s got %s\n", tc.desc, email, e.Actor))
+			if i > 0 {
+				assert.False(t, e.Timestamp.Before(page.Events[i-1].Timestamp), fmt.Sprintf("%s: expected events in chronological order\n", tc.desc))
+			}
+		}
+	}
+}
+
+func TestCanAccessByKey(t *testing.T) {
+	svc := newService(map[string]string{token: email})
+
+	ths, err := svc.CreateThings(context.Background(), token, thing)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+	chs, err := svc.CreateChannels(context.Background(), token, channel, channel)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+	err = svc.Connect(context.Background(), token, []string{chs[0].ID}, []string{ths[0].ID})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+
+	cases := map[string]struct {
+		token   string
+		channel string
+		err     error
+	}{
+		"allowed access": {
+			token:   ths[0].Key,
+			channel: chs[0].ID,
+			err:     nil,
+		},
+		"non-existing thing": {
+			token:   wrongValue,
+			channel: chs[0].ID,
+			err:     things.ErrNotFound,
+		},
+		"non-existing chan": {
+			token:   ths[0].Key,
+			channel: wrongValue,
+			err:     things.ErrEntityConnected,
+		},
+		"non-connected channel": {
+			token:   ths[0].Key,
+			channel: chs[1].ID,
+			err:     things.ErrEntityConnected,
+		},
+	}
+
+	for desc, tc := range cases {
+		_, err := svc.CanAccessByKey(context.Background(), tc.channel, tc.token)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected '%s' got '%s'\n", desc, tc.err, err))
+	}
+}
+
+func TestCanAccessByID(t *testing.T) {
+	svc := newService(map[string]string{token: email})
+
+	ths, err := svc.CreateThings(context.Background(), token, thing, thing)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+	th := ths[0]
+	chs, err := svc.CreateChannels(context.Background(), token, channel)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+	ch := chs[0]
+	err = svc.Connect(context.Background(), token, []string{ch.ID}, []string{th.ID})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+
+	cases := map[string]struct {
+		thingID string
+		channel string
+		err     error
+	}{
+		"allowed access": {
+			thingID: th.ID,
+			channel: ch.ID,
+			err:     nil,
+		},
+		"access to non-existing thing": {
+			thingID: wrongValue,
+			channel: ch.ID,
+			err:     things.ErrEntityConnected,
+		},
+		"access to non-existing channel": {
+			thingID: th.ID,
+			channel: wrongID,
+			err:     things.ErrEntityConnected,
+		},
+		"access to not-connected thing": {
+			thingID: ths[1].ID,
+			channel: ch.ID,
+			err:     things.ErrEntityConnected,
+		},
+	}
+
+	for desc, tc := range cases {
+		err := svc.CanAccessByID(context.Background(), tc.channel, tc.thingID)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s\n", desc, tc.err, err))
+	}
+}
+
+func TestIdentify(t *testing.T) {
+	svc := newService(map[string]string{token: email})
+
+	ths, err := svc.CreateThings(context.Background(), token, thing)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+	th := ths[0]
+
+	cases := map[string]struct {
+		token string
+		id    string
+		err   error
+	}{
+		"identify existing thing": {
+			token: th.Key,
+			id:    th.ID,
+			err:   nil,
+		},
+		"identify non-existing thing": {
+			token: wrongValue,
+			id:    wrongID,
+			err:   things.ErrNotFound,
+		},
+	}
+
+	for desc, tc := range cases {
+		id, err := svc.Identify(context.Background(), tc.token)
+		assert.Equal(t, tc.id, id, fmt.Sprintf("%s: expected %s got %s\n", desc, tc.id, id))
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s\n", desc, tc.err, err))
+	}
+}
+
+func TestIdentifyByAnyKey(t *testing.T) {
+	svc := newService(map[string]string{token: email})
+
+	th := things.Thing{Name: "gateway", Key: "slot-a", Keys: []string{"slot-b", "slot-c"}}
+	ths, err := svc.CreateThings(context.Background(), token, th)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+	th = ths[0]
+
+	for _, key := range []string{"slot-a", "slot-b", "slot-c"} {
+		id, err := svc.Identify(context.Background(), key)
+		assert.Nil(t, err, fmt.Sprintf("identify thing by key %s: unexpected error: %s\n", key, err))
+		assert.Equal(t, th.ID, id, fmt.Sprintf("identify thing by key %s: expected %s got %s\n", key, th.ID, id))
+	}
+
+	cases := []struct {
+		desc  string
+		thing things.Thing
+		err   error
+	}{
+		{
+			desc:  "create thing with primary key of another thing's additional key",
+			thing: things.Thing{Key: "slot-b"},
+			err:   things.ErrConflict,
+		},
+		{
+			desc:  "create thing with additional key of another thing's primary key",
+			thing: things.Thing{Key: "other", Keys: []string{"slot-a"}},
+			err:   things.ErrConflict,
+		},
+		{
+			desc:  "create thing with additional key of another thing's additional key",
+			thing: things.Thing{Key: "other", Keys: []string{"slot-c"}},
+			err:   things.ErrConflict,
+		},
+		{
+			desc:  "create thing with unique keys",
+			thing: things.Thing{Key: "other", Keys: []string{"other-b"}},
+			err:   nil,
+		},
+	}
+
+	for _, tc := range cases {
+		_, err := svc.CreateThings(context.Background(), token, tc.thing)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s\n", tc.desc, tc.err, err))
+	}
+
+	err = svc.UpdateKey(context.Background(), token, th.ID, "other-b")
+	assert.True(t, errors.Contains(err, things.ErrConflict), fmt.Sprintf("update key to another thing's additional key: expected %s got %s\n", things.ErrConflict, err))
+}
+
+func TestIdentifyTemporaryKey(t *testing.T) {
+	now := time.Now()
+	conns := make(chan mocks.Connection)
+	thingsRepo := mocks.NewThingRepositoryWithClock(conns, func() time.Time { return now })
+	thingCache := mocks.NewThingCache()
+	svc := things.New(mocks.NewAuthService(map[string]string{token: email}), thingsRepo, mocks.NewChannelRepository(thingsRepo, conns), nil, mocks.NewChannelCache(), thingCache, uuid.NewMock())
+
+	ths, err := svc.CreateThings(context.Background(), token, thing)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+	th := ths[0]
+	chs, err := svc.CreateChannels(context.Background(), token, channel)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+	err = svc.Connect(context.Background(), token, []string{chs[0].ID}, []string{th.ID})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+
+	key := "temporary-key"
+	err = thingsRepo.SaveTemporaryKey(context.Background(), email, th.ID, key, now.Add(time.Minute))
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+
+	cases := []struct {
+		desc    string
+		advance time.Duration
+		id      string
+		err     error
+	}{
+		{
+			desc:    "identify thing with temporary key before expiry",
+			advance: 0,
+			id:      th.ID,
+			err:     nil,
+		},
+		{
+			desc:    "identify thing with expired temporary key",
+			advance: time.Minute,
+			id:      "",
+			err:     things.ErrAuthorization,
+		},
+	}
+
+	for _, tc := range cases {
+		now = now.Add(tc.advance)
+		id, err := svc.Identify(context.Background(), key)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s\n", tc.desc, tc.err, err))
+		assert.Equal(t, tc.id, id, fmt.Sprintf("%s: expected id %s got %s\n", tc.desc, tc.id, id))
+		id, err = svc.CanAccessByKey(context.Background(), chs[0].ID, key)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected access error %s got %s\n", tc.desc, tc.err, err))
+		assert.Equal(t, tc.id, id, fmt.Sprintf("%s: expected access id %s got %s\n", tc.desc, tc.id, id))
+		_, err = thingCache.ID(context.Background(), key)
+		assert.True(t, errors.Contains(err, things.ErrNotFound), fmt.Sprintf("%s: expected temporary key not to be cached, got %s\n", tc.desc, err))
+	}
+}
+
+// connsCounter counts the connections retrieved by thing from the wrapped
+// repository.
+type connsCounter struct {
+	things.ChannelRepository
+	reads int
+}
+
+func (cc *connsCounter) RetrieveConnectionsByThing(ctx context.Context, thingID string) ([]string, error) {
+	cc.reads++
+	return cc.ChannelRepository.RetrieveConnectionsByThing(ctx, thingID)
+}
+
+func TestConnectionsByKey(t *testing.T) {
+	auth := mocks.NewAuthService(map[string]string{token: email})
+	conns := make(chan mocks.Connection)
+	thingsRepo := mocks.NewThingRepository(conns)
+	cc := &connsCounter{ChannelRepository: mocks.NewChannelRepository(thingsRepo, conns)}
+	svc := things.New(auth, thingsRepo, cc, nil, mocks.NewChannelCache(), mocks.NewThingCache(), uuid.NewMock())
+
+	ths, err := svc.CreateThings(context.Background(), token, thing)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+	th := ths[0]
+	chs, err := svc.CreateChannels(context.Background(), token, channel, channel)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+	err = svc.Connect(context.Background(), token, []string{chs[0].ID}, []string{th.ID})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+
+	cases := []struct {
+		desc    string
+		key     string
+		prepare func() error
+		chIDs   []string
+		reads   int
+		err     error
+	}{
+		{
+			desc:  "retrieve connections from repository",
+			key:   th.Key,
+			chIDs: []string{chs[0].ID},
+			reads: 1,
+			err:   nil,
+		},
+		{
+			desc:  "retrieve connections from cache",
+			key:   th.Key,
+			chIDs: []string{chs[0].ID},
+			reads: 1,
+			err:   nil,
+		},
+		{
+			desc: "retrieve connections after connecting",
+			key:  th.Key,
+			prepare: func() error {
+				return svc.Connect(context.Background(), token, []string{chs[1].ID}, []string{th.ID})
+			},
+			chIDs: []string{chs[0].ID, chs[1].ID},
+			reads: 2,
+			err:   nil,
+		},
+		{
+			desc: "retrieve connections after disconnecting",
+			key:  th.Key,
+			prepare: func() error {
+				return svc.Disconnect(context.Background(), token, chs[0].ID, th.ID)
+			},
+			chIDs: []string{chs[1].ID},
+			reads: 3,
+			err:   nil,
+		},
+		{
+			desc:  "retrieve connections of non-existing thing",
+			key:   wrongValue,
+			chIDs: nil,
+			reads: 3,
+			err:   things.ErrNotFound,
+		},
+	}
+
+	for _, tc := range cases {
+		if tc.prepare != nil {
+			err := tc.prepare()
+			require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s\n", tc.desc, err))
+		}
+		chIDs, err := svc.ConnectionsByKey(context.Background(), tc.key)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s\n", tc.desc, tc.err, err))
+		assert.ElementsMatch(t, tc.chIDs, chIDs, fmt.Sprintf("%s: expected %v got %v\n", tc.desc, tc.chIDs, chIDs))
+		assert.Equal(t, tc.reads, cc.reads, fmt.Sprintf("%s: expected %d repository reads got %d\n", tc.desc, tc.reads, cc.reads))
+	}
+}
+
+func TestRebuildConnectionCache(t *testing.T) {
+	otherToken := "other-token"
+	auth := mocks.NewAuthService(map[string]string{token: email, otherToken: "other@example.com"})
+	conns := make(chan mocks.Connection)
+	thingsRepo := mocks.NewThingRepository(conns)
+	channelsRepo := mocks.NewChannelRepository(thingsRepo, conns)
+	chanCache := mocks.NewChannelCache()
+	svc := things.NewWithConfig(auth, thingsRepo, channelsRepo, nil, chanCache, mocks.NewThingCache(), uuid.NewMock(), things.Config{AdminEmail: email})
+
+	ths, err := svc.CreateThings(context.Background(), token, things.Thing{Name: "a"}, things.Thing{Name: "b"})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+	chs, err := svc.CreateChannels(context.Background(), token, things.Channel{Name: "a"}, things.Channel{Name: "b"}, things.Channel{Name: "c"})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+
+	err = svc.Connect(context.Background(), token, []string{chs[0].ID}, []string{ths[0].ID})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+	err = svc.Connect(context.Background(), token, []string{chs[1].ID}, []string{ths[1].ID})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+
+	// Corrupt the cache with a valid, a missing, and a stale entry.
+	err = chanCache.Connect(context.Background(), chs[0].ID, ths[0].ID)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+	err = chanCache.Connect(context.Background(), chs[2].ID, ths[1].ID)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+
+	cases := []struct {
+		desc  string
+		token string
+		rep   things.CacheReport
+		err   error
+	}{
+		{
+			desc:  "rebuild connection cache with wrong credentials",
+			token: wrongValue,
+			rep:   things.CacheReport{},
+			err:   things.ErrUnauthorizedAccess,
+		},
+		{
+			desc:  "rebuild connection cache as non-admin user",
+			token: otherToken,
+			rep:   things.CacheReport{},
+			err:   things.ErrAuthorization,
+		},
+		{
+			desc:  "rebuild corrupted connection cache",
+			token: token,
+			rep:   things.CacheReport{Added: 1, Removed: 1},
+			err:   nil,
+		},
+		{
+			desc:  "rebuild consistent connection cache",
+			token: token,
+			rep:   things.CacheReport{},
+			err:   nil,
+		},
+	}
+
+	for _, tc := range cases {
+		rep, err := svc.RebuildConnectionCache(context.Background(), tc.token)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s\n", tc.desc, tc.err, err))
+		assert.Equal(t, tc.rep, rep, fmt.Sprintf("%s: expected %v got %v\n", tc.desc, tc.rep, rep))
+	}
+
+	stored, err := channelsRepo.RetrieveAllConnections(context.Background())
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+	cached, err := chanCache.RetrieveAll(context.Background())
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+	assert.ElementsMatch(t, stored, cached, fmt.Sprintf("expected cache %v to match repository %v\n", cached, stored))
+}
+
+func TestCountAll(t *testing.T) {
+	otherToken, otherEmail := "other-token", "other@example.com"
+	auth := mocks.NewAuthService(map[string]string{token: email, otherToken: otherEmail})
+	conns := make(chan mocks.Connection)
+	thingsRepo := mocks.NewThingRepository(conns)
+	channelsRepo := mocks.NewChannelRepository(thingsRepo, conns)
+	svc := things.NewWithConfig(auth, thingsRepo, channelsRepo, nil, mocks.NewChannelCache(), mocks.NewThingCache(), uuid.NewMock(), things.Config{AdminEmail: email})
+
+	ths, err := svc.CreateThings(context.Background(), token, things.Thing{Name: "a"}, things.Thing{Name: "b"})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+	chs, err := svc.CreateChannels(context.Background(), token, channel, channel, channel)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+	otherThs, err := svc.CreateThings(context.Background(), otherToken, things.Thing{Name: "c"})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+	otherChs, err := svc.CreateChannels(context.Background(), otherToken, channel)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+
+	err = svc.Connect(context.Background(), token, []string{chs[0].ID}, []string{ths[0].ID, ths[1].ID})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+	err = svc.Connect(context.Background(), token, []string{chs[1].ID}, []string{ths[0].ID})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+	err = svc.Connect(context.Background(), otherToken, []string{otherChs[0].ID}, []string{otherThs[0].ID})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s\n", err))
+
+	cases := []struct {
+		desc     string
+		token    string
+		remove   func() error
+		things   uint64
+		channels uint64
+		conns    uint64
+		err      error
+	}{
+		{
+			desc:  "count with wrong credentials",
+			token: wrongValue,
+			err:   things.ErrUnauthorizedAccess,
+		},
+		{
+			desc:     "count entities of all users",
+			token:    token,
+			things:   3,
+			channels: 4,
+			conns:    4,
+		},
+		{
+			desc:  "count entities of all users as non-admin user",
+			token: otherToken,
+			err:   things.ErrAuthorization,
+		},
+		{
+			desc:  "count entities after removing connected thing",
+			token: token,
+			remove: func() error {
+				return svc.RemoveThing(context.Background(), token, ths[1].ID)
+			},
+			things:   2,
+			channels: 4,
+			conns:    3,
+		},
+		{
+			desc:  "count entities after removing connected channel",
+			token: token,
+			remove: func() error {
+				return svc.RemoveChannel(context.Background(), token, chs[1].ID)
+			},
+			things:   2,
+			channels: 3,
+			conns:    2,
+		},
+	}
+
+	for _, tc := range cases {
+		if tc.remove != nil {
+			err := tc.remove()
+			require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s\n", tc.desc, err))
+		}
+		ths, chs, conns, err := svc.CountAll(context.Background(), tc.token)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s\n", tc.desc, tc.err, err))
+		assert.Equal(t, tc.things, ths, fmt.Sprintf("%s: expected %d things got %d\n", tc.desc, tc.things, ths))
+		assert.Equal(t, tc.channels, chs, fmt.Sprintf("%s: expected %d channels got %d\n", tc.desc, tc.channels, chs))
+		assert.Equal(t, tc.conns, conns, fmt.Sprintf("%s: expected %d connections got %d\n", tc.desc, tc.conns, conns))
+	}
+}
+
+func TestReconcileGroups(t *testing.T) {
+	cases := []struct {
+		desc         string
+		token        string
+		defaultGroup bool
+		orphaned     int
+		reassigned   uint64
+		remaining    int
+		err          error
+	}{
+		{
+			desc:     "reconcile groups with wrong credentials",
+			token:    wrongValue,
+			orphaned: 0,
+			err:      things.ErrUnauthorizedAccess,
+		},
+		{
+			desc:      "report orphaned memberships",
+			token:     token,
+			orphaned:  2,
+			remaining: 2,
+			err:       nil,
+		},
+		{
+			desc:         "reassign orphaned memberships to default group",
+			token:        token,
+			defaultGroup: true,
+			orphaned:     2,
+			reassigned:   2,
+			remaining:    0,
+			err:          nil,
+		},
+	}
+
+	for _, tc := range cases {
+		auth := mocks.NewAuthService(map[string]string{token: email})
+		conns := make(chan mocks.Connection)
+		thingsRepo := mocks.NewThingRepository(conns)
+		channelsRepo := mocks.NewChannelRepository(thingsRepo, conns)
+		groupsRepo := mocks.NewGroupRepository()
+		svc := things.New(auth, thingsRepo, channelsRepo, groupsRepo, mocks.NewChannelCache(), mocks.NewThingCache(), uuid.NewMock())
+
+		ths, err := svc.CreateThings(context.Background(), token, things.Thing{Name: "a"}, things.Thing{Name: "b"}, things.Thing{Name: "c"})
+		require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s\n", tc.desc, err))
+
+		var gIDs []string
+		for _, name := range []string{"kept", "deleted", "default"} {
+			id, err := svc.CreateGroup(context.Background(), token, groups.Group{Name: name})
+			require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s\n", tc.desc, err))
+			gIDs = append(gIDs, id)
+		}
+		kept, deleted, def := gIDs[0], gIDs[1], gIDs[2]
+
+		for _, th := range ths[:2] {
+			err := svc.Assign(context.Background(), token, th.ID, deleted)
+			require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s\n", tc.desc, err))
+		}
+		err = svc.Assign(context.Background(), token, ths[2].ID, kept)
+		require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s\n", tc.desc, err))
+		err = svc.RemoveGroup(context.Background(), token, deleted)
+		require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s\n", tc.desc, err))
+
+		defaultGroupID := ""
+		if tc.defaultGroup {
+			defaultGroupID = def
+		}
+		rep, err := svc.ReconcileGroups(context.Background(), tc.token, defaultGroupID)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s\n", tc.desc, tc.err, err))
+		assert.Equal(t, tc.orphaned, len(rep.Orphaned), fmt.Sprintf("%s: expected %d orphaned got %d\n", tc.desc, tc.orphaned, len(rep.Orphaned)))
+		assert.Equal(t, tc.reassigned, rep.Reassigned, fmt.Sprintf("%s: expected %d reassigned got %d\n", tc.desc, tc.reassigned, rep.Reassigned))
+		for _, o := range rep.Orphaned {
+			assert.Equal(t, deleted, o.GroupID, fmt.Sprintf("%s: expected orphaned group %s got %s\n", tc.desc, deleted, o.GroupID))
+		}
+		if tc.err != nil {
+			continue
+		}
+
+		rep, err = svc.ReconcileGroups(context.Background(), tc.token, "")
+		require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s\n", tc.desc, err))
+		assert.Equal(t, tc.remaining, len(rep.Orphaned), fmt.Sprintf("%s: expected %d remaining orphaned got %d\n", tc.desc, tc.remaining, len(rep.Orphaned)))
+
+		if tc.defaultGroup {
+			mp, err := svc.ListMembers(context.Background(), token, def, 0, 10, nil)
+			require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s\n", tc.desc, err))
+			assert.Equal(t, uint64(2), mp.Total, fmt.Sprintf("%s: expected 2 default group members got %d\n", tc.desc, mp.Total))
+		}
+	}
+}
+
+func TestRetrieveGroupContents(t *testing.T) {
+	otherToken := "other-token"
+	auth := mocks.NewAuthService(map[string]string{token: email, otherToken: "other@example.com"})
+	conns := make(chan mocks.Connection)
+	thingsRepo := mocks.NewThingRepository(conns)
+	channelsRepo := mocks.NewChannelRepository(thingsRepo, conns)
+	groupsRepo := mocks.NewGroupRepository()
+	svc := things.New(auth, thingsRepo, channelsRepo, groupsRepo, mocks.NewChannelCache(), mocks.NewThingCache(), uuid.NewMock())
+
+	ths, err := svc.CreateThings(context.Background(), token, thing, thing, thing, thing, thing)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	chs, err := svc.CreateChannels(context.Background(), token, channel, channel, channel, channel, channel)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+
+	gID, err := svc.CreateGroup(context.Background(), token, groups.Group{Name: "dashboard"})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	otherID, err := svc.CreateGroup(context.Background(), token, groups.Group{Name: "other"})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+
+	for _, th := range ths[:4] {
+		err := svc.Assign(context.Background(), token, th.ID, gID)
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	}
+	err = svc.Assign(context.Background(), token, ths[4].ID, otherID)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+
+	// The group things are connected to the first three channels, one of
+	// them shared by two things. The fourth channel is connected only to
+	// the thing of the other group and the last one isn't connected.
+	connections := []struct {
+		chs []string
+		ths []string
+	}{
+		{chs: []string{chs[0].ID, chs[1].ID}, ths: []string{ths[0].ID}},
+		{chs: []string{chs[2].ID}, ths: []string{ths[1].ID, ths[2].ID}},
+		{chs: []string{chs[3].ID}, ths: []string{ths[4].ID}},
+	}
+	for _, c := range connections {
+		err := svc.Connect(context.Background(), token, c.chs, c.ths)
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	}
+
+	// Wait for things and channels to connect.
+	time.Sleep(time.Second)
+
+	ids := func(ths []things.Thing, chs []things.Channel) ([]string, []string) {
+		thIDs, chIDs := []string{}, []string{}
+		for _, th := range ths {
+			thIDs = append(thIDs, th.ID)
+		}
+		for _, ch := range chs {
+			chIDs = append(chIDs, ch.ID)
+		}
+		return thIDs, chIDs
+	}
+	groupThs, groupChs := ids(ths[:4], chs[:3])
+
+	cases := []struct {
+		desc        string
+		token       string
+		group       string
+		offset      uint64
+		limit       uint64
+		things      []string
+		channels    []string
+		thingsTotal uint64
+		chansTotal  uint64
+		err         error
+	}{
+		{
+			desc:        "retrieve all group contents",
+			token:       token,
+			group:       gID,
+			offset:      0,
+			limit:       10,
+			things:      groupThs,
+			channels:    groupChs,
+			thingsTotal: 4,
+			chansTotal:  3,
+			err:         nil,
+		},
+		{
+			desc:        "retrieve group contents page",
+			token:       token,
+			group:       gID,
+			offset:      1,
+			limit:       2,
+			things:      groupThs[1:3],
+			channels:    groupChs[1:3],
+			thingsTotal: 4,
+			chansTotal:  3,
+			err:         nil,
+		},
+		{
+			desc:        "retrieve group contents page past the channels",
+			token:       token,
+			group:       gID,
+			offset:      3,
+			limit:       2,
+			things:      groupThs[3:],
+			channels:    []string{},
+			thingsTotal: 4,
+			chansTotal:  3,
+			err:         nil,
+		},
+		{
+			desc:   "retrieve group contents with wrong credentials",
+			token:  wrongValue,
+			group:  gID,
+			offset: 0,
+			limit:  10,
+			err:    things.ErrUnauthorizedAccess,
+		},
+		{
+			desc:   "retrieve contents of group owned by another user",
+			token:  otherToken,
+			group:  gID,
+			offset: 0,
+			limit:  10,
+			err:    things.ErrAuthorization,
+		},
+		{
+			desc:   "retrieve contents of non-existing group",
+			token:  token,
+			group:  wrongID,
+			offset: 0,
+			limit:  10,
+			err:    groups.ErrNotFound,
+		},
+	}
+
+	for _, tc := range cases {
+		gc, err := svc.RetrieveGroupContents(context.Background(), tc.token, tc.group, things.PageMetadata{Offset: tc.offset, Limit: tc.limit})
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s\n", tc.desc, tc.err, err))
+		if tc.err != nil {
+			continue
+		}
+
+		thIDs, chIDs := ids(gc.Things.Things, gc.Channels.Channels)
+		assert.Equal(t, tc.things, thIDs, fmt.Sprintf("%s: expected things %v got %v\n", tc.desc, tc.things, thIDs))
+		assert.Equal(t, tc.channels, chIDs, fmt.Sprintf("%s: expected channels %v got %v\n", tc.desc, tc.channels, chIDs))
+		assert.Equal(t, tc.thingsTotal, gc.Things.Total, fmt.Sprintf("%s: expected %d things in total got %d\n", tc.desc, tc.thingsTotal, gc.Things.Total))
+		assert.Equal(t, tc.chansTotal, gc.Channels.Total, fmt.Sprintf("%s: expected %d channels in total got %d\n", tc.desc, tc.chansTotal, gc.Channels.Total))
+	}
+}
@@ -5,6 +5,7 @@ package things
 
 import (
 	"context"
+	"time"
 
 	"github.com/mainflux/mainflux/pkg/errors"
 )
@@ -34,16 +35,56 @@ var (
 // describing of particular thing or channel.
 type Metadata map[string]interface{}
 
+const (
+	// EnabledStatus is the status of things in service, which new things
+	// are saved with.
+	EnabledStatus = "enabled"
+
+	// DisabledStatus is the status of decommissioned things. They keep
+	// their keys and history, but are excluded from the listings unless
+	// requested.
+	DisabledStatus = "disabled"
+
+	// AllStatus lists things regardless of their status.
+	AllStatus = "all"
+)
+
 // Thing represents a Mainflux thing. Each thing is owned by one user, and
 // it is assigned with the unique identifier and (temporary) access key.
+// Besides its primary key, a thing can have additional active keys, e.g.
+// one per firmware slot. All the keys are unique across things.
 type Thing struct {
 	ID       string
 	Owner    string
 	Name     string
 	Key      string
+	Keys     []string
 	Metadata Metadata
+	Status   string
+	// Connected and Connections are set only when the connection status
+	// is requested while listing things.
+	Connected   bool
+	Connections uint64
+	// Groups is set only when the groups are requested while listing
+	// the things of groups.
+	Groups []ThingGroup
+}
+
+// ThingGroup is the group a listed thing belongs to.
+type ThingGroup struct {
+	ID    string
+	Name  string
+	Owner string
 }
 
+// NullFacet is the metadata facet value counting the things whose metadata
+// lacks the key, or has it set to null or to an empty string.
+const NullFacet = ""
+
+// OrderConnectedAt orders the things connected to a channel by the time
+// they were connected.
+const OrderConnectedAt = "connectedAt"
+
 // Page contains page related metadata as well as list of things that
 // belong to this page.
 type Page struct {
@@ -51,6 +92,21 @@ type Page struct {
 	Things []Thing
 }
 
+// CompactThing is the reduced representation of a thing for clients that
+// don't need the thing keys and metadata, such as mobile apps.
+type CompactThing struct {
+	ID        string
+	Name      string
+	Connected bool
+}
+
+// CompactPage contains page related metadata as well as list of compact
+// things that belong to this page.
+type CompactPage struct {
+	PageMetadata
+	Things []CompactThing
+}
+
 // ThingRepository specifies a thing persistence API.
 type ThingRepository interface {
 	// Save persists multiple things. Things are saved using a transaction. If one thing
@@ -62,26 +118,107 @@ type ThingRepository interface {
 	// returned to indicate operation failure.
 	Update(ctx context.Context, t Thing) error
 
-	// UpdateKey updates key value of the existing thing. A non-nil error is
-	// returned to indicate operation failure.
+	// UpdateKey updates the primary key value of the existing thing. A
+	// non-nil error is returned to indicate operation failure.
 	UpdateKey(ctx context.Context, owner, id, key string) error
 
+	// UpdateMetadata merges the metadata into the metadata of the existing
+	// thing, leaving its other fields unchanged. The keys with a nil value
+	// are removed. A non-nil error is returned to indicate operation
+	// failure.
+	UpdateMetadata(ctx context.Context, owner, id string, md Metadata) error
+
 	// RetrieveByID retrieves the thing having the provided identifier, that is owned
 	// by the specified user.
 	RetrieveByID(ctx context.Context, owner, id string) (Thing, error)
 
-	// RetrieveByKey returns thing ID for given thing key.
+	// RetrieveByIDsMap retrieves the things having the provided identifiers.
+	// The things are keyed by their identifiers, while the identifiers of
+	// non-existing things are omitted from the result.
+	RetrieveByIDsMap(ctx context.Context, ids []string) (map[string]Thing, error)
+
+	// RetrieveByIDs retrieves the things having the provided identifiers,
+	// in the order of the identifiers. The identifiers of non-existing
+	// things are skipped.
+	RetrieveByIDs(ctx context.Context, ids []string) ([]Thing, error)
+
+	// RetrieveByGroupIDs retrieves the subset of things owned by the
+	// specified user, that are members of any of the specified groups and
+	// have the status of the page metadata, enabled by default. Setting
+	// Sample in the page metadata retrieves a pseudo-random sample of the
+	// things instead. Setting WithGroups embeds the groups each thing
+	// belongs to, ordered by name, at the cost of joining the groups.
+	RetrieveByGroupIDs(ctx context.Context, owner string, groupIDs []string, pm PageMetadata) (Page, error)
+
+	// RetrieveCompactByGroupIDs retrieves the same things as
+	// RetrieveByGroupIDs, but only their identifiers, names and connection
+	// status.
+	RetrieveCompactByGroupIDs(ctx context.Context, owner string, groupIDs []string, pm PageMetadata) (CompactPage, error)
+
+	// RetrieveByMetadata retrieves the subset of things owned by the
+	// specified user, whose metadata contains every key of the filter with
+	// an equal value. If groups are specified, only the things that are
+	// members of any of them are retrieved.
+	RetrieveByMetadata(ctx context.Context, owner string, groupIDs []string, filter Metadata, pm PageMetadata) (Page, error)
+
+	// Search retrieves the subset of things whose name or any string value
+	// of the top-level metadata contains the query, ignoring case. If
+	// groups are specified, only the things that are members of any of
+	// them are searched.
+	Search(ctx context.Context, groupIDs []string, query string, pm PageMetadata) (Page, error)
+
+	// CountByGroupIDs returns the number of existing things that are
+	// members of any of the specified groups.
+	CountByGroupIDs(ctx context.Context, groupIDs []string) (uint64, error)
+
+	// CountAll returns the number of things of all the users.
+	CountAll(ctx context.Context) (uint64, error)
+
+	// MetadataFacet returns the number of existing things that are members
+	// of any of the specified groups, per text value of the metadata key.
+	// The things without a value are counted under NullFacet.
+	MetadataFacet(ctx context.Context, groupIDs []string, key string) (map[string]uint64, error)
+
+	// ChangeStatus sets the status of the thing having the provided
+	// identifier to either EnabledStatus or DisabledStatus.
+	ChangeStatus(ctx context.Context, id, status string) error
+
+	// SaveTemporaryKey adds the key to the additional keys of the thing
+	// having the provided identifier, that is owned by the specified user.
+	// The key identifies the thing until it expires.
+	SaveTemporaryKey(ctx context.Context, owner, id, key string, expiresAt time.Time) error
+
+	// RemoveExpiredKeys removes the temporary keys expired by the given
+	// time and returns them.
+	RemoveExpiredKeys(ctx context.Context, now time.Time) ([]string, error)
+
+	// RetrieveByKey returns thing ID for given thing key, which is either
+	// the primary or one of the additional keys of the thing. Expired
+	// temporary keys resolve to ErrAuthorization.
 	RetrieveByKey(ctx context.Context, key string) (string, error)
 
+	// RetrieveKeyExpiry returns the expiry of the thing key, or the zero
+	// time if the key doesn't expire.
+	RetrieveKeyExpiry(ctx context.Context, key string) (time.Time, error)
+
 	// RetrieveAll retrieves the subset of things owned by the specified user.
 	RetrieveAll(ctx context.Context, owner string, pm PageMetadata) (Page, error)
 
+	// RetrieveAllStream streams the things of all the users, ordered by owner
+	// and identifier, retrieving batchSize things at a time, so that they are
+	// never held in memory all at once. Both channels are closed once the
+	// things are streamed. Streaming stops when the context is done, and the
+	// error channel then yields the context error. A failing retrieval is
+	// yielded on the error channel too, after the things retrieved before.
+	RetrieveAllStream(ctx context.Context, batchSize int) (<-chan Thing, <-chan error)
+
 	// RetrieveByChannel retrieves the subset of things owned by the specified
-	// user and connected or not connected to specified channel.
-	RetrieveByChannel(ctx context.Context, owner, channel string, offset, limit uint64, connected bool) (Page, error)
+	// user and connected or not connected to specified channel. Connected
+	// things can be ordered by connection time using OrderConnectedAt.
+	RetrieveByChannel(ctx context.Context, owner, channel string, connected bool, pm PageMetadata) (Page, error)
 
 	// Remove removes the thing having the provided identifier, that is owned
-	// by the specified user.
+	// by the specified user, and disconnects it from all the channels.
 	Remove(ctx context.Context, owner, id string) error
 }
 
@@ -93,6 +230,14 @@ type ThingCache interface {
 	// ID returns thing ID for given key.
 	ID(context.Context, string) (string, error)
 
+	// IDs returns thing IDs for given keys. The keys of the things that
+	// aren't cached are not present in the returned map.
+	IDs(context.Context, []string) (map[string]string, error)
+
 	// Removes thing from cache.
 	Remove(context.Context, string) error
+
+	// RemoveKey removes the thing key from cache, leaving the other keys
+	// of the thing cached.
+	RemoveKey(context.Context, string) error
 }
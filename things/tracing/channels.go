@@ -15,13 +15,22 @@ const (
 	saveChannelsOp            = "save_channels"
 	updateChannelOp           = "update_channel"
 	retrieveChannelByIDOp     = "retrieve_channel_by_id"
+	retrieveChannelsByIDsOp   = "retrieve_channels_by_ids"
 	retrieveAllChannelsOp     = "retrieve_all_channels"
 	retrieveChannelsByThingOp = "retrieve_channels_by_thing"
 	removeChannelOp           = "retrieve_channel"
 	connectOp                 = "connect"
 	disconnectOp              = "disconnect"
+	disconnectManyOp          = "disconnect_many"
 	hasThingOp                = "has_thing"
 	hasThingByIDOp            = "has_thing_by_id"
+	retrieveAllConnectionsOp  = "retrieve_all_connections"
+	retrieveAllCachedConnsOp  = "retrieve_all_cached_connections"
+	retrieveConnsByThingOp    = "retrieve_connections_by_thing"
+	countAllChannelsOp        = "count_all_channels"
+	retrieveCachedConnsOp     = "retrieve_cached_connections"
+	saveCachedConnsOp         = "save_cached_connections"
+	removeCachedConnsOp       = "remove_cached_connections"
 )
 
 var (
@@ -67,6 +76,14 @@ func (crm channelRepositoryMiddleware) RetrieveByID(ctx context.Context, owner,
 	return crm.repo.RetrieveByID(ctx, owner, id)
 }
 
+func (crm channelRepositoryMiddleware) RetrieveByIDs(ctx context.Context, ids []string) ([]things.Channel, error) {
+	span := createSpan(ctx, crm.tracer, retrieveChannelsByIDsOp)
+	defer span.Finish()
+	ctx = opentracing.ContextWithSpan(ctx, span)
+
+	return crm.repo.RetrieveByIDs(ctx, ids)
+}
+
 func (crm channelRepositoryMiddleware) RetrieveAll(ctx context.Context, owner string, pm things.PageMetadata) (things.ChannelsPage, error) {
 	span := createSpan(ctx, crm.tracer, retrieveAllChannelsOp)
 	defer span.Finish()
@@ -91,12 +108,12 @@ func (crm channelRepositoryMiddleware) Remove(ctx context.Context, owner, id str
 	return crm.repo.Remove(ctx, owner, id)
 }
 
-func (crm channelRepositoryMiddleware) Connect(ctx context.Context, owner string, chIDs, thIDs []string) error {
+func (crm channelRepositoryMiddleware) Connect(ctx context.Context, owner string, chIDs, thIDs []string, limit uint64, actions ...things.Actions) error {
 	span := createSpan(ctx, crm.tracer, connectOp)
 	defer span.Finish()
 	ctx = opentracing.ContextWithSpan(ctx, span)
 
-	return crm.repo.Connect(ctx, owner, chIDs, thIDs)
+	return crm.repo.Connect(ctx, owner, chIDs, thIDs, limit, actions...)
 }
 
 func (crm channelRepositoryMiddleware) Disconnect(ctx context.Context, owner, chanID, thingID string) error {
@@ -107,6 +124,14 @@ func (crm channelRepositoryMiddleware) Disconnect(ctx context.Context, owner, ch
 	return crm.repo.Disconnect(ctx, owner, chanID, thingID)
 }
 
+func (crm channelRepositoryMiddleware) DisconnectMany(ctx context.Context, owner string, chIDs, thIDs []string) error {
+	span := createSpan(ctx, crm.tracer, disconnectManyOp)
+	defer span.Finish()
+	ctx = opentracing.ContextWithSpan(ctx, span)
+
+	return crm.repo.DisconnectMany(ctx, owner, chIDs, thIDs)
+}
+
 func (crm channelRepositoryMiddleware) HasThing(ctx context.Context, chanID, key string) (string, error) {
 	span := createSpan(ctx, crm.tracer, hasThingOp)
 	defer span.Finish()
@@ -115,12 +140,36 @@ func (crm channelRepositoryMiddleware) HasThing(ctx context.Context, chanID, key
 	return crm.repo.HasThing(ctx, chanID, key)
 }
 
-func (crm channelRepositoryMiddleware) HasThingByID(ctx context.Context, chanID, thingID string) error {
+func (crm channelRepositoryMiddleware) HasThingByID(ctx context.Context, chanID, thingID string, actions ...things.Actions) error {
 	span := createSpan(ctx, crm.tracer, hasThingByIDOp)
 	defer span.Finish()
 	ctx = opentracing.ContextWithSpan(ctx, span)
 
-	return crm.repo.HasThingByID(ctx, chanID, thingID)
+	return crm.repo.HasThingByID(ctx, chanID, thingID, actions...)
+}
+
+func (crm channelRepositoryMiddleware) RetrieveAllConnections(ctx context.Context) ([]things.Connection, error) {
+	span := createSpan(ctx, crm.tracer, retrieveAllConnectionsOp)
+	defer span.Finish()
+	ctx = opentracing.ContextWithSpan(ctx, span)
+
+	return crm.repo.RetrieveAllConnections(ctx)
+}
+
+func (crm channelRepositoryMiddleware) RetrieveConnectionsByThing(ctx context.Context, thingID string) ([]string, error) {
+	span := createSpan(ctx, crm.tracer, retrieveConnsByThingOp)
+	defer span.Finish()
+	ctx = opentracing.ContextWithSpan(ctx, span)
+
+	return crm.repo.RetrieveConnectionsByThing(ctx, thingID)
+}
+
+func (crm channelRepositoryMiddleware) CountAll(ctx context.Context) (uint64, uint64, error) {
+	span := createSpan(ctx, crm.tracer, countAllChannelsOp)
+	defer span.Finish()
+	ctx = opentracing.ContextWithSpan(ctx, span)
+
+	return crm.repo.CountAll(ctx)
 }
 
 type channelCacheMiddleware struct {
@@ -168,3 +217,35 @@ func (ccm channelCacheMiddleware) Remove(ctx context.Context, chanID string) err
 
 	return ccm.cache.Remove(ctx, chanID)
 }
+
+func (ccm channelCacheMiddleware) RetrieveAll(ctx context.Context) ([]things.Connection, error) {
+	span := createSpan(ctx, ccm.tracer, retrieveAllCachedConnsOp)
+	defer span.Finish()
+	ctx = opentracing.ContextWithSpan(ctx, span)
+
+	return ccm.cache.RetrieveAll(ctx)
+}
+
+func (ccm channelCacheMiddleware) Connections(ctx context.Context, thingID string) ([]string, error) {
+	span := createSpan(ctx, ccm.tracer, retrieveCachedConnsOp)
+	defer span.Finish()
+	ctx = opentracing.ContextWithSpan(ctx, span)
+
+	return ccm.cache.Connections(ctx, thingID)
+}
+
+func (ccm channelCacheMiddleware) SaveConnections(ctx context.Context, thingID string, chanIDs []string) error {
+	span := createSpan(ctx, ccm.tracer, saveCachedConnsOp)
+	defer span.Finish()
+	ctx = opentracing.ContextWithSpan(ctx, span)
+
+	return ccm.cache.SaveConnections(ctx, thingID, chanIDs)
+}
+
+func (ccm channelCacheMiddleware) RemoveConnections(ctx context.Context, thingID string) error {
+	span := createSpan(ctx, ccm.tracer, removeCachedConnsOp)
+	defer span.Finish()
+	ctx = opentracing.ContextWithSpan(ctx, span)
+
+	return ccm.cache.RemoveConnections(ctx, thingID)
+}
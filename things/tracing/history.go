@@ -0,0 +1,57 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package tracing
+
+import (
+	"context"
+
+	"github.com/mainflux/mainflux/things"
+	opentracing "github.com/opentracing/opentracing-go"
+)
+
+const (
+	saveConnectionEventsOp              = "save_connection_events"
+	retrieveConnectionEventsByThingOp   = "retrieve_connection_events_by_thing"
+	retrieveConnectionEventsByChannelOp = "retrieve_connection_events_by_channel"
+)
+
+var _ things.ConnectionEventRepository = (*connectionEventRepositoryMiddleware)(nil)
+
+type connectionEventRepositoryMiddleware struct {
+	tracer opentracing.Tracer
+	repo   things.ConnectionEventRepository
+}
+
+// ConnectionEventRepositoryMiddleware tracks request and their latency, and
+// adds spans to context.
+func ConnectionEventRepositoryMiddleware(tracer opentracing.Tracer, repo things.ConnectionEventRepository) things.ConnectionEventRepository {
+	return connectionEventRepositoryMiddleware{
+		tracer: tracer,
+		repo:   repo,
+	}
+}
+
+func (erm connectionEventRepositoryMiddleware) Save(ctx context.Context, events ...things.ConnectionEvent) error {
+	span := createSpan(ctx, erm.tracer, saveConnectionEventsOp)
+	defer span.Finish()
+	ctx = opentracing.ContextWithSpan(ctx, span)
+
+	return erm.repo.Save(ctx, events...)
+}
+
+func (erm connectionEventRepositoryMiddleware) RetrieveByThing(ctx context.Context, owner, thingID string, offset, limit uint64) (things.ConnectionEventsPage, error) {
+	span := createSpan(ctx, erm.tracer, retrieveConnectionEventsByThingOp)
+	defer span.Finish()
+	ctx = opentracing.ContextWithSpan(ctx, span)
+
+	return erm.repo.RetrieveByThing(ctx, owner, thingID, offset, limit)
+}
+
+func (erm connectionEventRepositoryMiddleware) RetrieveByChannel(ctx context.Context, owner, chanID string, offset, limit uint64) (things.ConnectionEventsPage, error) {
+	span := createSpan(ctx, erm.tracer, retrieveConnectionEventsByChannelOp)
+	defer span.Finish()
+	ctx = opentracing.ContextWithSpan(ctx, span)
+
+	return erm.repo.RetrieveByChannel(ctx, owner, chanID, offset, limit)
+}
@@ -5,22 +5,39 @@ package tracing
 
 import (
 	"context"
+	"time"
 
 	"github.com/mainflux/mainflux/things"
 	opentracing "github.com/opentracing/opentracing-go"
 )
 
 const (
-	saveThingOp               = "save_thing"
-	saveThingsOp              = "save_things"
-	updateThingOp             = "update_thing"
-	updateThingKeyOp          = "update_thing_by_key"
-	retrieveThingByIDOp       = "retrieve_thing_by_id"
-	retrieveThingByKeyOp      = "retrieve_thing_by_key"
-	retrieveAllThingsOp       = "retrieve_all_things"
-	retrieveThingsByChannelOp = "retrieve_things_by_chan"
-	removeThingOp             = "remove_thing"
-	retrieveThingIDByKeyOp    = "retrieve_id_by_key"
+	saveThingOp                = "save_thing"
+	saveThingsOp               = "save_things"
+	updateThingOp              = "update_thing"
+	updateThingKeyOp           = "update_thing_by_key"
+	updateThingMetadataOp      = "update_thing_metadata"
+	retrieveThingByIDOp        = "retrieve_thing_by_id"
+	retrieveThingByKeyOp       = "retrieve_thing_by_key"
+	retrieveKeyExpiryOp        = "retrieve_key_expiry"
+	retrieveThingsByIDsMapOp   = "retrieve_things_by_ids_map"
+	retrieveThingsByIDsOp      = "retrieve_things_by_ids"
+	retrieveThingsByGroupsOp   = "retrieve_things_by_groups"
+	retrieveThingsByMetadataOp = "retrieve_things_by_metadata"
+	searchThingsOp             = "search_things"
+	countThingsByGroupsOp      = "count_things_by_groups"
+	countAllThingsOp           = "count_all_things"
+	retrieveMetadataFacetOp    = "retrieve_metadata_facet"
+	changeThingStatusOp        = "change_thing_status"
+	saveTemporaryKeyOp         = "save_temporary_key"
+	removeExpiredKeysOp        = "remove_expired_keys"
+	retrieveAllThingsOp        = "retrieve_all_things"
+	streamAllThingsOp          = "stream_all_things"
+	retrieveThingsByChannelOp  = "retrieve_things_by_chan"
+	removeThingOp              = "remove_thing"
+	removeThingKeyOp           = "remove_thing_key"
+	retrieveThingIDByKeyOp     = "retrieve_id_by_key"
+	retrieveThingIDsByKeysOp   = "retrieve_ids_by_keys"
 )
 
 var (
@@ -66,6 +83,14 @@ func (trm thingRepositoryMiddleware) UpdateKey(ctx context.Context, owner, id, k
 	return trm.repo.UpdateKey(ctx, owner, id, key)
 }
 
+func (trm thingRepositoryMiddleware) UpdateMetadata(ctx context.Context, owner, id string, md things.Metadata) error {
+	span := createSpan(ctx, trm.tracer, updateThingMetadataOp)
+	defer span.Finish()
+	ctx = opentracing.ContextWithSpan(ctx, span)
+
+	return trm.repo.UpdateMetadata(ctx, owner, id, md)
+}
+
 func (trm thingRepositoryMiddleware) RetrieveByID(ctx context.Context, owner, id string) (things.Thing, error) {
 	span := createSpan(ctx, trm.tracer, retrieveThingByIDOp)
 	defer span.Finish()
@@ -74,6 +99,102 @@ func (trm thingRepositoryMiddleware) RetrieveByID(ctx context.Context, owner, id
 	return trm.repo.RetrieveByID(ctx, owner, id)
 }
 
+func (trm thingRepositoryMiddleware) RetrieveByIDsMap(ctx context.Context, ids []string) (map[string]things.Thing, error) {
+	span := createSpan(ctx, trm.tracer, retrieveThingsByIDsMapOp)
+	defer span.Finish()
+	ctx = opentracing.ContextWithSpan(ctx, span)
+
+	return trm.repo.RetrieveByIDsMap(ctx, ids)
+}
+
+func (trm thingRepositoryMiddleware) RetrieveByIDs(ctx context.Context, ids []string) ([]things.Thing, error) {
+	span := createSpan(ctx, trm.tracer, retrieveThingsByIDsOp)
+	defer span.Finish()
+	ctx = opentracing.ContextWithSpan(ctx, span)
+
+	return trm.repo.RetrieveByIDs(ctx, ids)
+}
+
+func (trm thingRepositoryMiddleware) CountByGroupIDs(ctx context.Context, groupIDs []string) (uint64, error) {
+	span := createSpan(ctx, trm.tracer, countThingsByGroupsOp)
+	defer span.Finish()
+	ctx = opentracing.ContextWithSpan(ctx, span)
+
+	return trm.repo.CountByGroupIDs(ctx, groupIDs)
+}
+
+func (trm thingRepositoryMiddleware) CountAll(ctx context.Context) (uint64, error) {
+	span := createSpan(ctx, trm.tracer, countAllThingsOp)
+	defer span.Finish()
+	ctx = opentracing.ContextWithSpan(ctx, span)
+
+	return trm.repo.CountAll(ctx)
+}
+
+func (trm thingRepositoryMiddleware) MetadataFacet(ctx context.Context, groupIDs []string, key string) (map[string]uint64, error) {
+	span := createSpan(ctx, trm.tracer, retrieveMetadataFacetOp)
+	defer span.Finish()
+	ctx = opentracing.ContextWithSpan(ctx, span)
+
+	return trm.repo.MetadataFacet(ctx, groupIDs, key)
+}
+
+func (trm thingRepositoryMiddleware) ChangeStatus(ctx context.Context, id, status string) error {
+	span := createSpan(ctx, trm.tracer, changeThingStatusOp)
+	defer span.Finish()
+	ctx = opentracing.ContextWithSpan(ctx, span)
+
+	return trm.repo.ChangeStatus(ctx, id, status)
+}
+
+func (trm thingRepositoryMiddleware) RetrieveByGroupIDs(ctx context.Context, owner string, groupIDs []string, pm things.PageMetadata) (things.Page, error) {
+	span := createSpan(ctx, trm.tracer, retrieveThingsByGroupsOp)
+	defer span.Finish()
+	ctx = opentracing.ContextWithSpan(ctx, span)
+
+	return trm.repo.RetrieveByGroupIDs(ctx, owner, groupIDs, pm)
+}
+
+func (trm thingRepositoryMiddleware) RetrieveCompactByGroupIDs(ctx context.Context, owner string, groupIDs []string, pm things.PageMetadata) (things.CompactPage, error) {
+	span := createSpan(ctx, trm.tracer, retrieveThingsByGroupsOp)
+	defer span.Finish()
+	ctx = opentracing.ContextWithSpan(ctx, span)
+
+	return trm.repo.RetrieveCompactByGroupIDs(ctx, owner, groupIDs, pm)
+}
+
+func (trm thingRepositoryMiddleware) RetrieveByMetadata(ctx context.Context, owner string, groupIDs []string, filter things.Metadata, pm things.PageMetadata) (things.Page, error) {
+	span := createSpan(ctx, trm.tracer, retrieveThingsByMetadataOp)
+	defer span.Finish()
+	ctx = opentracing.ContextWithSpan(ctx, span)
+
+	return trm.repo.RetrieveByMetadata(ctx, owner, groupIDs, filter, pm)
+}
+
+func (trm thingRepositoryMiddleware) Search(ctx context.Context, groupIDs []string, query string, pm things.PageMetadata) (things.Page, error) {
+	span := createSpan(ctx, trm.tracer, searchThingsOp)
+	defer span.Finish()
+	ctx = opentracing.ContextWithSpan(ctx, span)
+
+	return trm.repo.Search(ctx, groupIDs, query, pm)
+}
+
+func (trm thingRepositoryMiddleware) SaveTemporaryKey(ctx context.Context, owner, id, key string, expiresAt time.Time) error {
+	span := createSpan(ctx, trm.tracer, saveTemporaryKeyOp)
+	defer span.Finish()
+	ctx = opentracing.ContextWithSpan(ctx, span)
+
+	return trm.repo.SaveTemporaryKey(ctx, owner, id, key, expiresAt)
+}
+
+func (trm thingRepositoryMiddleware) RemoveExpiredKeys(ctx context.Context, now time.Time) ([]string, error) {
+	span := createSpan(ctx, trm.tracer, removeExpiredKeysOp)
+	defer span.Finish()
+	ctx = opentracing.ContextWithSpan(ctx, span)
+
+	return trm.repo.RemoveExpiredKeys(ctx, now)
+}
+
 func (trm thingRepositoryMiddleware) RetrieveByKey(ctx context.Context, key string) (string, error) {
 	span := createSpan(ctx, trm.tracer, retrieveThingByKeyOp)
 	defer span.Finish()
@@ -82,6 +203,14 @@ func (trm thingRepositoryMiddleware) RetrieveByKey(ctx context.Context, key stri
 	return trm.repo.RetrieveByKey(ctx, key)
 }
 
+func (trm thingRepositoryMiddleware) RetrieveKeyExpiry(ctx context.Context, key string) (time.Time, error) {
+	span := createSpan(ctx, trm.tracer, retrieveKeyExpiryOp)
+	defer span.Finish()
+	ctx = opentracing.ContextWithSpan(ctx, span)
+
+	return trm.repo.RetrieveKeyExpiry(ctx, key)
+}
+
 func (trm thingRepositoryMiddleware) RetrieveAll(ctx context.Context, owner string, pm things.PageMetadata) (things.Page, error) {
 	span := createSpan(ctx, trm.tracer, retrieveAllThingsOp)
 	defer span.Finish()
@@ -90,12 +219,20 @@ func (trm thingRepositoryMiddleware) RetrieveAll(ctx context.Context, owner stri
 	return trm.repo.RetrieveAll(ctx, owner, pm)
 }
 
-func (trm thingRepositoryMiddleware) RetrieveByChannel(ctx context.Context, owner, channel string, offset, limit uint64, connected bool) (things.Page, error) {
+func (trm thingRepositoryMiddleware) RetrieveAllStream(ctx context.Context, batchSize int) (<-chan things.Thing, <-chan error) {
+	span := createSpan(ctx, trm.tracer, streamAllThingsOp)
+	defer span.Finish()
+	ctx = opentracing.ContextWithSpan(ctx, span)
+
+	return trm.repo.RetrieveAllStream(ctx, batchSize)
+}
+
+func (trm thingRepositoryMiddleware) RetrieveByChannel(ctx context.Context, owner, channel string, connected bool, pm things.PageMetadata) (things.Page, error) {
 	span := createSpan(ctx, trm.tracer, retrieveThingsByChannelOp)
 	defer span.Finish()
 	ctx = opentracing.ContextWithSpan(ctx, span)
 
-	return trm.repo.RetrieveByChannel(ctx, owner, channel, offset, limit, connected)
+	return trm.repo.RetrieveByChannel(ctx, owner, channel, connected, pm)
 }
 
 func (trm thingRepositoryMiddleware) Remove(ctx context.Context, owner, id string) error {
@@ -136,6 +273,14 @@ func (tcm thingCacheMiddleware) ID(ctx context.Context, thingKey string) (string
 	return tcm.cache.ID(ctx, thingKey)
 }
 
+func (tcm thingCacheMiddleware) IDs(ctx context.Context, thingKeys []string) (map[string]string, error) {
+	span := createSpan(ctx, tcm.tracer, retrieveThingIDsByKeysOp)
+	defer span.Finish()
+	ctx = opentracing.ContextWithSpan(ctx, span)
+
+	return tcm.cache.IDs(ctx, thingKeys)
+}
+
 func (tcm thingCacheMiddleware) Remove(ctx context.Context, thingID string) error {
 	span := createSpan(ctx, tcm.tracer, removeThingOp)
 	defer span.Finish()
@@ -144,6 +289,14 @@ func (tcm thingCacheMiddleware) Remove(ctx context.Context, thingID string) erro
 	return tcm.cache.Remove(ctx, thingID)
 }
 
+func (tcm thingCacheMiddleware) RemoveKey(ctx context.Context, thingKey string) error {
+	span := createSpan(ctx, tcm.tracer, removeThingKeyOp)
+	defer span.Finish()
+	ctx = opentracing.ContextWithSpan(ctx, span)
+
+	return tcm.cache.RemoveKey(ctx, thingKey)
+}
+
 func createSpan(ctx context.Context, tracer opentracing.Tracer, opName string) opentracing.Span {
 	if parentSpan := opentracing.SpanFromContext(ctx); parentSpan != nil {
 		return tracer.StartSpan(
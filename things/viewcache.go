@@ -0,0 +1,144 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package things
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultViewCacheSize is the number of things the view cache holds if
+// the configured size is not positive.
+const DefaultViewCacheSize = 1000
+
+var _ ThingRepository = (*viewCache)(nil)
+
+// viewCache is a read-through cache of the things retrieved by ID. The
+// cached things are evicted once they expire, after they are updated,
+// removed or their status or keys change, and in least recently used
+// order once the cache is full. Since other service instances and the key
+// sweeper don't invalidate it, the TTL bounds how long a stale thing can
+// be returned.
+type viewCache struct {
+	ThingRepository
+	ttl   time.Duration
+	size  int
+	mu    sync.Mutex
+	items map[string]*list.Element
+	lru   *list.List
+}
+
+type viewEntry struct {
+	thing   Thing
+	expires time.Time
+}
+
+func newViewCache(repo ThingRepository, ttl time.Duration, size int) ThingRepository {
+	if size <= 0 {
+		size = DefaultViewCacheSize
+	}
+	return &viewCache{
+		ThingRepository: repo,
+		ttl:             ttl,
+		size:            size,
+		items:           make(map[string]*list.Element),
+		lru:             list.New(),
+	}
+}
+
+func (vc *viewCache) RetrieveByID(ctx context.Context, owner, id string) (Thing, error) {
+	if th, ok := vc.get(owner, id); ok {
+		return th, nil
+	}
+
+	th, err := vc.ThingRepository.RetrieveByID(ctx, owner, id)
+	if err != nil {
+		return Thing{}, err
+	}
+	vc.put(th)
+	return th, nil
+}
+
+func (vc *viewCache) Update(ctx context.Context, thing Thing) error {
+	defer vc.remove(thing.ID)
+	return vc.ThingRepository.Update(ctx, thing)
+}
+
+func (vc *viewCache) UpdateKey(ctx context.Context, owner, id, key string) error {
+	defer vc.remove(id)
+	return vc.ThingRepository.UpdateKey(ctx, owner, id, key)
+}
+
+func (vc *viewCache) UpdateMetadata(ctx context.Context, owner, id string, md Metadata) error {
+	defer vc.remove(id)
+	return vc.ThingRepository.UpdateMetadata(ctx, owner, id, md)
+}
+
+func (vc *viewCache) Remove(ctx context.Context, owner, id string) error {
+	defer vc.remove(id)
+	return vc.ThingRepository.Remove(ctx, owner, id)
+}
+
+func (vc *viewCache) ChangeStatus(ctx context.Context, id, status string) error {
+	defer vc.remove(id)
+	return vc.ThingRepository.ChangeStatus(ctx, id, status)
+}
+
+func (vc *viewCache) SaveTemporaryKey(ctx context.Context, owner, id, key string, expiresAt time.Time) error {
+	defer vc.remove(id)
+	return vc.ThingRepository.SaveTemporaryKey(ctx, owner, id, key, expiresAt)
+}
+
+// get returns the cached thing, if it is owned by the owner. The owner is
+// checked so that a cached thing isn't disclosed to other users.
+func (vc *viewCache) get(owner, id string) (Thing, bool) {
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+
+	el, ok := vc.items[id]
+	if !ok {
+		return Thing{}, false
+	}
+	e := el.Value.(viewEntry)
+	if time.Now().After(e.expires) {
+		vc.lru.Remove(el)
+		delete(vc.items, id)
+		return Thing{}, false
+	}
+	if e.thing.Owner != owner {
+		return Thing{}, false
+	}
+	vc.lru.MoveToFront(el)
+	return e.thing, true
+}
+
+func (vc *viewCache) put(th Thing) {
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+
+	e := viewEntry{thing: th, expires: time.Now().Add(vc.ttl)}
+	if el, ok := vc.items[th.ID]; ok {
+		el.Value = e
+		vc.lru.MoveToFront(el)
+		return
+	}
+	vc.items[th.ID] = vc.lru.PushFront(e)
+	for vc.lru.Len() > vc.size {
+		el := vc.lru.Back()
+		vc.lru.Remove(el)
+		delete(vc.items, el.Value.(viewEntry).thing.ID)
+	}
+}
+
+func (vc *viewCache) remove(id string) {
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+
+	if el, ok := vc.items[id]; ok {
+		vc.lru.Remove(el)
+		delete(vc.items, id)
+	}
+}
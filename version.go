@@ -6,9 +6,19 @@ package mainflux
 import (
 	"encoding/json"
 	"net/http"
+	"time"
 )
 
-const version string = "0.11.0"
+// Build information, which can be overridden at build time using
+// -ldflags "-X 'github.com/mainflux/mainflux.commit=<commit>'" and
+// similarly for version and buildTime.
+var (
+	version   = "0.11.0"
+	commit    = "unknown"
+	buildTime = "unknown"
+)
+
+var startTime = time.Now()
 
 // VersionInfo contains version endpoint response.
 type VersionInfo struct {
@@ -29,3 +39,114 @@ func Version(service string) http.HandlerFunc {
 		rw.Write(data)
 	})
 }
+
+// ServiceDescriptor contains the root endpoint response, which describes
+// the service and links its operational endpoints.
+type ServiceDescriptor struct {
+	// Service contains service name.
+	Service string `json:"service"`
+
+	// Version contains service current version value.
+	Version string `json:"version"`
+
+	// Links contains the paths of the health and metrics endpoints.
+	Links map[string]string `json:"links"`
+}
+
+// Descriptor exposes an HTTP handler for retrieving the service
+// descriptor.
+func Descriptor(service string) http.HandlerFunc {
+	return http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+		res := ServiceDescriptor{
+			Service: service,
+			Version: version,
+			Links: map[string]string{
+				"health":  "/health",
+				"metrics": "/metrics",
+			},
+		}
+
+		data, _ := json.Marshal(res)
+
+		rw.Header().Set("Content-Type", "application/json")
+		rw.Write(data)
+	})
+}
+
+// BuildInfo contains the build information of the running service.
+type BuildInfo struct {
+	// Service contains service name.
+	Service string `json:"service"`
+
+	// Version contains service current version value.
+	Version string `json:"version"`
+
+	// Commit contains the commit the service was built from.
+	Commit string `json:"commit"`
+
+	// BuildTime contains the time the service was built.
+	BuildTime string `json:"build_time"`
+
+	// StartTime contains the time the service was started.
+	StartTime time.Time `json:"start_time"`
+}
+
+// HealthInfo contains health endpoint response.
+type HealthInfo struct {
+	// Status contains the service liveness status.
+	Status string `json:"status"`
+
+	// Info contains the build information of the service.
+	Info BuildInfo `json:"info"`
+
+	// Checks contains the status of each checked dependency, which is
+	// either pass or the reason of the failure.
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// HealthCheck returns an error if a dependency of the service is
+// unavailable.
+type HealthCheck func() error
+
+// Health exposes an HTTP handler for retrieving service health and
+// build information.
+func Health(service string) http.HandlerFunc {
+	return CheckedHealth(service, nil)
+}
+
+// CheckedHealth exposes an HTTP handler for retrieving service health and
+// build information, which runs the dependency checks on each request.
+// If any of the checks fails, the service is reported unavailable.
+func CheckedHealth(service string, checks map[string]HealthCheck) http.HandlerFunc {
+	return http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+		res := HealthInfo{
+			Status: "pass",
+			Info: BuildInfo{
+				Service:   service,
+				Version:   version,
+				Commit:    commit,
+				BuildTime: buildTime,
+				StartTime: startTime,
+			},
+		}
+
+		code := http.StatusOK
+		if len(checks) > 0 {
+			res.Checks = make(map[string]string, len(checks))
+		}
+		for name, check := range checks {
+			res.Checks[name] = "pass"
+			if err := check(); err != nil {
+				res.Checks[name] = err.Error()
+				res.Status = "fail"
+				code = http.StatusServiceUnavailable
+			}
+		}
+
+		data, _ := json.Marshal(res)
+
+		rw.Header().Set("Content-Type", "application/health+json")
+		rw.WriteHeader(code)
+		rw.Write(data)
+	})
+}
@@ -0,0 +1,95 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package mainflux
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealth(t *testing.T) {
+	// Simulate the values injected using -ldflags -X.
+	version, commit, buildTime = "1.2.3", "0123456789abcdef", "2020-01-02T03:04:05Z"
+	startTime = time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	rec := httptest.NewRecorder()
+	Health("writer")(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+	require.Equal(t, http.StatusOK, rec.Code, fmt.Sprintf("expected status %d got %d", http.StatusOK, rec.Code))
+
+	var res map[string]interface{}
+	err := json.Unmarshal(rec.Body.Bytes(), &res)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	assert.Equal(t, "pass", res["status"], fmt.Sprintf("expected status pass got %v", res["status"]))
+
+	info, ok := res["info"].(map[string]interface{})
+	require.True(t, ok, "expected info object in response")
+
+	cases := map[string]string{
+		"service":    "writer",
+		"version":    "1.2.3",
+		"commit":     "0123456789abcdef",
+		"build_time": "2020-01-02T03:04:05Z",
+		"start_time": "2020-01-02T03:04:05Z",
+	}
+	for field, expected := range cases {
+		assert.Equal(t, expected, info[field], fmt.Sprintf("%s: expected %s got %v", field, expected, info[field]))
+	}
+}
+
+func TestCheckedHealth(t *testing.T) {
+	pass := func() error { return nil }
+	fail := func() error { return errors.New("connection refused") }
+
+	cases := []struct {
+		desc   string
+		checks map[string]HealthCheck
+		code   int
+		status string
+		result map[string]interface{}
+	}{
+		{
+			desc:   "health with passing checks",
+			checks: map[string]HealthCheck{"influxdb": pass, "nats": pass},
+			code:   http.StatusOK,
+			status: "pass",
+			result: map[string]interface{}{"influxdb": "pass", "nats": "pass"},
+		},
+		{
+			desc:   "health with failing check",
+			checks: map[string]HealthCheck{"influxdb": fail, "nats": pass},
+			code:   http.StatusServiceUnavailable,
+			status: "fail",
+			result: map[string]interface{}{"influxdb": "connection refused", "nats": "pass"},
+		},
+		{
+			desc:   "health without checks",
+			checks: nil,
+			code:   http.StatusOK,
+			status: "pass",
+			result: nil,
+		},
+	}
+
+	for _, tc := range cases {
+		rec := httptest.NewRecorder()
+		CheckedHealth("writer", tc.checks)(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+		assert.Equal(t, tc.code, rec.Code, fmt.Sprintf("%s: expected status %d got %d", tc.desc, tc.code, rec.Code))
+
+		var res map[string]interface{}
+		err := json.Unmarshal(rec.Body.Bytes(), &res)
+		require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", tc.desc, err))
+		assert.Equal(t, tc.status, res["status"], fmt.Sprintf("%s: expected status %s got %v", tc.desc, tc.status, res["status"]))
+
+		checks, _ := res["checks"].(map[string]interface{})
+		assert.Equal(t, tc.result, checks, fmt.Sprintf("%s: expected checks %v got %v", tc.desc, tc.result, checks))
+	}
+}
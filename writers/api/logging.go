@@ -27,12 +27,13 @@ func LoggingMiddleware(svc writers.MessageRepository, logger log.Logger) writers
 
 func (lm *loggingMiddleware) Save(msgs interface{}) (err error) {
 	defer func(begin time.Time) {
-		message := fmt.Sprintf("Method save took %s to complete", time.Since(begin))
 		if err != nil {
-			lm.logger.Warn(fmt.Sprintf("%s with error: %s.", message, err))
+			// The duration is left out so that repeated failures produce
+			// identical messages, which a sampling logger can limit.
+			lm.logger.Warn(fmt.Sprintf("Method save failed with error: %s.", err))
 			return
 		}
-		lm.logger.Info(fmt.Sprintf("%s without errors.", message))
+		lm.logger.Info(fmt.Sprintf("Method save took %s to complete without errors.", time.Since(begin)))
 	}(time.Now())
 
 	return lm.svc.Save(msgs)
@@ -13,10 +13,18 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
-// MakeHandler returns a HTTP API handler with version and metrics.
+// MakeHandler returns a HTTP API handler with version, health and metrics.
 func MakeHandler(svcName string) http.Handler {
+	return MakeCheckedHandler(svcName, nil)
+}
+
+// MakeCheckedHandler returns a HTTP API handler with version, health and
+// metrics, whose health endpoint fails unless all the dependency checks
+// pass.
+func MakeCheckedHandler(svcName string, checks map[string]mainflux.HealthCheck) http.Handler {
 	r := bone.New()
 	r.GetFunc("/version", mainflux.Version(svcName))
+	r.GetFunc("/health", mainflux.CheckedHealth(svcName, checks))
 	r.Handle("/metrics", promhttp.Handler())
 
 	return r
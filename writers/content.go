@@ -0,0 +1,133 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package writers
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/mainflux/mainflux/pkg/errors"
+	"github.com/mainflux/mainflux/pkg/transformers/senml"
+)
+
+var errInvalidContentRoute = errors.New("invalid content route")
+
+// ContentRouteConfig routes decoded messages having the field to the
+// target. If the value is set, the field must have that value as well,
+// compared in its text form (e.g. "21" or "true"). The meaning of the
+// target depends on the writer (e.g. InfluxDB measurement).
+type ContentRouteConfig struct {
+	Field  string `toml:"field"`
+	Value  string `toml:"value"`
+	Target string `toml:"target"`
+}
+
+// ContentRoute represents the validated content route.
+type ContentRoute struct {
+	Field  string
+	Value  string
+	Target string
+}
+
+// NewContentRoute validates the content route and returns it.
+func NewContentRoute(field, value, target string) (ContentRoute, error) {
+	if field == "" {
+		return ContentRoute{}, errors.Wrap(errInvalidContentRoute, fmt.Errorf("route to %s has no field", target))
+	}
+	if target == "" {
+		return ContentRoute{}, errors.Wrap(errInvalidContentRoute, fmt.Errorf("field %s has no target", field))
+	}
+	return ContentRoute{Field: field, Value: value, Target: target}, nil
+}
+
+// Match reports whether the decoded fields satisfy the route.
+func (r ContentRoute) Match(fields map[string]interface{}) bool {
+	v, ok := fields[r.Field]
+	if !ok || v == nil {
+		return false
+	}
+	return r.Value == "" || fmt.Sprint(v) == r.Value
+}
+
+func newContentRoutes(cfgs []ContentRouteConfig) ([]ContentRoute, error) {
+	var routes []ContentRoute
+	declared := make(map[[2]string]string)
+	for _, c := range cfgs {
+		k := [2]string{c.Field, c.Value}
+		if t, ok := declared[k]; ok {
+			return nil, errors.Wrap(errInvalidContentRoute, fmt.Errorf("field %s with value %q already routed to %s", c.Field, c.Value, t))
+		}
+		r, err := NewContentRoute(c.Field, c.Value, c.Target)
+		if err != nil {
+			return nil, err
+		}
+		declared[k] = c.Target
+		routes = append(routes, r)
+	}
+	return routes, nil
+}
+
+// SenMLFields returns the fields of the SenML record content routes are
+// matched against, keyed by their SenML JSON labels: n, u, v, vs, vb, vd
+// and s. Unset attributes are omitted.
+func SenMLFields(msg senml.Message) map[string]interface{} {
+	fields := make(map[string]interface{})
+	if msg.Name != "" {
+		fields["n"] = msg.Name
+	}
+	if msg.Unit != "" {
+		fields["u"] = msg.Unit
+	}
+	if msg.Value != nil {
+		fields["v"] = *msg.Value
+	}
+	if msg.StringValue != nil {
+		fields["vs"] = *msg.StringValue
+	}
+	if msg.BoolValue != nil {
+		fields["vb"] = *msg.BoolValue
+	}
+	if msg.DataValue != nil {
+		fields["vd"] = *msg.DataValue
+	}
+	if msg.Sum != nil {
+		fields["s"] = *msg.Sum
+	}
+	return fields
+}
+
+// ContentRoutes holds the pipeline content routes, which can be replaced
+// while messages are being written.
+type ContentRoutes struct {
+	v atomic.Value
+}
+
+// NewContentRoutes returns the content routes holding the provided routes
+// in the order of their declaration, as built by NewPipeline. The slice
+// must not be modified afterwards.
+func NewContentRoutes(routes []ContentRoute) *ContentRoutes {
+	r := &ContentRoutes{}
+	r.Store(routes)
+	return r
+}
+
+// Target returns the target of the first declared route matching the
+// decoded fields.
+func (r *ContentRoutes) Target(fields map[string]interface{}) (string, bool) {
+	for _, route := range r.v.Load().([]ContentRoute) {
+		if route.Match(fields) {
+			return route.Target, true
+		}
+	}
+	return "", false
+}
+
+// Store replaces the content routes. The slice must not be modified
+// afterwards.
+func (r *ContentRoutes) Store(routes []ContentRoute) {
+	if routes == nil {
+		routes = []ContentRoute{}
+	}
+	r.v.Store(routes)
+}
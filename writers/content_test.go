@@ -0,0 +1,118 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package writers_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/mainflux/mainflux/pkg/transformers/senml"
+	"github.com/mainflux/mainflux/writers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContentRoutes(t *testing.T) {
+	p, err := writers.NewPipeline(writers.PipelineConfig{
+		ContentRoutes: []writers.ContentRouteConfig{
+			{Field: "n", Value: "temp", Target: "temperature"},
+			{Field: "temp", Target: "temperature"},
+			{Field: "alarm", Value: "true", Target: "alarms"},
+			{Field: "level", Value: "2", Target: "critical"},
+			{Field: "level", Target: "levels"},
+		},
+	})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	routes := writers.NewContentRoutes(p.ContentRoutes)
+
+	cases := []struct {
+		desc   string
+		fields map[string]interface{}
+		target string
+		routed bool
+	}{
+		{
+			desc:   "route fields having the field",
+			fields: map[string]interface{}{"temp": 21.5, "hum": 40.0},
+			target: "temperature",
+			routed: true,
+		},
+		{
+			desc:   "route fields having the field with the value",
+			fields: map[string]interface{}{"n": "temp", "v": 21.5},
+			target: "temperature",
+			routed: true,
+		},
+		{
+			desc:   "route fields having the boolean value",
+			fields: map[string]interface{}{"alarm": true},
+			target: "alarms",
+			routed: true,
+		},
+		{
+			desc:   "route fields having the numeric value to the first declared route",
+			fields: map[string]interface{}{"level": 2.0},
+			target: "critical",
+			routed: true,
+		},
+		{
+			desc:   "route fields having the field with another value",
+			fields: map[string]interface{}{"level": 1.0},
+			target: "levels",
+			routed: true,
+		},
+		{
+			desc:   "route fields having the field with a null value",
+			fields: map[string]interface{}{"temp": nil},
+			routed: false,
+		},
+		{
+			desc:   "route fields having the field with another value only",
+			fields: map[string]interface{}{"n": "hum", "alarm": false},
+			routed: false,
+		},
+		{
+			desc:   "route no fields",
+			fields: map[string]interface{}{},
+			routed: false,
+		},
+	}
+
+	for _, tc := range cases {
+		target, ok := routes.Target(tc.fields)
+		assert.Equal(t, tc.routed, ok, fmt.Sprintf("%s: expected routed %t got %t", tc.desc, tc.routed, ok))
+		assert.Equal(t, tc.target, target, fmt.Sprintf("%s: expected target %s got %s", tc.desc, tc.target, target))
+	}
+}
+
+func TestSenMLFields(t *testing.T) {
+	v, s, b := 21.5, "on", true
+
+	cases := []struct {
+		desc   string
+		msg    senml.Message
+		fields map[string]interface{}
+	}{
+		{
+			desc:   "fields of record with numeric value",
+			msg:    senml.Message{Name: "temp", Unit: "Cel", Value: &v, Sum: &v},
+			fields: map[string]interface{}{"n": "temp", "u": "Cel", "v": v, "s": v},
+		},
+		{
+			desc:   "fields of record with string value",
+			msg:    senml.Message{Name: "switch", StringValue: &s},
+			fields: map[string]interface{}{"n": "switch", "vs": s},
+		},
+		{
+			desc:   "fields of record with boolean value",
+			msg:    senml.Message{BoolValue: &b},
+			fields: map[string]interface{}{"vb": b},
+		},
+	}
+
+	for _, tc := range cases {
+		fields := writers.SenMLFields(tc.msg)
+		assert.Equal(t, tc.fields, fields, fmt.Sprintf("%s: expected %v got %v", tc.desc, tc.fields, fields))
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package writers
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/mainflux/mainflux/pkg/errors"
+	"github.com/mainflux/mainflux/pkg/transformers/json"
+	"github.com/mainflux/mainflux/pkg/transformers/senml"
+)
+
+// DefaultDecodeLogEvery is the default number of decode failures of a
+// format and subject per logged failure.
+const DefaultDecodeLogEvery = 100
+
+// snippetSize is the number of payload bytes logged with a decode failure.
+const snippetSize = 64
+
+// Formats of the payloads which fail to decode.
+const (
+	formatSenML   = "senml"
+	formatJSON    = "json"
+	formatUnknown = "unknown"
+)
+
+// decodeFormat returns the format the transformer failed to decode the
+// payload from.
+func decodeFormat(err error) string {
+	switch {
+	case errors.Contains(err, senml.ErrDecode), errors.Contains(err, senml.ErrNormalize):
+		return formatSenML
+	case errors.Contains(err, json.ErrTransform):
+		return formatJSON
+	default:
+		return formatUnknown
+	}
+}
+
+// redact returns the beginning of the payload with letters replaced by x
+// and digits by 0, so that the logged snippet shows the structure of the
+// payload without the values it carries.
+func redact(payload []byte) string {
+	n := len(payload)
+	if n > snippetSize {
+		n = snippetSize
+	}
+	snippet := make([]byte, n)
+	for i, b := range payload[:n] {
+		switch {
+		case b >= 'a' && b <= 'z', b >= 'A' && b <= 'Z':
+			snippet[i] = 'x'
+		case b >= '0' && b <= '9':
+			snippet[i] = '0'
+		case b < ' ' || b > '~':
+			snippet[i] = '.'
+		default:
+			snippet[i] = b
+		}
+	}
+	if len(payload) > n {
+		return fmt.Sprintf("%s... (%d bytes)", snippet, len(payload))
+	}
+	return string(snippet)
+}
+
+// decodeSampler counts the decode failures of each format and subject to
+// log only the first one and then one in every.
+type decodeSampler struct {
+	every int
+	mu    sync.Mutex
+	seen  map[[2]string]int
+}
+
+func newDecodeSampler(every int) *decodeSampler {
+	if every == 0 {
+		every = DefaultDecodeLogEvery
+	}
+	return &decodeSampler{
+		every: every,
+		seen:  make(map[[2]string]int),
+	}
+}
+
+// sample reports whether the decode failure is logged.
+func (s *decodeSampler) sample(format, subject string) bool {
+	if s.every < 0 {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k := [2]string{format, subject}
+	n := s.seen[k]
+	s.seen[k]++
+	return n%s.every == 0
+}
+
+// decodeFailed counts the message which failed to decode and logs it if
+// sampled.
+func (s *stream) decodeFailed(payload []byte, err error) {
+	format := decodeFormat(err)
+	if s.decodeCounter != nil {
+		s.decodeCounter.With("format", format, "subject", s.subject).Add(1)
+	}
+	if s.decodeSampler.sample(format, s.subject) {
+		s.logger.Warn(fmt.Sprintf("Failed to decode %s message on %s: %s, payload: %q", format, s.subject, err, redact(payload)))
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package writers_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	log "github.com/mainflux/mainflux/logger"
+	"github.com/mainflux/mainflux/pkg/messaging/nats"
+	"github.com/mainflux/mainflux/pkg/transformers"
+	"github.com/mainflux/mainflux/pkg/transformers/json"
+	"github.com/mainflux/mainflux/pkg/transformers/senml"
+	"github.com/mainflux/mainflux/writers"
+	"github.com/mainflux/mainflux/writers/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var _ log.Logger = (*loggerMock)(nil)
+
+// loggerMock records the logged warnings.
+type loggerMock struct {
+	mu    sync.Mutex
+	warns []string
+}
+
+func (l *loggerMock) Debug(msg string) {}
+func (l *loggerMock) Info(msg string)  {}
+func (l *loggerMock) Error(msg string) {}
+
+func (l *loggerMock) Warn(msg string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.warns = append(l.warns, msg)
+}
+
+func (l *loggerMock) decodeFailures() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var res []string
+	for _, w := range l.warns {
+		if strings.HasPrefix(w, "Failed to decode") {
+			res = append(res, w)
+		}
+	}
+	return res
+}
+
+func TestDecodeFailures(t *testing.T) {
+	cases := []struct {
+		desc        string
+		transformer transformers.Transformer
+		payload     string
+		every       int
+		published   int
+		format      string
+		logged      int
+	}{
+		{
+			desc:        "count malformed SenML messages",
+			transformer: senml.New(senml.JSON),
+			payload:     `[{"n":"temp","v":21.5`,
+			published:   3,
+			format:      "senml",
+			logged:      1,
+		},
+		{
+			desc:        "count SenML messages failing to normalize",
+			transformer: senml.New(senml.JSON),
+			payload:     `[{"v":21.5}]`,
+			published:   1,
+			format:      "senml",
+			logged:      1,
+		},
+		{
+			desc:        "count malformed JSON messages",
+			transformer: json.New(),
+			payload:     `{"temp":21.5`,
+			published:   3,
+			format:      "json",
+			logged:      1,
+		},
+		{
+			desc:        "log one in every malformed JSON messages",
+			transformer: json.New(),
+			payload:     `{"temp":21.5`,
+			every:       2,
+			published:   5,
+			format:      "json",
+			logged:      3,
+		},
+		{
+			desc:        "count malformed messages without logging them",
+			transformer: senml.New(senml.JSON),
+			payload:     `{"temp"`,
+			every:       -1,
+			published:   2,
+			format:      "senml",
+			logged:      0,
+		},
+	}
+
+	for _, tc := range cases {
+		ps := mocks.NewPubSub()
+		counter := newCounterMock()
+		logger := &loggerMock{}
+		cfg := writers.Config{
+			SubjectsConfigPath: subjectsCfgPath,
+			DecodeCounter:      counter,
+			DecodeLogEvery:     tc.every,
+		}
+		c, err := writers.StartConsumer(ps, mocks.NewMessageRepository(), tc.transformer, cfg, logger)
+		require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", tc.desc, err))
+
+		m := msg
+		m.Payload = []byte(tc.payload)
+		for i := 0; i < tc.published; i++ {
+			ps.Publish(nats.SubjectAllChannels, m)
+		}
+		_, err = c.Shutdown(context.Background())
+		require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", tc.desc, err))
+
+		failures := counter.value("format", tc.format, "subject", nats.SubjectAllChannels)
+		assert.Equal(t, float64(tc.published), failures, fmt.Sprintf("%s: expected %d %s decode failures got %v", tc.desc, tc.published, tc.format, failures))
+
+		logged := logger.decodeFailures()
+		assert.Equal(t, tc.logged, len(logged), fmt.Sprintf("%s: expected %d logged decode failures got %d", tc.desc, tc.logged, len(logged)))
+		for _, l := range logged {
+			assert.Contains(t, l, tc.format, fmt.Sprintf("%s: expected log %q to hold the format", tc.desc, l))
+			assert.NotContains(t, l, "21.5", fmt.Sprintf("%s: expected log %q to hold the redacted payload", tc.desc, l))
+		}
+	}
+}
+
+func TestDecodeFailureSnippet(t *testing.T) {
+	ps := mocks.NewPubSub()
+	logger := &loggerMock{}
+	c, err := writers.StartConsumer(ps, mocks.NewMessageRepository(), json.New(), writers.Config{SubjectsConfigPath: subjectsCfgPath}, logger)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+
+	m := msg
+	m.Payload = []byte(`{"secret":"` + strings.Repeat("a", 100) + `"`)
+	ps.Publish(nats.SubjectAllChannels, m)
+	_, err = c.Shutdown(context.Background())
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+
+	logged := logger.decodeFailures()
+	require.Equal(t, 1, len(logged), fmt.Sprintf("expected 1 logged decode failure got %d", len(logged)))
+	snippet := fmt.Sprintf("%q", `{"xxxxxx":"`+strings.Repeat("x", 53)+`... (112 bytes)`)
+	assert.True(t, strings.HasSuffix(logged[0], snippet), fmt.Sprintf("expected log %q to end with the snippet %s", logged[0], snippet))
+}
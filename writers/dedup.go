@@ -0,0 +1,90 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package writers
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mainflux/mainflux/pkg/messaging"
+)
+
+// DefaultDedupSize is the number of message IDs remembered for deduplication
+// if the size is not configured.
+const DefaultDedupSize = 10000
+
+// messageID returns the key identifying the message. Messages don't carry
+// an explicit ID, so the publisher, destination and creation time are used
+// instead. Messages without the creation time can't be identified.
+func messageID(msg messaging.Message) (string, bool) {
+	if msg.Created == 0 {
+		return "", false
+	}
+	return fmt.Sprintf("%s/%s/%s/%d", msg.Publisher, msg.Channel, msg.Subtopic, msg.Created), true
+}
+
+type seenEntry struct {
+	id      string
+	expires time.Time
+}
+
+// seenSet is a bounded set of recently seen message IDs. Since all the
+// entries live for the same time, they expire in the insertion order, so
+// the oldest entries are evicted first.
+type seenSet struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	size    int
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+func newSeenSet(ttl time.Duration, size int) *seenSet {
+	if size <= 0 {
+		size = DefaultDedupSize
+	}
+	return &seenSet{
+		ttl:     ttl,
+		size:    size,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// seen reports whether the ID was seen within the window, and remembers it
+// otherwise.
+func (s *seenSet) seen(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for e := s.order.Front(); e != nil; e = s.order.Front() {
+		entry := e.Value.(seenEntry)
+		if now.Before(entry.expires) && s.order.Len() < s.size {
+			break
+		}
+		s.order.Remove(e)
+		delete(s.entries, entry.id)
+	}
+
+	if _, ok := s.entries[id]; ok {
+		return true
+	}
+	s.entries[id] = s.order.PushBack(seenEntry{id: id, expires: now.Add(s.ttl)})
+	return false
+}
+
+// forget removes the ID from the set, so that the message is not skipped
+// when redelivered.
+func (s *seenSet) forget(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.entries[id]; ok {
+		s.order.Remove(e)
+		delete(s.entries, id)
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package writers
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/metrics"
+	"github.com/mainflux/mainflux/logger"
+	"github.com/mainflux/mainflux/pkg/errors"
+)
+
+// FanoutPolicy defines how a fan-out repository treats messages some of
+// its sinks failed to save.
+type FanoutPolicy string
+
+const (
+	// FanoutAll fails the save unless every sink saved the message.
+	FanoutAll FanoutPolicy = "all"
+
+	// FanoutBestEffort fails the save only if no sink saved the message.
+	// The failures of the other sinks are logged and counted.
+	FanoutBestEffort FanoutPolicy = "best_effort"
+)
+
+var (
+	// ErrInvalidFanoutPolicy indicates an unknown fan-out policy.
+	ErrInvalidFanoutPolicy = errors.New("invalid fan-out policy")
+
+	// ErrSinkSave indicates that a sink failed to save the message.
+	ErrSinkSave = errors.New("failed to save message to sink")
+)
+
+// ParseFanoutPolicy returns the policy with the given name. An empty name
+// stands for FanoutAll.
+func ParseFanoutPolicy(name string) (FanoutPolicy, error) {
+	switch p := FanoutPolicy(name); p {
+	case "":
+		return FanoutAll, nil
+	case FanoutAll, FanoutBestEffort:
+		return p, nil
+	default:
+		return "", errors.Wrap(ErrInvalidFanoutPolicy, fmt.Errorf("%s", name))
+	}
+}
+
+// Sink is a named repository messages are fanned out to.
+type Sink struct {
+	Name string
+	Repo MessageRepository
+}
+
+// FanoutConfig defines the options of the fan-out repository.
+type FanoutConfig struct {
+	// Policy defines how partial failures are treated. If empty,
+	// FanoutAll is used.
+	Policy FanoutPolicy
+
+	// Counter, if set, counts the saves of every sink by sink and status
+	// (written or failed).
+	Counter metrics.Counter
+
+	// Latency, if set, observes the duration of the saves of every sink
+	// in seconds by sink.
+	Latency metrics.Histogram
+}
+
+var _ MessageRepository = (*fanout)(nil)
+
+type fanout struct {
+	sinks  []Sink
+	cfg    FanoutConfig
+	logger logger.Logger
+}
+
+// NewFanout returns a repository which saves every message to all the
+// sinks concurrently, e.g. to write to an old and a new database during a
+// migration. Whether partial failures fail the save depends on the policy.
+func NewFanout(sinks []Sink, cfg FanoutConfig, logger logger.Logger) (MessageRepository, error) {
+	policy, err := ParseFanoutPolicy(string(cfg.Policy))
+	if err != nil {
+		return nil, err
+	}
+	cfg.Policy = policy
+	return &fanout{
+		sinks:  sinks,
+		cfg:    cfg,
+		logger: logger,
+	}, nil
+}
+
+func (f *fanout) Save(msgs interface{}) error {
+	errs := make([]error, len(f.sinks))
+	var wg sync.WaitGroup
+	for i, s := range f.sinks {
+		wg.Add(1)
+		go func(i int, s Sink) {
+			defer wg.Done()
+			errs[i] = f.save(s, msgs)
+		}(i, s)
+	}
+	wg.Wait()
+
+	var failed int
+	var first error
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		failed++
+		err = errors.Wrap(ErrSinkSave, errors.Wrap(fmt.Errorf("%s", f.sinks[i].Name), err))
+		if first == nil {
+			first = err
+		}
+		if f.cfg.Policy == FanoutBestEffort {
+			f.logger.Warn(fmt.Sprintf("Failed to save message to sink %s: %s", f.sinks[i].Name, errs[i]))
+		}
+	}
+
+	if f.cfg.Policy == FanoutBestEffort && failed < len(f.sinks) {
+		return nil
+	}
+	return first
+}
+
+func (f *fanout) save(s Sink, msgs interface{}) error {
+	begin := time.Now()
+	err := s.Repo.Save(msgs)
+
+	if f.cfg.Counter != nil {
+		status := "written"
+		if err != nil {
+			status = "failed"
+		}
+		f.cfg.Counter.With("sink", s.Name, "status", status).Add(1)
+	}
+	if f.cfg.Latency != nil {
+		f.cfg.Latency.With("sink", s.Name).Observe(time.Since(begin).Seconds())
+	}
+	return err
+}
@@ -0,0 +1,163 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package writers_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/mainflux/mainflux/pkg/errors"
+	"github.com/mainflux/mainflux/pkg/transformers/senml"
+	"github.com/mainflux/mainflux/writers"
+	"github.com/mainflux/mainflux/writers/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFanoutConsumer(t *testing.T) {
+	subject := "channels.fanout"
+	ps := mocks.NewPubSub()
+	primary := mocks.NewMessageRepository()
+	secondary := mocks.NewMessageRepository()
+	counter := newCounterMock()
+	repo, err := writers.NewFanout([]writers.Sink{
+		{Name: "primary", Repo: primary},
+		{Name: "secondary", Repo: secondary},
+	}, writers.FanoutConfig{Counter: counter}, testLog)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+
+	cfg := writers.Config{
+		Streams: []writers.Stream{{Subject: subject}},
+	}
+	c, err := writers.StartConsumer(ps, repo, senml.New(senml.JSON), cfg, testLog)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+
+	n := 5
+	for i := 0; i < n; i++ {
+		err := ps.Publish(subject, msg)
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	}
+	_, err = c.Shutdown(context.Background())
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+
+	for name, sink := range map[string]mocks.MessageRepository{"primary": primary, "secondary": secondary} {
+		msgs := sink.Messages()
+		assert.Len(t, msgs, n, fmt.Sprintf("expected %s sink to receive %d messages got %d", name, n, len(msgs)))
+		for _, m := range msgs {
+			_, ok := m.([]senml.Message)
+			assert.True(t, ok, fmt.Sprintf("expected %s sink to receive SenML messages got %T", name, m))
+		}
+		v := counter.value("sink", name, "status", "written")
+		assert.Equal(t, float64(n), v, fmt.Sprintf("expected %d writes counted for %s sink got %v", n, name, v))
+	}
+}
+
+func TestFanoutPolicy(t *testing.T) {
+	cases := []struct {
+		desc   string
+		policy writers.FanoutPolicy
+		sinks  []writers.MessageRepository
+		err    error
+		saved  int
+	}{
+		{
+			desc:   "save to all sinks requiring all",
+			policy: writers.FanoutAll,
+			sinks:  []writers.MessageRepository{mocks.NewMessageRepository(), mocks.NewMessageRepository()},
+			err:    nil,
+			saved:  2,
+		},
+		{
+			desc:   "save with a failing sink requiring all",
+			policy: writers.FanoutAll,
+			sinks:  []writers.MessageRepository{mocks.NewMessageRepository(), failingRepository{}},
+			err:    writers.ErrSinkSave,
+			saved:  1,
+		},
+		{
+			desc:   "save with a failing sink on best effort",
+			policy: writers.FanoutBestEffort,
+			sinks:  []writers.MessageRepository{failingRepository{}, mocks.NewMessageRepository()},
+			err:    nil,
+			saved:  1,
+		},
+		{
+			desc:   "save with all sinks failing on best effort",
+			policy: writers.FanoutBestEffort,
+			sinks:  []writers.MessageRepository{failingRepository{}, failingRepository{}},
+			err:    writers.ErrSinkSave,
+			saved:  0,
+		},
+		{
+			desc:   "save with default policy and a failing sink",
+			policy: "",
+			sinks:  []writers.MessageRepository{failingRepository{}, mocks.NewMessageRepository()},
+			err:    writers.ErrSinkSave,
+			saved:  1,
+		},
+	}
+
+	for _, tc := range cases {
+		counter := newCounterMock()
+		var sinks []writers.Sink
+		for i, r := range tc.sinks {
+			sinks = append(sinks, writers.Sink{Name: fmt.Sprintf("sink-%d", i), Repo: r})
+		}
+		repo, err := writers.NewFanout(sinks, writers.FanoutConfig{Policy: tc.policy, Counter: counter}, testLog)
+		require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", tc.desc, err))
+
+		err = repo.Save([]senml.Message{{Name: "temp"}})
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s", tc.desc, tc.err, err))
+		if tc.err != nil {
+			assert.True(t, errors.Contains(err, errors.New("failed to save")), fmt.Sprintf("%s: expected sink error got %s", tc.desc, err))
+		}
+
+		saved := 0
+		for i, r := range tc.sinks {
+			name := fmt.Sprintf("sink-%d", i)
+			if m, ok := r.(mocks.MessageRepository); ok {
+				saved += len(m.Messages())
+				assert.Equal(t, float64(1), counter.value("sink", name, "status", "written"), fmt.Sprintf("%s: expected write counted for %s", tc.desc, name))
+				continue
+			}
+			assert.Equal(t, float64(1), counter.value("sink", name, "status", "failed"), fmt.Sprintf("%s: expected failure counted for %s", tc.desc, name))
+		}
+		assert.Equal(t, tc.saved, saved, fmt.Sprintf("%s: expected %d saved messages got %d", tc.desc, tc.saved, saved))
+	}
+}
+
+func TestParseFanoutPolicy(t *testing.T) {
+	cases := []struct {
+		desc   string
+		name   string
+		policy writers.FanoutPolicy
+		err    error
+	}{
+		{
+			desc:   "parse empty policy",
+			name:   "",
+			policy: writers.FanoutAll,
+			err:    nil,
+		},
+		{
+			desc:   "parse best effort policy",
+			name:   "best_effort",
+			policy: writers.FanoutBestEffort,
+			err:    nil,
+		},
+		{
+			desc:   "parse unknown policy",
+			name:   "any",
+			policy: "",
+			err:    writers.ErrInvalidFanoutPolicy,
+		},
+	}
+
+	for _, tc := range cases {
+		policy, err := writers.ParseFanoutPolicy(tc.name)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s", tc.desc, tc.err, err))
+		assert.Equal(t, tc.policy, policy, fmt.Sprintf("%s: expected %s got %s", tc.desc, tc.policy, policy))
+	}
+}
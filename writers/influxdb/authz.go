@@ -0,0 +1,110 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package influxdb
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	influxdata "github.com/influxdata/influxdb/client/v2"
+	"github.com/mainflux/mainflux/logger"
+	"github.com/mainflux/mainflux/pkg/errors"
+)
+
+// ErrUnauthorized indicates that InfluxDB rejected the credentials of the
+// writer, or that they lack the write permission. Unlike the other write
+// errors, it persists until the credentials are fixed, so the writes are
+// not retried.
+var ErrUnauthorized = errors.New("InfluxDB rejected the credentials or they lack write permission")
+
+// authzMessages are the fragments of the errors of the 401 and 403
+// responses of InfluxDB 1.x and of the 1.x compatible API of InfluxDB 2.
+// They identify the errors of the clients which return the response body
+// without the status code, such as the InfluxDB client.
+var authzMessages = []string{
+	"authorization failed",
+	"unable to parse authentication credentials",
+	"not authorized",
+	"unauthorized",
+	"forbidden",
+	"insufficient permission",
+}
+
+// IsUnauthorized reports whether the error is a rejection of the
+// credentials or of the permissions of the client. The errors holding the
+// response status are matched by the status code only, so that a body
+// mentioning authorization doesn't change how other failures are handled.
+func IsUnauthorized(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Contains(err, ErrUnauthorized) {
+		return true
+	}
+	if code := statusCode(err); code != NoStatus {
+		return code == http.StatusUnauthorized || code == http.StatusForbidden
+	}
+	msg := strings.ToLower(err.Error())
+	for _, m := range authzMessages {
+		if strings.Contains(msg, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// AuthzClient is an InfluxDB client which tracks whether its writes are
+// rejected for lack of authorization.
+type AuthzClient interface {
+	influxdata.Client
+
+	// Authorized returns the error wrapping ErrUnauthorized of the last
+	// write if it was rejected, and nil otherwise.
+	Authorized() error
+}
+
+var _ AuthzClient = (*authzClient)(nil)
+
+type authzClient struct {
+	influxdata.Client
+	logger logger.Logger
+	mu     sync.Mutex
+	err    error
+}
+
+// NewAuthzClient returns the client whose writes rejected for lack of
+// authorization fail with ErrUnauthorized. The first rejection is logged
+// as an error, since no write succeeds until the credentials are fixed.
+func NewAuthzClient(client influxdata.Client, logger logger.Logger) AuthzClient {
+	return &authzClient{Client: client, logger: logger}
+}
+
+func (c *authzClient) Write(bp influxdata.BatchPoints) error {
+	err := c.Client.Write(bp)
+	if err != nil && !IsUnauthorized(err) {
+		return err
+	}
+	if err != nil && !errors.Contains(err, ErrUnauthorized) {
+		err = errors.Wrap(ErrUnauthorized, err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch {
+	case err != nil && c.err == nil:
+		c.logger.Error(fmt.Sprintf("InfluxDB rejected the writes to database %s, check the credentials and their write permission: %s", bp.Database(), err))
+	case err == nil && c.err != nil:
+		c.logger.Info(fmt.Sprintf("InfluxDB accepts the writes to database %s again", bp.Database()))
+	}
+	c.err = err
+	return err
+}
+
+func (c *authzClient) Authorized() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
@@ -0,0 +1,209 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package influxdb_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	influxdata "github.com/influxdata/influxdb/client/v2"
+	"github.com/mainflux/mainflux/pkg/errors"
+	"github.com/mainflux/mainflux/pkg/messaging"
+	"github.com/mainflux/mainflux/pkg/transformers/senml"
+	writer "github.com/mainflux/mainflux/writers/influxdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// influxStub responds to the writes with the status and the body, and
+// counts them.
+type influxStub struct {
+	mu     sync.Mutex
+	status int
+	body   string
+	writes int
+}
+
+func (s *influxStub) set(status int, body string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status, s.body = status, body
+}
+
+func (s *influxStub) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.writes
+}
+
+func (s *influxStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.writes++
+	w.WriteHeader(s.status)
+	fmt.Fprint(w, s.body)
+}
+
+func newStubClient(t *testing.T, stub *influxStub) (influxdata.Client, func()) {
+	ts := httptest.NewServer(stub)
+	client, err := influxdata.NewHTTPClient(influxdata.HTTPConfig{Addr: ts.URL})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	return client, ts.Close
+}
+
+func TestIsUnauthorized(t *testing.T) {
+	cases := []struct {
+		desc string
+		err  error
+		res  bool
+	}{
+		{
+			desc: "InfluxDB 1.x invalid credentials",
+			err:  errors.New(`{"error":"authorization failed"}`),
+			res:  true,
+		},
+		{
+			desc: "InfluxDB 1.x missing write privilege",
+			err:  errors.New(`{"error":"\"reader\" user is not authorized to write to database \"mainflux\""}`),
+			res:  true,
+		},
+		{
+			desc: "InfluxDB 2 read-only token",
+			err:  errors.New(`{"code":"forbidden","message":"insufficient permissions for write"}`),
+			res:  true,
+		},
+		{
+			desc: "InfluxDB 2 invalid token",
+			err:  errors.New(`{"code":"unauthorized","message":"unauthorized access"}`),
+			res:  true,
+		},
+		{
+			desc: "wrapped unauthorized error",
+			err:  errors.Wrap(errors.New("failed to save"), writer.ErrUnauthorized),
+			res:  true,
+		},
+		{
+			desc: "401 response",
+			err:  &writer.StatusError{Code: http.StatusUnauthorized, Body: `{"error":"invalid token"}`},
+			res:  true,
+		},
+		{
+			desc: "403 response",
+			err:  &writer.StatusError{Code: http.StatusForbidden, Body: `{"error":"write denied"}`},
+			res:  true,
+		},
+		{
+			desc: "400 response mentioning authorization",
+			err:  &writer.StatusError{Code: http.StatusBadRequest, Body: `{"error":"field \"unauthorized\" has conflicting type"}`},
+			res:  false,
+		},
+		{
+			desc: "500 response mentioning authorization",
+			err:  &writer.StatusError{Code: http.StatusInternalServerError, Body: `{"error":"authorization failed to load"}`},
+			res:  false,
+		},
+		{
+			desc: "unavailable database",
+			err:  errors.New("connection refused"),
+			res:  false,
+		},
+		{
+			desc: "missing database",
+			err:  errors.New(`{"error":"database not found: \"mainflux\""}`),
+			res:  false,
+		},
+		{
+			desc: "no error",
+			err:  nil,
+			res:  false,
+		},
+	}
+
+	for _, tc := range cases {
+		res := writer.IsUnauthorized(tc.err)
+		assert.Equal(t, tc.res, res, fmt.Sprintf("%s: expected %t got %t\n", tc.desc, tc.res, res))
+	}
+}
+
+func TestAuthzClient(t *testing.T) {
+	msgs, err := senml.New(senml.JSON).Transform(messaging.Message{
+		Channel:   "45",
+		Publisher: "2580",
+		Protocol:  "http",
+		Payload:   []byte(`[{"n":"temp","v":21}]`),
+	})
+	require.Nil(t, err, fmt.Sprintf("Transforming SenML expected to succeed: %s.\n", err))
+
+	stub := &influxStub{}
+	client, stop := newStubClient(t, stub)
+	defer stop()
+	authz := writer.NewAuthzClient(client, testLog)
+	repo := writer.New(authz, testDB)
+
+	cases := []struct {
+		desc   string
+		status int
+		body   string
+		err    error
+		authz  error
+	}{
+		{
+			desc:   "write with read-only token",
+			status: http.StatusForbidden,
+			body:   `{"code":"forbidden","message":"insufficient permissions for write"}`,
+			err:    writer.ErrUnauthorized,
+			authz:  writer.ErrUnauthorized,
+		},
+		{
+			desc:   "write with invalid credentials",
+			status: http.StatusUnauthorized,
+			body:   `{"error":"authorization failed"}`,
+			err:    writer.ErrUnauthorized,
+			authz:  writer.ErrUnauthorized,
+		},
+		{
+			desc:   "write to missing database",
+			status: http.StatusNotFound,
+			body:   `{"error":"database not found: \"test\""}`,
+			err:    errors.New(`{"error":"database not found: \"test\""}`),
+			authz:  writer.ErrUnauthorized,
+		},
+		{
+			desc:   "write with fixed credentials",
+			status: http.StatusNoContent,
+			err:    nil,
+			authz:  nil,
+		},
+	}
+
+	for _, tc := range cases {
+		stub.set(tc.status, tc.body)
+		err := repo.Save(msgs)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s\n", tc.desc, tc.err, err))
+		if tc.err != nil && tc.err != writer.ErrUnauthorized {
+			assert.False(t, errors.Contains(err, writer.ErrUnauthorized), fmt.Sprintf("%s: expected transient error got %s\n", tc.desc, err))
+		}
+		err = authz.Authorized()
+		assert.True(t, errors.Contains(err, tc.authz), fmt.Sprintf("%s: expected authorization state %s got %s\n", tc.desc, tc.authz, err))
+	}
+}
+
+func TestFailoverUnauthorized(t *testing.T) {
+	primary, secondary := &influxStub{}, &influxStub{}
+	primary.set(http.StatusForbidden, `{"error":"\"reader\" user is not authorized to write to database \"test\""}`)
+	secondary.set(http.StatusNoContent, "")
+	pc, stopPrimary := newStubClient(t, primary)
+	defer stopPrimary()
+	sc, stopSecondary := newStubClient(t, secondary)
+	defer stopSecondary()
+
+	client := writer.NewFailoverClient(pc, sc)
+	err := client.Write(batch(t, "", 1))
+	assert.True(t, writer.IsUnauthorized(err), fmt.Sprintf("expected authorization error got %s", err))
+	assert.Equal(t, 1, primary.count(), fmt.Sprintf("expected a write to the primary endpoint got %d", primary.count()))
+	assert.Equal(t, 0, secondary.count(), fmt.Sprintf("expected the rejected write not to be retried got %d", secondary.count()))
+}
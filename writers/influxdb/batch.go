@@ -0,0 +1,326 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package influxdb
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/metrics"
+	influxdata "github.com/influxdata/influxdb/client/v2"
+	"github.com/mainflux/mainflux/logger"
+	"github.com/mainflux/mainflux/pkg/errors"
+)
+
+// flushMethod is the method label of the batch write metrics.
+const flushMethod = "flush_batch"
+
+// ErrClientClosed indicates a write to a batching client that is closed.
+var ErrClientClosed = errors.New("batching client is closed")
+
+// BatchConfig defines when the buffered points are flushed.
+type BatchConfig struct {
+	// Size is the number of buffered points that triggers a flush.
+	Size int
+
+	// Interval is the longest time points are buffered for. If zero,
+	// points are flushed only when Size points are buffered.
+	Interval time.Duration
+
+	// Depth, if set, reports the number of buffered points.
+	Depth metrics.Gauge
+
+	// OldestAge, if set, reports on each flush the time in seconds the
+	// oldest buffered point waited for it, or zero if the buffer was
+	// empty. Unlike Depth, it grows when the flushes stall.
+	OldestAge metrics.Gauge
+
+	// Counter and Latency, if set, count the batch writes and observe
+	// their duration with the flush_batch method label.
+	Counter metrics.Counter
+	Latency metrics.Histogram
+
+	// Processing, if set, observes the time in seconds between the write
+	// of the points to the batching client and the successful write of
+	// their batch, which includes the time they spend buffered.
+	Processing metrics.Histogram
+}
+
+// BufferSummary describes the points buffered for the next batch write,
+// without their field values.
+type BufferSummary struct {
+	// Points is the number of buffered points.
+	Points int `json:"points"`
+
+	// Bytes is the size of the buffered points in line protocol.
+	Bytes int `json:"bytes"`
+
+	// Since is when the oldest buffered point was buffered. It is nil if
+	// the buffer is empty.
+	Since *time.Time `json:"since,omitempty"`
+
+	// Series contains the number of buffered points of each series.
+	Series []SeriesSummary `json:"series"`
+}
+
+// SeriesSummary contains the number of buffered points of a series, which
+// is identified by the measurement and the tags of its points.
+type SeriesSummary struct {
+	Database        string `json:"database"`
+	RetentionPolicy string `json:"retention_policy,omitempty"`
+	Series          string `json:"series"`
+	Points          int    `json:"points"`
+}
+
+// BatchingClient is an InfluxDB client which writes the points in batches.
+type BatchingClient interface {
+	influxdata.Client
+
+	// Summary returns the summary of the buffered points.
+	Summary() BufferSummary
+}
+
+var _ BatchingClient = (*batchingClient)(nil)
+
+type batchingClient struct {
+	influxdata.Client
+	cfg     BatchConfig
+	logger  logger.Logger
+	mu      sync.Mutex
+	pending map[influxdata.BatchPointsConfig]influxdata.BatchPoints
+	// received holds the receipt time of every write buffered in the
+	// batch with the same key.
+	received map[influxdata.BatchPointsConfig][]time.Time
+	count    int
+	since    time.Time
+	closed   bool
+	done     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewBatchingClient returns a client which buffers the written points and
+// writes them to the wrapped client in batches, once the configured number
+// of points is buffered or the flush interval elapses. A write that fills
+// the buffer returns the error of the flush; errors of the periodic
+// flushes are logged. Closing the client flushes the buffered points
+// before closing the wrapped client.
+func NewBatchingClient(client influxdata.Client, cfg BatchConfig, logger logger.Logger) BatchingClient {
+	c := &batchingClient{
+		Client:   client,
+		cfg:      cfg,
+		logger:   logger,
+		pending:  make(map[influxdata.BatchPointsConfig]influxdata.BatchPoints),
+		received: make(map[influxdata.BatchPointsConfig][]time.Time),
+		done:     make(chan struct{}),
+	}
+	if cfg.Interval > 0 {
+		c.wg.Add(1)
+		go c.run()
+	}
+	return c
+}
+
+func (c *batchingClient) Write(bp influxdata.BatchPoints) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return ErrClientClosed
+	}
+
+	key := influxdata.BatchPointsConfig{
+		Precision:        bp.Precision(),
+		Database:         bp.Database(),
+		RetentionPolicy:  bp.RetentionPolicy(),
+		WriteConsistency: bp.WriteConsistency(),
+	}
+	pending, ok := c.pending[key]
+	if !ok {
+		var err error
+		if pending, err = influxdata.NewBatchPoints(key); err != nil {
+			return err
+		}
+		c.pending[key] = pending
+	}
+	pts := bp.Points()
+	now := time.Now()
+	if c.count == 0 && len(pts) > 0 {
+		c.since = now
+	}
+	if len(pts) > 0 {
+		c.received[key] = append(c.received[key], now)
+	}
+	pending.AddPoints(pts)
+	c.count += len(pts)
+	c.setDepth()
+
+	if c.count < c.cfg.Size {
+		return nil
+	}
+	return c.flush()
+}
+
+func (c *batchingClient) Summary() BufferSummary {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	sum := BufferSummary{Series: []SeriesSummary{}}
+	if c.count > 0 {
+		since := c.since
+		sum.Since = &since
+	}
+
+	series := make(map[SeriesSummary]int)
+	for key, bp := range c.pending {
+		for _, pt := range bp.Points() {
+			s := SeriesSummary{
+				Database:        key.Database,
+				RetentionPolicy: key.RetentionPolicy,
+				Series:          seriesKey(pt),
+			}
+			series[s]++
+			sum.Points++
+			sum.Bytes += len(pt.String())
+		}
+	}
+	for s, n := range series {
+		s.Points = n
+		sum.Series = append(sum.Series, s)
+	}
+	sort.Slice(sum.Series, func(i, j int) bool {
+		a, b := sum.Series[i], sum.Series[j]
+		if a.Database != b.Database {
+			return a.Database < b.Database
+		}
+		if a.RetentionPolicy != b.RetentionPolicy {
+			return a.RetentionPolicy < b.RetentionPolicy
+		}
+		return a.Series < b.Series
+	})
+
+	return sum
+}
+
+// seriesKey returns the measurement and the sorted tags of the point.
+func seriesKey(pt *influxdata.Point) string {
+	tags := pt.Tags()
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := []string{pt.Name()}
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf("%s=%s", k, tags[k]))
+	}
+	return strings.Join(parts, ",")
+}
+
+func (c *batchingClient) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return ErrClientClosed
+	}
+	c.closed = true
+	c.mu.Unlock()
+
+	close(c.done)
+	c.wg.Wait()
+
+	c.mu.Lock()
+	err := c.flush()
+	c.mu.Unlock()
+
+	if cerr := c.Client.Close(); cerr != nil && err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (c *batchingClient) run() {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(c.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.mu.Lock()
+			if err := c.flush(); err != nil {
+				c.logger.Warn(fmt.Sprintf("Failed to flush buffered points: %s", err))
+			}
+			c.mu.Unlock()
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// flush writes all the buffered points. The points of failed batches are
+// dropped so that an unavailable database doesn't make the buffer grow
+// without bounds. It must be called with the lock held.
+func (c *batchingClient) flush() error {
+	c.setAge()
+	var err error
+	for key, bp := range c.pending {
+		werr := c.write(bp)
+		if werr != nil && err == nil {
+			err = werr
+		}
+		if werr == nil {
+			c.observe(c.received[key])
+		}
+		delete(c.pending, key)
+		delete(c.received, key)
+	}
+	c.count = 0
+	c.setDepth()
+	return err
+}
+
+func (c *batchingClient) write(bp influxdata.BatchPoints) error {
+	defer func(begin time.Time) {
+		if c.cfg.Counter != nil {
+			c.cfg.Counter.With("method", flushMethod).Add(1)
+		}
+		if c.cfg.Latency != nil {
+			c.cfg.Latency.With("method", flushMethod).Observe(time.Since(begin).Seconds())
+		}
+	}(time.Now())
+
+	return c.Client.Write(bp)
+}
+
+func (c *batchingClient) observe(received []time.Time) {
+	if c.cfg.Processing == nil {
+		return
+	}
+	for _, t := range received {
+		c.cfg.Processing.Observe(time.Since(t).Seconds())
+	}
+}
+
+func (c *batchingClient) setDepth() {
+	if c.cfg.Depth != nil {
+		c.cfg.Depth.Set(float64(c.count))
+	}
+}
+
+// setAge reports the age of the oldest buffered point. It must be called
+// with the lock held.
+func (c *batchingClient) setAge() {
+	if c.cfg.OldestAge == nil {
+		return
+	}
+	age := 0.0
+	if c.count > 0 {
+		age = time.Since(c.since).Seconds()
+	}
+	c.cfg.OldestAge.Set(age)
+}
@@ -0,0 +1,342 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package influxdb_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/metrics"
+	influxdata "github.com/influxdata/influxdb/client/v2"
+	"github.com/mainflux/mainflux/pkg/errors"
+	writer "github.com/mainflux/mainflux/writers/influxdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// batchMock records the written points and fails writes while it is down.
+type batchMock struct {
+	influxdata.Client
+	mu     sync.Mutex
+	writes int
+	points int
+	down   bool
+	closed bool
+}
+
+func (b *batchMock) Write(bp influxdata.BatchPoints) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.down {
+		return errors.New("endpoint unavailable")
+	}
+	b.writes++
+	b.points += len(bp.Points())
+	return nil
+}
+
+func (b *batchMock) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	return nil
+}
+
+func (b *batchMock) state() (int, int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.writes, b.points
+}
+
+type gaugeMock struct {
+	mu    sync.Mutex
+	value float64
+}
+
+func (g *gaugeMock) With(...string) metrics.Gauge { return g }
+
+func (g *gaugeMock) Set(value float64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.value = value
+}
+
+func (g *gaugeMock) Add(delta float64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.value += delta
+}
+
+func (g *gaugeMock) get() float64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.value
+}
+
+// methodMock counts the observations by method label.
+type methodMock struct {
+	mu     sync.Mutex
+	method string
+	counts map[string]int
+}
+
+func (m *methodMock) with(labelValues ...string) *methodMock {
+	method := ""
+	for i := 0; i+1 < len(labelValues); i += 2 {
+		if labelValues[i] == "method" {
+			method = labelValues[i+1]
+		}
+	}
+	return &methodMock{method: method, counts: m.counts}
+}
+
+func (m *methodMock) observe() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.counts[m.method]++
+}
+
+type counterMock struct{ *methodMock }
+
+func (c counterMock) With(labelValues ...string) metrics.Counter {
+	return counterMock{c.with(labelValues...)}
+}
+
+func (c counterMock) Add(float64) { c.observe() }
+
+type histogramMock struct{ *methodMock }
+
+func (h histogramMock) With(labelValues ...string) metrics.Histogram {
+	return histogramMock{h.with(labelValues...)}
+}
+
+func (h histogramMock) Observe(float64) { h.observe() }
+
+// valueMock records the observed values.
+type valueMock struct {
+	mu     sync.Mutex
+	values []float64
+}
+
+func (v *valueMock) With(...string) metrics.Histogram { return v }
+
+func (v *valueMock) Observe(value float64) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.values = append(v.values, value)
+}
+
+func (v *valueMock) get() []float64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return append([]float64{}, v.values...)
+}
+
+func batch(t *testing.T, policy string, n int) influxdata.BatchPoints {
+	bp, err := influxdata.NewBatchPoints(influxdata.BatchPointsConfig{Database: testDB, RetentionPolicy: policy})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	for i := 0; i < n; i++ {
+		pt, err := influxdata.NewPoint("messages", nil, map[string]interface{}{"value": float64(i)}, time.Now())
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+		bp.AddPoint(pt)
+	}
+	return bp
+}
+
+func TestBatchingClientSize(t *testing.T) {
+	bm := &batchMock{}
+	depth := &gaugeMock{}
+	client := writer.NewBatchingClient(bm, writer.BatchConfig{Size: 5, Depth: depth}, testLog)
+
+	err := client.Write(batch(t, "", 2))
+	assert.Nil(t, err, fmt.Sprintf("expected no error got %s", err))
+	err = client.Write(batch(t, "one_day", 2))
+	assert.Nil(t, err, fmt.Sprintf("expected no error got %s", err))
+
+	writes, points := bm.state()
+	assert.Equal(t, 0, writes, fmt.Sprintf("expected no writes before the batch is full got %d", writes))
+	assert.Equal(t, float64(4), depth.get(), fmt.Sprintf("expected buffer depth 4 got %v", depth.get()))
+
+	err = client.Write(batch(t, "", 1))
+	assert.Nil(t, err, fmt.Sprintf("expected no error got %s", err))
+
+	writes, points = bm.state()
+	assert.Equal(t, 2, writes, fmt.Sprintf("expected a write per retention policy got %d", writes))
+	assert.Equal(t, 5, points, fmt.Sprintf("expected 5 points written got %d", points))
+	assert.Equal(t, float64(0), depth.get(), fmt.Sprintf("expected empty buffer got %v", depth.get()))
+}
+
+func TestBatchingClientInterval(t *testing.T) {
+	bm := &batchMock{}
+	client := writer.NewBatchingClient(bm, writer.BatchConfig{Size: 100, Interval: 10 * time.Millisecond}, testLog)
+	defer client.Close()
+
+	err := client.Write(batch(t, "", 3))
+	assert.Nil(t, err, fmt.Sprintf("expected no error got %s", err))
+
+	assert.Eventually(t, func() bool {
+		_, points := bm.state()
+		return points == 3
+	}, time.Second, 5*time.Millisecond, "expected buffered points to be flushed after the interval")
+}
+
+func TestBatchingClientClose(t *testing.T) {
+	bm := &batchMock{}
+	client := writer.NewBatchingClient(bm, writer.BatchConfig{Size: 100, Interval: time.Hour}, testLog)
+
+	err := client.Write(batch(t, "", 3))
+	assert.Nil(t, err, fmt.Sprintf("expected no error got %s", err))
+
+	err = client.Close()
+	assert.Nil(t, err, fmt.Sprintf("expected no error got %s", err))
+	_, points := bm.state()
+	assert.Equal(t, 3, points, fmt.Sprintf("expected buffered points to be flushed on close got %d", points))
+	assert.True(t, bm.closed, "expected wrapped client to be closed")
+
+	err = client.Write(batch(t, "", 1))
+	assert.True(t, errors.Contains(err, writer.ErrClientClosed), fmt.Sprintf("expected %s got %s", writer.ErrClientClosed, err))
+}
+
+func TestBatchingClientFlushError(t *testing.T) {
+	bm := &batchMock{down: true}
+	depth := &gaugeMock{}
+	client := writer.NewBatchingClient(bm, writer.BatchConfig{Size: 2, Depth: depth}, testLog)
+
+	err := client.Write(batch(t, "", 2))
+	assert.NotNil(t, err, "expected flush error")
+	assert.Equal(t, float64(0), depth.get(), fmt.Sprintf("expected failed points to be dropped got depth %v", depth.get()))
+
+	bm.mu.Lock()
+	bm.down = false
+	bm.mu.Unlock()
+	err = client.Write(batch(t, "", 2))
+	assert.Nil(t, err, fmt.Sprintf("expected no error got %s", err))
+	_, points := bm.state()
+	assert.Equal(t, 2, points, fmt.Sprintf("expected only new points to be written got %d", points))
+}
+
+func TestBatchingClientMetrics(t *testing.T) {
+	bm := &batchMock{}
+	counts := map[string]int{}
+	counter := counterMock{&methodMock{counts: counts}}
+	latency := histogramMock{&methodMock{counts: map[string]int{}}}
+	client := writer.NewBatchingClient(bm, writer.BatchConfig{Size: 2, Counter: counter, Latency: latency}, testLog)
+
+	for i := 0; i < 3; i++ {
+		err := client.Write(batch(t, "", 2))
+		assert.Nil(t, err, fmt.Sprintf("expected no error got %s", err))
+	}
+	err := client.Write(batch(t, "one_day", 1))
+	assert.Nil(t, err, fmt.Sprintf("expected no error got %s", err))
+	err = client.Close()
+	assert.Nil(t, err, fmt.Sprintf("expected no error got %s", err))
+
+	assert.Equal(t, map[string]int{"flush_batch": 4}, counts, fmt.Sprintf("expected 4 batch writes counted got %v", counts))
+	assert.Equal(t, map[string]int{"flush_batch": 4}, latency.counts, fmt.Sprintf("expected 4 batch writes observed got %v", latency.counts))
+}
+
+func TestBatchingClientSummary(t *testing.T) {
+	bm := &batchMock{}
+	client := writer.NewBatchingClient(bm, writer.BatchConfig{Size: 100}, testLog)
+
+	sum := client.Summary()
+	assert.Equal(t, 0, sum.Points, fmt.Sprintf("expected empty buffer got %d points", sum.Points))
+	assert.Nil(t, sum.Since, fmt.Sprintf("expected no buffering time got %v", sum.Since))
+
+	before := time.Now()
+	bp := batch(t, "", 2)
+	pt, err := influxdata.NewPoint("messages", map[string]string{"channel": "1"}, map[string]interface{}{"value": "secret"}, time.Now())
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	bp.AddPoint(pt)
+	err = client.Write(bp)
+	assert.Nil(t, err, fmt.Sprintf("expected no error got %s", err))
+	err = client.Write(batch(t, "one_day", 1))
+	assert.Nil(t, err, fmt.Sprintf("expected no error got %s", err))
+
+	bytes := len(pt.String())
+	for _, p := range bp.Points()[:2] {
+		bytes += len(p.String())
+	}
+	bytes += len(batch(t, "one_day", 1).Points()[0].String())
+
+	sum = client.Summary()
+	assert.Equal(t, 4, sum.Points, fmt.Sprintf("expected 4 buffered points got %d", sum.Points))
+	assert.Equal(t, bytes, sum.Bytes, fmt.Sprintf("expected %d buffered bytes got %d", bytes, sum.Bytes))
+	require.NotNil(t, sum.Since, "expected buffering time")
+	assert.False(t, sum.Since.Before(before), fmt.Sprintf("expected buffering time after %s got %s", before, sum.Since))
+
+	series := []writer.SeriesSummary{
+		{Database: testDB, Series: "messages", Points: 2},
+		{Database: testDB, Series: "messages,channel=1", Points: 1},
+		{Database: testDB, RetentionPolicy: "one_day", Series: "messages", Points: 1},
+	}
+	assert.Equal(t, series, sum.Series, fmt.Sprintf("expected series %v got %v", series, sum.Series))
+	for _, s := range sum.Series {
+		assert.NotContains(t, s.Series, "secret", "expected field values to be left out of the summary")
+	}
+
+	err = client.Close()
+	assert.Nil(t, err, fmt.Sprintf("expected no error got %s", err))
+	sum = client.Summary()
+	assert.Equal(t, 0, sum.Points, fmt.Sprintf("expected flushed buffer got %d points", sum.Points))
+}
+
+func TestBatchingClientProcessingLatency(t *testing.T) {
+	bm := &batchMock{}
+	processing := &valueMock{}
+	client := writer.NewBatchingClient(bm, writer.BatchConfig{Size: 3, Processing: processing}, testLog)
+
+	delay := 50 * time.Millisecond
+	err := client.Write(batch(t, "", 2))
+	assert.Nil(t, err, fmt.Sprintf("expected no error got %s", err))
+	time.Sleep(delay)
+	err = client.Write(batch(t, "", 1))
+	assert.Nil(t, err, fmt.Sprintf("expected no error got %s", err))
+
+	values := processing.get()
+	require.Len(t, values, 2, fmt.Sprintf("expected a value per buffered write got %v", values))
+	assert.GreaterOrEqual(t, values[0], delay.Seconds(), fmt.Sprintf("expected latency of at least %s got %vs", delay, values[0]))
+	assert.Less(t, values[0], (delay + time.Second).Seconds(), fmt.Sprintf("expected latency close to %s got %vs", delay, values[0]))
+	assert.Less(t, values[1], values[0], fmt.Sprintf("expected latest write to be buffered shorter got %v", values))
+
+	// Dropped points are not observed.
+	bm.mu.Lock()
+	bm.down = true
+	bm.mu.Unlock()
+	err = client.Write(batch(t, "", 3))
+	assert.NotNil(t, err, "expected flush error")
+	values = processing.get()
+	assert.Len(t, values, 2, fmt.Sprintf("expected failed writes not to be observed got %v", values))
+}
+
+func TestBatchingClientOldestAge(t *testing.T) {
+	bm := &batchMock{}
+	age := &gaugeMock{}
+	client := writer.NewBatchingClient(bm, writer.BatchConfig{Size: 100, Interval: time.Hour, OldestAge: age}, testLog)
+
+	wait := 50 * time.Millisecond
+	err := client.Write(batch(t, "", 1))
+	assert.Nil(t, err, fmt.Sprintf("expected no error got %s", err))
+	time.Sleep(wait)
+	err = client.Write(batch(t, "", 1))
+	assert.Nil(t, err, fmt.Sprintf("expected no error got %s", err))
+	assert.Equal(t, float64(0), age.get(), fmt.Sprintf("expected age to be reported on flush only got %v", age.get()))
+
+	err = client.Close()
+	assert.Nil(t, err, fmt.Sprintf("expected no error got %s", err))
+	assert.GreaterOrEqual(t, age.get(), wait.Seconds(), fmt.Sprintf("expected age of at least %v got %v", wait.Seconds(), age.get()))
+	assert.Less(t, age.get(), time.Second.Seconds(), fmt.Sprintf("expected age of the oldest point only got %v", age.get()))
+}
+
+func TestBatchingClientOldestAgeEmpty(t *testing.T) {
+	age := &gaugeMock{value: 1}
+	client := writer.NewBatchingClient(&batchMock{}, writer.BatchConfig{Size: 100, Interval: 10 * time.Millisecond, OldestAge: age}, testLog)
+	defer client.Close()
+
+	assert.Eventually(t, func() bool {
+		return age.get() == 0
+	}, time.Second, 5*time.Millisecond, "expected zero age of an empty buffer")
+}
@@ -0,0 +1,135 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package influxdb
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	influxdata "github.com/influxdata/influxdb/client/v2"
+	"github.com/mainflux/mainflux/pkg/errors"
+)
+
+var (
+	// ErrInvalidConsistency indicates that the write consistency level is
+	// not supported.
+	ErrInvalidConsistency = errors.New("invalid write consistency")
+
+	errNoEndpoints = errors.New("no InfluxDB endpoints configured")
+)
+
+var consistencies = map[string]bool{
+	"":       true,
+	"any":    true,
+	"one":    true,
+	"quorum": true,
+	"all":    true,
+}
+
+// ValidateConsistency checks that the write consistency level is one of
+// the levels supported by InfluxDB clusters. The empty level leaves the
+// choice to the server.
+func ValidateConsistency(level string) error {
+	if !consistencies[level] {
+		return errors.Wrap(ErrInvalidConsistency, fmt.Errorf("%s", level))
+	}
+	return nil
+}
+
+var _ influxdata.Client = (*failoverClient)(nil)
+
+type failoverClient struct {
+	mu      sync.Mutex
+	clients []influxdata.Client
+	current int
+}
+
+// NewFailoverClient returns the client that sends each request to the
+// endpoint which last succeeded, and on failure retries the request on
+// the following endpoints in order. The error of the last endpoint is
+// returned if none of them succeeds. Requests rejected for lack of
+// authorization are not retried, since the endpoints share the
+// credentials.
+func NewFailoverClient(clients ...influxdata.Client) influxdata.Client {
+	return &failoverClient{clients: clients}
+}
+
+func (fc *failoverClient) Ping(timeout time.Duration) (rtt time.Duration, version string, err error) {
+	err = fc.do(func(c influxdata.Client) error {
+		var err error
+		rtt, version, err = c.Ping(timeout)
+		return err
+	})
+	return rtt, version, err
+}
+
+func (fc *failoverClient) Write(bp influxdata.BatchPoints) error {
+	return fc.do(func(c influxdata.Client) error {
+		return c.Write(bp)
+	})
+}
+
+func (fc *failoverClient) Query(q influxdata.Query) (res *influxdata.Response, err error) {
+	err = fc.do(func(c influxdata.Client) error {
+		var err error
+		res, err = c.Query(q)
+		return err
+	})
+	return res, err
+}
+
+func (fc *failoverClient) QueryCtx(ctx context.Context, q influxdata.Query) (res *influxdata.Response, err error) {
+	err = fc.do(func(c influxdata.Client) error {
+		var err error
+		res, err = c.QueryCtx(ctx, q)
+		return err
+	})
+	return res, err
+}
+
+func (fc *failoverClient) QueryAsChunk(q influxdata.Query) (res *influxdata.ChunkedResponse, err error) {
+	err = fc.do(func(c influxdata.Client) error {
+		var err error
+		res, err = c.QueryAsChunk(q)
+		return err
+	})
+	return res, err
+}
+
+func (fc *failoverClient) Close() error {
+	var err error
+	for _, c := range fc.clients {
+		if cerr := c.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+func (fc *failoverClient) do(req func(influxdata.Client) error) error {
+	if len(fc.clients) == 0 {
+		return errNoEndpoints
+	}
+
+	fc.mu.Lock()
+	start := fc.current
+	fc.mu.Unlock()
+
+	var err error
+	for i := range fc.clients {
+		idx := (start + i) % len(fc.clients)
+		if err = req(fc.clients[idx]); err == nil {
+			fc.mu.Lock()
+			fc.current = idx
+			fc.mu.Unlock()
+			return nil
+		}
+		if IsUnauthorized(err) {
+			return err
+		}
+	}
+	return err
+}
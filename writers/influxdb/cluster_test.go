@@ -0,0 +1,140 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package influxdb_test
+
+import (
+	"fmt"
+	"testing"
+
+	influxdata "github.com/influxdata/influxdb/client/v2"
+	"github.com/mainflux/mainflux/pkg/errors"
+	"github.com/mainflux/mainflux/pkg/messaging"
+	"github.com/mainflux/mainflux/pkg/transformers/senml"
+	writer "github.com/mainflux/mainflux/writers/influxdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// endpointMock counts the writes and fails them while it is down.
+type endpointMock struct {
+	influxdata.Client
+	down   bool
+	writes int
+}
+
+func (e *endpointMock) Write(bp influxdata.BatchPoints) error {
+	if e.down {
+		return errors.New("endpoint unavailable")
+	}
+	e.writes++
+	return nil
+}
+
+func TestFailover(t *testing.T) {
+	msgs, err := senml.New(senml.JSON).Transform(messaging.Message{
+		Channel:   "45",
+		Publisher: "2580",
+		Protocol:  "http",
+		Payload:   []byte(`[{"n":"temp","v":21}]`),
+	})
+	require.Nil(t, err, fmt.Sprintf("Transforming SenML expected to succeed: %s.\n", err))
+
+	primary, secondary := &endpointMock{}, &endpointMock{}
+	repo := writer.New(writer.NewFailoverClient(primary, secondary), testDB)
+
+	cases := []struct {
+		desc          string
+		primaryDown   bool
+		secondaryDown bool
+		primary       int
+		secondary     int
+		fail          bool
+	}{
+		{
+			desc:      "write to available primary endpoint",
+			primary:   1,
+			secondary: 0,
+		},
+		{
+			desc:        "fail over to secondary endpoint",
+			primaryDown: true,
+			primary:     1,
+			secondary:   1,
+		},
+		{
+			desc:      "keep writing to secondary endpoint after primary recovery",
+			primary:   1,
+			secondary: 2,
+		},
+		{
+			desc:          "fail back to primary endpoint",
+			secondaryDown: true,
+			primary:       2,
+			secondary:     2,
+		},
+		{
+			desc:          "fail to write to unavailable endpoints",
+			primaryDown:   true,
+			secondaryDown: true,
+			primary:       2,
+			secondary:     2,
+			fail:          true,
+		},
+	}
+
+	for _, tc := range cases {
+		primary.down, secondary.down = tc.primaryDown, tc.secondaryDown
+		err := repo.Save(msgs)
+		assert.Equal(t, tc.fail, err != nil, fmt.Sprintf("%s: expected failure %t got error %v\n", tc.desc, tc.fail, err))
+		assert.Equal(t, tc.primary, primary.writes, fmt.Sprintf("%s: expected %d primary writes got %d\n", tc.desc, tc.primary, primary.writes))
+		assert.Equal(t, tc.secondary, secondary.writes, fmt.Sprintf("%s: expected %d secondary writes got %d\n", tc.desc, tc.secondary, secondary.writes))
+	}
+}
+
+func TestWriteConsistency(t *testing.T) {
+	msgs, err := senml.New(senml.JSON).Transform(messaging.Message{
+		Channel:   "45",
+		Publisher: "2580",
+		Protocol:  "http",
+		Payload:   []byte(`[{"n":"temp","v":21}]`),
+	})
+	require.Nil(t, err, fmt.Sprintf("Transforming SenML expected to succeed: %s.\n", err))
+
+	cases := []struct {
+		desc        string
+		consistency string
+		err         error
+	}{
+		{
+			desc:        "write with server default consistency",
+			consistency: "",
+			err:         nil,
+		},
+		{
+			desc:        "write with quorum consistency",
+			consistency: "quorum",
+			err:         nil,
+		},
+		{
+			desc:        "validate unknown consistency",
+			consistency: "most",
+			err:         writer.ErrInvalidConsistency,
+		},
+	}
+
+	for _, tc := range cases {
+		err := writer.ValidateConsistency(tc.consistency)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s\n", tc.desc, tc.err, err))
+		if tc.err != nil {
+			continue
+		}
+
+		cm := &clientMock{}
+		repo := writer.NewWithConfig(cm, writer.Config{Database: testDB, WriteConsistency: tc.consistency})
+		err = repo.Save(msgs)
+		require.Nil(t, err, fmt.Sprintf("%s: Save operation expected to succeed: %s.\n", tc.desc, err))
+		require.Equal(t, 1, len(cm.batches), fmt.Sprintf("%s: expected 1 batch got %d\n", tc.desc, len(cm.batches)))
+		assert.Equal(t, tc.consistency, cm.batches[0].WriteConsistency(), fmt.Sprintf("%s: expected consistency %s got %s\n", tc.desc, tc.consistency, cm.batches[0].WriteConsistency()))
+	}
+}
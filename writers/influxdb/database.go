@@ -0,0 +1,93 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package influxdb
+
+import (
+	"fmt"
+	"time"
+
+	influxdata "github.com/influxdata/influxdb/client/v2"
+	"github.com/mainflux/mainflux/pkg/errors"
+)
+
+var (
+	// ErrMissingDatabase indicates that the writer database doesn't exist
+	// and creating it is disabled.
+	ErrMissingDatabase = errors.New("database does not exist")
+
+	// ErrInvalidDuration indicates a database retention duration which
+	// InfluxDB doesn't accept.
+	ErrInvalidDuration = errors.New("invalid database retention duration")
+
+	errRetrieveDatabases = errors.New("failed to retrieve databases")
+	errCreateDatabase    = errors.New("failed to create database")
+)
+
+// minDuration is the shortest retention duration InfluxDB accepts.
+const minDuration = time.Hour
+
+// DatabaseConfig defines how the writer database is checked at startup.
+type DatabaseConfig struct {
+	// Create creates the database if it doesn't exist.
+	Create bool
+
+	// Duration is the default retention duration of the created database.
+	// Zero keeps the data forever.
+	Duration time.Duration
+}
+
+// EnsureDatabase checks that the writer database exists. A missing database
+// is created if the configuration allows it, otherwise ErrMissingDatabase
+// is returned.
+func EnsureDatabase(client influxdata.Client, db string, cfg DatabaseConfig) error {
+	if cfg.Duration != 0 && cfg.Duration < minDuration {
+		return errors.Wrap(ErrInvalidDuration, fmt.Errorf("%s is shorter than %s", cfg.Duration, minDuration))
+	}
+
+	exists, err := databaseExists(client, db)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+	if !cfg.Create {
+		return errors.Wrap(ErrMissingDatabase, fmt.Errorf("%s", db))
+	}
+
+	cmd := fmt.Sprintf("CREATE DATABASE %q", db)
+	if cfg.Duration != 0 {
+		cmd = fmt.Sprintf("%s WITH DURATION %ds", cmd, int64(cfg.Duration/time.Second))
+	}
+	resp, err := client.Query(influxdata.NewQuery(cmd, "", ""))
+	if err != nil {
+		return errors.Wrap(errCreateDatabase, err)
+	}
+	if resp.Error() != nil {
+		return errors.Wrap(errCreateDatabase, resp.Error())
+	}
+	return nil
+}
+
+func databaseExists(client influxdata.Client, db string) (bool, error) {
+	resp, err := client.Query(influxdata.NewQuery("SHOW DATABASES", "", ""))
+	if err != nil {
+		return false, errors.Wrap(errRetrieveDatabases, err)
+	}
+	if resp.Error() != nil {
+		return false, errors.Wrap(errRetrieveDatabases, resp.Error())
+	}
+
+	for _, res := range resp.Results {
+		for _, s := range res.Series {
+			for _, v := range s.Values {
+				// The database name is the only column of the result.
+				if name, ok := v[0].(string); ok && name == db {
+					return true, nil
+				}
+			}
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,37 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package influxdb
+
+import (
+	"fmt"
+	"strings"
+
+	influxdata "github.com/influxdata/influxdb/client/v2"
+	"github.com/mainflux/mainflux/logger"
+)
+
+var _ influxdata.Client = (*dryRunClient)(nil)
+
+type dryRunClient struct {
+	influxdata.Client
+	logger logger.Logger
+}
+
+// NewDryRunClient returns the client which logs the points of the writes
+// in line protocol at the debug level instead of writing them. The pings
+// and the queries are sent to the wrapped client, so that the connection
+// to InfluxDB is still checked.
+func NewDryRunClient(client influxdata.Client, logger logger.Logger) influxdata.Client {
+	return dryRunClient{Client: client, logger: logger}
+}
+
+func (c dryRunClient) Write(bp influxdata.BatchPoints) error {
+	pts := bp.Points()
+	lines := make([]string, len(pts))
+	for i, pt := range pts {
+		lines[i] = pt.String()
+	}
+	c.logger.Debug(fmt.Sprintf("Dry run, not writing to database %s:\n%s", bp.Database(), strings.Join(lines, "\n")))
+	return nil
+}
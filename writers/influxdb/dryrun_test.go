@@ -0,0 +1,57 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package influxdb_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+
+	log "github.com/mainflux/mainflux/logger"
+	"github.com/mainflux/mainflux/pkg/messaging"
+	"github.com/mainflux/mainflux/pkg/transformers/senml"
+	"github.com/mainflux/mainflux/writers"
+	writer "github.com/mainflux/mainflux/writers/influxdb"
+	"github.com/mainflux/mainflux/writers/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDryRun(t *testing.T) {
+	msg := messaging.Message{
+		Channel:   "45",
+		Publisher: "2580",
+		Protocol:  "http",
+		Payload:   []byte(`[{"n":"temp","v":21}]`),
+	}
+
+	var buf bytes.Buffer
+	logger, err := log.New(&buf, log.Debug.String())
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+
+	cm := &clientMock{databases: []string{testDB}}
+	client := writer.NewDryRunClient(cm, logger)
+	ps := mocks.NewPubSub()
+	consumer, err := writers.StartConsumer(ps, writer.New(client, testDB), senml.New(senml.JSON), writers.Config{
+		Streams: []writers.Stream{{Subject: "channels.45"}},
+	}, logger)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+
+	for i := 0; i < 2; i++ {
+		err = ps.Publish("channels.45", msg)
+		assert.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	}
+	assert.Empty(t, cm.batches, fmt.Sprintf("expected no writes got %d", len(cm.batches)))
+	assert.Contains(t, buf.String(), "messages,channel=45,name=temp,publisher=2580 ", fmt.Sprintf("expected the points to be logged in line protocol got %s", buf.String()))
+
+	err = writer.EnsureDatabase(client, testDB, writer.DatabaseConfig{})
+	assert.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	assert.NotEmpty(t, cm.commands, "expected the queries to be sent")
+
+	rep, err := consumer.Shutdown(context.Background())
+	assert.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	assert.Equal(t, uint64(2), rep.Consumed, fmt.Sprintf("expected 2 consumed messages got %d", rep.Consumed))
+	assert.Equal(t, uint64(2), rep.Written, fmt.Sprintf("expected 2 written messages got %d", rep.Written))
+}
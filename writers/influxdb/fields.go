@@ -8,7 +8,10 @@ import (
 
 type fields map[string]interface{}
 
-func senmlFields(msg senml.Message) fields {
+// senmlFields returns the fields of the SenML record. The record name,
+// resolved from the base name and the name during normalization, is
+// stored as a tag, so the numeric value is stored with the valueField key.
+func senmlFields(msg senml.Message, valueField string) fields {
 	updateTime := strconv.FormatFloat(msg.UpdateTime, 'f', -1, 64)
 	ret := fields{
 		"protocol":   msg.Protocol,
@@ -18,7 +21,7 @@ func senmlFields(msg senml.Message) fields {
 
 	switch {
 	case msg.Value != nil:
-		ret["value"] = *msg.Value
+		ret[valueField] = *msg.Value
 	case msg.StringValue != nil:
 		ret["stringValue"] = *msg.StringValue
 	case msg.DataValue != nil:
@@ -0,0 +1,124 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package influxdb
+
+import (
+	"strings"
+
+	"github.com/mainflux/mainflux/pkg/transformers/json"
+	"github.com/mainflux/mainflux/pkg/transformers/senml"
+)
+
+const (
+	geohashTag = "geohash"
+
+	// MaxGeohashPrecision is the maximum number of geohash characters.
+	MaxGeohashPrecision = 12
+
+	latKey = "lat"
+	lonKey = "lon"
+)
+
+const base32 = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// geohash encodes the coordinates into a geohash of the given number of
+// characters.
+func geohash(lat, lon float64, precision int) string {
+	latRange := [2]float64{-90, 90}
+	lonRange := [2]float64{-180, 180}
+
+	var hash strings.Builder
+	even := true
+	idx, bit := 0, 0
+	for hash.Len() < precision {
+		r, v := &latRange, lat
+		if even {
+			r, v = &lonRange, lon
+		}
+		mid := (r[0] + r[1]) / 2
+		idx <<= 1
+		if v >= mid {
+			idx |= 1
+			r[0] = mid
+		} else {
+			r[1] = mid
+		}
+		even = !even
+
+		if bit++; bit == 5 {
+			hash.WriteByte(base32[idx])
+			idx, bit = 0, 0
+		}
+	}
+	return hash.String()
+}
+
+type coordinates struct {
+	lat, lon       float64
+	hasLat, hasLon bool
+}
+
+func (c coordinates) valid() bool {
+	return c.hasLat && c.hasLon &&
+		c.lat >= -90 && c.lat <= 90 &&
+		c.lon >= -180 && c.lon <= 180
+}
+
+// coordinate returns the coordinate the SenML record carries, if any.
+// Coordinates are recognized by the lat and lon units defined by RFC 8428,
+// or by the last segment of the record name.
+func coordinate(msg senml.Message) string {
+	if msg.Unit == latKey || msg.Unit == lonKey {
+		return msg.Unit
+	}
+	name := msg.Name
+	if i := strings.LastIndexAny(name, ":/"); i >= 0 {
+		name = name[i+1:]
+	}
+	if name == latKey || name == lonKey {
+		return name
+	}
+	return ""
+}
+
+// senmlGeohashes returns the geohash of the coordinates sent by each
+// publisher. Publishers which didn't send both coordinates are omitted.
+func senmlGeohashes(msgs []senml.Message, precision int) map[string]string {
+	coords := make(map[string]coordinates)
+	for _, msg := range msgs {
+		if msg.Value == nil {
+			continue
+		}
+		c := coords[msg.Publisher]
+		switch coordinate(msg) {
+		case latKey:
+			c.lat, c.hasLat = *msg.Value, true
+		case lonKey:
+			c.lon, c.hasLon = *msg.Value, true
+		default:
+			continue
+		}
+		coords[msg.Publisher] = c
+	}
+
+	hashes := make(map[string]string)
+	for pub, c := range coords {
+		if c.valid() {
+			hashes[pub] = geohash(c.lat, c.lon, precision)
+		}
+	}
+	return hashes
+}
+
+// jsonGeohash returns the geohash of the coordinates in the first level
+// of the JSON payload.
+func jsonGeohash(msg json.Message, precision int) (string, bool) {
+	var c coordinates
+	c.lat, c.hasLat = msg.Payload[latKey].(float64)
+	c.lon, c.hasLon = msg.Payload[lonKey].(float64)
+	if !c.valid() {
+		return "", false
+	}
+	return geohash(c.lat, c.lon, precision), true
+}
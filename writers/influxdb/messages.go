@@ -4,89 +4,340 @@
 package influxdb
 
 import (
+	"fmt"
 	"math"
+	"strconv"
 	"time"
 
+	"github.com/go-kit/kit/metrics"
 	"github.com/mainflux/mainflux/pkg/errors"
 	"github.com/mainflux/mainflux/pkg/transformers/json"
 	"github.com/mainflux/mainflux/pkg/transformers/senml"
 	"github.com/mainflux/mainflux/writers"
 
 	influxdata "github.com/influxdata/influxdb/client/v2"
+	"github.com/influxdata/influxdb/models"
 )
 
 const (
 	senmlPoints = "messages"
 	jsonPoints  = "json"
+
+	ingestionField = "ingestion_time"
+
+	// DefaultValueField is the field key of the SenML numeric value.
+	DefaultValueField = "value"
+
+	// DefaultMeasurement is the measurement of the SenML points.
+	DefaultMeasurement = senmlPoints
 )
 
 var (
+	// ErrInvalidPrecision indicates that the timestamp precision is not
+	// supported.
+	ErrInvalidPrecision = errors.New("invalid timestamp precision")
+
 	errSaveMessage   = errors.New("failed to save message to influxdb database")
 	errMessageFormat = errors.New("invalid message format")
 )
+
+// precision is the unit the point timestamps are truncated to, and the
+// precision they are written with.
+type precision struct {
+	unit time.Duration
+	api  string
+}
+
+// precisions maps the supported timestamp precisions to their units and
+// the precisions of the InfluxDB write API. The client rejects the "u"
+// precision of microseconds, so they are written as nanoseconds.
+var precisions = map[string]precision{
+	"":   {unit: time.Nanosecond, api: "ns"},
+	"ns": {unit: time.Nanosecond, api: "ns"},
+	"us": {unit: time.Microsecond, api: "ns"},
+	"ms": {unit: time.Millisecond, api: "ms"},
+	"s":  {unit: time.Second, api: "s"},
+}
+
+// ValidatePrecision checks that the timestamp precision is one of ns, us,
+// ms or s. The empty precision stands for nanoseconds.
+func ValidatePrecision(precision string) error {
+	if _, ok := precisions[precision]; !ok {
+		return errors.Wrap(ErrInvalidPrecision, fmt.Errorf("%s", precision))
+	}
+	return nil
+}
+
 var _ writers.MessageRepository = (*influxRepo)(nil)
 
+// Config defines the options used to build and write InfluxDB points.
+type Config struct {
+	// Database is the name of the database points are written to.
+	Database string
+
+	// WriteConsistency is the number of cluster nodes required to confirm
+	// the write (any, one, quorum or all). If empty, the server default is
+	// used.
+	WriteConsistency string
+
+	// Precision is the precision the point timestamps are truncated to
+	// and written with (ns, us, ms or s). Points of the same series which
+	// differ by less than the precision overwrite each other. If empty,
+	// nanoseconds are used.
+	Precision string
+
+	// Measurement is the measurement SenML points are written to unless
+	// routed to another one. If empty, DefaultMeasurement is used. JSON
+	// points are written to the measurement of their format.
+	Measurement string
+
+	// UnitAsTag makes the writer store the SenML unit as a tag instead
+	// of a field.
+	UnitAsTag bool
+
+	// Retention selects the retention policy points are written with,
+	// based on the message channel.
+	Retention Retention
+
+	// Routes, if set, maps channels to retention tiers ahead of
+	// Retention.Channels. Unlike them, routes can be replaced while the
+	// writer runs.
+	Routes *writers.Routes
+
+	// Measurements, if set, maps message subjects to the measurements
+	// points are written to in place of the default ones. The most
+	// specific matching pattern wins.
+	Measurements *writers.SubjectRoutes
+
+	// ContentMeasurements, if set, maps the decoded fields of messages to
+	// the measurements points are written to, ahead of Measurements. The
+	// first matching route wins.
+	ContentMeasurements *writers.ContentRoutes
+
+	// IngestionTime makes the writer store the time the message was
+	// written as an additional field, in seconds since the Unix epoch.
+	IngestionTime bool
+
+	// ValueField is the field key the SenML numeric value is stored with.
+	// If empty, DefaultValueField is used.
+	ValueField string
+
+	// GeohashPrecision is the number of characters of the geohash tag
+	// computed from the coordinates the messages carry, up to
+	// MaxGeohashPrecision. If zero, the tag is not added.
+	GeohashPrecision int
+
+	// MaxTagLength is the maximum length in bytes of tag values. Longer
+	// values are handled according to the TagPolicy. If zero, tag values
+	// are not checked.
+	MaxTagLength int
+
+	// TagPolicy defines how tag values longer than MaxTagLength are
+	// handled. If empty, TagTruncate is used.
+	TagPolicy TagPolicy
+
+	// TagCounter, if set, counts the tag values longer than MaxTagLength
+	// by tag key and status (truncated or rejected).
+	TagCounter metrics.Counter
+
+	// OnWrite, if set, is called with the result of every batch of points
+	// written to the database.
+	OnWrite func(WriteResult)
+}
+
+// WriteResult describes a batch of points written to the database.
+type WriteResult struct {
+	// RetentionPolicy is the retention policy the points were written with.
+	RetentionPolicy string
+
+	// Points are the written points.
+	Points []*influxdata.Point
+
+	// Err is the error returned by the database, if any.
+	Err error
+}
+
+// PointKey returns the identity of the point in InfluxDB, i.e. its series
+// key (the measurement and tag set) and time. Writing a point with the key
+// of a stored one overwrites the stored fields, and since the points of a
+// message are built from the message alone, a replayed message overwrites
+// its points rather than duplicating them. The points of messages without
+// a timestamp are the exception, as they are written at the current time.
+func PointKey(pt *influxdata.Point) string {
+	key := models.MakeKey([]byte(pt.Name()), models.NewTags(pt.Tags()))
+	return string(key) + " " + strconv.FormatInt(pt.UnixNano(), 10)
+}
+
 type influxRepo struct {
 	client influxdata.Client
 	cfg    influxdata.BatchPointsConfig
+	opts   Config
+	unit   time.Duration
 }
 
 // New returns new InfluxDB writer.
 func New(client influxdata.Client, database string) writers.MessageRepository {
+	return NewWithConfig(client, Config{Database: database})
+}
+
+// NewWithConfig returns new InfluxDB writer that builds points
+// using the provided configuration.
+func NewWithConfig(client influxdata.Client, cfg Config) writers.MessageRepository {
+	if cfg.ValueField == "" {
+		cfg.ValueField = DefaultValueField
+	}
+	if cfg.GeohashPrecision > MaxGeohashPrecision {
+		cfg.GeohashPrecision = MaxGeohashPrecision
+	}
+	if cfg.TagPolicy == "" {
+		cfg.TagPolicy = TagTruncate
+	}
+	if cfg.Measurement == "" {
+		cfg.Measurement = DefaultMeasurement
+	}
 	return &influxRepo{
 		client: client,
 		cfg: influxdata.BatchPointsConfig{
-			Database: database,
+			Database:         cfg.Database,
+			WriteConsistency: cfg.WriteConsistency,
+			Precision:        precisions[cfg.Precision].api,
 		},
+		opts: cfg,
+		unit: precisions[cfg.Precision].unit,
 	}
 }
 
 func (repo *influxRepo) Save(message interface{}) error {
-	pts, err := influxdata.NewBatchPoints(repo.cfg)
-	if err != nil {
-		return errors.Wrap(errSaveMessage, err)
-	}
+	var pts batches
+	var err error
 	switch m := message.(type) {
 	case json.Messages:
-		pts, err = repo.jsonPoints(pts, m)
+		pts, err = repo.jsonPoints(m)
 	default:
-		pts, err = repo.senmlPoints(pts, m)
+		pts, err = repo.senmlPoints(m)
 	}
 	if err != nil {
 		return err
 	}
 
-	if err := repo.client.Write(pts); err != nil {
-		return errors.Wrap(errSaveMessage, err)
+	for _, bp := range pts {
+		err := repo.client.Write(bp)
+		if repo.opts.OnWrite != nil {
+			repo.opts.OnWrite(WriteResult{
+				RetentionPolicy: bp.RetentionPolicy(),
+				Points:          bp.Points(),
+				Err:             err,
+			})
+		}
+		if IsUnauthorized(err) && !errors.Contains(err, ErrUnauthorized) {
+			err = errors.Wrap(ErrUnauthorized, err)
+		}
+		if err != nil {
+			return errors.Wrap(errSaveMessage, err)
+		}
 	}
 	return nil
 }
 
-func (repo *influxRepo) senmlPoints(pts influxdata.BatchPoints, messages interface{}) (influxdata.BatchPoints, error) {
+// policy returns the retention policy used for the given channel.
+func (repo *influxRepo) policy(channel string) string {
+	if repo.opts.Routes != nil {
+		if tier, ok := repo.opts.Routes.Target(channel); ok {
+			return repo.opts.Retention.Tiers[tier]
+		}
+	}
+	return repo.opts.Retention.policy(channel)
+}
+
+// measurement returns the measurement the message of the channel and
+// subtopic with the decoded fields is written to.
+func (repo *influxRepo) measurement(channel, subtopic string, fields map[string]interface{}, def string) string {
+	if repo.opts.ContentMeasurements != nil {
+		if m, ok := repo.opts.ContentMeasurements.Target(fields); ok {
+			return m
+		}
+	}
+	if repo.opts.Measurements != nil {
+		if m, ok := repo.opts.Measurements.Target(writers.MessageSubject(channel, subtopic)); ok {
+			return m
+		}
+	}
+	return def
+}
+
+// batches groups points by the retention policy they are written with.
+type batches map[string]influxdata.BatchPoints
+
+func (repo *influxRepo) add(pts batches, channel string, pt *influxdata.Point) error {
+	policy := repo.policy(channel)
+	bp, ok := pts[policy]
+	if !ok {
+		cfg := repo.cfg
+		cfg.RetentionPolicy = policy
+		var err error
+		if bp, err = influxdata.NewBatchPoints(cfg); err != nil {
+			return errors.Wrap(errSaveMessage, err)
+		}
+		pts[policy] = bp
+	}
+	bp.AddPoint(pt)
+	return nil
+}
+
+func (repo *influxRepo) senmlPoints(messages interface{}) (batches, error) {
 	msgs, ok := messages.([]senml.Message)
 	if !ok {
 		return nil, errSaveMessage
 	}
 
+	pts := batches{}
+	now := time.Now()
+
+	var hashes map[string]string
+	if repo.opts.GeohashPrecision > 0 {
+		hashes = senmlGeohashes(msgs, repo.opts.GeohashPrecision)
+	}
+
 	for _, msg := range msgs {
-		tgs, flds := senmlTags(msg), senmlFields(msg)
+		tgs, flds := senmlTags(msg), senmlFields(msg, repo.opts.ValueField)
+		if repo.opts.UnitAsTag {
+			delete(flds, "unit")
+			tgs["unit"] = msg.Unit
+		}
+		if hash, ok := hashes[msg.Publisher]; ok {
+			tgs[geohashTag] = hash
+		}
+		if err := tgs.limit(repo.opts.MaxTagLength, repo.opts.TagPolicy, repo.opts.TagCounter); err != nil {
+			return nil, err
+		}
+		repo.addIngestionTime(flds, now)
 
 		sec, dec := math.Modf(msg.Time)
-		t := time.Unix(int64(sec), int64(dec*(1e9)))
+		t := time.Unix(int64(sec), int64(dec*(1e9))).Truncate(repo.unit)
 
-		pt, err := influxdata.NewPoint(senmlPoints, tgs, flds, t)
+		pt, err := influxdata.NewPoint(repo.measurement(msg.Channel, msg.Subtopic, writers.SenMLFields(msg), repo.opts.Measurement), tgs, flds, t)
 		if err != nil {
 			return nil, errors.Wrap(errSaveMessage, err)
 		}
-		pts.AddPoint(pt)
+		if err := repo.add(pts, msg.Channel, pt); err != nil {
+			return nil, err
+		}
 	}
 
 	return pts, nil
 }
 
-func (repo *influxRepo) jsonPoints(pts influxdata.BatchPoints, msgs json.Messages) (influxdata.BatchPoints, error) {
+func (repo *influxRepo) jsonPoints(msgs json.Messages) (batches, error) {
+	pts := batches{}
+	now := time.Now()
 	for i, m := range msgs.Data {
-		t := time.Unix(0, m.Created+int64(i))
+		// Messages without a timestamp are written at the current time,
+		// rather than at the Unix epoch.
+		created := m.Created
+		if created == 0 {
+			created = now.UnixNano()
+		}
+		t := time.Unix(0, created+int64(i)).Truncate(repo.unit)
 
 		// Copy first-level fields so that the original Payload is unchanged.
 		fields := make(map[string]interface{})
@@ -95,16 +346,34 @@ func (repo *influxRepo) jsonPoints(pts influxdata.BatchPoints, msgs json.Message
 		}
 		// At least one known field need to exist so that COUNT can be performed.
 		fields["protocol"] = m.Protocol
-		pt, err := influxdata.NewPoint(msgs.Format, jsonTags(m), fields, t)
+		repo.addIngestionTime(fields, now)
+		tgs := jsonTags(m)
+		if repo.opts.GeohashPrecision > 0 {
+			if hash, ok := jsonGeohash(m, repo.opts.GeohashPrecision); ok {
+				tgs[geohashTag] = hash
+			}
+		}
+		if err := tgs.limit(repo.opts.MaxTagLength, repo.opts.TagPolicy, repo.opts.TagCounter); err != nil {
+			return nil, err
+		}
+		pt, err := influxdata.NewPoint(repo.measurement(m.Channel, m.Subtopic, m.Payload, msgs.Format), tgs, fields, t)
 		if err != nil {
 			return nil, errors.Wrap(errSaveMessage, err)
 		}
-		pts.AddPoint(pt)
+		if err := repo.add(pts, m.Channel, pt); err != nil {
+			return nil, err
+		}
 	}
 
 	return pts, nil
 }
 
+func (repo *influxRepo) addIngestionTime(fields map[string]interface{}, now time.Time) {
+	if repo.opts.IngestionTime {
+		fields[ingestionField] = float64(now.UnixNano()) / 1e9
+	}
+}
+
 type message struct {
 	json.Message
 	payload []map[string]interface{}
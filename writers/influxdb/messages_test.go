@@ -6,12 +6,20 @@ package influxdb_test
 import (
 	"fmt"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/go-kit/kit/metrics"
 	influxdata "github.com/influxdata/influxdb/client/v2"
+	"github.com/influxdata/influxdb/models"
 	log "github.com/mainflux/mainflux/logger"
+	"github.com/mainflux/mainflux/pkg/errors"
+	"github.com/mainflux/mainflux/pkg/messaging"
+	"github.com/mainflux/mainflux/pkg/transformers"
+	"github.com/mainflux/mainflux/pkg/transformers/json"
 	"github.com/mainflux/mainflux/pkg/transformers/senml"
+	"github.com/mainflux/mainflux/writers"
 	writer "github.com/mainflux/mainflux/writers/influxdb"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -130,3 +138,1157 @@ func TestSave(t *testing.T) {
 		assert.Equal(t, tc.expectedSize, count, fmt.Sprintf("Expected to have %d messages saved, found %d instead.\n", tc.expectedSize, count))
 	}
 }
+
+// clientMock records written batches instead of sending them to InfluxDB.
+type clientMock struct {
+	influxdata.Client
+	batches   []influxdata.BatchPoints
+	policies  []string
+	databases []string
+	commands  []string
+	err       error
+}
+
+func (c *clientMock) Query(q influxdata.Query) (*influxdata.Response, error) {
+	c.commands = append(c.commands, q.Command)
+	row := models.Row{Columns: []string{"name", "duration"}}
+	switch {
+	case q.Command == "SHOW DATABASES":
+		row.Columns = []string{"name"}
+		for _, db := range c.databases {
+			row.Values = append(row.Values, []interface{}{db})
+		}
+	case strings.HasPrefix(q.Command, "CREATE DATABASE"):
+		return &influxdata.Response{}, nil
+	default:
+		for _, p := range c.policies {
+			row.Values = append(row.Values, []interface{}{p, "0s"})
+		}
+	}
+	res := influxdata.Result{Series: []models.Row{row}}
+	return &influxdata.Response{Results: []influxdata.Result{res}}, nil
+}
+
+func (c *clientMock) Write(bp influxdata.BatchPoints) error {
+	if c.err != nil {
+		return c.err
+	}
+	c.batches = append(c.batches, bp)
+	return nil
+}
+
+func (c *clientMock) points() []*influxdata.Point {
+	var pts []*influxdata.Point
+	for _, bp := range c.batches {
+		pts = append(pts, bp.Points()...)
+	}
+	return pts
+}
+
+func point(t *testing.T, name string, tags map[string]string, fields map[string]interface{}, tm time.Time) *influxdata.Point {
+	pt, err := influxdata.NewPoint(name, tags, fields, tm)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	return pt
+}
+
+func TestSaveUnit(t *testing.T) {
+	payload := `[{"bn":"dev:","bu":"Cel","n":"inherited","v":21},{"n":"own","u":"%RH","v":40}]`
+	msgs, err := senml.New(senml.JSON).Transform(messaging.Message{
+		Channel:   "45",
+		Publisher: "2580",
+		Protocol:  "http",
+		Payload:   []byte(payload),
+	})
+	require.Nil(t, err, fmt.Sprintf("Transforming SenML expected to succeed: %s.\n", err))
+
+	units := map[string]string{
+		"dev:inherited": "Cel",
+		"dev:own":       "%RH",
+	}
+
+	cases := []struct {
+		desc      string
+		unitAsTag bool
+	}{
+		{
+			desc:      "save unit as field",
+			unitAsTag: false,
+		},
+		{
+			desc:      "save unit as tag",
+			unitAsTag: true,
+		},
+	}
+
+	for _, tc := range cases {
+		cm := &clientMock{}
+		repo := writer.NewWithConfig(cm, writer.Config{Database: testDB, UnitAsTag: tc.unitAsTag})
+		err := repo.Save(msgs)
+		require.Nil(t, err, fmt.Sprintf("%s: Save operation expected to succeed: %s.\n", tc.desc, err))
+
+		pts := cm.points()
+		assert.Equal(t, len(units), len(pts), fmt.Sprintf("%s: expected %d points got %d\n", tc.desc, len(units), len(pts)))
+		for _, pt := range pts {
+			tags := pt.Tags()
+			fields, err := pt.Fields()
+			require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s\n", tc.desc, err))
+
+			unit := units[tags["name"]]
+			switch tc.unitAsTag {
+			case true:
+				assert.Equal(t, unit, tags["unit"], fmt.Sprintf("%s: expected unit tag %s got %s\n", tc.desc, unit, tags["unit"]))
+				assert.NotContains(t, fields, "unit", fmt.Sprintf("%s: unexpected unit field\n", tc.desc))
+			default:
+				assert.Equal(t, unit, fields["unit"], fmt.Sprintf("%s: expected unit field %s got %v\n", tc.desc, unit, fields["unit"]))
+				assert.NotContains(t, tags, "unit", fmt.Sprintf("%s: unexpected unit tag\n", tc.desc))
+			}
+		}
+	}
+}
+
+func TestSaveRetention(t *testing.T) {
+	retention := writer.Retention{
+		Tiers: map[string]string{
+			"short": "one_day",
+			"long":  "one_year",
+		},
+		Channels: map[string]string{
+			"telemetry": "short",
+			"billing":   "long",
+		},
+	}
+
+	cases := []struct {
+		desc    string
+		channel string
+		policy  string
+	}{
+		{
+			desc:    "save message of short retention tier channel",
+			channel: "telemetry",
+			policy:  "one_day",
+		},
+		{
+			desc:    "save message of long retention tier channel",
+			channel: "billing",
+			policy:  "one_year",
+		},
+		{
+			desc:    "save message of channel without retention tier",
+			channel: "other",
+			policy:  "",
+		},
+	}
+
+	for _, tc := range cases {
+		msgs, err := senml.New(senml.JSON).Transform(messaging.Message{
+			Channel:   tc.channel,
+			Publisher: "2580",
+			Protocol:  "http",
+			Payload:   []byte(`[{"bn":"dev:","n":"temp","v":21},{"n":"hum","v":40}]`),
+		})
+		require.Nil(t, err, fmt.Sprintf("%s: transforming SenML expected to succeed: %s.\n", tc.desc, err))
+
+		cm := &clientMock{}
+		repo := writer.NewWithConfig(cm, writer.Config{Database: testDB, Retention: retention})
+		err = repo.Save(msgs)
+		require.Nil(t, err, fmt.Sprintf("%s: Save operation expected to succeed: %s.\n", tc.desc, err))
+
+		require.Equal(t, 1, len(cm.batches), fmt.Sprintf("%s: expected 1 batch got %d\n", tc.desc, len(cm.batches)))
+		bp := cm.batches[0]
+		assert.Equal(t, tc.policy, bp.RetentionPolicy(), fmt.Sprintf("%s: expected policy %s got %s\n", tc.desc, tc.policy, bp.RetentionPolicy()))
+		assert.Equal(t, 2, len(bp.Points()), fmt.Sprintf("%s: expected 2 points got %d\n", tc.desc, len(bp.Points())))
+	}
+}
+
+func TestSaveMeasurement(t *testing.T) {
+	p, err := writers.NewPipeline(writers.PipelineConfig{
+		SubjectRoutes: []writers.SubjectRouteConfig{
+			{Subject: "channels.*.sensors.*", Target: "sensors"},
+			{Subject: "channels.*.sensors.temp", Target: "temperature"},
+			{Subject: "channels.42.>", Target: "fleet"},
+		},
+	})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	measurements := writers.NewSubjectRoutes(p.SubjectRoutes)
+
+	cases := []struct {
+		desc        string
+		transformer transformers.Transformer
+		channel     string
+		subtopic    string
+		payload     string
+		measurement string
+	}{
+		{
+			desc:        "save SenML message matching single token wildcards",
+			transformer: senml.New(senml.JSON),
+			channel:     "1",
+			subtopic:    "sensors.hum",
+			payload:     `[{"n":"hum","v":40}]`,
+			measurement: "sensors",
+		},
+		{
+			desc:        "save SenML message matching the most specific pattern",
+			transformer: senml.New(senml.JSON),
+			channel:     "1",
+			subtopic:    "sensors.temp",
+			payload:     `[{"n":"temp","v":21}]`,
+			measurement: "temperature",
+		},
+		{
+			desc:        "save SenML message matching the tail wildcard",
+			transformer: senml.New(senml.JSON),
+			channel:     "42",
+			subtopic:    "actuators",
+			payload:     `[{"n":"valve","vb":true}]`,
+			measurement: "fleet",
+		},
+		{
+			desc:        "save SenML message not matching any pattern",
+			transformer: senml.New(senml.JSON),
+			channel:     "1",
+			payload:     `[{"n":"temp","v":21}]`,
+			measurement: "messages",
+		},
+		{
+			desc:        "save JSON message matching the most specific pattern",
+			transformer: json.New(),
+			channel:     "1",
+			subtopic:    "sensors.temp",
+			payload:     `{"temp":21}`,
+			measurement: "temperature",
+		},
+		{
+			desc:        "save JSON message not matching any pattern",
+			transformer: json.New(),
+			channel:     "1",
+			subtopic:    "status",
+			payload:     `{"status":"ok"}`,
+			measurement: "status",
+		},
+	}
+
+	for _, tc := range cases {
+		msgs, err := tc.transformer.Transform(messaging.Message{
+			Channel:   tc.channel,
+			Subtopic:  tc.subtopic,
+			Publisher: "2580",
+			Protocol:  "http",
+			Payload:   []byte(tc.payload),
+		})
+		require.Nil(t, err, fmt.Sprintf("%s: transforming message expected to succeed: %s.\n", tc.desc, err))
+
+		cm := &clientMock{}
+		repo := writer.NewWithConfig(cm, writer.Config{Database: testDB, Measurements: measurements})
+		err = repo.Save(msgs)
+		require.Nil(t, err, fmt.Sprintf("%s: Save operation expected to succeed: %s.\n", tc.desc, err))
+
+		pts := cm.points()
+		require.Equal(t, 1, len(pts), fmt.Sprintf("%s: expected 1 point got %d\n", tc.desc, len(pts)))
+		assert.Equal(t, tc.measurement, pts[0].Name(), fmt.Sprintf("%s: expected measurement %s got %s\n", tc.desc, tc.measurement, pts[0].Name()))
+	}
+}
+
+func TestSavePrecision(t *testing.T) {
+	created := time.Unix(1600000000, 123456789)
+
+	cases := []struct {
+		desc        string
+		precision   string
+		measurement string
+		transformer transformers.Transformer
+		payload     string
+		name        string
+		time        time.Time
+		api         string
+	}{
+		{
+			desc:        "save JSON message with default precision",
+			transformer: json.New(),
+			payload:     `{"temp":21}`,
+			name:        "json",
+			time:        created,
+			api:         "ns",
+		},
+		{
+			desc:        "save JSON message with microsecond precision",
+			precision:   "us",
+			transformer: json.New(),
+			payload:     `{"temp":21}`,
+			name:        "json",
+			time:        time.Unix(1600000000, 123456000),
+			api:         "ns",
+		},
+		{
+			desc:        "save JSON message with millisecond precision",
+			precision:   "ms",
+			transformer: json.New(),
+			payload:     `{"temp":21}`,
+			name:        "json",
+			time:        time.Unix(1600000000, 123000000),
+			api:         "ms",
+		},
+		{
+			desc:        "save SenML message with second precision to measurement",
+			precision:   "s",
+			measurement: "telemetry",
+			transformer: senml.New(senml.JSON),
+			payload:     `[{"n":"temp","v":21,"t":1600000000.5}]`,
+			name:        "telemetry",
+			time:        time.Unix(1600000000, 0),
+			api:         "s",
+		},
+		{
+			desc:        "save SenML message to default measurement",
+			transformer: senml.New(senml.JSON),
+			payload:     `[{"n":"temp","v":21,"t":1600000000.5}]`,
+			name:        "messages",
+			time:        time.Unix(1600000000, 500000000),
+			api:         "ns",
+		},
+	}
+
+	for _, tc := range cases {
+		msgs, err := tc.transformer.Transform(messaging.Message{
+			Channel:   "45",
+			Subtopic:  "json",
+			Publisher: "2580",
+			Protocol:  "http",
+			Payload:   []byte(tc.payload),
+			Created:   created.UnixNano(),
+		})
+		require.Nil(t, err, fmt.Sprintf("%s: transforming message expected to succeed: %s.\n", tc.desc, err))
+
+		cm := &clientMock{}
+		repo := writer.NewWithConfig(cm, writer.Config{Database: testDB, Precision: tc.precision, Measurement: tc.measurement})
+		err = repo.Save(msgs)
+		require.Nil(t, err, fmt.Sprintf("%s: Save operation expected to succeed: %s.\n", tc.desc, err))
+
+		require.Equal(t, 1, len(cm.batches), fmt.Sprintf("%s: expected 1 batch got %d\n", tc.desc, len(cm.batches)))
+		assert.Equal(t, tc.api, cm.batches[0].Precision(), fmt.Sprintf("%s: expected precision %s got %s\n", tc.desc, tc.api, cm.batches[0].Precision()))
+		pts := cm.points()
+		require.Equal(t, 1, len(pts), fmt.Sprintf("%s: expected 1 point got %d\n", tc.desc, len(pts)))
+		assert.Equal(t, tc.name, pts[0].Name(), fmt.Sprintf("%s: expected measurement %s got %s\n", tc.desc, tc.name, pts[0].Name()))
+		assert.Equal(t, tc.time.UnixNano(), pts[0].UnixNano(), fmt.Sprintf("%s: expected time %d got %d\n", tc.desc, tc.time.UnixNano(), pts[0].UnixNano()))
+	}
+}
+
+func TestValidatePrecision(t *testing.T) {
+	cases := []struct {
+		desc      string
+		precision string
+		err       error
+	}{
+		{
+			desc:      "validate empty precision",
+			precision: "",
+			err:       nil,
+		},
+		{
+			desc:      "validate microsecond precision",
+			precision: "us",
+			err:       nil,
+		},
+		{
+			desc:      "validate second precision",
+			precision: "s",
+			err:       nil,
+		},
+		{
+			desc:      "validate InfluxDB microsecond precision",
+			precision: "u",
+			err:       writer.ErrInvalidPrecision,
+		},
+		{
+			desc:      "validate hour precision",
+			precision: "h",
+			err:       writer.ErrInvalidPrecision,
+		},
+	}
+
+	for _, tc := range cases {
+		err := writer.ValidatePrecision(tc.precision)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s\n", tc.desc, tc.err, err))
+	}
+}
+
+func TestSaveContentMeasurement(t *testing.T) {
+	p, err := writers.NewPipeline(writers.PipelineConfig{
+		SubjectRoutes: []writers.SubjectRouteConfig{
+			{Subject: "channels.42", Target: "fleet"},
+		},
+		ContentRoutes: []writers.ContentRouteConfig{
+			{Field: "n", Value: "temp", Target: "temperature"},
+			{Field: "temp", Target: "temperature"},
+			{Field: "vb", Target: "switches"},
+		},
+	})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	cfg := writer.Config{
+		Database:            testDB,
+		Measurements:        writers.NewSubjectRoutes(p.SubjectRoutes),
+		ContentMeasurements: writers.NewContentRoutes(p.ContentRoutes),
+	}
+
+	cases := []struct {
+		desc         string
+		transformer  transformers.Transformer
+		channel      string
+		subtopic     string
+		payload      string
+		measurements []string
+	}{
+		{
+			desc:         "save SenML records routed by name and value presence",
+			transformer:  senml.New(senml.JSON),
+			channel:      "1",
+			payload:      `[{"n":"temp","v":21},{"n":"hum","v":40},{"n":"valve","vb":true}]`,
+			measurements: []string{"temperature", "messages", "switches"},
+		},
+		{
+			desc:         "save SenML records routed by content ahead of subject",
+			transformer:  senml.New(senml.JSON),
+			channel:      "42",
+			payload:      `[{"n":"temp","v":21},{"n":"hum","v":40}]`,
+			measurements: []string{"temperature", "fleet"},
+		},
+		{
+			desc:         "save JSON message having the field",
+			transformer:  json.New(),
+			channel:      "1",
+			subtopic:     "climate",
+			payload:      `{"temp":21,"hum":40}`,
+			measurements: []string{"temperature"},
+		},
+		{
+			desc:         "save JSON message without the field",
+			transformer:  json.New(),
+			channel:      "1",
+			subtopic:     "climate",
+			payload:      `{"hum":40}`,
+			measurements: []string{"climate"},
+		},
+	}
+
+	for _, tc := range cases {
+		msgs, err := tc.transformer.Transform(messaging.Message{
+			Channel:   tc.channel,
+			Subtopic:  tc.subtopic,
+			Publisher: "2580",
+			Protocol:  "http",
+			Payload:   []byte(tc.payload),
+		})
+		require.Nil(t, err, fmt.Sprintf("%s: transforming message expected to succeed: %s.\n", tc.desc, err))
+
+		cm := &clientMock{}
+		repo := writer.NewWithConfig(cm, cfg)
+		err = repo.Save(msgs)
+		require.Nil(t, err, fmt.Sprintf("%s: Save operation expected to succeed: %s.\n", tc.desc, err))
+
+		var measurements []string
+		for _, pt := range cm.points() {
+			measurements = append(measurements, pt.Name())
+		}
+		assert.Equal(t, tc.measurements, measurements, fmt.Sprintf("%s: expected measurements %v got %v\n", tc.desc, tc.measurements, measurements))
+	}
+}
+
+func TestValidateRetention(t *testing.T) {
+	cases := []struct {
+		desc      string
+		retention writer.Retention
+		policies  []string
+		err       error
+	}{
+		{
+			desc: "validate existing retention policies",
+			retention: writer.Retention{
+				Tiers:    map[string]string{"short": "one_day"},
+				Channels: map[string]string{"telemetry": "short"},
+			},
+			policies: []string{"autogen", "one_day"},
+			err:      nil,
+		},
+		{
+			desc:      "validate without retention tiers",
+			retention: writer.Retention{},
+			err:       nil,
+		},
+		{
+			desc: "validate missing retention policy",
+			retention: writer.Retention{
+				Tiers:    map[string]string{"short": "one_day"},
+				Channels: map[string]string{"telemetry": "short"},
+			},
+			policies: []string{"autogen"},
+			err:      writer.ErrMissingPolicy,
+		},
+		{
+			desc: "validate channel mapped to unknown tier",
+			retention: writer.Retention{
+				Tiers:    map[string]string{"short": "one_day"},
+				Channels: map[string]string{"telemetry": "long"},
+			},
+			policies: []string{"one_day"},
+			err:      writer.ErrUnknownTier,
+		},
+	}
+
+	for _, tc := range cases {
+		cm := &clientMock{policies: tc.policies}
+		err := writer.ValidateRetention(cm, writer.Config{Database: testDB, Retention: tc.retention})
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s\n", tc.desc, tc.err, err))
+	}
+}
+
+func TestEnsureDatabase(t *testing.T) {
+	cases := []struct {
+		desc      string
+		databases []string
+		cfg       writer.DatabaseConfig
+		create    string
+		err       error
+	}{
+		{
+			desc:      "ensure existing database",
+			databases: []string{"_internal", testDB},
+			cfg:       writer.DatabaseConfig{Create: true},
+			err:       nil,
+		},
+		{
+			desc:      "ensure missing database without creating it",
+			databases: []string{"_internal"},
+			cfg:       writer.DatabaseConfig{},
+			err:       writer.ErrMissingDatabase,
+		},
+		{
+			desc:      "ensure missing database by creating it",
+			databases: []string{"_internal"},
+			cfg:       writer.DatabaseConfig{Create: true},
+			create:    fmt.Sprintf("CREATE DATABASE %q", testDB),
+			err:       nil,
+		},
+		{
+			desc:      "ensure missing database by creating it with retention duration",
+			databases: []string{"_internal"},
+			cfg:       writer.DatabaseConfig{Create: true, Duration: 30 * 24 * time.Hour},
+			create:    fmt.Sprintf("CREATE DATABASE %q WITH DURATION 2592000s", testDB),
+			err:       nil,
+		},
+		{
+			desc:      "ensure database with too short retention duration",
+			databases: []string{"_internal"},
+			cfg:       writer.DatabaseConfig{Create: true, Duration: time.Minute},
+			err:       writer.ErrInvalidDuration,
+		},
+	}
+
+	for _, tc := range cases {
+		cm := &clientMock{databases: tc.databases}
+		err := writer.EnsureDatabase(cm, testDB, tc.cfg)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s\n", tc.desc, tc.err, err))
+
+		var created []string
+		for _, cmd := range cm.commands {
+			if strings.HasPrefix(cmd, "CREATE DATABASE") {
+				created = append(created, cmd)
+			}
+		}
+		switch tc.create {
+		case "":
+			assert.Empty(t, created, fmt.Sprintf("%s: expected no database to be created got %v\n", tc.desc, created))
+		default:
+			assert.Equal(t, []string{tc.create}, created, fmt.Sprintf("%s: expected %s got %v\n", tc.desc, tc.create, created))
+		}
+	}
+}
+
+func TestSaveIngestionTime(t *testing.T) {
+	msgs, err := senml.New(senml.JSON).Transform(messaging.Message{
+		Channel:   "45",
+		Publisher: "2580",
+		Protocol:  "http",
+		Created:   time.Now().Add(-time.Hour).UnixNano(),
+		Payload:   []byte(`[{"bn":"dev:","n":"temp","v":21},{"n":"hum","v":40}]`),
+	})
+	require.Nil(t, err, fmt.Sprintf("Transforming SenML expected to succeed: %s.\n", err))
+
+	cases := []struct {
+		desc          string
+		ingestionTime bool
+	}{
+		{
+			desc:          "save message without ingestion time",
+			ingestionTime: false,
+		},
+		{
+			desc:          "save message with ingestion time",
+			ingestionTime: true,
+		},
+	}
+
+	for _, tc := range cases {
+		cm := &clientMock{}
+		repo := writer.NewWithConfig(cm, writer.Config{Database: testDB, IngestionTime: tc.ingestionTime})
+		before := float64(time.Now().UnixNano()) / 1e9
+		err := repo.Save(msgs)
+		require.Nil(t, err, fmt.Sprintf("%s: Save operation expected to succeed: %s.\n", tc.desc, err))
+		after := float64(time.Now().UnixNano()) / 1e9
+
+		pts := cm.points()
+		assert.Equal(t, 2, len(pts), fmt.Sprintf("%s: expected 2 points got %d\n", tc.desc, len(pts)))
+		for _, pt := range pts {
+			fields, err := pt.Fields()
+			require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s\n", tc.desc, err))
+			if !tc.ingestionTime {
+				assert.NotContains(t, fields, "ingestion_time", fmt.Sprintf("%s: unexpected ingestion time field\n", tc.desc))
+				continue
+			}
+			ingested, ok := fields["ingestion_time"].(float64)
+			require.True(t, ok, fmt.Sprintf("%s: expected ingestion time field\n", tc.desc))
+			assert.True(t, ingested >= before && ingested <= after, fmt.Sprintf("%s: expected ingestion time between %f and %f got %f\n", tc.desc, before, after, ingested))
+			// The point time remains the message time.
+			assert.True(t, pt.Time().Before(time.Now().Add(-time.Minute)), fmt.Sprintf("%s: expected point time to be the message time got %s\n", tc.desc, pt.Time()))
+		}
+	}
+}
+
+func TestSaveTransformed(t *testing.T) {
+	created := time.Now().Add(-time.Hour).Round(time.Microsecond)
+
+	cases := []struct {
+		desc        string
+		transformer transformers.Transformer
+		created     int64
+		payload     string
+		fields      map[string]interface{}
+		time        time.Time
+	}{
+		{
+			desc:        "save SenML message",
+			transformer: senml.New(senml.JSON),
+			created:     created.UnixNano(),
+			payload:     fmt.Sprintf(`[{"bn":"dev:","bt":%d,"n":"temp","u":"Cel","v":21}]`, created.Unix()),
+			fields:      map[string]interface{}{"value": 21.0, "unit": "Cel"},
+			time:        created.Truncate(time.Second),
+		},
+		{
+			desc:        "save JSON message with nested objects",
+			transformer: json.New(),
+			created:     created.UnixNano(),
+			payload:     `{"temp":21,"sensor":{"hum":40,"battery":{"level":"low"}}}`,
+			fields:      map[string]interface{}{"temp": 21.0, "sensor/hum": 40.0, "sensor/battery/level": "low", "protocol": "http"},
+			time:        created,
+		},
+		{
+			desc:        "save JSON message without timestamp",
+			transformer: json.New(),
+			payload:     `{"temp":21}`,
+			fields:      map[string]interface{}{"temp": 21.0, "protocol": "http"},
+		},
+	}
+
+	for _, tc := range cases {
+		msgs, err := tc.transformer.Transform(messaging.Message{
+			Channel:   "45",
+			Publisher: "2580",
+			Protocol:  "http",
+			Created:   tc.created,
+			Payload:   []byte(tc.payload),
+		})
+		require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s\n", tc.desc, err))
+
+		cm := &clientMock{}
+		before := time.Now()
+		err = writer.New(cm, testDB).Save(msgs)
+		require.Nil(t, err, fmt.Sprintf("%s: Save operation expected to succeed: %s.\n", tc.desc, err))
+
+		pts := cm.points()
+		require.Equal(t, 1, len(pts), fmt.Sprintf("%s: expected 1 point got %d\n", tc.desc, len(pts)))
+		fields, err := pts[0].Fields()
+		require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s\n", tc.desc, err))
+		for k, v := range tc.fields {
+			assert.Equal(t, v, fields[k], fmt.Sprintf("%s: expected field %s %v got %v\n", tc.desc, k, v, fields[k]))
+		}
+		if tc.time.IsZero() {
+			assert.False(t, pts[0].Time().Before(before), fmt.Sprintf("%s: expected point time after %s got %s\n", tc.desc, before, pts[0].Time()))
+			continue
+		}
+		assert.True(t, tc.time.Equal(pts[0].Time()), fmt.Sprintf("%s: expected point time %s got %s\n", tc.desc, tc.time, pts[0].Time()))
+	}
+}
+
+func TestSaveReplay(t *testing.T) {
+	created := time.Now().Add(-time.Minute).UnixNano()
+
+	cases := []struct {
+		desc          string
+		transformer   transformers.Transformer
+		payload       string
+		ingestionTime bool
+		points        int
+	}{
+		{
+			desc:        "replay SenML message",
+			transformer: senml.New(senml.JSON),
+			payload:     `[{"bn":"dev:","n":"temp","v":21},{"n":"hum","v":40},{"n":"temp","t":1,"v":22}]`,
+			points:      3,
+		},
+		{
+			desc:          "replay SenML message with ingestion time",
+			transformer:   senml.New(senml.JSON),
+			payload:       `[{"bn":"dev:","n":"temp","v":21},{"n":"hum","v":40}]`,
+			ingestionTime: true,
+			points:        2,
+		},
+		{
+			desc:        "replay JSON message",
+			transformer: json.New(),
+			payload:     `[{"temp":21,"sensor":{"hum":40}},{"temp":22}]`,
+			points:      2,
+		},
+		{
+			desc:          "replay JSON message with ingestion time",
+			transformer:   json.New(),
+			payload:       `{"temp":21,"lat":42.6,"lon":-5.6}`,
+			ingestionTime: true,
+			points:        1,
+		},
+	}
+
+	for _, tc := range cases {
+		cm := &clientMock{}
+		repo := writer.NewWithConfig(cm, writer.Config{Database: testDB, IngestionTime: tc.ingestionTime, GeohashPrecision: 6})
+		for i := 0; i < 2; i++ {
+			msgs, err := tc.transformer.Transform(messaging.Message{
+				Channel:   "45",
+				Publisher: "2580",
+				Protocol:  "http",
+				Created:   created,
+				Payload:   []byte(tc.payload),
+			})
+			require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s\n", tc.desc, err))
+			err = repo.Save(msgs)
+			require.Nil(t, err, fmt.Sprintf("%s: Save operation expected to succeed: %s.\n", tc.desc, err))
+		}
+
+		// The points InfluxDB stores are the last ones written by key.
+		stored := make(map[string]map[string]interface{})
+		for _, pt := range cm.points() {
+			fields, err := pt.Fields()
+			require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s\n", tc.desc, err))
+			delete(fields, "ingestion_time")
+			key := writer.PointKey(pt)
+			if prev, ok := stored[key]; ok {
+				assert.Equal(t, prev, fields, fmt.Sprintf("%s: expected replayed point %s fields %v got %v\n", tc.desc, key, prev, fields))
+			}
+			stored[key] = fields
+		}
+		assert.Equal(t, 2*tc.points, len(cm.points()), fmt.Sprintf("%s: expected %d written points got %d\n", tc.desc, 2*tc.points, len(cm.points())))
+		assert.Equal(t, tc.points, len(stored), fmt.Sprintf("%s: expected %d stored points got %d\n", tc.desc, tc.points, len(stored)))
+	}
+}
+
+func TestPointKey(t *testing.T) {
+	now := time.Now()
+
+	cases := []struct {
+		desc  string
+		name  string
+		tags  map[string]string
+		time  time.Time
+		other *influxdata.Point
+		same  bool
+	}{
+		{
+			desc:  "key of point with different fields",
+			name:  "messages",
+			tags:  map[string]string{"channel": "45", "name": "temp"},
+			time:  now,
+			other: point(t, "messages", map[string]string{"name": "temp", "channel": "45"}, map[string]interface{}{"value": 22.0}, now),
+			same:  true,
+		},
+		{
+			desc:  "key of point with different time",
+			name:  "messages",
+			tags:  map[string]string{"channel": "45", "name": "temp"},
+			time:  now,
+			other: point(t, "messages", map[string]string{"channel": "45", "name": "temp"}, map[string]interface{}{"value": 21.0}, now.Add(time.Nanosecond)),
+		},
+		{
+			desc:  "key of point with different tags",
+			name:  "messages",
+			tags:  map[string]string{"channel": "45", "name": "temp"},
+			time:  now,
+			other: point(t, "messages", map[string]string{"channel": "45", "name": "hum"}, map[string]interface{}{"value": 21.0}, now),
+		},
+		{
+			desc:  "key of point with different measurement",
+			name:  "messages",
+			tags:  map[string]string{"channel": "45", "name": "temp"},
+			time:  now,
+			other: point(t, "json", map[string]string{"channel": "45", "name": "temp"}, map[string]interface{}{"value": 21.0}, now),
+		},
+	}
+
+	for _, tc := range cases {
+		pt := point(t, tc.name, tc.tags, map[string]interface{}{"value": 21.0}, tc.time)
+		same := writer.PointKey(pt) == writer.PointKey(tc.other)
+		assert.Equal(t, tc.same, same, fmt.Sprintf("%s: expected same key %t got %t\n", tc.desc, tc.same, same))
+	}
+}
+
+func TestSaveValueField(t *testing.T) {
+	payload := `[{"n":"full:name","v":1},{"bn":"dev:","n":"temp","v":2},{"n":"hum","v":3},{"bn":"other:","v":4}]`
+	msgs, err := senml.New(senml.JSON).Transform(messaging.Message{
+		Channel:   "45",
+		Publisher: "2580",
+		Protocol:  "http",
+		Payload:   []byte(payload),
+	})
+	require.Nil(t, err, fmt.Sprintf("Transforming SenML expected to succeed: %s.\n", err))
+
+	values := map[string]float64{
+		"full:name": 1,
+		"dev:temp":  2,
+		"dev:hum":   3,
+		"other:":    4,
+	}
+
+	cases := []struct {
+		desc       string
+		valueField string
+		key        string
+	}{
+		{
+			desc:       "save value with default field key",
+			valueField: "",
+			key:        writer.DefaultValueField,
+		},
+		{
+			desc:       "save value with configured field key",
+			valueField: "reading",
+			key:        "reading",
+		},
+	}
+
+	for _, tc := range cases {
+		cm := &clientMock{}
+		repo := writer.NewWithConfig(cm, writer.Config{Database: testDB, ValueField: tc.valueField})
+		err := repo.Save(msgs)
+		require.Nil(t, err, fmt.Sprintf("%s: Save operation expected to succeed: %s.\n", tc.desc, err))
+
+		pts := cm.points()
+		assert.Equal(t, len(values), len(pts), fmt.Sprintf("%s: expected %d points got %d\n", tc.desc, len(values), len(pts)))
+		for _, pt := range pts {
+			name := pt.Tags()["name"]
+			fields, err := pt.Fields()
+			require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s\n", tc.desc, err))
+
+			value, ok := values[name]
+			assert.True(t, ok, fmt.Sprintf("%s: unexpected name %s\n", tc.desc, name))
+			assert.Equal(t, value, fields[tc.key], fmt.Sprintf("%s: expected %s field %v got %v\n", tc.desc, tc.key, value, fields[tc.key]))
+			if tc.key != writer.DefaultValueField {
+				assert.NotContains(t, fields, writer.DefaultValueField, fmt.Sprintf("%s: unexpected default value field\n", tc.desc))
+			}
+		}
+	}
+}
+
+func TestSaveCallback(t *testing.T) {
+	msgs, err := senml.New(senml.JSON).Transform(messaging.Message{
+		Channel:   "45",
+		Publisher: "2580",
+		Protocol:  "http",
+		Payload:   []byte(`[{"bn":"dev:","bt":1600000000,"n":"temp","v":21},{"n":"hum","t":1,"v":40}]`),
+	})
+	require.Nil(t, err, fmt.Sprintf("Transforming SenML expected to succeed: %s.\n", err))
+
+	type point struct {
+		name  string
+		value interface{}
+		time  time.Time
+	}
+	expected := []point{
+		{name: "dev:temp", value: float64(21), time: time.Unix(1600000000, 0)},
+		{name: "dev:hum", value: float64(40), time: time.Unix(1600000001, 0)},
+	}
+	writeErr := errors.New("write failed")
+
+	cases := []struct {
+		desc string
+		err  error
+	}{
+		{
+			desc: "report successful write",
+			err:  nil,
+		},
+		{
+			desc: "report failed write",
+			err:  writeErr,
+		},
+	}
+
+	for _, tc := range cases {
+		var results []writer.WriteResult
+		cm := &clientMock{err: tc.err}
+		repo := writer.NewWithConfig(cm, writer.Config{
+			Database: testDB,
+			OnWrite:  func(res writer.WriteResult) { results = append(results, res) },
+		})
+		err := repo.Save(msgs)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s\n", tc.desc, tc.err, err))
+
+		require.Equal(t, 1, len(results), fmt.Sprintf("%s: expected 1 result got %d\n", tc.desc, len(results)))
+		res := results[0]
+		assert.Equal(t, tc.err, res.Err, fmt.Sprintf("%s: expected error %s got %s\n", tc.desc, tc.err, res.Err))
+		assert.Equal(t, "", res.RetentionPolicy, fmt.Sprintf("%s: expected default retention policy got %s\n", tc.desc, res.RetentionPolicy))
+		require.Equal(t, len(expected), len(res.Points), fmt.Sprintf("%s: expected %d points got %d\n", tc.desc, len(expected), len(res.Points)))
+		for i, pt := range res.Points {
+			fields, err := pt.Fields()
+			require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s\n", tc.desc, err))
+			actual := point{name: pt.Tags()["name"], value: fields["value"], time: pt.Time()}
+			assert.Equal(t, expected[i], actual, fmt.Sprintf("%s: expected point %v got %v\n", tc.desc, expected[i], actual))
+		}
+	}
+}
+
+func TestSaveGeohash(t *testing.T) {
+	located := `[{"bn":"dev:","n":"lat","u":"lat","v":57.64911},{"n":"lon","u":"lon","v":10.40744},{"n":"temp","v":21}]`
+	named := `[{"bn":"dev:","n":"lat","v":42.6},{"n":"lon","v":-5.6}]`
+	partial := `[{"bn":"dev:","n":"lat","v":42.6},{"n":"temp","v":21}]`
+	unlocated := `[{"bn":"dev:","n":"temp","v":21}]`
+
+	cases := []struct {
+		desc      string
+		payload   string
+		precision int
+		hash      string
+	}{
+		{
+			desc:      "save coordinates recognized by unit",
+			payload:   located,
+			precision: 11,
+			hash:      "u4pruydqqvj",
+		},
+		{
+			desc:      "save coordinates recognized by unit with lower precision",
+			payload:   located,
+			precision: 5,
+			hash:      "u4pru",
+		},
+		{
+			desc:      "save coordinates recognized by name",
+			payload:   named,
+			precision: 5,
+			hash:      "ezs42",
+		},
+		{
+			desc:      "save only latitude",
+			payload:   partial,
+			precision: 5,
+			hash:      "",
+		},
+		{
+			desc:      "save without coordinates",
+			payload:   unlocated,
+			precision: 5,
+			hash:      "",
+		},
+		{
+			desc:      "save coordinates with geohash disabled",
+			payload:   located,
+			precision: 0,
+			hash:      "",
+		},
+	}
+
+	for _, tc := range cases {
+		msgs, err := senml.New(senml.JSON).Transform(messaging.Message{
+			Channel:   "45",
+			Publisher: "2580",
+			Protocol:  "http",
+			Payload:   []byte(tc.payload),
+		})
+		require.Nil(t, err, fmt.Sprintf("%s: Transforming SenML expected to succeed: %s.\n", tc.desc, err))
+
+		cm := &clientMock{}
+		repo := writer.NewWithConfig(cm, writer.Config{Database: testDB, GeohashPrecision: tc.precision})
+		err = repo.Save(msgs)
+		require.Nil(t, err, fmt.Sprintf("%s: Save operation expected to succeed: %s.\n", tc.desc, err))
+
+		for _, pt := range cm.points() {
+			hash, ok := pt.Tags()["geohash"]
+			if tc.hash == "" {
+				assert.False(t, ok, fmt.Sprintf("%s: unexpected geohash tag %s\n", tc.desc, hash))
+				continue
+			}
+			assert.Equal(t, tc.hash, hash, fmt.Sprintf("%s: expected geohash %s got %s\n", tc.desc, tc.hash, hash))
+		}
+	}
+
+	jsonCases := []struct {
+		desc    string
+		payload json.Payload
+		hash    string
+	}{
+		{
+			desc:    "save JSON message with coordinates",
+			payload: json.Payload{"lat": 42.6, "lon": -5.6, "temp": 21.0},
+			hash:    "ezs42",
+		},
+		{
+			desc:    "save JSON message with out of range coordinates",
+			payload: json.Payload{"lat": 142.6, "lon": -5.6},
+			hash:    "",
+		},
+		{
+			desc:    "save JSON message without coordinates",
+			payload: json.Payload{"temp": 21.0},
+			hash:    "",
+		},
+	}
+
+	for _, tc := range jsonCases {
+		msgs := json.Messages{
+			Format: "geo",
+			Data:   []json.Message{{Channel: "45", Publisher: "2580", Created: time.Now().UnixNano(), Payload: tc.payload}},
+		}
+
+		cm := &clientMock{}
+		repo := writer.NewWithConfig(cm, writer.Config{Database: testDB, GeohashPrecision: 5})
+		err := repo.Save(msgs)
+		require.Nil(t, err, fmt.Sprintf("%s: Save operation expected to succeed: %s.\n", tc.desc, err))
+
+		pts := cm.points()
+		require.Equal(t, 1, len(pts), fmt.Sprintf("%s: expected 1 point got %d\n", tc.desc, len(pts)))
+		hash, ok := pts[0].Tags()["geohash"]
+		if tc.hash == "" {
+			assert.False(t, ok, fmt.Sprintf("%s: unexpected geohash tag %s\n", tc.desc, hash))
+			continue
+		}
+		assert.Equal(t, tc.hash, hash, fmt.Sprintf("%s: expected geohash %s got %s\n", tc.desc, tc.hash, hash))
+	}
+}
+
+// tagCounterMock counts the values by tag key and status.
+type tagCounterMock struct {
+	counts map[string]int
+	label  string
+}
+
+func (c tagCounterMock) With(labelValues ...string) metrics.Counter {
+	return tagCounterMock{counts: c.counts, label: strings.Join(labelValues, ":")}
+}
+
+func (c tagCounterMock) Add(float64) { c.counts[c.label]++ }
+
+func TestSaveTagLength(t *testing.T) {
+	long := strings.Repeat("x", 40)
+
+	cases := []struct {
+		desc      string
+		name      string
+		publisher string
+		max       int
+		policy    writer.TagPolicy
+		tags      map[string]string
+		err       error
+		counts    map[string]int
+	}{
+		{
+			desc:   "save truncated over-length tag value",
+			name:   long,
+			max:    16,
+			policy: writer.TagTruncate,
+			tags:   map[string]string{"name": strings.Repeat("x", 13) + writer.TruncatedMarker},
+			counts: map[string]int{"tag:name:status:truncated": 1},
+		},
+		{
+			desc:   "save truncated over-length tag value with default policy",
+			name:   long,
+			max:    16,
+			tags:   map[string]string{"name": strings.Repeat("x", 13) + writer.TruncatedMarker},
+			counts: map[string]int{"tag:name:status:truncated": 1},
+		},
+		{
+			desc:      "save truncated over-length multibyte tag value",
+			name:      "temp",
+			publisher: strings.Repeat("é", 10),
+			max:       8,
+			policy:    writer.TagTruncate,
+			tags:      map[string]string{"name": "temp", "publisher": "éé" + writer.TruncatedMarker},
+			counts:    map[string]int{"tag:publisher:status:truncated": 1},
+		},
+		{
+			desc:   "save truncated tag value without room for marker",
+			name:   long,
+			max:    2,
+			policy: writer.TagTruncate,
+			tags:   map[string]string{"name": "xx", "publisher": "25"},
+			counts: map[string]int{"tag:publisher:status:truncated": 1, "tag:name:status:truncated": 1},
+		},
+		{
+			desc:   "reject over-length tag value",
+			name:   long,
+			max:    16,
+			policy: writer.TagReject,
+			err:    writer.ErrTagTooLong,
+			counts: map[string]int{"tag:name:status:rejected": 1},
+		},
+		{
+			desc:   "save tag value within length",
+			name:   "temp",
+			max:    16,
+			policy: writer.TagReject,
+			tags:   map[string]string{"name": "temp"},
+			counts: map[string]int{},
+		},
+		{
+			desc:   "save over-length tag value without maximum length",
+			name:   long,
+			max:    0,
+			policy: writer.TagReject,
+			tags:   map[string]string{"name": long},
+			counts: map[string]int{},
+		},
+	}
+
+	for _, tc := range cases {
+		if tc.publisher == "" {
+			tc.publisher = "2580"
+		}
+		msgs, err := senml.New(senml.JSON).Transform(messaging.Message{
+			Channel:   "45",
+			Publisher: tc.publisher,
+			Protocol:  "http",
+			Payload:   []byte(fmt.Sprintf(`[{"n":"%s","v":21}]`, tc.name)),
+		})
+		require.Nil(t, err, fmt.Sprintf("%s: transforming SenML expected to succeed: %s.\n", tc.desc, err))
+
+		cm := &clientMock{}
+		counts := map[string]int{}
+		repo := writer.NewWithConfig(cm, writer.Config{
+			Database:     testDB,
+			MaxTagLength: tc.max,
+			TagPolicy:    tc.policy,
+			TagCounter:   tagCounterMock{counts: counts},
+		})
+		err = repo.Save(msgs)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s\n", tc.desc, tc.err, err))
+		assert.Equal(t, tc.counts, counts, fmt.Sprintf("%s: expected counts %v got %v\n", tc.desc, tc.counts, counts))
+		if tc.err != nil {
+			assert.True(t, errors.Contains(err, writers.ErrRejected), fmt.Sprintf("%s: expected %s got %s\n", tc.desc, writers.ErrRejected, err))
+			assert.Empty(t, cm.points(), fmt.Sprintf("%s: expected no points written\n", tc.desc))
+			continue
+		}
+
+		pts := cm.points()
+		require.Equal(t, 1, len(pts), fmt.Sprintf("%s: expected 1 point got %d\n", tc.desc, len(pts)))
+		tags := pts[0].Tags()
+		for k, v := range tc.tags {
+			assert.Equal(t, v, tags[k], fmt.Sprintf("%s: expected %s tag %s got %s\n", tc.desc, k, v, tags[k]))
+		}
+	}
+}
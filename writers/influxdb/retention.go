@@ -0,0 +1,93 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package influxdb
+
+import (
+	"fmt"
+
+	influxdata "github.com/influxdata/influxdb/client/v2"
+	"github.com/mainflux/mainflux/pkg/errors"
+)
+
+var (
+	// ErrUnknownTier indicates that a channel is mapped to a retention tier
+	// which is not defined.
+	ErrUnknownTier = errors.New("unknown retention tier")
+
+	// ErrMissingPolicy indicates that a retention tier refers to a retention
+	// policy which doesn't exist in the database.
+	ErrMissingPolicy = errors.New("retention policy does not exist")
+
+	errRetrievePolicies = errors.New("failed to retrieve retention policies")
+)
+
+// Retention maps channels to retention tiers. Each tier is backed by an
+// InfluxDB retention policy of the writer database. Messages of channels
+// that are not mapped are written using the database default policy.
+type Retention struct {
+	// Tiers maps the tier name to the retention policy name.
+	Tiers map[string]string `toml:"tiers"`
+
+	// Channels maps the channel ID to the tier name.
+	Channels map[string]string `toml:"channels"`
+}
+
+// policy returns the retention policy used for the given channel.
+func (r Retention) policy(channel string) string {
+	tier, ok := r.Channels[channel]
+	if !ok {
+		return ""
+	}
+	return r.Tiers[tier]
+}
+
+// ValidateRoutes checks that the channels are mapped to tiers defined in
+// the retention configuration.
+func ValidateRoutes(cfg Config, routes map[string]string) error {
+	for ch, tier := range routes {
+		if _, ok := cfg.Retention.Tiers[tier]; !ok {
+			return errors.Wrap(ErrUnknownTier, fmt.Errorf("channel %s is mapped to tier %s", ch, tier))
+		}
+	}
+	return nil
+}
+
+// ValidateRetention checks that every mapped tier is defined and that the
+// retention policies backing the tiers exist in the configured database.
+func ValidateRetention(client influxdata.Client, cfg Config) error {
+	if err := ValidateRoutes(cfg, cfg.Retention.Channels); err != nil {
+		return err
+	}
+	if len(cfg.Retention.Tiers) == 0 {
+		return nil
+	}
+
+	q := influxdata.NewQuery(fmt.Sprintf("SHOW RETENTION POLICIES ON %q", cfg.Database), cfg.Database, "")
+	resp, err := client.Query(q)
+	if err != nil {
+		return errors.Wrap(errRetrievePolicies, err)
+	}
+	if resp.Error() != nil {
+		return errors.Wrap(errRetrievePolicies, resp.Error())
+	}
+
+	policies := map[string]bool{}
+	for _, res := range resp.Results {
+		for _, s := range res.Series {
+			for _, v := range s.Values {
+				// The policy name is the first column of the result.
+				if name, ok := v[0].(string); ok {
+					policies[name] = true
+				}
+			}
+		}
+	}
+
+	for tier, policy := range cfg.Retention.Tiers {
+		if !policies[policy] {
+			return errors.Wrap(ErrMissingPolicy, fmt.Errorf("tier %s uses policy %s", tier, policy))
+		}
+	}
+	return nil
+}
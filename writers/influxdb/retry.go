@@ -0,0 +1,216 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package influxdb
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/metrics"
+	influxdata "github.com/influxdata/influxdb/client/v2"
+	"github.com/mainflux/mainflux/pkg/errors"
+	"github.com/mainflux/mainflux/writers"
+)
+
+// StatusAction defines how the writer handles a write which InfluxDB
+// answered with an HTTP status.
+type StatusAction string
+
+const (
+	// StatusRetry retries the write after the delay requested by the
+	// Retry-After header of the response or, without it, after an
+	// exponential backoff.
+	StatusRetry StatusAction = "retry"
+
+	// StatusDeadLetter dead-letters the messages of the write, since
+	// InfluxDB won't accept them on a retry.
+	StatusDeadLetter StatusAction = "dead_letter"
+
+	// StatusFail returns the error of the write, which the consumer counts
+	// as failed.
+	StatusFail StatusAction = "fail"
+)
+
+// NoStatus is the status code of the writes failing without a response,
+// e.g. because of a connection error.
+const NoStatus = 0
+
+// ErrInvalidStatusAction indicates an unknown status action or a malformed
+// status code.
+var ErrInvalidStatusAction = errors.New("invalid status action")
+
+// StatusActions maps the HTTP status codes of the InfluxDB responses, or
+// NoStatus, to the actions taken on them. The writes answered with the
+// unlisted codes fail.
+type StatusActions map[int]StatusAction
+
+// DefaultStatusActions returns the actions dead-lettering the points
+// InfluxDB can't parse (400) and retrying the writes which were throttled
+// (429), which InfluxDB failed to handle (500 and 503) or which failed
+// without a response.
+func DefaultStatusActions() StatusActions {
+	return StatusActions{
+		NoStatus:                       StatusRetry,
+		http.StatusBadRequest:          StatusDeadLetter,
+		http.StatusTooManyRequests:     StatusRetry,
+		http.StatusInternalServerError: StatusRetry,
+		http.StatusServiceUnavailable:  StatusRetry,
+	}
+}
+
+// ParseStatusActions returns the default actions overridden by the comma
+// separated code:action pairs, e.g. "413:dead_letter,500:fail", where the
+// code 0 stands for NoStatus.
+func ParseStatusActions(s string) (StatusActions, error) {
+	actions := DefaultStatusActions()
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, ":", 2)
+		if len(kv) != 2 {
+			return nil, errors.Wrap(ErrInvalidStatusAction, fmt.Errorf("%s is not a code:action pair", pair))
+		}
+		code, err := strconv.Atoi(strings.TrimSpace(kv[0]))
+		if err != nil || (code != NoStatus && (code < 100 || code > 599)) {
+			return nil, errors.Wrap(ErrInvalidStatusAction, fmt.Errorf("%s is not an HTTP status code", kv[0]))
+		}
+		switch a := StatusAction(strings.TrimSpace(kv[1])); a {
+		case StatusRetry, StatusDeadLetter, StatusFail:
+			actions[code] = a
+		default:
+			return nil, errors.Wrap(ErrInvalidStatusAction, fmt.Errorf("%s", kv[1]))
+		}
+	}
+	return actions, nil
+}
+
+// String formats the actions as ParseStatusActions parses them, ordered by
+// the status code.
+func (sa StatusActions) String() string {
+	codes := make([]int, 0, len(sa))
+	for c := range sa {
+		codes = append(codes, c)
+	}
+	sort.Ints(codes)
+	pairs := make([]string, len(codes))
+	for i, c := range codes {
+		pairs[i] = fmt.Sprintf("%d:%s", c, sa[c])
+	}
+	return strings.Join(pairs, ",")
+}
+
+// Action returns the action taken on the write error.
+func (sa StatusActions) Action(err error) StatusAction {
+	if a, ok := sa[statusCode(err)]; ok {
+		return a
+	}
+	return StatusFail
+}
+
+// statusCode returns the status code of the write error, or NoStatus if
+// the write failed without a response.
+func statusCode(err error) int {
+	if se, ok := err.(*StatusError); ok {
+		return se.Code
+	}
+	return NoStatus
+}
+
+// RetryConfig defines how the writes are handled by the status of their
+// response.
+type RetryConfig struct {
+	// Actions are the actions taken by status code. If nil, the default
+	// actions are taken.
+	Actions StatusActions
+
+	// Retries is the number of times a write is retried before its error
+	// is returned.
+	Retries int
+
+	// Backoff is the delay before the first retry of a write answered
+	// without the Retry-After header. It doubles on each retry, up to
+	// MaxBackoff.
+	Backoff time.Duration
+
+	// MaxBackoff, if set, caps the delay before a retry, including the one
+	// requested by the Retry-After header, so that a throttled write
+	// doesn't stall the writer indefinitely.
+	MaxBackoff time.Duration
+
+	// Counter, if set, counts the unsuccessful writes with the status and
+	// action labels.
+	Counter metrics.Counter
+
+	// Sleep waits for the delay before a retry. It defaults to time.Sleep.
+	Sleep func(time.Duration)
+}
+
+var _ influxdata.Client = (*retryClient)(nil)
+
+type retryClient struct {
+	influxdata.Client
+	cfg RetryConfig
+}
+
+// NewRetryClient returns the client which takes the configured action on
+// the writes answered with an unsuccessful HTTP status, or failing without
+// a response. The underlying client must fail the writes answered by
+// InfluxDB with a *StatusError, as the clients returned by NewHTTPClient
+// do. The errors of the dead-lettered writes wrap writers.ErrRejected.
+func NewRetryClient(client influxdata.Client, cfg RetryConfig) influxdata.Client {
+	if cfg.Actions == nil {
+		cfg.Actions = DefaultStatusActions()
+	}
+	if cfg.Sleep == nil {
+		cfg.Sleep = time.Sleep
+	}
+	return &retryClient{Client: client, cfg: cfg}
+}
+
+func (c *retryClient) Write(bp influxdata.BatchPoints) error {
+	backoff := c.cfg.Backoff
+	for attempt := 0; ; attempt++ {
+		err := c.Client.Write(bp)
+		if err == nil {
+			return nil
+		}
+
+		action := c.cfg.Actions.Action(err)
+		c.count(err, action)
+		switch {
+		case action == StatusDeadLetter:
+			return errors.Wrap(writers.ErrRejected, err)
+		case action == StatusFail, attempt >= c.cfg.Retries:
+			return err
+		}
+
+		delay := backoff
+		if se, ok := err.(*StatusError); ok && se.RetryAfter > 0 {
+			delay = se.RetryAfter
+		} else {
+			backoff *= 2
+		}
+		if c.cfg.MaxBackoff > 0 && delay > c.cfg.MaxBackoff {
+			delay = c.cfg.MaxBackoff
+		}
+		c.cfg.Sleep(delay)
+	}
+}
+
+func (c *retryClient) count(err error, action StatusAction) {
+	if c.cfg.Counter == nil {
+		return
+	}
+	status := "none"
+	if code := statusCode(err); code != NoStatus {
+		status = strconv.Itoa(code)
+	}
+	c.cfg.Counter.With("status", status, "action", string(action)).Add(1)
+}
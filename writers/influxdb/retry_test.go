@@ -0,0 +1,290 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package influxdb_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	influxdata "github.com/influxdata/influxdb/client/v2"
+	"github.com/mainflux/mainflux/pkg/errors"
+	"github.com/mainflux/mainflux/pkg/messaging"
+	"github.com/mainflux/mainflux/pkg/transformers/senml"
+	"github.com/mainflux/mainflux/writers"
+	writer "github.com/mainflux/mainflux/writers/influxdb"
+	"github.com/mainflux/mainflux/writers/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type stubResponse struct {
+	status     int
+	retryAfter string
+	body       string
+}
+
+// statusStub responds to the writes with the responses in order,
+// repeating the last one, and records the databases written to.
+type statusStub struct {
+	mu        sync.Mutex
+	responses []stubResponse
+	databases []string
+}
+
+func (s *statusStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res := s.responses[len(s.responses)-1]
+	if len(s.databases) < len(s.responses) {
+		res = s.responses[len(s.databases)]
+	}
+	s.databases = append(s.databases, r.URL.Query().Get("db"))
+	if res.retryAfter != "" {
+		w.Header().Set("Retry-After", res.retryAfter)
+	}
+	w.WriteHeader(res.status)
+	fmt.Fprint(w, res.body)
+}
+
+func TestRetryClient(t *testing.T) {
+	badData := `{"error":"unable to parse 'messages value=': missing field value"}`
+
+	cases := []struct {
+		desc      string
+		actions   writer.StatusActions
+		responses []stubResponse
+		err       error
+		rejected  bool
+		writes    int
+		sleeps    []time.Duration
+		counts    map[string]int
+	}{
+		{
+			desc:      "dead-letter write with bad data",
+			responses: []stubResponse{{status: http.StatusBadRequest, body: badData}},
+			err:       errors.New(badData),
+			rejected:  true,
+			writes:    1,
+			counts:    map[string]int{"status:400:action:dead_letter": 1},
+		},
+		{
+			desc: "retry throttled write after Retry-After",
+			responses: []stubResponse{
+				{status: http.StatusTooManyRequests, retryAfter: "3", body: `{"error":"too many requests"}`},
+				{status: http.StatusNoContent},
+			},
+			writes: 2,
+			sleeps: []time.Duration{3 * time.Second},
+			counts: map[string]int{"status:429:action:retry": 1},
+		},
+		{
+			desc: "cap Retry-After of throttled write",
+			responses: []stubResponse{
+				{status: http.StatusTooManyRequests, retryAfter: "120", body: `{"error":"too many requests"}`},
+				{status: http.StatusNoContent},
+			},
+			writes: 2,
+			sleeps: []time.Duration{time.Minute},
+			counts: map[string]int{"status:429:action:retry": 1},
+		},
+		{
+			desc:      "retry failing write with backoff",
+			responses: []stubResponse{{status: http.StatusInternalServerError, body: `{"error":"timeout"}`}},
+			err:       errors.New(`{"error":"timeout"}`),
+			writes:    4,
+			sleeps:    []time.Duration{time.Second, 2 * time.Second, 4 * time.Second},
+			counts:    map[string]int{"status:500:action:retry": 4},
+		},
+		{
+			desc: "retry write to unavailable database until it succeeds",
+			responses: []stubResponse{
+				{status: http.StatusServiceUnavailable, body: `{"error":"max-concurrent-write-limit exceeded"}`},
+				{status: http.StatusServiceUnavailable, body: `{"error":"max-concurrent-write-limit exceeded"}`},
+				{status: http.StatusNoContent},
+			},
+			writes: 3,
+			sleeps: []time.Duration{time.Second, 2 * time.Second},
+			counts: map[string]int{"status:503:action:retry": 2},
+		},
+		{
+			desc:      "fail write with unlisted status",
+			responses: []stubResponse{{status: http.StatusNotFound, body: `{"error":"database not found: \"test\""}`}},
+			err:       errors.New(`{"error":"database not found: \"test\""}`),
+			writes:    1,
+			counts:    map[string]int{"status:404:action:fail": 1},
+		},
+		{
+			desc:      "fail write with configured status action",
+			actions:   writer.StatusActions{http.StatusBadRequest: writer.StatusFail},
+			responses: []stubResponse{{status: http.StatusBadRequest, body: badData}},
+			err:       errors.New(badData),
+			writes:    1,
+			counts:    map[string]int{"status:400:action:fail": 1},
+		},
+		{
+			desc:      "dead-letter write with configured status action",
+			actions:   writer.StatusActions{http.StatusServiceUnavailable: writer.StatusDeadLetter},
+			responses: []stubResponse{{status: http.StatusServiceUnavailable, body: `{"error":"engine: cache-max-memory-size exceeded"}`}},
+			err:       errors.New(`{"error":"engine: cache-max-memory-size exceeded"}`),
+			rejected:  true,
+			writes:    1,
+			counts:    map[string]int{"status:503:action:dead_letter": 1},
+		},
+		{
+			desc:      "write successfully",
+			responses: []stubResponse{{status: http.StatusNoContent}},
+			writes:    1,
+			counts:    map[string]int{},
+		},
+	}
+
+	for _, tc := range cases {
+		stub := &statusStub{responses: tc.responses}
+		ts := httptest.NewServer(stub)
+		hc, err := writer.NewHTTPClient(influxdata.HTTPConfig{Addr: ts.URL})
+		require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", tc.desc, err))
+
+		var sleeps []time.Duration
+		counts := make(map[string]int)
+		client := writer.NewRetryClient(hc, writer.RetryConfig{
+			Actions:    tc.actions,
+			Retries:    3,
+			Backoff:    time.Second,
+			MaxBackoff: time.Minute,
+			Counter:    tagCounterMock{counts: counts},
+			Sleep:      func(d time.Duration) { sleeps = append(sleeps, d) },
+		})
+
+		err = client.Write(batch(t, "", 2))
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s\n", tc.desc, tc.err, err))
+		rejected := errors.Contains(err, writers.ErrRejected)
+		assert.Equal(t, tc.rejected, rejected, fmt.Sprintf("%s: expected rejected %t got %t\n", tc.desc, tc.rejected, rejected))
+		assert.Equal(t, tc.writes, len(stub.databases), fmt.Sprintf("%s: expected %d writes got %d\n", tc.desc, tc.writes, len(stub.databases)))
+		assert.Equal(t, tc.sleeps, sleeps, fmt.Sprintf("%s: expected delays %v got %v\n", tc.desc, tc.sleeps, sleeps))
+		assert.Equal(t, tc.counts, counts, fmt.Sprintf("%s: expected counts %v got %v\n", tc.desc, tc.counts, counts))
+		for _, db := range stub.databases {
+			assert.Equal(t, testDB, db, fmt.Sprintf("%s: expected write to %s got %s\n", tc.desc, testDB, db))
+		}
+
+		client.Close()
+		ts.Close()
+	}
+}
+
+// unreachableClient fails the writes like an unreachable InfluxDB, and
+// counts them.
+type unreachableClient struct {
+	influxdata.Client
+	mu     sync.Mutex
+	writes int
+}
+
+func (c *unreachableClient) Write(influxdata.BatchPoints) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.writes++
+	return errors.New("dial tcp 127.0.0.1:8086: connect: connection refused")
+}
+
+// deadLetterMock records the messages published by subject.
+type deadLetterMock struct {
+	mu   sync.Mutex
+	msgs map[string][]messaging.Message
+}
+
+func (dl *deadLetterMock) PublishSubject(subject string, msg messaging.Message) error {
+	dl.mu.Lock()
+	defer dl.mu.Unlock()
+	dl.msgs[subject] = append(dl.msgs[subject], msg)
+	return nil
+}
+
+func TestRetryDeadLetter(t *testing.T) {
+	msg := messaging.Message{
+		Channel:   "45",
+		Publisher: "2580",
+		Protocol:  "http",
+		Payload:   []byte(`[{"n":"temp","v":21}]`),
+	}
+	subject := "dead_letters.influxdb"
+
+	uc := &unreachableClient{}
+	var sleeps []time.Duration
+	client := writer.NewRetryClient(uc, writer.RetryConfig{
+		Retries: 2,
+		Backoff: time.Second,
+		Sleep:   func(d time.Duration) { sleeps = append(sleeps, d) },
+	})
+	dl := &deadLetterMock{msgs: make(map[string][]messaging.Message)}
+	ps := mocks.NewPubSub()
+	consumer, err := writers.StartConsumer(ps, writer.New(client, testDB), senml.New(senml.JSON), writers.Config{
+		Streams:           []writers.Stream{{Subject: "channels.45"}},
+		DeadLetter:        dl,
+		DeadLetterSubject: subject,
+	}, testLog)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+
+	err = ps.Publish("channels.45", msg)
+	assert.NotNil(t, err, "expected the write to fail")
+	assert.Equal(t, 3, uc.writes, fmt.Sprintf("expected 3 writes got %d", uc.writes))
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second}, sleeps, fmt.Sprintf("expected delays of 1s and 2s got %v", sleeps))
+	assert.Equal(t, map[string][]messaging.Message{subject: {msg}}, dl.msgs, fmt.Sprintf("expected the message on %s got %v", subject, dl.msgs))
+
+	rep, err := consumer.Shutdown(context.Background())
+	assert.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	assert.Equal(t, uint64(1), rep.Failed, fmt.Sprintf("expected 1 failed message got %d", rep.Failed))
+	assert.Equal(t, uint64(1), rep.Republished, fmt.Sprintf("expected 1 republished message got %d", rep.Republished))
+}
+
+func TestParseStatusActions(t *testing.T) {
+	cases := []struct {
+		desc    string
+		actions string
+		res     string
+		err     error
+	}{
+		{
+			desc: "parse empty actions",
+			res:  "0:retry,400:dead_letter,429:retry,500:retry,503:retry",
+		},
+		{
+			desc:    "parse overriding and additional actions",
+			actions: "413:dead_letter, 500:fail",
+			res:     "0:retry,400:dead_letter,413:dead_letter,429:retry,500:fail,503:retry",
+		},
+		{
+			desc:    "parse action of writes without response",
+			actions: "0:fail",
+			res:     "0:fail,400:dead_letter,429:retry,500:retry,503:retry",
+		},
+		{
+			desc:    "parse unknown action",
+			actions: "500:drop",
+			err:     writer.ErrInvalidStatusAction,
+		},
+		{
+			desc:    "parse invalid status code",
+			actions: "5xx:retry",
+			err:     writer.ErrInvalidStatusAction,
+		},
+		{
+			desc:    "parse pair without action",
+			actions: "500",
+			err:     writer.ErrInvalidStatusAction,
+		},
+	}
+
+	for _, tc := range cases {
+		actions, err := writer.ParseStatusActions(tc.actions)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s\n", tc.desc, tc.err, err))
+		if tc.err == nil {
+			assert.Equal(t, tc.res, actions.String(), fmt.Sprintf("%s: expected %s got %s\n", tc.desc, tc.res, actions))
+		}
+	}
+}
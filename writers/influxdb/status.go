@@ -0,0 +1,162 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package influxdb
+
+import (
+	"bytes"
+	"crypto/tls"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"time"
+
+	influxdata "github.com/influxdata/influxdb/client/v2"
+)
+
+// StatusError is the error of a write which InfluxDB answered with an
+// unsuccessful HTTP status. It formats as the response body, like the
+// errors of the InfluxDB client.
+type StatusError struct {
+	// Code is the HTTP status code of the response.
+	Code int
+
+	// RetryAfter is the delay requested by the Retry-After header of the
+	// response, or zero if it has none.
+	RetryAfter time.Duration
+
+	// Body is the response body.
+	Body string
+}
+
+func (e *StatusError) Error() string {
+	return e.Body
+}
+
+var _ influxdata.Client = (*statusClient)(nil)
+
+type statusClient struct {
+	influxdata.Client
+	url        url.URL
+	username   string
+	password   string
+	useragent  string
+	httpClient *http.Client
+	transport  *http.Transport
+}
+
+// NewHTTPClient returns the HTTP client of the InfluxDB endpoint whose
+// failed writes return a *StatusError holding the response status. The
+// other requests are sent by the InfluxDB client.
+func NewHTTPClient(cfg influxdata.HTTPConfig) (influxdata.Client, error) {
+	client, err := influxdata.NewHTTPClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(cfg.Addr)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.UserAgent == "" {
+		cfg.UserAgent = "InfluxDBClient"
+	}
+
+	tr := &http.Transport{
+		TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: cfg.InsecureSkipVerify,
+		},
+		Proxy:       cfg.Proxy,
+		DialContext: cfg.DialContext,
+	}
+	if cfg.TLSConfig != nil {
+		tr.TLSClientConfig = cfg.TLSConfig
+		tr.TLSClientConfig.InsecureSkipVerify = cfg.InsecureSkipVerify
+	}
+	return &statusClient{
+		Client:    client,
+		url:       *u,
+		username:  cfg.Username,
+		password:  cfg.Password,
+		useragent: cfg.UserAgent,
+		httpClient: &http.Client{
+			Timeout:   cfg.Timeout,
+			Transport: tr,
+		},
+		transport: tr,
+	}, nil
+}
+
+// Write sends the points in line protocol like the InfluxDB client does.
+func (c *statusClient) Write(bp influxdata.BatchPoints) error {
+	var b bytes.Buffer
+	for _, p := range bp.Points() {
+		if p == nil {
+			continue
+		}
+		b.WriteString(p.PrecisionString(bp.Precision()))
+		b.WriteByte('\n')
+	}
+
+	u := c.url
+	u.Path = path.Join(u.Path, "write")
+	req, err := http.NewRequest("POST", u.String(), &b)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "")
+	req.Header.Set("User-Agent", c.useragent)
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	params := req.URL.Query()
+	params.Set("db", bp.Database())
+	params.Set("rp", bp.RetentionPolicy())
+	params.Set("precision", bp.Precision())
+	params.Set("consistency", bp.WriteConsistency())
+	req.URL.RawQuery = params.Encode()
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return &StatusError{
+			Code:       resp.StatusCode,
+			RetryAfter: retryAfter(resp.Header.Get("Retry-After"), time.Now()),
+			Body:       string(body),
+		}
+	}
+	return nil
+}
+
+func (c *statusClient) Close() error {
+	c.transport.CloseIdleConnections()
+	return c.Client.Close()
+}
+
+// retryAfter returns the delay requested by the Retry-After header, which
+// holds either the seconds to wait for or the time to retry at.
+func retryAfter(header string, now time.Time) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(header); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(header); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
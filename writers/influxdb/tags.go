@@ -1,10 +1,54 @@
 package influxdb
 
 import (
+	"fmt"
+	"sort"
+	"unicode/utf8"
+
+	"github.com/go-kit/kit/metrics"
+	"github.com/mainflux/mainflux/pkg/errors"
 	"github.com/mainflux/mainflux/pkg/transformers/json"
 	"github.com/mainflux/mainflux/pkg/transformers/senml"
+	"github.com/mainflux/mainflux/writers"
+)
+
+// TagPolicy defines how the writer handles tag values longer than the
+// maximum tag value length.
+type TagPolicy string
+
+const (
+	// TagTruncate cuts long tag values and ends them with TruncatedMarker.
+	TagTruncate TagPolicy = "truncate"
+
+	// TagReject dead-letters messages with long tag values.
+	TagReject TagPolicy = "reject"
+
+	// TruncatedMarker ends the truncated tag values.
+	TruncatedMarker = "..."
 )
 
+var (
+	// ErrInvalidTagPolicy indicates an unknown tag policy.
+	ErrInvalidTagPolicy = errors.New("invalid tag policy")
+
+	// ErrTagTooLong indicates that the message was rejected because of a
+	// tag value longer than the maximum tag value length.
+	ErrTagTooLong = errors.New("tag value too long")
+)
+
+// ParseTagPolicy returns the policy with the given name. An empty name
+// stands for TagTruncate.
+func ParseTagPolicy(name string) (TagPolicy, error) {
+	switch p := TagPolicy(name); p {
+	case "":
+		return TagTruncate, nil
+	case TagTruncate, TagReject:
+		return p, nil
+	default:
+		return "", errors.Wrap(ErrInvalidTagPolicy, fmt.Errorf("%s", name))
+	}
+}
+
 type tags map[string]string
 
 func senmlTags(msg senml.Message) tags {
@@ -23,3 +67,50 @@ func jsonTags(msg json.Message) tags {
 		"publisher": msg.Publisher,
 	}
 }
+
+// limit applies the policy to the tag values longer than max bytes, and
+// counts them with the tag key and the policy outcome. A zero max disables
+// the check. Rejected values make the error wrap writers.ErrRejected, so
+// that the message is dead-lettered.
+func (tgs tags) limit(max int, policy TagPolicy, counter metrics.Counter) error {
+	if max <= 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(tgs))
+	for k, v := range tgs {
+		if len(v) > max {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if policy == TagReject {
+			countTag(counter, k, "rejected")
+			return errors.Wrap(writers.ErrRejected, errors.Wrap(ErrTagTooLong, fmt.Errorf("tag %s has %d bytes, more than %d", k, len(tgs[k]), max)))
+		}
+		countTag(counter, k, "truncated")
+		tgs[k] = truncate(tgs[k], max)
+	}
+	return nil
+}
+
+func countTag(counter metrics.Counter, key, status string) {
+	if counter != nil {
+		counter.With("tag", key, "status", status).Add(1)
+	}
+}
+
+// truncate cuts the value to at most max bytes, ending with
+// TruncatedMarker if there is room for it, without splitting a UTF-8
+// encoded character.
+func truncate(v string, max int) string {
+	marker := TruncatedMarker
+	if max <= len(marker) {
+		marker = ""
+	}
+	cut := max - len(marker)
+	for cut > 0 && !utf8.RuneStart(v[cut]) {
+		cut--
+	}
+	return v[:cut] + marker
+}
@@ -0,0 +1,126 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package writers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mainflux/mainflux/pkg/errors"
+	"github.com/mainflux/mainflux/pkg/messaging"
+)
+
+// DefaultSubjectChannel is the default channel the messages with malformed
+// channels are written to by SubjectDefault.
+const DefaultSubjectChannel = "unknown"
+
+// SubjectPolicy defines how the consumer handles messages whose channel and
+// subtopic don't make a well-formed channels.<channel>[.<subtopic>]
+// subject, which would otherwise be written with misleading tags.
+type SubjectPolicy string
+
+const (
+	// SubjectDeadLetter dead-letters messages with malformed subjects.
+	SubjectDeadLetter SubjectPolicy = "dead_letter"
+
+	// SubjectDefault writes messages with malformed channels to the
+	// default channel, and drops malformed subtopics.
+	SubjectDefault SubjectPolicy = "default"
+)
+
+var (
+	// ErrInvalidSubjectPolicy indicates an unknown subject policy.
+	ErrInvalidSubjectPolicy = errors.New("invalid subject policy")
+
+	// ErrMalformedSubject indicates a message subject which isn't made of
+	// the channels prefix, the channel and the optional subtopic tokens.
+	ErrMalformedSubject = errors.New("malformed message subject")
+)
+
+// ParseSubjectPolicy returns the policy with the given name. An empty name
+// stands for SubjectDeadLetter.
+func ParseSubjectPolicy(name string) (SubjectPolicy, error) {
+	switch p := SubjectPolicy(name); p {
+	case "":
+		return SubjectDeadLetter, nil
+	case SubjectDeadLetter, SubjectDefault:
+		return p, nil
+	default:
+		return "", errors.Wrap(ErrInvalidSubjectPolicy, fmt.Errorf("%s", name))
+	}
+}
+
+// ParseSubject returns the channel and the subtopic of the message subject,
+// which is the channels prefix followed by the channel and the optional
+// subtopic tokens. None of the tokens can be empty, hold whitespace or
+// wildcards.
+func ParseSubject(subject string) (string, string, error) {
+	tokens := strings.Split(subject, tokenSep)
+	if len(tokens) < 2 || tokens[0] != subjectPrefix {
+		return "", "", errors.Wrap(ErrMalformedSubject, fmt.Errorf("subject %s isn't prefixed by %s%s", subject, subjectPrefix, tokenSep))
+	}
+	for _, t := range tokens[1:] {
+		if err := checkToken(t); err != nil {
+			return "", "", errors.Wrap(ErrMalformedSubject, fmt.Errorf("subject %s %s", subject, err))
+		}
+	}
+	return tokens[1], strings.Join(tokens[2:], tokenSep), nil
+}
+
+func checkToken(t string) error {
+	switch {
+	case t == "":
+		return fmt.Errorf("has an empty token")
+	case strings.ContainsAny(t, " \t\r\n"):
+		return fmt.Errorf("has whitespace within token %q", t)
+	case strings.ContainsAny(t, anyToken+anyTail):
+		return fmt.Errorf("has a wildcard within token %s", t)
+	default:
+		return nil
+	}
+}
+
+// checkSubject checks that the channel of the message is a single token and
+// that its subtopic is made of tokens, so that the message subject parses
+// back into them.
+func checkSubject(msg messaging.Message) (bool, bool) {
+	channel := !strings.Contains(msg.Channel, tokenSep) && checkToken(msg.Channel) == nil
+	subtopic := true
+	if msg.Subtopic != "" {
+		for _, t := range strings.Split(msg.Subtopic, tokenSep) {
+			if checkToken(t) != nil {
+				subtopic = false
+				break
+			}
+		}
+	}
+	return channel, subtopic
+}
+
+// handleSubject applies the subject policy to the message with a malformed
+// subject and returns the message to write, or an error if the message is
+// dead-lettered.
+func (s *stream) handleSubject(msg messaging.Message) (messaging.Message, error) {
+	channel, subtopic := checkSubject(msg)
+	if channel && subtopic {
+		return msg, nil
+	}
+
+	subject := MessageSubject(msg.Channel, msg.Subtopic)
+	s.count(s.subject, "malformed_subject", &s.malformed)
+	if s.subjectPolicy == SubjectDeadLetter {
+		s.count(s.subject, "dead_lettered", &s.deadLettered)
+		s.deadLetter(msg)
+		return msg, errors.Wrap(ErrMalformedSubject, fmt.Errorf("%q", subject))
+	}
+
+	if !channel {
+		msg.Channel = s.defaultChannel
+	}
+	if !subtopic {
+		msg.Subtopic = ""
+	}
+	s.logger.Warn(fmt.Sprintf("Writing message with malformed subject %q as %s", subject, MessageSubject(msg.Channel, msg.Subtopic)))
+	return msg, nil
+}
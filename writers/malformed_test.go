@@ -0,0 +1,216 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package writers_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/mainflux/mainflux/pkg/errors"
+	"github.com/mainflux/mainflux/pkg/messaging/nats"
+	"github.com/mainflux/mainflux/pkg/transformers/senml"
+	"github.com/mainflux/mainflux/writers"
+	"github.com/mainflux/mainflux/writers/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSubject(t *testing.T) {
+	cases := []struct {
+		desc     string
+		subject  string
+		channel  string
+		subtopic string
+		err      error
+	}{
+		{
+			desc:    "parse subject without subtopic",
+			subject: "channels.chan",
+			channel: "chan",
+		},
+		{
+			desc:     "parse subject with subtopic",
+			subject:  "channels.chan.room.temp",
+			channel:  "chan",
+			subtopic: "room.temp",
+		},
+		{
+			desc:    "parse subject without channel",
+			subject: "channels",
+			err:     writers.ErrMalformedSubject,
+		},
+		{
+			desc:    "parse subject with other prefix",
+			subject: "things.chan",
+			err:     writers.ErrMalformedSubject,
+		},
+		{
+			desc:    "parse subject with empty channel",
+			subject: "channels..temp",
+			err:     writers.ErrMalformedSubject,
+		},
+		{
+			desc:    "parse subject with empty subtopic token",
+			subject: "channels.chan.room..temp",
+			err:     writers.ErrMalformedSubject,
+		},
+		{
+			desc:    "parse subject with trailing separator",
+			subject: "channels.chan.",
+			err:     writers.ErrMalformedSubject,
+		},
+		{
+			desc:    "parse subject with wildcard",
+			subject: "channels.chan.*",
+			err:     writers.ErrMalformedSubject,
+		},
+		{
+			desc:    "parse subject with whitespace",
+			subject: "channels.chan.room temp",
+			err:     writers.ErrMalformedSubject,
+		},
+	}
+
+	for _, tc := range cases {
+		channel, subtopic, err := writers.ParseSubject(tc.subject)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s", tc.desc, tc.err, err))
+		assert.Equal(t, tc.channel, channel, fmt.Sprintf("%s: expected channel %s got %s", tc.desc, tc.channel, channel))
+		assert.Equal(t, tc.subtopic, subtopic, fmt.Sprintf("%s: expected subtopic %s got %s", tc.desc, tc.subtopic, subtopic))
+	}
+}
+
+func TestMalformedSubjects(t *testing.T) {
+	dlqSubject := "dead_letters.writer"
+
+	cases := []struct {
+		desc     string
+		policy   writers.SubjectPolicy
+		channel  string
+		subtopic string
+		written  []string
+		subjects []string
+		report   writers.ShutdownReport
+	}{
+		{
+			desc:     "write message with well-formed subject",
+			channel:  "chan",
+			subtopic: "room.temp",
+			written:  []string{"chan", "room.temp"},
+			report:   writers.ShutdownReport{Consumed: 1, Written: 1},
+		},
+		{
+			desc:     "dead-letter message without channel",
+			channel:  "",
+			subjects: []string{dlqSubject},
+			report:   writers.ShutdownReport{Consumed: 1, DeadLettered: 1, Republished: 1, MalformedSubjects: 1},
+		},
+		{
+			desc:     "dead-letter message with channel of many tokens",
+			channel:  "chan.room",
+			subjects: []string{dlqSubject},
+			report:   writers.ShutdownReport{Consumed: 1, DeadLettered: 1, Republished: 1, MalformedSubjects: 1},
+		},
+		{
+			desc:     "dead-letter message with wildcard subtopic",
+			channel:  "chan",
+			subtopic: "room.>",
+			subjects: []string{dlqSubject},
+			report:   writers.ShutdownReport{Consumed: 1, DeadLettered: 1, Republished: 1, MalformedSubjects: 1},
+		},
+		{
+			desc:     "write message without channel to default channel",
+			policy:   writers.SubjectDefault,
+			channel:  "",
+			subtopic: "room.temp",
+			written:  []string{writers.DefaultSubjectChannel, "room.temp"},
+			report:   writers.ShutdownReport{Consumed: 1, Written: 1, MalformedSubjects: 1},
+		},
+		{
+			desc:     "write message with empty subtopic token without subtopic",
+			policy:   writers.SubjectDefault,
+			channel:  "chan",
+			subtopic: "room..temp",
+			written:  []string{"chan", ""},
+			report:   writers.ShutdownReport{Consumed: 1, Written: 1, MalformedSubjects: 1},
+		},
+		{
+			desc:     "write message with whitespace to default channel without subtopic",
+			policy:   writers.SubjectDefault,
+			channel:  "my chan",
+			subtopic: " ",
+			written:  []string{writers.DefaultSubjectChannel, ""},
+			report:   writers.ShutdownReport{Consumed: 1, Written: 1, MalformedSubjects: 1},
+		},
+	}
+
+	for _, tc := range cases {
+		ps := mocks.NewPubSub()
+		repo := mocks.NewMessageRepository()
+		dl := &deadLetterMock{}
+		counter := newCounterMock()
+		c, err := writers.StartConsumer(ps, repo, senml.New(senml.JSON), writers.Config{
+			SubjectsConfigPath: subjectsCfgPath,
+			Counter:            counter,
+			SubjectPolicy:      tc.policy,
+			DeadLetter:         dl,
+			DeadLetterSubject:  dlqSubject,
+		}, testLog)
+		require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", tc.desc, err))
+
+		m := msg
+		m.Channel, m.Subtopic = tc.channel, tc.subtopic
+		ps.Publish(nats.SubjectAllChannels, m)
+		rep, err := c.Shutdown(context.Background())
+		require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", tc.desc, err))
+		assert.Equal(t, tc.report, rep, fmt.Sprintf("%s: expected %v got %v", tc.desc, tc.report, rep))
+		assert.Equal(t, tc.subjects, dl.subjects, fmt.Sprintf("%s: expected dead letters on %v got %v", tc.desc, tc.subjects, dl.subjects))
+		malformed := counter.value("subject", nats.SubjectAllChannels, "status", "malformed_subject")
+		assert.Equal(t, float64(tc.report.MalformedSubjects), malformed, fmt.Sprintf("%s: expected %d counted malformed subjects got %v", tc.desc, tc.report.MalformedSubjects, malformed))
+
+		var written []string
+		for _, msgs := range repo.Messages() {
+			for _, sm := range msgs.([]senml.Message) {
+				written = append(written, sm.Channel, sm.Subtopic)
+			}
+		}
+		assert.Equal(t, tc.written, written, fmt.Sprintf("%s: expected written channel and subtopic %v got %v", tc.desc, tc.written, written))
+	}
+}
+
+func TestParseSubjectPolicy(t *testing.T) {
+	cases := []struct {
+		desc   string
+		name   string
+		policy writers.SubjectPolicy
+		err    error
+	}{
+		{
+			desc:   "parse empty policy",
+			name:   "",
+			policy: writers.SubjectDeadLetter,
+		},
+		{
+			desc:   "parse dead-letter policy",
+			name:   "dead_letter",
+			policy: writers.SubjectDeadLetter,
+		},
+		{
+			desc:   "parse default policy",
+			name:   "default",
+			policy: writers.SubjectDefault,
+		},
+		{
+			desc: "parse unknown policy",
+			name: "drop",
+			err:  writers.ErrInvalidSubjectPolicy,
+		},
+	}
+
+	for _, tc := range cases {
+		policy, err := writers.ParseSubjectPolicy(tc.name)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s", tc.desc, tc.err, err))
+		assert.Equal(t, tc.policy, policy, fmt.Sprintf("%s: expected policy %s got %s", tc.desc, tc.policy, policy))
+	}
+}
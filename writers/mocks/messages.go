@@ -0,0 +1,46 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package mocks
+
+import (
+	"sync"
+
+	"github.com/mainflux/mainflux/writers"
+)
+
+var _ writers.MessageRepository = (*messageRepositoryMock)(nil)
+
+// MessageRepository is a mock message repository which keeps
+// saved messages in memory.
+type MessageRepository interface {
+	writers.MessageRepository
+
+	// Messages returns all the saved messages.
+	Messages() []interface{}
+}
+
+type messageRepositoryMock struct {
+	mu       sync.Mutex
+	messages []interface{}
+}
+
+// NewMessageRepository returns mock message repository.
+func NewMessageRepository() MessageRepository {
+	return &messageRepositoryMock{}
+}
+
+func (repo *messageRepositoryMock) Save(msgs interface{}) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	repo.messages = append(repo.messages, msgs)
+	return nil
+}
+
+func (repo *messageRepositoryMock) Messages() []interface{} {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	return append([]interface{}{}, repo.messages...)
+}
@@ -0,0 +1,58 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package mocks
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/mainflux/mainflux/pkg/messaging"
+)
+
+var errNotSubscribed = errors.New("not subscribed")
+
+var _ messaging.PubSub = (*pubSubMock)(nil)
+
+type pubSubMock struct {
+	mu       sync.Mutex
+	handlers map[string]messaging.MessageHandler
+}
+
+// NewPubSub returns mock message publisher/subscriber. Published messages
+// are synchronously delivered to the handler subscribed to the same topic.
+func NewPubSub() messaging.PubSub {
+	return &pubSubMock{
+		handlers: make(map[string]messaging.MessageHandler),
+	}
+}
+
+func (ps *pubSubMock) Publish(topic string, msg messaging.Message) error {
+	ps.mu.Lock()
+	h, ok := ps.handlers[topic]
+	ps.mu.Unlock()
+
+	if !ok {
+		return errNotSubscribed
+	}
+	return h(msg)
+}
+
+func (ps *pubSubMock) Subscribe(topic string, handler messaging.MessageHandler) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	ps.handlers[topic] = handler
+	return nil
+}
+
+func (ps *pubSubMock) Unsubscribe(topic string) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if _, ok := ps.handlers[topic]; !ok {
+		return errNotSubscribed
+	}
+	delete(ps.handlers, topic)
+	return nil
+}
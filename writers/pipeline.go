@@ -0,0 +1,250 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package writers
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sync/atomic"
+
+	"github.com/BurntSushi/toml"
+	"github.com/mainflux/mainflux/pkg/errors"
+	"github.com/mainflux/mainflux/pkg/transformers"
+	"github.com/mainflux/mainflux/pkg/transformers/json"
+	"github.com/mainflux/mainflux/pkg/transformers/senml"
+)
+
+const contentTypeParam = "content_type"
+
+var (
+	// ErrInvalidPipeline indicates that the pipeline declaration is invalid.
+	ErrInvalidPipeline = errors.New("invalid pipeline configuration")
+
+	errUnknownTransformer = errors.New("unknown transformer")
+	errUnknownParam       = errors.New("unknown transformer parameter")
+	errInvalidParam       = errors.New("invalid transformer parameter value")
+	errInvalidRoute       = errors.New("invalid route")
+	errInvalidStream      = errors.New("invalid stream")
+)
+
+// TransformerConfig declares the transformer used to decode messages and
+// its parameters.
+type TransformerConfig struct {
+	Name   string            `toml:"name"`
+	Params map[string]string `toml:"params"`
+}
+
+// RouteConfig routes messages of the listed channels to the target. The
+// meaning of the target depends on the writer (e.g. InfluxDB retention tier).
+type RouteConfig struct {
+	Channels []string `toml:"channels"`
+	Target   string   `toml:"target"`
+}
+
+// StreamConfig declares a subject subscribed to independently, with its
+// own transformer and routes.
+type StreamConfig struct {
+	Subject     string            `toml:"subject"`
+	Transformer TransformerConfig `toml:"transformer"`
+	Routes      []RouteConfig     `toml:"routes"`
+}
+
+// PipelineConfig declares the stages messages pass through before they
+// are written.
+type PipelineConfig struct {
+	Transformer   TransformerConfig    `toml:"transformer"`
+	Routes        []RouteConfig        `toml:"routes"`
+	SubjectRoutes []SubjectRouteConfig `toml:"subject_routes"`
+	ContentRoutes []ContentRouteConfig `toml:"content_routes"`
+	Streams       []StreamConfig       `toml:"streams"`
+}
+
+// Pipeline represents the pipeline built from its declaration.
+type Pipeline struct {
+	// Subjects is the list of subjects to subscribe to. If the file
+	// lists none, all the channels are subscribed to.
+	Subjects []string
+
+	// Transformer transforms received messages. It is nil if the
+	// declaration doesn't specify one.
+	Transformer transformers.Transformer
+
+	// Routes maps the channel ID to the route target.
+	Routes map[string]string
+
+	// SubjectRoutes is the list of subject routes, ordered from the most
+	// specific one.
+	SubjectRoutes []SubjectRoute
+
+	// ContentRoutes is the list of content routes in the order of their
+	// declaration. Writers match them against the decoded messages ahead
+	// of the subject routes.
+	ContentRoutes []ContentRoute
+
+	// Streams is the list of independently consumed subjects. Streams
+	// without their own transformer use the pipeline transformer.
+	Streams []Stream
+}
+
+// Routes holds the pipeline routes, which can be replaced while messages
+// are being written.
+type Routes struct {
+	v atomic.Value
+}
+
+// NewRoutes returns the routes holding the provided map of channel IDs to
+// route targets. The map must not be modified afterwards.
+func NewRoutes(routes map[string]string) *Routes {
+	r := &Routes{}
+	r.Store(routes)
+	return r
+}
+
+// Target returns the target the channel is routed to.
+func (r *Routes) Target(channel string) (string, bool) {
+	routes := r.v.Load().(map[string]string)
+	t, ok := routes[channel]
+	return t, ok
+}
+
+// Store replaces the routes. The map must not be modified afterwards.
+func (r *Routes) Store(routes map[string]string) {
+	if routes == nil {
+		routes = map[string]string{}
+	}
+	r.v.Store(routes)
+}
+
+type pipelineFile struct {
+	Subjects filterConfig   `toml:"subjects"`
+	Pipeline PipelineConfig `toml:"pipeline"`
+}
+
+// LoadPipeline loads the pipeline declared in the configuration file.
+// The subjects are read from the same file StartConsumer uses. If the
+// file is malformed or lists an invalid subject, the error wraps
+// ErrInvalidPipeline.
+func LoadPipeline(path string) (Pipeline, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Pipeline{}, errors.Wrap(errOpenConfFile, err)
+	}
+
+	var f pipelineFile
+	if err := toml.Unmarshal(data, &f); err != nil {
+		return Pipeline{}, errors.Wrap(ErrInvalidPipeline, errors.Wrap(errParseConfFile, err))
+	}
+
+	subjects, err := filterSubjects(f.Subjects)
+	if err != nil {
+		return Pipeline{}, errors.Wrap(ErrInvalidPipeline, err)
+	}
+
+	p, err := NewPipeline(f.Pipeline)
+	if err != nil {
+		return Pipeline{}, err
+	}
+	p.Subjects = subjects
+
+	return p, nil
+}
+
+// NewPipeline validates the declaration and builds the pipeline.
+func NewPipeline(cfg PipelineConfig) (Pipeline, error) {
+	t, err := newTransformer(cfg.Transformer)
+	if err != nil {
+		return Pipeline{}, errors.Wrap(ErrInvalidPipeline, err)
+	}
+
+	routes := make(map[string]string)
+	if err := addRoutes(routes, cfg.Routes); err != nil {
+		return Pipeline{}, errors.Wrap(ErrInvalidPipeline, err)
+	}
+
+	subjectRoutes, err := newSubjectRoutes(cfg.SubjectRoutes)
+	if err != nil {
+		return Pipeline{}, errors.Wrap(ErrInvalidPipeline, err)
+	}
+
+	contentRoutes, err := newContentRoutes(cfg.ContentRoutes)
+	if err != nil {
+		return Pipeline{}, errors.Wrap(ErrInvalidPipeline, err)
+	}
+
+	var streams []Stream
+	subjects := make(map[string]bool)
+	for i, sc := range cfg.Streams {
+		if sc.Subject == "" {
+			return Pipeline{}, errors.Wrap(ErrInvalidPipeline, errors.Wrap(errInvalidStream, fmt.Errorf("stream %d has no subject", i)))
+		}
+		if subjects[sc.Subject] {
+			return Pipeline{}, errors.Wrap(ErrInvalidPipeline, errors.Wrap(errInvalidStream, fmt.Errorf("subject %s declared twice", sc.Subject)))
+		}
+		subjects[sc.Subject] = true
+
+		st, err := newTransformer(sc.Transformer)
+		if err != nil {
+			return Pipeline{}, errors.Wrap(ErrInvalidPipeline, err)
+		}
+		if st == nil {
+			st = t
+		}
+		if err := addRoutes(routes, sc.Routes); err != nil {
+			return Pipeline{}, errors.Wrap(ErrInvalidPipeline, err)
+		}
+		streams = append(streams, Stream{Subject: sc.Subject, Transformer: st})
+	}
+
+	return Pipeline{
+		Transformer:   t,
+		Routes:        routes,
+		SubjectRoutes: subjectRoutes,
+		ContentRoutes: contentRoutes,
+		Streams:       streams,
+	}, nil
+}
+
+func addRoutes(routes map[string]string, cfgs []RouteConfig) error {
+	for i, r := range cfgs {
+		if r.Target == "" {
+			return errors.Wrap(errInvalidRoute, fmt.Errorf("route %d has no target", i))
+		}
+		for _, ch := range r.Channels {
+			if t, ok := routes[ch]; ok {
+				return errors.Wrap(errInvalidRoute, fmt.Errorf("channel %s already routed to %s", ch, t))
+			}
+			routes[ch] = r.Target
+		}
+	}
+	return nil
+}
+
+func newTransformer(cfg TransformerConfig) (transformers.Transformer, error) {
+	switch cfg.Name {
+	case "":
+		if len(cfg.Params) > 0 {
+			return nil, errors.Wrap(errUnknownTransformer, fmt.Errorf("parameters set without transformer name"))
+		}
+		return nil, nil
+	case "senml":
+		ct := senml.JSON
+		for k, v := range cfg.Params {
+			if k != contentTypeParam {
+				return nil, errors.Wrap(errUnknownParam, fmt.Errorf("%s: %s", cfg.Name, k))
+			}
+			if v != senml.JSON && v != senml.CBOR {
+				return nil, errors.Wrap(errInvalidParam, fmt.Errorf("%s: %s = %s", cfg.Name, k, v))
+			}
+			ct = v
+		}
+		return senml.New(ct), nil
+	case "json":
+		for k := range cfg.Params {
+			return nil, errors.Wrap(errUnknownParam, fmt.Errorf("%s: %s", cfg.Name, k))
+		}
+		return json.New(), nil
+	default:
+		return nil, errors.Wrap(errUnknownTransformer, fmt.Errorf("%s", cfg.Name))
+	}
+}
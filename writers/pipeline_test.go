@@ -0,0 +1,386 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package writers_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/mainflux/mainflux/pkg/errors"
+	"github.com/mainflux/mainflux/pkg/transformers"
+	"github.com/mainflux/mainflux/pkg/transformers/json"
+	"github.com/mainflux/mainflux/pkg/transformers/senml"
+	"github.com/mainflux/mainflux/writers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const pipelineCfg = `
+[subjects]
+filter = ["channels.telemetry", "channels.billing.>"]
+
+[pipeline]
+  [pipeline.transformer]
+  name = "senml"
+    [pipeline.transformer.params]
+    content_type = "application/senml+cbor"
+
+  [[pipeline.routes]]
+  channels = ["telemetry", "sensors"]
+  target = "short"
+
+  [[pipeline.routes]]
+  channels = ["billing"]
+  target = "long"
+`
+
+func TestLoadPipeline(t *testing.T) {
+	f, err := ioutil.TempFile("", "pipeline-*.toml")
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(pipelineCfg)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	f.Close()
+
+	p, err := writers.LoadPipeline(f.Name())
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+
+	subjects := []string{"channels.telemetry", "channels.billing.>"}
+	routes := map[string]string{
+		"telemetry": "short",
+		"sensors":   "short",
+		"billing":   "long",
+	}
+	assert.Equal(t, subjects, p.Subjects, fmt.Sprintf("expected subjects %v got %v", subjects, p.Subjects))
+	assert.Equal(t, senml.New(senml.CBOR), p.Transformer, "expected SenML CBOR transformer")
+	assert.Equal(t, routes, p.Routes, fmt.Sprintf("expected routes %v got %v", routes, p.Routes))
+
+	_, err = writers.LoadPipeline(subjectsCfgPath)
+	assert.NotNil(t, err, "loading non-existing pipeline configuration expected to fail")
+	assert.False(t, errors.Contains(err, writers.ErrInvalidPipeline), fmt.Sprintf("loading non-existing pipeline configuration: expected missing file error got %s", err))
+}
+
+func TestLoadPipelineSubjects(t *testing.T) {
+	cases := []struct {
+		desc     string
+		cfg      string
+		subjects []string
+		err      error
+	}{
+		{
+			desc:     "load tenant subjects",
+			cfg:      "[subjects]\nfilter = [\"channels.tenant-a.>\", \"channels.tenant-b.*\"]\n",
+			subjects: []string{"channels.tenant-a.>", "channels.tenant-b.*"},
+			err:      nil,
+		},
+		{
+			desc:     "load configuration without subjects",
+			cfg:      "[pipeline]\n  [pipeline.transformer]\n  name = \"json\"\n",
+			subjects: []string{"channels.>"},
+			err:      nil,
+		},
+		{
+			desc:     "load empty subject list",
+			cfg:      "[subjects]\nfilter = []\n",
+			subjects: []string{"channels.>"},
+			err:      nil,
+		},
+		{
+			desc: "load malformed configuration",
+			cfg:  "[subjects\nfilter = [\"channels.>\"]\n",
+			err:  writers.ErrInvalidPipeline,
+		},
+		{
+			desc: "load subjects of wrong type",
+			cfg:  "[subjects]\nfilter = \"channels.>\"\n",
+			err:  writers.ErrInvalidPipeline,
+		},
+		{
+			desc: "load subject with empty token",
+			cfg:  "[subjects]\nfilter = [\"channels..>\"]\n",
+			err:  writers.ErrInvalidPipeline,
+		},
+		{
+			desc: "load subject with whitespace",
+			cfg:  "[subjects]\nfilter = [\"channels.tenant a\"]\n",
+			err:  writers.ErrInvalidPipeline,
+		},
+		{
+			desc: "load subject with misplaced wildcard",
+			cfg:  "[subjects]\nfilter = [\"channels.>.temp\"]\n",
+			err:  writers.ErrInvalidPipeline,
+		},
+	}
+
+	for _, tc := range cases {
+		f, err := ioutil.TempFile("", "subjects-*.toml")
+		require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", tc.desc, err))
+		_, err = f.WriteString(tc.cfg)
+		require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", tc.desc, err))
+		f.Close()
+
+		p, err := writers.LoadPipeline(f.Name())
+		os.Remove(f.Name())
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s", tc.desc, tc.err, err))
+		if tc.err != nil {
+			continue
+		}
+		assert.Equal(t, tc.subjects, p.Subjects, fmt.Sprintf("%s: expected subjects %v got %v", tc.desc, tc.subjects, p.Subjects))
+	}
+}
+
+func TestNewPipeline(t *testing.T) {
+	cases := []struct {
+		desc        string
+		cfg         writers.PipelineConfig
+		transformer transformers.Transformer
+		routes      map[string]string
+		streams     []writers.Stream
+		err         error
+	}{
+		{
+			desc:        "build empty pipeline",
+			cfg:         writers.PipelineConfig{},
+			transformer: nil,
+			routes:      map[string]string{},
+			err:         nil,
+		},
+		{
+			desc: "build pipeline with default SenML transformer",
+			cfg: writers.PipelineConfig{
+				Transformer: writers.TransformerConfig{Name: "senml"},
+			},
+			transformer: senml.New(senml.JSON),
+			routes:      map[string]string{},
+			err:         nil,
+		},
+		{
+			desc: "build pipeline with JSON transformer and routes",
+			cfg: writers.PipelineConfig{
+				Transformer: writers.TransformerConfig{Name: "json"},
+				Routes: []writers.RouteConfig{
+					{Channels: []string{"telemetry"}, Target: "short"},
+				},
+			},
+			transformer: json.New(),
+			routes:      map[string]string{"telemetry": "short"},
+			err:         nil,
+		},
+		{
+			desc: "build pipeline with streams",
+			cfg: writers.PipelineConfig{
+				Transformer: writers.TransformerConfig{Name: "senml"},
+				Routes: []writers.RouteConfig{
+					{Channels: []string{"telemetry"}, Target: "short"},
+				},
+				Streams: []writers.StreamConfig{
+					{Subject: "channels.telemetry"},
+					{
+						Subject:     "channels.billing",
+						Transformer: writers.TransformerConfig{Name: "json"},
+						Routes: []writers.RouteConfig{
+							{Channels: []string{"billing"}, Target: "long"},
+						},
+					},
+				},
+			},
+			transformer: senml.New(senml.JSON),
+			routes:      map[string]string{"telemetry": "short", "billing": "long"},
+			streams: []writers.Stream{
+				{Subject: "channels.telemetry", Transformer: senml.New(senml.JSON)},
+				{Subject: "channels.billing", Transformer: json.New()},
+			},
+			err: nil,
+		},
+		{
+			desc: "build pipeline with stream without subject",
+			cfg: writers.PipelineConfig{
+				Streams: []writers.StreamConfig{{}},
+			},
+			err: writers.ErrInvalidPipeline,
+		},
+		{
+			desc: "build pipeline with subject declared twice",
+			cfg: writers.PipelineConfig{
+				Streams: []writers.StreamConfig{
+					{Subject: "channels.telemetry"},
+					{Subject: "channels.telemetry"},
+				},
+			},
+			err: writers.ErrInvalidPipeline,
+		},
+		{
+			desc: "build pipeline with channel routed twice by streams",
+			cfg: writers.PipelineConfig{
+				Routes: []writers.RouteConfig{
+					{Channels: []string{"telemetry"}, Target: "short"},
+				},
+				Streams: []writers.StreamConfig{
+					{
+						Subject: "channels.telemetry",
+						Routes: []writers.RouteConfig{
+							{Channels: []string{"telemetry"}, Target: "long"},
+						},
+					},
+				},
+			},
+			err: writers.ErrInvalidPipeline,
+		},
+		{
+			desc: "build pipeline with unknown transformer",
+			cfg: writers.PipelineConfig{
+				Transformer: writers.TransformerConfig{Name: "xml"},
+			},
+			err: writers.ErrInvalidPipeline,
+		},
+		{
+			desc: "build pipeline with unknown transformer parameter",
+			cfg: writers.PipelineConfig{
+				Transformer: writers.TransformerConfig{
+					Name:   "senml",
+					Params: map[string]string{"format": "cbor"},
+				},
+			},
+			err: writers.ErrInvalidPipeline,
+		},
+		{
+			desc: "build pipeline with invalid content type",
+			cfg: writers.PipelineConfig{
+				Transformer: writers.TransformerConfig{
+					Name:   "senml",
+					Params: map[string]string{"content_type": "application/xml"},
+				},
+			},
+			err: writers.ErrInvalidPipeline,
+		},
+		{
+			desc: "build pipeline with route without target",
+			cfg: writers.PipelineConfig{
+				Routes: []writers.RouteConfig{
+					{Channels: []string{"telemetry"}},
+				},
+			},
+			err: writers.ErrInvalidPipeline,
+		},
+		{
+			desc: "build pipeline with channel routed twice",
+			cfg: writers.PipelineConfig{
+				Routes: []writers.RouteConfig{
+					{Channels: []string{"telemetry"}, Target: "short"},
+					{Channels: []string{"telemetry"}, Target: "long"},
+				},
+			},
+			err: writers.ErrInvalidPipeline,
+		},
+		{
+			desc: "build pipeline with subject route without target",
+			cfg: writers.PipelineConfig{
+				SubjectRoutes: []writers.SubjectRouteConfig{
+					{Subject: "channels.*.sensors.*"},
+				},
+			},
+			err: writers.ErrInvalidPipeline,
+		},
+		{
+			desc: "build pipeline with subject route with empty token",
+			cfg: writers.PipelineConfig{
+				SubjectRoutes: []writers.SubjectRouteConfig{
+					{Subject: "channels..sensors", Target: "sensors"},
+				},
+			},
+			err: writers.ErrInvalidPipeline,
+		},
+		{
+			desc: "build pipeline with subject route with tail wildcard before the last token",
+			cfg: writers.PipelineConfig{
+				SubjectRoutes: []writers.SubjectRouteConfig{
+					{Subject: "channels.>.sensors", Target: "sensors"},
+				},
+			},
+			err: writers.ErrInvalidPipeline,
+		},
+		{
+			desc: "build pipeline with subject route with wildcard within a token",
+			cfg: writers.PipelineConfig{
+				SubjectRoutes: []writers.SubjectRouteConfig{
+					{Subject: "channels.sensor*", Target: "sensors"},
+				},
+			},
+			err: writers.ErrInvalidPipeline,
+		},
+		{
+			desc: "build pipeline with subject routed twice",
+			cfg: writers.PipelineConfig{
+				SubjectRoutes: []writers.SubjectRouteConfig{
+					{Subject: "channels.*.sensors.*", Target: "sensors"},
+					{Subject: "channels.*.sensors.*", Target: "metrics"},
+				},
+			},
+			err: writers.ErrInvalidPipeline,
+		},
+		{
+			desc: "build pipeline with content route without field",
+			cfg: writers.PipelineConfig{
+				ContentRoutes: []writers.ContentRouteConfig{{Target: "temperature"}},
+			},
+			err: writers.ErrInvalidPipeline,
+		},
+		{
+			desc: "build pipeline with content route without target",
+			cfg: writers.PipelineConfig{
+				ContentRoutes: []writers.ContentRouteConfig{{Field: "temp"}},
+			},
+			err: writers.ErrInvalidPipeline,
+		},
+		{
+			desc: "build pipeline with content routed twice",
+			cfg: writers.PipelineConfig{
+				ContentRoutes: []writers.ContentRouteConfig{
+					{Field: "n", Value: "temp", Target: "temperature"},
+					{Field: "n", Value: "temp", Target: "metrics"},
+				},
+			},
+			err: writers.ErrInvalidPipeline,
+		},
+	}
+
+	for _, tc := range cases {
+		p, err := writers.NewPipeline(tc.cfg)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s", tc.desc, tc.err, err))
+		if tc.err != nil {
+			continue
+		}
+		assert.IsType(t, tc.transformer, p.Transformer, fmt.Sprintf("%s: expected transformer %T got %T", tc.desc, tc.transformer, p.Transformer))
+		if tc.cfg.Transformer.Name == "senml" {
+			assert.Equal(t, tc.transformer, p.Transformer, fmt.Sprintf("%s: unexpected transformer configuration", tc.desc))
+		}
+		assert.Equal(t, tc.routes, p.Routes, fmt.Sprintf("%s: expected routes %v got %v", tc.desc, tc.routes, p.Routes))
+		assert.Equal(t, len(tc.streams), len(p.Streams), fmt.Sprintf("%s: expected %d streams got %d", tc.desc, len(tc.streams), len(p.Streams)))
+		for i, st := range p.Streams {
+			assert.Equal(t, tc.streams[i].Subject, st.Subject, fmt.Sprintf("%s: expected subject %s got %s", tc.desc, tc.streams[i].Subject, st.Subject))
+			assert.IsType(t, tc.streams[i].Transformer, st.Transformer, fmt.Sprintf("%s: expected transformer %T got %T", tc.desc, tc.streams[i].Transformer, st.Transformer))
+		}
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	routes := writers.NewRoutes(map[string]string{"telemetry": "short"})
+
+	target, ok := routes.Target("telemetry")
+	assert.True(t, ok, "expected channel to be routed")
+	assert.Equal(t, "short", target, fmt.Sprintf("expected target short got %s", target))
+
+	routes.Store(map[string]string{"billing": "long"})
+	_, ok = routes.Target("telemetry")
+	assert.False(t, ok, "expected replaced route to be removed")
+	target, ok = routes.Target("billing")
+	assert.True(t, ok, "expected channel to be routed")
+	assert.Equal(t, "long", target, fmt.Sprintf("expected target long got %s", target))
+
+	routes.Store(nil)
+	_, ok = routes.Target("billing")
+	assert.False(t, ok, "expected no routes")
+}
@@ -0,0 +1,200 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package writers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/mainflux/mainflux/pkg/errors"
+)
+
+const (
+	subjectPrefix = "channels"
+	tokenSep      = "."
+	anyToken      = "*"
+	anyTail       = ">"
+)
+
+var errInvalidSubjectRoute = errors.New("invalid subject route")
+
+// SubjectRouteConfig routes messages whose subject matches the pattern to
+// the target. The pattern is a list of dot separated tokens, where "*"
+// matches any single token and a trailing ">" matches one or more
+// tokens. The meaning of the target depends on the writer (e.g. InfluxDB
+// measurement).
+type SubjectRouteConfig struct {
+	Subject string `toml:"subject"`
+	Target  string `toml:"target"`
+}
+
+// SubjectRoute represents the validated subject route.
+type SubjectRoute struct {
+	Subject string
+	Target  string
+	tokens  []string
+}
+
+// NewSubjectRoute validates the subject pattern and returns the route.
+func NewSubjectRoute(subject, target string) (SubjectRoute, error) {
+	if target == "" {
+		return SubjectRoute{}, errors.Wrap(errInvalidSubjectRoute, fmt.Errorf("subject %s has no target", subject))
+	}
+	if subject == "" {
+		return SubjectRoute{}, errors.Wrap(errInvalidSubjectRoute, fmt.Errorf("route to %s has no subject", target))
+	}
+	tokens, err := subjectTokens(subject)
+	if err != nil {
+		return SubjectRoute{}, errors.Wrap(errInvalidSubjectRoute, err)
+	}
+	return SubjectRoute{Subject: subject, Target: target, tokens: tokens}, nil
+}
+
+// subjectTokens splits the subject pattern into its tokens, checking that
+// none is empty or holds whitespace, and that the wildcards are whole
+// tokens.
+func subjectTokens(subject string) ([]string, error) {
+	tokens := strings.Split(subject, tokenSep)
+	for i, t := range tokens {
+		switch {
+		case t == "":
+			return nil, fmt.Errorf("subject %s has an empty token", subject)
+		case strings.ContainsAny(t, " \t\r\n"):
+			return nil, fmt.Errorf("subject %s has whitespace within token %s", subject, t)
+		case t == anyTail && i != len(tokens)-1:
+			return nil, fmt.Errorf("subject %s has %s before the last token", subject, anyTail)
+		case t != anyToken && t != anyTail && strings.ContainsAny(t, anyToken+anyTail):
+			return nil, fmt.Errorf("subject %s has a wildcard within token %s", subject, t)
+		}
+	}
+	return tokens, nil
+}
+
+// Match reports whether the subject matches the route pattern.
+func (r SubjectRoute) Match(subject string) bool {
+	tokens := strings.Split(subject, tokenSep)
+	for i, t := range r.tokens {
+		if t == anyTail {
+			return len(tokens) > i
+		}
+		if i >= len(tokens) || (t != anyToken && t != tokens[i]) {
+			return false
+		}
+	}
+	return len(tokens) == len(r.tokens)
+}
+
+func (r SubjectRoute) literals() int {
+	n := 0
+	for _, t := range r.tokens {
+		if t != anyToken && t != anyTail {
+			n++
+		}
+	}
+	return n
+}
+
+func (r SubjectRoute) tail() bool {
+	return r.tokens[len(r.tokens)-1] == anyTail
+}
+
+func rank(token string) int {
+	switch token {
+	case anyTail:
+		return 2
+	case anyToken:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// precedes reports whether the route takes precedence over the other one
+// when both match a subject. The route with more literal tokens wins;
+// then the one without a trailing ">"; then the one with a literal token
+// where the other has a wildcard, comparing the tokens from the left.
+func (r SubjectRoute) precedes(o SubjectRoute) bool {
+	if rl, ol := r.literals(), o.literals(); rl != ol {
+		return rl > ol
+	}
+	if rt, ot := r.tail(), o.tail(); rt != ot {
+		return ot
+	}
+	for i := 0; i < len(r.tokens) && i < len(o.tokens); i++ {
+		if rr, or := rank(r.tokens[i]), rank(o.tokens[i]); rr != or {
+			return rr < or
+		}
+	}
+	if len(r.tokens) != len(o.tokens) {
+		return len(r.tokens) > len(o.tokens)
+	}
+	return r.Subject < o.Subject
+}
+
+func newSubjectRoutes(cfgs []SubjectRouteConfig) ([]SubjectRoute, error) {
+	var routes []SubjectRoute
+	subjects := make(map[string]string)
+	for _, c := range cfgs {
+		if t, ok := subjects[c.Subject]; ok {
+			return nil, errors.Wrap(errInvalidSubjectRoute, fmt.Errorf("subject %s already routed to %s", c.Subject, t))
+		}
+		r, err := NewSubjectRoute(c.Subject, c.Target)
+		if err != nil {
+			return nil, err
+		}
+		subjects[c.Subject] = c.Target
+		routes = append(routes, r)
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		return routes[i].precedes(routes[j])
+	})
+	return routes, nil
+}
+
+// MessageSubject returns the subject the message of the channel and
+// subtopic is published to.
+func MessageSubject(channel, subtopic string) string {
+	subject := subjectPrefix + tokenSep + channel
+	if subtopic != "" {
+		subject += tokenSep + subtopic
+	}
+	return subject
+}
+
+// SubjectRoutes holds the pipeline subject routes, which can be replaced
+// while messages are being written.
+type SubjectRoutes struct {
+	v atomic.Value
+}
+
+// NewSubjectRoutes returns the subject routes holding the provided routes
+// ordered by precedence, as built by NewPipeline. The slice must not be
+// modified afterwards.
+func NewSubjectRoutes(routes []SubjectRoute) *SubjectRoutes {
+	r := &SubjectRoutes{}
+	r.Store(routes)
+	return r
+}
+
+// Target returns the target of the most specific route matching the
+// subject.
+func (r *SubjectRoutes) Target(subject string) (string, bool) {
+	for _, route := range r.v.Load().([]SubjectRoute) {
+		if route.Match(subject) {
+			return route.Target, true
+		}
+	}
+	return "", false
+}
+
+// Store replaces the subject routes. The slice must not be modified
+// afterwards.
+func (r *SubjectRoutes) Store(routes []SubjectRoute) {
+	if routes == nil {
+		routes = []SubjectRoute{}
+	}
+	r.v.Store(routes)
+}
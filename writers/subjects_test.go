@@ -0,0 +1,132 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package writers_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/mainflux/mainflux/writers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubjectRoutes(t *testing.T) {
+	p, err := writers.NewPipeline(writers.PipelineConfig{
+		SubjectRoutes: []writers.SubjectRouteConfig{
+			{Subject: "channels.>", Target: "messages"},
+			{Subject: "channels.*.sensors.*", Target: "sensors"},
+			{Subject: "channels.*.sensors.temp", Target: "temperature"},
+			{Subject: "channels.42.>", Target: "fleet"},
+			{Subject: "channels.42.*.*", Target: "fleet_sensors"},
+			{Subject: "channels.*.*.temp", Target: "any_temperature"},
+			{Subject: "channels.7.sensors.>", Target: "depot"},
+			{Subject: "channels.7.*.*", Target: "depot_sensors"},
+		},
+	})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	routes := writers.NewSubjectRoutes(p.SubjectRoutes)
+
+	cases := []struct {
+		desc    string
+		subject string
+		target  string
+		routed  bool
+	}{
+		{
+			desc:    "route subject matching the tail wildcard only",
+			subject: "channels.1",
+			target:  "messages",
+			routed:  true,
+		},
+		{
+			desc:    "route subject matching single token wildcards over tail wildcard",
+			subject: "channels.1.sensors.hum",
+			target:  "sensors",
+			routed:  true,
+		},
+		{
+			desc:    "route subject matching more literal tokens",
+			subject: "channels.1.sensors.temp",
+			target:  "temperature",
+			routed:  true,
+		},
+		{
+			desc:    "route subject with equal literal tokens to pattern without tail wildcard",
+			subject: "channels.42.sensors.hum",
+			target:  "fleet_sensors",
+			routed:  true,
+		},
+		{
+			desc:    "route subject with equal literal tokens to leftmost literal token",
+			subject: "channels.42.actuators.temp",
+			target:  "fleet_sensors",
+			routed:  true,
+		},
+		{
+			desc:    "route subject matching tail wildcard with more literal tokens",
+			subject: "channels.7.sensors.hum",
+			target:  "depot",
+			routed:  true,
+		},
+		{
+			desc:    "route subject matching a literal token before a wildcard",
+			subject: "channels.1.actuators.temp",
+			target:  "any_temperature",
+			routed:  true,
+		},
+		{
+			desc:    "route longer subject to the tail wildcard",
+			subject: "channels.42.sensors.temp.raw",
+			target:  "fleet",
+			routed:  true,
+		},
+		{
+			desc:    "route subject not matching any pattern",
+			subject: "events.1",
+			routed:  false,
+		},
+		{
+			desc:    "route subject without tokens for the tail wildcard",
+			subject: "channels",
+			routed:  false,
+		},
+	}
+
+	for _, tc := range cases {
+		target, ok := routes.Target(tc.subject)
+		assert.Equal(t, tc.routed, ok, fmt.Sprintf("%s: expected routed %t got %t", tc.desc, tc.routed, ok))
+		assert.Equal(t, tc.target, target, fmt.Sprintf("%s: expected target %s got %s", tc.desc, tc.target, target))
+	}
+
+	routes.Store(nil)
+	_, ok := routes.Target("channels.1")
+	assert.False(t, ok, "expected no subject routes")
+}
+
+func TestMessageSubject(t *testing.T) {
+	cases := []struct {
+		desc     string
+		channel  string
+		subtopic string
+		subject  string
+	}{
+		{
+			desc:    "subject of message without subtopic",
+			channel: "1",
+			subject: "channels.1",
+		},
+		{
+			desc:     "subject of message with subtopic",
+			channel:  "1",
+			subtopic: "sensors.temp",
+			subject:  "channels.1.sensors.temp",
+		},
+	}
+
+	for _, tc := range cases {
+		subject := writers.MessageSubject(tc.channel, tc.subtopic)
+		assert.Equal(t, tc.subject, subject, fmt.Sprintf("%s: expected subject %s got %s", tc.desc, tc.subject, subject))
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package writers
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/mainflux/mainflux/pkg/errors"
+	"github.com/mainflux/mainflux/pkg/transformers/senml"
+)
+
+// TimestampPolicy defines how the consumer handles messages with malformed
+// timestamps, or timestamps outside of the allowed clock skew.
+type TimestampPolicy string
+
+const (
+	// TimestampAccept writes bad timestamps as they are.
+	TimestampAccept TimestampPolicy = "accept"
+
+	// TimestampClamp replaces bad timestamps with the current time.
+	TimestampClamp TimestampPolicy = "clamp"
+
+	// TimestampReject dead-letters messages with bad timestamps.
+	TimestampReject TimestampPolicy = "reject"
+)
+
+var (
+	// ErrInvalidTimestampPolicy indicates an unknown timestamp policy.
+	ErrInvalidTimestampPolicy = errors.New("invalid timestamp policy")
+
+	// ErrInvalidTimestamp indicates that the message was rejected because
+	// of a malformed timestamp, or a timestamp outside of the allowed clock
+	// skew.
+	ErrInvalidTimestamp = errors.New("invalid message timestamp")
+)
+
+// ParseTimestampPolicy returns the policy with the given name. An empty
+// name stands for TimestampAccept.
+func ParseTimestampPolicy(name string) (TimestampPolicy, error) {
+	switch p := TimestampPolicy(name); p {
+	case "":
+		return TimestampAccept, nil
+	case TimestampAccept, TimestampClamp, TimestampReject:
+		return p, nil
+	default:
+		return "", errors.Wrap(ErrInvalidTimestampPolicy, fmt.Errorf("%s", name))
+	}
+}
+
+// badTimestamp reports whether the SenML time, in seconds, is malformed,
+// more than future ahead of now, or more than past behind now. A zero skew
+// disables the respective check. Zero time means the message carries no
+// time at all, so it is neither malformed nor in the past.
+func badTimestamp(t float64, now time.Time, future, past time.Duration) bool {
+	if math.IsNaN(t) || math.IsInf(t, 0) || t < 0 {
+		return true
+	}
+	if future > 0 && t > seconds(now.Add(future)) {
+		return true
+	}
+	return past > 0 && t != 0 && t < seconds(now.Add(-past))
+}
+
+func seconds(t time.Time) float64 {
+	return float64(t.UnixNano()) / float64(1e9)
+}
+
+// checkTimestamps applies the policy to the transformed messages and
+// reports whether any of them had a bad timestamp. Only SenML messages
+// carry device timestamps, so other messages are left intact.
+func checkTimestamps(msgs interface{}, policy TimestampPolicy, future, past time.Duration) (bool, error) {
+	records, ok := msgs.([]senml.Message)
+	if !ok {
+		return false, nil
+	}
+
+	now := time.Now()
+	bad := false
+	for i := range records {
+		if !badTimestamp(records[i].Time, now, future, past) {
+			continue
+		}
+		bad = true
+		switch policy {
+		case TimestampReject:
+			return true, errors.Wrap(ErrInvalidTimestamp, fmt.Errorf("record %s has time %v", records[i].Name, records[i].Time))
+		case TimestampClamp:
+			records[i].Time = seconds(now)
+		}
+	}
+	return bad, nil
+}
@@ -4,59 +4,679 @@
 package writers
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"io/ioutil"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/BurntSushi/toml"
+	"github.com/go-kit/kit/metrics"
 	"github.com/mainflux/mainflux/logger"
 	"github.com/mainflux/mainflux/pkg/errors"
 	"github.com/mainflux/mainflux/pkg/messaging"
 	pubsub "github.com/mainflux/mainflux/pkg/messaging/nats"
 	"github.com/mainflux/mainflux/pkg/transformers"
+	"github.com/mainflux/mainflux/pkg/transformers/json"
+	"github.com/mainflux/mainflux/pkg/transformers/senml"
 )
 
 var (
 	errOpenConfFile      = errors.New("unable to open configuration file")
 	errParseConfFile     = errors.New("unable to parse configuration file")
 	errMessageConversion = errors.New("error conversing transformed messages")
+
+	// ErrConsumerClosed indicates that the consumer has been shut down and
+	// no longer accepts messages.
+	ErrConsumerClosed = errors.New("consumer is shut down")
+
+	// ErrShutdownTimeout indicates that the in-flight writes did not
+	// complete before the shutdown deadline.
+	ErrShutdownTimeout = errors.New("shutdown timed out with in-flight writes")
+
+	// ErrRejected indicates that the repository rejected the message
+	// because of its content, so retrying it would never succeed. The
+	// consumer dead-letters such messages.
+	ErrRejected = errors.New("message rejected by the repository")
+
+	// ErrInvalidDeadLetterSubject indicates a dead-letter subject which is
+	// malformed or consumed by the consumer itself.
+	ErrInvalidDeadLetterSubject = errors.New("invalid dead-letter subject")
+
+	// ErrInvalidSubject indicates a malformed subject in the subjects
+	// configuration file.
+	ErrInvalidSubject = errors.New("invalid subject")
+
+	errStreamsChanged = errors.New("streams can't be changed without a restart")
 )
 
+// DeadLetterPublisher publishes the messages the consumer doesn't write.
+type DeadLetterPublisher interface {
+	// PublishSubject publishes the message to the subject as is.
+	PublishSubject(subject string, msg messaging.Message) error
+}
+
+// Consumer represents a running message consumer that persists the
+// messages received from the message broker.
+type Consumer interface {
+	// Shutdown stops consuming new messages and waits for in-flight writes
+	// to complete and the queue workers to stop until the provided context
+	// is done. The returned report contains the number of writes that were
+	// completed and abandoned during the shutdown.
+	Shutdown(ctx context.Context) (ShutdownReport, error)
+
+	// Reload replaces the transformers of the consumed subjects with the
+	// ones of the pipeline. Subjects the pipeline sets no transformer for
+	// use the transformer the consumer was started with. Messages being
+	// written keep the transformer they started with. The pipeline can't
+	// add or remove streams; if it does, the error wraps ErrInvalidPipeline
+	// and nothing is replaced.
+	Reload(p Pipeline) error
+}
+
+// Config defines the options used by the consumer.
+type Config struct {
+	// SubjectsConfigPath is the path of the configuration file containing
+	// the list of subjects to subscribe to.
+	SubjectsConfigPath string
+
+	// QueueSize is the number of received messages that can wait to be
+	// written. When the queue is full, the subscription handler blocks until
+	// there is room in the queue, which stops message consumption. If the
+	// size is zero, messages are written synchronously by the handler.
+	// Each subject has its own queue.
+	QueueSize int
+
+	// Streams is the list of subjects subscribed to independently, each
+	// with its own transformer. If empty, the subjects are loaded from
+	// the SubjectsConfigPath file.
+	Streams []Stream
+
+	// Counter, if set, counts the processed messages by subject and status.
+	Counter metrics.Counter
+
+	// DecodeCounter, if set, counts the messages which failed to decode by
+	// format (senml, json or unknown) and subject.
+	DecodeCounter metrics.Counter
+
+	// DecodeLogEvery is the number of decode failures of a format and
+	// subject per logged failure, the first one being logged. The log
+	// holds a redacted snippet of the payload. If zero,
+	// DefaultDecodeLogEvery is used. If negative, decode failures are not
+	// logged.
+	DecodeLogEvery int
+
+	// DedupWindow is the time during which redelivered messages are
+	// skipped instead of written again. The redeliveries of messages which
+	// failed to be written are not skipped. If zero, messages are not
+	// deduplicated.
+	DedupWindow time.Duration
+
+	// DedupSize is the maximum number of message IDs remembered within the
+	// window. If zero, DefaultDedupSize is used.
+	DedupSize int
+
+	// TimestampPolicy defines how messages with malformed timestamps, or
+	// timestamps more than MaxFutureSkew ahead of or MaxPastSkew behind the
+	// current time, are handled. If empty, TimestampAccept is used.
+	TimestampPolicy TimestampPolicy
+
+	// MaxFutureSkew is how far in the future timestamps can be. If zero,
+	// future timestamps are not checked.
+	MaxFutureSkew time.Duration
+
+	// MaxPastSkew is how far in the past timestamps can be, e.g. to catch
+	// devices whose clocks were reset. If zero, past timestamps are not
+	// checked.
+	MaxPastSkew time.Duration
+
+	// SubjectPolicy defines how messages whose channel and subtopic don't
+	// make a well-formed subject are handled. If empty, SubjectDeadLetter
+	// is used.
+	SubjectPolicy SubjectPolicy
+
+	// DefaultChannel is the channel SubjectDefault writes the messages
+	// with malformed channels to. If empty, DefaultSubjectChannel is used.
+	DefaultChannel string
+
+	// DeadLetter, if set, publishes the messages which are dead-lettered
+	// or which the repository failed to save to DeadLetterSubject, so that
+	// they aren't dropped.
+	DeadLetter DeadLetterPublisher
+
+	// DeadLetterSubject is the subject of the dead letters. It can't hold
+	// wildcards, nor be matched by the consumed subjects, which would
+	// consume the dead letters again.
+	DeadLetterSubject string
+}
+
+// Stream represents a subject and the transformer used for its messages.
+type Stream struct {
+	Subject string
+
+	// Transformer transforms messages received on the subject. If nil,
+	// the consumer transformer is used.
+	Transformer transformers.Transformer
+}
+
+// ShutdownReport summarizes the consumer run and the state of in-flight
+// writes on shutdown.
+type ShutdownReport struct {
+	// Flushed is the number of in-flight writes completed during shutdown.
+	Flushed uint64
+
+	// Abandoned is the number of in-flight writes that didn't complete
+	// before the shutdown deadline.
+	Abandoned uint64
+
+	// Consumed is the total number of messages accepted by the consumer.
+	Consumed uint64
+
+	// Written is the total number of messages successfully saved.
+	Written uint64
+
+	// DeadLettered is the total number of messages not written because
+	// they could not be transformed, had malformed subjects or their
+	// timestamps rejected, or were rejected by the repository, so retrying
+	// them would never succeed.
+	DeadLettered uint64
+
+	// Failed is the total number of messages the repository failed to save.
+	Failed uint64
+
+	// Duplicates is the total number of redelivered messages skipped.
+	Duplicates uint64
+
+	// Empty is the total number of messages skipped because their payload
+	// is blank or holds no records.
+	Empty uint64
+
+	// TimestampsAccepted, TimestampsClamped and TimestampsRejected are the
+	// total numbers of messages with bad timestamps by policy outcome.
+	TimestampsAccepted uint64
+	TimestampsClamped  uint64
+	TimestampsRejected uint64
+
+	// Republished is the total number of dead-lettered and failed messages
+	// published to the dead-letter subject, and Dropped the total number
+	// of those which failed to be published to it.
+	Republished uint64
+	Dropped     uint64
+
+	// MalformedSubjects is the total number of messages with malformed
+	// subjects, either dead-lettered or written by the subject policy.
+	MalformedSubjects uint64
+
+	// BufferDepth is the number of messages left in the queue on shutdown.
+	BufferDepth int
+}
+
+var _ Consumer = (*consumer)(nil)
+
 type consumer struct {
+	sub         messaging.Subscriber
 	repo        MessageRepository
 	transformer transformers.Transformer
 	logger      logger.Logger
+	counter     metrics.Counter
+	dedup       *seenSet
+	policy      TimestampPolicy
+	skew        time.Duration
+	pastSkew    time.Duration
+	dlq         DeadLetterPublisher
+	dlqSubject  string
+	streams     []*stream
+	// declared reports whether the streams were declared in the
+	// configuration rather than loaded from the subjects file.
+	declared bool
+
+	// decodeCounter and decodeSampler count and sample the messages which
+	// failed to decode.
+	decodeCounter metrics.Counter
+	decodeSampler *decodeSampler
+
+	// subjectPolicy and defaultChannel handle the messages with malformed
+	// subjects.
+	subjectPolicy  SubjectPolicy
+	defaultChannel string
+
+	mu       sync.Mutex
+	closed   bool
+	wg       sync.WaitGroup
+	inFlight int64
+
+	// handlers tracks the running subscription handlers and workers the
+	// running queue workers, so that the queues are closed once nothing
+	// sends to them and the workers are done on shutdown.
+	handlers sync.WaitGroup
+	workers  sync.WaitGroup
+
+	consumed     uint64
+	written      uint64
+	deadLettered uint64
+	failed       uint64
+	duplicates   uint64
+	empty        uint64
+	accepted     uint64
+	clamped      uint64
+	rejected     uint64
+	republished  uint64
+	dropped      uint64
+	malformed    uint64
 }
 
 // Start method starts consuming messages received from NATS.
 // This method transforms messages to SenML format before
 // using MessageRepository to store them.
 func Start(sub messaging.Subscriber, repo MessageRepository, transformer transformers.Transformer, subjectsCfgPath string, logger logger.Logger) error {
-	c := consumer{
+	_, err := StartConsumer(sub, repo, transformer, Config{SubjectsConfigPath: subjectsCfgPath}, logger)
+	return err
+}
+
+// StartConsumer starts consuming messages received from NATS the same way
+// Start does, and returns the Consumer which can be used to gracefully
+// shut it down. If the subjects configuration file lists an invalid
+// subject, the error wraps ErrInvalidSubject.
+func StartConsumer(sub messaging.Subscriber, repo MessageRepository, transformer transformers.Transformer, cfg Config, logger logger.Logger) (Consumer, error) {
+	streams := cfg.Streams
+	if len(streams) == 0 {
+		subjects, err := loadSubjectsConfig(cfg.SubjectsConfigPath)
+		switch {
+		case errors.Contains(err, ErrInvalidSubject):
+			return nil, err
+		case err != nil:
+			logger.Warn(fmt.Sprintf("Failed to load subjects: %s", err))
+		}
+		for _, subject := range subjects {
+			streams = append(streams, Stream{Subject: subject})
+		}
+	}
+
+	c := &consumer{
+		sub:         sub,
 		repo:        repo,
 		transformer: transformer,
 		logger:      logger,
+		counter:     cfg.Counter,
+		skew:        cfg.MaxFutureSkew,
+		pastSkew:    cfg.MaxPastSkew,
+		dlq:         cfg.DeadLetter,
+		dlqSubject:  cfg.DeadLetterSubject,
+		declared:    len(cfg.Streams) > 0,
+
+		decodeCounter: cfg.DecodeCounter,
+		decodeSampler: newDecodeSampler(cfg.DecodeLogEvery),
+
+		defaultChannel: cfg.DefaultChannel,
+	}
+	if c.defaultChannel == "" {
+		c.defaultChannel = DefaultSubjectChannel
+	}
+	subjectPolicy, err := ParseSubjectPolicy(string(cfg.SubjectPolicy))
+	if err != nil {
+		return nil, err
+	}
+	c.subjectPolicy = subjectPolicy
+	policy, err := ParseTimestampPolicy(string(cfg.TimestampPolicy))
+	if err != nil {
+		return nil, err
+	}
+	c.policy = policy
+	if cfg.DedupWindow > 0 {
+		c.dedup = newSeenSet(cfg.DedupWindow, cfg.DedupSize)
+	}
+	if c.dlq != nil {
+		if err := checkDeadLetterSubject(c.dlqSubject, streams); err != nil {
+			return nil, errors.Wrap(ErrInvalidDeadLetterSubject, err)
+		}
+	}
+
+	for _, st := range streams {
+		s := &stream{
+			consumer: c,
+			subject:  st.Subject,
+		}
+		s.setTransformer(st.Transformer)
+		if cfg.QueueSize > 0 {
+			s.queue = make(chan messaging.Message, cfg.QueueSize)
+			c.workers.Add(1)
+			go s.work()
+		}
+
+		if err := sub.Subscribe(s.subject, s.handler); err != nil {
+			return nil, err
+		}
+		c.streams = append(c.streams, s)
 	}
+	return c, nil
+}
 
-	subjects, err := loadSubjectsConfig(subjectsCfgPath)
+// checkDeadLetterSubject checks that the dead-letter subject is a literal
+// subject which none of the streams consumes.
+func checkDeadLetterSubject(subject string, streams []Stream) error {
+	if subject == "" {
+		return fmt.Errorf("dead-letter subject is empty")
+	}
+	tokens, err := subjectTokens(subject)
 	if err != nil {
-		logger.Warn(fmt.Sprintf("Failed to load subjects: %s", err))
+		return err
+	}
+	for _, t := range tokens {
+		if t == anyToken || t == anyTail {
+			return fmt.Errorf("subject %s has wildcards", subject)
+		}
+	}
+	for _, st := range streams {
+		tokens, err := subjectTokens(st.Subject)
+		if err != nil {
+			continue
+		}
+		if (SubjectRoute{tokens: tokens}).Match(subject) {
+			return fmt.Errorf("subject %s is consumed by %s", subject, st.Subject)
+		}
+	}
+	return nil
+}
+
+func (c *consumer) Shutdown(ctx context.Context) (ShutdownReport, error) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return ShutdownReport{}, ErrConsumerClosed
+	}
+	c.closed = true
+	c.mu.Unlock()
+
+	for _, s := range c.streams {
+		if err := c.sub.Unsubscribe(s.subject); err != nil {
+			c.logger.Warn(fmt.Sprintf("Failed to unsubscribe from %s: %s", s.subject, err))
+		}
+	}
+
+	pending := uint64(atomic.LoadInt64(&c.inFlight))
+
+	done := make(chan struct{})
+	go func() {
+		c.handlers.Wait()
+		for _, s := range c.streams {
+			if s.queue != nil {
+				close(s.queue)
+			}
+		}
+		c.workers.Wait()
+		c.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		rep := c.report()
+		rep.Flushed = pending
+		return rep, nil
+	case <-ctx.Done():
+		abandoned := uint64(atomic.LoadInt64(&c.inFlight))
+		rep := c.report()
+		rep.Flushed = pending - abandoned
+		rep.Abandoned = abandoned
+		return rep, ErrShutdownTimeout
+	}
+}
+
+func (c *consumer) Reload(p Pipeline) error {
+	ts := make(map[string]transformers.Transformer)
+	for _, st := range p.Streams {
+		ts[st.Subject] = st.Transformer
+	}
+	if err := c.checkStreams(ts); err != nil {
+		return errors.Wrap(ErrInvalidPipeline, err)
+	}
+
+	for _, s := range c.streams {
+		t := ts[s.subject]
+		if t == nil {
+			t = p.Transformer
+		}
+		s.setTransformer(t)
+	}
+	return nil
+}
+
+// checkStreams checks that the reloaded pipeline declares the consumed
+// streams, since subscriptions are not changed on reload.
+func (c *consumer) checkStreams(ts map[string]transformers.Transformer) error {
+	if !c.declared {
+		if len(ts) > 0 {
+			return errStreamsChanged
+		}
+		return nil
+	}
+	if len(ts) != len(c.streams) {
+		return errStreamsChanged
+	}
+	for _, s := range c.streams {
+		if _, ok := ts[s.subject]; !ok {
+			return errors.Wrap(errStreamsChanged, fmt.Errorf("subject %s removed", s.subject))
+		}
+	}
+	return nil
+}
+
+func (c *consumer) report() ShutdownReport {
+	rep := ShutdownReport{
+		Consumed:     atomic.LoadUint64(&c.consumed),
+		Written:      atomic.LoadUint64(&c.written),
+		DeadLettered: atomic.LoadUint64(&c.deadLettered),
+		Failed:       atomic.LoadUint64(&c.failed),
+		Duplicates:   atomic.LoadUint64(&c.duplicates),
+		Empty:        atomic.LoadUint64(&c.empty),
+
+		TimestampsAccepted: atomic.LoadUint64(&c.accepted),
+		TimestampsClamped:  atomic.LoadUint64(&c.clamped),
+		TimestampsRejected: atomic.LoadUint64(&c.rejected),
+
+		Republished: atomic.LoadUint64(&c.republished),
+		Dropped:     atomic.LoadUint64(&c.dropped),
+
+		MalformedSubjects: atomic.LoadUint64(&c.malformed),
+	}
+	for _, s := range c.streams {
+		rep.BufferDepth += len(s.queue)
+	}
+	return rep
+}
+
+func (c *consumer) duplicate(msg messaging.Message) bool {
+	if c.dedup == nil {
+		return false
+	}
+	id, ok := messageID(msg)
+	if !ok {
+		return false
+	}
+	return c.dedup.seen(id)
+}
+
+// forget removes the message from the deduplicated ones, so that its
+// redelivery is written.
+func (c *consumer) forget(msg messaging.Message) {
+	if c.dedup == nil {
+		return
+	}
+	if id, ok := messageID(msg); ok {
+		c.dedup.forget(id)
+	}
+}
+
+func (c *consumer) count(subject, status string, total *uint64) {
+	atomic.AddUint64(total, 1)
+	if c.counter != nil {
+		c.counter.With("subject", subject, "status", status).Add(1)
+	}
+}
+
+// stream processes the messages of a single subscription, so that a slow
+// subject doesn't block the others.
+type stream struct {
+	*consumer
+	subject     string
+	transformer atomic.Value
+	queue       chan messaging.Message
+}
+
+// transformerValue wraps the stream transformer, since an atomic.Value
+// can't hold values of different types.
+type transformerValue struct {
+	transformers.Transformer
+}
+
+// setTransformer replaces the stream transformer. If t is nil, the
+// consumer transformer is used.
+func (s *stream) setTransformer(t transformers.Transformer) {
+	if t == nil {
+		t = s.consumer.transformer
+	}
+	s.transformer.Store(transformerValue{t})
+}
+
+func (s *stream) handler(msg messaging.Message) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrConsumerClosed
+	}
+	if s.duplicate(msg) {
+		s.mu.Unlock()
+		s.count(s.subject, "consumed", &s.consumed)
+		s.count(s.subject, "duplicate", &s.duplicates)
+		return nil
+	}
+	s.wg.Add(1)
+	s.handlers.Add(1)
+	atomic.AddInt64(&s.inFlight, 1)
+	s.mu.Unlock()
+	defer s.handlers.Done()
+	s.count(s.subject, "consumed", &s.consumed)
+
+	if s.queue != nil {
+		// Blocks while the queue is full, which pauses consumption.
+		s.queue <- msg
+		return nil
 	}
 
-	for _, subject := range subjects {
-		if err := sub.Subscribe(subject, c.handler); err != nil {
-			return err
+	return s.write(msg)
+}
+
+func (s *stream) work() {
+	defer s.workers.Done()
+	for msg := range s.queue {
+		if err := s.write(msg); err != nil {
+			s.logger.Warn(fmt.Sprintf("Failed to write message: %s", err))
 		}
 	}
+}
+
+func (s *stream) write(msg messaging.Message) error {
+	defer func() {
+		atomic.AddInt64(&s.inFlight, -1)
+		s.wg.Done()
+	}()
+
+	// The message is marked as seen when it is received, so that the
+	// redeliveries received while it is being written are skipped. If the
+	// write fails, the mark is removed so that a redelivery is retried.
+	if err := s.save(msg); err != nil {
+		s.forget(msg)
+		return err
+	}
 	return nil
 }
 
-func (c *consumer) handler(msg messaging.Message) error {
-	t, err := c.transformer.Transform(msg)
+func (s *stream) save(msg messaging.Message) error {
+	// Empty messages are skipped rather than written as empty batches,
+	// which some clients reject.
+	if len(bytes.TrimSpace(msg.Payload)) == 0 {
+		s.count(s.subject, "empty", &s.empty)
+		return nil
+	}
+
+	msg, err := s.handleSubject(msg)
+	if err != nil {
+		return err
+	}
+
+	tr := s.transformer.Load().(transformerValue)
+	t, err := tr.Transform(msg)
+	if err != nil {
+		s.decodeFailed(msg.Payload, err)
+		s.count(s.subject, "dead_lettered", &s.deadLettered)
+		s.deadLetter(msg)
+		return err
+	}
+	if empty(t) {
+		s.count(s.subject, "empty", &s.empty)
+		return nil
+	}
+
+	bad, err := checkTimestamps(t, s.policy, s.skew, s.pastSkew)
+	if bad {
+		s.countTimestamp()
+	}
 	if err != nil {
+		s.count(s.subject, "dead_lettered", &s.deadLettered)
+		s.deadLetter(msg)
 		return err
 	}
 
-	return c.repo.Save(t)
+	if err := s.repo.Save(t); err != nil {
+		if errors.Contains(err, ErrRejected) {
+			s.count(s.subject, "dead_lettered", &s.deadLettered)
+		} else {
+			s.count(s.subject, "failed", &s.failed)
+		}
+		s.deadLetter(msg)
+		return err
+	}
+	s.count(s.subject, "written", &s.written)
+	return nil
+}
+
+// deadLetter publishes the message which isn't written to the dead-letter
+// subject, if any.
+func (s *stream) deadLetter(msg messaging.Message) {
+	if s.dlq == nil {
+		return
+	}
+	if err := s.dlq.PublishSubject(s.dlqSubject, msg); err != nil {
+		s.logger.Warn(fmt.Sprintf("Failed to publish message to dead-letter subject %s: %s", s.dlqSubject, err))
+		s.count(s.subject, "dropped", &s.dropped)
+		return
+	}
+	s.count(s.subject, "republished", &s.republished)
+}
+
+// empty reports whether the transformed message holds no records.
+func empty(msgs interface{}) bool {
+	switch m := msgs.(type) {
+	case []senml.Message:
+		return len(m) == 0
+	case json.Messages:
+		return len(m.Data) == 0
+	default:
+		return false
+	}
+}
+
+func (s *stream) countTimestamp() {
+	switch s.policy {
+	case TimestampReject:
+		s.count(s.subject, "timestamp_rejected", &s.rejected)
+	case TimestampClamp:
+		s.count(s.subject, "timestamp_clamped", &s.clamped)
+	default:
+		s.count(s.subject, "timestamp_accepted", &s.accepted)
+	}
 }
 
 type filterConfig struct {
@@ -78,5 +698,20 @@ func loadSubjectsConfig(subjectsConfigPath string) ([]string, error) {
 		return []string{pubsub.SubjectAllChannels}, errors.Wrap(errParseConfFile, err)
 	}
 
-	return subjectsCfg.Subjects.Filter, nil
+	return filterSubjects(subjectsCfg.Subjects)
+}
+
+// filterSubjects validates the subjects of the filter. If it lists none,
+// all the channels are subscribed to. If any subject is invalid, the error
+// wraps ErrInvalidSubject.
+func filterSubjects(cfg filterConfig) ([]string, error) {
+	if len(cfg.Filter) == 0 {
+		return []string{pubsub.SubjectAllChannels}, nil
+	}
+	for _, s := range cfg.Filter {
+		if _, err := subjectTokens(s); err != nil {
+			return nil, errors.Wrap(ErrInvalidSubject, err)
+		}
+	}
+	return cfg.Filter, nil
 }
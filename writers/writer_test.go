@@ -0,0 +1,1049 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package writers_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/metrics"
+	log "github.com/mainflux/mainflux/logger"
+	"github.com/mainflux/mainflux/pkg/errors"
+	"github.com/mainflux/mainflux/pkg/messaging"
+	"github.com/mainflux/mainflux/pkg/messaging/nats"
+	"github.com/mainflux/mainflux/pkg/transformers"
+	"github.com/mainflux/mainflux/pkg/transformers/json"
+	"github.com/mainflux/mainflux/pkg/transformers/senml"
+	"github.com/mainflux/mainflux/writers"
+	"github.com/mainflux/mainflux/writers/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	subjectsCfgPath = "non-existing-config.toml"
+	payload         = `[{"bn":"base-name","n":"temp","v":21.5}]`
+)
+
+var (
+	testLog, _ = log.New(os.Stdout, log.Info.String())
+	msg        = messaging.Message{
+		Channel:   "channel",
+		Publisher: "publisher",
+		Protocol:  "http",
+		Payload:   []byte(payload),
+	}
+)
+
+// gateRepository blocks every Save until released.
+type gateRepository struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func newGateRepository() gateRepository {
+	return gateRepository{
+		started: make(chan struct{}, 10),
+		release: make(chan struct{}),
+	}
+}
+
+func (repo gateRepository) Save(msgs interface{}) error {
+	repo.started <- struct{}{}
+	<-repo.release
+	return nil
+}
+
+func TestShutdown(t *testing.T) {
+	cases := []struct {
+		desc      string
+		inFlight  int
+		release   bool
+		timeout   time.Duration
+		flushed   uint64
+		abandoned uint64
+		err       error
+	}{
+		{
+			desc:     "shutdown without in-flight writes",
+			inFlight: 0,
+			timeout:  time.Second,
+			err:      nil,
+		},
+		{
+			desc:     "shutdown with in-flight writes completed within timeout",
+			inFlight: 3,
+			release:  true,
+			timeout:  time.Second,
+			flushed:  3,
+			err:      nil,
+		},
+		{
+			desc:      "shutdown with in-flight writes abandoned past timeout",
+			inFlight:  2,
+			release:   false,
+			timeout:   50 * time.Millisecond,
+			abandoned: 2,
+			err:       writers.ErrShutdownTimeout,
+		},
+	}
+
+	for _, tc := range cases {
+		ps := mocks.NewPubSub()
+		repo := newGateRepository()
+		c, err := writers.StartConsumer(ps, repo, senml.New(senml.JSON), writers.Config{SubjectsConfigPath: subjectsCfgPath}, testLog)
+		require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", tc.desc, err))
+
+		var wg sync.WaitGroup
+		for i := 0; i < tc.inFlight; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				ps.Publish(nats.SubjectAllChannels, msg)
+			}()
+			<-repo.started
+		}
+
+		if tc.release {
+			go func() {
+				time.Sleep(10 * time.Millisecond)
+				close(repo.release)
+			}()
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), tc.timeout)
+		rep, err := c.Shutdown(ctx)
+		cancel()
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s", tc.desc, tc.err, err))
+		assert.Equal(t, tc.flushed, rep.Flushed, fmt.Sprintf("%s: expected %d flushed got %d", tc.desc, tc.flushed, rep.Flushed))
+		assert.Equal(t, tc.abandoned, rep.Abandoned, fmt.Sprintf("%s: expected %d abandoned got %d", tc.desc, tc.abandoned, rep.Abandoned))
+
+		if !tc.release {
+			close(repo.release)
+		}
+		wg.Wait()
+	}
+}
+
+func TestShutdownStopsIntake(t *testing.T) {
+	ps := mocks.NewPubSub()
+	repo := mocks.NewMessageRepository()
+	c, err := writers.StartConsumer(ps, repo, senml.New(senml.JSON), writers.Config{SubjectsConfigPath: subjectsCfgPath}, testLog)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+
+	err = ps.Publish(nats.SubjectAllChannels, msg)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+
+	_, err = c.Shutdown(context.Background())
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+
+	err = ps.Publish(nats.SubjectAllChannels, msg)
+	assert.NotNil(t, err, "publishing after shutdown expected to fail")
+	assert.Equal(t, 1, len(repo.Messages()), fmt.Sprintf("expected 1 saved message got %d", len(repo.Messages())))
+}
+
+func TestBackpressure(t *testing.T) {
+	queueSize := 2
+	ps := mocks.NewPubSub()
+	repo := newGateRepository()
+	cfg := writers.Config{
+		SubjectsConfigPath: subjectsCfgPath,
+		QueueSize:          queueSize,
+	}
+	_, err := writers.StartConsumer(ps, repo, senml.New(senml.JSON), cfg, testLog)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+
+	// The first message is taken by the writer and blocks in Save.
+	err = ps.Publish(nats.SubjectAllChannels, msg)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	<-repo.started
+
+	// The following messages fill the queue without blocking the handler.
+	for i := 0; i < queueSize; i++ {
+		err = ps.Publish(nats.SubjectAllChannels, msg)
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	}
+
+	// The queue is full, so the handler blocks and consumption is paused.
+	published := make(chan struct{})
+	go func() {
+		ps.Publish(nats.SubjectAllChannels, msg)
+		close(published)
+	}()
+
+	select {
+	case <-published:
+		assert.Fail(t, "consumption expected to pause when the queue is full")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Draining the queue resumes consumption.
+	repo.release <- struct{}{}
+	select {
+	case <-published:
+	case <-time.After(time.Second):
+		assert.Fail(t, "consumption expected to resume when the queue drains")
+	}
+	close(repo.release)
+}
+
+// failingRepository fails to save every message.
+type failingRepository struct{}
+
+func (repo failingRepository) Save(msgs interface{}) error {
+	return errors.New("failed to save")
+}
+
+// rejectingRepository rejects every message.
+type rejectingRepository struct{}
+
+func (repo rejectingRepository) Save(msgs interface{}) error {
+	return errors.Wrap(writers.ErrRejected, errors.New("tag value too long"))
+}
+
+func TestShutdownReport(t *testing.T) {
+	invalid := msg
+	invalid.Payload = []byte("invalid")
+
+	cases := []struct {
+		desc   string
+		repo   writers.MessageRepository
+		valid  int
+		broken int
+		report writers.ShutdownReport
+	}{
+		{
+			desc:   "report pipeline with valid and invalid messages",
+			repo:   mocks.NewMessageRepository(),
+			valid:  3,
+			broken: 2,
+			report: writers.ShutdownReport{
+				Consumed:     5,
+				Written:      3,
+				DeadLettered: 2,
+			},
+		},
+		{
+			desc:   "report pipeline with failing repository",
+			repo:   failingRepository{},
+			valid:  4,
+			broken: 1,
+			report: writers.ShutdownReport{
+				Consumed:     5,
+				DeadLettered: 1,
+				Failed:       4,
+			},
+		},
+		{
+			desc:   "report pipeline with rejecting repository",
+			repo:   rejectingRepository{},
+			valid:  3,
+			broken: 1,
+			report: writers.ShutdownReport{
+				Consumed:     4,
+				DeadLettered: 4,
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		ps := mocks.NewPubSub()
+		c, err := writers.StartConsumer(ps, tc.repo, senml.New(senml.JSON), writers.Config{SubjectsConfigPath: subjectsCfgPath}, testLog)
+		require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", tc.desc, err))
+
+		for i := 0; i < tc.valid; i++ {
+			ps.Publish(nats.SubjectAllChannels, msg)
+		}
+		for i := 0; i < tc.broken; i++ {
+			ps.Publish(nats.SubjectAllChannels, invalid)
+		}
+
+		rep, err := c.Shutdown(context.Background())
+		require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", tc.desc, err))
+		assert.Equal(t, tc.report, rep, fmt.Sprintf("%s: expected %v got %v", tc.desc, tc.report, rep))
+	}
+}
+
+// counterMock sums the counted values by label values.
+type counterMock struct {
+	mu     *sync.Mutex
+	values map[string]float64
+	labels []string
+}
+
+func newCounterMock() counterMock {
+	return counterMock{
+		mu:     &sync.Mutex{},
+		values: make(map[string]float64),
+	}
+}
+
+func (c counterMock) With(labelValues ...string) metrics.Counter {
+	return counterMock{
+		mu:     c.mu,
+		values: c.values,
+		labels: append(append([]string{}, c.labels...), labelValues...),
+	}
+}
+
+func (c counterMock) Add(delta float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[strings.Join(c.labels, ",")] += delta
+}
+
+func (c counterMock) value(labelValues ...string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[strings.Join(labelValues, ",")]
+}
+
+func TestStreams(t *testing.T) {
+	senmlSubject := "channels.senml"
+	jsonSubject := "channels.json"
+	jsonMsg := msg
+	jsonMsg.Subtopic = "json"
+	jsonMsg.Payload = []byte(`{"temp":21.5}`)
+
+	ps := mocks.NewPubSub()
+	repo := mocks.NewMessageRepository()
+	counter := newCounterMock()
+	cfg := writers.Config{
+		Streams: []writers.Stream{
+			{Subject: senmlSubject},
+			{Subject: jsonSubject, Transformer: json.New()},
+		},
+		QueueSize: 1,
+		Counter:   counter,
+	}
+	c, err := writers.StartConsumer(ps, repo, senml.New(senml.JSON), cfg, testLog)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+
+	senmlNum, jsonNum := 3, 2
+	for i := 0; i < senmlNum; i++ {
+		err := ps.Publish(senmlSubject, msg)
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	}
+	for i := 0; i < jsonNum; i++ {
+		err := ps.Publish(jsonSubject, jsonMsg)
+		require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	}
+	// Messages published to the subject of the other stream are broken.
+	err = ps.Publish(senmlSubject, jsonMsg)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+
+	_, err = c.Shutdown(context.Background())
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+
+	var senmls, jsons int
+	for _, m := range repo.Messages() {
+		switch m.(type) {
+		case []senml.Message:
+			senmls++
+		case json.Messages:
+			jsons++
+		}
+	}
+	assert.Equal(t, senmlNum, senmls, fmt.Sprintf("expected %d SenML messages got %d", senmlNum, senmls))
+	assert.Equal(t, jsonNum, jsons, fmt.Sprintf("expected %d JSON messages got %d", jsonNum, jsons))
+
+	cases := []struct {
+		desc    string
+		subject string
+		status  string
+		value   float64
+	}{
+		{
+			desc:    "count consumed SenML messages",
+			subject: senmlSubject,
+			status:  "consumed",
+			value:   float64(senmlNum + 1),
+		},
+		{
+			desc:    "count written SenML messages",
+			subject: senmlSubject,
+			status:  "written",
+			value:   float64(senmlNum),
+		},
+		{
+			desc:    "count dead-lettered SenML messages",
+			subject: senmlSubject,
+			status:  "dead_lettered",
+			value:   1,
+		},
+		{
+			desc:    "count consumed JSON messages",
+			subject: jsonSubject,
+			status:  "consumed",
+			value:   float64(jsonNum),
+		},
+		{
+			desc:    "count written JSON messages",
+			subject: jsonSubject,
+			status:  "written",
+			value:   float64(jsonNum),
+		},
+		{
+			desc:    "count dead-lettered JSON messages",
+			subject: jsonSubject,
+			status:  "dead_lettered",
+			value:   0,
+		},
+	}
+
+	for _, tc := range cases {
+		v := counter.value("subject", tc.subject, "status", tc.status)
+		assert.Equal(t, tc.value, v, fmt.Sprintf("%s: expected %v got %v", tc.desc, tc.value, v))
+	}
+}
+
+func TestStartConsumerSubjects(t *testing.T) {
+	cases := []struct {
+		desc string
+		cfg  string
+		err  error
+	}{
+		{
+			desc: "start consumer with valid subjects",
+			cfg:  "[subjects]\nfilter = [\"channels.tenant-a.>\"]\n",
+			err:  nil,
+		},
+		{
+			desc: "start consumer with subject with empty token",
+			cfg:  "[subjects]\nfilter = [\"channels..>\"]\n",
+			err:  writers.ErrInvalidSubject,
+		},
+		{
+			desc: "start consumer with subject with misplaced wildcard",
+			cfg:  "[subjects]\nfilter = [\"channels.>.temp\"]\n",
+			err:  writers.ErrInvalidSubject,
+		},
+	}
+
+	for _, tc := range cases {
+		f, err := ioutil.TempFile("", "subjects-*.toml")
+		require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", tc.desc, err))
+		_, err = f.WriteString(tc.cfg)
+		require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", tc.desc, err))
+		f.Close()
+
+		cfg := writers.Config{SubjectsConfigPath: f.Name()}
+		c, err := writers.StartConsumer(mocks.NewPubSub(), mocks.NewMessageRepository(), senml.New(senml.JSON), cfg, testLog)
+		os.Remove(f.Name())
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s", tc.desc, tc.err, err))
+		if tc.err != nil {
+			continue
+		}
+		_, err = c.Shutdown(context.Background())
+		assert.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", tc.desc, err))
+	}
+}
+
+func TestDedup(t *testing.T) {
+	first := msg
+	first.Created = time.Now().UnixNano()
+	second := first
+	second.Created++
+	anonymous := msg
+
+	cases := []struct {
+		desc     string
+		window   time.Duration
+		size     int
+		pause    time.Duration
+		msgs     []messaging.Message
+		written  int
+		dupCount uint64
+	}{
+		{
+			desc:     "redeliver message within window",
+			window:   time.Minute,
+			msgs:     []messaging.Message{first, first, second, first},
+			written:  2,
+			dupCount: 2,
+		},
+		{
+			desc:     "redeliver message past window",
+			window:   10 * time.Millisecond,
+			pause:    20 * time.Millisecond,
+			msgs:     []messaging.Message{first, first},
+			written:  2,
+			dupCount: 0,
+		},
+		{
+			desc:     "redeliver message evicted from full window",
+			window:   time.Minute,
+			size:     1,
+			msgs:     []messaging.Message{first, second, first},
+			written:  3,
+			dupCount: 0,
+		},
+		{
+			desc:     "redeliver message without deduplication",
+			window:   0,
+			msgs:     []messaging.Message{first, first},
+			written:  2,
+			dupCount: 0,
+		},
+		{
+			desc:     "redeliver message without creation time",
+			window:   time.Minute,
+			msgs:     []messaging.Message{anonymous, anonymous},
+			written:  2,
+			dupCount: 0,
+		},
+	}
+
+	for _, tc := range cases {
+		ps := mocks.NewPubSub()
+		repo := mocks.NewMessageRepository()
+		counter := newCounterMock()
+		cfg := writers.Config{
+			SubjectsConfigPath: subjectsCfgPath,
+			Counter:            counter,
+			DedupWindow:        tc.window,
+			DedupSize:          tc.size,
+		}
+		c, err := writers.StartConsumer(ps, repo, senml.New(senml.JSON), cfg, testLog)
+		require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", tc.desc, err))
+
+		for _, m := range tc.msgs {
+			err := ps.Publish(nats.SubjectAllChannels, m)
+			require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", tc.desc, err))
+			time.Sleep(tc.pause)
+		}
+
+		rep, err := c.Shutdown(context.Background())
+		require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", tc.desc, err))
+		assert.Equal(t, tc.written, len(repo.Messages()), fmt.Sprintf("%s: expected %d saved messages got %d", tc.desc, tc.written, len(repo.Messages())))
+		assert.Equal(t, tc.dupCount, rep.Duplicates, fmt.Sprintf("%s: expected %d duplicates got %d", tc.desc, tc.dupCount, rep.Duplicates))
+		dups := counter.value("subject", nats.SubjectAllChannels, "status", "duplicate")
+		assert.Equal(t, float64(tc.dupCount), dups, fmt.Sprintf("%s: expected %d counted duplicates got %v", tc.desc, tc.dupCount, dups))
+	}
+}
+
+// flakyRepository fails to save the first messages and saves the
+// following ones to the wrapped repository.
+type flakyRepository struct {
+	mocks.MessageRepository
+	failures int
+}
+
+func (repo *flakyRepository) Save(msgs interface{}) error {
+	if repo.failures > 0 {
+		repo.failures--
+		return errors.New("failed to save")
+	}
+	return repo.MessageRepository.Save(msgs)
+}
+
+func TestDedupFailedWrite(t *testing.T) {
+	m := msg
+	m.Created = time.Now().UnixNano()
+
+	ps := mocks.NewPubSub()
+	repo := &flakyRepository{MessageRepository: mocks.NewMessageRepository(), failures: 1}
+	cfg := writers.Config{
+		SubjectsConfigPath: subjectsCfgPath,
+		DedupWindow:        time.Minute,
+	}
+	c, err := writers.StartConsumer(ps, repo, senml.New(senml.JSON), cfg, testLog)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+
+	// The redelivery of the message which failed to be written is written,
+	// and the following ones are skipped.
+	for i := 0; i < 3; i++ {
+		ps.Publish(nats.SubjectAllChannels, m)
+	}
+
+	rep, err := c.Shutdown(context.Background())
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	assert.Equal(t, 1, len(repo.Messages()), fmt.Sprintf("expected 1 saved message got %d", len(repo.Messages())))
+	assert.Equal(t, uint64(1), rep.Failed, fmt.Sprintf("expected 1 failed write got %d", rep.Failed))
+	assert.Equal(t, uint64(1), rep.Duplicates, fmt.Sprintf("expected 1 duplicate got %d", rep.Duplicates))
+}
+
+func TestEmptyMessages(t *testing.T) {
+	cases := []struct {
+		desc        string
+		transformer transformers.Transformer
+		payload     string
+		written     int
+		empty       uint64
+	}{
+		{
+			desc:        "skip SenML message with empty payload",
+			transformer: senml.New(senml.JSON),
+			payload:     "",
+			written:     0,
+			empty:       1,
+		},
+		{
+			desc:        "skip SenML message with whitespace-only payload",
+			transformer: senml.New(senml.JSON),
+			payload:     " \n\t ",
+			written:     0,
+			empty:       1,
+		},
+		{
+			desc:        "skip SenML message without records",
+			transformer: senml.New(senml.JSON),
+			payload:     "[]",
+			written:     0,
+			empty:       1,
+		},
+		{
+			desc:        "skip JSON message with whitespace-only payload",
+			transformer: json.New(),
+			payload:     "\r\n",
+			written:     0,
+			empty:       1,
+		},
+		{
+			desc:        "skip JSON message without objects",
+			transformer: json.New(),
+			payload:     "[]",
+			written:     0,
+			empty:       1,
+		},
+		{
+			desc:        "write SenML message with records",
+			transformer: senml.New(senml.JSON),
+			payload:     payload,
+			written:     1,
+			empty:       0,
+		},
+	}
+
+	for _, tc := range cases {
+		ps := mocks.NewPubSub()
+		repo := mocks.NewMessageRepository()
+		counter := newCounterMock()
+		cfg := writers.Config{
+			SubjectsConfigPath: subjectsCfgPath,
+			Counter:            counter,
+		}
+		c, err := writers.StartConsumer(ps, repo, tc.transformer, cfg, testLog)
+		require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", tc.desc, err))
+
+		m := msg
+		m.Subtopic = "format"
+		m.Payload = []byte(tc.payload)
+		err = ps.Publish(nats.SubjectAllChannels, m)
+		assert.Nil(t, err, fmt.Sprintf("%s: expected message to be acknowledged got %s", tc.desc, err))
+
+		rep, err := c.Shutdown(context.Background())
+		require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", tc.desc, err))
+		assert.Equal(t, tc.written, len(repo.Messages()), fmt.Sprintf("%s: expected %d saved messages got %d", tc.desc, tc.written, len(repo.Messages())))
+		assert.Equal(t, tc.empty, rep.Empty, fmt.Sprintf("%s: expected %d empty messages got %d", tc.desc, tc.empty, rep.Empty))
+		assert.Equal(t, uint64(0), rep.DeadLettered, fmt.Sprintf("%s: expected no dead-lettered messages got %d", tc.desc, rep.DeadLettered))
+		empty := counter.value("subject", nats.SubjectAllChannels, "status", "empty")
+		assert.Equal(t, float64(tc.empty), empty, fmt.Sprintf("%s: expected %d counted empty messages got %v", tc.desc, tc.empty, empty))
+	}
+}
+
+func TestTimestampPolicy(t *testing.T) {
+	valid := msg
+	valid.Created = time.Now().UnixNano()
+	malformed := valid
+	malformed.Payload = []byte(`[{"bn":"base-name","n":"temp","v":21.5,"t":-1e12}]`)
+	future := valid
+	future.Payload = []byte(`[{"bn":"base-name","n":"temp","v":21.5,"t":4102444800}]`)
+
+	cases := []struct {
+		desc    string
+		policy  writers.TimestampPolicy
+		msg     messaging.Message
+		written int
+		clamped bool
+		status  string
+		err     error
+	}{
+		{
+			desc:    "write valid timestamp",
+			policy:  writers.TimestampReject,
+			msg:     valid,
+			written: 1,
+		},
+		{
+			desc:    "accept malformed timestamp",
+			policy:  writers.TimestampAccept,
+			msg:     malformed,
+			written: 1,
+			status:  "timestamp_accepted",
+		},
+		{
+			desc:    "accept far-future timestamp",
+			policy:  writers.TimestampAccept,
+			msg:     future,
+			written: 1,
+			status:  "timestamp_accepted",
+		},
+		{
+			desc:    "clamp malformed timestamp",
+			policy:  writers.TimestampClamp,
+			msg:     malformed,
+			written: 1,
+			clamped: true,
+			status:  "timestamp_clamped",
+		},
+		{
+			desc:    "clamp far-future timestamp",
+			policy:  writers.TimestampClamp,
+			msg:     future,
+			written: 1,
+			clamped: true,
+			status:  "timestamp_clamped",
+		},
+		{
+			desc:    "reject malformed timestamp",
+			policy:  writers.TimestampReject,
+			msg:     malformed,
+			written: 0,
+			status:  "timestamp_rejected",
+			err:     writers.ErrInvalidTimestamp,
+		},
+		{
+			desc:    "reject far-future timestamp",
+			policy:  writers.TimestampReject,
+			msg:     future,
+			written: 0,
+			status:  "timestamp_rejected",
+			err:     writers.ErrInvalidTimestamp,
+		},
+	}
+
+	for _, tc := range cases {
+		ps := mocks.NewPubSub()
+		repo := mocks.NewMessageRepository()
+		counter := newCounterMock()
+		cfg := writers.Config{
+			SubjectsConfigPath: subjectsCfgPath,
+			Counter:            counter,
+			TimestampPolicy:    tc.policy,
+			MaxFutureSkew:      time.Hour,
+		}
+		c, err := writers.StartConsumer(ps, repo, senml.New(senml.JSON), cfg, testLog)
+		require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", tc.desc, err))
+
+		before := float64(time.Now().UnixNano()) / float64(1e9)
+		err = ps.Publish(nats.SubjectAllChannels, tc.msg)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s", tc.desc, tc.err, err))
+		after := float64(time.Now().UnixNano()) / float64(1e9)
+
+		rep, err := c.Shutdown(context.Background())
+		require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", tc.desc, err))
+
+		saved := repo.Messages()
+		require.Equal(t, tc.written, len(saved), fmt.Sprintf("%s: expected %d saved messages got %d", tc.desc, tc.written, len(saved)))
+		if tc.clamped {
+			ts := saved[0].([]senml.Message)[0].Time
+			assert.True(t, ts >= before && ts <= after, fmt.Sprintf("%s: expected time between %v and %v got %v", tc.desc, before, after, ts))
+		}
+
+		outcomes := rep.TimestampsAccepted + rep.TimestampsClamped + rep.TimestampsRejected
+		for _, status := range []string{"timestamp_accepted", "timestamp_clamped", "timestamp_rejected"} {
+			want := 0.0
+			if status == tc.status {
+				want = 1
+			}
+			v := counter.value("subject", nats.SubjectAllChannels, "status", status)
+			assert.Equal(t, want, v, fmt.Sprintf("%s: expected %v %s messages got %v", tc.desc, want, status, v))
+		}
+		if tc.status == "" {
+			assert.Equal(t, uint64(0), outcomes, fmt.Sprintf("%s: expected no bad timestamps got %d", tc.desc, outcomes))
+			continue
+		}
+		assert.Equal(t, uint64(1), outcomes, fmt.Sprintf("%s: expected one bad timestamp got %d", tc.desc, outcomes))
+	}
+
+	_, err := writers.StartConsumer(mocks.NewPubSub(), mocks.NewMessageRepository(), senml.New(senml.JSON), writers.Config{TimestampPolicy: "drop"}, testLog)
+	assert.True(t, errors.Contains(err, writers.ErrInvalidTimestampPolicy), fmt.Sprintf("expected %s got %s", writers.ErrInvalidTimestampPolicy, err))
+}
+
+func TestTimestampSkew(t *testing.T) {
+	// Relative SenML times are resolved against the message creation time.
+	skewed := func(offset string) messaging.Message {
+		m := msg
+		m.Created = time.Now().UnixNano()
+		m.Payload = []byte(fmt.Sprintf(`[{"bn":"base-name","n":"temp","v":21.5,"t":%s}]`, offset))
+		return m
+	}
+
+	cases := []struct {
+		desc    string
+		msg     messaging.Message
+		written int
+		err     error
+	}{
+		{
+			desc:    "write timestamp just inside the past skew",
+			msg:     skewed("-3540"),
+			written: 1,
+			err:     nil,
+		},
+		{
+			desc:    "reject timestamp just outside the past skew",
+			msg:     skewed("-3660"),
+			written: 0,
+			err:     writers.ErrInvalidTimestamp,
+		},
+		{
+			desc:    "write timestamp just inside the future skew",
+			msg:     skewed("3540"),
+			written: 1,
+			err:     nil,
+		},
+		{
+			desc:    "reject timestamp just outside the future skew",
+			msg:     skewed("3660"),
+			written: 0,
+			err:     writers.ErrInvalidTimestamp,
+		},
+	}
+
+	for _, tc := range cases {
+		ps := mocks.NewPubSub()
+		repo := mocks.NewMessageRepository()
+		counter := newCounterMock()
+		cfg := writers.Config{
+			SubjectsConfigPath: subjectsCfgPath,
+			Counter:            counter,
+			TimestampPolicy:    writers.TimestampReject,
+			MaxFutureSkew:      time.Hour,
+			MaxPastSkew:        time.Hour,
+		}
+		c, err := writers.StartConsumer(ps, repo, senml.New(senml.JSON), cfg, testLog)
+		require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", tc.desc, err))
+
+		err = ps.Publish(nats.SubjectAllChannels, tc.msg)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s", tc.desc, tc.err, err))
+
+		rep, err := c.Shutdown(context.Background())
+		require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", tc.desc, err))
+		assert.Equal(t, tc.written, len(repo.Messages()), fmt.Sprintf("%s: expected %d saved messages got %d", tc.desc, tc.written, len(repo.Messages())))
+
+		rejected := uint64(1 - tc.written)
+		assert.Equal(t, rejected, rep.TimestampsRejected, fmt.Sprintf("%s: expected %d rejected timestamps got %d", tc.desc, rejected, rep.TimestampsRejected))
+		v := counter.value("subject", nats.SubjectAllChannels, "status", "timestamp_rejected")
+		assert.Equal(t, float64(rejected), v, fmt.Sprintf("%s: expected %d counted rejected timestamps got %v", tc.desc, rejected, v))
+	}
+}
+
+func TestReload(t *testing.T) {
+	subject := "channels.reloaded"
+	jsonMsg := msg
+	jsonMsg.Subtopic = "json"
+	jsonMsg.Payload = []byte(`{"temp":21.5}`)
+
+	ps := mocks.NewPubSub()
+	repo := mocks.NewMessageRepository()
+	cfg := writers.Config{
+		Streams: []writers.Stream{{Subject: subject}},
+	}
+	c, err := writers.StartConsumer(ps, repo, senml.New(senml.JSON), cfg, testLog)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+
+	err = ps.Publish(subject, jsonMsg)
+	assert.NotNil(t, err, "expected JSON message to be rejected by the SenML transformer")
+
+	cases := []struct {
+		desc     string
+		pipeline writers.Pipeline
+		err      error
+	}{
+		{
+			desc:     "reload pipeline with a new stream",
+			pipeline: writers.Pipeline{Streams: []writers.Stream{{Subject: subject}, {Subject: "channels.other"}}},
+			err:      writers.ErrInvalidPipeline,
+		},
+		{
+			desc:     "reload pipeline with a replaced stream",
+			pipeline: writers.Pipeline{Streams: []writers.Stream{{Subject: "channels.other", Transformer: json.New()}}},
+			err:      writers.ErrInvalidPipeline,
+		},
+		{
+			desc:     "reload pipeline without streams",
+			pipeline: writers.Pipeline{Transformer: json.New()},
+			err:      writers.ErrInvalidPipeline,
+		},
+	}
+
+	for _, tc := range cases {
+		err := c.Reload(tc.pipeline)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s", tc.desc, tc.err, err))
+		err = ps.Publish(subject, msg)
+		assert.Nil(t, err, fmt.Sprintf("%s: expected the current transformer to be kept got %s", tc.desc, err))
+	}
+
+	err = c.Reload(writers.Pipeline{Streams: []writers.Stream{{Subject: subject, Transformer: json.New()}}})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	err = ps.Publish(subject, jsonMsg)
+	assert.Nil(t, err, fmt.Sprintf("expected JSON message to be written after reload got %s", err))
+
+	// Going back to a pipeline without a stream transformer restores the
+	// consumer transformer.
+	err = c.Reload(writers.Pipeline{Streams: []writers.Stream{{Subject: subject}}})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	err = ps.Publish(subject, msg)
+	assert.Nil(t, err, fmt.Sprintf("expected SenML message to be written after reload got %s", err))
+
+	msgs := repo.Messages()
+	require.Len(t, msgs, len(cases)+2, fmt.Sprintf("expected %d written messages got %d", len(cases)+2, len(msgs)))
+	_, ok := msgs[len(cases)].(json.Messages)
+	assert.True(t, ok, fmt.Sprintf("expected JSON message got %T", msgs[len(cases)]))
+	_, ok = msgs[len(cases)+1].([]senml.Message)
+	assert.True(t, ok, fmt.Sprintf("expected SenML message got %T", msgs[len(cases)+1]))
+}
+
+func TestReloadInFlight(t *testing.T) {
+	subject := "channels.reloaded"
+	ps := mocks.NewPubSub()
+	repo := newGateRepository()
+	cfg := writers.Config{
+		Streams: []writers.Stream{{Subject: subject}},
+	}
+	c, err := writers.StartConsumer(ps, repo, senml.New(senml.JSON), cfg, testLog)
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+
+	errs := make(chan error, 1)
+	go func() { errs <- ps.Publish(subject, msg) }()
+	<-repo.started
+
+	err = c.Reload(writers.Pipeline{Streams: []writers.Stream{{Subject: subject, Transformer: json.New()}}})
+	require.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	close(repo.release)
+
+	err = <-errs
+	assert.Nil(t, err, fmt.Sprintf("expected in-flight message to be written with the previous transformer got %s", err))
+}
+
+// deadLetterMock records the published messages, or fails to publish them
+// with the error.
+type deadLetterMock struct {
+	mu       sync.Mutex
+	err      error
+	subjects []string
+}
+
+func (dl *deadLetterMock) PublishSubject(subject string, msg messaging.Message) error {
+	dl.mu.Lock()
+	defer dl.mu.Unlock()
+	if dl.err != nil {
+		return dl.err
+	}
+	dl.subjects = append(dl.subjects, subject)
+	return nil
+}
+
+func TestDeadLetter(t *testing.T) {
+	invalid := msg
+	invalid.Payload = []byte("invalid")
+	subject := "dead_letters.writer"
+
+	cases := []struct {
+		desc     string
+		repo     writers.MessageRepository
+		msg      messaging.Message
+		err      error
+		subjects []string
+		report   writers.ShutdownReport
+	}{
+		{
+			desc:     "republish message the repository failed to save",
+			repo:     failingRepository{},
+			msg:      msg,
+			subjects: []string{subject},
+			report:   writers.ShutdownReport{Consumed: 1, Failed: 1, Republished: 1},
+		},
+		{
+			desc:     "republish message rejected by the repository",
+			repo:     rejectingRepository{},
+			msg:      msg,
+			subjects: []string{subject},
+			report:   writers.ShutdownReport{Consumed: 1, DeadLettered: 1, Republished: 1},
+		},
+		{
+			desc:     "republish message failing to be transformed",
+			repo:     mocks.NewMessageRepository(),
+			msg:      invalid,
+			subjects: []string{subject},
+			report:   writers.ShutdownReport{Consumed: 1, DeadLettered: 1, Republished: 1},
+		},
+		{
+			desc:   "drop message failing to be republished",
+			repo:   failingRepository{},
+			msg:    msg,
+			err:    errors.New("nats: connection closed"),
+			report: writers.ShutdownReport{Consumed: 1, Failed: 1, Dropped: 1},
+		},
+		{
+			desc:   "write message",
+			repo:   mocks.NewMessageRepository(),
+			msg:    msg,
+			report: writers.ShutdownReport{Consumed: 1, Written: 1},
+		},
+	}
+
+	for _, tc := range cases {
+		ps := mocks.NewPubSub()
+		dl := &deadLetterMock{err: tc.err}
+		c, err := writers.StartConsumer(ps, tc.repo, senml.New(senml.JSON), writers.Config{
+			SubjectsConfigPath: subjectsCfgPath,
+			DeadLetter:         dl,
+			DeadLetterSubject:  subject,
+		}, testLog)
+		require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", tc.desc, err))
+
+		ps.Publish(nats.SubjectAllChannels, tc.msg)
+		rep, err := c.Shutdown(context.Background())
+		require.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", tc.desc, err))
+		assert.Equal(t, tc.report, rep, fmt.Sprintf("%s: expected %v got %v", tc.desc, tc.report, rep))
+		assert.Equal(t, tc.subjects, dl.subjects, fmt.Sprintf("%s: expected dead letters on %v got %v", tc.desc, tc.subjects, dl.subjects))
+	}
+}
+
+func TestDeadLetterSubject(t *testing.T) {
+	cases := []struct {
+		desc    string
+		subject string
+		err     error
+	}{
+		{
+			desc:    "start consumer with dead-letter subject",
+			subject: "dead_letters.writer",
+			err:     nil,
+		},
+		{
+			desc:    "start consumer with empty dead-letter subject",
+			subject: "",
+			err:     writers.ErrInvalidDeadLetterSubject,
+		},
+		{
+			desc:    "start consumer with wildcard dead-letter subject",
+			subject: "dead_letters.*",
+			err:     writers.ErrInvalidDeadLetterSubject,
+		},
+		{
+			desc:    "start consumer with consumed dead-letter subject",
+			subject: "channels.dead_letters",
+			err:     writers.ErrInvalidDeadLetterSubject,
+		},
+	}
+
+	for _, tc := range cases {
+		_, err := writers.StartConsumer(mocks.NewPubSub(), mocks.NewMessageRepository(), senml.New(senml.JSON), writers.Config{
+			SubjectsConfigPath: subjectsCfgPath,
+			DeadLetter:         &deadLetterMock{},
+			DeadLetterSubject:  tc.subject,
+		}, testLog)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s\n", tc.desc, tc.err, err))
+	}
+}